@@ -0,0 +1,257 @@
+// Package client is a Go client of the record API. Client sends untyped
+// values, Collection reads and writes values of one Go type
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mit-service/internal/codec"
+)
+
+// ErrNotFound is returned when the record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrVersionConflict is returned when a write expected another version of
+// the record than the current one
+var ErrVersionConflict = errors.New("record version conflict")
+
+// ErrReserved is returned when a record ID is reserved by another caller
+var ErrReserved = errors.New("record ID is reserved")
+
+// Error is a response of the service with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mit-service: %d %s", e.StatusCode, e.Message)
+}
+
+// Is makes 404 responses match ErrNotFound, version conflicts
+// ErrVersionConflict and reserved IDs ErrReserved
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrVersionConflict:
+		return e.StatusCode == http.StatusConflict && strings.HasPrefix(e.Message, "Record version conflict")
+	case ErrReserved:
+		return e.StatusCode == http.StatusConflict && strings.Contains(e.Message, "record ID is reserved")
+	}
+	return false
+}
+
+// RawRecord is a record with its value left encoded
+type RawRecord struct {
+	ID    string          `json:"id"`
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value"`
+	Hash  string          `json:"hash,omitempty"`
+
+	// Version is the version to pass to UpdateIfVersion and DeleteIfVersion
+	Version int64 `json:"version,omitempty"`
+}
+
+// Client calls the record API of one service instance
+type Client struct {
+	baseURL string
+	http    *http.Client
+	header  http.Header
+	codecs  *codec.Registry
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with client instead of
+// http.DefaultClient
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.http = client
+	}
+}
+
+// WithHeader adds a header to every request, e.g. Authorization
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// New creates a client of the service at baseURL, e.g.
+// "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+		header:  make(http.Header),
+		codecs:  codec.NewRegistry(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Insert queues the insert of a record and returns its consistency token.
+// recordType is optional
+func (c *Client) Insert(ctx context.Context, id, recordType string, value map[string]interface{}) (string, error) {
+	return c.write(ctx, "/insert", map[string]interface{}{"id": id, "type": recordType, "value": value})
+}
+
+// Reservation is a claim on a record ID, see Reserve
+type Reservation struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Reserve claims the unused record ID id for lease, the default lease of
+// the service for 0. Until it expires only InsertReserved with the token of
+// the reservation can create the record; reserving it again fails with
+// ErrReserved
+func (c *Client) Reserve(ctx context.Context, id string, lease time.Duration) (*Reservation, error) {
+	body := map[string]interface{}{"id": id}
+	if lease > 0 {
+		body["lease"] = lease.String()
+	}
+
+	var reservation Reservation
+	if err := c.do(ctx, http.MethodPost, "/reserve", body, &reservation); err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// InsertReserved queues the insert of a record reserved with Reserve and
+// returns its consistency token
+func (c *Client) InsertReserved(ctx context.Context, reservation *Reservation, recordType string, value map[string]interface{}) (string, error) {
+	return c.write(ctx, "/insert", map[string]interface{}{
+		"id": reservation.ID, "type": recordType, "value": value, "reservation": reservation.Token,
+	})
+}
+
+// InsertRequest is a record to insert with InsertBatch. Type is optional
+type InsertRequest struct {
+	ID    string                 `json:"id"`
+	Type  string                 `json:"type,omitempty"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// InsertBatch queues the inserts of several records in one request and
+// returns their consistency tokens in order. When one record is invalid
+// none is queued
+func (c *Client) InsertBatch(ctx context.Context, records []InsertRequest) ([]string, error) {
+	var response struct {
+		ConsistencyTokens []string `json:"consistency_tokens"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/insert/batch", records, &response); err != nil {
+		return nil, err
+	}
+	return response.ConsistencyTokens, nil
+}
+
+// Update queues the update of a record and returns its consistency token
+func (c *Client) Update(ctx context.Context, id string, value map[string]interface{}) (string, error) {
+	return c.write(ctx, "/update", map[string]interface{}{"id": id, "value": value})
+}
+
+// Delete queues the delete of a record and returns its consistency token
+func (c *Client) Delete(ctx context.Context, id string) (string, error) {
+	return c.write(ctx, "/delete", map[string]interface{}{"id": id})
+}
+
+// UpdateIfVersion queues the update of a record read with version, failing
+// with ErrVersionConflict when it changed since. The write itself may still
+// fail when another one is applied first, reading it with the consistency
+// token then returns a 409 Error
+func (c *Client) UpdateIfVersion(ctx context.Context, id string, value map[string]interface{}, version int64) (string, error) {
+	return c.write(ctx, "/update", map[string]interface{}{"id": id, "value": value, "expected_version": version})
+}
+
+// DeleteIfVersion queues the delete of a record read with version, failing
+// with ErrVersionConflict when it changed since
+func (c *Client) DeleteIfVersion(ctx context.Context, id string, version int64) (string, error) {
+	return c.write(ctx, "/delete", map[string]interface{}{"id": id, "expected_version": version})
+}
+
+// Get reads a record. With a consistency token of a write the read waits
+// until that write is applied
+func (c *Client) Get(ctx context.Context, id, consistencyToken string) (*RawRecord, error) {
+	query := url.Values{"id": {id}}
+	if consistencyToken != "" {
+		query.Set("consistency_token", consistencyToken)
+	}
+
+	var record RawRecord
+	if err := c.do(ctx, http.MethodGet, "/get?"+query.Encode(), nil, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// write sends a write request and returns the consistency token
+func (c *Client) write(ctx context.Context, path string, body interface{}) (string, error) {
+	var response struct {
+		ConsistencyToken string `json:"consistency_token"`
+	}
+	if err := c.do(ctx, http.MethodPost, path, body, &response); err != nil {
+		return "", err
+	}
+	return response.ConsistencyToken, nil
+}
+
+// do sends a request and decodes the response into out
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var response struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&response) != nil || response.Error == "" {
+			response.Error = http.StatusText(resp.StatusCode)
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: response.Error}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
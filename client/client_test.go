@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/handler"
+	"mit-service/internal/metrics"
+	"mit-service/internal/repository"
+	"mit-service/internal/service"
+)
+
+type user struct {
+	Name  string   `json:"name"`
+	Age   int      `json:"age"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// newTestClient starts a service with a mock repository and returns a
+// client of it
+func newTestClient(t *testing.T, opts ...service.Option) *Client {
+	t.Helper()
+	mock := repository.NewMockRepository()
+	appMetrics := metrics.NewMetrics()
+	svc := service.NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, appMetrics, opts...)
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond)
+	t.Cleanup(func() { svc.Close() })
+
+	server := httptest.NewServer(handler.SetupRoutes(svc, appMetrics))
+	t.Cleanup(server.Close)
+	return New(server.URL)
+}
+
+func TestCollection(t *testing.T) {
+	ctx := context.Background()
+	users, err := NewCollection[user](newTestClient(t), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	token, err := users.Insert(ctx, "user_1", user{Name: "Ada", Age: 36, Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record, err := users.Get(ctx, "user_1", token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record.ID != "user_1" || record.Value.Name != "Ada" || record.Value.Age != 36 || len(record.Value.Roles) != 1 {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	if token, err = users.Update(ctx, "user_1", user{Name: "Ada", Age: 37}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record, err = users.Get(ctx, "user_1", token); err != nil || record.Value.Age != 37 {
+		t.Errorf("Expected the updated value, got %+v, %v", record, err)
+	}
+
+	if token, err = users.Delete(ctx, "user_1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = users.Get(ctx, "user_1", token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := users.Insert(ctx, "", user{Name: "nobody"}); err == nil || !strings.Contains(err.Error(), "ID cannot be empty") {
+		t.Errorf("Expected the error of the service, got %v", err)
+	}
+}
+
+func TestClient_InsertBatch(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	tokens, err := c.InsertBatch(ctx, []InsertRequest{
+		{ID: "user_1", Value: map[string]interface{}{"name": "Ada"}},
+		{ID: "user_2", Value: map[string]interface{}{"name": "Grace"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("Expected a token per record, got %v", tokens)
+	}
+	for i, id := range []string{"user_1", "user_2"} {
+		record, err := c.Get(ctx, id, tokens[i])
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(string(record.Value), `"name"`) {
+			t.Errorf("Unexpected record %+v", record)
+		}
+	}
+
+	// An invalid record fails the whole batch
+	_, err = c.InsertBatch(ctx, []InsertRequest{
+		{ID: "user_3", Value: map[string]interface{}{"name": "Barbara"}},
+		{ID: "user_4", Type: "unknown", Value: map[string]interface{}{"name": "Frances"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "record 1 (user_4)") {
+		t.Errorf("Expected the error of the second record, got %v", err)
+	}
+	if _, err := c.Get(ctx, "user_3", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected nothing queued, got %v", err)
+	}
+}
+
+func TestClient_UpdateIfVersion(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	token, err := c.Insert(ctx, "user_1", "", map[string]interface{}{"name": "Ada"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record, err := c.Get(ctx, "user_1", token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	token, err = c.UpdateIfVersion(ctx, "user_1", map[string]interface{}{"name": "Grace"}, record.Version)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.Get(ctx, "user_1", token); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The record changed since it was read
+	_, err = c.UpdateIfVersion(ctx, "user_1", map[string]interface{}{"name": "Barbara"}, record.Version)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, got %v", err)
+	}
+	if _, err := c.DeleteIfVersion(ctx, "user_1", record.Version); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, got %v", err)
+	}
+}
+
+func TestClient_Reserve(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, service.WithReservations(time.Hour))
+
+	reservation, err := c.Reserve(ctx, "order_1", 30*time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.Reserve(ctx, "order_1", 0); !errors.Is(err, ErrReserved) {
+		t.Errorf("Expected the ID reserved, got %v", err)
+	}
+	if _, err := c.Insert(ctx, "order_1", "", map[string]interface{}{"total": 1}); !errors.Is(err, ErrReserved) {
+		t.Errorf("Expected an insert without the token rejected, got %v", err)
+	}
+
+	token, err := c.InsertReserved(ctx, reservation, "", map[string]interface{}{"total": 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.Get(ctx, "order_1", token); err != nil {
+		t.Errorf("Expected the reserved record inserted, got %v", err)
+	}
+}
+
+// upperCodec stores names upper-cased
+type upperCodec struct{}
+
+func (upperCodec) Encode(value user) (map[string]interface{}, error) {
+	return map[string]interface{}{"name": strings.ToUpper(value.Name), "age": value.Age}, nil
+}
+
+func (upperCodec) Decode(data json.RawMessage) (user, error) {
+	var value user
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+func TestCollection_Codec(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	RegisterCodec[user](c, "", upperCodec{})
+
+	if _, err := NewCollection[map[string]interface{}](c, ""); err == nil {
+		t.Error("Expected an error for a collection of another Go type")
+	}
+
+	users, err := NewCollection[user](c, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	token, err := users.Insert(ctx, "user_1", user{Name: "Ada"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record, err := c.Get(ctx, "user_1", token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(record.Value), `"ADA"`) {
+		t.Errorf("Expected the value encoded by the codec, got %s", record.Value)
+	}
+
+	// Values that are not JSON objects are rejected before they are sent
+	numbers, err := NewCollection[int](c, "number")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := numbers.Insert(ctx, "n", 1); err == nil {
+		t.Error("Expected an error for a value that is not a JSON object")
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+
+	"mit-service/internal/codec"
+)
+
+// Codec converts record values of type T to and from JSON objects
+type Codec[T any] interface {
+	codec.Codec[T]
+}
+
+// RegisterCodec makes the collections of recordType created from c convert
+// values with cdc instead of encoding/json
+func RegisterCodec[T any](c *Client, recordType string, cdc Codec[T]) {
+	codec.Register[T](c.codecs, recordType, cdc)
+}
+
+// Record is a record whose value is of type T
+type Record[T any] struct {
+	ID    string
+	Type  string
+	Value T
+	Hash  string
+}
+
+// Collection reads and writes the records of one record type, whose values
+// are of type T
+type Collection[T any] struct {
+	client     *Client
+	recordType string
+	codec      codec.Codec[T]
+}
+
+// NewCollection creates a collection of the records of recordType, empty
+// for untyped records. Values are converted with the codec registered for
+// recordType, encoding/json by default. It fails when the codec registered
+// converts another Go type
+func NewCollection[T any](c *Client, recordType string) (*Collection[T], error) {
+	cdc, err := codec.For[T](c.codecs, recordType)
+	if err != nil {
+		return nil, err
+	}
+	return &Collection[T]{client: c, recordType: recordType, codec: cdc}, nil
+}
+
+// Insert queues the insert of a record and returns its consistency token
+func (c *Collection[T]) Insert(ctx context.Context, id string, value T) (string, error) {
+	encoded, err := c.codec.Encode(value)
+	if err != nil {
+		return "", err
+	}
+	return c.client.Insert(ctx, id, c.recordType, encoded)
+}
+
+// Update queues the update of a record and returns its consistency token
+func (c *Collection[T]) Update(ctx context.Context, id string, value T) (string, error) {
+	encoded, err := c.codec.Encode(value)
+	if err != nil {
+		return "", err
+	}
+	return c.client.Update(ctx, id, encoded)
+}
+
+// Delete queues the delete of a record and returns its consistency token
+func (c *Collection[T]) Delete(ctx context.Context, id string) (string, error) {
+	return c.client.Delete(ctx, id)
+}
+
+// Get reads a record and decodes its value. With a consistency token of a
+// write the read waits until that write is applied
+func (c *Collection[T]) Get(ctx context.Context, id, consistencyToken string) (*Record[T], error) {
+	raw, err := c.client.Get(ctx, id, consistencyToken)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := c.codec.Decode(raw.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &Record[T]{ID: raw.ID, Type: raw.Type, Value: value, Hash: raw.Hash}, nil
+}
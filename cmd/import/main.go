@@ -0,0 +1,160 @@
+// Command import loads a legacy key-value dump into a running service through
+// its bulk import endpoint (POST /admin/import).
+//
+//	go run ./cmd/import -format csv -file users.csv -id-field user_id -id-prefix user_ \
+//	    -url http://localhost:8080 -token $ADMIN_TOKEN
+//
+// Progress is kept in a checkpoint file next to the dump, so an interrupted
+// import continues where it stopped when run again with the same arguments
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"mit-service/internal/importer"
+)
+
+func main() {
+	var (
+		format     = flag.String("format", importer.FormatJSONLines, "dump format: jsonl, csv or redis-json (output of `rdb --command json`)")
+		file       = flag.String("file", "", "dump file to import (required)")
+		url        = flag.String("url", "http://localhost:8080", "base URL of the service")
+		token      = flag.String("token", os.Getenv("ADMIN_TOKEN"), "admin token of the service, defaults to $ADMIN_TOKEN")
+		idField    = flag.String("id-field", "", "row field holding the record ID (default \"id\", \"key\" for redis-json)")
+		idPrefix   = flag.String("id-prefix", "", "prefix added to every record ID")
+		valueField = flag.String("value-field", "", "row field holding the value (default: the other fields as an object, \"value\" for redis-json)")
+		recordType = flag.String("type", "", "record type set on every record")
+		rename     = flag.String("rename", "", "renames of value fields, e.g. old=new,fname=first_name")
+		drop       = flag.String("drop", "", "comma-separated value fields to drop")
+		parseJSON  = flag.Bool("parse-json", false, "decode string values holding JSON objects or arrays")
+		batchSize  = flag.Int("batch-size", 500, "records per import request (at most 10000)")
+		overwrite  = flag.Bool("overwrite", false, "replace existing records holding a different value")
+		dryRun     = flag.Bool("dry-run", false, "only report what the import would do")
+		checkpoint = flag.String("checkpoint", "", "progress file for resuming (default <file>.checkpoint, \"-\" disables)")
+		retries    = flag.Int("retries", 5, "retries of a failed import request")
+		interval   = flag.Duration("progress-interval", 10*time.Second, "how often progress is logged")
+	)
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	mapping, err := buildMapping(*format, *idField, *idPrefix, *valueField, *recordType, *rename, *drop, *parseJSON)
+	if err != nil {
+		log.Fatalf("Invalid mapping: %v", err)
+	}
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Failed to open dump: %v", err)
+	}
+	defer input.Close()
+
+	reader, err := importer.NewReader(*format, input)
+	if err != nil {
+		log.Fatalf("Failed to read dump: %v", err)
+	}
+
+	checkpointPath := *checkpoint
+	switch checkpointPath {
+	case "":
+		checkpointPath = *file + ".checkpoint"
+	case "-":
+		checkpointPath = ""
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	started := time.Now()
+	lastReport := started
+	progress, err := importer.Load(ctx, reader, mapping, importer.Options{
+		URL:        *url,
+		Token:      *token,
+		BatchSize:  *batchSize,
+		Overwrite:  *overwrite,
+		DryRun:     *dryRun,
+		Input:      *file,
+		Checkpoint: checkpointPath,
+		Retries:    *retries,
+		RetryDelay: time.Second,
+		Progress: func(p *importer.Progress) {
+			if time.Since(lastReport) >= *interval {
+				lastReport = time.Now()
+				logProgress(p, started)
+			}
+		},
+		Invalid: func(row int, err error) {
+			log.Printf("Skipping row %d: %v", row, err)
+		},
+	})
+	if progress != nil {
+		logProgress(progress, started)
+		for _, importErr := range progress.Errors {
+			log.Printf("Failed to import %s: %s", importErr.ID, importErr.Error)
+		}
+	}
+	if err != nil {
+		if checkpointPath != "" {
+			log.Fatalf("Import stopped: %v (run again to resume from %s)", err, checkpointPath)
+		}
+		log.Fatalf("Import stopped: %v", err)
+	}
+	log.Printf("Import completed in %v", time.Since(started).Round(time.Millisecond))
+}
+
+// buildMapping returns the mapping rules from the flags, defaulting the ID and
+// value fields per format
+func buildMapping(format, idField, idPrefix, valueField, recordType, rename, drop string, parseJSON bool) (*importer.Mapping, error) {
+	if idField == "" {
+		idField = "id"
+		if format == importer.FormatRedisJSON {
+			idField = "key"
+		}
+	}
+	if valueField == "" && format == importer.FormatRedisJSON {
+		valueField = "value"
+	}
+
+	renames, err := importer.ParseRenames(rename)
+	if err != nil {
+		return nil, err
+	}
+
+	var dropped []string
+	for _, name := range strings.Split(drop, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			dropped = append(dropped, name)
+		}
+	}
+
+	return &importer.Mapping{
+		IDField:    idField,
+		IDPrefix:   idPrefix,
+		ValueField: valueField,
+		Type:       recordType,
+		Rename:     renames,
+		Drop:       dropped,
+		ParseJSON:  parseJSON,
+	}, nil
+}
+
+// logProgress logs the totals and the row rate of this run
+func logProgress(p *importer.Progress, started time.Time) {
+	rate := float64(p.Rows-p.Resumed) / time.Since(started).Seconds()
+	dryRun := ""
+	if p.DryRun {
+		dryRun = " (dry run)"
+	}
+	log.Printf("%d rows%s: %d created, %d updated, %d unchanged, %d skipped, %d failed, %d invalid, %d resumed (%.0f rows/s)",
+		p.Rows, dryRun, p.Created, p.Updated, p.Unchanged, p.Skipped, p.Failed, p.Invalid, p.Resumed, rate)
+}
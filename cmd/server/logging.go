@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+	"log/slog"
+	"os"
+
+	"mit-service/internal/config"
+	"mit-service/internal/version"
+)
+
+// setupLogging routes the standard logger through the configured format.
+// JSON logs carry the version as a field, text logs as a prefix
+func setupLogging(cfg config.LogConfig, info version.Info) {
+	if cfg.Format == config.LogFormatJSON {
+		handler := slog.NewJSONHandler(os.Stderr, nil)
+		slog.SetDefault(slog.New(handler).With("version", info.Version))
+		return
+	}
+
+	log.SetPrefix("[" + info.Version + "] ")
+}
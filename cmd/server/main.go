@@ -2,15 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"mit-service/internal/amqpconsumer"
 	"mit-service/internal/config"
 	"mit-service/internal/handler"
+	"mit-service/internal/importer"
 	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/mqttbridge"
+	"mit-service/internal/notify"
+	"mit-service/internal/objectstore"
 	"mit-service/internal/repository"
+	"mit-service/internal/search"
 	"mit-service/internal/service"
+	"mit-service/internal/version"
+	"mit-service/internal/warehouse"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -18,36 +29,561 @@ import (
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
-	log.Printf("Starting MIT Service with repository type: %s", cfg.Repository.Type)
+	info := version.Get()
+	setupLogging(cfg.Log, info)
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	log.Printf("Starting MIT Service %s (commit %s, built %s, %s) with repository type: %s",
+		info.Version, info.Commit, info.BuildDate, info.GoVersion, cfg.Repository.Type)
+	if cfg.Env != "" {
+		log.Printf("Using %s configuration profile", cfg.Env)
+	}
+
+	// Initialize metrics
+	httpBuckets, err := metrics.ParseBuckets(cfg.Server.HTTPDurationBuckets)
+	if err != nil {
+		log.Fatalf("Invalid HTTP_DURATION_BUCKETS: %v", err)
+	}
+	taskBuckets, err := metrics.ParseBuckets(cfg.Server.TaskDurationBuckets)
+	if err != nil {
+		log.Fatalf("Invalid TASK_DURATION_BUCKETS: %v", err)
+	}
+	appMetrics := metrics.NewMetrics(
+		metrics.WithHTTPDurationBuckets(httpBuckets),
+		metrics.WithTaskDurationBuckets(taskBuckets),
+		metrics.WithNativeHistograms(cfg.Server.NativeHistogramFactor),
+	)
+	log.Println("Metrics initialized successfully")
+
+	slos, err := metrics.ParseSLOs(cfg.Server.SLOs)
+	if err != nil {
+		log.Fatalf("Invalid SLOS: %v", err)
+	}
+	appMetrics.SetSLOs(slos)
+
+	if cfg.Server.TenantMetrics != "" {
+		var tenants []string
+		for _, tenant := range strings.Split(cfg.Server.TenantMetrics, ",") {
+			if tenant = strings.TrimSpace(tenant); tenant != "" {
+				tenants = append(tenants, tenant)
+			}
+		}
+		appMetrics.SetTenantLabels(tenants...)
+		log.Printf("Per-tenant metrics enabled for %d tenants, the others labelled \"other\"", len(tenants))
+	}
+
+	var anomalyDetector *metrics.AnomalyDetector
+	if cfg.Server.AnomalyInterval > 0 {
+		var hooks []metrics.AnomalyHook
+		if cfg.Server.AnomalyWebhookURL != "" {
+			hooks = append(hooks, metrics.WebhookHook(cfg.Server.AnomalyWebhookURL, 5*time.Second))
+		}
+		anomalyDetector = metrics.NewAnomalyDetector(appMetrics, metrics.AnomalyConfig{
+			Interval:    cfg.Server.AnomalyInterval,
+			Sensitivity: cfg.Server.AnomalySensitivity,
+			Baseline:    cfg.Server.AnomalyBaseline,
+			WarmUp:      10,
+		}, hooks...)
+		anomalyDetector.Start()
+		log.Printf("Anomaly detection enabled (interval: %v)", cfg.Server.AnomalyInterval)
+	}
 
 	// Initialize repository
-	repoManager, err := repository.NewRepositoryManager(cfg)
+	repoManager, err := repository.NewRepositoryManager(cfg, appMetrics)
 	if err != nil {
 		log.Fatalf("Failed to initialize repository: %v", err)
 	}
 
 	log.Println("Repository initialized successfully")
 
-	// Initialize metrics
-	appMetrics := metrics.NewMetrics()
-	log.Println("Metrics initialized successfully")
+	// Compare the live schema with the expected one, the mock has none
+	schemaCtx, cancelSchema := context.WithTimeout(context.Background(), 30*time.Second)
+	schemaReport, err := repoManager.CheckSchema(schemaCtx)
+	cancelSchema()
+	switch {
+	case errors.Is(err, models.ErrSchemaCheckUnsupported):
+	case err != nil && cfg.Repository.FailOnSchemaDrift:
+		log.Fatalf("Failed to check schema: %v", err)
+	case err != nil:
+		log.Printf("Failed to check schema: %v", err)
+	case !schemaReport.InSync:
+		for _, drift := range schemaReport.Drift {
+			where := drift.Table
+			if drift.Column != "" {
+				where += "." + drift.Column
+			}
+			log.Printf("Schema drift in %s: %s", where, drift.Issue)
+		}
+		if cfg.Repository.FailOnSchemaDrift {
+			log.Fatalf("Schema does not match the expected one (%d differences), refusing to start", len(schemaReport.Drift))
+		}
+	}
 
 	// Initialize service
-	svc := service.NewService(repoManager, appMetrics)
+	var svcOpts []service.Option
+	if cfg.Repository.TransactionalEnqueue {
+		if repoManager.Tx == nil {
+			log.Println("DB_TRANSACTIONAL_ENQUEUE requires single-database mode, ignoring")
+		} else {
+			svcOpts = append(svcOpts, service.WithTransactionalEnqueue())
+		}
+	}
+
+	transforms, err := service.ParseTransforms(cfg.Repository.WriteTransforms)
+	if err != nil {
+		log.Fatalf("Invalid WRITE_TRANSFORMS: %v", err)
+	}
+	if transforms.Len() > 0 {
+		svcOpts = append(svcOpts, service.WithTransforms(transforms))
+		log.Printf("Write transforms enabled (%d steps)", transforms.Len())
+	}
+
+	if cfg.Repository.ScriptRulesFile != "" {
+		scripts, err := service.LoadScriptRules(cfg.Repository.ScriptRulesFile, cfg.Repository.ScriptTimeout)
+		if err != nil {
+			log.Fatalf("Invalid SCRIPT_RULES_FILE: %v", err)
+		}
+		svcOpts = append(svcOpts, service.WithScriptRules(scripts))
+		log.Printf("Script rules enabled (%d rules)", scripts.Len())
+	}
+
+	retentionRules, err := service.ParseRetentionRules(cfg.Repository.RetentionRules)
+	if err != nil {
+		log.Fatalf("Invalid RETENTION_RULES: %v", err)
+	}
+	sandboxKeys, err := handler.ParseSandboxKeys(cfg.Server.SandboxKeys)
+	if err != nil {
+		log.Fatalf("Invalid SANDBOX_KEYS: %v", err)
+	}
+	if len(sandboxKeys) > 0 {
+		if cfg.Server.SandboxTTL <= 0 {
+			log.Fatalf("Invalid SANDBOX_TTL: %v, expected a positive duration", cfg.Server.SandboxTTL)
+		}
+		retentionRules = append(retentionRules, service.SandboxRetentionRule(cfg.Server.SandboxTTL))
+	}
+	tenantKeys, err := handler.ParseTenantKeys(cfg.Server.TenantKeys)
+	if err != nil {
+		log.Fatalf("Invalid TENANT_KEYS: %v", err)
+	}
+	if cfg.Server.TenantRequired && len(tenantKeys) == 0 && !cfg.Server.TenantHeader {
+		log.Fatalf("TENANT_REQUIRED needs TENANT_KEYS or TENANT_HEADER")
+	}
+	idStrategy, err := service.ParseIDStrategy(cfg.Repository.IDStrategy)
+	if err != nil {
+		log.Fatalf("Invalid ID_STRATEGY: %v", err)
+	}
+	if idStrategy != nil {
+		svcOpts = append(svcOpts, service.WithIDStrategy(idStrategy))
+		log.Printf("Inserts without ID get a generated %s ID", cfg.Repository.IDStrategy)
+	}
+	if cfg.Repository.ReservationMaxLease > 0 {
+		svcOpts = append(svcOpts, service.WithReservations(cfg.Repository.ReservationMaxLease))
+		retentionRules = append(retentionRules, service.ReservationRetentionRule(cfg.Repository.ReservationMaxLease))
+		log.Printf("Record ID reservations enabled (leases up to %v)", cfg.Repository.ReservationMaxLease)
+	}
+	if cfg.Repository.CompositeCacheSize > 0 {
+		svcOpts = append(svcOpts, service.WithCompositeCache(cfg.Repository.CompositeCacheSize, cfg.Repository.CompositeCacheTTL))
+	}
+	if len(retentionRules) > 0 {
+		svcOpts = append(svcOpts, service.WithRetentionRules(retentionRules))
+	}
+
+	svcOpts = append(svcOpts, service.WithReadinessThresholds(
+		cfg.Server.ReadyWorkerStallTimeout, cfg.Server.ReadyMaxBacklogAge))
+	svcOpts = append(svcOpts, service.WithConsistencyWait(cfg.Server.ConsistencyMaxWait))
+
+	var shadow repository.RecordRepository
+	if cfg.Shadow.Enabled {
+		shadow, err = repository.NewShadowRepository(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize shadow repository: %v", err)
+		}
+		svcOpts = append(svcOpts, service.WithShadowRepository(shadow))
+		log.Printf("Shadow repository enabled (target: %s)", cfg.ShadowDB.Address())
+	}
+
+	svc := service.NewService(repoManager, appMetrics, svcOpts...)
+
+	if cfg.Shadow.Writes {
+		err := svc.StartShadowWrites(service.ShadowConfig{
+			ReadSampleRate: cfg.Shadow.ReadSampleRate,
+			ReadTimeout:    cfg.Shadow.ReadTimeout,
+		})
+		if err != nil {
+			log.Fatalf("Invalid shadow configuration: %v", err)
+		}
+		log.Printf("Shadow writes enabled (read sample rate: %g)", cfg.Shadow.ReadSampleRate)
+	}
 
 	// Start inbox worker
+	var workerOpts []service.WorkerOption
+	if cfg.InboxWorker.AdaptiveBatch {
+		workerOpts = append(workerOpts, service.WithAdaptiveBatching(
+			cfg.InboxWorker.MinBatchSize,
+			cfg.InboxWorker.MaxBatchSize,
+			cfg.InboxWorker.BatchTargetLatency,
+			cfg.InboxWorker.BatchMaxErrorRate,
+		))
+		log.Printf("Adaptive batch sizing enabled (min: %d, max: %d)",
+			cfg.InboxWorker.MinBatchSize, cfg.InboxWorker.MaxBatchSize)
+	}
+
+	if cfg.InboxWorker.BatchConcurrency > 1 {
+		workerOpts = append(workerOpts, service.WithBatchConcurrency(cfg.InboxWorker.BatchConcurrency))
+		log.Printf("Intra-batch concurrency enabled (%d)", cfg.InboxWorker.BatchConcurrency)
+	}
+
+	if cfg.InboxWorker.DependencyRetryTimeout > 0 {
+		workerOpts = append(workerOpts, service.WithDependencyRetryTimeout(cfg.InboxWorker.DependencyRetryTimeout))
+	}
+
+	if cfg.InboxWorker.TaskTrace {
+		workerOpts = append(workerOpts, service.WithTaskTracing())
+		log.Printf("Task processing traces enabled")
+	}
+
+	var coalescePrefixes []string
+	for _, prefix := range strings.Split(cfg.InboxWorker.CoalescePrefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			coalescePrefixes = append(coalescePrefixes, prefix)
+		}
+	}
+	if len(coalescePrefixes) > 0 {
+		workerOpts = append(workerOpts, service.WithCoalescing(coalescePrefixes))
+		log.Printf("Update coalescing enabled for records: %s", strings.Join(coalescePrefixes, ", "))
+	}
+
+	if cfg.InboxWorker.ThrottleMemoryMB > 0 || cfg.InboxWorker.ThrottleGoroutines > 0 {
+		workerOpts = append(workerOpts, service.WithThrottling(
+			cfg.InboxWorker.ThrottleMemoryMB,
+			cfg.InboxWorker.ThrottleGoroutines,
+		))
+		log.Printf("Worker throttling enabled (memory: %dMB, goroutines: %d)",
+			cfg.InboxWorker.ThrottleMemoryMB, cfg.InboxWorker.ThrottleGoroutines)
+	}
+
+	if cfg.InboxWorker.EnrichmentURL != "" {
+		enricher := service.NewEnricher(service.EnrichmentConfig{
+			URL:              cfg.InboxWorker.EnrichmentURL,
+			Operations:       strings.Split(cfg.InboxWorker.EnrichmentOperations, ","),
+			Timeout:          cfg.InboxWorker.EnrichmentTimeout,
+			Retries:          cfg.InboxWorker.EnrichmentRetries,
+			RetryDelay:       cfg.InboxWorker.EnrichmentRetryDelay,
+			FailureThreshold: cfg.InboxWorker.EnrichmentFailureThreshold,
+			OpenDuration:     cfg.InboxWorker.EnrichmentOpenDuration,
+			FailOpen:         cfg.InboxWorker.EnrichmentFailOpen,
+		}, appMetrics)
+		workerOpts = append(workerOpts, service.WithEnricher(enricher))
+		log.Printf("Enrichment enabled for operations: %s", cfg.InboxWorker.EnrichmentOperations)
+	}
+
 	svc.StartInboxWorker(
 		cfg.InboxWorker.WorkerCount,
 		cfg.InboxWorker.BatchSize,
 		cfg.InboxWorker.PollInterval,
 		cfg.InboxWorker.MaxRetries,
 		cfg.InboxWorker.RetryDelay,
+		workerOpts...,
 	)
 
 	log.Printf("Inbox worker started with %d workers", cfg.InboxWorker.WorkerCount)
 
+	if len(retentionRules) > 0 && cfg.Repository.RetentionInterval > 0 {
+		svc.StartRetentionWorker(cfg.Repository.RetentionInterval, cfg.Repository.RetentionDryRun)
+	}
+
+	if cfg.Repository.TableStatsInterval > 0 {
+		svc.StartTableStatsMonitor(cfg.Repository.TableStatsInterval)
+		log.Printf("Table stats monitor started (interval: %v)", cfg.Repository.TableStatsInterval)
+	}
+
+	if cfg.Server.MetricsCollectInterval > 0 {
+		svc.StartMetricsCollector(cfg.Server.MetricsCollectInterval)
+		log.Printf("Metrics collector started (interval: %v)", cfg.Server.MetricsCollectInterval)
+	}
+
+	if cfg.Repository.PlanMonitorInterval > 0 && cfg.Repository.Type == "postgres" {
+		svc.StartPlanMonitor(cfg.Repository.PlanMonitorInterval, cfg.Repository.PlanCostFactor)
+		log.Printf("Query plan monitor started (interval: %v, cost factor: %v)", cfg.Repository.PlanMonitorInterval, cfg.Repository.PlanCostFactor)
+	}
+
+	if cfg.Repository.IntegrityCheckInterval > 0 {
+		svc.StartIntegrityMonitor(cfg.Repository.IntegrityCheckInterval)
+		log.Printf("Integrity checks enabled (interval: %v)", cfg.Repository.IntegrityCheckInterval)
+	}
+
+	if cfg.Repository.AccessStats {
+		svc.StartAccessStats(cfg.Repository.AccessStatsSampleRate, cfg.Repository.AccessStatsFlushInterval)
+		log.Printf("Access stats enabled (sample rate: %g, flush interval: %v)",
+			cfg.Repository.AccessStatsSampleRate, cfg.Repository.AccessStatsFlushInterval)
+	}
+
+	var replica repository.RecordRepository
+	if cfg.Replication.Enabled {
+		replica, err = repository.NewReplicaRepository(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize replica repository: %v", err)
+		}
+		err = svc.StartReplication(replica, service.ReplicationConfig{
+			Interval:       cfg.Replication.Interval,
+			BatchSize:      cfg.Replication.BatchSize,
+			ConflictPolicy: cfg.Replication.ConflictPolicy,
+			Lookback:       cfg.Replication.Lookback,
+			SettleDelay:    cfg.Replication.SettleDelay,
+		})
+		if err != nil {
+			log.Fatalf("Invalid replication configuration: %v", err)
+		}
+		log.Printf("Replication enabled (target: %s, conflict policy: %s, lookback: %v)",
+			cfg.ReplicaDB.Address(), cfg.Replication.ConflictPolicy, cfg.Replication.Lookback)
+
+		if cfg.Replication.Backfill {
+			if _, err := svc.StartReplicationBackfill(); err != nil {
+				log.Printf("Failed to start replication backfill: %v", err)
+			}
+		}
+	}
+
+	var bridge *mqttbridge.Bridge
+	if cfg.MQTT.Enabled {
+		routes, err := mqttbridge.ParseRoutes(cfg.MQTT.Routes)
+		if err != nil {
+			log.Fatalf("Invalid MQTT_ROUTES: %v", err)
+		}
+		bridge, err = mqttbridge.New(mqttbridge.Config{
+			BrokerURL:    cfg.MQTT.BrokerURL,
+			ClientID:     cfg.MQTT.ClientID,
+			Username:     cfg.MQTT.Username,
+			Password:     cfg.MQTT.Password,
+			QoS:          byte(cfg.MQTT.QoS),
+			CleanSession: cfg.MQTT.CleanSession,
+			Routes:       routes,
+			WriteRetries: cfg.MQTT.WriteRetries,
+		}, svc, appMetrics)
+		if err != nil {
+			log.Fatalf("Invalid MQTT configuration: %v", err)
+		}
+		if err := bridge.Start(); err != nil {
+			log.Fatalf("Failed to start MQTT bridge: %v", err)
+		}
+		log.Printf("MQTT bridge enabled (broker: %s, routes: %s, QoS: %d)",
+			cfg.MQTT.BrokerURL, cfg.MQTT.Routes, cfg.MQTT.QoS)
+	}
+
+	var consumer *amqpconsumer.Consumer
+	if cfg.AMQP.Enabled {
+		consumer, err = amqpconsumer.New(amqpconsumer.Config{
+			URL:          cfg.AMQP.URL,
+			Queue:        cfg.AMQP.Queue,
+			Prefetch:     cfg.AMQP.Prefetch,
+			DeclareQueue: cfg.AMQP.DeclareQueue,
+			RetryDelay:   cfg.AMQP.RetryDelay,
+		}, svc, appMetrics)
+		if err != nil {
+			log.Fatalf("Invalid AMQP configuration: %v", err)
+		}
+		consumer.Start()
+		log.Printf("AMQP consumer enabled (queue: %s, prefetch: %d)", cfg.AMQP.Queue, cfg.AMQP.Prefetch)
+	}
+
+	if cfg.Ingest.Enabled {
+		store, err := objectstore.NewS3Store(context.Background(), cfg.Ingest.Bucket, cfg.Ingest.Region, cfg.Ingest.Endpoint)
+		if err != nil {
+			log.Fatalf("Failed to initialize S3 client: %v", err)
+		}
+		err = svc.StartIngest(store, service.IngestConfig{
+			Prefix:    cfg.Ingest.Prefix,
+			Interval:  cfg.Ingest.Interval,
+			StateDir:  cfg.Ingest.StateDir,
+			BatchSize: cfg.Ingest.BatchSize,
+			Overwrite: cfg.Ingest.Overwrite,
+			Mapping: importer.Mapping{
+				IDField:    cfg.Ingest.IDField,
+				IDPrefix:   cfg.Ingest.IDPrefix,
+				ValueField: cfg.Ingest.ValueField,
+				Type:       cfg.Ingest.Type,
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to start S3 ingestion: %v", err)
+		}
+		log.Printf("S3 ingestion enabled (s3://%s/%s, interval: %v)", cfg.Ingest.Bucket, cfg.Ingest.Prefix, cfg.Ingest.Interval)
+	}
+
+	if cfg.Search.Enabled {
+		index, err := search.New(search.Config{
+			URL:      cfg.Search.URL,
+			Index:    cfg.Search.Index,
+			APIKey:   cfg.Search.APIKey,
+			Username: cfg.Search.Username,
+			Password: cfg.Search.Password,
+			Timeout:  cfg.Search.Timeout,
+		})
+		if err != nil {
+			log.Fatalf("Invalid search configuration: %v", err)
+		}
+		err = svc.StartSearchIndex(index, service.SearchIndexConfig{
+			Interval:    cfg.Search.Interval,
+			BatchSize:   cfg.Search.BatchSize,
+			Lookback:    cfg.Search.Lookback,
+			SettleDelay: cfg.Search.SettleDelay,
+		})
+		if err != nil {
+			log.Fatalf("Invalid search configuration: %v", err)
+		}
+		log.Printf("Search indexing enabled (index: %s, lookback: %v)", cfg.Search.Index, cfg.Search.Lookback)
+
+		if cfg.Search.Reindex {
+			if _, err := svc.StartSearchReindex(); err != nil {
+				log.Printf("Failed to start search reindex: %v", err)
+			}
+		}
+	}
+
+	if cfg.Analytics.Enabled {
+		columns, err := service.ParseAnalyticsColumns(cfg.Analytics.Columns)
+		if err != nil {
+			log.Fatalf("Invalid ANALYTICS_COLUMNS: %v", err)
+		}
+		for _, table := range []string{cfg.Analytics.ChangesTable, cfg.Analytics.TasksTable} {
+			if !warehouse.ValidTable(table) {
+				log.Fatalf("Invalid analytics table name %q", table)
+			}
+		}
+		clickhouse, err := warehouse.NewClickHouse(warehouse.ClickHouseConfig{
+			URL:      cfg.Analytics.URL,
+			Database: cfg.Analytics.Database,
+			Username: cfg.Analytics.Username,
+			Password: cfg.Analytics.Password,
+			Timeout:  cfg.Analytics.Timeout,
+		})
+		if err != nil {
+			log.Fatalf("Invalid analytics configuration: %v", err)
+		}
+		err = svc.StartAnalyticsExport(clickhouse, service.AnalyticsConfig{
+			Interval:        cfg.Analytics.Interval,
+			BatchSize:       cfg.Analytics.BatchSize,
+			Lookback:        cfg.Analytics.Lookback,
+			SettleDelay:     cfg.Analytics.SettleDelay,
+			ChangesTable:    cfg.Analytics.ChangesTable,
+			TasksTable:      cfg.Analytics.TasksTable,
+			IncludeValue:    cfg.Analytics.IncludeValue,
+			Columns:         columns,
+			StateFile:       cfg.Analytics.StateFile,
+			AlertWebhookURL: cfg.Analytics.AlertWebhookURL,
+			AlertAfter:      cfg.Analytics.AlertAfter,
+		})
+		if err != nil {
+			log.Fatalf("Failed to start analytics export: %v", err)
+		}
+		log.Printf("Analytics export enabled (%s, interval: %v)", clickhouse.Name(), cfg.Analytics.Interval)
+	}
+
+	if cfg.Digest.Enabled {
+		var senders []service.DigestSender
+		var targets []string
+		if cfg.Digest.SlackWebhookURL != "" {
+			slack, err := notify.NewSlack(cfg.Digest.SlackWebhookURL, 10*time.Second)
+			if err != nil {
+				log.Fatalf("Invalid DIGEST_SLACK_WEBHOOK_URL: %v", err)
+			}
+			senders = append(senders, slack)
+			targets = append(targets, slack.Name())
+		}
+		if cfg.Digest.SMTPAddr != "" {
+			var to []string
+			for _, address := range strings.Split(cfg.Digest.SMTPTo, ",") {
+				if address = strings.TrimSpace(address); address != "" {
+					to = append(to, address)
+				}
+			}
+			smtp, err := notify.NewSMTP(notify.SMTPConfig{
+				Addr:     cfg.Digest.SMTPAddr,
+				Username: cfg.Digest.SMTPUsername,
+				Password: cfg.Digest.SMTPPassword,
+				From:     cfg.Digest.SMTPFrom,
+				To:       to,
+				Timeout:  30 * time.Second,
+			})
+			if err != nil {
+				log.Fatalf("Invalid digest SMTP configuration: %v", err)
+			}
+			senders = append(senders, smtp)
+			targets = append(targets, smtp.Name())
+		}
+		err := svc.StartFailedTaskDigest(senders, service.DigestConfig{
+			Interval:   cfg.Digest.Interval,
+			SampleSize: cfg.Digest.SampleSize,
+		})
+		if err != nil {
+			log.Fatalf("Failed to start failed task digest (set DIGEST_SLACK_WEBHOOK_URL or DIGEST_SMTP_ADDR): %v", err)
+		}
+		log.Printf("Failed task digest enabled (%s, interval: %v)", strings.Join(targets, ", "), cfg.Digest.Interval)
+	}
+
 	// Setup HTTP routes
-	mux := handler.SetupRoutes(svc, appMetrics)
+	handlerOpts := []handler.Option{handler.WithRequestLogging(cfg.Log.Requests)}
+	if cfg.Server.AdminToken != "" {
+		handlerOpts = append(handlerOpts, handler.WithAdminToken(cfg.Server.AdminToken))
+		log.Println("Admin endpoints enabled")
+	}
+	if cfg.Server.ShedMaxLatency > 0 || cfg.Server.ShedMaxInFlight > 0 {
+		priorities, err := handler.ParsePriorities(cfg.Server.ShedPriorities)
+		if err != nil {
+			log.Fatalf("Invalid SHED_PRIORITIES: %v", err)
+		}
+		shedder := handler.NewLoadShedder(priorities, cfg.Server.ShedMaxLatency, cfg.Server.ShedMaxInFlight, appMetrics)
+		handlerOpts = append(handlerOpts, handler.WithLoadShedding(shedder))
+		log.Printf("Load shedding enabled (max latency: %v, max in flight: %d)",
+			cfg.Server.ShedMaxLatency, cfg.Server.ShedMaxInFlight)
+	}
+	if cfg.Server.RouteConcurrency != "" {
+		limits, err := handler.ParseConcurrencyLimits(cfg.Server.RouteConcurrency)
+		if err != nil {
+			log.Fatalf("Invalid ROUTE_CONCURRENCY: %v", err)
+		}
+		handlerOpts = append(handlerOpts, handler.WithConcurrencyLimits(limits))
+		log.Printf("Route concurrency limits enabled: %s", cfg.Server.RouteConcurrency)
+	}
+	if cfg.Server.RouteTimeouts != "" {
+		timeouts, err := handler.ParseRouteTimeouts(cfg.Server.RouteTimeouts)
+		if err != nil {
+			log.Fatalf("Invalid ROUTE_TIMEOUTS: %v", err)
+		}
+		handlerOpts = append(handlerOpts, handler.WithRouteTimeouts(timeouts))
+		log.Printf("Route timeouts enabled: %s", cfg.Server.RouteTimeouts)
+	}
+	if idStrategy != nil {
+		handlerOpts = append(handlerOpts, handler.WithGeneratedIDs())
+	}
+	if len(sandboxKeys) > 0 {
+		handlerOpts = append(handlerOpts, handler.WithSandboxKeys(sandboxKeys))
+		log.Printf("Sandboxes enabled (%d keys, records purged %v after their last write)",
+			len(sandboxKeys), cfg.Server.SandboxTTL)
+	}
+	if len(tenantKeys) > 0 {
+		handlerOpts = append(handlerOpts, handler.WithTenantKeys(tenantKeys))
+	}
+	if cfg.Server.TenantHeader {
+		handlerOpts = append(handlerOpts, handler.WithTenantHeader())
+	}
+	if cfg.Server.TenantRequired {
+		handlerOpts = append(handlerOpts, handler.WithRequiredTenant())
+	}
+	if len(tenantKeys) > 0 || cfg.Server.TenantHeader {
+		log.Printf("Multi-tenancy enabled (%d tenant keys, X-Tenant-ID trusted: %v, tenant required: %v)",
+			len(tenantKeys), cfg.Server.TenantHeader, cfg.Server.TenantRequired)
+	}
+	if cfg.Server.ResponseTemplatesFile != "" {
+		templates, err := handler.LoadResponseTemplates(cfg.Server.ResponseTemplatesFile)
+		if err != nil {
+			log.Fatalf("Invalid RESPONSE_TEMPLATES_FILE: %v", err)
+		}
+		handlerOpts = append(handlerOpts, handler.WithResponseTemplates(templates))
+		log.Printf("Response templates enabled for %d client profiles", templates.Profiles())
+	}
+	mux := handler.SetupRoutes(svc, appMetrics, handlerOpts...)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -66,17 +602,75 @@ func main() {
 		}
 	}()
 
+	// Warm up while the startup probe keeps traffic away
+	go func() {
+		var ids []string
+		for _, id := range strings.Split(cfg.Server.WarmUpRecordIDs, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.WarmUpTimeout)
+		defer cancel()
+		svc.WarmUp(ctx, ids)
+	}()
+
 	// Log service endpoints
 	log.Println("Service endpoints:")
 	log.Printf("  Health check:  http://localhost:%s/health", cfg.Server.Port)
+	log.Printf("  Startup probe: http://localhost:%s/startup", cfg.Server.Port)
+	log.Printf("  Readiness:     http://localhost:%s/ready", cfg.Server.Port)
+	log.Printf("  Version:       http://localhost:%s/version", cfg.Server.Port)
 	log.Printf("  Performance:   http://localhost:%s/performance", cfg.Server.Port)
 	log.Printf("  Metrics:       http://localhost:%s/metrics", cfg.Server.Port)
+	log.Printf("  SLOs:          http://localhost:%s/slo", cfg.Server.Port)
 	log.Printf("  Task stats:    http://localhost:%s/stats", cfg.Server.Port)
 	log.Printf("  Task list:     http://localhost:%s/tasks?status=<status>&limit=<limit>&offset=<offset>", cfg.Server.Port)
 	log.Printf("  Insert:        POST http://localhost:%s/insert", cfg.Server.Port)
 	log.Printf("  Update:        POST http://localhost:%s/update", cfg.Server.Port)
 	log.Printf("  Delete:        POST http://localhost:%s/delete", cfg.Server.Port)
-	log.Printf("  Get:           GET  http://localhost:%s/get?id=<record_id>", cfg.Server.Port)
+	log.Printf("  Get:           GET  http://localhost:%s/get?id=<record_id>[&consistency_token=<token>]", cfg.Server.Port)
+	log.Printf("  Records:       GET  http://localhost:%s/records?type=<type>&limit=<limit>&offset=<offset>", cfg.Server.Port)
+	log.Printf("  Enqueue task:  POST http://localhost:%s/tasks/enqueue", cfg.Server.Port)
+	if cfg.Search.Enabled {
+		log.Printf("  Search:        GET  http://localhost:%s/search?q=<query> or POST with a query body", cfg.Server.Port)
+	}
+	log.Printf("  Twirp RPC:     POST http://localhost:%s/twirp/%s/<Method>", cfg.Server.Port, handler.RPCService)
+	log.Printf("  Connect RPC:   POST http://localhost:%s/%s/<Method>", cfg.Server.Port, handler.RPCService)
+	if cfg.Server.AdminToken != "" {
+		log.Printf("  Admin tables:  GET  http://localhost:%s/admin/tables", cfg.Server.Port)
+		if cfg.Repository.Type == "postgres" {
+			log.Printf("  Explain:       GET  http://localhost:%s/admin/explain?endpoint=<path>&<params>", cfg.Server.Port)
+		}
+		log.Printf("  Export:        GET  http://localhost:%s/admin/export?prefix=<prefix>&after_id=<id>", cfg.Server.Port)
+		log.Printf("  Clone:         POST http://localhost:%s/admin/clone", cfg.Server.Port)
+		if cfg.Ingest.Enabled {
+			log.Printf("  Ingest status: GET  http://localhost:%s/admin/ingest[?key=<key>]", cfg.Server.Port)
+		}
+		if cfg.Repository.AccessStats {
+			log.Printf("  Hot records:   GET  http://localhost:%s/admin/hot-records?limit=<limit>&by=<reads|writes|total>", cfg.Server.Port)
+		}
+		if cfg.Replication.Enabled {
+			log.Printf("  Replication:   GET  http://localhost:%s/admin/replication", cfg.Server.Port)
+		}
+		if cfg.Shadow.Writes {
+			log.Printf("  Shadow:        GET  http://localhost:%s/admin/shadow", cfg.Server.Port)
+			log.Printf("  Cutover:       POST http://localhost:%s/admin/shadow/cutover", cfg.Server.Port)
+		}
+		if cfg.Search.Enabled {
+			log.Printf("  Search index:  GET  http://localhost:%s/admin/search-index", cfg.Server.Port)
+		}
+		if cfg.Analytics.Enabled {
+			log.Printf("  Analytics:     GET  http://localhost:%s/admin/analytics", cfg.Server.Port)
+		}
+		if cfg.Digest.Enabled {
+			log.Printf("  Task digest:   GET  http://localhost:%s/admin/digest", cfg.Server.Port)
+		}
+		if repoManager.Snapshots != nil {
+			log.Printf("  Snapshots:     GET  http://localhost:%s/admin/snapshots", cfg.Server.Port)
+		}
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
@@ -94,19 +688,41 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// Stop taking MQTT and AMQP writes before the worker stops
+	if bridge != nil {
+		bridge.Stop()
+	}
+	if consumer != nil {
+		consumer.Stop()
+	}
+
 	// Stop service and cleanup
 	svc.Close()
+	if anomalyDetector != nil {
+		anomalyDetector.Stop()
+	}
 
-	// Close repository connections
-	if repoManager.Record != nil {
-		if err := repoManager.Record.Close(); err != nil {
-			log.Printf("Error closing record repository: %v", err)
+	// Persist mock data for the next start
+	if repoManager.Snapshots != nil && cfg.Repository.SnapshotName != "" {
+		if info, err := repoManager.Snapshots.Save(ctx, cfg.Repository.SnapshotName); err != nil {
+			log.Printf("Failed to save snapshot: %v", err)
+		} else {
+			log.Printf("Saved snapshot '%s' (%d records, %d tasks)", info.Name, info.Records, info.Tasks)
 		}
 	}
 
-	if repoManager.Inbox != nil {
-		if err := repoManager.Inbox.Close(); err != nil {
-			log.Printf("Error closing inbox repository: %v", err)
+	// Close repository connections
+	if err := repoManager.Close(); err != nil {
+		log.Printf("Error closing repositories: %v", err)
+	}
+	if replica != nil {
+		if err := replica.Close(); err != nil {
+			log.Printf("Error closing replica repository: %v", err)
+		}
+	}
+	if shadow != nil {
+		if err := shadow.Close(); err != nil {
+			log.Printf("Error closing shadow repository: %v", err)
 		}
 	}
 
@@ -0,0 +1,122 @@
+package amqpconsumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+)
+
+// fakeWriter records queued writes, failing all of them with err
+type fakeWriter struct {
+	err    error
+	writes []string
+}
+
+func (w *fakeWriter) Insert(ctx context.Context, req *models.InsertRequest) (*models.InboxTask, error) {
+	return w.write("insert " + req.ID + " " + req.Type)
+}
+
+func (w *fakeWriter) Update(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error) {
+	return w.write("update " + req.ID)
+}
+
+func (w *fakeWriter) Delete(ctx context.Context, req *models.DeleteRequest) (*models.InboxTask, error) {
+	return w.write("delete " + req.ID)
+}
+
+func (w *fakeWriter) write(description string) (*models.InboxTask, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	w.writes = append(w.writes, description)
+	return &models.InboxTask{ID: "task"}, nil
+}
+
+// fakeAcknowledger records how a delivery was settled
+type fakeAcknowledger struct {
+	settled string
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.settled = "ack"
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.settled = "reject"
+	if requeue {
+		a.settled = "requeue"
+	}
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func newTestConsumer(t *testing.T, writer Writer) *Consumer {
+	t.Helper()
+	consumer, err := New(Config{URL: "amqp://localhost", Queue: "writes", Prefetch: 1, RetryDelay: time.Millisecond}, writer, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return consumer
+}
+
+func TestConsumer_Deliver(t *testing.T) {
+	writer := &fakeWriter{}
+	consumer := newTestConsumer(t, writer)
+
+	tests := []struct {
+		body     string
+		err      error
+		expected string
+	}{
+		{`{"operation": "insert", "id": "a", "type": "order", "value": {"total": 1}}`, nil, "ack"},
+		{`{"operation": "update", "id": "a", "value": {"total": 2}}`, nil, "ack"},
+		{`{"operation": "delete", "id": "a"}`, nil, "ack"},
+		{`not json`, nil, "reject"},
+		{`{"operation": "upsert", "id": "a", "value": {"total": 1}}`, nil, "reject"},
+		{`{"operation": "insert", "id": " ", "value": {"total": 1}}`, nil, "reject"},
+		{`{"operation": "update", "id": "a"}`, nil, "reject"},
+		{`{"operation": "update", "id": "b", "value": {"total": 1}}`, models.ErrRecordNotFound, "reject"},
+		{`{"operation": "insert", "id": "b", "value": {"total": 1}}`, errors.New("database unavailable"), "requeue"},
+	}
+
+	for _, tt := range tests {
+		writer.err = tt.err
+		ack := &fakeAcknowledger{}
+		consumer.deliver(amqp.Delivery{Acknowledger: ack, Body: []byte(tt.body)})
+		if ack.settled != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.body, tt.expected, ack.settled)
+		}
+	}
+
+	expected := []string{"insert a order", "update a", "delete a"}
+	if len(writer.writes) != len(expected) {
+		t.Fatalf("Expected writes %v, got %v", expected, writer.writes)
+	}
+	for i := range expected {
+		if writer.writes[i] != expected[i] {
+			t.Errorf("Expected writes %v, got %v", expected, writer.writes)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Queue: "writes", Prefetch: 1},
+		{URL: "amqp://localhost", Prefetch: 1},
+		{URL: "amqp://localhost", Queue: "writes"},
+	} {
+		if _, err := New(cfg, &fakeWriter{}, metrics.NewMetrics()); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package binenc converts request and response bodies between JSON and the
+// compact binary encodings CBOR and MessagePack
+package binenc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Format is a binary encoding
+type Format string
+
+const (
+	CBOR    Format = "application/cbor"
+	MsgPack Format = "application/msgpack"
+)
+
+// ErrNumberRange is returned for JSON numbers that have no exact binary form
+var ErrNumberRange = errors.New("number out of range")
+
+// cborDecoding decodes maps with string keys, the only ones JSON has
+var cborDecoding, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+// Parse returns the format of a Content-Type or Accept media type
+func Parse(contentType string) (Format, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/cbor":
+		return CBOR, true
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return MsgPack, true
+	default:
+		return "", false
+	}
+}
+
+// ToJSON converts a document of format to JSON. Byte strings become base64
+// strings, as encoding/json writes []byte
+func ToJSON(format Format, data []byte) ([]byte, error) {
+	var value interface{}
+	var err error
+	switch format {
+	case CBOR:
+		err = cborDecoding.Unmarshal(data, &value)
+	case MsgPack:
+		err = msgpack.Unmarshal(data, &value)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s document: %w", format, err)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s document has no JSON form: %w", format, err)
+	}
+	return encoded, nil
+}
+
+// FromJSON converts a JSON document to format. Integral numbers are encoded
+// as integers, the others as float64. Integers beyond the 64-bit range and
+// numbers beyond the float64 range are rejected with ErrNumberRange
+func FromJSON(format Format, data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON document: %w", err)
+	}
+	value, err := compactNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case CBOR:
+		return cbor.Marshal(value)
+	case MsgPack:
+		return msgpack.Marshal(value)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// compactNumbers replaces the json.Numbers of a decoded document with int64,
+// uint64 or float64 values
+func compactNumbers(value interface{}) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if v[key], err = compactNumbers(item); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if v[i], err = compactNumbers(item); err != nil {
+				return nil, err
+			}
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		if n, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return n, nil
+		}
+		// An integer literal beyond 64 bits would lose digits as a float
+		if !strings.ContainsAny(v.String(), ".eE") {
+			return nil, fmt.Errorf("%w: %s", ErrNumberRange, v)
+		}
+		if f, err := v.Float64(); err == nil && !math.IsInf(f, 0) {
+			return f, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNumberRange, v)
+	}
+	return value, nil
+}
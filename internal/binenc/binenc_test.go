@@ -0,0 +1,80 @@
+package binenc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	document := `{"id":"user_1","value":{"name":"Ada","age":36,"score":1.5,"roles":["admin"],"address":{"city":"London"},"active":true,"manager":null}}`
+
+	for _, format := range []Format{CBOR, MsgPack} {
+		encoded, err := FromJSON(format, []byte(document))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if len(encoded) >= len(document) {
+			t.Errorf("%s: expected a smaller document, got %d bytes for %d", format, len(encoded), len(document))
+		}
+
+		decoded, err := ToJSON(format, encoded)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		var expected, got interface{}
+		json.Unmarshal([]byte(document), &expected)
+		if err := json.Unmarshal(decoded, &got); err != nil {
+			t.Fatalf("%s: expected JSON, got %s: %v", format, decoded, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %s, got %s", format, document, decoded)
+		}
+	}
+}
+
+func TestToJSON_Invalid(t *testing.T) {
+	for _, format := range []Format{CBOR, MsgPack} {
+		if _, err := ToJSON(format, []byte{0xc1}); err == nil {
+			t.Errorf("%s: expected an error for malformed data", format)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]Format{
+		"application/cbor":                 CBOR,
+		"application/msgpack":              MsgPack,
+		"application/x-msgpack; charset=x": MsgPack,
+		"application/json":                 "",
+	}
+	for contentType, expected := range tests {
+		if format, _ := Parse(contentType); format != expected {
+			t.Errorf("%s: expected %q, got %q", contentType, expected, format)
+		}
+	}
+}
+
+func TestFromJSON_NumberRange(t *testing.T) {
+	for _, format := range []Format{CBOR, MsgPack} {
+		encoded, err := FromJSON(format, []byte(`{"max":18446744073709551615,"min":-9223372036854775808,"small":1e-300}`))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		decoded, err := ToJSON(format, encoded)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if !strings.Contains(string(decoded), `"max":18446744073709551615`) || !strings.Contains(string(decoded), `"min":-9223372036854775808`) {
+			t.Errorf("%s: expected the 64-bit bounds kept exactly, got %s", format, decoded)
+		}
+
+		for _, document := range []string{`{"n":18446744073709551616}`, `[-9223372036854775809]`, `{"n":1e400}`} {
+			if _, err := FromJSON(format, []byte(document)); !errors.Is(err, ErrNumberRange) {
+				t.Errorf("%s: expected %s rejected as out of range, got %v", format, document, err)
+			}
+		}
+	}
+}
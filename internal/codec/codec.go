@@ -0,0 +1,97 @@
+// Package codec converts record values between their stored JSON object form
+// and Go types, looked up per record type
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec converts record values of type T to and from JSON objects
+type Codec[T any] interface {
+	// Encode returns the JSON object stored for value
+	Encode(value T) (map[string]interface{}, error)
+
+	// Decode converts a stored JSON object to T
+	Decode(data json.RawMessage) (T, error)
+}
+
+// JSON converts values with encoding/json. T must encode to a JSON object
+type JSON[T any] struct{}
+
+// Encode marshals value and unmarshals it into a map, numbers as
+// json.Number so large integers keep their precision
+func (JSON[T]) Encode(value T) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, fmt.Errorf("%T does not encode to a JSON object", value)
+	}
+	return object, nil
+}
+
+// Decode unmarshals data into T
+func (JSON[T]) Decode(data json.RawMessage) (T, error) {
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("failed to decode %T: %w", value, err)
+	}
+	return value, nil
+}
+
+// Registry holds the codecs of record types. Types without a registered
+// codec use JSON
+type Registry struct {
+	mu     sync.RWMutex
+	codecs map[string]registered
+}
+
+// registered is a codec with the Go type it converts
+type registered struct {
+	goType reflect.Type
+	codec  any
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{codecs: make(map[string]registered)}
+}
+
+// Register sets the codec of recordType, replacing a registered one
+func Register[T any](r *Registry, recordType string, codec Codec[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codecs[recordType] = registered{goType: typeOf[T](), codec: codec}
+}
+
+// For returns the codec of recordType converting values of type T. It fails
+// when recordType is registered for another Go type
+func For[T any](r *Registry, recordType string) (Codec[T], error) {
+	r.mu.RLock()
+	entry, ok := r.codecs[recordType]
+	r.mu.RUnlock()
+
+	if !ok {
+		return JSON[T]{}, nil
+	}
+	codec, ok := entry.codec.(Codec[T])
+	if !ok {
+		return nil, fmt.Errorf("record type %q is registered for %s, not %s", recordType, entry.goType, typeOf[T]())
+	}
+	return codec, nil
+}
+
+// typeOf returns the reflect.Type of T, also for interface types
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
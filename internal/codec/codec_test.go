@@ -0,0 +1,34 @@
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type account struct {
+	ID      string `json:"id"`
+	Balance uint64 `json:"balance"`
+}
+
+func TestJSON_NumberPrecision(t *testing.T) {
+	object, err := JSON[account]{}.Encode(account{ID: "a", Balance: 12345678901234567890})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, _ := json.Marshal(object)
+	if expected := `{"balance":12345678901234567890,"id":"a"}`; string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	decoded, err := JSON[account]{}.Decode(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded.Balance != 12345678901234567890 {
+		t.Errorf("Expected the balance to round-trip, got %d", decoded.Balance)
+	}
+
+	if _, err := (JSON[[]int]{}).Encode([]int{1}); err == nil {
+		t.Error("Expected values not encoding to an object rejected")
+	}
+}
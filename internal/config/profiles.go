@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// profiles change the defaults of environment variables per APP_ENV.
+// Variables set explicitly always win over the profile
+var profiles = map[string]map[string]string{
+	"dev": {
+		"REPOSITORY_TYPE": "mock",
+		"LOG_FORMAT":      LogFormatText,
+		"LOG_REQUESTS":    "true",
+	},
+	"staging": {
+		"REPOSITORY_TYPE": "postgres",
+		"LOG_FORMAT":      LogFormatJSON,
+		"LOG_REQUESTS":    "true",
+	},
+	"prod": {
+		"REPOSITORY_TYPE": "postgres",
+		"LOG_FORMAT":      LogFormatJSON,
+		"LOG_REQUESTS":    "false",
+	},
+}
+
+// ValidateEnv checks that env names a profile, the empty env uses none
+func ValidateEnv(env string) error {
+	if _, ok := profiles[env]; ok || env == "" {
+		return nil
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown APP_ENV %q, expected one of %v", env, names)
+}
+
+// lookupEnv returns the environment variable, falling back to the default
+// of the APP_ENV profile
+func lookupEnv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return profiles[os.Getenv("APP_ENV")][key]
+}
@@ -0,0 +1,50 @@
+package config
+
+import "testing"
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        string
+		repository string // REPOSITORY_TYPE set explicitly
+		expected   string
+		format     string
+		requests   bool
+	}{
+		{"no profile", "", "", "postgres", LogFormatText, true},
+		{"dev", "dev", "", "mock", LogFormatText, true},
+		{"prod", "prod", "", "postgres", LogFormatJSON, false},
+		{"explicit wins", "dev", "postgres", "postgres", LogFormatText, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.env)
+			t.Setenv("REPOSITORY_TYPE", tt.repository)
+			t.Setenv("LOG_FORMAT", "")
+			t.Setenv("LOG_REQUESTS", "")
+
+			cfg := LoadConfig()
+			if cfg.Repository.Type != tt.expected {
+				t.Errorf("Expected repository %s, got %s", tt.expected, cfg.Repository.Type)
+			}
+			if cfg.Log.Format != tt.format {
+				t.Errorf("Expected log format %s, got %s", tt.format, cfg.Log.Format)
+			}
+			if cfg.Log.Requests != tt.requests {
+				t.Errorf("Expected request logging %v, got %v", tt.requests, cfg.Log.Requests)
+			}
+		})
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	for _, env := range []string{"", "dev", "staging", "prod"} {
+		if err := ValidateEnv(env); err != nil {
+			t.Errorf("Unexpected error for %q: %v", env, err)
+		}
+	}
+	if err := ValidateEnv("production"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+}
@@ -2,6 +2,7 @@ package e2e
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -30,12 +31,12 @@ func TestE2E_InsertAndGet(t *testing.T) {
 		},
 	}
 
-	repoManager, err := repository.NewRepositoryManager(cfg)
+	appMetrics := metrics.NewMetrics()
+	repoManager, err := repository.NewRepositoryManager(cfg, appMetrics)
 	if err != nil {
 		t.Fatalf("Failed to create repository: %v", err)
 	}
 
-	appMetrics := metrics.NewMetrics()
 	svc := service.NewService(repoManager, appMetrics)
 	
 	// Start inbox worker
@@ -63,7 +64,7 @@ func TestE2E_InsertAndGet(t *testing.T) {
 	// Test INSERT operation
 	insertReq := models.InsertRequest{
 		ID:    testID,
-		Value: testData,
+		Value: models.MustEncodeValue(testData),
 	}
 	insertBody, _ := json.Marshal(insertReq)
 
@@ -101,9 +102,9 @@ func TestE2E_InsertAndGet(t *testing.T) {
 	}
 
 	// Check record data
-	recordData, ok := record.Value.(map[string]interface{})
-	if !ok {
-		t.Fatalf("Record value is not a map")
+	var recordData map[string]interface{}
+	if err := record.DecodeValue(&recordData); err != nil {
+		t.Fatalf("Record value is not a map: %v", err)
 	}
 
 	if recordData["name"] != testData["name"] {
@@ -124,12 +125,12 @@ func TestE2E_UpdateRecord(t *testing.T) {
 		},
 	}
 
-	repoManager, err := repository.NewRepositoryManager(cfg)
+	appMetrics := metrics.NewMetrics()
+	repoManager, err := repository.NewRepositoryManager(cfg, appMetrics)
 	if err != nil {
 		t.Fatalf("Failed to create repository: %v", err)
 	}
 
-	appMetrics := metrics.NewMetrics()
 	svc := service.NewService(repoManager, appMetrics)
 	svc.StartInboxWorker(
 		cfg.InboxWorker.WorkerCount,
@@ -151,7 +152,7 @@ func TestE2E_UpdateRecord(t *testing.T) {
 		"name": "Initial Name",
 		"age":  25,
 	}
-	insertReq := models.InsertRequest{ID: testID, Value: insertData}
+	insertReq := models.InsertRequest{ID: testID, Value: models.MustEncodeValue(insertData)}
 	insertBody, _ := json.Marshal(insertReq)
 	
 	resp, _ := http.Post(server.URL+"/insert", "application/json", bytes.NewBuffer(insertBody))
@@ -166,7 +167,7 @@ func TestE2E_UpdateRecord(t *testing.T) {
 		"age":  26,
 		"city": "New York",
 	}
-	updateReq := models.UpdateRequest{ID: testID, Value: updateData}
+	updateReq := models.UpdateRequest{ID: testID, Value: models.MustEncodeValue(updateData)}
 	updateBody, _ := json.Marshal(updateReq)
 
 	updateResp, err := http.Post(server.URL+"/update", "application/json", bytes.NewBuffer(updateBody))
@@ -189,7 +190,8 @@ func TestE2E_UpdateRecord(t *testing.T) {
 	var record models.Record
 	json.NewDecoder(getResp.Body).Decode(&record)
 
-	recordData := record.Value.(map[string]interface{})
+	var recordData map[string]interface{}
+	record.DecodeValue(&recordData)
 	if recordData["name"] != "Updated Name" {
 		t.Errorf("Expected updated name, got %v", recordData["name"])
 	}
@@ -205,8 +207,8 @@ func TestE2E_GetNonExistentRecord(t *testing.T) {
 		Repository: config.RepositoryConfig{Type: "mock"},
 	}
 
-	repoManager, _ := repository.NewRepositoryManager(cfg)
 	appMetrics := metrics.NewMetrics()
+	repoManager, _ := repository.NewRepositoryManager(cfg, appMetrics)
 	svc := service.NewService(repoManager, appMetrics)
 
 	mux := handler.SetupRoutes(svc, appMetrics)
@@ -238,8 +240,8 @@ func TestE2E_TaskStats(t *testing.T) {
 		},
 	}
 
-	repoManager, _ := repository.NewRepositoryManager(cfg)
 	appMetrics := metrics.NewMetrics()
+	repoManager, _ := repository.NewRepositoryManager(cfg, appMetrics)
 	svc := service.NewService(repoManager, appMetrics)
 	svc.StartInboxWorker(
 		cfg.InboxWorker.WorkerCount,
@@ -258,7 +260,7 @@ func TestE2E_TaskStats(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		insertReq := models.InsertRequest{
 			ID:    fmt.Sprintf("test_%d", i),
-			Value: map[string]interface{}{"data": i},
+			Value: models.MustEncodeValue(map[string]interface{}{"data": i}),
 		}
 		insertBody, _ := json.Marshal(insertReq)
 		resp, _ := http.Post(server.URL+"/insert", "application/json", bytes.NewBuffer(insertBody))
@@ -299,8 +301,8 @@ func TestE2E_HealthCheck(t *testing.T) {
 		Repository: config.RepositoryConfig{Type: "mock"},
 	}
 
-	repoManager, _ := repository.NewRepositoryManager(cfg)
 	appMetrics := metrics.NewMetrics()
+	repoManager, _ := repository.NewRepositoryManager(cfg, appMetrics)
 	svc := service.NewService(repoManager, appMetrics)
 
 	mux := handler.SetupRoutes(svc, appMetrics)
@@ -331,3 +333,193 @@ func TestE2E_HealthCheck(t *testing.T) {
 		t.Errorf("Expected mit-service, got %v", health["service"])
 	}
 }
+
+func TestE2E_AdminTables(t *testing.T) {
+	// Setup
+	cfg := &config.Config{
+		Repository: config.RepositoryConfig{Type: "mock"},
+	}
+
+	appMetrics := metrics.NewMetrics()
+	repoManager, _ := repository.NewRepositoryManager(cfg, appMetrics)
+	svc := service.NewService(repoManager, appMetrics)
+
+	mux := handler.SetupRoutes(svc, appMetrics, handler.WithAdminToken("secret"))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Without the token the endpoint is rejected
+	resp, err := http.Get(server.URL + "/admin/tables")
+	if err != nil {
+		t.Fatalf("Admin request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/admin/tables", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Admin request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Tables []models.TableStats `json:"tables"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode admin response: %v", err)
+	}
+
+	if len(body.Tables) != 2 {
+		t.Errorf("Expected stats for 2 tables, got %d", len(body.Tables))
+	}
+}
+
+func TestE2E_MockSnapshotRestore(t *testing.T) {
+	// Setup
+	cfg := &config.Config{
+		Repository: config.RepositoryConfig{
+			Type:         "mock",
+			SnapshotDir:  t.TempDir(),
+			SnapshotName: "latest",
+		},
+	}
+
+	appMetrics := metrics.NewMetrics()
+	repoManager, err := repository.NewRepositoryManager(cfg, appMetrics)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	record := &models.Record{ID: "snap_1", Value: models.MustEncodeValue(map[string]interface{}{"kept": true})}
+	if err := repoManager.Record.Insert(context.Background(), record); err != nil {
+		t.Fatalf("Failed to insert record: %v", err)
+	}
+
+	svc := service.NewService(repoManager, appMetrics)
+	mux := handler.SetupRoutes(svc, appMetrics, handler.WithAdminToken("secret"))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/admin/snapshots/save?name=latest", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Save snapshot request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// A new repository restores the snapshot on start
+	restarted, err := repository.NewRepositoryManager(cfg, appMetrics)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	restored, err := restarted.Record.Get(context.Background(), "snap_1")
+	if err != nil {
+		t.Fatalf("Expected record to be restored from snapshot: %v", err)
+	}
+
+	var value map[string]interface{}
+	restored.DecodeValue(&value)
+	if value["kept"] != true {
+		t.Errorf("Expected restored value kept=true, got %s", restored.Value)
+	}
+}
+
+func TestE2E_RecordTypes(t *testing.T) {
+	// Setup
+	cfg := &config.Config{
+		Repository: config.RepositoryConfig{Type: "mock"},
+		InboxWorker: config.InboxWorkerConfig{
+			WorkerCount:  1,
+			BatchSize:    1,
+			PollInterval: 100 * time.Millisecond,
+			MaxRetries:   3,
+			RetryDelay:   100 * time.Millisecond,
+		},
+	}
+
+	appMetrics := metrics.NewMetrics()
+	repoManager, _ := repository.NewRepositoryManager(cfg, appMetrics)
+	svc := service.NewService(repoManager, appMetrics)
+	svc.StartInboxWorker(
+		cfg.InboxWorker.WorkerCount,
+		cfg.InboxWorker.BatchSize,
+		cfg.InboxWorker.PollInterval,
+		cfg.InboxWorker.MaxRetries,
+		cfg.InboxWorker.RetryDelay,
+	)
+	defer svc.Close()
+
+	mux := handler.SetupRoutes(svc, appMetrics, handler.WithAdminToken("secret"))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Register a record type
+	schemaBody := `{"type": "object", "required": ["email"], "properties": {"email": {"type": "string"}}}`
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/admin/schemas?name=user", bytes.NewBufferString(schemaBody))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Schema request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// Values violating the schema are rejected
+	invalid, _ := json.Marshal(models.InsertRequest{ID: "user_1", Type: "user", Value: models.MustEncodeValue(map[string]interface{}{"name": "x"})})
+	resp, err = http.Post(server.URL+"/insert", "application/json", bytes.NewBuffer(invalid))
+	if err != nil {
+		t.Fatalf("Insert request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", resp.StatusCode)
+	}
+
+	valid, _ := json.Marshal(models.InsertRequest{ID: "user_1", Type: "user", Value: models.MustEncodeValue(map[string]interface{}{"email": "a@b.c"})})
+	resp, err = http.Post(server.URL+"/insert", "application/json", bytes.NewBuffer(valid))
+	if err != nil {
+		t.Fatalf("Insert request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Wait for inbox processing
+	time.Sleep(300 * time.Millisecond)
+
+	resp, err = http.Get(server.URL + "/records?type=user")
+	if err != nil {
+		t.Fatalf("Records request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var list models.RecordsListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode records: %v", err)
+	}
+
+	if len(list.Records) != 1 || list.Records[0].ID != "user_1" {
+		t.Errorf("Expected only user_1 of type user, got %+v", list.Records)
+	}
+}
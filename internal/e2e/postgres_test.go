@@ -0,0 +1,284 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mit-service/internal/config"
+	"mit-service/internal/handler"
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+	"mit-service/internal/service"
+)
+
+// The tests in this file run the full stack against a real PostgreSQL and
+// are skipped unless E2E_POSTGRES is set. The databases are configured with
+// the usual DB_* and INBOX_DB_* variables, e.g. after `make db-up`:
+//
+//	E2E_POSTGRES=1 go test ./internal/e2e -run Postgres
+//
+// Every run uses record IDs with a unique prefix, so the tests can share a
+// database with other data but must not run against production.
+
+// postgresStack is the service under test backed by PostgreSQL
+type postgresStack struct {
+	repo   *repository.RepositoryManager
+	svc    *service.Service
+	server *httptest.Server
+	prefix string
+
+	// processed counts successful pipeline runs per record ID
+	mu        sync.Mutex
+	processed map[string]int
+}
+
+// newPostgresStack connects to PostgreSQL and starts the worker and server
+func newPostgresStack(t *testing.T, workerCount, batchSize, maxRetries int) *postgresStack {
+	t.Helper()
+
+	if os.Getenv("E2E_POSTGRES") == "" {
+		t.Skip("set E2E_POSTGRES=1 to run against PostgreSQL")
+	}
+
+	cfg := config.LoadConfig()
+	cfg.Repository.Type = "postgres"
+	cfg.Repository.ConnectRetries = 1
+
+	appMetrics := metrics.NewMetrics()
+	repoManager, err := repository.NewRepositoryManager(cfg, appMetrics)
+	if err != nil {
+		t.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+
+	s := &postgresStack{
+		repo:      repoManager,
+		svc:       service.NewService(repoManager, appMetrics),
+		prefix:    fmt.Sprintf("e2e_%d_", time.Now().UnixNano()),
+		processed: make(map[string]int),
+	}
+
+	s.svc.StartInboxWorker(workerCount, batchSize, 50*time.Millisecond, maxRetries, 100*time.Millisecond,
+		service.WithTaskMiddleware(s.countProcessed))
+	s.server = httptest.NewServer(handler.SetupRoutes(s.svc, appMetrics))
+
+	t.Cleanup(func() {
+		s.server.Close()
+		s.svc.Close()
+		s.cleanup(t)
+		repoManager.Close()
+	})
+
+	return s
+}
+
+// countProcessed is task middleware counting persisted tasks per record of
+// this run
+func (s *postgresStack) countProcessed(next service.TaskStep) service.TaskStep {
+	return func(ctx context.Context, task *models.InboxTask) error {
+		if err := next(ctx, task); err != nil {
+			return err
+		}
+
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(task.Payload, &payload) == nil && strings.HasPrefix(payload.ID, s.prefix) {
+			s.mu.Lock()
+			s.processed[payload.ID]++
+			s.mu.Unlock()
+		}
+		return nil
+	}
+}
+
+// cleanup removes the records created by this run
+func (s *postgresStack) cleanup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records, err := s.repo.Record.ListRecords(ctx, models.RecordFilter{Prefix: s.prefix, Limit: 10000})
+	if err != nil {
+		t.Logf("Failed to list test records for cleanup: %v", err)
+		return
+	}
+	for _, record := range records {
+		if err := s.repo.Record.Delete(ctx, record.ID); err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+			t.Logf("Failed to delete test record %s: %v", record.ID, err)
+		}
+	}
+}
+
+// post sends a JSON request and checks the response status
+func (s *postgresStack) post(t *testing.T, path string, body interface{}, expected int) {
+	t.Helper()
+
+	encoded, _ := json.Marshal(body)
+	resp, err := http.Post(s.server.URL+path, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", path, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		t.Fatalf("POST %s: expected status %d, got %d", path, expected, resp.StatusCode)
+	}
+}
+
+// get fetches a record through the API, nil when it does not exist
+func (s *postgresStack) get(t *testing.T, id string) *models.Record {
+	t.Helper()
+
+	resp, err := http.Get(s.server.URL + "/get?id=" + id)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: unexpected status %d", id, resp.StatusCode)
+	}
+
+	var record models.Record
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	return &record
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// findTask returns the task of the given status whose payload targets id
+func (s *postgresStack) findTask(t *testing.T, status, id string) *models.InboxTask {
+	t.Helper()
+
+	tasks, err := s.repo.Inbox.ListTasks(context.Background(), models.TaskFilter{Status: status, Limit: 1000})
+	if err != nil {
+		t.Fatalf("Failed to list %s tasks: %v", status, err)
+	}
+	for _, task := range tasks {
+		if strings.Contains(string(task.Payload), `"`+id+`"`) {
+			return task
+		}
+	}
+	return nil
+}
+
+func TestE2E_Postgres_RecordLifecycle(t *testing.T) {
+	s := newPostgresStack(t, 2, 5, 3)
+	id := s.prefix + "lifecycle"
+
+	s.post(t, "/insert", models.InsertRequest{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"name": "before"})}, http.StatusCreated)
+	waitFor(t, 5*time.Second, "insert", func() bool { return s.get(t, id) != nil })
+
+	s.post(t, "/update", models.UpdateRequest{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"name": "after"})}, http.StatusOK)
+	waitFor(t, 5*time.Second, "update", func() bool {
+		record := s.get(t, id)
+		if record == nil {
+			return false
+		}
+		var value map[string]interface{}
+		record.DecodeValue(&value)
+		return value["name"] == "after"
+	})
+
+	s.post(t, "/delete", models.DeleteRequest{ID: id}, http.StatusOK)
+	waitFor(t, 5*time.Second, "delete", func() bool { return s.get(t, id) == nil })
+}
+
+func TestE2E_Postgres_ConcurrentClaiming(t *testing.T) {
+	s := newPostgresStack(t, 8, 5, 3)
+
+	const count = 100
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("%sclaim_%03d", s.prefix, i)
+		s.post(t, "/insert", models.InsertRequest{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"n": i})}, http.StatusCreated)
+	}
+
+	waitFor(t, 20*time.Second, "all inserts", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.processed) == count
+	})
+
+	// Give a double claim the chance to show up before checking
+	time.Sleep(500 * time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, n := range s.processed {
+		if n != 1 {
+			t.Errorf("Task for record %s was processed %d times", id, n)
+		}
+	}
+}
+
+func TestE2E_Postgres_RetriesAndCleanup(t *testing.T) {
+	s := newPostgresStack(t, 1, 5, 1)
+	missing := s.prefix + "missing"
+	existing := s.prefix + "existing"
+
+	// Updating a missing record fails on every attempt until retries run out.
+	// It bypasses the API, which may reject it with transactional enqueue
+	payload, _ := json.Marshal(&models.UpdateTaskPayload{ID: missing, Value: models.MustEncodeValue(map[string]interface{}{"x": 1})})
+	err := s.repo.Inbox.CreateTask(context.Background(), &models.InboxTask{
+		ID:        fmt.Sprintf("%s-task", missing),
+		Operation: models.TaskOperationUpdate,
+		Payload:   payload,
+		Status:    models.TaskStatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	var failed *models.InboxTask
+	waitFor(t, 10*time.Second, "task to fail", func() bool {
+		failed = s.findTask(t, models.TaskStatusFailed, missing)
+		return failed != nil
+	})
+	if failed.Retries < 1 {
+		t.Errorf("Expected the failed task to be retried, got %d retries", failed.Retries)
+	}
+	if !strings.Contains(failed.Error, "not found") {
+		t.Errorf("Expected a not found error, got %q", failed.Error)
+	}
+
+	// Completed tasks are removed by cleanup
+	s.post(t, "/insert", models.InsertRequest{ID: existing, Value: models.MustEncodeValue(map[string]interface{}{"x": 1})}, http.StatusCreated)
+	waitFor(t, 5*time.Second, "task to complete", func() bool {
+		return s.findTask(t, models.TaskStatusCompleted, existing) != nil
+	})
+
+	if err := s.repo.Inbox.DeleteCompletedTasks(context.Background(), 0); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if task := s.findTask(t, models.TaskStatusCompleted, existing); task != nil {
+		t.Errorf("Expected completed task %s to be cleaned up", task.ID)
+	}
+}
@@ -0,0 +1,840 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mit-service/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportRecords bounds the records accepted by one /admin/import request
+const maxImportRecords = 10000
+
+// withAdmin restricts a handler to requests carrying the admin token as a
+// bearer token. Admin endpoints are unavailable when no token is configured
+func (h *Handler) withAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken == "" {
+			h.writeErrorResponse(w, http.StatusNotFound, "Admin endpoints are disabled")
+			return
+		}
+
+		if !h.adminAuthorized(r) {
+			h.writeErrorResponse(w, http.StatusUnauthorized, "Invalid admin token")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// adminAuthorized reports whether a request carries the admin token as a
+// bearer token, always false when no token is configured
+func (h *Handler) adminAuthorized(r *http.Request) bool {
+	if h.adminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
+// AdminTables handles GET /admin/tables requests - shows table sizes and dead-tuple estimates
+func (h *Handler) AdminTables(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats, err := h.service.GetTableStats(ctx)
+	if err != nil {
+		if h.clientGone(w, r, "AdminTables") {
+			return
+		}
+		log.Printf("AdminTables: failed to get table stats: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get table stats: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"tables": stats,
+	})
+}
+
+// AdminSchemaCheck handles GET /admin/schema-check requests - compares the
+// live database schema with the expected one, answering 503 on drift
+func (h *Handler) AdminSchemaCheck(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.CheckSchema(r.Context())
+	if err != nil {
+		if errors.Is(err, models.ErrSchemaCheckUnsupported) {
+			h.writeErrorResponse(w, http.StatusNotImplemented, err.Error())
+			return
+		}
+		if h.clientGone(w, r, "AdminSchemaCheck") {
+			return
+		}
+		log.Printf("AdminSchemaCheck: failed to check schema: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to check schema: "+err.Error())
+		return
+	}
+
+	code := http.StatusOK
+	if !report.InSync {
+		code = http.StatusServiceUnavailable
+	}
+	h.writeJSONResponse(w, code, report)
+}
+
+// AdminExplain handles GET /admin/explain?endpoint=<path>&<params> requests -
+// runs EXPLAIN ANALYZE for the queries the endpoint issues with the params
+func (h *Handler) AdminExplain(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	endpoint := params.Get("endpoint")
+	params.Del("endpoint")
+
+	report, err := h.service.Explain(r.Context(), endpoint, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidExplain):
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrExplainUnsupported):
+			h.writeErrorResponse(w, http.StatusNotImplemented, err.Error())
+		default:
+			if h.clientGone(w, r, "AdminExplain") {
+				return
+			}
+			log.Printf("AdminExplain: failed to explain %s: %v", endpoint, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to explain queries: "+err.Error())
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, report)
+}
+
+// AdminHotRecords handles GET /admin/hot-records?limit=<n>&by=<reads|writes|total>
+// requests - lists the most accessed records
+func (h *Handler) AdminHotRecords(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsed, 1000)
+	}
+
+	orderBy := r.URL.Query().Get("by")
+	switch orderBy {
+	case "":
+		orderBy = models.AccessOrderTotal
+	case models.AccessOrderReads, models.AccessOrderWrites, models.AccessOrderTotal:
+	default:
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid ordering, use reads, writes or total")
+		return
+	}
+
+	stats, err := h.service.HottestRecords(r.Context(), limit, orderBy)
+	if err != nil {
+		if errors.Is(err, models.ErrAccessStatsDisabled) {
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Access statistics are not enabled")
+			return
+		}
+		if h.clientGone(w, r, "AdminHotRecords") {
+			return
+		}
+		log.Printf("AdminHotRecords: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get access stats: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"records": stats,
+		"by":      orderBy,
+	})
+}
+
+// AdminSnapshots handles GET /admin/snapshots requests - lists saved snapshots
+func (h *Handler) AdminSnapshots(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := h.service.ListSnapshots(r.Context())
+	if err != nil {
+		h.writeSnapshotError(w, r, "AdminSnapshots", err)
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"snapshots": snapshots,
+	})
+}
+
+// AdminSaveSnapshot handles POST /admin/snapshots/save?name=<name> requests
+func (h *Handler) AdminSaveSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	info, err := h.service.SaveSnapshot(r.Context(), name)
+	if err != nil {
+		h.writeSnapshotError(w, r, "AdminSaveSnapshot", err)
+		return
+	}
+
+	log.Printf("AdminSaveSnapshot: saved snapshot '%s' (%d records, %d tasks)", info.Name, info.Records, info.Tasks)
+	h.writeJSONResponse(w, http.StatusOK, info)
+}
+
+// AdminLoadSnapshot handles POST /admin/snapshots/load?name=<name> requests
+func (h *Handler) AdminLoadSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	info, err := h.service.LoadSnapshot(r.Context(), name)
+	if err != nil {
+		h.writeSnapshotError(w, r, "AdminLoadSnapshot", err)
+		return
+	}
+
+	log.Printf("AdminLoadSnapshot: loaded snapshot '%s' (%d records, %d tasks)", info.Name, info.Records, info.Tasks)
+	h.writeJSONResponse(w, http.StatusOK, info)
+}
+
+// writeSnapshotError maps snapshot errors to HTTP responses
+func (h *Handler) writeSnapshotError(w http.ResponseWriter, r *http.Request, operation string, err error) {
+	switch {
+	case errors.Is(err, models.ErrSnapshotsUnsupported):
+		h.writeErrorResponse(w, http.StatusNotImplemented, "Snapshots are not enabled")
+	case errors.Is(err, models.ErrInvalidSnapshotName):
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid snapshot name, use 1-64 letters, digits, '-' or '_'")
+	case errors.Is(err, fs.ErrNotExist):
+		h.writeErrorResponse(w, http.StatusNotFound, "Snapshot not found")
+	default:
+		if h.clientGone(w, r, operation) {
+			return
+		}
+		log.Printf("%s: %v", operation, err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Snapshot operation failed: "+err.Error())
+	}
+}
+
+// AdminRetention handles /admin/retention requests. GET reports what the
+// retention rules would delete, POST applies them right away
+func (h *Handler) AdminRetention(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.Method == http.MethodGet
+
+	reports := h.service.EvaluateRetention(r.Context(), dryRun)
+	if h.clientGone(w, r, "AdminRetention") {
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"rules": reports,
+	})
+}
+
+// AdminDuplicates handles /admin/duplicates requests. POST starts a scan for
+// records with identical values in the background, GET returns the running
+// or last finished scan
+func (h *Handler) AdminDuplicates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := h.service.DuplicateReport()
+		if report == nil {
+			h.writeErrorResponse(w, http.StatusNotFound, "No duplicate scan has been run, start one with POST")
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, report)
+
+	case http.MethodPost:
+		report, err := h.service.StartDuplicateScan()
+		if err != nil {
+			if errors.Is(err, models.ErrScanRunning) {
+				h.writeErrorResponse(w, http.StatusConflict, "A duplicate scan is already running")
+				return
+			}
+			log.Printf("AdminDuplicates: %v", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start duplicate scan: "+err.Error())
+			return
+		}
+		log.Printf("AdminDuplicates: started duplicate scan")
+		h.writeJSONResponse(w, http.StatusAccepted, report)
+
+	}
+}
+
+// AdminIntegrity handles /admin/integrity requests. POST starts re-hashing
+// stored values in the background, GET returns the running or last finished
+// check with the records whose value no longer matches its hash
+func (h *Handler) AdminIntegrity(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := h.service.IntegrityReport()
+		if report == nil {
+			h.writeErrorResponse(w, http.StatusNotFound, "No integrity check has been run, start one with POST")
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, report)
+
+	case http.MethodPost:
+		report, err := h.service.StartIntegrityCheck()
+		if err != nil {
+			if errors.Is(err, models.ErrScanRunning) {
+				h.writeErrorResponse(w, http.StatusConflict, "An integrity check is already running")
+				return
+			}
+			log.Printf("AdminIntegrity: %v", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start integrity check: "+err.Error())
+			return
+		}
+		log.Printf("AdminIntegrity: started integrity check")
+		h.writeJSONResponse(w, http.StatusAccepted, report)
+
+	}
+}
+
+// AdminReplication handles GET /admin/replication requests - returns the
+// replication cursor, lag and counters and the last backfill
+func (h *Handler) AdminReplication(w http.ResponseWriter, r *http.Request) {
+	status, err := h.service.ReplicationStatus()
+	if err != nil {
+		if errors.Is(err, models.ErrReplicationDisabled) {
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Replication is not enabled")
+			return
+		}
+		log.Printf("AdminReplication: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get replication status: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, status)
+}
+
+// AdminReplicationBackfill handles POST /admin/replication/backfill requests -
+// starts copying every record to the secondary, progress is reported by
+// GET /admin/replication
+func (h *Handler) AdminReplicationBackfill(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.StartReplicationBackfill()
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrReplicationDisabled):
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Replication is not enabled")
+		case errors.Is(err, models.ErrScanRunning):
+			h.writeErrorResponse(w, http.StatusConflict, "A backfill is already running")
+		default:
+			log.Printf("AdminReplicationBackfill: %v", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start backfill: "+err.Error())
+		}
+		return
+	}
+
+	log.Printf("AdminReplicationBackfill: started backfill")
+	h.writeJSONResponse(w, http.StatusAccepted, report)
+}
+
+// AdminShadow handles GET /admin/shadow requests - returns the mirrored
+// write and compared read counts, the recent divergences and the last
+// backfill of the shadow repository
+func (h *Handler) AdminShadow(w http.ResponseWriter, r *http.Request) {
+	status, err := h.service.ShadowStatus()
+	if err != nil {
+		if errors.Is(err, models.ErrShadowDisabled) {
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Shadow writes are not enabled")
+			return
+		}
+		log.Printf("AdminShadow: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get shadow status: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, status)
+}
+
+// AdminShadowBackfill handles POST /admin/shadow/backfill requests - starts
+// copying every record to the shadow, progress is reported by
+// GET /admin/shadow
+func (h *Handler) AdminShadowBackfill(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.StartShadowBackfill()
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrShadowDisabled):
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Shadow writes are not enabled")
+		case errors.Is(err, models.ErrScanRunning):
+			h.writeErrorResponse(w, http.StatusConflict, "A backfill is already running")
+		default:
+			log.Printf("AdminShadowBackfill: %v", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start backfill: "+err.Error())
+		}
+		return
+	}
+
+	log.Printf("AdminShadowBackfill: started backfill")
+	h.writeJSONResponse(w, http.StatusAccepted, report)
+}
+
+// AdminShadowCutover handles /admin/shadow/cutover requests - POST starts
+// promoting the shadow backend to primary, or switching back after a
+// cutover, GET returns the running or last cutover
+func (h *Handler) AdminShadowCutover(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := h.service.CutoverReport()
+		if report == nil {
+			h.writeErrorResponse(w, http.StatusNotFound, "No cutover has been started, start one with POST")
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, report)
+
+	case http.MethodPost:
+		var req models.CutoverRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+			return
+		}
+
+		report, err := h.service.StartCutover(&req)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrShadowDisabled):
+				h.writeErrorResponse(w, http.StatusNotImplemented, "Shadow writes are not enabled")
+			case errors.Is(err, models.ErrInvalidCutover):
+				h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, models.ErrCutoverNotReady):
+				h.writeErrorResponse(w, http.StatusConflict, err.Error())
+			case errors.Is(err, models.ErrScanRunning):
+				h.writeErrorResponse(w, http.StatusConflict, "A cutover is already running")
+			default:
+				log.Printf("AdminShadowCutover: %v", err)
+				h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start cutover: "+err.Error())
+			}
+			return
+		}
+		log.Printf("AdminShadowCutover: started cutover from the %s to the %s backend", report.From, report.To)
+		h.writeJSONResponse(w, http.StatusAccepted, report)
+
+	}
+}
+
+// AdminSearchIndex handles GET /admin/search-index requests - returns the
+// indexer cursor, lag and counters and the last reindex
+func (h *Handler) AdminSearchIndex(w http.ResponseWriter, r *http.Request) {
+	status, err := h.service.SearchIndexStatus()
+	if err != nil {
+		if errors.Is(err, models.ErrSearchDisabled) {
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Search is not enabled")
+			return
+		}
+		log.Printf("AdminSearchIndex: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get search index status: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, status)
+}
+
+// AdminSearchReindex handles POST /admin/search-index/reindex requests -
+// starts indexing every record, progress is reported by
+// GET /admin/search-index
+func (h *Handler) AdminSearchReindex(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.StartSearchReindex()
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrSearchDisabled):
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Search is not enabled")
+		case errors.Is(err, models.ErrScanRunning):
+			h.writeErrorResponse(w, http.StatusConflict, "A reindex is already running")
+		default:
+			log.Printf("AdminSearchReindex: %v", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start reindex: "+err.Error())
+		}
+		return
+	}
+
+	log.Printf("AdminSearchReindex: started reindex")
+	h.writeJSONResponse(w, http.StatusAccepted, report)
+}
+
+// AdminAnalytics handles /admin/analytics requests - GET returns the
+// progress of the analytics export, POST exports now instead of at the next
+// interval
+func (h *Handler) AdminAnalytics(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status, err := h.service.AnalyticsStatus()
+		if err != nil {
+			h.writeAnalyticsError(w, err)
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, status)
+	case http.MethodPost:
+		if err := h.service.TriggerAnalyticsExport(); err != nil {
+			h.writeAnalyticsError(w, err)
+			return
+		}
+		log.Printf("AdminAnalytics: triggered export")
+		h.writeJSONResponse(w, http.StatusAccepted, models.SuccessResponse{Message: "Analytics export triggered"})
+	}
+}
+
+// writeAnalyticsError responds to a failed analytics request
+func (h *Handler) writeAnalyticsError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrAnalyticsDisabled) {
+		h.writeErrorResponse(w, http.StatusNotImplemented, "Analytics export is not enabled")
+		return
+	}
+	log.Printf("AdminAnalytics: %v", err)
+	h.writeErrorResponse(w, http.StatusInternalServerError, "Analytics request failed: "+err.Error())
+}
+
+// AdminDigest handles /admin/digest requests - GET returns the digest of the
+// tasks failed since the last one sent, POST sends it now
+func (h *Handler) AdminDigest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		digest, err := h.service.PendingDigest(r.Context())
+		if err != nil {
+			h.writeDigestError(w, r, err)
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, digest)
+	case http.MethodPost:
+		if err := h.service.TriggerDigest(); err != nil {
+			h.writeDigestError(w, r, err)
+			return
+		}
+		log.Printf("AdminDigest: triggered digest")
+		h.writeJSONResponse(w, http.StatusAccepted, models.SuccessResponse{Message: "Digest triggered"})
+	}
+}
+
+// writeDigestError responds to a failed digest request
+func (h *Handler) writeDigestError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrDigestDisabled) {
+		h.writeErrorResponse(w, http.StatusNotImplemented, "Failed task digest is not enabled")
+		return
+	}
+	if h.clientGone(w, r, "AdminDigest") {
+		return
+	}
+	log.Printf("AdminDigest: %v", err)
+	h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to build digest: "+err.Error())
+}
+
+// AdminExport handles GET /admin/export requests - returns a page of records
+// in ID order, filtered by ?prefix= and ?exclude_prefix=. The next page is
+// requested with ?after_id= set to the returned next_after_id
+func (h *Handler) AdminExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.RecordFilter{
+		Prefix:        query.Get("prefix"),
+		ExcludePrefix: query.Get("exclude_prefix"),
+		AfterID:       query.Get("after_id"),
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	page, err := h.service.ExportRecords(r.Context(), filter)
+	if err != nil {
+		if h.clientGone(w, r, "AdminExport") {
+			return
+		}
+		log.Printf("AdminExport: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to export records: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, page)
+}
+
+// AdminImport handles POST /admin/import requests - writes the records in the
+// body directly to the repository, see models.ImportRequest
+func (h *Handler) AdminImport(w http.ResponseWriter, r *http.Request) {
+	var req models.ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+	if len(req.Records) > maxImportRecords {
+		h.writeErrorResponse(w, http.StatusBadRequest,
+			"Too many records, import at most "+strconv.Itoa(maxImportRecords)+" per request")
+		return
+	}
+
+	result, err := h.service.ImportRecords(r.Context(), &req)
+	if err != nil {
+		if h.clientGone(w, r, "AdminImport") {
+			return
+		}
+		log.Printf("AdminImport: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to import records: "+err.Error())
+		return
+	}
+
+	log.Printf("AdminImport: %d created, %d updated, %d skipped, %d failed (dry run: %t)",
+		result.Created, result.Updated, result.Skipped, result.Failed, result.DryRun)
+	h.writeJSONResponse(w, http.StatusOK, result)
+}
+
+// AdminClone handles /admin/clone requests. POST starts copying the records
+// of another instance into this one in the background, GET returns the
+// running or last finished clone
+func (h *Handler) AdminClone(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := h.service.CloneReport()
+		if report == nil {
+			h.writeErrorResponse(w, http.StatusNotFound, "No clone has been run, start one with POST")
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, report)
+
+	case http.MethodPost:
+		var req models.CloneRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+			return
+		}
+		source, err := url.Parse(req.SourceURL)
+		if err != nil || (source.Scheme != "http" && source.Scheme != "https") || source.Host == "" {
+			h.writeErrorResponse(w, http.StatusBadRequest, "source_url must be an http or https URL")
+			return
+		}
+
+		report, err := h.service.StartClone(&req)
+		if err != nil {
+			if errors.Is(err, models.ErrScanRunning) {
+				h.writeErrorResponse(w, http.StatusConflict, "A clone is already running")
+				return
+			}
+			log.Printf("AdminClone: %v", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start clone: "+err.Error())
+			return
+		}
+		log.Printf("AdminClone: started clone from %s (dry run: %t)", req.SourceURL, req.DryRun)
+		h.writeJSONResponse(w, http.StatusAccepted, report)
+
+	}
+}
+
+// AdminReprocess handles /admin/reprocess requests. POST starts running the
+// finished tasks selected by the body through the processing pipeline again,
+// see models.ReprocessRequest; GET returns the running or last finished run
+func (h *Handler) AdminReprocess(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := h.service.ReprocessReport()
+		if report == nil {
+			h.writeErrorResponse(w, http.StatusNotFound, "No reprocessing has been run, start one with POST")
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, report)
+
+	case http.MethodPost:
+		var req models.ReprocessRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+			return
+		}
+
+		report, err := h.service.StartReprocess(&req)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidReprocess):
+				h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, models.ErrHistoryUnsupported):
+				h.writeErrorResponse(w, http.StatusNotImplemented, "Record history is not enabled")
+			case errors.Is(err, models.ErrScanRunning):
+				h.writeErrorResponse(w, http.StatusConflict, "A reprocessing run is already running")
+			default:
+				log.Printf("AdminReprocess: %v", err)
+				h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start reprocessing: "+err.Error())
+			}
+			return
+		}
+		log.Printf("AdminReprocess: started reprocessing %s from %s (dry run: %t)",
+			req.Source, req.From.Format(time.RFC3339), req.DryRun)
+		h.writeJSONResponse(w, http.StatusAccepted, report)
+
+	}
+}
+
+// AdminVerify handles /admin/verify requests. POST starts replaying the
+// completed tasks selected by the body against the shadow repository and
+// comparing the result with the primary, see models.VerifyRequest; GET
+// returns the running or last finished run
+func (h *Handler) AdminVerify(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := h.service.VerifyReport()
+		if report == nil {
+			h.writeErrorResponse(w, http.StatusNotFound, "No verify run has been started, start one with POST")
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, report)
+
+	case http.MethodPost:
+		var req models.VerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+			return
+		}
+
+		report, err := h.service.StartVerify(&req)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidVerify):
+				h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, models.ErrScanRunning):
+				h.writeErrorResponse(w, http.StatusConflict, "A verify run is already running")
+			default:
+				log.Printf("AdminVerify: %v", err)
+				h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to start verify run: "+err.Error())
+			}
+			return
+		}
+		log.Printf("AdminVerify: started verify run against the %s shadow from %s",
+			report.Shadow, req.From.Format(time.RFC3339))
+		h.writeJSONResponse(w, http.StatusAccepted, report)
+
+	}
+}
+
+// AdminIngest handles GET /admin/ingest requests - lists the status of every
+// file under the watched prefix, or of one file with ?key=
+func (h *Handler) AdminIngest(w http.ResponseWriter, r *http.Request) {
+	var response interface{}
+	var err error
+	if key := r.URL.Query().Get("key"); key != "" {
+		response, err = h.service.IngestFile(key)
+	} else {
+		var files []*models.IngestFile
+		files, err = h.service.IngestFiles()
+		response = map[string]interface{}{"files": files}
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrIngestDisabled):
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Ingestion is not enabled")
+		case errors.Is(err, models.ErrIngestFileNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, "File not found")
+		default:
+			log.Printf("AdminIngest: %v", err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get ingest status: "+err.Error())
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, response)
+}
+
+// AdminIngestNotify handles POST /admin/ingest/notify requests - lists the
+// watched prefix now, e.g. on an S3 event notification, retrying the failed
+// files named in the body
+func (h *Handler) AdminIngestNotify(w http.ResponseWriter, r *http.Request) {
+	var req models.IngestNotification
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+
+	keys := req.Keys
+	for _, record := range req.Records {
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid object key: "+record.S3.Object.Key)
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	if err := h.service.NotifyIngest(keys); err != nil {
+		if errors.Is(err, models.ErrIngestDisabled) {
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Ingestion is not enabled")
+			return
+		}
+		log.Printf("AdminIngestNotify: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to notify ingestion: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusAccepted, map[string]interface{}{"keys": keys})
+}
+
+// AdminSchemas handles /admin/schemas requests managing record types:
+// GET lists all types or returns one with ?name=, PUT ?name= registers the
+// JSON Schema in the body, DELETE ?name= removes an unused type
+func (h *Handler) AdminSchemas(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			types, err := h.service.ListRecordTypes(ctx)
+			if err != nil {
+				h.writeSchemaError(w, r, "AdminSchemas", err)
+				return
+			}
+			h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+				"types": types,
+			})
+			return
+		}
+
+		recordType, err := h.service.GetRecordType(ctx, name)
+		if err != nil {
+			h.writeSchemaError(w, r, "AdminSchemas", err)
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, recordType)
+
+	case http.MethodPut:
+		var schemaDoc map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&schemaDoc); err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid schema JSON: "+err.Error())
+			return
+		}
+
+		recordType := &models.RecordType{Name: name, Schema: schemaDoc}
+		if err := h.service.PutRecordType(ctx, recordType); err != nil {
+			h.writeSchemaError(w, r, "AdminSchemas", err)
+			return
+		}
+
+		log.Printf("AdminSchemas: registered record type '%s'", name)
+		h.writeJSONResponse(w, http.StatusOK, recordType)
+
+	case http.MethodDelete:
+		if err := h.service.DeleteRecordType(ctx, name); err != nil {
+			h.writeSchemaError(w, r, "AdminSchemas", err)
+			return
+		}
+
+		log.Printf("AdminSchemas: deleted record type '%s'", name)
+		h.writeJSONResponse(w, http.StatusOK, models.SuccessResponse{
+			Message: "Record type deleted",
+		})
+
+	}
+}
+
+// writeSchemaError maps record type errors to HTTP responses
+func (h *Handler) writeSchemaError(w http.ResponseWriter, r *http.Request, operation string, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidSchema):
+		h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrUnknownRecordType):
+		h.writeErrorResponse(w, http.StatusNotFound, "Record type not found")
+	case errors.Is(err, models.ErrRecordExists):
+		h.writeErrorResponse(w, http.StatusConflict, err.Error())
+	default:
+		if h.clientGone(w, r, operation) {
+			return
+		}
+		log.Printf("%s: %v", operation, err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Record type operation failed: "+err.Error())
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"mit-service/internal/models"
+)
+
+// WebSocket timings of /ws connections
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 2 * wsPingInterval
+)
+
+// wsUpgrader upgrades /ws requests. Any origin may connect, as the CORS
+// headers of the other routes allow
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// Changes handles GET /ws requests - upgrades to a WebSocket streaming the
+// record writes applied by this instance as JSON messages, e.g.
+// {"operation": "update", "id": "user_1", ...}. ids (comma-separated) and
+// prefix select the records. The connection is closed with 1013 (try again
+// later) when the client cannot keep up
+func (h *Handler) Changes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.ChangeFilter{Prefix: query.Get("prefix")}
+	for _, id := range strings.Split(query.Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events, err := h.service.SubscribeChanges(ctx, filter)
+	if err != nil {
+		if errors.Is(err, models.ErrTooManySubscribers) {
+			w.Header().Set("Retry-After", "1")
+			h.writeErrorResponse(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		log.Printf("Changes: failed to subscribe: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to subscribe to changes: "+err.Error())
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader answered the request
+		log.Printf("Changes: failed to upgrade: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// The read loop answers pings and notices the client leaving; clients
+	// send nothing else
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if ctx.Err() == nil {
+					message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind")
+					conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteTimeout))
+				}
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
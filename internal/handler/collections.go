@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"mit-service/internal/models"
+	"mit-service/internal/service"
+)
+
+// withCollection confines the requests of /collections/{name}/... routes to
+// the records of the collection
+func (h *Handler) withCollection(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !service.ValidCollectionName(name) {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid collection name")
+			return
+		}
+		next(w, r.WithContext(service.WithCollection(r.Context(), name)))
+	}
+}
+
+// idFromPath sets id from the {id} wildcard of resource-style routes,
+// which takes precedence over an ID in the query or body
+func idFromPath(r *http.Request, id *string) {
+	if pathID := r.PathValue("id"); pathID != "" {
+		*id = pathID
+	}
+}
+
+// Collections handles GET /collections requests - lists the collections
+// with their record counts
+func (h *Handler) Collections(w http.ResponseWriter, r *http.Request) {
+	response, err := h.service.ListCollections(r.Context())
+	if err != nil {
+		if h.clientGone(w, r, "Collections") {
+			return
+		}
+		log.Printf("Collections: failed to list collections: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to list collections: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, response)
+}
+
+// Collection handles GET /collections/{name} requests - returns the stats
+// of a collection
+func (h *Handler) Collection(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	stats, err := h.service.GetCollection(r.Context(), name)
+	if err != nil {
+		if h.clientGone(w, r, "Collection") {
+			return
+		}
+		if errors.Is(err, models.ErrCollectionNotFound) {
+			h.writeErrorResponse(w, http.StatusNotFound, "Collection not found")
+			return
+		}
+		log.Printf("Collection: failed to get collection %s: %v", name, err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get collection: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, stats)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"mit-service/internal/reqtrace"
+)
+
+const (
+	// debugHeader asks for a trace of the request, honoured only together
+	// with the admin token
+	debugHeader = "X-Debug"
+
+	// debugTraceHeader carries the trace of responses that are not JSON
+	// objects
+	debugTraceHeader = "X-Debug-Trace"
+)
+
+// withDebug traces requests sending X-Debug: true with the admin token: the
+// time spent in the handler, service and repository layers, the SQL executed
+// and the cache lookups. The trace is added as a "debug" field to JSON object
+// responses and sent in the X-Debug-Trace header otherwise. Requests without
+// the admin token are served untraced
+func (h *Handler) withDebug(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if enabled, _ := strconv.ParseBool(r.Header.Get(debugHeader)); !enabled || !h.adminAuthorized(r) {
+			next(w, r)
+			return
+		}
+
+		trace := reqtrace.New()
+		bw := &bufferedWriter{header: w.Header()}
+		endHandler := trace.Span("handler", r.URL.Path)
+		next(bw, r.WithContext(reqtrace.WithTrace(r.Context(), trace)))
+		endHandler()
+
+		encodedTrace, err := json.Marshal(trace.Report())
+		if err != nil {
+			log.Printf("Failed to encode the trace of %s: %v", r.URL.Path, err)
+			bw.flush(w)
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(bw.header.Get("Content-Type"))
+		var fields map[string]json.RawMessage
+		if mediaType != "application/json" || json.Unmarshal(bw.body.Bytes(), &fields) != nil || fields == nil {
+			w.Header().Set(debugTraceHeader, string(encodedTrace))
+			bw.flush(w)
+			return
+		}
+
+		fields["debug"] = encodedTrace
+		var body bytes.Buffer
+		if err := json.NewEncoder(&body).Encode(fields); err != nil {
+			log.Printf("Failed to add the trace of %s: %v", r.URL.Path, err)
+			bw.flush(w)
+			return
+		}
+		bw.body = body
+		bw.flush(w)
+	}
+}
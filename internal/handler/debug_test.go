@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/reqtrace"
+)
+
+func TestDebugTrace(t *testing.T) {
+	svc := &fakeService{
+		record:  &models.Record{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})},
+		records: &models.RecordsListResponse{Limit: 50},
+	}
+	mux := newTestMux(svc)
+
+	req := newAdminRequest(t, http.MethodGet, "/get?id=user_1", nil)
+	req.Header.Set(debugHeader, "true")
+	rec := serve(mux, req)
+	assertStatus(t, rec, http.StatusOK)
+
+	var resp struct {
+		ID    string          `json:"id"`
+		Debug reqtrace.Report `json:"debug"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.ID != "user_1" {
+		t.Errorf("Expected the record next to the trace, got %s", rec.Body.String())
+	}
+	if len(resp.Debug.Spans) != 1 || resp.Debug.Spans[0].Layer != "handler" || resp.Debug.Spans[0].Name != "/get" {
+		t.Errorf("Expected the handler span, got %+v", resp.Debug.Spans)
+	}
+
+	// Errors are JSON objects too
+	req = newAdminRequest(t, http.MethodGet, "/get", nil)
+	req.Header.Set(debugHeader, "1")
+	rec = serve(mux, req)
+	assertStatus(t, rec, http.StatusBadRequest)
+	assertErrorContains(t, rec, "ID parameter is required")
+	var fields map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &fields)
+	if _, traced := fields["debug"]; !traced || rec.Header().Get(debugTraceHeader) != "" {
+		t.Errorf("Expected the trace in the body, got %s", rec.Body.String())
+	}
+
+	// Without the admin token the header is ignored
+	req = newRequest(t, http.MethodGet, "/get?id=user_1", nil)
+	req.Header.Set(debugHeader, "true")
+	rec = serve(mux, req)
+	fields = nil
+	json.Unmarshal(rec.Body.Bytes(), &fields)
+	if _, traced := fields["debug"]; traced {
+		t.Errorf("Expected no trace without the admin token, got %s", rec.Body.String())
+	}
+}
+
+func TestDebugTrace_Header(t *testing.T) {
+	h := NewHandler(&fakeService{}, metrics.NewMetrics(), WithAdminToken(testAdminToken))
+	traced := h.withDebug(func(w http.ResponseWriter, r *http.Request) {
+		defer reqtrace.FromContext(r.Context()).Span("service", "Export")()
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("id\nuser_1\n"))
+	})
+
+	req := newAdminRequest(t, http.MethodGet, "/export", nil)
+	req.Header.Set(debugHeader, "true")
+	rec := serve(traced, req)
+	assertStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != "id\nuser_1\n" {
+		t.Errorf("Expected the body unchanged, got %q", rec.Body.String())
+	}
+
+	var report reqtrace.Report
+	if err := json.Unmarshal([]byte(rec.Header().Get(debugTraceHeader)), &report); err != nil {
+		t.Fatalf("Expected the trace in %s: %v", debugTraceHeader, err)
+	}
+	if len(report.Spans) != 2 || report.Spans[0].Layer != "service" || report.Spans[1].Layer != "handler" {
+		t.Errorf("Expected service and handler spans, got %+v", report.Spans)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"mit-service/internal/binenc"
+	"mit-service/internal/models"
+)
+
+// decodeBody decodes a JSON request body into v, numbers as json.Number so
+// values keep their precision. CBOR and MessagePack bodies, announced by
+// their Content-Type, are converted to JSON first
+func decodeBody(r *http.Request, v interface{}) error {
+	format, ok := binenc.Parse(r.Header.Get("Content-Type"))
+	if !ok {
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		return decoder.Decode(v)
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return io.EOF
+	}
+	converted, err := binenc.ToJSON(format, data)
+	if err != nil {
+		return err
+	}
+	return models.UnmarshalValue(converted, v)
+}
+
+// acceptedFormat returns the binary format preferred by the Accept header,
+// false when JSON comes first or no binary format is listed
+func acceptedFormat(r *http.Request) (binenc.Format, bool) {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if format, ok := binenc.Parse(accepted); ok {
+			return format, true
+		}
+		mediaType, _, _ := mime.ParseMediaType(accepted)
+		if mediaType == "application/json" || mediaType == "*/*" {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// writeNegotiatedResponse writes data as JSON, or as CBOR or MessagePack
+// when the client asks for it in the Accept header. Data holding numbers the
+// binary format cannot represent exactly is refused with 406
+func (h *Handler) writeNegotiatedResponse(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	format, ok := acceptedFormat(r)
+	if !ok {
+		h.writeJSONResponse(w, statusCode, data)
+		return
+	}
+
+	encoded, err := json.Marshal(data)
+	if err == nil {
+		encoded, err = binenc.FromJSON(format, encoded)
+	}
+	if errors.Is(err, binenc.ErrNumberRange) {
+		h.writeErrorResponse(w, http.StatusNotAcceptable, fmt.Sprintf("Response cannot be encoded as %s: %v", format, err))
+		return
+	}
+	if err != nil {
+		log.Printf("Error encoding %s response: %v", format, err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", string(format))
+	w.WriteHeader(statusCode)
+	w.Write(encoded)
+}
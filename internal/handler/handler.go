@@ -1,14 +1,23 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"mit-service/internal/metrics"
 	"mit-service/internal/models"
 	"mit-service/internal/service"
+	"mit-service/internal/version"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -16,16 +25,85 @@ import (
 
 // Handler handles HTTP requests
 type Handler struct {
-	service *service.Service
+	service service.API
 	metrics *metrics.Metrics
+
+	// adminToken guards the /admin endpoints, empty disables them
+	adminToken string
+
+	// shedder rejects low-priority requests under overload, nil disables it
+	shedder *LoadShedder
+
+	// limiters are per-route semaphores capping concurrent requests
+	limiters map[string]chan struct{}
+
+	// timeouts are per-route time budgets, "*" applies to unlisted routes
+	timeouts map[string]time.Duration
+
+	// quietRequests turns off the per-request log line
+	quietRequests bool
+
+	// templates shape responses per client profile, nil disables shaping
+	templates *ResponseTemplates
+
+	// generateIDs accepts inserts without ID, the service generating one
+	generateIDs bool
+
+	// sandboxKeys maps sandbox API keys to their sandbox, nil disables
+	// sandboxes
+	sandboxKeys map[string]string
+
+	// tenantKeys maps tenant API keys to their tenant, tenantHeader trusts
+	// the X-Tenant-ID header and tenantRequired rejects record requests
+	// without a tenant
+	tenantKeys     map[string]string
+	tenantHeader   bool
+	tenantRequired bool
+
+	// middleware is added to the chains of every route
+	middleware Chain
+
+	// routes are the routes registered by SetupRoutes
+	routes []apiRoute
+}
+
+// Option configures optional handler behaviour
+type Option func(*Handler)
+
+// WithAdminToken enables the /admin endpoints for requests carrying the token
+func WithAdminToken(token string) Option {
+	return func(h *Handler) {
+		h.adminToken = token
+	}
+}
+
+// WithRequestLogging turns the per-request log line on or off, it is on by default
+func WithRequestLogging(enabled bool) Option {
+	return func(h *Handler) {
+		h.quietRequests = !enabled
+	}
+}
+
+// WithGeneratedIDs accepts inserts without ID, for a service configured
+// with an ID strategy
+func WithGeneratedIDs() Option {
+	return func(h *Handler) {
+		h.generateIDs = true
+	}
 }
 
 // NewHandler creates a new handler instance
-func NewHandler(service *service.Service, metrics *metrics.Metrics) *Handler {
-	return &Handler{
+func NewHandler(service service.API, metrics *metrics.Metrics, opts ...Option) *Handler {
+	h := &Handler{
 		service: service,
 		metrics: metrics,
 	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
 }
 
 // validateID validates that ID is not empty or whitespace
@@ -33,58 +111,254 @@ func (h *Handler) validateID(id string) bool {
 	return strings.TrimSpace(id) != ""
 }
 
+// validateInsertID also accepts an omitted ID when the service generates
+// the IDs of inserts
+func (h *Handler) validateInsertID(id string) bool {
+	return (id == "" && h.generateIDs) || h.validateID(id)
+}
+
+// valueProblem returns why the value of a write is refused, "" when it is a
+// JSON object with members
+func valueProblem(value json.RawMessage) string {
+	if models.IsEmptyValue(value) {
+		return "Value cannot be empty"
+	}
+	if !models.IsObjectValue(value) {
+		return "Value must be a JSON object"
+	}
+	return ""
+}
+
 // Insert handles POST /insert requests
 func (h *Handler) Insert(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if isProtobuf(r) {
+		h.insertProto(w, r)
 		return
 	}
 
 	var req models.InsertRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeBody(r, &req); err != nil {
 		log.Printf("Insert: invalid request: %v", err)
 		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
 		return
 	}
 
 	// Validate ID
-	if !h.validateID(req.ID) {
+	if !h.validateInsertID(req.ID) {
 		h.writeErrorResponse(w, http.StatusBadRequest, "ID cannot be empty")
 		return
 	}
 
 	// Validate Value
-	if len(req.Value) == 0 {
-		h.writeErrorResponse(w, http.StatusBadRequest, "Value cannot be empty")
+	if problem := valueProblem(req.Value); problem != "" {
+		h.writeErrorResponse(w, http.StatusBadRequest, problem)
 		return
 	}
 
 	ctx := r.Context()
-	if err := h.service.Insert(ctx, &req); err != nil {
+	task, err := h.service.Insert(ctx, &req)
+	if err != nil {
+		if h.clientGone(w, r, "Insert") {
+			return
+		}
 		log.Printf("Insert: failed to insert record %s: %v", req.ID, err)
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to insert record: "+err.Error())
+		if errors.Is(err, models.ErrUnknownRecordType) {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Unknown record type: "+req.Type)
+		} else if errors.Is(err, models.ErrIDRequired) {
+			h.writeErrorResponse(w, http.StatusBadRequest, "ID cannot be empty")
+		} else if errors.Is(err, models.ErrSystemRecord) {
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		} else if errors.Is(err, models.ErrSchemaValidation) {
+			h.writeErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		} else if !h.writeReservationError(w, err) && !h.writeTaskIDError(w, r, req.TaskID, err) {
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to insert record: "+err.Error())
+		}
 		return
 	}
 
 	log.Printf("Insert: queued insert task for record ID: %s", req.ID)
-	h.writeJSONResponse(w, http.StatusCreated, models.SuccessResponse{
-		Message: "Insert task queued successfully",
+	h.writeQueued(w, http.StatusCreated, "Insert task queued successfully", req.ID, task)
+}
+
+// maxInsertBatch is the most records a batch insert may hold
+const maxInsertBatch = 1000
+
+// InsertBatch handles POST /insert/batch requests - queues the inserts of
+// an array of records at once. The batch is validated as a whole: when one
+// record is invalid, none is queued
+func (h *Handler) InsertBatch(w http.ResponseWriter, r *http.Request) {
+	var reqs []*models.InsertRequest
+	if err := decodeBody(r, &reqs); err != nil {
+		log.Printf("InsertBatch: invalid request: %v", err)
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+
+	if len(reqs) == 0 {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Batch cannot be empty")
+		return
+	}
+	if len(reqs) > maxInsertBatch {
+		h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Batch cannot hold more than %d records", maxInsertBatch))
+		return
+	}
+	for i, req := range reqs {
+		if req == nil || !h.validateInsertID(req.ID) {
+			h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Record %d: ID cannot be empty", i))
+			return
+		}
+		if problem := valueProblem(req.Value); problem != "" {
+			h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Record %d: %s", i, problem))
+			return
+		}
+	}
+
+	tasks, err := h.service.InsertBatch(r.Context(), reqs)
+	if err != nil {
+		if h.clientGone(w, r, "InsertBatch") {
+			return
+		}
+		log.Printf("InsertBatch: failed to insert %d records: %v", len(reqs), err)
+		if errors.Is(err, models.ErrUnknownRecordType) || errors.Is(err, models.ErrIDRequired) {
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, models.ErrSystemRecord) {
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		} else if errors.Is(err, models.ErrSchemaValidation) {
+			h.writeErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		} else if !h.writeReservationError(w, err) && !h.writeTaskIDError(w, r, "", err) {
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to insert records: "+err.Error())
+		}
+		return
+	}
+
+	tokens := make([]string, len(tasks))
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		tokens[i] = task.ID
+		ids[i] = reqs[i].ID
+	}
+
+	log.Printf("InsertBatch: queued %d insert tasks", len(tasks))
+	h.writeJSONResponse(w, http.StatusCreated, models.InsertBatchResponse{
+		Message:           "Insert tasks queued successfully",
+		Count:             len(tasks),
+		ConsistencyTokens: tokens,
+		IDs:               ids,
 	})
 }
 
+// Reserve handles POST /reserve requests - claims an unused record ID for a
+// lease, so that only inserts presenting the returned token can create it
+func (h *Handler) Reserve(w http.ResponseWriter, r *http.Request) {
+	var req models.ReserveRequest
+	if err := decodeBody(r, &req); err != nil {
+		log.Printf("Reserve: invalid request: %v", err)
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+
+	if !h.validateID(req.ID) {
+		h.writeErrorResponse(w, http.StatusBadRequest, "ID cannot be empty")
+		return
+	}
+
+	var lease time.Duration
+	if req.Lease != "" {
+		var err error
+		if lease, err = time.ParseDuration(req.Lease); err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid lease: "+req.Lease)
+			return
+		}
+	}
+
+	reservation, err := h.service.Reserve(r.Context(), req.ID, lease)
+	if err != nil {
+		if h.clientGone(w, r, "Reserve") {
+			return
+		}
+		log.Printf("Reserve: failed to reserve record %s: %v", req.ID, err)
+		if errors.Is(err, models.ErrInvalidReservation) {
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, models.ErrRecordExists) {
+			h.writeErrorResponse(w, http.StatusConflict, "Record already exists")
+		} else if errors.Is(err, models.ErrSystemRecord) {
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		} else if !h.writeReservationError(w, err) {
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to reserve record: "+err.Error())
+		}
+		return
+	}
+
+	log.Printf("Reserve: reserved record ID %s until %s", req.ID, reservation.ExpiresAt.Format(time.RFC3339))
+	h.writeJSONResponse(w, http.StatusCreated, reservation)
+}
+
+// writeReservationError answers the reservation errors of inserts and
+// reservations, reporting whether err was one
+func (h *Handler) writeReservationError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrRecordReserved):
+		h.writeErrorResponse(w, http.StatusConflict, err.Error())
+	case errors.Is(err, models.ErrReservationExpired):
+		h.writeErrorResponse(w, http.StatusGone, err.Error())
+	case errors.Is(err, models.ErrReservationsDisabled):
+		h.writeErrorResponse(w, http.StatusNotImplemented, "Reservations are not enabled")
+	default:
+		return false
+	}
+	return true
+}
+
+// writeTaskIDError answers the errors of writes queued under a task ID the
+// client supplied, reporting whether err was one. A reused ID gets a 409
+// with the task holding it, unless taskID is empty because a batch failed.
+// Task IDs are namespaced by keyspace, so the task is the caller's
+func (h *Handler) writeTaskIDError(w http.ResponseWriter, r *http.Request, taskID string, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrInvalidTaskID):
+		h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrTaskExists):
+		response := &models.TaskExistsResponse{Error: err.Error()}
+		if taskID != "" {
+			task, getErr := h.service.GetTask(r.Context(), taskID)
+			if getErr == nil && task.TenantID == service.TenantFromContext(r.Context()) {
+				response.Task = task
+			}
+		}
+		h.writeJSONResponse(w, http.StatusConflict, response)
+	default:
+		return false
+	}
+	return true
+}
+
 // Update handles POST /update requests
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if isProtobuf(r) {
+		h.updateProto(w, r)
 		return
 	}
+	h.update(w, r, "Update", h.service.Update)
+}
 
+// Patch handles PATCH /v2/records/{id} requests - queues the update of a
+// record to its value merged with the value of the /update body as a JSON
+// merge patch
+func (h *Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, "Patch", h.service.Patch)
+}
+
+// update queues the update of the request body with write, operation names
+// the handler in the logs
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, operation string,
+	write func(context.Context, *models.UpdateRequest) (*models.InboxTask, error)) {
 	var req models.UpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Update: invalid request: %v", err)
+	if err := decodeBody(r, &req); err != nil {
+		log.Printf("%s: invalid request: %v", operation, err)
 		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
 		return
 	}
+	idFromPath(r, &req.ID)
 
 	// Validate ID
 	if !h.validateID(req.ID) {
@@ -93,33 +367,53 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate Value
-	if len(req.Value) == 0 {
-		h.writeErrorResponse(w, http.StatusBadRequest, "Value cannot be empty")
+	if problem := valueProblem(req.Value); problem != "" {
+		h.writeErrorResponse(w, http.StatusBadRequest, problem)
 		return
 	}
 
 	ctx := r.Context()
-	if err := h.service.Update(ctx, &req); err != nil {
-		log.Printf("Update: failed to update record %s: %v", req.ID, err)
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to update record: "+err.Error())
+	task, err := write(ctx, &req)
+	if err != nil {
+		if h.clientGone(w, r, operation) {
+			return
+		}
+		log.Printf("%s: failed to update record %s: %v", operation, req.ID, err)
+		if errors.Is(err, models.ErrRecordNotFound) {
+			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		} else if errors.Is(err, models.ErrVersionConflict) {
+			h.writeErrorResponse(w, http.StatusConflict, "Record version conflict: expected version "+strconv.FormatInt(req.ExpectedVersion, 10))
+		} else if errors.Is(err, models.ErrInvalidPatch) {
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, models.ErrSystemRecord) {
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		} else if errors.Is(err, models.ErrSchemaValidation) {
+			h.writeErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		} else if !h.writeTaskIDError(w, r, req.TaskID, err) {
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to update record: "+err.Error())
+		}
 		return
 	}
 
 	// Success - no additional logging needed
-	h.writeJSONResponse(w, http.StatusOK, models.SuccessResponse{
-		Message: "Update task queued successfully",
-	})
+	h.writeQueued(w, http.StatusOK, "Update task queued successfully", "", task)
 }
 
 // Delete handles POST /delete requests
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
-		return
-	}
-
 	var req models.DeleteRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if r.Method == http.MethodDelete {
+		// Resource-style deletes have no body, the expected version is a
+		// query parameter
+		idFromPath(r, &req.ID)
+		if version := r.URL.Query().Get("expected_version"); version != "" {
+			var err error
+			if req.ExpectedVersion, err = strconv.ParseInt(version, 10, 64); err != nil || req.ExpectedVersion < 1 {
+				h.writeErrorResponse(w, http.StatusBadRequest, "expected_version must be a positive integer")
+				return
+			}
+		}
+	} else if err := decodeBody(r, &req); err != nil {
 		log.Printf("Delete: invalid request: %v", err)
 		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
 		return
@@ -132,90 +426,531 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := h.service.Delete(ctx, &req); err != nil {
+	task, err := h.service.Delete(ctx, &req)
+	if err != nil {
+		if h.clientGone(w, r, "Delete") {
+			return
+		}
 		log.Printf("Delete: failed to delete record %s: %v", req.ID, err)
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to delete record: "+err.Error())
+		if errors.Is(err, models.ErrRecordNotFound) {
+			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		} else if errors.Is(err, models.ErrVersionConflict) {
+			h.writeErrorResponse(w, http.StatusConflict, "Record version conflict: expected version "+strconv.FormatInt(req.ExpectedVersion, 10))
+		} else if errors.Is(err, models.ErrRecordReferenced) {
+			h.writeErrorResponse(w, http.StatusConflict, err.Error())
+		} else if errors.Is(err, models.ErrSystemRecord) {
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		} else if !h.writeTaskIDError(w, r, req.TaskID, err) {
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to delete record: "+err.Error())
+		}
 		return
 	}
 
 	// Success - no additional logging needed
-	h.writeJSONResponse(w, http.StatusOK, models.SuccessResponse{
-		Message: "Delete task queued successfully",
+	h.writeQueued(w, http.StatusOK, "Delete task queued successfully", "", task)
+}
+
+// EnqueueTask handles POST /tasks/enqueue requests for custom task operations
+func (h *Handler) EnqueueTask(w http.ResponseWriter, r *http.Request) {
+	var req models.EnqueueTaskRequest
+	if err := decodeBody(r, &req); err != nil {
+		log.Printf("EnqueueTask: invalid request: %v", err)
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
+		return
+	}
+
+	if strings.TrimSpace(req.Operation) == "" {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Operation cannot be empty")
+		return
+	}
+
+	ctx := r.Context()
+	task, err := h.service.EnqueueTask(ctx, &req)
+	if err != nil {
+		if h.clientGone(w, r, "EnqueueTask") {
+			return
+		}
+		log.Printf("EnqueueTask: failed to enqueue %s task: %v", req.Operation, err)
+		if errors.Is(err, models.ErrInvalidTaskOperation) {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Unknown operation: "+req.Operation)
+		} else if errors.Is(err, models.ErrSchemaValidation) {
+			h.writeErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		} else if !h.writeTaskIDError(w, r, req.TaskID, err) {
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to enqueue task: "+err.Error())
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusAccepted, models.EnqueueTaskResponse{
+		Message: req.Operation + " task queued successfully",
+		TaskID:  task.ID,
 	})
 }
 
-// Get handles GET /get requests
-func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+// SimulateTask handles POST /tasks/simulate requests - runs a task through
+// the worker pipeline without persisting it and reports the outcome. A task
+// that would fail is still a 200, its status and steps say why
+func (h *Handler) SimulateTask(w http.ResponseWriter, r *http.Request) {
+	var req models.SimulateTaskRequest
+	if err := decodeBody(r, &req); err != nil {
+		log.Printf("SimulateTask: invalid request: %v", err)
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
 		return
 	}
 
+	if strings.TrimSpace(req.Operation) == "" {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Operation cannot be empty")
+		return
+	}
+
+	simulation, err := h.service.SimulateTask(r.Context(), &req)
+	if err != nil {
+		if h.clientGone(w, r, "SimulateTask") {
+			return
+		}
+		if errors.Is(err, models.ErrSystemRecord) {
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+			return
+		}
+		log.Printf("SimulateTask: failed to simulate %s task: %v", req.Operation, err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to simulate task: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, simulation)
+}
+
+// Get handles GET /get requests
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	// Get ID from query parameters
 	id := r.URL.Query().Get("id")
+	idFromPath(r, &id)
 	if !h.validateID(id) {
 		h.writeErrorResponse(w, http.StatusBadRequest, "ID parameter is required")
 		return
 	}
 
 	ctx := r.Context()
+
+	// With a consistency token the read waits until that write is applied
+	token := r.URL.Query().Get("consistency_token")
+	if token == "" {
+		token = r.Header.Get(consistencyTokenHeader)
+	}
+	if token != "" {
+		if err := h.service.WaitForWrite(ctx, token); err != nil {
+			if h.clientGone(w, r, "Get") {
+				return
+			}
+			switch {
+			case errors.Is(err, models.ErrInvalidToken):
+				h.writeErrorResponse(w, http.StatusBadRequest, "Invalid consistency token")
+			case errors.Is(err, models.ErrConsistencyTimeout):
+				w.Header().Set("Retry-After", "1")
+				h.writeErrorResponse(w, http.StatusServiceUnavailable, "Write not applied yet, retry later")
+			case errors.Is(err, models.ErrWriteFailed):
+				h.writeErrorResponse(w, http.StatusConflict, "The write of this consistency token failed: "+err.Error())
+			default:
+				log.Printf("Get: failed to wait for write %s: %v", token, err)
+				h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to wait for write: "+err.Error())
+			}
+			return
+		}
+	}
+
 	record, err := h.service.Get(ctx, id)
 	if err != nil {
+		if h.clientGone(w, r, "Get") {
+			return
+		}
 		log.Printf("Get: failed to get record %s: %v", id, err)
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, models.ErrRecordNotFound) {
 			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		} else if errors.Is(err, models.ErrSystemRecord) {
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		} else if errors.Is(err, models.ErrQueryTimeout) {
+			h.writeErrorResponse(w, http.StatusGatewayTimeout, "Database query timed out")
 		} else {
 			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get record: "+err.Error())
 		}
 		return
 	}
 
+	// Protobuf values are returned encoded unless rendering is requested
+	if r.URL.Query().Get("render") == "json" {
+		if record, err = h.service.RenderRecord(ctx, record); err != nil {
+			log.Printf("Get: failed to render record %s: %v", id, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to render record: "+err.Error())
+			return
+		}
+	}
+
+	// Optionally report writes queued for the record, so the caller knows
+	// the value may be about to change
+	if r.URL.Query().Get("pending_changes") == "true" {
+		taskIDs, err := h.service.PendingChanges(ctx, id)
+		if err != nil {
+			if h.clientGone(w, r, "Get") {
+				return
+			}
+			log.Printf("Get: failed to get pending changes of record %s: %v", id, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get pending changes: "+err.Error())
+			return
+		}
+		h.writeNegotiatedResponse(w, r, http.StatusOK, models.RecordWithPendingChanges{
+			Record:         record,
+			PendingChanges: len(taskIDs) > 0,
+			PendingTaskIDs: taskIDs,
+		})
+		return
+	}
+
 	// Success - no additional logging needed
-	h.writeJSONResponse(w, http.StatusOK, record)
+	h.writeNegotiatedResponse(w, r, http.StatusOK, record)
 }
 
-// Health handles GET /health requests
-func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+// consistencyTokenHeader carries the consistency token of a queued write,
+// and can be sent on reads instead of the consistency_token parameter
+const consistencyTokenHeader = "X-Consistency-Token"
+
+// writeQueued responds to an accepted write with the consistency token of
+// its task
+func (h *Handler) writeQueued(w http.ResponseWriter, status int, message, id string, task *models.InboxTask) {
+	response := models.SuccessResponse{Message: message, ID: id}
+	if task != nil {
+		response.ConsistencyToken = task.ID
+		w.Header().Set(consistencyTokenHeader, task.ID)
+	}
+	h.writeJSONResponse(w, status, response)
+}
+
+// Diff handles GET /diff?id=<id>&from_version=<n>&to_version=<m> requests -
+// returns the changes of the record value between two versions
+func (h *Handler) Diff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id := query.Get("id")
+	if !h.validateID(id) {
+		h.writeErrorResponse(w, http.StatusBadRequest, "ID parameter is required")
+		return
+	}
+	fromVersion, err := strconv.Atoi(query.Get("from_version"))
+	if err != nil || fromVersion < 1 {
+		h.writeErrorResponse(w, http.StatusBadRequest, "from_version must be a positive integer")
+		return
+	}
+	toVersion, err := strconv.Atoi(query.Get("to_version"))
+	if err != nil || toVersion < 1 {
+		h.writeErrorResponse(w, http.StatusBadRequest, "to_version must be a positive integer")
 		return
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
-		"status":  "healthy",
-		"service": "mit-service",
-	})
+	diff, err := h.service.DiffRecord(r.Context(), id, fromVersion, toVersion)
+	if err != nil {
+		if h.clientGone(w, r, "Diff") {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrHistoryUnsupported):
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Record history is not enabled")
+		case errors.Is(err, models.ErrRecordNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		case errors.Is(err, models.ErrVersionNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, "Version not found")
+		case errors.Is(err, models.ErrSystemRecord):
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrQueryTimeout):
+			h.writeErrorResponse(w, http.StatusGatewayTimeout, "Database query timed out")
+		default:
+			log.Printf("Diff: failed to diff record %s: %v", id, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to diff record: "+err.Error())
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, diff)
 }
 
-// Tasks handles GET /tasks requests - shows current inbox tasks
-func (h *Handler) Tasks(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+// RecordHistory handles GET /records/{id}/history?limit=<n>&offset=<m>
+// requests - returns the writes of a record, oldest first
+func (h *Handler) RecordHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.validateID(id) {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid record ID")
 		return
 	}
+	limit, offset := parsePagination(r)
 
-	// Parse query parameters
-	status := r.URL.Query().Get("status")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
+	page, err := h.service.RecordHistory(r.Context(), id, limit, offset)
+	if err != nil {
+		if h.clientGone(w, r, "RecordHistory") {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrHistoryUnsupported):
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Record history is not enabled")
+		case errors.Is(err, models.ErrRecordNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		case errors.Is(err, models.ErrSystemRecord):
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrQueryTimeout):
+			h.writeErrorResponse(w, http.StatusGatewayTimeout, "Database query timed out")
+		default:
+			log.Printf("RecordHistory: failed to get history of record %s: %v", id, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get record history: "+err.Error())
+		}
+		return
+	}
 
-	limit := 50 // default
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
+	h.writeJSONResponse(w, http.StatusOK, page)
+}
+
+// RecordReferences handles GET /records/{id}/references requests - returns
+// the records a record references and the records referencing it
+func (h *Handler) RecordReferences(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.validateID(id) {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid record ID")
+		return
+	}
+
+	references, err := h.service.RecordReferences(r.Context(), id)
+	if err != nil {
+		if h.clientGone(w, r, "RecordReferences") {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		case errors.Is(err, models.ErrSystemRecord):
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrQueryTimeout):
+			h.writeErrorResponse(w, http.StatusGatewayTimeout, "Database query timed out")
+		default:
+			log.Printf("RecordReferences: failed to get references of record %s: %v", id, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get record references: "+err.Error())
 		}
+		return
 	}
 
-	offset := 0 // default
-	if offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
+	h.writeJSONResponse(w, http.StatusOK, references)
+}
+
+// Traverse handles GET /traverse?start=<id>&depth=<n> requests - returns the
+// records reachable from a record along its references, depth 1 by default
+func (h *Handler) Traverse(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	start := query.Get("start")
+	if !h.validateID(start) {
+		h.writeErrorResponse(w, http.StatusBadRequest, "start parameter is required")
+		return
+	}
+	depth := 1
+	if raw := query.Get("depth"); raw != "" {
+		var err error
+		if depth, err = strconv.Atoi(raw); err != nil || depth < 0 || depth > service.MaxTraversalDepth {
+			h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("depth must be an integer between 0 and %d", service.MaxTraversalDepth))
+			return
+		}
+	}
+
+	traversal, err := h.service.Traverse(r.Context(), start, depth)
+	if err != nil {
+		if h.clientGone(w, r, "Traverse") {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidTraversal):
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrRecordNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		case errors.Is(err, models.ErrSystemRecord):
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrQueryTimeout):
+			h.writeErrorResponse(w, http.StatusGatewayTimeout, "Database query timed out")
+		default:
+			log.Printf("Traverse: failed to traverse from record %s: %v", start, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to traverse references: "+err.Error())
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, traversal)
+}
+
+// RecordComposite handles GET /records/{id}/composite?depth=<n>&fields=<spec>
+// requests - returns a record with the records it references inlined, depth
+// 1 by default. fields selects the references to inline, each as field to
+// replace the ID or field:member to add the record next to it
+func (h *Handler) RecordComposite(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.validateID(id) {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid record ID")
+		return
+	}
+	query := r.URL.Query()
+	opts := service.CompositeOptions{Depth: 1}
+	if raw := query.Get("depth"); raw != "" {
+		var err error
+		if opts.Depth, err = strconv.Atoi(raw); err != nil || opts.Depth < 0 || opts.Depth > service.MaxTraversalDepth {
+			h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("depth must be an integer between 0 and %d", service.MaxTraversalDepth))
+			return
+		}
+	}
+	if query.Has("fields") {
+		var err error
+		if opts.Fields, err = service.ParseCompositeFields(query.Get("fields")); err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	doc, err := h.service.Composite(r.Context(), id, opts)
+	if err != nil {
+		if h.clientGone(w, r, "RecordComposite") {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidComposite):
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrRecordNotFound):
+			h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+		case errors.Is(err, models.ErrSystemRecord):
+			h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, models.ErrQueryTimeout):
+			h.writeErrorResponse(w, http.StatusGatewayTimeout, "Database query timed out")
+		default:
+			log.Printf("RecordComposite: failed to compose record %s: %v", id, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to compose record: "+err.Error())
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, doc)
+}
+
+// maxSearchBodySize bounds the query DSL body of a search
+const maxSearchBodySize = 1 << 20
+
+// Search handles GET and POST /search requests - runs a search against the
+// search index. URL parameters (q, size, from, sort, ...) and a query DSL
+// body are passed through and the response of the index is returned as is
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Method == http.MethodPost {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxSearchBodySize+1))
+		if err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Failed to read request body: "+err.Error())
+			return
+		}
+		if len(body) > maxSearchBodySize {
+			h.writeErrorResponse(w, http.StatusRequestEntityTooLarge, "Search body is too large")
+			return
+		}
+		if len(bytes.TrimSpace(body)) > 0 && !json.Valid(body) {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: search body must be JSON")
+			return
 		}
 	}
 
+	response, err := h.service.Search(r.Context(), r.URL.Query(), body)
+	if err != nil {
+		if h.clientGone(w, r, "Search") {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrSearchDisabled):
+			h.writeErrorResponse(w, http.StatusNotImplemented, "Search is not enabled")
+		case errors.Is(err, models.ErrInvalidSearch):
+			h.writeErrorResponse(w, http.StatusBadRequest, err.Error())
+		default:
+			log.Printf("Search: %v", err)
+			h.writeErrorResponse(w, http.StatusBadGateway, "Failed to search: "+err.Error())
+		}
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, response)
+}
+
+// Records handles GET /records requests - lists records, optionally filtered by type
+func (h *Handler) Records(w http.ResponseWriter, r *http.Request) {
+	recordType := r.URL.Query().Get("type")
+	limit, offset := parsePagination(r)
+
+	ctx := r.Context()
+	response, err := h.service.ListRecords(ctx, recordType, limit, offset)
+	if err != nil {
+		if h.clientGone(w, r, "Records") {
+			return
+		}
+		log.Printf("Records: failed to list records: %v", err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to list records: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, response)
+}
+
+// Health handles GET /health requests
+func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"status":  "healthy",
+		"service": "mit-service",
+	})
+}
+
+// Version handles GET /version requests
+func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, http.StatusOK, version.Get())
+}
+
+// Startup handles GET /startup requests, answering 503 until the instance
+// has finished starting up so orchestrators keep traffic away from it
+func (h *Handler) Startup(w http.ResponseWriter, r *http.Request) {
+	status := h.service.StartupStatus()
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	h.writeJSONResponse(w, code, status)
+}
+
+// Ready handles GET /ready requests, answering 503 while the inbox worker is
+// dead or wedged or the backlog exceeds its limit
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	status := h.service.Readiness(r.Context())
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	h.writeJSONResponse(w, code, status)
+}
+
+// SelfTest handles GET /selftest requests, running a synthetic write/read
+// cycle for deploy pipelines: 200 when every step passed, 503 otherwise.
+// With ?inbox=true the writes go through the inbox worker
+func (h *Handler) SelfTest(w http.ResponseWriter, r *http.Request) {
+	report := h.service.SelfTest(r.Context(), r.URL.Query().Get("inbox") == "true")
+	code := http.StatusOK
+	if !report.Passed {
+		code = http.StatusServiceUnavailable
+	}
+	h.writeJSONResponse(w, code, report)
+}
+
+// Tasks handles GET /tasks requests - shows current inbox tasks
+func (h *Handler) Tasks(w http.ResponseWriter, r *http.Request) {
+	// Parse query parameters
+	status := r.URL.Query().Get("status")
+	limit, offset := parsePagination(r)
+
 	ctx := r.Context()
 	response, err := h.service.GetTasks(ctx, status, limit, offset)
 	if err != nil {
+		if h.clientGone(w, r, "Tasks") {
+			return
+		}
 		log.Printf("Tasks: failed to get tasks: %v", err)
 		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get tasks: "+err.Error())
 		return
@@ -226,16 +961,74 @@ func (h *Handler) Tasks(w http.ResponseWriter, r *http.Request) {
 	h.writeJSONResponse(w, http.StatusOK, response)
 }
 
-// TaskStats handles GET /stats requests - shows inbox tasks statistics
-func (h *Handler) TaskStats(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+// Task handles GET /task and GET /v2/tasks/{id} requests - shows an inbox task with the
+// processing trace of its last attempt when the worker traces tasks
+func (h *Handler) Task(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	idFromPath(r, &id)
+	if id == "" {
+		h.writeErrorResponse(w, http.StatusBadRequest, "ID parameter is required")
+		return
+	}
+
+	task, err := h.service.GetTask(r.Context(), id)
+	if err != nil {
+		if h.clientGone(w, r, "Task") {
+			return
+		}
+		if errors.Is(err, models.ErrRecordNotFound) {
+			h.writeErrorResponse(w, http.StatusNotFound, "Task not found")
+			return
+		}
+		log.Printf("Task: failed to get task %s: %v", id, err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get task: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, task)
+}
+
+// maxTaskStatusIDs is the most task IDs a bulk status query may hold
+const maxTaskStatusIDs = 1000
+
+// TaskStatuses handles POST /tasks/status requests - shows the current
+// statuses of up to maxTaskStatusIDs tasks at once
+func (h *Handler) TaskStatuses(w http.ResponseWriter, r *http.Request) {
+	var req models.TaskStatusRequest
+	if err := decodeBody(r, &req); err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request format: "+err.Error())
 		return
 	}
+	if len(req.IDs) == 0 {
+		h.writeErrorResponse(w, http.StatusBadRequest, "IDs cannot be empty")
+		return
+	}
+	if len(req.IDs) > maxTaskStatusIDs {
+		h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Cannot query more than %d tasks", maxTaskStatusIDs))
+		return
+	}
+
+	response, err := h.service.GetTaskStatuses(r.Context(), req.IDs)
+	if err != nil {
+		if h.clientGone(w, r, "TaskStatuses") {
+			return
+		}
+		log.Printf("TaskStatuses: failed to get %d tasks: %v", len(req.IDs), err)
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get task statuses: "+err.Error())
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, response)
+}
 
+// TaskStats handles GET /stats requests - shows inbox tasks statistics
+func (h *Handler) TaskStats(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	stats, err := h.service.GetTaskStats(ctx)
 	if err != nil {
+		if h.clientGone(w, r, "TaskStats") {
+			return
+		}
 		log.Printf("TaskStats: failed to get task stats: %v", err)
 		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to get task stats: "+err.Error())
 		return
@@ -248,11 +1041,6 @@ func (h *Handler) TaskStats(w http.ResponseWriter, r *http.Request) {
 
 // Metrics handles GET /metrics requests - shows performance metrics
 func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
-		return
-	}
-
 	snapshot := h.metrics.GetSnapshot()
 
 	log.Printf("Metrics: RPS=%.2f, avg_response=%.2fms, queue_depth=%d, goroutines=%d",
@@ -263,17 +1051,22 @@ func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
 
 // Performance handles GET /performance requests - shows health status and recommendations
 func (h *Handler) Performance(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
-		return
-	}
-
 	snapshot := h.metrics.GetSnapshot()
 	health := snapshot.GetHealthStatus()
 
+	// Deviations from the rolling baselines, on top of the static thresholds
+	anomalies := h.metrics.Anomalies()
+	for _, a := range anomalies {
+		if health.Status == "healthy" {
+			health.Status = "warning"
+		}
+		health.Issues = append(health.Issues, "Anomaly: "+a.Signal+" "+a.Kind)
+	}
+
 	response := map[string]interface{}{
-		"health":  health,
-		"metrics": snapshot,
+		"health":    health,
+		"metrics":   snapshot,
+		"anomalies": anomalies,
 	}
 
 	log.Printf("Performance: status=%s, score=%d, issues=%d",
@@ -282,15 +1075,76 @@ func (h *Handler) Performance(w http.ResponseWriter, r *http.Request) {
 	h.writeJSONResponse(w, http.StatusOK, response)
 }
 
-// writeJSONResponse writes a JSON response with the given status code
+// parsePagination reads the limit (default 50) and offset (default 0) query
+// parameters, ignoring invalid values
+func parsePagination(r *http.Request) (limit, offset int) {
+	limitStr := r.URL.Query().Get("limit")
+	offsetStr := r.URL.Query().Get("offset")
+
+	limit = 50 // default
+	if limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	offset = 0 // default
+	if offsetStr != "" {
+		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	return limit, offset
+}
+
+// statusClientClosedRequest is the non-standard status (as used by nginx)
+// recorded when the client disconnects before a response is written
+const statusClientClosedRequest = 499
+
+// clientGone reports whether the client abandoned the request. The request
+// context is cancelled on disconnect, which aborts in-flight queries; the
+// request is then recorded as 499 instead of a server error
+func (h *Handler) clientGone(w http.ResponseWriter, r *http.Request, operation string) bool {
+	if !errors.Is(r.Context().Err(), context.Canceled) {
+		return false
+	}
+
+	log.Printf("%s: client disconnected, request cancelled", operation)
+	w.WriteHeader(statusClientClosedRequest)
+	return true
+}
+
+// maxPooledBufferBytes bounds the response buffers kept for reuse, so one
+// large response does not pin its buffer
+const maxPooledBufferBytes = 64 << 10
+
+// responseBuffers are reused to encode JSON responses
+var responseBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// writeJSONResponse writes a JSON response with the given status code. The
+// response is encoded into a pooled buffer first, so an encoding error can
+// still be answered with a 500
 func (h *Handler) writeJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	buf := responseBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBufferBytes {
+			buf.Reset()
+			responseBuffers.Put(buf)
+		}
+	}()
 
-	if err := json.NewEncoder(w).Encode(data); err != nil {
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
 		log.Printf("Error encoding JSON response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(buf.Bytes())
 }
 
 // writeErrorResponse writes an error response with the given status code and message
@@ -304,7 +1158,7 @@ func (h *Handler) writeErrorResponse(w http.ResponseWriter, statusCode int, mess
 func (h *Handler) enableCORS(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Client-Profile, X-Debug, X-Sandbox-Key, X-Tenant-ID")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 	if r.Method == "OPTIONS" {
@@ -324,6 +1178,14 @@ func (h *Handler) withCORS(next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
+// SLO handles GET /slo requests, reporting compliance and remaining error
+// budget of each SLO over its rolling windows
+func (h *Handler) SLO(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"slos": h.metrics.SLOReports(),
+	})
+}
+
 // PrometheusMetrics endpoint for Prometheus
 func (h *Handler) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
 	promhttp.Handler().ServeHTTP(w, r)
@@ -332,15 +1194,20 @@ func (h *Handler) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
 // Middleware wrapper for logging
 func (h *Handler) withLogging(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s %s", r.Method, r.URL.Path, r.RemoteAddr)
+		if !h.quietRequests {
+			log.Printf("%s %s %s", r.Method, r.URL.Path, r.RemoteAddr)
+		}
 		next(w, r)
 	})
 }
 
-// ResponseWriter wrapper to capture status code
+// ResponseWriter wrapper to capture status code and response size. It
+// passes flushing and hijacking through, so streaming responses and
+// connection upgrades keep working behind the middleware
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	size       int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -348,6 +1215,33 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher when the wrapped writer does
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, failing when the wrapped writer does not
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", rw.ResponseWriter)
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Middleware wrapper for metrics
 func (h *Handler) withMetrics(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -356,6 +1250,8 @@ func (h *Handler) withMetrics(next http.HandlerFunc) http.HandlerFunc {
 		// Increment active connections
 		h.metrics.IncrementActiveConnections()
 		defer h.metrics.DecrementActiveConnections()
+		h.metrics.IncrementInFlight(r.URL.Path)
+		defer h.metrics.DecrementInFlight(r.URL.Path)
 
 		// Wrap response writer to capture status code
 		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
@@ -365,6 +1261,9 @@ func (h *Handler) withMetrics(next http.HandlerFunc) http.HandlerFunc {
 
 		// Record metrics with detailed information for Prometheus
 		duration := time.Since(start)
-		h.metrics.RecordHTTPRequestWithDetails(r.Method, r.URL.Path, rw.statusCode, duration)
+		h.metrics.RecordHTTPRequestWithDetails(r.Method, r.URL.Path, rw.statusCode, rw.size, duration)
+		if tenant, err := h.requestTenant(r); err == nil && tenant != "" {
+			h.metrics.RecordTenantRequest(tenant, r.URL.Path, rw.statusCode, duration)
+		}
 	})
 }
@@ -0,0 +1,1030 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"mit-service/internal/binenc"
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/version"
+)
+
+func TestHandler_ErrorPaths(t *testing.T) {
+	errBackend := errors.New("connection refused")
+	wrap := func(err error) error { return fmt.Errorf("failed: %w", err) }
+	validValue := map[string]interface{}{"id": "a", "value": map[string]interface{}{"k": "v"}}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    interface{}
+		admin   bool
+		err     error
+		status  int
+		message string
+	}{
+		{"insert wrong method", http.MethodGet, "/insert", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"insert malformed body", http.MethodPost, "/insert", `{"id":`, false, nil, http.StatusBadRequest, "Invalid request format"},
+		{"insert empty id", http.MethodPost, "/insert", map[string]interface{}{"id": " ", "value": map[string]interface{}{"k": "v"}}, false, nil, http.StatusBadRequest, "ID cannot be empty"},
+		{"insert empty value", http.MethodPost, "/insert", map[string]interface{}{"id": "a"}, false, nil, http.StatusBadRequest, "Value cannot be empty"},
+		{"insert null value", http.MethodPost, "/insert", map[string]interface{}{"id": "a", "value": nil}, false, nil, http.StatusBadRequest, "Value cannot be empty"},
+		{"insert scalar value", http.MethodPost, "/insert", map[string]interface{}{"id": "a", "value": 5}, false, nil, http.StatusBadRequest, "Value must be a JSON object"},
+		{"insert unknown type", http.MethodPost, "/insert", validValue, false, wrap(models.ErrUnknownRecordType), http.StatusBadRequest, "Unknown record type"},
+		{"insert schema violation", http.MethodPost, "/insert", validValue, false, wrap(models.ErrSchemaValidation), http.StatusUnprocessableEntity, "schema validation"},
+		{"insert reserved", http.MethodPost, "/insert", validValue, false, wrap(models.ErrRecordReserved), http.StatusConflict, "reserved"},
+		{"insert reservation expired", http.MethodPost, "/insert", validValue, false, wrap(models.ErrReservationExpired), http.StatusGone, "reservation expired"},
+		{"insert task id reused", http.MethodPost, "/insert", validValue, false, wrap(models.ErrTaskExists), http.StatusConflict, "task ID is already used"},
+		{"insert invalid task id", http.MethodPost, "/insert", validValue, false, wrap(models.ErrInvalidTaskID), http.StatusBadRequest, "invalid task ID"},
+		{"insert backend failure", http.MethodPost, "/insert", validValue, false, errBackend, http.StatusInternalServerError, "Failed to insert record"},
+
+		{"reserve wrong method", http.MethodGet, "/reserve", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"reserve empty id", http.MethodPost, "/reserve", map[string]interface{}{"id": " "}, false, nil, http.StatusBadRequest, "ID cannot be empty"},
+		{"reserve invalid lease", http.MethodPost, "/reserve", map[string]interface{}{"id": "a", "lease": "soon"}, false, nil, http.StatusBadRequest, "Invalid lease"},
+		{"reserve lease too long", http.MethodPost, "/reserve", map[string]interface{}{"id": "a"}, false, wrap(models.ErrInvalidReservation), http.StatusBadRequest, "invalid reservation"},
+		{"reserve existing record", http.MethodPost, "/reserve", map[string]interface{}{"id": "a"}, false, wrap(models.ErrRecordExists), http.StatusConflict, "Record already exists"},
+		{"reserve reserved", http.MethodPost, "/reserve", map[string]interface{}{"id": "a"}, false, wrap(models.ErrRecordReserved), http.StatusConflict, "reserved"},
+		{"reserve disabled", http.MethodPost, "/reserve", map[string]interface{}{"id": "a"}, false, models.ErrReservationsDisabled, http.StatusNotImplemented, "Reservations are not enabled"},
+		{"reserve backend failure", http.MethodPost, "/reserve", map[string]interface{}{"id": "a"}, false, errBackend, http.StatusInternalServerError, "Failed to reserve record"},
+
+		{"batch wrong method", http.MethodGet, "/insert/batch", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"batch not an array", http.MethodPost, "/insert/batch", validValue, false, nil, http.StatusBadRequest, "Invalid request format"},
+		{"batch empty", http.MethodPost, "/insert/batch", `[]`, false, nil, http.StatusBadRequest, "Batch cannot be empty"},
+		{"batch empty id", http.MethodPost, "/insert/batch", []interface{}{validValue, map[string]interface{}{"value": map[string]interface{}{"k": "v"}}}, false, nil, http.StatusBadRequest, "Record 1: ID cannot be empty"},
+		{"batch empty value", http.MethodPost, "/insert/batch", []interface{}{map[string]interface{}{"id": "a"}}, false, nil, http.StatusBadRequest, "Record 0: Value cannot be empty"},
+		{"batch schema violation", http.MethodPost, "/insert/batch", []interface{}{validValue}, false, wrap(models.ErrSchemaValidation), http.StatusUnprocessableEntity, "schema validation"},
+		{"batch task id reused", http.MethodPost, "/insert/batch", []interface{}{validValue}, false, wrap(models.ErrTaskExists), http.StatusConflict, "task ID is already used"},
+		{"batch backend failure", http.MethodPost, "/insert/batch", []interface{}{validValue}, false, errBackend, http.StatusInternalServerError, "Failed to insert records"},
+
+		{"update wrong method", http.MethodGet, "/update", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"update malformed body", http.MethodPost, "/update", `[]`, false, nil, http.StatusBadRequest, "Invalid request format"},
+		{"update empty id", http.MethodPost, "/update", map[string]interface{}{"value": map[string]interface{}{"k": "v"}}, false, nil, http.StatusBadRequest, "ID cannot be empty"},
+		{"update empty value", http.MethodPost, "/update", map[string]interface{}{"id": "a"}, false, nil, http.StatusBadRequest, "Value cannot be empty"},
+		{"update missing record", http.MethodPost, "/update", validValue, false, wrap(models.ErrRecordNotFound), http.StatusNotFound, "Record not found"},
+		{"update schema violation", http.MethodPost, "/update", validValue, false, wrap(models.ErrSchemaValidation), http.StatusUnprocessableEntity, "schema validation"},
+		{"update version conflict", http.MethodPost, "/update", map[string]interface{}{"id": "a", "value": map[string]interface{}{"k": "v"}, "expected_version": 2}, false, wrap(models.ErrVersionConflict), http.StatusConflict, "expected version 2"},
+		{"update task id reused", http.MethodPost, "/update", validValue, false, wrap(models.ErrTaskExists), http.StatusConflict, "task ID is already used"},
+		{"update backend failure", http.MethodPost, "/update", validValue, false, errBackend, http.StatusInternalServerError, "Failed to update record"},
+
+		{"delete wrong method", http.MethodGet, "/delete", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"delete malformed body", http.MethodPost, "/delete", `nope`, false, nil, http.StatusBadRequest, "Invalid request format"},
+		{"delete empty id", http.MethodPost, "/delete", map[string]interface{}{"id": ""}, false, nil, http.StatusBadRequest, "ID cannot be empty"},
+		{"delete missing record", http.MethodPost, "/delete", map[string]interface{}{"id": "a"}, false, wrap(models.ErrRecordNotFound), http.StatusNotFound, "Record not found"},
+		{"delete version conflict", http.MethodPost, "/delete", map[string]interface{}{"id": "a", "expected_version": 3}, false, wrap(models.ErrVersionConflict), http.StatusConflict, "Record version conflict"},
+		{"delete invalid task id", http.MethodPost, "/delete", map[string]interface{}{"id": "a", "task_id": " t "}, false, wrap(models.ErrInvalidTaskID), http.StatusBadRequest, "invalid task ID"},
+		{"delete backend failure", http.MethodPost, "/delete", map[string]interface{}{"id": "a"}, false, errBackend, http.StatusInternalServerError, "Failed to delete record"},
+
+		{"get wrong method", http.MethodPost, "/get?id=a", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"get missing id", http.MethodGet, "/get", nil, false, nil, http.StatusBadRequest, "ID parameter is required"},
+		{"get missing record", http.MethodGet, "/get?id=a", nil, false, wrap(models.ErrRecordNotFound), http.StatusNotFound, "Record not found"},
+		{"get query timeout", http.MethodGet, "/get?id=a", nil, false, wrap(models.ErrQueryTimeout), http.StatusGatewayTimeout, "timed out"},
+		{"get consistency timeout", http.MethodGet, "/get?id=a&consistency_token=t", nil, false, wrap(models.ErrConsistencyTimeout), http.StatusServiceUnavailable, "not applied yet"},
+		{"get consistency write failed", http.MethodGet, "/get?id=a&consistency_token=t", nil, false, wrap(models.ErrWriteFailed), http.StatusConflict, "write of this consistency token failed"},
+		{"get invalid consistency token", http.MethodGet, "/get?id=a&consistency_token=t", nil, false, models.ErrInvalidToken, http.StatusBadRequest, "Invalid consistency token"},
+		{"get backend failure", http.MethodGet, "/get?id=a", nil, false, errBackend, http.StatusInternalServerError, "Failed to get record"},
+
+		{"diff wrong method", http.MethodPost, "/diff?id=a&from_version=1&to_version=2", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"diff missing id", http.MethodGet, "/diff?from_version=1&to_version=2", nil, false, nil, http.StatusBadRequest, "ID parameter is required"},
+		{"diff invalid version", http.MethodGet, "/diff?id=a&from_version=0&to_version=2", nil, false, nil, http.StatusBadRequest, "from_version"},
+		{"diff history disabled", http.MethodGet, "/diff?id=a&from_version=1&to_version=2", nil, false, models.ErrHistoryUnsupported, http.StatusNotImplemented, "history is not enabled"},
+		{"diff missing version", http.MethodGet, "/diff?id=a&from_version=1&to_version=9", nil, false, wrap(models.ErrVersionNotFound), http.StatusNotFound, "Version not found"},
+
+		{"history wrong method", http.MethodPost, "/records/a/history", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"history blank id", http.MethodGet, "/records/%20/history", nil, false, nil, http.StatusBadRequest, "Invalid record ID"},
+		{"history disabled", http.MethodGet, "/records/a/history", nil, false, models.ErrHistoryUnsupported, http.StatusNotImplemented, "history is not enabled"},
+		{"history missing record", http.MethodGet, "/records/a/history", nil, false, wrap(models.ErrRecordNotFound), http.StatusNotFound, "Record not found"},
+		{"history backend failure", http.MethodGet, "/records/a/history", nil, false, errBackend, http.StatusInternalServerError, "Failed to get record history"},
+
+		{"records wrong method", http.MethodPost, "/records", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"records backend failure", http.MethodGet, "/records", nil, false, errBackend, http.StatusInternalServerError, "Failed to list records"},
+		{"tasks wrong method", http.MethodPost, "/tasks", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"tasks backend failure", http.MethodGet, "/tasks", nil, false, errBackend, http.StatusInternalServerError, "Failed to get tasks"},
+		{"task wrong method", http.MethodPost, "/task?id=t_1", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"task missing id", http.MethodGet, "/task", nil, false, nil, http.StatusBadRequest, "ID parameter is required"},
+		{"task missing", http.MethodGet, "/task?id=t_1", nil, false, wrap(models.ErrRecordNotFound), http.StatusNotFound, "Task not found"},
+		{"task backend failure", http.MethodGet, "/task?id=t_1", nil, false, errBackend, http.StatusInternalServerError, "Failed to get task"},
+		{"stats wrong method", http.MethodPost, "/stats", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"stats backend failure", http.MethodGet, "/stats", nil, false, errBackend, http.StatusInternalServerError, "Failed to get task stats"},
+
+		{"enqueue without token", http.MethodPost, "/tasks/enqueue", map[string]interface{}{"operation": "reindex"}, false, nil, http.StatusUnauthorized, "Invalid admin token"},
+		{"enqueue wrong method", http.MethodGet, "/tasks/enqueue", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"enqueue malformed body", http.MethodPost, "/tasks/enqueue", `{`, true, nil, http.StatusBadRequest, "Invalid request format"},
+		{"enqueue empty operation", http.MethodPost, "/tasks/enqueue", map[string]interface{}{}, true, nil, http.StatusBadRequest, "Operation cannot be empty"},
+		{"enqueue unknown operation", http.MethodPost, "/tasks/enqueue", map[string]interface{}{"operation": "reindex"}, true, wrap(models.ErrInvalidTaskOperation), http.StatusBadRequest, "Unknown operation"},
+		{"enqueue invalid payload", http.MethodPost, "/tasks/enqueue", map[string]interface{}{"operation": "reindex"}, true, wrap(models.ErrSchemaValidation), http.StatusUnprocessableEntity, "schema validation"},
+		{"enqueue task id reused", http.MethodPost, "/tasks/enqueue", map[string]interface{}{"operation": "reindex", "task_id": "t"}, true, wrap(models.ErrTaskExists), http.StatusConflict, "task ID is already used"},
+		{"task statuses wrong method", http.MethodGet, "/tasks/status", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"task statuses no ids", http.MethodPost, "/tasks/status", map[string]interface{}{"ids": []string{}}, false, nil, http.StatusBadRequest, "IDs cannot be empty"},
+		{"task statuses too many ids", http.MethodPost, "/tasks/status", map[string]interface{}{"ids": make([]string, maxTaskStatusIDs+1)}, false, nil, http.StatusBadRequest, "Cannot query more than 1000 tasks"},
+		{"task statuses backend failure", http.MethodPost, "/tasks/status", map[string]interface{}{"ids": []string{"t"}}, false, errBackend, http.StatusInternalServerError, "Failed to get task statuses"},
+		{"enqueue backend failure", http.MethodPost, "/tasks/enqueue", map[string]interface{}{"operation": "reindex"}, true, errBackend, http.StatusInternalServerError, "Failed to enqueue task"},
+		{"simulate wrong method", http.MethodGet, "/tasks/simulate", nil, false, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"simulate malformed body", http.MethodPost, "/tasks/simulate", `{`, false, nil, http.StatusBadRequest, "Invalid request format"},
+		{"simulate empty operation", http.MethodPost, "/tasks/simulate", map[string]interface{}{}, false, nil, http.StatusBadRequest, "Operation cannot be empty"},
+		{"simulate system record", http.MethodPost, "/tasks/simulate", map[string]interface{}{"operation": "update"}, false, wrap(models.ErrSystemRecord), http.StatusForbidden, "system record"},
+		{"simulate backend failure", http.MethodPost, "/tasks/simulate", map[string]interface{}{"operation": "update"}, false, errBackend, http.StatusInternalServerError, "Failed to simulate task"},
+
+		{"admin without token", http.MethodGet, "/admin/tables", nil, false, nil, http.StatusUnauthorized, "Invalid admin token"},
+		{"admin tables failure", http.MethodGet, "/admin/tables", nil, true, errBackend, http.StatusInternalServerError, "Failed to get table stats"},
+		{"admin hot records disabled", http.MethodGet, "/admin/hot-records", nil, true, models.ErrAccessStatsDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin hot records invalid order", http.MethodGet, "/admin/hot-records?by=size", nil, true, nil, http.StatusBadRequest, "Invalid ordering"},
+		{"admin hot records invalid limit", http.MethodGet, "/admin/hot-records?limit=-1", nil, true, nil, http.StatusBadRequest, "Invalid limit"},
+		{"admin duplicates wrong method", http.MethodDelete, "/admin/duplicates", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"admin duplicates not run", http.MethodGet, "/admin/duplicates", nil, true, nil, http.StatusNotFound, "No duplicate scan"},
+		{"admin duplicates running", http.MethodPost, "/admin/duplicates", nil, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin integrity not run", http.MethodGet, "/admin/integrity", nil, true, nil, http.StatusNotFound, "No integrity check"},
+		{"admin integrity running", http.MethodPost, "/admin/integrity", nil, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin replication disabled", http.MethodGet, "/admin/replication", nil, true, models.ErrReplicationDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin backfill running", http.MethodPost, "/admin/replication/backfill", nil, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin shadow disabled", http.MethodGet, "/admin/shadow", nil, true, models.ErrShadowDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin shadow backfill disabled", http.MethodPost, "/admin/shadow/backfill", nil, true, models.ErrShadowDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin shadow backfill running", http.MethodPost, "/admin/shadow/backfill", nil, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin cutover not run", http.MethodGet, "/admin/shadow/cutover", nil, true, nil, http.StatusNotFound, "No cutover"},
+		{"admin cutover disabled", http.MethodPost, "/admin/shadow/cutover", map[string]interface{}{}, true, models.ErrShadowDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin cutover invalid", http.MethodPost, "/admin/shadow/cutover", map[string]interface{}{}, true, models.ErrInvalidCutover, http.StatusBadRequest, "invalid cutover request"},
+		{"admin cutover not ready", http.MethodPost, "/admin/shadow/cutover", map[string]interface{}{}, true, models.ErrCutoverNotReady, http.StatusConflict, "not ready"},
+		{"admin cutover running", http.MethodPost, "/admin/shadow/cutover", map[string]interface{}{}, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin explain wrong method", http.MethodPost, "/admin/explain", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"admin explain invalid", http.MethodGet, "/admin/explain?endpoint=/insert", nil, true, models.ErrInvalidExplain, http.StatusBadRequest, "invalid explain request"},
+		{"admin explain unsupported", http.MethodGet, "/admin/explain?endpoint=/get&id=a", nil, true, models.ErrExplainUnsupported, http.StatusNotImplemented, "not supported"},
+		{"admin explain failure", http.MethodGet, "/admin/explain?endpoint=/get&id=a", nil, true, errBackend, http.StatusInternalServerError, "Failed to explain queries"},
+		{"admin export invalid limit", http.MethodGet, "/admin/export?limit=0", nil, true, nil, http.StatusBadRequest, "Invalid limit"},
+		{"admin export failure", http.MethodGet, "/admin/export", nil, true, errBackend, http.StatusInternalServerError, "Failed to export records"},
+		{"admin import wrong method", http.MethodGet, "/admin/import", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"admin import malformed body", http.MethodPost, "/admin/import", `{`, true, nil, http.StatusBadRequest, "Invalid request format"},
+		{"admin clone not run", http.MethodGet, "/admin/clone", nil, true, nil, http.StatusNotFound, "No clone"},
+		{"admin clone invalid source", http.MethodPost, "/admin/clone", map[string]interface{}{"source_url": "ftp://example.com"}, true, nil, http.StatusBadRequest, "source_url"},
+		{"admin clone running", http.MethodPost, "/admin/clone", map[string]interface{}{"source_url": "http://example.com"}, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin reprocess not run", http.MethodGet, "/admin/reprocess", nil, true, nil, http.StatusNotFound, "No reprocessing"},
+		{"admin reprocess invalid", http.MethodPost, "/admin/reprocess", map[string]interface{}{}, true, models.ErrInvalidReprocess, http.StatusBadRequest, "invalid reprocess request"},
+		{"admin reprocess history", http.MethodPost, "/admin/reprocess", map[string]interface{}{"source": "history"}, true, models.ErrHistoryUnsupported, http.StatusNotImplemented, "history is not enabled"},
+		{"admin verify not run", http.MethodGet, "/admin/verify", nil, true, nil, http.StatusNotFound, "No verify run"},
+		{"admin verify invalid", http.MethodPost, "/admin/verify", map[string]interface{}{}, true, models.ErrInvalidVerify, http.StatusBadRequest, "invalid verify request"},
+		{"admin verify running", http.MethodPost, "/admin/verify", map[string]interface{}{}, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin reprocess running", http.MethodPost, "/admin/reprocess", map[string]interface{}{}, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"admin ingest disabled", http.MethodGet, "/admin/ingest", nil, true, models.ErrIngestDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin ingest unknown file", http.MethodGet, "/admin/ingest?key=a.ndjson", nil, true, nil, http.StatusNotFound, "File not found"},
+		{"admin ingest notify wrong method", http.MethodGet, "/admin/ingest/notify", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"admin ingest notify malformed body", http.MethodPost, "/admin/ingest/notify", `{`, true, nil, http.StatusBadRequest, "Invalid request format"},
+		{"admin ingest notify disabled", http.MethodPost, "/admin/ingest/notify", map[string]interface{}{}, true, models.ErrIngestDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin search index disabled", http.MethodGet, "/admin/search-index", nil, true, models.ErrSearchDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin reindex running", http.MethodPost, "/admin/search-index/reindex", nil, true, models.ErrScanRunning, http.StatusConflict, "already running"},
+		{"search disabled", http.MethodGet, "/search?q=ada", nil, true, models.ErrSearchDisabled, http.StatusNotImplemented, "not enabled"},
+		{"search malformed body", http.MethodPost, "/search", `{"query":`, true, nil, http.StatusBadRequest, "must be JSON"},
+		{"search rejected", http.MethodPost, "/search", map[string]interface{}{"query": map[string]interface{}{"bogus": nil}}, true, fmt.Errorf("%w: unknown query [bogus]", models.ErrInvalidSearch), http.StatusBadRequest, "unknown query [bogus]"},
+		{"admin analytics disabled", http.MethodGet, "/admin/analytics", nil, true, models.ErrAnalyticsDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin analytics trigger disabled", http.MethodPost, "/admin/analytics", nil, true, models.ErrAnalyticsDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin digest disabled", http.MethodGet, "/admin/digest", nil, true, models.ErrDigestDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin digest trigger disabled", http.MethodPost, "/admin/digest", nil, true, models.ErrDigestDisabled, http.StatusNotImplemented, "not enabled"},
+		{"admin digest backend error", http.MethodGet, "/admin/digest", nil, true, errBackend, http.StatusInternalServerError, "Failed to build digest"},
+		{"search unavailable", http.MethodGet, "/search", nil, true, errBackend, http.StatusBadGateway, "Failed to search"},
+		{"admin snapshots unsupported", http.MethodGet, "/admin/snapshots", nil, true, models.ErrSnapshotsUnsupported, http.StatusNotImplemented, "not enabled"},
+		{"admin snapshot invalid name", http.MethodPost, "/admin/snapshots/save?name=a/b", nil, true, models.ErrInvalidSnapshotName, http.StatusBadRequest, "Invalid snapshot name"},
+		{"admin snapshot not found", http.MethodPost, "/admin/snapshots/load?name=x", nil, true, wrap(fs.ErrNotExist), http.StatusNotFound, "Snapshot not found"},
+		{"admin snapshot failure", http.MethodPost, "/admin/snapshots/load?name=x", nil, true, errBackend, http.StatusInternalServerError, "Snapshot operation failed"},
+		{"admin retention wrong method", http.MethodDelete, "/admin/retention", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"admin schemas wrong method", http.MethodPost, "/admin/schemas", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"admin schema malformed body", http.MethodPut, "/admin/schemas?name=order", `{`, true, nil, http.StatusBadRequest, "Invalid schema JSON"},
+		{"admin schema invalid", http.MethodPut, "/admin/schemas?name=order", map[string]interface{}{}, true, wrap(models.ErrInvalidSchema), http.StatusBadRequest, "invalid schema"},
+		{"admin schema unknown", http.MethodGet, "/admin/schemas?name=order", nil, true, wrap(models.ErrUnknownRecordType), http.StatusNotFound, "Record type not found"},
+		{"admin schema in use", http.MethodDelete, "/admin/schemas?name=order", nil, true, wrap(models.ErrRecordExists), http.StatusConflict, "already exists"},
+		{"admin schema failure", http.MethodGet, "/admin/schemas", nil, true, errBackend, http.StatusInternalServerError, "Record type operation failed"},
+		{"admin proto types wrong method", http.MethodPost, "/admin/proto-types", nil, true, nil, http.StatusMethodNotAllowed, "Method not allowed"},
+		{"admin proto type malformed body", http.MethodPut, "/admin/proto-types?name=user", `{`, true, nil, http.StatusBadRequest, "Invalid proto type JSON"},
+		{"admin proto type invalid", http.MethodPut, "/admin/proto-types?name=user", map[string]interface{}{}, true, wrap(models.ErrInvalidSchema), http.StatusBadRequest, "invalid schema"},
+		{"admin proto type unknown", http.MethodGet, "/admin/proto-types?name=user", nil, true, wrap(models.ErrUnknownRecordType), http.StatusNotFound, "Record type not found"},
+		{"admin proto type in use", http.MethodDelete, "/admin/proto-types?name=user", nil, true, wrap(models.ErrRecordExists), http.StatusConflict, "already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := newTestMux(&fakeService{err: tt.err})
+
+			req := newRequest(t, tt.method, tt.target, tt.body)
+			if tt.admin {
+				req = newAdminRequest(t, tt.method, tt.target, tt.body)
+			}
+
+			rec := serve(mux, req)
+			assertStatus(t, rec, tt.status)
+			assertErrorContains(t, rec, tt.message)
+		})
+	}
+}
+
+func TestHandler_InsertBatch(t *testing.T) {
+	svc := &fakeService{}
+	mux := newTestMux(svc)
+
+	batch := []interface{}{
+		map[string]interface{}{"id": "a", "type": "user", "value": map[string]interface{}{"n": 1}},
+		map[string]interface{}{"id": "b", "value": map[string]interface{}{"n": 2}},
+	}
+	rec := serve(mux, newRequest(t, http.MethodPost, "/insert/batch", batch))
+	assertStatus(t, rec, http.StatusCreated)
+
+	var response models.InsertBatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Count != 2 || strings.Join(response.ConsistencyTokens, ",") != "task-0,task-1" {
+		t.Errorf("Expected a token per record in order, got %+v", response)
+	}
+	if len(svc.lastBatch) != 2 || svc.lastBatch[0].Type != "user" || svc.lastBatch[1].ID != "b" {
+		t.Errorf("Expected the batch passed to the service, got %+v", svc.lastBatch)
+	}
+
+	tooLarge := make([]interface{}, maxInsertBatch+1)
+	for i := range tooLarge {
+		tooLarge[i] = batch[0]
+	}
+	rec = serve(mux, newRequest(t, http.MethodPost, "/insert/batch", tooLarge))
+	assertStatus(t, rec, http.StatusBadRequest)
+	assertErrorContains(t, rec, "more than 1000 records")
+}
+
+func TestHandler_AdminIngestNotify(t *testing.T) {
+	svc := &fakeService{}
+	mux := newTestMux(svc)
+
+	// An S3 event notification, keys are URL-encoded
+	event := `{"Records": [{"eventName": "ObjectCreated:Put", "s3": {"object": {"key": "in/day+1%2B.ndjson"}}}]}`
+	rec := serve(mux, newAdminRequest(t, http.MethodPost, "/admin/ingest/notify", event))
+	assertStatus(t, rec, http.StatusAccepted)
+	if len(svc.lastNotify) != 1 || svc.lastNotify[0] != "in/day 1+.ndjson" {
+		t.Errorf("Expected the decoded key, got %v", svc.lastNotify)
+	}
+
+	rec = serve(mux, newAdminRequest(t, http.MethodPost, "/admin/ingest/notify", map[string]interface{}{"keys": []string{"in/a.ndjson"}}))
+	assertStatus(t, rec, http.StatusAccepted)
+	if len(svc.lastNotify) != 1 || svc.lastNotify[0] != "in/a.ndjson" {
+		t.Errorf("Expected the listed key, got %v", svc.lastNotify)
+	}
+}
+
+func TestHandler_Search(t *testing.T) {
+	svc := &fakeService{search: json.RawMessage(`{"hits":{"total":{"value":1},"hits":[{"_id":"a"}]}}`)}
+	mux := newTestMux(svc)
+
+	query := map[string]interface{}{"query": map[string]interface{}{"match": map[string]interface{}{"value.name": "ada"}}}
+	rec := serve(mux, newRequest(t, http.MethodPost, "/search?size=5", query))
+	assertStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(mux, newAdminRequest(t, http.MethodPost, "/search?size=5", query))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastSearch.Get("size") != "5" || !strings.Contains(string(svc.lastQuery), `"value.name":"ada"`) {
+		t.Errorf("Expected the parameters and body passed through, got %v %s", svc.lastSearch, svc.lastQuery)
+	}
+	if !strings.Contains(rec.Body.String(), `"_id":"a"`) {
+		t.Errorf("Expected the index response, got %s", rec.Body.String())
+	}
+}
+
+func TestHandler_ClientGone(t *testing.T) {
+	mux := newTestMux(&fakeService{err: context.Canceled})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/get?id=a", nil).WithContext(ctx))
+	assertStatus(t, rec, statusClientClosedRequest)
+}
+
+func TestHandler_GoldenResponses(t *testing.T) {
+	svc := &fakeService{
+		record: &models.Record{ID: "a", Type: "order", Value: models.MustEncodeValue(map[string]interface{}{"total": 10})},
+		records: &models.RecordsListResponse{
+			Records: []*models.Record{{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})}},
+			Limit:   50,
+		},
+		task:           &models.InboxTask{ID: "task-1", Operation: "reindex"},
+		stats:          &models.TaskStats{TotalTasks: 3, PendingTasks: 1, CompletedTasks: 2},
+		pendingTaskIDs: []string{"task-2"},
+		recordTypes: []*models.RecordType{
+			{Name: "order", Schema: map[string]interface{}{"type": "object"}},
+		},
+		export: &models.ExportPage{
+			Records:     []*models.Record{{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})}},
+			NextAfterID: "a",
+		},
+		imported: &models.ImportResult{Created: 1, Skipped: 1},
+	}
+	mux := newTestMux(svc)
+
+	tests := []struct {
+		name   string
+		req    func(t *testing.T) *http.Request
+		status int
+	}{
+		{"insert", func(t *testing.T) *http.Request {
+			return newRequest(t, http.MethodPost, "/insert", map[string]interface{}{"id": "a", "value": map[string]interface{}{"k": "v"}})
+		}, http.StatusCreated},
+		{"update", func(t *testing.T) *http.Request {
+			return newRequest(t, http.MethodPost, "/update", map[string]interface{}{"id": "a", "value": map[string]interface{}{"k": "v"}})
+		}, http.StatusOK},
+		{"delete", func(t *testing.T) *http.Request {
+			return newRequest(t, http.MethodPost, "/delete", map[string]interface{}{"id": "a"})
+		}, http.StatusOK},
+		{"get", func(t *testing.T) *http.Request {
+			return newRequest(t, http.MethodGet, "/get?id=a", nil)
+		}, http.StatusOK},
+		{"get_pending_changes", func(t *testing.T) *http.Request {
+			return newRequest(t, http.MethodGet, "/get?id=a&pending_changes=true", nil)
+		}, http.StatusOK},
+		{"records", func(t *testing.T) *http.Request {
+			return newRequest(t, http.MethodGet, "/records", nil)
+		}, http.StatusOK},
+		{"enqueue", func(t *testing.T) *http.Request {
+			return newAdminRequest(t, http.MethodPost, "/tasks/enqueue", map[string]interface{}{"operation": "reindex"})
+		}, http.StatusAccepted},
+		{"stats", func(t *testing.T) *http.Request {
+			return newRequest(t, http.MethodGet, "/stats", nil)
+		}, http.StatusOK},
+		{"admin_schemas", func(t *testing.T) *http.Request {
+			return newAdminRequest(t, http.MethodGet, "/admin/schemas", nil)
+		}, http.StatusOK},
+		{"admin_export", func(t *testing.T) *http.Request {
+			return newAdminRequest(t, http.MethodGet, "/admin/export?prefix=a&after_id=0&limit=1", nil)
+		}, http.StatusOK},
+		{"admin_import", func(t *testing.T) *http.Request {
+			return newAdminRequest(t, http.MethodPost, "/admin/import", map[string]interface{}{
+				"records": []map[string]interface{}{{"id": "a", "value": "v"}, {"id": "b", "value": "v"}},
+			})
+		}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(mux, tt.req(t))
+			assertStatus(t, rec, tt.status)
+			assertGolden(t, rec, tt.name)
+		})
+	}
+
+	if svc.lastInsert == nil || svc.lastInsert.ID != "a" {
+		t.Errorf("Expected insert request for record a, got %+v", svc.lastInsert)
+	}
+	if svc.lastExport.Prefix != "a" || svc.lastExport.AfterID != "0" || svc.lastExport.Limit != 1 {
+		t.Errorf("Expected export filter from the query, got %+v", svc.lastExport)
+	}
+	if svc.lastImport == nil || len(svc.lastImport.Records) != 2 {
+		t.Errorf("Expected import of 2 records, got %+v", svc.lastImport)
+	}
+}
+
+func TestHandler_Startup(t *testing.T) {
+	tests := []struct {
+		name   string
+		ready  bool
+		status int
+	}{
+		{"starting", false, http.StatusServiceUnavailable},
+		{"ready", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{startup: &models.StartupStatus{Ready: tt.ready}}
+			rec := serve(newTestMux(svc), newRequest(t, http.MethodGet, "/startup", nil))
+			assertStatus(t, rec, tt.status)
+		})
+	}
+}
+
+func TestHandler_Version(t *testing.T) {
+	rec := serve(newTestMux(&fakeService{}), newRequest(t, http.MethodGet, "/version", nil))
+	assertStatus(t, rec, http.StatusOK)
+
+	var info version.Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info != version.Get() {
+		t.Errorf("Expected %+v, got %+v", version.Get(), info)
+	}
+}
+
+func TestHandler_MethodMatching(t *testing.T) {
+	mux := newTestMux(&fakeService{})
+
+	rec := serve(mux, newAdminRequest(t, http.MethodDelete, "/search", nil))
+	assertStatus(t, rec, http.StatusMethodNotAllowed)
+	assertErrorContains(t, rec, "Method not allowed")
+	if allow := rec.Header().Get("Allow"); allow != "GET, POST" {
+		t.Errorf("Expected Allow GET, POST, got %q", allow)
+	}
+
+	// CORS preflight requests are answered for every public route
+	rec = serve(mux, newRequest(t, http.MethodOptions, "/insert", nil))
+	assertStatus(t, rec, http.StatusNoContent)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected CORS headers, got %v", rec.Header())
+	}
+}
+
+func TestHandler_Ready(t *testing.T) {
+	tests := []struct {
+		name   string
+		ready  bool
+		status int
+	}{
+		{"wedged", false, http.StatusServiceUnavailable},
+		{"ready", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeService{readiness: &models.ReadinessStatus{Ready: tt.ready}}
+			rec := serve(newTestMux(svc), newRequest(t, http.MethodGet, "/ready", nil))
+			assertStatus(t, rec, tt.status)
+		})
+	}
+}
+
+func TestHandler_SelfTest(t *testing.T) {
+	svc := &fakeService{selfTest: &models.SelfTestReport{Passed: false, Steps: []*models.SelfTestStep{{Name: "insert", Error: "boom"}}}}
+	mux := newTestMux(svc)
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/selftest", nil))
+	assertStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(mux, newAdminRequest(t, http.MethodGet, "/selftest", nil))
+	assertStatus(t, rec, http.StatusServiceUnavailable)
+
+	svc.selfTest = &models.SelfTestReport{Passed: true}
+	rec = serve(mux, newAdminRequest(t, http.MethodGet, "/selftest?inbox=true", nil))
+	assertStatus(t, rec, http.StatusOK)
+}
+
+func TestHandler_AdminSchemaCheck(t *testing.T) {
+	svc := &fakeService{schema: &models.SchemaReport{InSync: true, Drift: []*models.SchemaDrift{}}}
+	mux := newTestMux(svc)
+
+	rec := serve(mux, newAdminRequest(t, http.MethodGet, "/admin/schema-check", nil))
+	assertStatus(t, rec, http.StatusOK)
+
+	svc.schema = &models.SchemaReport{Drift: []*models.SchemaDrift{{Table: "records", Column: "version", Issue: "column is missing"}}}
+	rec = serve(mux, newAdminRequest(t, http.MethodGet, "/admin/schema-check", nil))
+	assertStatus(t, rec, http.StatusServiceUnavailable)
+	if !strings.Contains(rec.Body.String(), "column is missing") {
+		t.Errorf("Expected the drift in the response, got %s", rec.Body.String())
+	}
+
+	svc.err = models.ErrSchemaCheckUnsupported
+	rec = serve(mux, newAdminRequest(t, http.MethodGet, "/admin/schema-check", nil))
+	assertStatus(t, rec, http.StatusNotImplemented)
+}
+
+func TestHandler_GeneratedIDs(t *testing.T) {
+	body := map[string]interface{}{"value": map[string]interface{}{"name": "Ada"}}
+
+	svc := &fakeService{task: &models.InboxTask{ID: "task-1"}}
+	rec := serve(newTestMux(svc), newRequest(t, http.MethodPost, "/insert", body))
+	assertStatus(t, rec, http.StatusBadRequest)
+
+	mux := SetupRoutes(svc, metrics.NewMetrics(), WithGeneratedIDs())
+	rec = serve(mux, newRequest(t, http.MethodPost, "/insert", body))
+	assertStatus(t, rec, http.StatusCreated)
+	var response models.SuccessResponse
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if response.ID != "generated-1" {
+		t.Errorf("Expected the generated ID in the response, got %s", rec.Body.String())
+	}
+
+	// A blank ID is still invalid
+	rec = serve(mux, newRequest(t, http.MethodPost, "/insert", map[string]interface{}{"id": " ", "value": body["value"]}))
+	assertStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestParseSandboxKeys(t *testing.T) {
+	keys, err := ParseSandboxKeys(" acme = k1, demo=k2 ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys["k1"] != "acme" || keys["k2"] != "demo" {
+		t.Errorf("Expected two sandboxes by key, got %v", keys)
+	}
+
+	for _, spec := range []string{"acme", "acme=", "=k1", "a/b=k1", "acme=k1,demo=k1"} {
+		if _, err := ParseSandboxKeys(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestHandler_Sandbox(t *testing.T) {
+	svc := &fakeService{task: &models.InboxTask{ID: "task-1"}, tasks: &models.TasksListResponse{}}
+	mux := SetupRoutes(svc, metrics.NewMetrics(), WithSandboxKeys(map[string]string{"k1": "acme"}))
+	body := map[string]interface{}{"id": "user_1", "value": map[string]interface{}{"name": "Ada"}}
+	withKey := func(req *http.Request, key string) *http.Request {
+		req.Header.Set(sandboxKeyHeader, key)
+		return req
+	}
+
+	rec := serve(mux, withKey(newRequest(t, http.MethodPost, "/insert", body), "k1"))
+	assertStatus(t, rec, http.StatusCreated)
+	if svc.lastSandbox != "acme" {
+		t.Errorf("Expected the insert in sandbox acme, got %q", svc.lastSandbox)
+	}
+
+	rec = serve(mux, newRequest(t, http.MethodPost, "/insert", body))
+	assertStatus(t, rec, http.StatusCreated)
+	if svc.lastSandbox != "" {
+		t.Errorf("Expected the insert outside any sandbox, got %q", svc.lastSandbox)
+	}
+
+	rec = serve(mux, withKey(newRequest(t, http.MethodPost, "/insert", body), "nope"))
+	assertStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(mux, withKey(newRequest(t, http.MethodGet, "/tasks", nil), "k1"))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastSandbox != "acme" {
+		t.Errorf("Expected the tasks of sandbox acme, got %q", svc.lastSandbox)
+	}
+	rec = serve(mux, withKey(newRequest(t, http.MethodGet, "/stats", nil), "k1"))
+	assertStatus(t, rec, http.StatusForbidden)
+
+	req := withKey(newRequest(t, http.MethodPost, twirpPrefix+"GetTaskStats", "{}"), "k1")
+	req.Header.Set("Content-Type", "application/json")
+	rec = serve(mux, req)
+	assertStatus(t, rec, http.StatusForbidden)
+	assertRPCError(t, rec.Body.Bytes(), "msg", codePermissionDenied)
+}
+
+func TestParseTenantKeys(t *testing.T) {
+	keys, err := ParseTenantKeys("acme=k1, globex=k2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys["k1"] != "acme" || keys["k2"] != "globex" {
+		t.Errorf("Expected two tenants by key, got %v", keys)
+	}
+
+	for _, spec := range []string{"acme", "a/b=k1", ".acme=k1", "acme=k1,globex=k1"} {
+		if _, err := ParseTenantKeys(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestHandler_Tenants(t *testing.T) {
+	svc := &fakeService{task: &models.InboxTask{ID: "task-1"}, tasks: &models.TasksListResponse{}, stats: &models.TaskStats{}}
+	body := map[string]interface{}{"id": "user_1", "value": map[string]interface{}{"name": "Ada"}}
+	as := func(req *http.Request, key, tenant string) *http.Request {
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		if tenant != "" {
+			req.Header.Set(tenantHeader, tenant)
+		}
+		return req
+	}
+
+	// Without tenancy the header is ignored
+	rec := serve(newTestMux(svc), as(newRequest(t, http.MethodPost, "/insert", body), "", "acme"))
+	assertStatus(t, rec, http.StatusCreated)
+	if svc.lastTenant != "" {
+		t.Errorf("Expected no tenant without tenancy, got %q", svc.lastTenant)
+	}
+
+	mux := SetupRoutes(svc, metrics.NewMetrics(), WithTenantKeys(map[string]string{"k1": "acme"}), WithRequiredTenant())
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		key, tenant string
+		status      int
+		wantTenant  string
+	}{
+		{"tenant key", http.MethodPost, "/insert", "k1", "", http.StatusCreated, "acme"},
+		{"matching header", http.MethodPost, "/insert", "k1", "acme", http.StatusCreated, "acme"},
+		{"other tenant header", http.MethodPost, "/insert", "k1", "globex", http.StatusForbidden, ""},
+		{"unknown key", http.MethodPost, "/insert", "nope", "", http.StatusUnauthorized, ""},
+		{"untrusted header", http.MethodPost, "/insert", "", "acme", http.StatusUnauthorized, ""},
+		{"no tenant", http.MethodPost, "/insert", "", "", http.StatusUnauthorized, ""},
+		{"task route", http.MethodGet, "/tasks", "k1", "", http.StatusOK, "acme"},
+		{"task route without tenant", http.MethodGet, "/tasks", "", "", http.StatusUnauthorized, ""},
+		{"unscoped route", http.MethodGet, "/stats", "k1", "", http.StatusForbidden, ""},
+		{"unscoped route without tenant", http.MethodGet, "/stats", "", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc.lastTenant = ""
+			var reqBody interface{}
+			if tt.method == http.MethodPost {
+				reqBody = body
+			}
+			rec := serve(mux, as(newRequest(t, tt.method, tt.target, reqBody), tt.key, tt.tenant))
+			assertStatus(t, rec, tt.status)
+			if svc.lastTenant != tt.wantTenant {
+				t.Errorf("Expected tenant %q, got %q", tt.wantTenant, svc.lastTenant)
+			}
+		})
+	}
+
+	// Simulations read the record of the payload, so they run in the
+	// keyspace of the tenant
+	simulate := map[string]interface{}{"operation": "update", "payload": body}
+	rec = serve(mux, as(newRequest(t, http.MethodPost, "/tasks/simulate", simulate), "", ""))
+	assertStatus(t, rec, http.StatusUnauthorized)
+	svc.simulation = &models.TaskSimulation{}
+	rec = serve(mux, as(newRequest(t, http.MethodPost, "/tasks/simulate", simulate), "k1", ""))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastTenant != "acme" {
+		t.Errorf("Expected the simulation of tenant acme, got %q", svc.lastTenant)
+	}
+
+	mux = SetupRoutes(svc, metrics.NewMetrics(), WithTenantHeader())
+	rec = serve(mux, as(newRequest(t, http.MethodPost, "/insert", body), "", "globex"))
+	assertStatus(t, rec, http.StatusCreated)
+	if svc.lastTenant != "globex" {
+		t.Errorf("Expected the insert of tenant globex, got %q", svc.lastTenant)
+	}
+	rec = serve(mux, as(newRequest(t, http.MethodPost, "/insert", body), "", "a/b"))
+	assertStatus(t, rec, http.StatusBadRequest)
+
+	req := as(newRequest(t, http.MethodPost, twirpPrefix+"GetTaskStats", "{}"), "", "globex")
+	req.Header.Set("Content-Type", "application/json")
+	rec = serve(mux, req)
+	assertStatus(t, rec, http.StatusForbidden)
+	assertRPCError(t, rec.Body.Bytes(), "msg", codePermissionDenied)
+}
+
+func TestHandler_Collections(t *testing.T) {
+	svc := &fakeService{
+		task:        &models.InboxTask{ID: "task-1"},
+		record:      &models.Record{ID: "o_1"},
+		collections: &models.CollectionsListResponse{Collections: []*models.CollectionStats{{Name: "orders", Records: 2}}},
+	}
+	mux := newTestMux(svc)
+	value := map[string]interface{}{"total": 10}
+
+	rec := serve(mux, newRequest(t, http.MethodPost, "/collections/orders/records", map[string]interface{}{"id": "o_1", "value": value}))
+	assertStatus(t, rec, http.StatusCreated)
+	if svc.lastScope != "orders" || svc.lastInsert.ID != "o_1" {
+		t.Errorf("Expected o_1 inserted into orders, got %q in %q", svc.lastInsert.ID, svc.lastScope)
+	}
+
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections/orders/records/o_1", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastScope != "orders" {
+		t.Errorf("Expected the read in orders, got %q", svc.lastScope)
+	}
+
+	// The path ID wins over the body
+	rec = serve(mux, newRequest(t, http.MethodPut, "/collections/orders/records/o_1", map[string]interface{}{"id": "o_2", "value": value}))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastUpdate.ID != "o_1" {
+		t.Errorf("Expected the update of o_1, got %q", svc.lastUpdate.ID)
+	}
+
+	rec = serve(mux, newRequest(t, http.MethodDelete, "/collections/orders/records/o_1?expected_version=3", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastDelete.ID != "o_1" || svc.lastDelete.ExpectedVersion != 3 {
+		t.Errorf("Expected the delete of o_1 at version 3, got %+v", svc.lastDelete)
+	}
+	rec = serve(mux, newRequest(t, http.MethodDelete, "/collections/orders/records/o_1?expected_version=x", nil))
+	assertStatus(t, rec, http.StatusBadRequest)
+
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections", nil))
+	assertStatus(t, rec, http.StatusOK)
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections/orders", nil))
+	assertStatus(t, rec, http.StatusOK)
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections/users", nil))
+	assertStatus(t, rec, http.StatusNotFound)
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections/.hidden/records", nil))
+	assertStatus(t, rec, http.StatusBadRequest)
+	rec = serve(mux, newRequest(t, http.MethodPatch, "/collections/orders/records/o_1", nil))
+	assertStatus(t, rec, http.StatusMethodNotAllowed)
+}
+
+func TestHandler_V2Routes(t *testing.T) {
+	svc := &fakeService{
+		task:   &models.InboxTask{ID: "task-1", Status: models.TaskStatusPending},
+		record: &models.Record{ID: "user_1", Version: 2},
+	}
+	mux := newTestMux(svc)
+	value := map[string]interface{}{"name": nil}
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/v2/records/user_1", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"version":2`) {
+		t.Errorf("Expected the record, got %s", rec.Body.String())
+	}
+
+	rec = serve(mux, newRequest(t, http.MethodPut, "/v2/records/user_1", map[string]interface{}{"value": map[string]interface{}{"name": "Ada"}}))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastUpdate == nil || svc.lastUpdate.ID != "user_1" {
+		t.Errorf("Expected the update of user_1, got %+v", svc.lastUpdate)
+	}
+
+	rec = serve(mux, newRequest(t, http.MethodPatch, "/v2/records/user_1", map[string]interface{}{"value": value}))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastPatch == nil || svc.lastPatch.ID != "user_1" || string(svc.lastPatch.Value) != `{"name":null}` {
+		t.Errorf("Expected the patch of user_1 removing name, got %+v", svc.lastPatch)
+	}
+	svc.err = fmt.Errorf("failed: %w", models.ErrVersionConflict)
+	rec = serve(mux, newRequest(t, http.MethodPatch, "/v2/records/user_1", map[string]interface{}{"value": value, "expected_version": 3}))
+	assertStatus(t, rec, http.StatusConflict)
+	if !strings.Contains(rec.Body.String(), "expected version 3") {
+		t.Errorf("Expected a conflict of the patch, got %s", rec.Body.String())
+	}
+	svc.err = nil
+
+	rec = serve(mux, newRequest(t, http.MethodDelete, "/v2/records/user_1?expected_version=2", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastDelete.ID != "user_1" || svc.lastDelete.ExpectedVersion != 2 {
+		t.Errorf("Expected the delete of user_1 at version 2, got %+v", svc.lastDelete)
+	}
+
+	rec = serve(mux, newRequest(t, http.MethodGet, "/v2/tasks/task-1", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"id":"task-1"`) {
+		t.Errorf("Expected the task, got %s", rec.Body.String())
+	}
+
+	// The flat routes stay
+	assertStatus(t, serve(mux, newRequest(t, http.MethodGet, "/get?id=user_1", nil)), http.StatusOK)
+	assertStatus(t, serve(mux, newRequest(t, http.MethodPost, "/v2/records/user_1", nil)), http.StatusMethodNotAllowed)
+}
+
+func TestHandler_RecordReferences(t *testing.T) {
+	svc := &fakeService{references: &models.RecordReferences{
+		ID:           "c_1",
+		References:   []*models.RecordReference{},
+		ReferencedBy: []*models.RecordReference{{ID: "o_1", Type: "order", Field: "customer", OnDelete: "restrict"}},
+	}}
+	mux := newTestMux(svc)
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/records/c_1/references", nil))
+	assertStatus(t, rec, http.StatusOK)
+	var refs models.RecordReferences
+	if err := json.Unmarshal(rec.Body.Bytes(), &refs); err != nil || len(refs.ReferencedBy) != 1 || refs.ReferencedBy[0].ID != "o_1" {
+		t.Errorf("Expected c_1 referenced by o_1, got %s", rec.Body.String())
+	}
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections/shop/records/c_1/references", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastScope != "shop" {
+		t.Errorf("Expected the references read in shop, got %q", svc.lastScope)
+	}
+
+	svc.err = fmt.Errorf("%w by 'o_1' in field 'customer'", models.ErrRecordReferenced)
+	rec = serve(mux, newRequest(t, http.MethodPost, "/delete", map[string]interface{}{"id": "c_1"}))
+	assertStatus(t, rec, http.StatusConflict)
+	assertErrorContains(t, rec, "referenced by 'o_1'")
+
+	svc.err = models.ErrRecordNotFound
+	rec = serve(mux, newRequest(t, http.MethodGet, "/records/c_2/references", nil))
+	assertStatus(t, rec, http.StatusNotFound)
+}
+
+func TestHandler_Traverse(t *testing.T) {
+	svc := &fakeService{traversal: &models.Traversal{Start: "o_1", Records: []*models.Record{{ID: "o_1"}}, Edges: []models.ReferenceEdge{}}}
+	mux := newTestMux(svc)
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/traverse?start=o_1", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastDepth != 1 {
+		t.Errorf("Expected depth 1 by default, got %d", svc.lastDepth)
+	}
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections/shop/traverse?start=o_1&depth=3", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastScope != "shop" || svc.lastDepth != 3 {
+		t.Errorf("Expected a depth 3 traversal in shop, got %d in %q", svc.lastDepth, svc.lastScope)
+	}
+
+	for _, target := range []string{"/traverse", "/traverse?start=o_1&depth=-1", "/traverse?start=o_1&depth=11", "/traverse?start=o_1&depth=x"} {
+		rec = serve(mux, newRequest(t, http.MethodGet, target, nil))
+		assertStatus(t, rec, http.StatusBadRequest)
+	}
+
+	svc.err = models.ErrRecordNotFound
+	rec = serve(mux, newRequest(t, http.MethodGet, "/traverse?start=nope", nil))
+	assertStatus(t, rec, http.StatusNotFound)
+}
+
+func TestHandler_RecordComposite(t *testing.T) {
+	svc := &fakeService{composite: &models.CompositeDocument{ID: "o_1", Value: json.RawMessage(`{"customer":{"name":"Ada"}}`), Depth: 1}}
+	mux := newTestMux(svc)
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/records/o_1/composite", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastComposite.Depth != 1 || svc.lastComposite.Fields != nil {
+		t.Errorf("Expected every reference inlined 1 deep by default, got %+v", svc.lastComposite)
+	}
+	rec = serve(mux, newRequest(t, http.MethodGet, "/collections/shop/records/o_1/composite?depth=2&fields=customer:customer_doc,owner", nil))
+	assertStatus(t, rec, http.StatusOK)
+	fields := svc.lastComposite.Fields
+	if svc.lastScope != "shop" || svc.lastComposite.Depth != 2 || fields["customer"] != "customer_doc" || fields["owner"] != "owner" {
+		t.Errorf("Expected a depth 2 composite in shop with the fields mapped, got %+v in %q", svc.lastComposite, svc.lastScope)
+	}
+
+	for _, target := range []string{"/records/o_1/composite?depth=11", "/records/o_1/composite?depth=x", "/records/o_1/composite?fields=", "/records/o_1/composite?fields=:doc"} {
+		rec = serve(mux, newRequest(t, http.MethodGet, target, nil))
+		assertStatus(t, rec, http.StatusBadRequest)
+	}
+
+	svc.err = models.ErrRecordNotFound
+	rec = serve(mux, newRequest(t, http.MethodGet, "/records/nope/composite", nil))
+	assertStatus(t, rec, http.StatusNotFound)
+}
+
+func TestHandler_Changes(t *testing.T) {
+	svc := &fakeService{changes: make(chan *models.ChangeEvent, 1)}
+	server := httptest.NewServer(SetupRoutes(svc, metrics.NewMetrics(), WithRouteTimeouts(map[string]time.Duration{"*": 50 * time.Millisecond})))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?ids=a,%20b&prefix=a"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if len(svc.lastFilter.IDs) != 2 || svc.lastFilter.IDs[1] != "b" || svc.lastFilter.Prefix != "a" {
+		t.Errorf("Expected the ids and prefix parsed, got %+v", svc.lastFilter)
+	}
+
+	svc.changes <- &models.ChangeEvent{Operation: models.TaskOperationUpdate, ID: "a", TaskID: "task-1"}
+	var event models.ChangeEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if event.ID != "a" || event.Operation != models.TaskOperationUpdate {
+		t.Errorf("Expected the update of a, got %+v", event)
+	}
+
+	// The connection outlives the route timeout and is closed once the
+	// client falls behind
+	time.Sleep(100 * time.Millisecond)
+	close(svc.changes)
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected the connection closed with 1013, got %v", err)
+	}
+
+	svc.err = models.ErrTooManySubscribers
+	rec := serve(newTestMux(svc), newRequest(t, http.MethodGet, "/ws", nil))
+	assertStatus(t, rec, http.StatusServiceUnavailable)
+}
+
+func TestHandler_SystemRecords(t *testing.T) {
+	svc := &fakeService{task: &models.InboxTask{ID: "task-1"}, record: &models.Record{ID: "user_1"}}
+	mux := newTestMux(svc)
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/get?id=user_1", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if !svc.lastConfined {
+		t.Error("Expected the read confined to the records of the request")
+	}
+	rec = serve(mux, newAdminRequest(t, http.MethodGet, "/get?id=user_1", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if svc.lastConfined {
+		t.Error("Expected the admin read to reach system records")
+	}
+
+	svc.err = fmt.Errorf("%w: '_system/flags'", models.ErrSystemRecord)
+	rec = serve(mux, newRequest(t, http.MethodGet, "/get?id=_system/flags", nil))
+	assertStatus(t, rec, http.StatusForbidden)
+	rec = serve(mux, newRequest(t, http.MethodPost, "/insert", map[string]interface{}{"id": "_system/flags", "value": map[string]interface{}{"on": true}}))
+	assertStatus(t, rec, http.StatusForbidden)
+	assertErrorContains(t, rec, "reserved for system records")
+
+	req := newRequest(t, http.MethodPost, twirpPrefix+"Get", `{"id": "_system/flags"}`)
+	rec = serve(mux, req)
+	assertStatus(t, rec, http.StatusForbidden)
+	assertRPCError(t, rec.Body.Bytes(), "msg", codePermissionDenied)
+
+	// The admin token is no tenant key, admins pick the tenant
+	svc.err = nil
+	mux = SetupRoutes(svc, metrics.NewMetrics(), WithAdminToken(testAdminToken), WithTenantKeys(map[string]string{"k1": "acme"}), WithRequiredTenant())
+	req = newAdminRequest(t, http.MethodPost, "/insert", map[string]interface{}{"id": "user_1", "value": map[string]interface{}{"name": "Ada"}})
+	req.Header.Set(tenantHeader, "acme")
+	rec = serve(mux, req)
+	assertStatus(t, rec, http.StatusCreated)
+	if svc.lastTenant != "acme" {
+		t.Errorf("Expected the admin insert for acme, got %q", svc.lastTenant)
+	}
+	rec = serve(mux, newAdminRequest(t, http.MethodGet, "/get?id=_system/flags", nil))
+	assertStatus(t, rec, http.StatusOK)
+}
+
+func TestHandler_ProtoWrites(t *testing.T) {
+	wrap := func(err error) error { return fmt.Errorf("failed: %w", err) }
+	newProtoRequest := func(target string, body string) *http.Request {
+		req := newRequest(t, http.MethodPost, target, body)
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		return req
+	}
+
+	svc := &fakeService{task: &models.InboxTask{ID: "task-1"}}
+	mux := newTestMux(svc)
+
+	rec := serve(mux, newProtoRequest("/insert?id=user_1&type=user", "\x0a\x03Ada"))
+	assertStatus(t, rec, http.StatusCreated)
+	if svc.lastProto == nil || svc.lastProto.ID != "user_1" || svc.lastProto.Type != "user" || string(svc.lastProto.Data) != "\x0a\x03Ada" {
+		t.Errorf("Expected the message of user_1, got %+v", svc.lastProto)
+	}
+
+	rec = serve(mux, newProtoRequest("/update?id=user_1", "\x0a\x03Bob"))
+	assertStatus(t, rec, http.StatusOK)
+
+	tests := []struct {
+		name    string
+		target  string
+		body    string
+		err     error
+		status  int
+		message string
+	}{
+		{"missing id", "/insert?type=user", "\x0a\x03Ada", nil, http.StatusBadRequest, "ID cannot be empty"},
+		{"empty value", "/insert?id=user_1&type=user", "", nil, http.StatusBadRequest, "Value cannot be empty"},
+		{"unknown type", "/insert?id=user_1&type=user", "\x0a\x03Ada", wrap(models.ErrUnknownRecordType), http.StatusBadRequest, "Unknown proto type: user"},
+		{"invalid message", "/insert?id=user_1&type=user", "\xff", wrap(models.ErrInvalidProto), http.StatusUnprocessableEntity, "invalid protobuf value"},
+		{"update not found", "/update?id=user_1", "\x0a\x03Ada", wrap(models.ErrRecordNotFound), http.StatusNotFound, "Record not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(newTestMux(&fakeService{err: tt.err}), newProtoRequest(tt.target, tt.body))
+			assertStatus(t, rec, tt.status)
+			assertErrorContains(t, rec, tt.message)
+		})
+	}
+}
+
+func TestHandler_BinaryEncodings(t *testing.T) {
+	for _, format := range []binenc.Format{binenc.CBOR, binenc.MsgPack} {
+		t.Run(string(format), func(t *testing.T) {
+			svc := &fakeService{
+				task:   &models.InboxTask{ID: "task-1"},
+				record: &models.Record{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})},
+			}
+			mux := newTestMux(svc)
+
+			body, err := binenc.FromJSON(format, []byte(`{"id": "user_1", "value": {"name": "Ada", "age": 36}}`))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			req := newRequest(t, http.MethodPost, "/insert", string(body))
+			req.Header.Set("Content-Type", string(format))
+			assertStatus(t, serve(mux, req), http.StatusCreated)
+			if svc.lastInsert == nil || svc.lastInsert.ID != "user_1" || !strings.Contains(string(svc.lastInsert.Value), `"age":36`) {
+				t.Errorf("Expected the decoded insert, got %+v", svc.lastInsert)
+			}
+
+			req = newRequest(t, http.MethodPost, "/insert", "\xc1")
+			req.Header.Set("Content-Type", string(format))
+			assertStatus(t, serve(mux, req), http.StatusBadRequest)
+
+			req = newRequest(t, http.MethodGet, "/get?id=user_1", nil)
+			req.Header.Set("Accept", string(format)+", application/json;q=0.5")
+			rec := serve(mux, req)
+			assertStatus(t, rec, http.StatusOK)
+			if rec.Header().Get("Content-Type") != string(format) {
+				t.Errorf("Expected a %s response, got %s", format, rec.Header().Get("Content-Type"))
+			}
+			decoded, err := binenc.ToJSON(format, rec.Body.Bytes())
+			if err != nil || !strings.Contains(string(decoded), `"name":"Ada"`) {
+				t.Errorf("Expected the record, got %s, %v", decoded, err)
+			}
+
+			// Numbers without an exact binary form are not rewritten
+			svc.record = &models.Record{ID: "user_1", Value: json.RawMessage(`{"id": 123456789012345678901234567890}`)}
+			assertStatus(t, serve(mux, req), http.StatusNotAcceptable)
+		})
+	}
+}
+
+func TestHandler_GetRawValue(t *testing.T) {
+	svc := &fakeService{record: &models.Record{ID: "bill_1", Value: json.RawMessage(`{"total": 12345678901234567891, "zeta": 1, "alpha": 0.10}`)}}
+	rec := serve(newTestMux(svc), newRequest(t, http.MethodGet, "/get?id=bill_1", nil))
+	assertStatus(t, rec, http.StatusOK)
+
+	// Raw values are passed through unchanged apart from whitespace
+	expected := `{"id":"bill_1","value":{"total":12345678901234567891,"zeta":1,"alpha":0.10}}` + "\n"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, rec.Body.String())
+	}
+}
+
+func BenchmarkHandler_Get(b *testing.B) {
+	value := json.RawMessage(`{"name": "Ada Lovelace", "email": "ada@example.com", "age": 36, "tags": ["math", "engines"]}`)
+	mux := newTestMux(&fakeService{record: &models.Record{ID: "user_1", Value: value}})
+	req := httptest.NewRequest(http.MethodGet, "/get?id=user_1", nil)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serve(mux, req)
+	}
+}
@@ -0,0 +1,560 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+	"mit-service/internal/service"
+)
+
+// update rewrites the golden files: go test ./internal/handler -update
+var update = flag.Bool("update", false, "update golden files")
+
+// fakeService is a service.API returning canned values. A non-nil err is
+// returned by every method, the last request of each kind is kept
+type fakeService struct {
+	err error
+
+	record      *models.Record
+	records     *models.RecordsListResponse
+	diff        *models.RecordDiff
+	history     *models.RecordHistoryPage
+	references  *models.RecordReferences
+	traversal   *models.Traversal
+	composite   *models.CompositeDocument
+	simulation  *models.TaskSimulation
+	changes     chan *models.ChangeEvent
+	task        *models.InboxTask
+	tasks       *models.TasksListResponse
+	statuses    *models.TaskStatusResponse
+	stats       *models.TaskStats
+	recordType  *models.RecordType
+	recordTypes []*models.RecordType
+	protoType   *models.ProtoType
+	protoTypes  []*models.ProtoType
+	tableStats  []*models.TableStats
+	schema      *models.SchemaReport
+	explain     *models.ExplainReport
+	hotRecords  []*models.RecordAccessStats
+	retention   []*models.RetentionReport
+	duplicates  *models.DuplicateReport
+	integrity   *models.IntegrityReport
+	replication *models.ReplicationStatus
+	shadow      *models.ShadowStatus
+	backfill    *models.BackfillReport
+	cutover     *models.CutoverReport
+	export      *models.ExportPage
+	imported    *models.ImportResult
+	clone       *models.CloneReport
+	reprocess   *models.ReprocessReport
+	verify      *models.VerifyReport
+	ingestFiles []*models.IngestFile
+	searchIndex *models.SearchIndexStatus
+	reindex     *models.ReindexReport
+	search      json.RawMessage
+	analytics   *models.AnalyticsStatus
+	digest      *models.FailedTaskDigest
+	snapshot    *models.SnapshotInfo
+	snapshots   []*models.SnapshotInfo
+	startup     *models.StartupStatus
+	readiness   *models.ReadinessStatus
+	selfTest    *models.SelfTestReport
+	collections *models.CollectionsListResponse
+
+	lastInsert    *models.InsertRequest
+	lastSandbox   string
+	lastScope     string
+	lastConfined  bool
+	lastDepth     int
+	lastComposite service.CompositeOptions
+	lastSimulate  *models.SimulateTaskRequest
+	lastFilter    models.ChangeFilter
+	lastTenant    string
+	lastBatch     []*models.InsertRequest
+	lastUpdate    *models.UpdateRequest
+	lastPatch     *models.UpdateRequest
+	lastDelete    *models.DeleteRequest
+	lastProto     *models.ProtoWriteRequest
+	lastToken     string
+	lastExport    models.RecordFilter
+	lastImport    *models.ImportRequest
+	lastClone     *models.CloneRequest
+	lastReprocess *models.ReprocessRequest
+	lastNotify    []string
+	lastSearch    url.Values
+	lastQuery     []byte
+
+	// pendingTaskIDs are the pending changes of every record
+	pendingTaskIDs []string
+}
+
+var _ service.API = (*fakeService)(nil)
+
+func (f *fakeService) Insert(ctx context.Context, req *models.InsertRequest) (*models.InboxTask, error) {
+	f.lastInsert = req
+	f.lastSandbox = service.SandboxFromContext(ctx)
+	f.lastScope = service.CollectionFromContext(ctx)
+	f.lastTenant = service.TenantFromContext(ctx)
+	if req.ID == "" {
+		req.ID = "generated-1"
+	}
+	return f.task, f.err
+}
+
+func (f *fakeService) InsertBatch(ctx context.Context, reqs []*models.InsertRequest) ([]*models.InboxTask, error) {
+	f.lastBatch = reqs
+	if f.err != nil {
+		return nil, f.err
+	}
+	tasks := make([]*models.InboxTask, len(reqs))
+	for i := range reqs {
+		tasks[i] = &models.InboxTask{ID: fmt.Sprintf("task-%d", i)}
+	}
+	return tasks, nil
+}
+
+func (f *fakeService) Update(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error) {
+	f.lastUpdate = req
+	return f.task, f.err
+}
+
+func (f *fakeService) Patch(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error) {
+	f.lastPatch = req
+	return f.task, f.err
+}
+
+func (f *fakeService) Delete(ctx context.Context, req *models.DeleteRequest) (*models.InboxTask, error) {
+	f.lastDelete = req
+	return f.task, f.err
+}
+
+func (f *fakeService) PendingChanges(ctx context.Context, id string) ([]string, error) {
+	return f.pendingTaskIDs, f.err
+}
+
+func (f *fakeService) WaitForWrite(ctx context.Context, token string) error {
+	f.lastToken = token
+	return f.err
+}
+
+func (f *fakeService) Reserve(ctx context.Context, id string, lease time.Duration) (*models.Reservation, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Reservation{ID: id, Token: "token-1", ExpiresAt: time.Now().Add(lease)}, nil
+}
+
+func (f *fakeService) Get(ctx context.Context, id string) (*models.Record, error) {
+	f.lastScope = service.CollectionFromContext(ctx)
+	f.lastConfined = repository.CheckRecordID(ctx, repository.SystemRecordPrefix) != nil
+	return f.record, f.err
+}
+
+func (f *fakeService) ListRecords(ctx context.Context, recordType string, limit, offset int) (*models.RecordsListResponse, error) {
+	return f.records, f.err
+}
+
+func (f *fakeService) RecordHistory(ctx context.Context, id string, limit, offset int) (*models.RecordHistoryPage, error) {
+	return f.history, f.err
+}
+
+func (f *fakeService) RecordReferences(ctx context.Context, id string) (*models.RecordReferences, error) {
+	f.lastScope = service.CollectionFromContext(ctx)
+	return f.references, f.err
+}
+
+func (f *fakeService) Traverse(ctx context.Context, start string, depth int) (*models.Traversal, error) {
+	f.lastScope = service.CollectionFromContext(ctx)
+	f.lastDepth = depth
+	return f.traversal, f.err
+}
+
+func (f *fakeService) Composite(ctx context.Context, id string, opts service.CompositeOptions) (*models.CompositeDocument, error) {
+	f.lastScope = service.CollectionFromContext(ctx)
+	f.lastComposite = opts
+	return f.composite, f.err
+}
+
+func (f *fakeService) DiffRecord(ctx context.Context, id string, fromVersion, toVersion int) (*models.RecordDiff, error) {
+	return f.diff, f.err
+}
+
+func (f *fakeService) Search(ctx context.Context, params url.Values, body []byte) (json.RawMessage, error) {
+	f.lastSearch, f.lastQuery = params, body
+	return f.search, f.err
+}
+
+func (f *fakeService) SimulateTask(ctx context.Context, req *models.SimulateTaskRequest) (*models.TaskSimulation, error) {
+	f.lastSimulate = req
+	f.lastTenant = service.TenantFromContext(ctx)
+	return f.simulation, f.err
+}
+
+func (f *fakeService) SubscribeChanges(ctx context.Context, filter models.ChangeFilter) (<-chan *models.ChangeEvent, error) {
+	f.lastScope = service.CollectionFromContext(ctx)
+	f.lastFilter = filter
+	return f.changes, f.err
+}
+
+func (f *fakeService) EnqueueTask(ctx context.Context, req *models.EnqueueTaskRequest) (*models.InboxTask, error) {
+	return f.task, f.err
+}
+
+func (f *fakeService) GetTasks(ctx context.Context, status string, limit, offset int) (*models.TasksListResponse, error) {
+	f.lastSandbox = service.SandboxFromContext(ctx)
+	f.lastTenant = service.TenantFromContext(ctx)
+	return f.tasks, f.err
+}
+
+func (f *fakeService) GetTask(ctx context.Context, id string) (*models.InboxTask, error) {
+	return f.task, f.err
+}
+
+func (f *fakeService) GetTaskStatuses(ctx context.Context, ids []string) (*models.TaskStatusResponse, error) {
+	return f.statuses, f.err
+}
+
+func (f *fakeService) GetTaskStats(ctx context.Context) (*models.TaskStats, error) {
+	return f.stats, f.err
+}
+
+func (f *fakeService) PutRecordType(ctx context.Context, recordType *models.RecordType) error {
+	return f.err
+}
+
+func (f *fakeService) GetRecordType(ctx context.Context, name string) (*models.RecordType, error) {
+	return f.recordType, f.err
+}
+
+func (f *fakeService) ListRecordTypes(ctx context.Context) ([]*models.RecordType, error) {
+	return f.recordTypes, f.err
+}
+
+func (f *fakeService) DeleteRecordType(ctx context.Context, name string) error {
+	return f.err
+}
+
+func (f *fakeService) PutProtoType(ctx context.Context, protoType *models.ProtoType) error {
+	return f.err
+}
+
+func (f *fakeService) GetProtoType(ctx context.Context, name string) (*models.ProtoType, error) {
+	return f.protoType, f.err
+}
+
+func (f *fakeService) ListProtoTypes(ctx context.Context) ([]*models.ProtoType, error) {
+	return f.protoTypes, f.err
+}
+
+func (f *fakeService) DeleteProtoType(ctx context.Context, name string) error {
+	return f.err
+}
+
+func (f *fakeService) InsertProto(ctx context.Context, req *models.ProtoWriteRequest) (*models.InboxTask, error) {
+	f.lastProto = req
+	return f.task, f.err
+}
+
+func (f *fakeService) UpdateProto(ctx context.Context, req *models.ProtoWriteRequest) (*models.InboxTask, error) {
+	f.lastProto = req
+	return f.task, f.err
+}
+
+func (f *fakeService) RenderRecord(ctx context.Context, record *models.Record) (*models.Record, error) {
+	return record, f.err
+}
+
+func (f *fakeService) GetTableStats(ctx context.Context) ([]*models.TableStats, error) {
+	return f.tableStats, f.err
+}
+
+func (f *fakeService) CheckSchema(ctx context.Context) (*models.SchemaReport, error) {
+	return f.schema, f.err
+}
+
+func (f *fakeService) Explain(ctx context.Context, endpoint string, params url.Values) (*models.ExplainReport, error) {
+	return f.explain, f.err
+}
+
+func (f *fakeService) HottestRecords(ctx context.Context, limit int, orderBy string) ([]*models.RecordAccessStats, error) {
+	return f.hotRecords, f.err
+}
+
+func (f *fakeService) EvaluateRetention(ctx context.Context, dryRun bool) []*models.RetentionReport {
+	return f.retention
+}
+
+func (f *fakeService) StartDuplicateScan() (*models.DuplicateReport, error) {
+	return f.duplicates, f.err
+}
+
+func (f *fakeService) DuplicateReport() *models.DuplicateReport {
+	return f.duplicates
+}
+
+func (f *fakeService) StartIntegrityCheck() (*models.IntegrityReport, error) {
+	return f.integrity, f.err
+}
+
+func (f *fakeService) IntegrityReport() *models.IntegrityReport {
+	return f.integrity
+}
+
+func (f *fakeService) ReplicationStatus() (*models.ReplicationStatus, error) {
+	return f.replication, f.err
+}
+
+func (f *fakeService) ShadowStatus() (*models.ShadowStatus, error) {
+	return f.shadow, f.err
+}
+
+func (f *fakeService) StartShadowBackfill() (*models.BackfillReport, error) {
+	return f.backfill, f.err
+}
+
+func (f *fakeService) StartCutover(req *models.CutoverRequest) (*models.CutoverReport, error) {
+	return f.cutover, f.err
+}
+
+func (f *fakeService) CutoverReport() *models.CutoverReport {
+	return f.cutover
+}
+
+func (f *fakeService) StartReplicationBackfill() (*models.BackfillReport, error) {
+	return f.backfill, f.err
+}
+
+func (f *fakeService) ExportRecords(ctx context.Context, filter models.RecordFilter) (*models.ExportPage, error) {
+	f.lastExport = filter
+	return f.export, f.err
+}
+
+func (f *fakeService) ImportRecords(ctx context.Context, req *models.ImportRequest) (*models.ImportResult, error) {
+	f.lastImport = req
+	return f.imported, f.err
+}
+
+func (f *fakeService) StartClone(req *models.CloneRequest) (*models.CloneReport, error) {
+	f.lastClone = req
+	return f.clone, f.err
+}
+
+func (f *fakeService) CloneReport() *models.CloneReport {
+	return f.clone
+}
+
+func (f *fakeService) StartReprocess(req *models.ReprocessRequest) (*models.ReprocessReport, error) {
+	f.lastReprocess = req
+	return f.reprocess, f.err
+}
+
+func (f *fakeService) ReprocessReport() *models.ReprocessReport {
+	return f.reprocess
+}
+
+func (f *fakeService) StartVerify(req *models.VerifyRequest) (*models.VerifyReport, error) {
+	return f.verify, f.err
+}
+
+func (f *fakeService) VerifyReport() *models.VerifyReport {
+	return f.verify
+}
+
+func (f *fakeService) IngestFiles() ([]*models.IngestFile, error) {
+	return f.ingestFiles, f.err
+}
+
+func (f *fakeService) IngestFile(key string) (*models.IngestFile, error) {
+	for _, file := range f.ingestFiles {
+		if file.Key == key {
+			return file, f.err
+		}
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return nil, models.ErrIngestFileNotFound
+}
+
+func (f *fakeService) NotifyIngest(keys []string) error {
+	f.lastNotify = keys
+	return f.err
+}
+
+func (f *fakeService) SearchIndexStatus() (*models.SearchIndexStatus, error) {
+	return f.searchIndex, f.err
+}
+
+func (f *fakeService) StartSearchReindex() (*models.ReindexReport, error) {
+	return f.reindex, f.err
+}
+
+func (f *fakeService) AnalyticsStatus() (*models.AnalyticsStatus, error) {
+	return f.analytics, f.err
+}
+
+func (f *fakeService) TriggerAnalyticsExport() error {
+	return f.err
+}
+
+func (f *fakeService) PendingDigest(ctx context.Context) (*models.FailedTaskDigest, error) {
+	return f.digest, f.err
+}
+
+func (f *fakeService) TriggerDigest() error {
+	return f.err
+}
+
+func (f *fakeService) ListSnapshots(ctx context.Context) ([]*models.SnapshotInfo, error) {
+	return f.snapshots, f.err
+}
+
+func (f *fakeService) SaveSnapshot(ctx context.Context, name string) (*models.SnapshotInfo, error) {
+	return f.snapshot, f.err
+}
+
+func (f *fakeService) LoadSnapshot(ctx context.Context, name string) (*models.SnapshotInfo, error) {
+	return f.snapshot, f.err
+}
+
+func (f *fakeService) StartupStatus() *models.StartupStatus {
+	return f.startup
+}
+
+func (f *fakeService) Readiness(ctx context.Context) *models.ReadinessStatus {
+	return f.readiness
+}
+
+func (f *fakeService) SelfTest(ctx context.Context, viaInbox bool) *models.SelfTestReport {
+	return f.selfTest
+}
+
+func (f *fakeService) ListCollections(ctx context.Context) (*models.CollectionsListResponse, error) {
+	return f.collections, f.err
+}
+
+func (f *fakeService) GetCollection(ctx context.Context, name string) (*models.CollectionStats, error) {
+	if f.err != nil || f.collections == nil {
+		return nil, f.err
+	}
+	for _, stats := range f.collections.Collections {
+		if stats.Name == name {
+			return stats, nil
+		}
+	}
+	return nil, models.ErrCollectionNotFound
+}
+
+// testAdminToken is the admin token of handlers built by newTestMux
+const testAdminToken = "test-token"
+
+// newTestMux routes requests to a handler backed by svc
+func newTestMux(svc service.API) *http.ServeMux {
+	return SetupRoutes(svc, metrics.NewMetrics(), WithAdminToken(testAdminToken))
+}
+
+// newRequest builds a request; a string body is sent as is, anything else
+// is encoded as JSON
+func newRequest(t *testing.T, method, target string, body interface{}) *http.Request {
+	t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("Failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// newAdminRequest builds a request carrying the test admin token
+func newAdminRequest(t *testing.T, method, target string, body interface{}) *http.Request {
+	t.Helper()
+
+	req := newRequest(t, method, target, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+// serve runs req through mux and returns the recorded response
+func serve(mux http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// assertStatus fails the test when the response has a different status
+func assertStatus(t *testing.T, rec *httptest.ResponseRecorder, expected int) {
+	t.Helper()
+
+	if rec.Code != expected {
+		t.Errorf("Expected status %d, got %d: %s", expected, rec.Code, rec.Body.String())
+	}
+}
+
+// assertErrorContains fails the test unless the response is an error
+// response whose message contains substr
+func assertErrorContains(t *testing.T, rec *httptest.ResponseRecorder, substr string) {
+	t.Helper()
+
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Expected JSON error response, got %q: %v", rec.Body.String(), err)
+	}
+	if !strings.Contains(resp.Error, substr) {
+		t.Errorf("Expected error containing %q, got %q", substr, resp.Error)
+	}
+}
+
+// assertGolden compares the response body with testdata/<name>.golden,
+// both normalized as indented JSON
+func assertGolden(t *testing.T, rec *httptest.ResponseRecorder, name string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	if err := json.Indent(&body, rec.Body.Bytes(), "", "  "); err != nil {
+		t.Fatalf("Response is not JSON: %q", rec.Body.String())
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, body.Bytes(), 0o644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(body.Bytes()), bytes.TrimSpace(golden)) {
+		t.Errorf("Response differs from %s:\n got: %s\nwant: %s", path, body.String(), golden)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ParseConcurrencyLimits parses per-route concurrency limits, e.g.
+// "/records=4,/tasks=2,/v2/records/{id}=8". Routes with path parameters
+// are named as registered
+func ParseConcurrencyLimits(spec string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		path, value, ok := strings.Cut(entry, "=")
+		path = strings.TrimSpace(path)
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid concurrency limit %q, expected /<path>=<n>", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid concurrency limit %q, expected a positive number", entry)
+		}
+		limits[path] = n
+	}
+	return limits, nil
+}
+
+// WithConcurrencyLimits caps concurrent requests per route, rejecting requests
+// beyond the cap with 503 so expensive endpoints cannot stampede the database
+func WithConcurrencyLimits(limits map[string]int) Option {
+	return func(h *Handler) {
+		h.limiters = make(map[string]chan struct{}, len(limits))
+		for path, n := range limits {
+			h.limiters[path] = make(chan struct{}, n)
+		}
+	}
+}
+
+// withConcurrencyLimit holds a slot of the route's semaphore while the request
+// runs. Requests arriving while all slots are taken are rejected, not queued
+func (h *Handler) withConcurrencyLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		sem, ok := h.limiters[route]
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next(w, r)
+		default:
+			h.metrics.RecordConcurrencyRejection(route)
+			w.Header().Set("Retry-After", "1")
+			h.writeErrorResponse(w, http.StatusServiceUnavailable, "Too many concurrent requests for "+route)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+)
+
+func TestConcurrencyLimit_RejectsWhenSaturated(t *testing.T) {
+	limits, err := ParseConcurrencyLimits("/records=2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	svc := &fakeService{
+		record:  &models.Record{ID: "a"},
+		records: &models.RecordsListResponse{},
+	}
+	h := NewHandler(svc, metrics.NewMetrics(), WithConcurrencyLimits(limits))
+	records := h.withConcurrencyLimit(h.Records)
+	get := h.withConcurrencyLimit(h.Get)
+
+	// Occupy both slots as two slow requests would
+	h.limiters["/records"] <- struct{}{}
+	h.limiters["/records"] <- struct{}{}
+
+	rec := serve(records, newRequest(t, http.MethodGet, "/records", nil))
+	assertStatus(t, rec, http.StatusServiceUnavailable)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on rejected request")
+	}
+
+	// Routes without a limit are unaffected
+	assertStatus(t, serve(get, newRequest(t, http.MethodGet, "/get?id=a", nil)), http.StatusOK)
+
+	// A freed slot admits the next request and is released afterwards
+	<-h.limiters["/records"]
+	assertStatus(t, serve(records, newRequest(t, http.MethodGet, "/records", nil)), http.StatusOK)
+	if n := len(h.limiters["/records"]); n != 1 {
+		t.Errorf("Expected 1 occupied slot, got %d", n)
+	}
+}
+
+func TestParseConcurrencyLimits_Invalid(t *testing.T) {
+	for _, spec := range []string{"records=2", "/records", "/records=0", "/records=many"} {
+		if _, err := ParseConcurrencyLimits(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestConcurrencyLimit_RouteWithPathParameters(t *testing.T) {
+	limits, err := ParseConcurrencyLimits("/v2/records/{id}=1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	h := NewHandler(&fakeService{record: &models.Record{ID: "a"}}, metrics.NewMetrics(), WithConcurrencyLimits(limits))
+	get := withRoute("/v2/records/{id}", h.withConcurrencyLimit(h.Get))
+
+	// Requests for any ID share the slots of the route
+	h.limiters["/v2/records/{id}"] <- struct{}{}
+	rec := serve(get, newRequest(t, http.MethodGet, "/v2/records/a", nil))
+	assertStatus(t, rec, http.StatusServiceUnavailable)
+	assertErrorContains(t, rec, "/v2/records/{id}")
+}
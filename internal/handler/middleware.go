@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Middleware wraps a handler with a cross-cutting concern
+type Middleware func(next http.HandlerFunc) http.HandlerFunc
+
+// Stage positions middleware in a chain. Lower stages are outer: they see
+// the request first and the response last. Middleware of the same stage
+// run in the order they were added
+type Stage int
+
+// Stages of the built-in middleware. They are spaced out so middleware can
+// be placed between them
+const (
+	// StageCORS answers preflight requests before they are counted
+	StageCORS Stage = 100
+	// StageMetrics measures everything below it, rejections included
+	StageMetrics Stage = 200
+	// StageShedding rejects low-priority requests under overload before
+	// they take a time budget or concurrency slot
+	StageShedding Stage = 300
+	// StageTimeout bounds the time the request spends below it
+	StageTimeout Stage = 400
+	// StageConcurrency caps the concurrent requests per route
+	StageConcurrency Stage = 500
+	// StageLogging logs the requests that were admitted
+	StageLogging Stage = 600
+	// StageAuth checks credentials, after logging so rejected requests
+	// are logged
+	StageAuth Stage = 700
+	// StageScope confines record accesses to the keyspace the auth
+	// middleware settled on
+	StageScope Stage = 750
+	// StageShaping reshapes responses of the handler below it
+	StageShaping Stage = 800
+	// StageDebug traces the handler itself
+	StageDebug Stage = 900
+)
+
+// Chain is an ordered set of middleware. It is immutable: Use returns a new
+// chain, so chains can be derived from a shared base
+type Chain struct {
+	entries []chainEntry
+}
+
+// chainEntry is a middleware with its stage
+type chainEntry struct {
+	stage      Stage
+	middleware Middleware
+}
+
+// Use returns the chain with m added at stage
+func (c Chain) Use(stage Stage, m Middleware) Chain {
+	entries := make([]chainEntry, len(c.entries), len(c.entries)+1)
+	copy(entries, c.entries)
+	entries = append(entries, chainEntry{stage: stage, middleware: m})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].stage < entries[j].stage
+	})
+	return Chain{entries: entries}
+}
+
+// Then wraps handler in the middleware of the chain
+func (c Chain) Then(handler http.HandlerFunc) http.HandlerFunc {
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		handler = c.entries[i].middleware(handler)
+	}
+	return handler
+}
+
+// WithMiddleware adds m at stage to the chains of every route, public and
+// admin, for features cutting across all of them
+func WithMiddleware(stage Stage, m Middleware) Option {
+	return func(h *Handler) {
+		h.middleware = h.middleware.Use(stage, m)
+	}
+}
+
+// publicChain returns the middleware of the public routes. Load shedding,
+// timeouts and concurrency limits are no-ops unless enabled
+func (h *Handler) publicChain() Chain {
+	return h.withShared(Chain{}.
+		Use(StageCORS, h.withCORS).
+		Use(StageMetrics, h.withMetrics).
+		Use(StageShedding, h.withShedding).
+		Use(StageTimeout, h.withTimeout).
+		Use(StageConcurrency, h.withConcurrencyLimit).
+		Use(StageLogging, h.withLogging))
+}
+
+// adminChain returns the middleware of the admin routes, which require the
+// admin token
+func (h *Handler) adminChain() Chain {
+	return h.withShared(Chain{}.
+		Use(StageMetrics, h.withMetrics).
+		Use(StageLogging, h.withLogging).
+		Use(StageAuth, h.withAdmin))
+}
+
+// withShared adds the middleware added with WithMiddleware to chain
+func (h *Handler) withShared(chain Chain) Chain {
+	for _, entry := range h.middleware.entries {
+		chain = chain.Use(entry.stage, entry.middleware)
+	}
+	return chain
+}
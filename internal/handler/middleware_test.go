@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mit-service/internal/metrics"
+)
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next(w, r)
+			}
+		}
+	}
+
+	// Stages order the chain regardless of the order middleware is added
+	base := Chain{}.Use(StageLogging, mark("logging")).Use(StageCORS, mark("cors"))
+	chain := base.Use(StageLogging, mark("logging 2")).Use(StageMetrics, mark("metrics"))
+
+	handler := chain.Then(func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") })
+	handler(nil, newRequest(t, http.MethodGet, "/", nil))
+
+	expected := []string{"cors", "metrics", "logging", "logging 2", "handler"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected %v, got %v", expected, order)
+	}
+
+	// Deriving a chain leaves its base unchanged
+	order = nil
+	base.Then(func(w http.ResponseWriter, r *http.Request) {})(nil, newRequest(t, http.MethodGet, "/", nil))
+	if !reflect.DeepEqual(order, []string{"cors", "logging"}) {
+		t.Errorf("Expected the base chain unchanged, got %v", order)
+	}
+}
+
+func TestWithMiddleware(t *testing.T) {
+	var seen []string
+	tracing := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.URL.Path)
+			next(w, r)
+		}
+	}
+	mux := SetupRoutes(&fakeService{}, metrics.NewMetrics(), WithAdminToken(testAdminToken), WithMiddleware(StageAuth+1, tracing))
+
+	assertStatus(t, serve(mux, newRequest(t, http.MethodGet, "/health", nil)), http.StatusOK)
+	assertStatus(t, serve(mux, newAdminRequest(t, http.MethodGet, "/admin/tables", nil)), http.StatusOK)
+
+	// Below the admin check, unauthorized requests do not get through
+	assertStatus(t, serve(mux, newRequest(t, http.MethodGet, "/admin/tables", nil)), http.StatusUnauthorized)
+
+	if strings.Join(seen, ",") != "/health,/admin/tables" {
+		t.Errorf("Expected the middleware on public and admin routes, got %v", seen)
+	}
+}
+
+func TestWithMetrics_WriterInterfaces(t *testing.T) {
+	h := NewHandler(&fakeService{}, metrics.NewMetrics())
+	handler := h.withMetrics(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: 1\n\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Expected the writer to flush, got %v", err)
+		}
+		// The recorder cannot be hijacked, which the wrapper reports
+		if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			t.Error("Expected an error hijacking a recorder")
+		}
+		if rw, ok := w.(*responseWriter); !ok || rw.size != 9 {
+			t.Errorf("Expected 9 bytes counted, got %+v", w)
+		}
+	})
+
+	rec := serve(handler, newRequest(t, http.MethodGet, "/events", nil))
+	if !rec.Flushed {
+		t.Error("Expected the response flushed")
+	}
+}
@@ -0,0 +1,471 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/version"
+)
+
+// apiRoute is a route registered by SetupRoutes, documented by
+// /openapi.json
+type apiRoute struct {
+	path    string
+	methods []string
+	admin   bool
+}
+
+// apiOperation documents a method of a route. Request and Response are
+// values of the types of the JSON bodies, the schemas of the document are
+// generated from them
+type apiOperation struct {
+	Summary  string
+	Query    []apiParam
+	Request  interface{} // nil without body
+	Status   int         // of success, 200 when zero
+	Response interface{} // nil without documented body
+}
+
+// apiParam documents a query parameter, Type is a JSON Schema type
+type apiParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+var (
+	paginationParams = []apiParam{
+		{"limit", "integer", "Page size, default 50"},
+		{"offset", "integer", "Items to skip"},
+	}
+	compositeParams = []apiParam{
+		{"depth", "integer", "Reference levels to inline, default 1"},
+		{"fields", "string", "Reference fields to inline, e.g. author,comments.author"},
+	}
+	traverseParams = []apiParam{
+		{"start", "string", "ID of the record to start from"},
+		{"depth", "integer", "Reference levels to follow"},
+	}
+	schemaNameParam = []apiParam{{"name", "string", "Type name, lists all types when omitted on GET"}}
+	snapshotParam   = []apiParam{{"name", "string", "Snapshot name"}}
+)
+
+// retentionResponse is the response of /admin/retention
+type retentionResponse struct {
+	Rules []*models.RetentionReport `json:"rules"`
+}
+
+// apiOperations documents the routes by "METHOD path". Every route
+// registered by SetupRoutes must be listed
+var apiOperations = map[string]apiOperation{
+	// Probes and service info
+	"GET /health": {Summary: "Liveness probe", Response: struct {
+		Status  string `json:"status"`
+		Service string `json:"service"`
+	}{}},
+	"GET /startup": {Summary: "Startup probe, 503 until the instance has started", Response: models.StartupStatus{}},
+	"GET /ready":   {Summary: "Readiness probe, 503 while the worker is wedged or the backlog too old", Response: models.ReadinessStatus{}},
+	"GET /version": {Summary: "Build information", Response: version.Info{}},
+	"GET /performance": {Summary: "Metrics snapshot, anomalies and health score", Response: struct {
+		Health    *metrics.HealthStatus    `json:"health"`
+		Metrics   *metrics.MetricsSnapshot `json:"metrics"`
+		Anomalies []metrics.Anomaly        `json:"anomalies"`
+	}{}},
+	"GET /slo": {Summary: "Compliance and error budget of the SLOs", Response: struct {
+		SLOs []metrics.SLOReport `json:"slos"`
+	}{}},
+	"GET /openapi.json": {Summary: "This OpenAPI document"},
+	"GET /docs":         {Summary: "Swagger UI of this document"},
+
+	// Inbox tasks
+	"GET /tasks": {Summary: "List inbox tasks", Response: models.TasksListResponse{},
+		Query: append([]apiParam{{"status", "string", "Only tasks of this status"}}, paginationParams...)},
+	"GET /task": {Summary: "Get an inbox task with its result and processing trace", Response: models.InboxTask{},
+		Query: []apiParam{{"id", "string", "Task ID, the consistency token of a write"}}},
+	"POST /tasks/enqueue":  {Summary: "Queue a task of a custom operation", Request: models.EnqueueTaskRequest{}, Status: http.StatusAccepted, Response: models.EnqueueTaskResponse{}},
+	"POST /tasks/simulate": {Summary: "Run a task through the worker pipeline without persisting it", Request: models.SimulateTaskRequest{}, Response: models.TaskSimulation{}},
+	"POST /tasks/status":   {Summary: "Current statuses of up to 1000 tasks", Request: models.TaskStatusRequest{}, Response: models.TaskStatusResponse{}},
+	"GET /stats":           {Summary: "Inbox task statistics", Response: models.TaskStats{}},
+
+	// Records
+	"POST /insert":       {Summary: "Queue the insert of a record", Request: models.InsertRequest{}, Status: http.StatusCreated, Response: models.SuccessResponse{}},
+	"POST /insert/batch": {Summary: "Queue the inserts of up to 1000 records", Request: []*models.InsertRequest{}, Status: http.StatusCreated, Response: models.InsertBatchResponse{}},
+	"POST /reserve":      {Summary: "Reserve an unused record ID", Request: models.ReserveRequest{}, Status: http.StatusCreated, Response: models.Reservation{}},
+	"POST /update":       {Summary: "Queue the update of a record", Request: models.UpdateRequest{}, Response: models.SuccessResponse{}},
+	"POST /delete":       {Summary: "Queue the delete of a record", Request: models.DeleteRequest{}, Response: models.SuccessResponse{}},
+	"GET /get": {Summary: "Get a record", Response: models.Record{}, Query: []apiParam{
+		{"id", "string", "Record ID"},
+		{"consistency_token", "string", "Wait until the write of this token is applied"},
+		{"pending_changes", "boolean", "Also report the writes to the record still queued"},
+		{"render", "string", "json renders protobuf values as JSON"},
+	}},
+	"GET /records": {Summary: "List records", Response: models.RecordsListResponse{},
+		Query: append([]apiParam{{"type", "string", "Only records of this type"}}, paginationParams...)},
+	"GET /diff": {Summary: "Changes of a record value between two versions", Response: models.RecordDiff{}, Query: []apiParam{
+		{"id", "string", "Record ID"},
+		{"from_version", "integer", "Version to diff from"},
+		{"to_version", "integer", "Version to diff to"},
+	}},
+	"GET /records/{id}/history":    {Summary: "Versions of a record", Query: paginationParams, Response: models.RecordHistoryPage{}},
+	"GET /records/{id}/references": {Summary: "References from and to a record", Response: models.RecordReferences{}},
+	"GET /records/{id}/composite":  {Summary: "A record with its references inlined", Query: compositeParams, Response: models.CompositeDocument{}},
+	"GET /traverse":                {Summary: "Records reachable from a record by references", Query: traverseParams, Response: models.Traversal{}},
+	"GET /ws": {Summary: "WebSocket streaming the record changes applied, as ChangeEvent messages", Status: http.StatusSwitchingProtocols, Response: models.ChangeEvent{},
+		Query: []apiParam{{"ids", "string", "Comma-separated record IDs"}, {"prefix", "string", "Record ID prefix"}}},
+	"GET /search":  {Summary: "Search the search index, parameters are passed through", Response: json.RawMessage{}},
+	"POST /search": {Summary: "Search the search index with a query DSL body", Request: json.RawMessage{}, Response: json.RawMessage{}},
+
+	// Collections
+	"GET /collections":                                {Summary: "List collections", Response: models.CollectionsListResponse{}},
+	"GET /collections/{name}":                         {Summary: "Get the stats of a collection", Response: models.CollectionStats{}},
+	"GET /collections/{name}/records":                 {Summary: "List the records of a collection", Query: paginationParams, Response: models.RecordsListResponse{}},
+	"POST /collections/{name}/records":                {Summary: "Queue the insert of a record into a collection", Request: models.InsertRequest{}, Status: http.StatusCreated, Response: models.SuccessResponse{}},
+	"GET /collections/{name}/records/{id}":            {Summary: "Get a record of a collection", Response: models.Record{}},
+	"PUT /collections/{name}/records/{id}":            {Summary: "Queue the update of a record of a collection", Request: models.UpdateRequest{}, Response: models.SuccessResponse{}},
+	"DELETE /collections/{name}/records/{id}":         {Summary: "Queue the delete of a record of a collection", Query: []apiParam{{"expected_version", "integer", "Version the record was read with"}}, Response: models.SuccessResponse{}},
+	"GET /collections/{name}/records/{id}/history":    {Summary: "Versions of a record of a collection", Query: paginationParams, Response: models.RecordHistoryPage{}},
+	"GET /collections/{name}/records/{id}/references": {Summary: "References from and to a record of a collection", Response: models.RecordReferences{}},
+	"GET /collections/{name}/records/{id}/composite":  {Summary: "A record of a collection with its references inlined", Query: compositeParams, Response: models.CompositeDocument{}},
+	"GET /collections/{name}/traverse":                {Summary: "Records of a collection reachable from a record", Query: traverseParams, Response: models.Traversal{}},
+
+	// v2 resource routes
+	"GET /v2/records/{id}":    {Summary: "Get a record", Response: models.Record{}},
+	"PUT /v2/records/{id}":    {Summary: "Queue the update of a record", Request: models.UpdateRequest{}, Response: models.SuccessResponse{}},
+	"PATCH /v2/records/{id}":  {Summary: "Queue the update of a record to its value merged with value as a JSON merge patch", Request: models.UpdateRequest{}, Response: models.SuccessResponse{}},
+	"DELETE /v2/records/{id}": {Summary: "Queue the delete of a record", Query: []apiParam{{"expected_version", "integer", "Version the record was read with"}}, Response: models.SuccessResponse{}},
+	"GET /v2/tasks/{id}":      {Summary: "Get an inbox task with its result and processing trace", Response: models.InboxTask{}},
+
+	// Administration
+	"GET /selftest": {Summary: "Smoke test of a write/read cycle, 503 when a step failed", Response: models.SelfTestReport{},
+		Query: []apiParam{{"inbox", "boolean", "Queue the writes through the inbox worker"}}},
+	"GET /admin/tables": {Summary: "Table statistics", Response: struct {
+		Tables []*models.TableStats `json:"tables"`
+	}{}},
+	"GET /admin/explain": {Summary: "Query plan of the query of an endpoint, other parameters are the endpoint's", Response: models.ExplainReport{},
+		Query: []apiParam{{"endpoint", "string", "Endpoint to explain, e.g. /records"}}},
+	"GET /admin/schema-check": {Summary: "Check the database schema against the expected one", Response: models.SchemaReport{}},
+	"GET /admin/snapshots": {Summary: "List the saved snapshots", Response: struct {
+		Snapshots []*models.SnapshotInfo `json:"snapshots"`
+	}{}},
+	"POST /admin/snapshots/save":       {Summary: "Save a snapshot of the records", Query: snapshotParam, Response: models.SnapshotInfo{}},
+	"POST /admin/snapshots/load":       {Summary: "Replace the records with a snapshot", Query: snapshotParam, Response: models.SnapshotInfo{}},
+	"GET /admin/schemas":               {Summary: "Get a record type, or list them", Query: schemaNameParam, Response: models.RecordType{}},
+	"PUT /admin/schemas":               {Summary: "Register the JSON Schema in the body as a record type", Query: schemaNameParam, Request: map[string]interface{}{}, Response: models.RecordType{}},
+	"DELETE /admin/schemas":            {Summary: "Delete an unused record type", Query: schemaNameParam, Response: models.SuccessResponse{}},
+	"GET /admin/proto-types":           {Summary: "Get a proto type, or list them", Query: schemaNameParam, Response: models.ProtoType{}},
+	"PUT /admin/proto-types":           {Summary: "Register a proto type", Query: schemaNameParam, Request: models.ProtoType{}, Response: models.ProtoType{}},
+	"DELETE /admin/proto-types":        {Summary: "Delete an unused proto type", Query: schemaNameParam, Response: models.SuccessResponse{}},
+	"GET /admin/retention":             {Summary: "What the retention rules would delete", Response: retentionResponse{}},
+	"POST /admin/retention":            {Summary: "Apply the retention rules", Response: retentionResponse{}},
+	"GET /admin/duplicates":            {Summary: "Report of the last duplicate scan", Response: models.DuplicateReport{}},
+	"POST /admin/duplicates":           {Summary: "Start a duplicate scan", Status: http.StatusAccepted, Response: models.DuplicateReport{}},
+	"GET /admin/integrity":             {Summary: "Report of the last integrity check", Response: models.IntegrityReport{}},
+	"POST /admin/integrity":            {Summary: "Start an integrity check", Status: http.StatusAccepted, Response: models.IntegrityReport{}},
+	"GET /admin/replication":           {Summary: "Replication status", Response: models.ReplicationStatus{}},
+	"POST /admin/replication/backfill": {Summary: "Start a replication backfill", Status: http.StatusAccepted, Response: models.BackfillReport{}},
+	"GET /admin/shadow":                {Summary: "Shadow write status", Response: models.ShadowStatus{}},
+	"POST /admin/shadow/backfill":      {Summary: "Start a backfill of the shadow backend", Status: http.StatusAccepted, Response: models.BackfillReport{}},
+	"GET /admin/shadow/cutover":        {Summary: "Report of the last cutover", Response: models.CutoverReport{}},
+	"POST /admin/shadow/cutover":       {Summary: "Start a cutover to the shadow backend", Request: models.CutoverRequest{}, Status: http.StatusAccepted, Response: models.CutoverReport{}},
+	"GET /admin/export": {Summary: "Export a page of records", Response: models.ExportPage{}, Query: []apiParam{
+		{"prefix", "string", "Only IDs with this prefix"},
+		{"exclude_prefix", "string", "No IDs with this prefix"},
+		{"after_id", "string", "Resume after this ID"},
+		{"limit", "integer", "Page size"},
+	}},
+	"POST /admin/import": {Summary: "Import records", Request: models.ImportRequest{}, Response: models.ImportResult{}},
+	"GET /admin/clone":   {Summary: "Report of the last clone", Response: models.CloneReport{}},
+	"POST /admin/clone":  {Summary: "Start cloning another instance", Request: models.CloneRequest{}, Status: http.StatusAccepted, Response: models.CloneReport{}},
+	"GET /admin/ingest":  {Summary: "Ingestion status of the files, or of one", Query: []apiParam{{"key", "string", "Object key of a file"}}, Response: models.IngestFile{}},
+	"POST /admin/ingest/notify": {Summary: "List the watched prefix now, e.g. on an S3 event notification", Request: models.IngestNotification{}, Status: http.StatusAccepted, Response: struct {
+		Keys []string `json:"keys"`
+	}{}},
+	"GET /admin/search-index":          {Summary: "Search index status", Response: models.SearchIndexStatus{}},
+	"POST /admin/search-index/reindex": {Summary: "Start rebuilding the search index", Status: http.StatusAccepted, Response: models.ReindexReport{}},
+	"GET /admin/analytics":             {Summary: "Analytics export status", Response: models.AnalyticsStatus{}},
+	"POST /admin/analytics":            {Summary: "Trigger an analytics export", Status: http.StatusAccepted, Response: models.SuccessResponse{}},
+	"GET /admin/reprocess":             {Summary: "Report of the last reprocessing", Response: models.ReprocessReport{}},
+	"POST /admin/reprocess":            {Summary: "Start reprocessing records", Request: models.ReprocessRequest{}, Status: http.StatusAccepted, Response: models.ReprocessReport{}},
+	"GET /admin/verify":                {Summary: "Report of the last verification", Response: models.VerifyReport{}},
+	"POST /admin/verify":               {Summary: "Start verifying a backend", Request: models.VerifyRequest{}, Status: http.StatusAccepted, Response: models.VerifyReport{}},
+	"GET /admin/digest":                {Summary: "Failed tasks of the next digest", Response: models.FailedTaskDigest{}},
+	"POST /admin/digest":               {Summary: "Send the failed task digest now", Status: http.StatusAccepted, Response: models.SuccessResponse{}},
+	"GET /admin/hot-records": {Summary: "Most accessed records", Response: struct {
+		Records []*models.RecordAccessStats `json:"records"`
+		By      string                      `json:"by"`
+	}{}, Query: []apiParam{{"limit", "integer", "Records to return, default 20"}, {"by", "string", "reads, writes or total"}}},
+}
+
+// OpenAPI handles GET /openapi.json requests - describes the routes as an
+// OpenAPI 3 document
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, http.StatusOK, buildOpenAPI(h.routes))
+}
+
+// docsPage is the Swagger UI of /openapi.json, loaded from a CDN
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>mit-service API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>window.ui = SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// Docs handles GET /docs requests - serves Swagger UI
+func (h *Handler) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
+
+// buildOpenAPI returns the OpenAPI document of routes
+func buildOpenAPI(routes []apiRoute) map[string]interface{} {
+	schemas := newSchemaRegistry()
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     jsonContent(schemas.schema(reflect.TypeOf(models.ErrorResponse{}))),
+	}
+
+	paths := map[string]interface{}{}
+	for _, route := range routes {
+		item := map[string]interface{}{}
+		for _, method := range route.methods {
+			doc := apiOperations[method+" "+route.path]
+			item[strings.ToLower(method)] = openAPIOperation(schemas, route, method, doc, errorResponse)
+		}
+		paths[route.path] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "mit-service",
+			"version": version.Get().Version,
+			"description": "Record storage with writes queued through an inbox. Record routes take a tenant " +
+				"(X-Tenant-ID or a tenant key) or sandbox (X-Sandbox-Key) when configured",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]interface{}{
+				"adminToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// openAPIOperation returns the operation object of method of route
+func openAPIOperation(schemas *schemaRegistry, route apiRoute, method string, doc apiOperation, errorResponse interface{}) map[string]interface{} {
+	tag := "records"
+	switch segment := strings.SplitN(strings.TrimPrefix(route.path, "/"), "/", 2)[0]; {
+	case route.admin:
+		tag = "admin"
+	case segment == "collections":
+		tag = "collections"
+	case segment == "v2":
+		tag = "v2"
+	case segment == "task" || segment == "tasks" || segment == "stats":
+		tag = "tasks"
+	case segment == "health" || segment == "startup" || segment == "ready" || segment == "version" ||
+		segment == "performance" || segment == "slo" || segment == "openapi.json" || segment == "docs":
+		tag = "service"
+	}
+
+	operation := map[string]interface{}{
+		"operationId": operationID(method, route.path),
+		"summary":     doc.Summary,
+		"tags":        []string{tag},
+	}
+
+	var params []interface{}
+	for _, segment := range strings.Split(route.path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			params = append(params, map[string]interface{}{
+				"name": strings.TrimSuffix(name, "}"), "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, param := range doc.Query {
+		params = append(params, map[string]interface{}{
+			"name": param.Name, "in": "query", "description": param.Description,
+			"schema": map[string]interface{}{"type": param.Type},
+		})
+	}
+	if params != nil {
+		operation["parameters"] = params
+	}
+
+	if doc.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(schemas.schema(reflect.TypeOf(doc.Request))),
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := map[string]interface{}{"description": http.StatusText(status)}
+	if doc.Response != nil {
+		response["content"] = jsonContent(schemas.schema(reflect.TypeOf(doc.Response)))
+	}
+	operation["responses"] = map[string]interface{}{
+		strconv.Itoa(status): response,
+		"default":            errorResponse,
+	}
+
+	if route.admin {
+		operation["security"] = []map[string][]string{{"adminToken": {}}}
+	}
+	return operation
+}
+
+// operationID derives a unique operation ID from method and path, e.g.
+// get_records_id_history for GET /records/{id}/history
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		id += "_" + segment
+	}
+	return id
+}
+
+// jsonContent returns the content object of a JSON body of schema
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// schemaRegistry generates the JSON Schemas of Go types as encoding/json
+// encodes them. Named struct types become components referenced by name
+type schemaRegistry struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+	types   map[string]reflect.Type
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: map[string]interface{}{},
+		names:   map[reflect.Type]string{},
+		types:   map[string]reflect.Type{},
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema returns the schema of t
+func (s *schemaRegistry) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{} // any JSON value
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = t.Name()
+			if _, taken := s.types[name]; taken {
+				name = path.Base(t.PkgPath()) + "." + name
+			}
+			s.names[t] = name
+			s.types[name] = t
+			// Registered before its fields so recursive types refer to it
+			s.schemas[name] = nil
+			s.schemas[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{} // interfaces hold any JSON value
+}
+
+// object returns the schema of struct type t: its exported fields named by
+// their json tags, required unless omitempty, embedded structs inlined
+func (s *schemaRegistry) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+				addFields(fieldType)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = s.schema(field.Type)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if required != nil {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
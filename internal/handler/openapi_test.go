@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"mit-service/internal/metrics"
+)
+
+func TestOpenAPI_DocumentsEveryRoute(t *testing.T) {
+	mux := SetupRoutes(&fakeService{}, metrics.NewMetrics(), WithAdminToken("secret"))
+
+	rec := serve(mux, newRequest(t, http.MethodGet, "/openapi.json", nil))
+	assertStatus(t, rec, http.StatusOK)
+	var doc struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+				Required   []string               `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to decode the document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got %q", doc.OpenAPI)
+	}
+
+	// Routes missing from apiOperations lack a summary, operations of
+	// routes not registered are stale
+	documented := 0
+	for path, item := range doc.Paths {
+		for method, operation := range item {
+			if operation["summary"] == "" {
+				t.Errorf("Expected %s %s documented in apiOperations", strings.ToUpper(method), path)
+			}
+			documented++
+		}
+	}
+	if documented != len(apiOperations) {
+		t.Errorf("Expected the %d operations of apiOperations registered, got %d", len(apiOperations), documented)
+	}
+
+	insert := doc.Paths["/insert"]["post"]
+	body, _ := json.Marshal(insert["requestBody"])
+	if !strings.Contains(string(body), `"#/components/schemas/InsertRequest"`) || insert["responses"].(map[string]interface{})["201"] == nil {
+		t.Errorf("Expected /insert to take an InsertRequest and answer 201, got %v", insert)
+	}
+	request := doc.Components.Schemas["InsertRequest"]
+	if request.Properties["task_id"] == nil || request.Properties["id"] == nil {
+		t.Errorf("Expected the InsertRequest schema generated from its json tags, got %+v", request)
+	}
+	for _, name := range request.Required {
+		if name == "task_id" {
+			t.Error("Expected omitempty fields not required")
+		}
+	}
+
+	if doc.Paths["/admin/tables"]["get"]["security"] == nil || doc.Paths["/get"]["get"]["security"] != nil {
+		t.Error("Expected only admin routes to require the admin token")
+	}
+	if params, _ := json.Marshal(doc.Paths["/records/{id}/history"]["get"]["parameters"]); !strings.Contains(string(params), `"in":"path"`) {
+		t.Errorf("Expected the {id} path parameter, got %s", params)
+	}
+
+	rec = serve(mux, newRequest(t, http.MethodGet, "/docs", nil))
+	assertStatus(t, rec, http.StatusOK)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Errorf("Expected the Swagger UI page of /openapi.json, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"mit-service/internal/models"
+)
+
+// maxProtoValueBytes caps the body of protobuf inserts and updates
+const maxProtoValueBytes = 4 << 20
+
+// isProtobuf reports whether a request body is an encoded protobuf message
+func isProtobuf(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-protobuf" || mediaType == "application/protobuf"
+}
+
+// readProtoWrite reads a protobuf write: the message is the body, the record
+// ID and proto type are query parameters
+func (h *Handler) readProtoWrite(w http.ResponseWriter, r *http.Request) (*models.ProtoWriteRequest, bool) {
+	req := &models.ProtoWriteRequest{
+		ID:   r.URL.Query().Get("id"),
+		Type: r.URL.Query().Get("type"),
+	}
+	idFromPath(r, &req.ID)
+	if !h.validateID(req.ID) {
+		h.writeErrorResponse(w, http.StatusBadRequest, "ID cannot be empty")
+		return nil, false
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProtoValueBytes))
+	if err != nil {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return nil, false
+	}
+	if len(data) == 0 {
+		h.writeErrorResponse(w, http.StatusBadRequest, "Value cannot be empty")
+		return nil, false
+	}
+	req.Data = data
+	return req, true
+}
+
+// insertProto handles POST /insert requests with a protobuf body
+func (h *Handler) insertProto(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.readProtoWrite(w, r)
+	if !ok {
+		return
+	}
+
+	task, err := h.service.InsertProto(r.Context(), req)
+	if err != nil {
+		h.writeProtoError(w, r, "Insert", req, err)
+		return
+	}
+
+	log.Printf("Insert: queued protobuf insert task for record ID: %s", req.ID)
+	h.writeQueued(w, http.StatusCreated, "Insert task queued successfully", req.ID, task)
+}
+
+// updateProto handles POST /update requests with a protobuf body
+func (h *Handler) updateProto(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.readProtoWrite(w, r)
+	if !ok {
+		return
+	}
+
+	task, err := h.service.UpdateProto(r.Context(), req)
+	if err != nil {
+		h.writeProtoError(w, r, "Update", req, err)
+		return
+	}
+
+	h.writeQueued(w, http.StatusOK, "Update task queued successfully", "", task)
+}
+
+// writeProtoError maps protobuf write errors to HTTP responses
+func (h *Handler) writeProtoError(w http.ResponseWriter, r *http.Request, operation string, req *models.ProtoWriteRequest, err error) {
+	if h.clientGone(w, r, operation) {
+		return
+	}
+	log.Printf("%s: failed to write protobuf record %s: %v", operation, req.ID, err)
+	switch {
+	case errors.Is(err, models.ErrUnknownRecordType):
+		h.writeErrorResponse(w, http.StatusBadRequest, "Unknown proto type: "+req.Type)
+	case errors.Is(err, models.ErrInvalidProto):
+		h.writeErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, models.ErrRecordNotFound):
+		h.writeErrorResponse(w, http.StatusNotFound, "Record not found")
+	case errors.Is(err, models.ErrSystemRecord):
+		h.writeErrorResponse(w, http.StatusForbidden, err.Error())
+	default:
+		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to write record: "+err.Error())
+	}
+}
+
+// AdminProtoTypes handles /admin/proto-types requests managing proto types:
+// GET lists all types or returns one with ?name=, PUT ?name= registers the
+// descriptor set and message in the JSON body, DELETE ?name= removes an
+// unused type
+func (h *Handler) AdminProtoTypes(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			types, err := h.service.ListProtoTypes(ctx)
+			if err != nil {
+				h.writeSchemaError(w, r, "AdminProtoTypes", err)
+				return
+			}
+			h.writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+				"types": types,
+			})
+			return
+		}
+
+		protoType, err := h.service.GetProtoType(ctx, name)
+		if err != nil {
+			h.writeSchemaError(w, r, "AdminProtoTypes", err)
+			return
+		}
+		h.writeJSONResponse(w, http.StatusOK, protoType)
+
+	case http.MethodPut:
+		var protoType models.ProtoType
+		if err := json.NewDecoder(r.Body).Decode(&protoType); err != nil {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Invalid proto type JSON: "+err.Error())
+			return
+		}
+
+		protoType.Name = name
+		if err := h.service.PutProtoType(ctx, &protoType); err != nil {
+			h.writeSchemaError(w, r, "AdminProtoTypes", err)
+			return
+		}
+
+		log.Printf("AdminProtoTypes: registered proto type '%s' (%s)", name, protoType.Message)
+		h.writeJSONResponse(w, http.StatusOK, &protoType)
+
+	case http.MethodDelete:
+		if err := h.service.DeleteProtoType(ctx, name); err != nil {
+			h.writeSchemaError(w, r, "AdminProtoTypes", err)
+			return
+		}
+
+		log.Printf("AdminProtoTypes: deleted proto type '%s'", name)
+		h.writeJSONResponse(w, http.StatusOK, models.SuccessResponse{
+			Message: "Proto type deleted",
+		})
+
+	}
+}
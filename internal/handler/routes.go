@@ -1,30 +1,221 @@
 package handler
 
 import (
+	"context"
 	"mit-service/internal/metrics"
 	"mit-service/internal/service"
 	"net/http"
+	"sort"
+	"strings"
 )
 
-// SetupRoutes sets up HTTP routes using standard library
-func SetupRoutes(service *service.Service, metrics *metrics.Metrics) *http.ServeMux {
+// SetupRoutes sets up HTTP routes using standard library. Public and admin
+// routes pass through the middleware of publicChain and adminChain
+func SetupRoutes(service service.API, metrics *metrics.Metrics, opts ...Option) *http.ServeMux {
 	mux := http.NewServeMux()
-	h := NewHandler(service, metrics)
+	h := NewHandler(service, metrics, opts...)
 
-	// Health check endpoint
-	mux.HandleFunc("/health", h.withCORS(h.withMetrics(h.withLogging(h.Health))))
+	public := &router{mux: mux, h: h, chain: h.publicChain()}
+	admin := &router{mux: mux, h: h, chain: h.adminChain(), admin: true}
 
-	// Monitoring endpoints
-	mux.HandleFunc("/tasks", h.withCORS(h.withMetrics(h.withLogging(h.Tasks))))
-	mux.HandleFunc("/stats", h.withCORS(h.withMetrics(h.withLogging(h.TaskStats))))
+	// Record routes serve tenants and sandbox keys from their keyspace, the
+	// other public routes reject them. Record routes never reach system
+	// records without the admin token
+	records := public.with(StageAuth, h.withTenant(true)).with(StageAuth, h.withSandbox(true)).
+		with(StageScope, h.withRecordScope)
+	public = public.with(StageAuth, h.withTenant(false)).with(StageAuth, h.withSandbox(false))
+	debug := records.with(StageDebug, h.withDebug)
+	shaped := debug.with(StageShaping, h.withShaping)
+
+	// Health check, probes and build info endpoints
+	public.handle("/health", h.Health, http.MethodGet)
+	public.handle("/startup", h.Startup, http.MethodGet)
+	public.handle("/ready", h.Ready, http.MethodGet)
+	public.handle("/version", h.Version, http.MethodGet)
+	public.handle("/openapi.json", h.OpenAPI, http.MethodGet)
+	public.handle("/docs", h.Docs, http.MethodGet)
+
+	// Monitoring endpoints. Tenants and sandbox keys read the tasks of
+	// their keyspace and simulate tasks on its records
+	records.handle("/tasks", h.Tasks, http.MethodGet)
+	records.handle("/task", h.Task, http.MethodGet)
+	records.handle("/tasks/simulate", h.SimulateTask, http.MethodPost)
+	records.handle("/tasks/status", h.TaskStatuses, http.MethodPost)
+	public.handle("/stats", h.TaskStats, http.MethodGet)
 	mux.HandleFunc("/metrics", h.PrometheusMetrics) // No middleware to avoid recursive metrics
-	mux.HandleFunc("/performance", h.withCORS(h.withMetrics(h.withLogging(h.Performance))))
+	public.handle("/performance", h.Performance, http.MethodGet)
+	public.handle("/slo", h.SLO, http.MethodGet)
 
 	// API routes (root level as specified in requirements)
-	mux.HandleFunc("/insert", h.withCORS(h.withMetrics(h.withLogging(h.Insert))))
-	mux.HandleFunc("/update", h.withCORS(h.withMetrics(h.withLogging(h.Update))))
-	mux.HandleFunc("/delete", h.withCORS(h.withMetrics(h.withLogging(h.Delete))))
-	mux.HandleFunc("/get", h.withCORS(h.withMetrics(h.withLogging(h.Get))))
+	debug.handle("/insert", h.Insert, http.MethodPost)
+	debug.handle("/insert/batch", h.InsertBatch, http.MethodPost)
+	debug.handle("/reserve", h.Reserve, http.MethodPost)
+	debug.handle("/update", h.Update, http.MethodPost)
+	debug.handle("/delete", h.Delete, http.MethodPost)
+	shaped.handle("/get", h.Get, http.MethodGet)
+	shaped.handle("/records", h.Records, http.MethodGet)
+	debug.handle("/diff", h.Diff, http.MethodGet)
+	debug.handle("/records/{id}/history", h.RecordHistory, http.MethodGet)
+	debug.handle("/records/{id}/references", h.RecordReferences, http.MethodGet)
+	debug.handle("/records/{id}/composite", h.RecordComposite, http.MethodGet)
+	debug.handle("/traverse", h.Traverse, http.MethodGet)
+	records.handle("/ws", h.Changes, http.MethodGet)
+
+	// Collection routes, the record endpoints on the records of one
+	// collection. They run in the sandbox of the request like the others
+	inCollection := debug.with(StageAuth, h.withCollection)
+	debug.handle("/collections", h.Collections, http.MethodGet)
+	inCollection.handle("/collections/{name}", h.Collection, http.MethodGet)
+	inCollection.handleMethods("/collections/{name}/records", map[string]http.HandlerFunc{
+		http.MethodGet:  h.withShaping(h.Records),
+		http.MethodPost: h.Insert,
+	})
+	inCollection.handleMethods("/collections/{name}/records/{id}", map[string]http.HandlerFunc{
+		http.MethodGet:    h.withShaping(h.Get),
+		http.MethodPut:    h.Update,
+		http.MethodDelete: h.Delete,
+	})
+	inCollection.handle("/collections/{name}/records/{id}/history", h.RecordHistory, http.MethodGet)
+	inCollection.handle("/collections/{name}/records/{id}/references", h.RecordReferences, http.MethodGet)
+	inCollection.handle("/collections/{name}/records/{id}/composite", h.RecordComposite, http.MethodGet)
+	inCollection.handle("/collections/{name}/traverse", h.Traverse, http.MethodGet)
+
+	// v2 routes, the records and tasks as resources with the ID in the
+	// path. The flat routes above stay for existing clients
+	debug.handleMethods("/v2/records/{id}", map[string]http.HandlerFunc{
+		http.MethodGet:    h.withShaping(h.Get),
+		http.MethodPut:    h.Update,
+		http.MethodPatch:  h.Patch,
+		http.MethodDelete: h.Delete,
+	})
+	records.handle("/v2/tasks/{id}", h.Task, http.MethodGet)
+
+	// RPC routes, the record service for Twirp and Connect clients. Their
+	// methods are checked by the RPC handlers, which answer in the error
+	// format of the protocol
+	mux.HandleFunc(twirpPrefix, records.chain.Then(h.TwirpRPC))
+	mux.HandleFunc(connectPrefix, records.chain.Then(h.ConnectRPC))
+	for name := range rpcMethods {
+		metrics.RegisterEndpoints(twirpPrefix+name, connectPrefix+name)
+	}
+
+	// Per-operation success rates reported by /performance
+	metrics.RegisterOperation("insert", "/insert", "/insert/batch", twirpPrefix+"Insert", connectPrefix+"Insert")
+	metrics.RegisterOperation("update", "/update", twirpPrefix+"Update", connectPrefix+"Update")
+	metrics.RegisterOperation("delete", "/delete", twirpPrefix+"Delete", connectPrefix+"Delete")
+	metrics.RegisterOperation("get", "/get", twirpPrefix+"Get", connectPrefix+"Get")
+
+	// Admin routes, require the admin token
+	admin.handle("/selftest", h.SelfTest, http.MethodGet)
+	// Custom operations run unscoped in the worker, outside any keyspace
+	admin.handle("/tasks/enqueue", h.EnqueueTask, http.MethodPost)
+	// The search index holds the records of every keyspace
+	admin.with(StageDebug, h.withDebug).handle("/search", h.Search, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/tables", h.AdminTables, http.MethodGet)
+	admin.handle("/admin/explain", h.AdminExplain, http.MethodGet)
+	admin.handle("/admin/schema-check", h.AdminSchemaCheck, http.MethodGet)
+	admin.handle("/admin/snapshots", h.AdminSnapshots, http.MethodGet)
+	admin.handle("/admin/snapshots/save", h.AdminSaveSnapshot, http.MethodPost)
+	admin.handle("/admin/schemas", h.AdminSchemas, http.MethodGet, http.MethodPut, http.MethodDelete)
+	admin.handle("/admin/proto-types", h.AdminProtoTypes, http.MethodGet, http.MethodPut, http.MethodDelete)
+	admin.handle("/admin/retention", h.AdminRetention, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/duplicates", h.AdminDuplicates, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/integrity", h.AdminIntegrity, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/replication", h.AdminReplication, http.MethodGet)
+	admin.handle("/admin/replication/backfill", h.AdminReplicationBackfill, http.MethodPost)
+	admin.handle("/admin/shadow", h.AdminShadow, http.MethodGet)
+	admin.handle("/admin/shadow/backfill", h.AdminShadowBackfill, http.MethodPost)
+	admin.handle("/admin/shadow/cutover", h.AdminShadowCutover, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/export", h.AdminExport, http.MethodGet)
+	admin.handle("/admin/import", h.AdminImport, http.MethodPost)
+	admin.handle("/admin/clone", h.AdminClone, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/ingest", h.AdminIngest, http.MethodGet)
+	admin.handle("/admin/ingest/notify", h.AdminIngestNotify, http.MethodPost)
+	admin.handle("/admin/search-index", h.AdminSearchIndex, http.MethodGet)
+	admin.handle("/admin/search-index/reindex", h.AdminSearchReindex, http.MethodPost)
+	admin.handle("/admin/analytics", h.AdminAnalytics, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/reprocess", h.AdminReprocess, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/verify", h.AdminVerify, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/digest", h.AdminDigest, http.MethodGet, http.MethodPost)
+	admin.handle("/admin/hot-records", h.AdminHotRecords, http.MethodGet)
+	admin.handle("/admin/snapshots/load", h.AdminLoadSnapshot, http.MethodPost)
 
 	return mux
 }
+
+// router registers the routes of a group sharing a middleware chain,
+// matching them by method with ServeMux patterns
+type router struct {
+	mux   *http.ServeMux
+	h     *Handler
+	chain Chain
+	admin bool
+}
+
+// with returns a router for routes that also pass through m at stage
+func (rt *router) with(stage Stage, m Middleware) *router {
+	return &router{mux: rt.mux, h: rt.h, chain: rt.chain.Use(stage, m), admin: rt.admin}
+}
+
+// handle registers handler for path and methods. Other methods get a 405
+// listing the allowed ones in the Allow header; they still pass through the
+// middleware, so they are counted and CORS preflight requests are answered.
+// The path is recorded as its own endpoint label in the metrics and the
+// route is described by /openapi.json. The middleware keyed by route sees
+// path, with its parameters, as the route of the request, see routeOf
+func (rt *router) handle(path string, handler http.HandlerFunc, methods ...string) {
+	rt.h.metrics.RegisterEndpoints(path)
+	rt.h.routes = append(rt.h.routes, apiRoute{path: path, methods: methods, admin: rt.admin})
+	for _, method := range methods {
+		rt.mux.HandleFunc(method+" "+path, withRoute(path, rt.chain.Then(handler)))
+	}
+
+	allowed := strings.Join(methods, ", ")
+	rt.mux.HandleFunc(path, withRoute(path, rt.chain.Then(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allowed)
+		rt.h.writeErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	})))
+}
+
+// handleMethods registers the handler of each method of path, for paths
+// whose methods are served by different handlers, see handle
+func (rt *router) handleMethods(path string, handlers map[string]http.HandlerFunc) {
+	methods := make([]string, 0, len(handlers))
+	for method := range handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	rt.handle(path, func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			// HEAD requests match GET patterns
+			handler = handlers[http.MethodGet]
+		}
+		handler(w, r)
+	}, methods...)
+}
+
+// routeKey is the context key of the route of a request
+type routeKey struct{}
+
+// withRoute sets the route of the requests of next to path
+func withRoute(path string, next http.HandlerFunc) http.HandlerFunc {
+	if !strings.Contains(path, "{") {
+		// The route of a path without parameters is the path itself
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, path)))
+	}
+}
+
+// routeOf returns the route r was registered for, e.g. "/v2/records/{id}",
+// which keys the per-route configuration of shaping, limits, shedding and
+// timeouts. Routes without path parameters are their path
+func routeOf(r *http.Request) string {
+	if route, ok := r.Context().Value(routeKey{}).(string); ok {
+		return route
+	}
+	return r.URL.Path
+}
@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"mit-service/internal/models"
+	"mit-service/internal/service"
+)
+
+// RPCService is the fully qualified name of the record service on the RPC
+// routes. Calls are POST <prefix><RPCService>/<Method> with a JSON body, as
+// spoken by Twirp (prefix /twirp/) and Connect (prefix /) clients
+const RPCService = "mit.v1.RecordService"
+
+// RPC route prefixes
+const (
+	twirpPrefix   = "/twirp/" + RPCService + "/"
+	connectPrefix = "/" + RPCService + "/"
+)
+
+// rpcProtocol selects the error body of a protocol
+type rpcProtocol int
+
+const (
+	protocolTwirp rpcProtocol = iota
+	protocolConnect
+)
+
+// Error codes shared by Twirp and Connect
+const (
+	codeInvalidArgument    = "invalid_argument"
+	codeNotFound           = "not_found"
+	codeAlreadyExists      = "already_exists"
+	codeAborted            = "aborted"
+	codeFailedPrecondition = "failed_precondition"
+	codeDeadlineExceeded   = "deadline_exceeded"
+	codeCanceled           = "canceled"
+	codeUnimplemented      = "unimplemented"
+	codeUnavailable        = "unavailable"
+	codePermissionDenied   = "permission_denied"
+	codeInternal           = "internal"
+	codeBadRoute           = "bad_route"
+	codeMalformed          = "malformed"
+)
+
+// rpcError is an error returned by an RPC method
+type rpcError struct {
+	code    string
+	message string
+}
+
+func (e *rpcError) Error() string {
+	return e.code + ": " + e.message
+}
+
+// rpcMethod decodes a request from body and calls the service
+type rpcMethod func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error)
+
+// rpcMethods are the methods of RPCService. They share the request and
+// response types of the REST endpoints
+var rpcMethods = map[string]rpcMethod{
+	"Insert": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req models.InsertRequest
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		if !h.validateInsertID(req.ID) {
+			return nil, &rpcError{codeInvalidArgument, "ID cannot be empty"}
+		}
+		if problem := valueProblem(req.Value); problem != "" {
+			return nil, &rpcError{codeInvalidArgument, problem}
+		}
+		task, err := h.service.Insert(ctx, &req)
+		response := queuedResponse("Insert task queued successfully", task)
+		response.ID = req.ID
+		return response, err
+	},
+	"Update": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req models.UpdateRequest
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		if !h.validateID(req.ID) {
+			return nil, &rpcError{codeInvalidArgument, "ID cannot be empty"}
+		}
+		if problem := valueProblem(req.Value); problem != "" {
+			return nil, &rpcError{codeInvalidArgument, problem}
+		}
+		task, err := h.service.Update(ctx, &req)
+		return queuedResponse("Update task queued successfully", task), err
+	},
+	"Delete": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req models.DeleteRequest
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		if !h.validateID(req.ID) {
+			return nil, &rpcError{codeInvalidArgument, "ID cannot be empty"}
+		}
+		task, err := h.service.Delete(ctx, &req)
+		return queuedResponse("Delete task queued successfully", task), err
+	},
+	"Get": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req models.GetRecordRequest
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		if !h.validateID(req.ID) {
+			return nil, &rpcError{codeInvalidArgument, "ID cannot be empty"}
+		}
+		if req.ConsistencyToken != "" {
+			if err := h.service.WaitForWrite(ctx, req.ConsistencyToken); err != nil {
+				return nil, err
+			}
+		}
+		return h.service.Get(ctx, req.ID)
+	},
+	"ListRecords": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req models.ListRecordsRequest
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		limit, offset := rpcPagination(req.Limit, req.Offset)
+		return h.service.ListRecords(ctx, req.Type, limit, offset)
+	},
+	"EnqueueTask": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req models.EnqueueTaskRequest
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(req.Operation) == "" {
+			return nil, &rpcError{codeInvalidArgument, "Operation cannot be empty"}
+		}
+		task, err := h.service.EnqueueTask(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+		return &models.EnqueueTaskResponse{Message: req.Operation + " task queued successfully", TaskID: task.ID}, nil
+	},
+	"ListTasks": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req models.ListTasksRequest
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		limit, offset := rpcPagination(req.Limit, req.Offset)
+		return h.service.GetTasks(ctx, req.Status, limit, offset)
+	},
+	"GetTaskStats": func(h *Handler, ctx context.Context, body json.RawMessage) (interface{}, error) {
+		var req struct{}
+		if err := decodeRPCRequest(body, &req); err != nil {
+			return nil, err
+		}
+		return h.service.GetTaskStats(ctx)
+	},
+}
+
+// rpcScopedMethods are the methods confining their reads and writes to the
+// tenant and sandbox of the request, the others reject tenants and sandbox
+// keys
+var rpcScopedMethods = map[string]bool{
+	"Insert": true, "Update": true, "Delete": true, "Get": true, "ListRecords": true, "ListTasks": true,
+}
+
+// rpcAdminMethods are the methods requiring the admin token like their REST
+// endpoints. Custom operations run unscoped in the worker, so only admins
+// may queue them
+var rpcAdminMethods = map[string]bool{
+	"EnqueueTask": true,
+}
+
+// TwirpRPC handles POST /twirp/mit.v1.RecordService/<Method> requests
+func (h *Handler) TwirpRPC(w http.ResponseWriter, r *http.Request) {
+	h.serveRPC(w, r, protocolTwirp, strings.TrimPrefix(r.URL.Path, twirpPrefix))
+}
+
+// ConnectRPC handles POST /mit.v1.RecordService/<Method> requests
+func (h *Handler) ConnectRPC(w http.ResponseWriter, r *http.Request) {
+	h.serveRPC(w, r, protocolConnect, strings.TrimPrefix(r.URL.Path, connectPrefix))
+}
+
+// serveRPC calls an RPC method with the JSON request body. Only the JSON
+// encoding is supported, protobuf clients get a bad route error (Twirp) or
+// 415 (Connect)
+func (h *Handler) serveRPC(w http.ResponseWriter, r *http.Request, protocol rpcProtocol, name string) {
+	if r.Method != http.MethodPost {
+		h.writeRPCError(w, protocol, &rpcError{codeBadRoute, "unsupported method " + r.Method + ", use POST"})
+		return
+	}
+
+	method, ok := rpcMethods[name]
+	if !ok {
+		h.writeRPCError(w, protocol, &rpcError{codeBadRoute, "no method " + RPCService + "/" + name})
+		return
+	}
+	if rpcAdminMethods[name] && !h.adminAuthorized(r) {
+		h.writeRPCError(w, protocol, &rpcError{codePermissionDenied, RPCService + "/" + name + " requires the admin token"})
+		return
+	}
+	if service.SandboxFromContext(r.Context()) != "" && !rpcScopedMethods[name] {
+		h.writeRPCError(w, protocol, &rpcError{codePermissionDenied, "sandbox keys can only be used with the record methods"})
+		return
+	}
+	if service.TenantFromContext(r.Context()) != "" && !rpcScopedMethods[name] {
+		h.writeRPCError(w, protocol, &rpcError{codePermissionDenied, "tenants can only use the record methods"})
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		if protocol == protocolConnect {
+			w.Header().Set("Accept-Post", "application/json")
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		h.writeRPCError(w, protocol, &rpcError{codeBadRoute, "unsupported content type " + r.Header.Get("Content-Type") + ", use application/json"})
+		return
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		h.writeRPCError(w, protocol, &rpcError{codeMalformed, "invalid request body: " + err.Error()})
+		return
+	}
+
+	response, err := method(h, r.Context(), body)
+	if err != nil {
+		if h.clientGone(w, r, "RPC "+name) {
+			return
+		}
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = toRPCError(err)
+		}
+		if rpcErr.code == codeInternal {
+			log.Printf("RPC %s: %v", name, err)
+		}
+		h.writeRPCError(w, protocol, rpcErr)
+		return
+	}
+
+	h.writeJSONResponse(w, http.StatusOK, response)
+}
+
+// decodeRPCRequest decodes a request body, an empty body being an empty request
+func decodeRPCRequest(body json.RawMessage, req interface{}) error {
+	if len(body) == 0 || string(body) == "null" {
+		return nil
+	}
+	if err := models.UnmarshalValue(body, req); err != nil {
+		return &rpcError{codeMalformed, "invalid request body: " + err.Error()}
+	}
+	return nil
+}
+
+// queuedResponse is the response of a queued write
+func queuedResponse(message string, task *models.InboxTask) *models.SuccessResponse {
+	response := &models.SuccessResponse{Message: message}
+	if task != nil {
+		response.ConsistencyToken = task.ID
+	}
+	return response
+}
+
+// rpcPagination applies the defaults of parsePagination
+func rpcPagination(limit, offset int) (int, int) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// toRPCError maps service errors to RPC error codes
+func toRPCError(err error) *rpcError {
+	switch {
+	case errors.Is(err, models.ErrRecordNotFound):
+		return &rpcError{codeNotFound, "Record not found"}
+	case errors.Is(err, models.ErrUnknownRecordType), errors.Is(err, models.ErrInvalidTaskOperation),
+		errors.Is(err, models.ErrSchemaValidation), errors.Is(err, models.ErrInvalidToken), errors.Is(err, models.ErrIDRequired),
+		errors.Is(err, models.ErrInvalidTaskID):
+		return &rpcError{codeInvalidArgument, err.Error()}
+	case errors.Is(err, models.ErrRecordExists), errors.Is(err, models.ErrRecordReserved), errors.Is(err, models.ErrTaskExists):
+		return &rpcError{codeAlreadyExists, err.Error()}
+	case errors.Is(err, models.ErrReservationExpired), errors.Is(err, models.ErrRecordReferenced):
+		return &rpcError{codeFailedPrecondition, err.Error()}
+	case errors.Is(err, models.ErrReservationsDisabled):
+		return &rpcError{codeUnimplemented, err.Error()}
+	case errors.Is(err, models.ErrSystemRecord):
+		return &rpcError{codePermissionDenied, err.Error()}
+	case errors.Is(err, models.ErrVersionConflict):
+		return &rpcError{codeAborted, "Record version conflict"}
+	case errors.Is(err, models.ErrWriteFailed):
+		return &rpcError{codeFailedPrecondition, "The write of this consistency token failed: " + err.Error()}
+	case errors.Is(err, models.ErrConsistencyTimeout):
+		return &rpcError{codeUnavailable, "Write not applied yet, retry later"}
+	case errors.Is(err, models.ErrQueryTimeout), errors.Is(err, context.DeadlineExceeded):
+		return &rpcError{codeDeadlineExceeded, "Database query timed out"}
+	case errors.Is(err, context.Canceled):
+		return &rpcError{codeCanceled, "Request cancelled"}
+	default:
+		return &rpcError{codeInternal, err.Error()}
+	}
+}
+
+// rpcStatus is the HTTP status of an error code, the same for both protocols
+// except where Connect deviates from Twirp
+func rpcStatus(protocol rpcProtocol, code string) int {
+	switch code {
+	case codeInvalidArgument, codeMalformed:
+		return http.StatusBadRequest
+	case codeNotFound:
+		return http.StatusNotFound
+	case codeBadRoute:
+		return http.StatusNotFound
+	case codeAlreadyExists, codeAborted:
+		return http.StatusConflict
+	case codeFailedPrecondition:
+		if protocol == protocolConnect {
+			return http.StatusBadRequest
+		}
+		return http.StatusPreconditionFailed
+	case codeDeadlineExceeded:
+		if protocol == protocolConnect {
+			return http.StatusGatewayTimeout
+		}
+		return http.StatusRequestTimeout
+	case codeCanceled:
+		if protocol == protocolConnect {
+			return statusClientClosedRequest
+		}
+		return http.StatusRequestTimeout
+	case codeUnimplemented:
+		return http.StatusNotImplemented
+	case codeUnavailable:
+		return http.StatusServiceUnavailable
+	case codePermissionDenied:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeRPCError writes the error body of the protocol: Twirp uses
+// {"code", "msg"}, Connect {"code", "message"}
+func (h *Handler) writeRPCError(w http.ResponseWriter, protocol rpcProtocol, err *rpcError) {
+	code := err.code
+	if protocol == protocolConnect {
+		// Connect has no bad_route or malformed codes
+		switch code {
+		case codeBadRoute:
+			code = codeNotFound
+		case codeMalformed:
+			code = codeInvalidArgument
+		}
+		h.writeJSONResponse(w, rpcStatus(protocol, err.code), map[string]string{"code": code, "message": err.message})
+		return
+	}
+	h.writeJSONResponse(w, rpcStatus(protocol, code), map[string]string{"code": code, "msg": err.message})
+}
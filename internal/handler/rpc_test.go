@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+// assertRPCError fails the test unless the response is an RPC error of code,
+// reading the message field of the protocol
+func assertRPCError(t *testing.T, body []byte, messageField, code string) {
+	t.Helper()
+
+	var resp map[string]string
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("Expected JSON error response, got %q: %v", body, err)
+	}
+	if resp["code"] != code || resp[messageField] == "" {
+		t.Errorf("Expected %s error with %s, got %s", code, messageField, body)
+	}
+}
+
+func TestRPC_Calls(t *testing.T) {
+	svc := &fakeService{
+		record:  &models.Record{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})},
+		records: &models.RecordsListResponse{Limit: 50},
+		task:    &models.InboxTask{ID: "task-1"},
+		stats:   &models.TaskStats{TotalTasks: 1},
+	}
+	mux := newTestMux(svc)
+
+	for _, prefix := range []string{twirpPrefix, connectPrefix} {
+		rec := serve(mux, newRequest(t, http.MethodPost, prefix+"Insert", map[string]interface{}{"id": "a", "value": map[string]interface{}{"k": "v"}}))
+		assertStatus(t, rec, http.StatusOK)
+		var queued models.SuccessResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &queued); err != nil || queued.ConsistencyToken != "task-1" {
+			t.Errorf("Expected consistency token task-1, got %s", rec.Body.String())
+		}
+
+		rec = serve(mux, newRequest(t, http.MethodPost, prefix+"Get", map[string]interface{}{"id": "a", "consistency_token": "task-1"}))
+		assertStatus(t, rec, http.StatusOK)
+		var record models.Record
+		if err := json.Unmarshal(rec.Body.Bytes(), &record); err != nil || record.ID != "a" {
+			t.Errorf("Expected record a, got %s", rec.Body.String())
+		}
+		if svc.lastToken != "task-1" {
+			t.Errorf("Expected Get to wait for task-1, got %q", svc.lastToken)
+		}
+
+		rec = serve(mux, newAdminRequest(t, http.MethodPost, prefix+"EnqueueTask", map[string]interface{}{"operation": "reindex"}))
+		assertStatus(t, rec, http.StatusOK)
+
+		// An empty body is an empty request
+		rec = serve(mux, newRequest(t, http.MethodPost, prefix+"GetTaskStats", "{}"))
+		assertStatus(t, rec, http.StatusOK)
+		req := newRequest(t, http.MethodPost, prefix+"ListRecords", nil)
+		req.Header.Set("Content-Type", "application/json")
+		assertStatus(t, serve(mux, req), http.StatusOK)
+	}
+}
+
+func TestRPC_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		rpc         string
+		contentType string
+		body        string
+		err         error
+		twirp       int
+		twirpCode   string
+		connect     int
+		connectCode string
+	}{
+		{"unknown method", http.MethodPost, "Drop", "application/json", "{}", nil,
+			http.StatusNotFound, codeBadRoute, http.StatusNotFound, codeNotFound},
+		{"GET", http.MethodGet, "Get", "application/json", "", nil,
+			http.StatusNotFound, codeBadRoute, http.StatusNotFound, codeNotFound},
+		{"malformed body", http.MethodPost, "Get", "application/json", "{", nil,
+			http.StatusBadRequest, codeMalformed, http.StatusBadRequest, codeInvalidArgument},
+		{"empty ID", http.MethodPost, "Get", "application/json", `{"id": " "}`, nil,
+			http.StatusBadRequest, codeInvalidArgument, http.StatusBadRequest, codeInvalidArgument},
+		{"not found", http.MethodPost, "Get", "application/json", `{"id": "a"}`, models.ErrRecordNotFound,
+			http.StatusNotFound, codeNotFound, http.StatusNotFound, codeNotFound},
+		{"version conflict", http.MethodPost, "Update", "application/json", `{"id": "a", "value": {"k": "v"}, "expected_version": 1}`, models.ErrVersionConflict,
+			http.StatusConflict, codeAborted, http.StatusConflict, codeAborted},
+		{"write failed", http.MethodPost, "Get", "application/json", `{"id": "a", "consistency_token": "t"}`, models.ErrWriteFailed,
+			http.StatusPreconditionFailed, codeFailedPrecondition, http.StatusBadRequest, codeFailedPrecondition},
+		{"query timeout", http.MethodPost, "ListRecords", "application/json", "{}", models.ErrQueryTimeout,
+			http.StatusRequestTimeout, codeDeadlineExceeded, http.StatusGatewayTimeout, codeDeadlineExceeded},
+		{"internal", http.MethodPost, "Delete", "application/json", `{"id": "a"}`, errors.New("boom"),
+			http.StatusInternalServerError, codeInternal, http.StatusInternalServerError, codeInternal},
+		{"admin method", http.MethodPost, "EnqueueTask", "application/json", `{"operation": "reindex"}`, nil,
+			http.StatusForbidden, codePermissionDenied, http.StatusForbidden, codePermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := newTestMux(&fakeService{err: tt.err})
+
+			req := newRequest(t, tt.method, twirpPrefix+tt.rpc, tt.body)
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := serve(mux, req)
+			assertStatus(t, rec, tt.twirp)
+			assertRPCError(t, rec.Body.Bytes(), "msg", tt.twirpCode)
+
+			req = newRequest(t, tt.method, connectPrefix+tt.rpc, tt.body)
+			req.Header.Set("Content-Type", tt.contentType)
+			rec = serve(mux, req)
+			assertStatus(t, rec, tt.connect)
+			assertRPCError(t, rec.Body.Bytes(), "message", tt.connectCode)
+		})
+	}
+}
+
+func TestRPC_Protobuf(t *testing.T) {
+	mux := newTestMux(&fakeService{})
+
+	req := newRequest(t, http.MethodPost, twirpPrefix+"Get", "")
+	req.Header.Set("Content-Type", "application/protobuf")
+	rec := serve(mux, req)
+	assertStatus(t, rec, http.StatusNotFound)
+	assertRPCError(t, rec.Body.Bytes(), "msg", codeBadRoute)
+
+	req = newRequest(t, http.MethodPost, connectPrefix+"Get", "")
+	req.Header.Set("Content-Type", "application/proto")
+	rec = serve(mux, req)
+	assertStatus(t, rec, http.StatusUnsupportedMediaType)
+	if rec.Header().Get("Accept-Post") != "application/json" {
+		t.Errorf("Expected Accept-Post header, got %q", rec.Header().Get("Accept-Post"))
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"mit-service/internal/service"
+)
+
+// sandboxKeyHeader carries the API key of a sandbox
+const sandboxKeyHeader = "X-Sandbox-Key"
+
+// ParseSandboxKeys parses sandbox API keys, e.g. "acme=k3y1,demo=k3y2",
+// into the sandbox of each key. A sandbox may have several keys
+func ParseSandboxKeys(spec string) (map[string]string, error) {
+	return parseKeys(spec, "sandbox", func(name string) error {
+		if strings.Contains(name, "/") {
+			return fmt.Errorf("invalid sandbox name %q, it must not contain '/'", name)
+		}
+		return nil
+	})
+}
+
+// parseKeys parses "<name>=<key>" entries into the name of each key, kind
+// naming the owners of the keys in errors
+func parseKeys(spec, kind string, validate func(name string) error) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, key, ok := strings.Cut(entry, "=")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid %s key %q, expected <%s>=<key>", kind, entry, kind)
+		}
+		if err := validate(name); err != nil {
+			return nil, err
+		}
+		if other, ok := keys[key]; ok && other != name {
+			return nil, fmt.Errorf("%s key of %q is also the key of %q", kind, name, other)
+		}
+		keys[key] = name
+	}
+	return keys, nil
+}
+
+// lookupKey returns the name key maps to in keys. Every key is compared in
+// constant time, so the time taken does not reveal how much of a key matched
+func lookupKey(keys map[string]string, key string) (name string, ok bool) {
+	for candidate, owner := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			name, ok = owner, true
+		}
+	}
+	return name, ok
+}
+
+// WithSandboxKeys serves requests carrying one of keys in the X-Sandbox-Key
+// header from the sandbox it maps to: the records they read and write are
+// separate from the production ones and those of other sandboxes
+func WithSandboxKeys(keys map[string]string) Option {
+	return func(h *Handler) {
+		h.sandboxKeys = keys
+	}
+}
+
+// withSandbox confines requests with a sandbox key to their sandbox. Routes
+// that do not confine their reads and writes to a sandbox (scoped false)
+// reject sandbox keys, so integrators never reach production data by mistake
+func (h *Handler) withSandbox(scoped bool) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(sandboxKeyHeader)
+			if key == "" || h.sandboxKeys == nil {
+				next(w, r)
+				return
+			}
+
+			name, ok := lookupKey(h.sandboxKeys, key)
+			if !ok {
+				h.writeErrorResponse(w, http.StatusUnauthorized, "Invalid sandbox key")
+				return
+			}
+			if !scoped {
+				h.writeErrorResponse(w, http.StatusForbidden, "Sandbox keys can only be used with the record endpoints")
+				return
+			}
+			next(w, r.WithContext(service.WithSandbox(r.Context(), name)))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"text/template"
+)
+
+// clientProfileHeader names the client profile whose response templates
+// apply to a request
+const clientProfileHeader = "X-Client-Profile"
+
+// templateRoutes are the routes response templates are given for
+var templateRoutes = map[string]bool{"/get": true, "/records": true}
+
+// shapedRoutes maps the routes whose responses can be shaped to the route of
+// their templates. The routes with the ID or collection in the path share
+// the templates of the flat routes serving the same responses
+var shapedRoutes = map[string]string{
+	"/get":                             "/get",
+	"/records":                         "/records",
+	"/v2/records/{id}":                 "/get",
+	"/collections/{name}/records":      "/records",
+	"/collections/{name}/records/{id}": "/get",
+}
+
+// ResponseTemplate is a Go template rendering the responses of a route for
+// clients of a profile. The template gets the decoded JSON response and
+// its output becomes the response body
+type ResponseTemplate struct {
+	Profile     string `json:"profile"`
+	Route       string `json:"route"` // "/get" or "/records", also applied to their v2 and collection routes
+	Template    string `json:"template"`
+	ContentType string `json:"content_type,omitempty"` // application/json by default
+}
+
+// compiledTemplate is a response template parsed once at load time
+type compiledTemplate struct {
+	template    *template.Template
+	contentType string
+}
+
+// ResponseTemplates are the response templates per client profile and route
+type ResponseTemplates struct {
+	profiles map[string]map[string]*compiledTemplate
+}
+
+// templateFuncs are available to response templates
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. {{json .value}}
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+// LoadResponseTemplates reads a JSON array of response templates from path
+func LoadResponseTemplates(path string) (*ResponseTemplates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response templates: %w", err)
+	}
+
+	var templates []ResponseTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse response templates: %w", err)
+	}
+	return NewResponseTemplates(templates)
+}
+
+// NewResponseTemplates compiles response templates. A profile has at most
+// one template per route
+func NewResponseTemplates(templates []ResponseTemplate) (*ResponseTemplates, error) {
+	profiles := make(map[string]map[string]*compiledTemplate)
+	for i, t := range templates {
+		if t.Profile == "" {
+			return nil, fmt.Errorf("response template %d: profile is required", i)
+		}
+		if !templateRoutes[t.Route] {
+			return nil, fmt.Errorf("response template %d: route %q cannot be shaped, use /get or /records", i, t.Route)
+		}
+		if profiles[t.Profile][t.Route] != nil {
+			return nil, fmt.Errorf("response template %d: profile %q has two templates for %s", i, t.Profile, t.Route)
+		}
+
+		parsed, err := template.New(t.Profile + t.Route).Funcs(templateFuncs).Option("missingkey=zero").Parse(t.Template)
+		if err != nil {
+			return nil, fmt.Errorf("response template %d: %w", i, err)
+		}
+		contentType := t.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+
+		if profiles[t.Profile] == nil {
+			profiles[t.Profile] = make(map[string]*compiledTemplate)
+		}
+		profiles[t.Profile][t.Route] = &compiledTemplate{template: parsed, contentType: contentType}
+	}
+	return &ResponseTemplates{profiles: profiles}, nil
+}
+
+// Profiles returns the number of client profiles
+func (t *ResponseTemplates) Profiles() int {
+	return len(t.profiles)
+}
+
+// WithResponseTemplates shapes /get and /records responses, and those of
+// their v2 and collection routes, for requests naming a client profile in
+// the X-Client-Profile header
+func WithResponseTemplates(templates *ResponseTemplates) Option {
+	return func(h *Handler) {
+		h.templates = templates
+	}
+}
+
+// withShaping renders successful JSON responses through the template of the
+// client profile. Requests without a profile, and routes the profile has no
+// template for, get the plain response
+func (h *Handler) withShaping(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile := r.Header.Get(clientProfileHeader)
+		if profile == "" || h.templates == nil {
+			next(w, r)
+			return
+		}
+
+		routes, ok := h.templates.profiles[profile]
+		if !ok {
+			h.writeErrorResponse(w, http.StatusBadRequest, "Unknown client profile: "+profile)
+			return
+		}
+		compiled, ok := routes[shapedRoutes[routeOf(r)]]
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		bw := &bufferedWriter{header: w.Header()}
+		next(bw, r)
+
+		mediaType, _, _ := mime.ParseMediaType(bw.header.Get("Content-Type"))
+		if bw.status != http.StatusOK || mediaType != "application/json" {
+			bw.flush(w)
+			return
+		}
+
+		decoder := json.NewDecoder(&bw.body)
+		decoder.UseNumber()
+		var data interface{}
+		var shaped bytes.Buffer
+		err := decoder.Decode(&data)
+		if err == nil {
+			err = compiled.template.Execute(&shaped, data)
+		}
+		if err != nil {
+			log.Printf("Failed to shape %s response for profile %s: %v", r.URL.Path, profile, err)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to shape response: "+err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", compiled.contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(shaped.Bytes())
+	}
+}
+
+// bufferedWriter holds a response until withShaping decides how to send it
+type bufferedWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	if bw.status == 0 {
+		bw.status = code
+	}
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(b)
+}
+
+// flush sends the buffered response unchanged
+func (bw *bufferedWriter) flush(w http.ResponseWriter) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	w.WriteHeader(bw.status)
+	w.Write(bw.body.Bytes())
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+)
+
+func TestResponseShaping(t *testing.T) {
+	templates, err := NewResponseTemplates([]ResponseTemplate{
+		{Profile: "legacy", Route: "/get", Template: `{"key":{{json .id}},"name":{{json .value.name}},"age":{{.value.age}}}`},
+		{Profile: "csv", Route: "/records", Template: `{{range .records}}{{.id}},{{.value.name}}{{"\n"}}{{end}}`, ContentType: "text/csv"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	svc := &fakeService{
+		record: &models.Record{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada", "age": 36})},
+		records: &models.RecordsListResponse{Records: []*models.Record{
+			{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})},
+			{ID: "user_2", Value: models.MustEncodeValue(map[string]interface{}{"name": "Bob"})},
+		}},
+	}
+	mux := SetupRoutes(svc, metrics.NewMetrics(), WithResponseTemplates(templates))
+
+	get := func(target, profile string) *http.Request {
+		req := newRequest(t, http.MethodGet, target, nil)
+		req.Header.Set(clientProfileHeader, profile)
+		return req
+	}
+
+	rec := serve(mux, get("/get?id=user_1", "legacy"))
+	assertStatus(t, rec, http.StatusOK)
+	if body := rec.Body.String(); body != `{"key":"user_1","name":"Ada","age":36}` {
+		t.Errorf("Expected the flat legacy record, got %s", body)
+	}
+
+	// The v2 route shares the /get templates
+	rec = serve(mux, get("/v2/records/user_1", "legacy"))
+	assertStatus(t, rec, http.StatusOK)
+	if body := rec.Body.String(); body != `{"key":"user_1","name":"Ada","age":36}` {
+		t.Errorf("Expected the flat legacy record from the v2 route, got %s", body)
+	}
+
+	rec = serve(mux, get("/records", "csv"))
+	assertStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "text/csv" || rec.Body.String() != "user_1,Ada\nuser_2,Bob\n" {
+		t.Errorf("Expected CSV records, got %s %q", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	// Collection routes share the /get and /records templates
+	rec = serve(mux, get("/collections/orders/records/user_1", "legacy"))
+	assertStatus(t, rec, http.StatusOK)
+	if body := rec.Body.String(); body != `{"key":"user_1","name":"Ada","age":36}` {
+		t.Errorf("Expected the flat legacy record from the collection route, got %s", body)
+	}
+
+	rec = serve(mux, get("/collections/orders/records", "csv"))
+	assertStatus(t, rec, http.StatusOK)
+	if rec.Body.String() != "user_1,Ada\nuser_2,Bob\n" {
+		t.Errorf("Expected CSV records from the collection route, got %q", rec.Body.String())
+	}
+
+	// Routes the profile has no template for are not shaped
+	rec = serve(mux, get("/get?id=user_1", "csv"))
+	assertStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the plain JSON record, got %s", rec.Body.String())
+	}
+
+	rec = serve(mux, get("/get?id=user_1", "unknown"))
+	assertStatus(t, rec, http.StatusBadRequest)
+	assertErrorContains(t, rec, "Unknown client profile")
+
+	// Errors pass through unchanged
+	rec = serve(SetupRoutes(&fakeService{err: models.ErrRecordNotFound}, metrics.NewMetrics(), WithResponseTemplates(templates)), get("/get?id=user_1", "legacy"))
+	assertStatus(t, rec, http.StatusNotFound)
+	assertErrorContains(t, rec, "Record not found")
+}
+
+func TestNewResponseTemplates_Invalid(t *testing.T) {
+	tests := map[string][]ResponseTemplate{
+		"no profile":      {{Route: "/get", Template: "{}"}},
+		"route":           {{Profile: "legacy", Route: "/insert", Template: "{}"}},
+		"duplicate route": {{Profile: "legacy", Route: "/get", Template: "{}"}, {Profile: "legacy", Route: "/get", Template: "{}"}},
+		"syntax":          {{Profile: "legacy", Route: "/get", Template: "{{.id"}},
+	}
+	for name, templates := range tests {
+		if _, err := NewResponseTemplates(templates); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
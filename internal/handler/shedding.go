@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mit-service/internal/metrics"
+)
+
+// Priority decides which requests are shed first under overload
+type Priority int
+
+// Endpoint priorities, from first to last shed
+const (
+	PriorityLow      Priority = iota // listings and exports, shed under overload
+	PriorityHigh                     // point reads and writes, shed only under severe overload
+	PriorityCritical                 // health checks, never shed
+)
+
+// String returns the priority name used in configuration and metrics
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "high"
+	}
+}
+
+// ParsePriority parses "low", "high" or "critical"
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
+	case "critical":
+		return PriorityCritical, nil
+	}
+	return PriorityHigh, fmt.Errorf("unknown priority %q, use low, high or critical", s)
+}
+
+// defaultPriorities keeps point reads and writes alive longest. Unlisted
+// endpoints are high priority
+var defaultPriorities = map[string]Priority{
+	"/health":      PriorityCritical,
+	"/startup":     PriorityCritical,
+	"/ready":       PriorityCritical,
+	"/version":     PriorityCritical,
+	"/records":     PriorityLow,
+	"/tasks":       PriorityLow,
+	"/stats":       PriorityLow,
+	"/performance": PriorityLow,
+	"/slo":         PriorityLow,
+}
+
+// ParsePriorities parses endpoint priority overrides, e.g.
+// "/records=low,/get=critical,/v2/records/{id}=critical", on top of the
+// defaults. Routes with path parameters are named as registered
+func ParsePriorities(spec string) (map[string]Priority, error) {
+	priorities := make(map[string]Priority, len(defaultPriorities))
+	for path, p := range defaultPriorities {
+		priorities[path] = p
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		path, name, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid priority %q, expected /<path>=<priority>", entry)
+		}
+		p, err := ParsePriority(name)
+		if err != nil {
+			return nil, err
+		}
+		priorities[strings.TrimSpace(path)] = p
+	}
+
+	return priorities, nil
+}
+
+// latencyDecay is the weight of the newest sample in the latency average
+const latencyDecay = 0.1
+
+// LoadShedder rejects requests by endpoint priority while the service is
+// overloaded. Overload is measured as the moving average of request latency
+// relative to maxLatency, and the number of requests in flight relative to
+// maxInFlight. At the limit low-priority requests are shed; at twice the
+// limit high-priority requests are shed as well
+type LoadShedder struct {
+	priorities  map[string]Priority
+	maxLatency  time.Duration
+	maxInFlight int64
+	metrics     *metrics.Metrics
+
+	inFlight int64
+
+	mu      sync.Mutex
+	latency float64 // moving average in nanoseconds
+}
+
+// NewLoadShedder creates a shedder. A zero maxLatency or maxInFlight disables
+// that signal
+func NewLoadShedder(priorities map[string]Priority, maxLatency time.Duration, maxInFlight int, metrics *metrics.Metrics) *LoadShedder {
+	return &LoadShedder{
+		priorities:  priorities,
+		maxLatency:  maxLatency,
+		maxInFlight: int64(maxInFlight),
+		metrics:     metrics,
+	}
+}
+
+// WithLoadShedding sheds low-priority requests first when the service is overloaded
+func WithLoadShedding(shedder *LoadShedder) Option {
+	return func(h *Handler) {
+		h.shedder = shedder
+	}
+}
+
+// priority returns the priority of an endpoint
+func (s *LoadShedder) priority(path string) Priority {
+	if p, ok := s.priorities[path]; ok {
+		return p
+	}
+	return PriorityHigh
+}
+
+// load returns the current load relative to the limits, 1 being at the limit
+func (s *LoadShedder) load(inFlight int64) float64 {
+	var load float64
+	if s.maxLatency > 0 {
+		s.mu.Lock()
+		load = s.latency / float64(s.maxLatency)
+		s.mu.Unlock()
+	}
+	if s.maxInFlight > 0 {
+		if l := float64(inFlight) / float64(s.maxInFlight); l > load {
+			load = l
+		}
+	}
+	return load
+}
+
+// shouldShed reports whether a request of priority p is rejected at load
+func shouldShed(p Priority, load float64) bool {
+	switch p {
+	case PriorityLow:
+		return load >= 1
+	case PriorityHigh:
+		return load >= 2
+	default:
+		return false
+	}
+}
+
+// observe adds a request latency to the moving average
+func (s *LoadShedder) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latency == 0 {
+		s.latency = float64(d)
+		return
+	}
+	s.latency += latencyDecay * (float64(d) - s.latency)
+}
+
+// withShedding rejects the request with 503 when its endpoint's priority is
+// being shed, and otherwise feeds its latency into the overload detection
+func (h *Handler) withShedding(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := h.shedder
+		if s == nil {
+			next(w, r)
+			return
+		}
+
+		inFlight := atomic.AddInt64(&s.inFlight, 1)
+		defer atomic.AddInt64(&s.inFlight, -1)
+
+		route := routeOf(r)
+		priority := s.priority(route)
+		if shouldShed(priority, s.load(inFlight)) {
+			s.metrics.RecordShedRequest(route, priority.String())
+			w.Header().Set("Retry-After", "1")
+			h.writeErrorResponse(w, http.StatusServiceUnavailable, "Service overloaded, retry later")
+			return
+		}
+
+		start := time.Now()
+		next(w, r)
+		s.observe(time.Since(start))
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+)
+
+func TestLoadShedding_ByPriority(t *testing.T) {
+	priorities, err := ParsePriorities("/get=low")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	shedder := NewLoadShedder(priorities, 100*time.Millisecond, 0, metrics.NewMetrics())
+
+	svc := &fakeService{
+		record:  &models.Record{ID: "a"},
+		records: &models.RecordsListResponse{},
+	}
+	mux := SetupRoutes(svc, metrics.NewMetrics(), WithLoadShedding(shedder))
+
+	tests := []struct {
+		name    string
+		latency time.Duration
+		target  string
+		status  int
+	}{
+		{"idle listing", 10 * time.Millisecond, "/records", http.StatusOK},
+		{"overloaded listing", 150 * time.Millisecond, "/records", http.StatusServiceUnavailable},
+		{"overloaded override", 150 * time.Millisecond, "/get?id=a", http.StatusServiceUnavailable},
+		{"overloaded write", 150 * time.Millisecond, "/delete", http.StatusOK},
+		{"severe write", 250 * time.Millisecond, "/delete", http.StatusServiceUnavailable},
+		{"severe health", 250 * time.Millisecond, "/health", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shedder.latency = float64(tt.latency)
+
+			method, body := http.MethodGet, interface{}(nil)
+			if tt.target == "/delete" {
+				method, body = http.MethodPost, map[string]interface{}{"id": "a"}
+			}
+
+			rec := serve(mux, newRequest(t, method, tt.target, body))
+			assertStatus(t, rec, tt.status)
+			if tt.status == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+				t.Error("Expected Retry-After header on shed request")
+			}
+		})
+	}
+}
+
+func TestParsePriorities_Invalid(t *testing.T) {
+	for _, spec := range []string{"records=low", "/records", "/records=urgent"} {
+		if _, err := ParsePriorities(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
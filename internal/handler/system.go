@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+
+	"mit-service/internal/service"
+)
+
+// withRecordScope confines the record accesses of a request to the records
+// of its keyspace and collection, so API keys never reach system records.
+// Requests with the admin token keep access to every record
+func (h *Handler) withRecordScope(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminAuthorized(r) {
+			next(w, r)
+			return
+		}
+		next(w, r.WithContext(service.ConfineToScope(r.Context())))
+	}
+}
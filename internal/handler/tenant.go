@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"mit-service/internal/service"
+)
+
+// tenantHeader names the tenant of a request
+const tenantHeader = "X-Tenant-ID"
+
+// ParseTenantKeys parses tenant API keys, e.g. "acme=k3y1,globex=k3y2",
+// into the tenant of each key. A tenant may have several keys
+func ParseTenantKeys(spec string) (map[string]string, error) {
+	return parseKeys(spec, "tenant", func(name string) error {
+		if !service.ValidTenantID(name) {
+			return fmt.Errorf("invalid tenant ID %q, expected up to 64 letters, digits, '_', '.' and '-'", name)
+		}
+		return nil
+	})
+}
+
+// WithTenantKeys serves requests carrying one of keys as a bearer token
+// for the tenant it maps to. An X-Tenant-ID header must then name the same
+// tenant
+func WithTenantKeys(keys map[string]string) Option {
+	return func(h *Handler) {
+		h.tenantKeys = keys
+	}
+}
+
+// WithTenantHeader serves requests for the tenant in their X-Tenant-ID
+// header, for deployments behind a gateway that authenticates tenants and
+// sets the header
+func WithTenantHeader() Option {
+	return func(h *Handler) {
+		h.tenantHeader = true
+	}
+}
+
+// WithRequiredTenant rejects record and task requests without a tenant, so
+// no request reaches the records and tasks outside the tenants
+func WithRequiredTenant() Option {
+	return func(h *Handler) {
+		h.tenantRequired = true
+	}
+}
+
+// tenantError is a request whose tenant cannot be established
+type tenantError struct {
+	status  int
+	message string
+}
+
+// requestTenant returns the tenant of r, empty for requests without one.
+// Tenant keys take precedence over the header; without tenancy configured
+// the header is ignored. The admin token is no tenant key, admins act as
+// the tenant of the header
+func (h *Handler) requestTenant(r *http.Request) (string, *tenantError) {
+	header := strings.TrimSpace(r.Header.Get(tenantHeader))
+	admin := h.adminAuthorized(r)
+
+	if h.tenantKeys != nil && !admin {
+		if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			tenant, ok := lookupKey(h.tenantKeys, key)
+			if !ok {
+				return "", &tenantError{http.StatusUnauthorized, "Invalid tenant key"}
+			}
+			if header != "" && header != tenant {
+				return "", &tenantError{http.StatusForbidden, "X-Tenant-ID does not match the tenant key"}
+			}
+			return tenant, nil
+		}
+		if header != "" && !h.tenantHeader {
+			return "", &tenantError{http.StatusUnauthorized, "A tenant key is required to act as a tenant"}
+		}
+	}
+
+	if header == "" || !(h.tenantHeader || admin && h.tenantKeys != nil) {
+		return "", nil
+	}
+	if !service.ValidTenantID(header) {
+		return "", &tenantError{http.StatusBadRequest, "Invalid tenant ID"}
+	}
+	return header, nil
+}
+
+// withTenant confines the requests of a tenant to its records. Routes that
+// do not confine their reads and writes to a tenant (scoped false) reject
+// tenant requests, as they would expose the data of every tenant
+func (h *Handler) withTenant(scoped bool) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			tenant, tenantErr := h.requestTenant(r)
+			switch {
+			case tenantErr != nil:
+				h.writeErrorResponse(w, tenantErr.status, tenantErr.message)
+			case tenant == "" && scoped && h.tenantRequired && !h.adminAuthorized(r):
+				h.writeErrorResponse(w, http.StatusUnauthorized, "A tenant is required")
+			case tenant == "":
+				next(w, r)
+			case !scoped:
+				h.writeErrorResponse(w, http.StatusForbidden, "Tenants can only use the record endpoints")
+			default:
+				next(w, r.WithContext(service.WithTenant(r.Context(), tenant)))
+			}
+		}
+	}
+}
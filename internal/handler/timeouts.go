@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultRouteTimeout is the key of the timeout applied to unlisted routes
+const defaultRouteTimeout = "*"
+
+// ParseRouteTimeouts parses per-route timeout budgets, e.g.
+// "/records=2s,/get=500ms,/v2/records/{id}=500ms,*=5s" where "*" applies to
+// all other routes. Routes with path parameters are named as registered
+func ParseRouteTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		path, value, ok := strings.Cut(entry, "=")
+		path = strings.TrimSpace(path)
+		if !ok || (path != defaultRouteTimeout && !strings.HasPrefix(path, "/")) {
+			return nil, fmt.Errorf("invalid route timeout %q, expected /<path>=<duration>", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid route timeout %q, expected a positive duration", entry)
+		}
+		timeouts[path] = d
+	}
+	return timeouts, nil
+}
+
+// WithRouteTimeouts gives routes a time budget. Requests exceeding it get 504
+// and their context is cancelled so downstream queries stop
+func WithRouteTimeouts(timeouts map[string]time.Duration) Option {
+	return func(h *Handler) {
+		h.timeouts = timeouts
+	}
+}
+
+// routeTimeout returns the budget of a route, zero when it has none
+func (h *Handler) routeTimeout(path string) time.Duration {
+	if d, ok := h.timeouts[path]; ok {
+		return d
+	}
+	return h.timeouts[defaultRouteTimeout]
+}
+
+// withTimeout works like http.TimeoutHandler: the handler writes into a
+// buffer, which is sent only if it finishes within the route's budget.
+// Otherwise the client gets a 504 error response and the handler's late
+// writes are discarded. WebSocket connections live on past any budget
+func (h *Handler) withTimeout(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		budget := h.routeTimeout(routeOf(r))
+		if budget <= 0 || websocket.IsWebSocketUpgrade(r) {
+			next(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			dst := w.Header()
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			w.WriteHeader(tw.status)
+			_, _ = w.Write(tw.body.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			tw.timedOut = true
+			if r.Context().Err() != nil {
+				// The client is gone, nobody reads the response
+				return
+			}
+			h.writeErrorResponse(w, http.StatusGatewayTimeout, fmt.Sprintf("Request exceeded its %s time budget", budget))
+		}
+	}
+}
+
+// timeoutWriter buffers a response until withTimeout decides whether to send it
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = code
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(b)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+)
+
+func TestRouteTimeout(t *testing.T) {
+	timeouts, err := ParseRouteTimeouts("/records=20ms,*=1s")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	h := NewHandler(&fakeService{}, metrics.NewMetrics(), WithRouteTimeouts(timeouts))
+
+	cancelled := make(chan struct{})
+	slow := h.withTimeout(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+		w.WriteHeader(http.StatusOK)
+	})
+	fast := h.withTimeout(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	})
+
+	rec := serve(slow, newRequest(t, http.MethodGet, "/records", nil))
+	assertStatus(t, rec, http.StatusGatewayTimeout)
+	assertErrorContains(t, rec, "time budget")
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the handler context to be cancelled")
+	}
+
+	rec = serve(fast, newRequest(t, http.MethodGet, "/get?id=a", nil))
+	assertStatus(t, rec, http.StatusCreated)
+	if rec.Header().Get("X-Test") != "yes" || rec.Body.String() != "done" {
+		t.Errorf("Expected buffered response to be passed through, got %q", rec.Body.String())
+	}
+}
+
+func TestParseRouteTimeouts_Invalid(t *testing.T) {
+	for _, spec := range []string{"records=1s", "/records", "/records=0s", "/records=soon"} {
+		if _, err := ParseRouteTimeouts(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+// readAll returns every row of the dump
+func readAll(t *testing.T, format, dump string) []Row {
+	t.Helper()
+	reader, err := NewReader(format, strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var rows []Row
+	for {
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestReaders(t *testing.T) {
+	tests := []struct {
+		format   string
+		dump     string
+		expected []Row
+	}{
+		{
+			FormatJSONLines,
+			"{\"id\": 1, \"name\": \"Ada\"}\n\n{\"id\": \"b\"}\n",
+			[]Row{{"id": json.Number("1"), "name": "Ada"}, {"id": "b"}},
+		},
+		{
+			FormatCSV,
+			"id,name\n1,Ada\n2,\"Grace, H\"\n",
+			[]Row{{"id": "1", "name": "Ada"}, {"id": "2", "name": "Grace, H"}},
+		},
+		{
+			FormatRedisJSON,
+			`[{"user:1": "Ada", "user:2": {"name": "Grace"}}, {}, {"tags": ["a", "b"]}]`,
+			[]Row{
+				{"key": "user:1", "value": "Ada"},
+				{"key": "user:2", "value": map[string]interface{}{"name": "Grace"}},
+				{"key": "tags", "value": []interface{}{"a", "b"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if rows := readAll(t, tt.format, tt.dump); !reflect.DeepEqual(rows, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, rows)
+			}
+		})
+	}
+
+	if _, err := NewReader("rdb", strings.NewReader("")); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestMapping(t *testing.T) {
+	mapping := &Mapping{
+		IDField:   "user_id",
+		IDPrefix:  "user_",
+		Type:      "user",
+		Rename:    map[string]string{"fname": "first_name"},
+		Drop:      []string{"password"},
+		ParseJSON: true,
+	}
+
+	record, err := mapping.Map(Row{
+		"user_id":  float64(12345678),
+		"fname":    "Ada",
+		"password": "secret",
+		"address":  `{"city": "London"}`,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := &models.Record{ID: "user_12345678", Type: "user", Value: models.MustEncodeValue(map[string]interface{}{
+		"first_name": "Ada",
+		"address":    map[string]interface{}{"city": "London"},
+	})}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, record)
+	}
+
+	if _, err := mapping.Map(Row{"fname": "Ada"}); err == nil {
+		t.Error("Expected an error for a row without ID")
+	}
+	if _, err := (&Mapping{IDField: "key", ValueField: "value"}).Map(Row{"key": "k"}); err == nil {
+		t.Error("Expected an error for a row without value")
+	}
+
+	if _, err := ParseRenames("a=b,c"); err == nil {
+		t.Error("Expected an error for a rename without target")
+	}
+}
+
+// importServer records the imported records and fails the request numbered
+// failAt with a client error
+func importServer(t *testing.T, failAt int) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var ids []string
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		if requests == failAt {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var req models.ImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		for _, record := range req.Records {
+			ids = append(ids, record.ID)
+		}
+		json.NewEncoder(w).Encode(&models.ImportResult{Created: len(req.Records)})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ids...)
+	}
+}
+
+func TestLoad_Resume(t *testing.T) {
+	dump := "id,name\n1,a\n2,b\n,invalid\n3,c\n4,d\n5,e\n"
+	checkpoint := filepath.Join(t.TempDir(), "dump.checkpoint")
+	mapping := &Mapping{IDField: "id", IDPrefix: "r"}
+
+	// The second batch fails, the first stays recorded in the checkpoint
+	server, imported := importServer(t, 2)
+	opts := Options{URL: server.URL, BatchSize: 2, Input: "dump.csv", Checkpoint: checkpoint}
+
+	reader, _ := NewReader(FormatCSV, strings.NewReader(dump))
+	if _, err := Load(context.Background(), reader, mapping, opts); err == nil {
+		t.Fatal("Expected the failed batch to stop the load")
+	}
+	if ids := imported(); !reflect.DeepEqual(ids, []string{"r1", "r2"}) {
+		t.Fatalf("Expected the first batch imported, got %v", ids)
+	}
+
+	reader, _ = NewReader(FormatCSV, strings.NewReader(dump))
+	progress, err := Load(context.Background(), reader, mapping, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ids := imported(); !reflect.DeepEqual(ids, []string{"r1", "r2", "r3", "r4", "r5"}) {
+		t.Errorf("Expected the remaining records imported once, got %v", ids)
+	}
+	if progress.Rows != 6 || progress.Resumed != 2 || progress.Invalid != 1 || progress.Created != 3 {
+		t.Errorf("Expected 6 rows with 2 resumed, 1 invalid and 3 created, got %+v", progress)
+	}
+	if _, err := os.Stat(checkpoint); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the checkpoint removed after a complete load, got %v", err)
+	}
+
+	// A checkpoint of another dump is refused
+	if err := saveCheckpoint(checkpoint, "other.csv", 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	reader, _ = NewReader(FormatCSV, strings.NewReader(dump))
+	if _, err := Load(context.Background(), reader, mapping, opts); err == nil {
+		t.Error("Expected an error for a checkpoint of another dump")
+	}
+}
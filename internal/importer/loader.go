@@ -0,0 +1,288 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// Options configure how records are sent to the bulk import endpoint
+type Options struct {
+	// URL is the base URL of the service, Token its admin token
+	URL   string
+	Token string
+
+	// BatchSize is the number of records sent per import request
+	BatchSize int
+
+	Overwrite bool
+	DryRun    bool
+
+	// Input names the dump in the checkpoint, so a checkpoint is not applied
+	// to another dump. Checkpoint is the progress file, empty disables resuming
+	Input      string
+	Checkpoint string
+
+	// Failed requests are retried Retries times, waiting RetryDelay doubled
+	// after every attempt
+	Retries    int
+	RetryDelay time.Duration
+
+	// Progress is called with the totals after every batch, Invalid with
+	// every row the mapping rejects
+	Progress func(*Progress)
+	Invalid  func(row int, err error)
+
+	Client *http.Client
+
+	// Import imports a batch in process instead of posting it to URL
+	Import func(ctx context.Context, req *models.ImportRequest) (*models.ImportResult, error)
+}
+
+// Progress counts what a load has done so far
+type Progress struct {
+	// Rows is the number of dump rows processed, including rows loaded by an
+	// earlier run and skipped on resume
+	Rows    int `json:"rows"`
+	Resumed int `json:"resumed"`
+
+	// Invalid counts rows the mapping rejected
+	Invalid int `json:"invalid"`
+	Batches int `json:"batches"`
+	models.ImportResult
+}
+
+// checkpoint is the progress file written after every batch
+type checkpoint struct {
+	Input string `json:"input"`
+	Rows  int    `json:"rows"`
+}
+
+// Load reads every row, maps it to a record and imports the records in
+// batches. With a checkpoint file the rows imported by an interrupted run
+// are skipped; the file is removed once the whole dump is loaded
+func Load(ctx context.Context, reader Reader, mapping *Mapping, opts Options) (*Progress, error) {
+	if opts.BatchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", opts.BatchSize)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: time.Minute}
+	}
+
+	progress := &Progress{ImportResult: models.ImportResult{DryRun: opts.DryRun}}
+
+	skip, err := loadCheckpoint(opts.Checkpoint, opts.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := make([]*models.Record, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) > 0 {
+			result, err := importBatch(ctx, opts, batch)
+			if err != nil {
+				return err
+			}
+			addResult(&progress.ImportResult, result)
+			progress.Batches++
+			batch = batch[:0]
+		}
+		if err := saveCheckpoint(opts.Checkpoint, opts.Input, progress.Rows); err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return progress, fmt.Errorf("failed to read row %d: %w", progress.Rows+1, err)
+		}
+		progress.Rows++
+
+		if progress.Rows <= skip {
+			progress.Resumed++
+			continue
+		}
+
+		record, err := mapping.Map(row)
+		if err != nil {
+			progress.Invalid++
+			if opts.Invalid != nil {
+				opts.Invalid(progress.Rows, err)
+			}
+		} else {
+			batch = append(batch, record)
+		}
+
+		if len(batch) == opts.BatchSize {
+			if err := flush(); err != nil {
+				return progress, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return progress, err
+	}
+	if opts.Checkpoint != "" {
+		if err := os.Remove(opts.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return progress, fmt.Errorf("failed to remove checkpoint: %w", err)
+		}
+	}
+	return progress, nil
+}
+
+// importBatch posts a batch to /admin/import, retrying network errors and
+// server errors. With opts.Import the batch is imported in process, retrying
+// every error
+func importBatch(ctx context.Context, opts Options, records []*models.Record) (*models.ImportResult, error) {
+	req := &models.ImportRequest{
+		Records:   records,
+		Overwrite: opts.Overwrite,
+		DryRun:    opts.DryRun,
+	}
+	send := func() (*models.ImportResult, bool, error) {
+		result, err := opts.Import(ctx, req)
+		return result, ctx.Err() == nil, err
+	}
+
+	if opts.Import == nil {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode batch: %w", err)
+		}
+		endpoint := strings.TrimRight(opts.URL, "/") + "/admin/import"
+		send = func() (*models.ImportResult, bool, error) {
+			return postBatch(ctx, opts, endpoint, body)
+		}
+	}
+
+	delay := opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		result, retry, err := send()
+		if err == nil {
+			return result, nil
+		}
+		if !retry || attempt >= opts.Retries {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// postBatch sends one import request and reports whether a failure is worth
+// retrying
+func postBatch(ctx context.Context, opts Options, endpoint string, body []byte) (*models.ImportResult, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid service URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, fmt.Errorf("import request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, resp.StatusCode >= 500,
+			fmt.Errorf("import returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var result models.ImportResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, false, fmt.Errorf("invalid import response: %w", err)
+	}
+	return &result, false, nil
+}
+
+// addResult adds the counts of a batch to the totals, keeping the first
+// errors
+func addResult(total, batch *models.ImportResult) {
+	total.Created += batch.Created
+	total.Updated += batch.Updated
+	total.Unchanged += batch.Unchanged
+	total.Skipped += batch.Skipped
+	total.Failed += batch.Failed
+	for _, importErr := range batch.Errors {
+		if len(total.Errors) < 100 {
+			total.Errors = append(total.Errors, importErr)
+		}
+	}
+}
+
+// loadCheckpoint returns the rows loaded by an earlier run of the same input
+func loadCheckpoint(path, input string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return 0, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if cp.Input != input {
+		return 0, fmt.Errorf("checkpoint %s belongs to %q, not %q; remove it to start over", path, cp.Input, input)
+	}
+	return cp.Rows, nil
+}
+
+// saveCheckpoint atomically records the rows processed so far
+func saveCheckpoint(path, input string, rows int) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(checkpoint{Input: input, Rows: rows})
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mit-service/internal/models"
+)
+
+// Mapping turns dump rows into records
+type Mapping struct {
+	// IDField is the row field holding the record ID, IDPrefix is prepended
+	IDField  string
+	IDPrefix string
+
+	// ValueField is the row field holding the value; when empty the other
+	// fields of the row form an object value
+	ValueField string
+
+	// Type is set as the record type of every record
+	Type string
+
+	// Rename and Drop rename and remove fields of object values
+	Rename map[string]string
+	Drop   []string
+
+	// ParseJSON decodes string values, and string fields of object values,
+	// that hold JSON objects or arrays
+	ParseJSON bool
+}
+
+// ParseRenames parses field renames in the form "old=new,old2=new2"
+func ParseRenames(spec string) (map[string]string, error) {
+	renames := make(map[string]string)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			return nil, fmt.Errorf("invalid rename %q, expected old=new", part)
+		}
+		renames[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return renames, nil
+}
+
+// Map returns the record for a row
+func (m *Mapping) Map(row Row) (*models.Record, error) {
+	rawID, ok := row[m.IDField]
+	if !ok {
+		return nil, fmt.Errorf("missing ID field %q", m.IDField)
+	}
+	id := formatID(rawID)
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("empty ID field %q", m.IDField)
+	}
+
+	var value interface{}
+	if m.ValueField != "" {
+		if value, ok = row[m.ValueField]; !ok {
+			return nil, fmt.Errorf("record %s: missing value field %q", id, m.ValueField)
+		}
+	} else {
+		fields := make(map[string]interface{}, len(row))
+		for name, field := range row {
+			if name != m.IDField {
+				fields[name] = field
+			}
+		}
+		value = fields
+	}
+
+	value = m.transform(value)
+	if value == nil {
+		return nil, fmt.Errorf("record %s: empty value", id)
+	}
+
+	encoded, err := models.EncodeValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("record %s: %w", id, err)
+	}
+	return &models.Record{ID: m.IDPrefix + id, Type: m.Type, Value: encoded}, nil
+}
+
+// transform applies JSON decoding, renames and drops to a value
+func (m *Mapping) transform(value interface{}) interface{} {
+	if m.ParseJSON {
+		value = decodeJSONString(value)
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	for _, name := range m.Drop {
+		delete(fields, name)
+	}
+	for from, to := range m.Rename {
+		if field, ok := fields[from]; ok {
+			delete(fields, from)
+			fields[to] = field
+		}
+	}
+	if m.ParseJSON {
+		for name, field := range fields {
+			fields[name] = decodeJSONString(field)
+		}
+	}
+	return fields
+}
+
+// decodeJSONString decodes a string holding a JSON object or array and
+// returns other values unchanged
+func decodeJSONString(value interface{}) interface{} {
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return value
+	}
+
+	var decoded interface{}
+	if err := models.UnmarshalValue([]byte(trimmed), &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
+
+// formatID renders an ID field, keeping integral numbers free of exponents
+func formatID(raw interface{}) string {
+	switch v := raw.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		if f, err := v.Float64(); err == nil && strings.ContainsAny(string(v), "eE") {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,180 @@
+// Package importer loads legacy key-value dumps into the service through its
+// bulk import endpoint
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"mit-service/internal/models"
+)
+
+// Supported dump formats
+const (
+	FormatJSONLines = "jsonl"
+	FormatCSV       = "csv"
+
+	// FormatRedisJSON is the output of redis-rdb-tools' `rdb --command json`,
+	// an array with one object of keys and values per Redis database
+	FormatRedisJSON = "redis-json"
+)
+
+// Row is one entry of a dump, decoded into field names and values
+type Row map[string]interface{}
+
+// Reader reads the rows of a dump one at a time
+type Reader interface {
+	// Next returns the next row, io.EOF after the last one
+	Next() (Row, error)
+}
+
+// NewReader returns a reader for the dump format
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatJSONLines:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		return &jsonLinesReader{scanner: scanner}, nil
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatRedisJSON:
+		return newRedisJSONReader(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected %s, %s or %s",
+			format, FormatJSONLines, FormatCSV, FormatRedisJSON)
+	}
+}
+
+// jsonLinesReader reads one JSON object per line, skipping blank lines
+type jsonLinesReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *jsonLinesReader) Next() (Row, error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var row Row
+		if err := models.UnmarshalValue([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return row, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// csvReader reads rows keyed by the column names of the header line
+type csvReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("csv dump has no header line")
+		}
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	return &csvReader{reader: reader, header: header}, nil
+}
+
+func (r *csvReader) Next() (Row, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != len(r.header) {
+		line, _ := r.reader.FieldPos(0)
+		return nil, fmt.Errorf("line %d: expected %d columns, got %d", line, len(r.header), len(fields))
+	}
+
+	row := make(Row, len(fields))
+	for i, name := range r.header {
+		row[name] = fields[i]
+	}
+	return row, nil
+}
+
+// redisJSONReader streams the keys of an rdb-tools JSON export as rows with
+// the fields "key" and "value"; hashes become objects, lists and sets arrays
+type redisJSONReader struct {
+	decoder *json.Decoder
+	inDB    bool
+}
+
+func newRedisJSONReader(r io.Reader) (*redisJSONReader, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := expectDelim(decoder, '['); err != nil {
+		return nil, fmt.Errorf("redis json export: %w", err)
+	}
+	return &redisJSONReader{decoder: decoder}, nil
+}
+
+func (r *redisJSONReader) Next() (Row, error) {
+	for {
+		if !r.inDB {
+			if !r.decoder.More() {
+				return nil, io.EOF
+			}
+			if err := expectDelim(r.decoder, '{'); err != nil {
+				return nil, fmt.Errorf("redis json export: %w", err)
+			}
+			r.inDB = true
+		}
+
+		if !r.decoder.More() {
+			// Consume the closing brace of the database object
+			if _, err := r.decoder.Token(); err != nil {
+				return nil, fmt.Errorf("redis json export: %w", err)
+			}
+			r.inDB = false
+			continue
+		}
+
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("redis json export: %w", err)
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("redis json export: expected a key, got %v", token)
+		}
+
+		var value interface{}
+		if err := r.decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("redis json export: value of %q: %w", key, err)
+		}
+		return Row{"key": key, "value": value}, nil
+	}
+}
+
+// expectDelim reads the next token and checks it is the delimiter
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Anomaly signals
+const (
+	SignalErrorRate         = "error_rate"         // failed share of HTTP requests
+	SignalRequestThroughput = "request_throughput" // HTTP requests per second
+	SignalTaskThroughput    = "task_throughput"    // completed tasks per second
+	SignalQueueGrowth       = "queue_growth"       // queue depth change per second
+)
+
+// Anomaly event types
+const (
+	AnomalyStarted  = "started"
+	AnomalyResolved = "resolved"
+)
+
+// Anomaly is a signal deviating from its rolling baseline
+type Anomaly struct {
+	Signal   string    `json:"signal"`
+	Kind     string    `json:"kind"` // spike or collapse
+	Value    float64   `json:"value"`
+	Baseline float64   `json:"baseline"`
+	Since    time.Time `json:"since"`
+}
+
+// AnomalyEvent is passed to hooks when an anomaly starts or resolves
+type AnomalyEvent struct {
+	Type    string  `json:"type"`
+	Anomaly Anomaly `json:"anomaly"`
+}
+
+// AnomalyHook receives anomaly events, it must not block for long
+type AnomalyHook func(AnomalyEvent)
+
+// AnomalyConfig configures the detector
+type AnomalyConfig struct {
+	Interval    time.Duration // sampling interval
+	Sensitivity float64       // standard deviations from the baseline counted as anomalous
+	Baseline    int           // samples the rolling baseline spans
+	WarmUp      int           // samples before detection starts
+}
+
+// baseline is an exponentially weighted mean and variance
+type baseline struct {
+	mean, variance float64
+	samples        int
+}
+
+func (b *baseline) update(value, alpha float64) {
+	if b.samples == 0 {
+		b.mean = value
+	} else {
+		diff := value - b.mean
+		b.mean += alpha * diff
+		b.variance = (1 - alpha) * (b.variance + alpha*diff*diff)
+	}
+	b.samples++
+}
+
+// deviation returns how many standard deviations value is from the mean.
+// A floor on the deviation keeps flat baselines from flagging noise
+func (b *baseline) deviation(value, floor float64) float64 {
+	std := math.Max(math.Sqrt(b.variance), floor)
+	return (value - b.mean) / std
+}
+
+// signalRule decides when a deviation of a signal is worth reporting
+type signalRule struct {
+	kind     string  // spike: above baseline, collapse: below
+	minDelta float64 // minimum absolute change from the baseline
+	floor    float64 // minimum standard deviation
+}
+
+var signalRules = map[string]signalRule{
+	SignalErrorRate:         {kind: "spike", minDelta: 0.05, floor: 0.01},
+	SignalRequestThroughput: {kind: "collapse", minDelta: 1, floor: 0.5},
+	SignalTaskThroughput:    {kind: "collapse", minDelta: 1, floor: 0.5},
+	SignalQueueGrowth:       {kind: "spike", minDelta: 1, floor: 0.5},
+}
+
+// anomalySample holds the counters read at one sampling tick
+type anomalySample struct {
+	at             time.Time
+	requests       int64
+	failedRequests int64
+	completedTasks int64
+	queueDepth     int64
+}
+
+// AnomalyDetector samples the metrics periodically and compares throughput,
+// error rate and queue growth against rolling baselines, reporting sudden
+// deviations that the static thresholds of GetHealthStatus miss
+type AnomalyDetector struct {
+	metrics *Metrics
+	cfg     AnomalyConfig
+	hooks   []AnomalyHook
+
+	mu        sync.Mutex
+	last      *anomalySample
+	baselines map[string]*baseline
+	active    map[string]*Anomaly
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// NewAnomalyDetector creates a detector reporting to hooks
+func NewAnomalyDetector(m *Metrics, cfg AnomalyConfig, hooks ...AnomalyHook) *AnomalyDetector {
+	if cfg.Baseline < 2 {
+		cfg.Baseline = 30
+	}
+	if cfg.Sensitivity <= 0 {
+		cfg.Sensitivity = 3
+	}
+
+	d := &AnomalyDetector{
+		metrics:   m,
+		cfg:       cfg,
+		hooks:     hooks,
+		baselines: make(map[string]*baseline),
+		active:    make(map[string]*Anomaly),
+		stopCh:    make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.anomalies = d
+	m.mu.Unlock()
+	return d
+}
+
+// Start samples on every interval until Stop
+func (d *AnomalyDetector) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stopCh:
+				return
+			case now := <-ticker.C:
+				d.observe(d.sample(now))
+			}
+		}
+	}()
+}
+
+// Stop stops sampling
+func (d *AnomalyDetector) Stop() {
+	d.once.Do(func() { close(d.stopCh) })
+	d.wg.Wait()
+}
+
+func (d *AnomalyDetector) sample(now time.Time) anomalySample {
+	return anomalySample{
+		at:             now,
+		requests:       atomic.LoadInt64(&d.metrics.totalRequests),
+		failedRequests: atomic.LoadInt64(&d.metrics.failedRequests),
+		completedTasks: atomic.LoadInt64(&d.metrics.completedTasks),
+		queueDepth:     atomic.LoadInt64(&d.metrics.queueDepth),
+	}
+}
+
+// observe turns a sample into signal values and checks them
+func (d *AnomalyDetector) observe(s anomalySample) {
+	d.mu.Lock()
+	last := d.last
+	d.last = &s
+	d.mu.Unlock()
+
+	if last == nil {
+		return
+	}
+	seconds := s.at.Sub(last.at).Seconds()
+	if seconds <= 0 {
+		return
+	}
+
+	values := map[string]float64{
+		SignalRequestThroughput: float64(s.requests-last.requests) / seconds,
+		SignalTaskThroughput:    float64(s.completedTasks-last.completedTasks) / seconds,
+		SignalQueueGrowth:       float64(s.queueDepth-last.queueDepth) / seconds,
+	}
+	// Error rates of a handful of requests are noise
+	if requests := s.requests - last.requests; requests >= 10 {
+		values[SignalErrorRate] = float64(s.failedRequests-last.failedRequests) / float64(requests)
+	}
+
+	var events []AnomalyEvent
+	for _, signal := range sortedSignals(values) {
+		if event := d.check(signal, values[signal], s.at); event != nil {
+			events = append(events, *event)
+		}
+	}
+
+	for _, event := range events {
+		log.Printf("Anomaly %s: %s %s (value %.3f, baseline %.3f)",
+			event.Type, event.Anomaly.Signal, event.Anomaly.Kind, event.Anomaly.Value, event.Anomaly.Baseline)
+		for _, hook := range d.hooks {
+			hook(event)
+		}
+	}
+}
+
+// check compares a value with its baseline and returns the event when an
+// anomaly starts or resolves. Anomalous values update the baseline slowly so
+// a lasting new level is eventually accepted as normal
+func (d *AnomalyDetector) check(signal string, value float64, now time.Time) *AnomalyEvent {
+	rule := signalRules[signal]
+	alpha := 2 / float64(d.cfg.Baseline+1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b := d.baselines[signal]
+	if b == nil {
+		b = &baseline{}
+		d.baselines[signal] = b
+	}
+
+	anomalous := false
+	if b.samples >= d.cfg.WarmUp {
+		deviation := b.deviation(value, rule.floor)
+		delta := value - b.mean
+		if rule.kind == "collapse" {
+			deviation, delta = -deviation, -delta
+		}
+		anomalous = deviation >= d.cfg.Sensitivity && delta >= rule.minDelta
+	}
+
+	var event *AnomalyEvent
+	active := d.active[signal]
+	switch {
+	case anomalous && active == nil:
+		active = &Anomaly{Signal: signal, Kind: rule.kind, Value: value, Baseline: b.mean, Since: now}
+		d.active[signal] = active
+		event = &AnomalyEvent{Type: AnomalyStarted, Anomaly: *active}
+	case anomalous:
+		active.Value = value
+	case active != nil:
+		delete(d.active, signal)
+		resolved := *active
+		resolved.Value = value
+		event = &AnomalyEvent{Type: AnomalyResolved, Anomaly: resolved}
+	}
+
+	if anomalous {
+		alpha /= 4
+	}
+	b.update(value, alpha)
+
+	return event
+}
+
+// Active returns the ongoing anomalies
+func (d *AnomalyDetector) Active() []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	anomalies := make([]Anomaly, 0, len(d.active))
+	for _, a := range d.active {
+		anomalies = append(anomalies, *a)
+	}
+	sort.Slice(anomalies, func(i, j int) bool { return anomalies[i].Signal < anomalies[j].Signal })
+	return anomalies
+}
+
+// Anomalies returns the ongoing anomalies, none when detection is off
+func (m *Metrics) Anomalies() []Anomaly {
+	m.mu.RLock()
+	d := m.anomalies
+	m.mu.RUnlock()
+
+	if d == nil {
+		return []Anomaly{}
+	}
+	return d.Active()
+}
+
+// WebhookHook posts every anomaly event as JSON to url
+func WebhookHook(url string, timeout time.Duration) AnomalyHook {
+	client := &http.Client{Timeout: timeout}
+	return func(event AnomalyEvent) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+
+		// Posted in the background so a slow receiver does not delay sampling
+		go func() {
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("Anomaly webhook failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				log.Printf("Anomaly webhook returned %s", resp.Status)
+			}
+		}()
+	}
+}
+
+func sortedSignals(values map[string]float64) []string {
+	signals := make([]string, 0, len(values))
+	for signal := range values {
+		signals = append(signals, signal)
+	}
+	sort.Strings(signals)
+	return signals
+}
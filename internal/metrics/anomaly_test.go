@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnomalyDetector_ErrorSpikeAndThroughputCollapse(t *testing.T) {
+	m := NewMetrics()
+
+	var events []AnomalyEvent
+	d := NewAnomalyDetector(m, AnomalyConfig{Interval: time.Second, Sensitivity: 3, Baseline: 10, WarmUp: 5},
+		func(e AnomalyEvent) { events = append(events, e) })
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var s anomalySample
+	step := func(requests, failed int64) {
+		s.at = s.at.Add(time.Second)
+		s.requests += requests
+		s.failedRequests += failed
+		d.observe(s)
+	}
+	s.at = start
+	d.observe(s)
+
+	// Steady 100 requests/s with 1% errors
+	for i := 0; i < 20; i++ {
+		step(100, 1)
+	}
+	if len(events) != 0 {
+		t.Fatalf("Expected no anomalies at steady state, got %+v", events)
+	}
+
+	// Errors jump to 30%
+	step(100, 30)
+	if len(events) != 1 || events[0].Type != AnomalyStarted || events[0].Anomaly.Signal != SignalErrorRate {
+		t.Fatalf("Expected an error rate anomaly, got %+v", events)
+	}
+	if active := m.Anomalies(); len(active) != 1 {
+		t.Errorf("Expected 1 active anomaly, got %+v", active)
+	}
+
+	// Back to normal resolves it
+	step(100, 1)
+	if len(events) != 2 || events[1].Type != AnomalyResolved {
+		t.Fatalf("Expected the anomaly to resolve, got %+v", events)
+	}
+
+	// Traffic collapses
+	step(5, 0)
+	last := events[len(events)-1]
+	if last.Anomaly.Signal != SignalRequestThroughput || last.Anomaly.Kind != "collapse" {
+		t.Errorf("Expected a throughput collapse, got %+v", last)
+	}
+}
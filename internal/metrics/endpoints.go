@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// otherEndpoint and otherMethod label requests to paths that are not
+// routes and with methods HTTP does not define, so scanners probing random
+// URLs do not add a series per URL
+const (
+	otherEndpoint = "other"
+	otherMethod   = "OTHER"
+)
+
+// knownMethods are the methods recorded under their own label
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// endpointSet is the set of paths recorded under their own label
+type endpointSet struct {
+	mu    sync.RWMutex
+	known map[string]bool
+
+	// patterns are the paths with wildcard segments such as {id}, split
+	// into segments. Requests matching one are recorded under the pattern
+	patterns [][]string
+}
+
+// RegisterEndpoints adds paths to the endpoints labelled by their path.
+// Once any is registered, requests to other paths are recorded as "other".
+// Paths with ServeMux wildcards, e.g. /records/{id}/history, label the
+// requests they match
+func (m *Metrics) RegisterEndpoints(paths ...string) {
+	m.endpoints.mu.Lock()
+	defer m.endpoints.mu.Unlock()
+
+	if m.endpoints.known == nil {
+		m.endpoints.known = make(map[string]bool)
+	}
+	for _, path := range paths {
+		if strings.Contains(path, "{") && !m.endpoints.known[path] {
+			m.endpoints.patterns = append(m.endpoints.patterns, strings.Split(path, "/"))
+		}
+		m.endpoints.known[path] = true
+	}
+}
+
+// matchPattern returns the registered pattern matching path, mu must be held
+func (e *endpointSet) matchPattern(path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	for _, pattern := range e.patterns {
+		if len(pattern) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, segment := range pattern {
+			if !strings.HasPrefix(segment, "{") && segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return strings.Join(pattern, "/"), true
+		}
+	}
+	return "", false
+}
+
+// endpointLabel returns the label of the endpoint of a request path or
+// URI: the path without query string when it is registered, "other"
+// otherwise. Before any endpoint is registered every path is its own label
+func (m *Metrics) endpointLabel(endpoint string) (string, bool) {
+	endpoint, _, _ = strings.Cut(endpoint, "?")
+
+	m.endpoints.mu.RLock()
+	defer m.endpoints.mu.RUnlock()
+
+	if m.endpoints.known == nil || m.endpoints.known[endpoint] {
+		return endpoint, false
+	}
+	if pattern, ok := m.endpoints.matchPattern(endpoint); ok {
+		return pattern, false
+	}
+	return otherEndpoint, true
+}
+
+// methodLabel returns the label of a request method
+func methodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return otherMethod
+}
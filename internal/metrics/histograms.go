@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures the Prometheus metrics created by NewMetrics
+type Option func(*histogramOptions)
+
+// histogramOptions are the bucket layouts of the duration histograms
+type histogramOptions struct {
+	httpBuckets  []float64
+	taskBuckets  []float64
+	nativeFactor float64
+}
+
+// WithHTTPDurationBuckets sets the buckets of the HTTP request duration
+// histogram, upper bounds in seconds
+func WithHTTPDurationBuckets(buckets []float64) Option {
+	return func(o *histogramOptions) {
+		o.httpBuckets = buckets
+	}
+}
+
+// WithTaskDurationBuckets sets the buckets of the task duration histogram,
+// upper bounds in seconds
+func WithTaskDurationBuckets(buckets []float64) Option {
+	return func(o *histogramOptions) {
+		o.taskBuckets = buckets
+	}
+}
+
+// WithNativeHistograms also exposes the duration histograms as native
+// histograms, whose buckets grow by at most factor (e.g. 1.1) from one to
+// the next. Scrapers negotiating the protobuf format read them in full
+// resolution, the classic buckets stay for the others
+func WithNativeHistograms(factor float64) Option {
+	return func(o *histogramOptions) {
+		o.nativeFactor = factor
+	}
+}
+
+// durationOpts returns the options of a duration histogram, with the
+// classic buckets or prometheus.DefBuckets when none are set
+func (o *histogramOptions) durationOpts(name, help string, buckets []float64) prometheus.HistogramOpts {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	opts := prometheus.HistogramOpts{
+		Name:    name,
+		Help:    help,
+		Buckets: buckets,
+	}
+	if o.nativeFactor > 1 {
+		opts.NativeHistogramBucketFactor = o.nativeFactor
+		opts.NativeHistogramMaxBucketNumber = 160
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	return opts
+}
+
+// ParseBuckets parses comma-separated histogram bucket upper bounds,
+// durations ("1ms,2.5ms,5ms") or seconds ("0.001,0.0025"). An empty spec
+// returns nil, the default buckets
+func ParseBuckets(spec string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		bound, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			d, durationErr := time.ParseDuration(field)
+			if durationErr != nil {
+				return nil, fmt.Errorf("invalid bucket %q: expected a duration or seconds", field)
+			}
+			bound = d.Seconds()
+		}
+
+		if bound <= 0 {
+			return nil, fmt.Errorf("invalid bucket %q: must be positive", field)
+		}
+		if len(buckets) > 0 && bound <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("invalid bucket %q: buckets must be increasing", field)
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets, nil
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected []float64
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"1ms, 2.5ms,5ms,1s", []float64{0.001, 0.0025, 0.005, 1}, false},
+		{"0.001,0.01,2", []float64{0.001, 0.01, 2}, false},
+		{"5ms,1ms", nil, true},
+		{"1ms,1ms", nil, true},
+		{"0", nil, true},
+		{"soon", nil, true},
+	}
+
+	for _, tt := range tests {
+		buckets, err := ParseBuckets(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected error %v, got %v", tt.spec, tt.wantErr, err)
+			continue
+		}
+		if !reflect.DeepEqual(buckets, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.spec, tt.expected, buckets)
+		}
+	}
+}
+
+func TestHistogramOptions(t *testing.T) {
+	var o histogramOptions
+	opts := o.durationOpts("d", "help", nil)
+	if !reflect.DeepEqual(opts.Buckets, prometheus.DefBuckets) || opts.NativeHistogramBucketFactor != 0 {
+		t.Errorf("Expected the default buckets only, got %+v", opts)
+	}
+
+	for _, opt := range []Option{WithTaskDurationBuckets([]float64{0.001, 0.005}), WithNativeHistograms(1.1)} {
+		opt(&o)
+	}
+	opts = o.durationOpts("d", "help", o.taskBuckets)
+	if !reflect.DeepEqual(opts.Buckets, []float64{0.001, 0.005}) || opts.NativeHistogramBucketFactor != 1.1 {
+		t.Errorf("Expected the task buckets and native histograms, got %+v", opts)
+	}
+}
@@ -26,17 +26,50 @@ type Metrics struct {
 	totalTaskTime     int64 // in milliseconds
 	tasksPerSecond    float64
 	avgTaskTime       float64
+	totalTaskLag      int64 // in microseconds, of successfully applied tasks
+	appliedTasks      int64
+	oldestPendingAge  int64 // in nanoseconds
 	queueDepth        int64
 	maxQueueDepth     int64
+	batchSize         int64
+	throttleEvents    int64
 	workerUtilization float64
+	workerUtilizations []float64
 	lastTaskTime      time.Time
 
+	// Retention metrics
+	retentionDeleted int64
+
+	// Load shedding metrics, including concurrency limit rejections
+	shedRequests int64
+
 	// System metrics
 	startTime      time.Time
 	goroutineCount int
 	memoryUsage    uint64
 	cpuUsage       float64
 
+	// Repository metrics
+	repository repositoryStats
+
+	// Database connection pool metrics
+	pools poolStats
+
+	// endpoints are the request paths recorded under their own label
+	endpoints endpointSet
+
+	// tenants are the tenants recorded under their own label
+	tenants tenantSet
+
+	// operations are the success rates of the registered operations
+	operations operationSet
+
+	// slos are the tracked service level objectives
+	slos []*sloCounter
+
+	// anomalies detects deviations from rolling baselines, nil when off
+	anomalies *AnomalyDetector
+
 	mu                sync.RWMutex
 	lastMetricsUpdate time.Time
 
@@ -44,12 +77,14 @@ type Metrics struct {
 	prometheus *PrometheusMetrics
 }
 
-// NewMetrics creates a new metrics instance
-func NewMetrics() *Metrics {
+// NewMetrics creates a new metrics instance. Options apply to the Prometheus
+// metrics, which are registered once per process: the first instance
+// decides their buckets
+func NewMetrics(opts ...Option) *Metrics {
 	return &Metrics{
 		startTime:         time.Now(),
 		lastMetricsUpdate: time.Now(),
-		prometheus:        NewPrometheusMetrics(),
+		prometheus:        NewPrometheusMetrics(opts...),
 	}
 }
 
@@ -70,27 +105,58 @@ func (m *Metrics) RecordHTTPRequest(duration time.Duration, success bool) {
 	m.updateHTTPMetrics()
 }
 
-// RecordHTTPRequestWithDetails records an HTTP request with detailed information for Prometheus
-func (m *Metrics) RecordHTTPRequestWithDetails(method, endpoint string, statusCode int, duration time.Duration) {
+// RecordHTTPRequestWithDetails records an HTTP request with detailed information for Prometheus,
+// size being the bytes of the response body
+func (m *Metrics) RecordHTTPRequestWithDetails(method, endpoint string, statusCode int, size int64, duration time.Duration) {
+	endpoint, collapsed := m.endpointLabel(endpoint)
+
 	// Update internal metrics
 	success := statusCode >= 200 && statusCode < 400
 	m.RecordHTTPRequest(duration, success)
+	m.recordSLOEvent(SLOKindHTTP, endpoint, statusCode < 500, duration)
+	m.recordOperation(endpoint, statusCode < 500)
 	
 	// Update Prometheus metrics
 	if m.prometheus != nil {
-		m.prometheus.RecordHTTPRequest(method, endpoint, statusCode, duration)
-		m.prometheus.SetActiveConnections(atomic.LoadInt64(&m.activeConnections))
+		m.prometheus.RecordHTTPRequest(methodLabel(method), endpoint, statusCode, size, duration)
+		if collapsed {
+			m.prometheus.RecordCollapsedPath()
+		}
 	}
 }
 
-// IncrementActiveConnections increments active connection count
+// IncrementInFlight counts a request of endpoint as being served
+func (m *Metrics) IncrementInFlight(endpoint string) {
+	if m.prometheus != nil {
+		endpoint, _ = m.endpointLabel(endpoint)
+		m.prometheus.AddHTTPInFlight(endpoint, 1)
+	}
+}
+
+// DecrementInFlight counts a request of endpoint as served
+func (m *Metrics) DecrementInFlight(endpoint string) {
+	if m.prometheus != nil {
+		endpoint, _ = m.endpointLabel(endpoint)
+		m.prometheus.AddHTTPInFlight(endpoint, -1)
+	}
+}
+
+// IncrementActiveConnections increments active connection count. The
+// Prometheus gauge is set from the same counter, so both always agree
 func (m *Metrics) IncrementActiveConnections() {
-	atomic.AddInt64(&m.activeConnections, 1)
+	m.setActiveConnections(atomic.AddInt64(&m.activeConnections, 1))
 }
 
 // DecrementActiveConnections decrements active connection count
 func (m *Metrics) DecrementActiveConnections() {
-	atomic.AddInt64(&m.activeConnections, -1)
+	m.setActiveConnections(atomic.AddInt64(&m.activeConnections, -1))
+}
+
+// setActiveConnections updates the Prometheus gauge of active connections
+func (m *Metrics) setActiveConnections(count int64) {
+	if m.prometheus != nil {
+		m.prometheus.SetActiveConnections(count)
+	}
 }
 
 // updateHTTPMetrics updates calculated HTTP metrics
@@ -151,6 +217,42 @@ func (m *Metrics) RecordTaskExecutionWithDetails(operation string, duration time
 	}
 }
 
+// RecordTaskCompletion records a task reaching its final state, with the
+// latency from enqueue to completion. The latency of applied tasks is the
+// inbox lag, the delay asynchronous writes take to become visible
+func (m *Metrics) RecordTaskCompletion(operation string, latency time.Duration, success bool) {
+	m.recordSLOEvent(SLOKindTask, operation, success, latency)
+	if !success {
+		return
+	}
+
+	atomic.AddInt64(&m.totalTaskLag, latency.Microseconds())
+	atomic.AddInt64(&m.appliedTasks, 1)
+	if m.prometheus != nil {
+		m.prometheus.ObserveTaskLag(operation, latency)
+	}
+}
+
+// SetOldestPendingAge sets the age of the oldest pending task, zero
+// without a backlog
+func (m *Metrics) SetOldestPendingAge(age time.Duration) {
+	atomic.StoreInt64(&m.oldestPendingAge, int64(age))
+
+	if m.prometheus != nil {
+		m.prometheus.SetOldestPendingAge(age)
+	}
+}
+
+// avgTaskLag returns the average time in milliseconds from enqueueing a
+// task to applying it
+func (m *Metrics) avgTaskLag() float64 {
+	applied := atomic.LoadInt64(&m.appliedTasks)
+	if applied == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&m.totalTaskLag)) / 1000 / float64(applied)
+}
+
 // SetQueueDepth sets the current queue depth
 func (m *Metrics) SetQueueDepth(depth int64) {
 	atomic.StoreInt64(&m.queueDepth, depth)
@@ -170,6 +272,220 @@ func (m *Metrics) SetQueueDepth(depth int64) {
 	}
 }
 
+// SetBatchSize sets the current inbox worker batch size
+func (m *Metrics) SetBatchSize(size int) {
+	atomic.StoreInt64(&m.batchSize, int64(size))
+
+	if m.prometheus != nil {
+		m.prometheus.SetBatchSize(size)
+	}
+}
+
+// RecordThrottleEvent records that the inbox worker backed off due to resource pressure
+func (m *Metrics) RecordThrottleEvent(reason string) {
+	atomic.AddInt64(&m.throttleEvents, 1)
+
+	if m.prometheus != nil {
+		m.prometheus.RecordThrottleEvent(reason)
+	}
+}
+
+// RecordCoalescedTask records an update task superseded by a later update
+// to the same record
+func (m *Metrics) RecordCoalescedTask() {
+	if m.prometheus != nil {
+		m.prometheus.RecordCoalescedTask()
+	}
+}
+
+// RecordRetention records records deleted by a retention rule, or matched
+// by it in dry-run mode
+func (m *Metrics) RecordRetention(prefix string, dryRun bool, count int) {
+	if !dryRun {
+		atomic.AddInt64(&m.retentionDeleted, int64(count))
+	}
+
+	if m.prometheus != nil {
+		m.prometheus.RecordRetention(prefix, dryRun, count)
+	}
+}
+
+// RecordShedRequest records a request rejected by load shedding
+func (m *Metrics) RecordShedRequest(endpoint, priority string) {
+	atomic.AddInt64(&m.shedRequests, 1)
+
+	if m.prometheus != nil {
+		endpoint, _ = m.endpointLabel(endpoint)
+		m.prometheus.RecordShedRequest(endpoint, priority)
+	}
+}
+
+// RecordConcurrencyRejection records a request rejected by a route concurrency limit
+func (m *Metrics) RecordConcurrencyRejection(endpoint string) {
+	atomic.AddInt64(&m.shedRequests, 1)
+
+	if m.prometheus != nil {
+		endpoint, _ = m.endpointLabel(endpoint)
+		m.prometheus.RecordConcurrencyRejection(endpoint)
+	}
+}
+
+// RecordEnrichment records the outcome of an enrichment call: success,
+// error or circuit_open
+func (m *Metrics) RecordEnrichment(status string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordEnrichment(status)
+	}
+}
+
+// SetEnrichmentCircuitOpen records whether the enrichment circuit breaker is open
+func (m *Metrics) SetEnrichmentCircuitOpen(open bool) {
+	if m.prometheus != nil {
+		m.prometheus.SetEnrichmentCircuitOpen(open)
+	}
+}
+
+// SetTableStats records the latest size and bloat estimates of a table
+func (m *Metrics) SetTableStats(table string, totalBytes, indexBytes, liveTuples, deadTuples int64) {
+	if m.prometheus != nil {
+		m.prometheus.SetTableStats(table, totalBytes, indexBytes, liveTuples, deadTuples)
+	}
+}
+
+// SetIntegrityResult records the outcome of a completed integrity verification
+func (m *Metrics) SetIntegrityResult(mismatched, unhashed int, finishedAt time.Time) {
+	if m.prometheus != nil {
+		m.prometheus.SetIntegrityResult(mismatched, unhashed, finishedAt)
+	}
+}
+
+// SetReplicationLag records how far replication trails the change stream
+func (m *Metrics) SetReplicationLag(lag time.Duration) {
+	if m.prometheus != nil {
+		m.prometheus.SetReplicationLag(lag)
+	}
+}
+
+// RecordReplicationChange counts a change replicated to the secondary
+func (m *Metrics) RecordReplicationChange(result string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordReplicationChange(result)
+	}
+}
+
+// RecordReplicationConflict counts a replication conflict by the winning side
+func (m *Metrics) RecordReplicationConflict(winner string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordReplicationConflict(winner)
+	}
+}
+
+// RecordMQTTMessage counts a message received by the MQTT bridge. topic is
+// the configured topic filter, keeping the label bounded
+func (m *Metrics) RecordMQTTMessage(topic, result string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordMQTTMessage(topic, result)
+	}
+}
+
+// SetMQTTConnected records whether the MQTT bridge is connected
+func (m *Metrics) SetMQTTConnected(connected bool) {
+	if m.prometheus != nil {
+		m.prometheus.SetMQTTConnected(connected)
+	}
+}
+
+// RecordAMQPMessage counts a write command consumed from the AMQP queue
+func (m *Metrics) RecordAMQPMessage(result string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordAMQPMessage(result)
+	}
+}
+
+// SetAMQPConnected records whether the AMQP consumer is consuming
+func (m *Metrics) SetAMQPConnected(connected bool) {
+	if m.prometheus != nil {
+		m.prometheus.SetAMQPConnected(connected)
+	}
+}
+
+// RecordIngestFile counts a file ingested from the object store
+func (m *Metrics) RecordIngestFile(status string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordIngestFile(status)
+	}
+}
+
+// SetSearchIndexLag records how far the search index trails the change stream
+func (m *Metrics) SetSearchIndexLag(lag time.Duration) {
+	if m.prometheus != nil {
+		m.prometheus.SetSearchIndexLag(lag)
+	}
+}
+
+// RecordSearchIndexDocuments counts documents indexed, deleted or failed
+func (m *Metrics) RecordSearchIndexDocuments(result string, count int) {
+	if m.prometheus != nil {
+		m.prometheus.RecordSearchIndexDocuments(result, count)
+	}
+}
+
+// RecordAnalyticsRows counts rows exported to the analytics warehouse
+func (m *Metrics) RecordAnalyticsRows(table string, count int) {
+	if m.prometheus != nil {
+		m.prometheus.RecordAnalyticsRows(table, count)
+	}
+}
+
+// RecordAnalyticsFailure counts a failed analytics export
+func (m *Metrics) RecordAnalyticsFailure() {
+	if m.prometheus != nil {
+		m.prometheus.RecordAnalyticsFailure()
+	}
+}
+
+// SetAnalyticsLastSuccess records when the last successful analytics export started
+func (m *Metrics) SetAnalyticsLastSuccess(t time.Time) {
+	if m.prometheus != nil {
+		m.prometheus.SetAnalyticsLastSuccess(t)
+	}
+}
+
+// RecordDigestSent counts a failed task digest sent to a target
+func (m *Metrics) RecordDigestSent(target string, success bool) {
+	if m.prometheus != nil {
+		m.prometheus.RecordDigestSent(target, success)
+	}
+}
+
+// RecordShadowWrite counts a write mirrored to the shadow repository
+func (m *Metrics) RecordShadowWrite(operation string, success bool) {
+	if m.prometheus != nil {
+		m.prometheus.RecordShadowWrite(operation, success)
+	}
+}
+
+// RecordShadowRead counts a read compared with the shadow repository
+func (m *Metrics) RecordShadowRead(result string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordShadowRead(result)
+	}
+}
+
+// SetQueryPlanCost records the estimated cost of the latest plan of a query
+func (m *Metrics) SetQueryPlanCost(query string, cost float64) {
+	if m.prometheus != nil {
+		m.prometheus.SetQueryPlanCost(query, cost)
+	}
+}
+
+// RecordPlanRegression counts a plan regression of a query
+func (m *Metrics) RecordPlanRegression(query, reason string) {
+	if m.prometheus != nil {
+		m.prometheus.RecordPlanRegression(query, reason)
+	}
+}
+
 // updateTaskMetrics updates calculated task metrics
 func (m *Metrics) updateTaskMetrics() {
 	m.mu.Lock()
@@ -213,13 +529,23 @@ func (m *Metrics) UpdateSystemMetrics() {
 	}
 }
 
-// GetSnapshot returns a snapshot of all metrics
-func (m *Metrics) GetSnapshot() *MetricsSnapshot {
+// SystemUsage refreshes and returns the current goroutine count and memory usage in bytes
+func (m *Metrics) SystemUsage() (int, uint64) {
 	m.UpdateSystemMetrics()
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.goroutineCount, m.memoryUsage
+}
+
+// GetSnapshot returns a snapshot of all metrics. System metrics, queue
+// depth, worker utilization and pool statistics are the ones of the last
+// sample taken by the metrics collector
+func (m *Metrics) GetSnapshot() *MetricsSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	uptime := time.Since(m.startTime)
 
 	return &MetricsSnapshot{
@@ -237,14 +563,36 @@ func (m *Metrics) GetSnapshot() *MetricsSnapshot {
 		FailedTasksCount: atomic.LoadInt64(&m.failedTasks),
 		TasksPerSecond:   m.tasksPerSecond,
 		AvgTaskTime:      m.avgTaskTime,
+		AvgTaskLag:       m.avgTaskLag(),
+		OldestPendingAge: time.Duration(atomic.LoadInt64(&m.oldestPendingAge)).Seconds(),
 		QueueDepth:       atomic.LoadInt64(&m.queueDepth),
 		MaxQueueDepth:    atomic.LoadInt64(&m.maxQueueDepth),
+		BatchSize:        atomic.LoadInt64(&m.batchSize),
+		ThrottleEvents:   atomic.LoadInt64(&m.throttleEvents),
+
+		WorkerUtilization:         m.workerUtilization,
+		WorkerUtilizationByWorker: append([]float64(nil), m.workerUtilizations...),
+
+		// Retention metrics
+		RetentionDeleted: atomic.LoadInt64(&m.retentionDeleted),
+
+		// Load shedding metrics
+		ShedRequests: atomic.LoadInt64(&m.shedRequests),
 
 		// System metrics
 		Uptime:         uptime,
 		GoroutineCount: m.goroutineCount,
 		MemoryUsageMB:  float64(m.memoryUsage) / 1024 / 1024,
 
+		// Repository metrics
+		Repository: m.repository.snapshot(),
+
+		// Database connection pool metrics
+		Pools: m.pools.snapshot(),
+
+		// Per-operation success rates
+		Operations: m.operations.snapshot(),
+
 		// Timestamps
 		LastRequestTime: m.lastRequestTime,
 		LastTaskTime:    m.lastTaskTime,
@@ -268,14 +616,40 @@ type MetricsSnapshot struct {
 	FailedTasksCount int64   `json:"failed_tasks_count"`
 	TasksPerSecond   float64 `json:"tasks_per_second"`
 	AvgTaskTime      float64 `json:"avg_task_time_ms"`
+	AvgTaskLag       float64 `json:"avg_task_lag_ms"`          // enqueue to successful apply
+	OldestPendingAge float64 `json:"oldest_pending_age_seconds"` // sampled by the metrics collector
 	QueueDepth       int64   `json:"queue_depth"`
 	MaxQueueDepth    int64   `json:"max_queue_depth"`
+	BatchSize        int64   `json:"batch_size"`
+	ThrottleEvents   int64   `json:"throttle_events"`
+
+	// WorkerUtilization is the percentage of time the inbox workers spent
+	// processing tasks since the previous sample, WorkerUtilizationByWorker
+	// the one of each worker goroutine
+	WorkerUtilization         float64   `json:"worker_utilization_percent"`
+	WorkerUtilizationByWorker []float64 `json:"worker_utilization_by_worker_percent"`
+
+	// Retention metrics
+	RetentionDeleted int64 `json:"retention_deleted"`
+
+	// Load shedding metrics
+	ShedRequests int64 `json:"shed_requests"`
 
 	// System metrics
 	Uptime         time.Duration `json:"uptime_seconds"`
 	GoroutineCount int           `json:"goroutine_count"`
 	MemoryUsageMB  float64       `json:"memory_usage_mb"`
 
+	// Repository metrics, keyed by "repository.Method"
+	Repository map[string]*RepositoryMethodSnapshot `json:"repository"`
+
+	// Database connection pool metrics, keyed by pool ("main", "inbox")
+	Pools map[string]*PoolSnapshot `json:"pools"`
+
+	// Success rates over the last 5 minutes, keyed by operation ("insert",
+	// "update", "delete", "get")
+	Operations map[string]*OperationSnapshot `json:"operations"`
+
 	// Timestamps
 	LastRequestTime time.Time `json:"last_request_time"`
 	LastTaskTime    time.Time `json:"last_task_time"`
@@ -377,6 +751,16 @@ func (s *MetricsSnapshot) GetHealthStatus() *HealthStatus {
 		status.Recommendations = append(status.Recommendations, "Monitor goroutine usage")
 	}
 
+	// Check connection pools (warning if requests wait for connections)
+	s.checkPools(status)
+
+	// Check inbox workers (warning if they are busy nearly all the time)
+	s.checkWorkers(status)
+
+	// Check the operation with the lowest success rate (warning below 99%,
+	// critical below 95%)
+	s.checkOperations(status)
+
 	return status
 }
 
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestActiveConnections_Gauge(t *testing.T) {
+	m := NewMetrics()
+
+	m.IncrementActiveConnections()
+	m.IncrementActiveConnections()
+	if got := testutil.ToFloat64(m.prometheus.httpActiveConnections); got != 2 {
+		t.Errorf("Expected the gauge at 2 while requests are served, got %v", got)
+	}
+	m.DecrementActiveConnections()
+	if got := testutil.ToFloat64(m.prometheus.httpActiveConnections); got != 1 {
+		t.Errorf("Expected the gauge at 1, got %v", got)
+	}
+}
+
+func TestHealthStatus_BusyWorkers(t *testing.T) {
+	m := NewMetrics()
+	m.SetWorkerUtilization(95, []float64{100, 90})
+
+	health := m.GetSnapshot().GetHealthStatus()
+	if health.Status != "warning" || len(health.Recommendations) != 1 || !strings.Contains(health.Recommendations[0], "INBOX_WORKER_COUNT") {
+		t.Errorf("Expected a recommendation to raise the worker count, got %+v", health)
+	}
+	if got := testutil.ToFloat64(m.prometheus.workerUtilizations.WithLabelValues("1")); got != 90 {
+		t.Errorf("Expected the utilization of worker 1 at 90, got %v", got)
+	}
+}
+
+func TestHealthStatus_OperationSuccessRates(t *testing.T) {
+	m := NewMetrics()
+	m.RegisterOperation("insert", "/insert", "/insert/batch")
+	m.RegisterOperation("update", "/update")
+	m.RegisterOperation("delete", "/delete")
+	m.RegisterOperation("get", "/get")
+
+	record := func(endpoint string, status, count int) {
+		for i := 0; i < count; i++ {
+			m.RecordHTTPRequestWithDetails("POST", endpoint, status, 0, time.Millisecond)
+		}
+	}
+	record("/insert", 201, 80)
+	record("/insert/batch", 201, 20)
+	record("/update", 200, 90)
+	record("/update", 500, 10)
+	record("/get?id=a", 404, 30) // client errors are not failures
+	record("/get", 503, 1)
+	record("/delete", 500, 5) // too few to judge
+
+	snapshot := m.GetSnapshot()
+	if insert := snapshot.Operations["insert"]; insert.Requests != 100 || insert.SuccessRate != 100 {
+		t.Errorf("Expected 100 successful inserts, got %+v", insert)
+	}
+	if get := snapshot.Operations["get"]; get.Requests != 31 || get.Failed != 1 {
+		t.Errorf("Expected 1 of 31 gets failed, got %+v", get)
+	}
+
+	health := snapshot.GetHealthStatus()
+	if health.Status != "critical" {
+		t.Errorf("Expected a critical status, got %s", health.Status)
+	}
+	var reported []string
+	for _, issue := range health.Issues {
+		if strings.Contains(issue, "success rate") {
+			reported = append(reported, issue)
+		}
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0], "Low update success rate: 90.0%") {
+		t.Errorf("Expected only the update success rate reported, got %v", health.Issues)
+	}
+}
+
+func TestEndpointLabels(t *testing.T) {
+	m := NewMetrics()
+	probe := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("GET", "/probe-1", "error"))
+	m.RecordHTTPRequestWithDetails("GET", "/probe-1", 404, 0, time.Millisecond)
+	if got := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("GET", "/probe-1", "error")); got != probe+1 {
+		t.Errorf("Expected paths labelled as is before endpoints are registered, got %v", got-probe)
+	}
+
+	m.RegisterEndpoints("/get")
+	collapsed := testutil.ToFloat64(m.prometheus.httpCollapsedPaths)
+	other := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("OTHER", "other", "error"))
+	get := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("GET", "/get", "success"))
+
+	m.RecordHTTPRequestWithDetails("GET", "/get?id=a", 200, 10, time.Millisecond)
+	m.RecordHTTPRequestWithDetails("PROPFIND", "/wp-login.php", 404, 0, time.Millisecond)
+
+	if got := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("GET", "/get", "success")); got != get+1 {
+		t.Errorf("Expected /get recorded without its query string, got %v", got-get)
+	}
+	if got := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("OTHER", "other", "error")); got != other+1 {
+		t.Errorf("Expected the unknown path and method collapsed, got %v", got-other)
+	}
+	if got := testutil.ToFloat64(m.prometheus.httpCollapsedPaths); got != collapsed+1 {
+		t.Errorf("Expected one collapsed path counted, got %v", got-collapsed)
+	}
+
+	// Paths matching a wildcard route are labelled with the route
+	m.RegisterEndpoints("/records/{id}/history")
+	history := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("GET", "/records/{id}/history", "success"))
+	m.RecordHTTPRequestWithDetails("GET", "/records/user_1/history", 200, 10, time.Millisecond)
+	m.RecordHTTPRequestWithDetails("GET", "/records/user_1/versions", 200, 10, time.Millisecond)
+	if got := testutil.ToFloat64(m.prometheus.httpRequestsTotal.WithLabelValues("GET", "/records/{id}/history", "success")); got != history+1 {
+		t.Errorf("Expected the history request labelled with its route, got %v", got-history)
+	}
+	if got := testutil.ToFloat64(m.prometheus.httpCollapsedPaths); got != collapsed+2 {
+		t.Errorf("Expected the unrouted path collapsed, got %v", got-collapsed-1)
+	}
+}
+
+func TestTaskLag(t *testing.T) {
+	m := NewMetrics()
+	m.RecordTaskCompletion("insert", 10*time.Millisecond, true)
+	m.RecordTaskCompletion("insert", 30*time.Millisecond, true)
+	m.RecordTaskCompletion("insert", time.Minute, false)
+	m.SetOldestPendingAge(90 * time.Second)
+
+	snapshot := m.GetSnapshot()
+	if snapshot.AvgTaskLag != 20 {
+		t.Errorf("Expected an average lag of 20ms over applied tasks, got %v", snapshot.AvgTaskLag)
+	}
+	if snapshot.OldestPendingAge != 90 {
+		t.Errorf("Expected the oldest pending task 90s old, got %v", snapshot.OldestPendingAge)
+	}
+	if got := testutil.ToFloat64(m.prometheus.oldestPendingAge); got != 90 {
+		t.Errorf("Expected the gauge at 90, got %v", got)
+	}
+}
+
+func TestTenantLabels(t *testing.T) {
+	m := NewMetrics()
+	m.RecordTenantRequest("acme", "/insert", 201, time.Millisecond)
+	if got := testutil.ToFloat64(m.prometheus.tenantRequests.WithLabelValues("acme", "/insert", "2xx")); got != 0 {
+		t.Errorf("Expected no tenant series without tenant labels, got %v", got)
+	}
+
+	m.SetTenantLabels("acme")
+	m.RecordTenantRequest("acme", "/insert", 201, time.Millisecond)
+	m.RecordTenantRequest("globex", "/insert", 201, time.Millisecond)
+	m.RecordTenantRequest("initech", "/insert", 201, time.Millisecond)
+	m.RecordTenantTask("initech", "insert", time.Millisecond, false)
+	if got := testutil.ToFloat64(m.prometheus.tenantRequests.WithLabelValues("acme", "/insert", "2xx")); got != 1 {
+		t.Errorf("Expected 1 request of acme, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.prometheus.tenantRequests.WithLabelValues(otherTenant, "/insert", "2xx")); got != 2 {
+		t.Errorf("Expected the requests of other tenants summed up, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.prometheus.tenantTasks.WithLabelValues(otherTenant, "insert", "error")); got != 1 {
+		t.Errorf("Expected 1 failed task of other tenants, got %v", got)
+	}
+
+	m.SetTenantQueueDepth(map[string]int{"globex": 3, "initech": 4})
+	if got := testutil.ToFloat64(m.prometheus.tenantQueueDepth.WithLabelValues("acme")); got != 0 {
+		t.Errorf("Expected no queue of acme, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.prometheus.tenantQueueDepth.WithLabelValues(otherTenant)); got != 7 {
+		t.Errorf("Expected a queue of 7 tasks of other tenants, got %v", got)
+	}
+}
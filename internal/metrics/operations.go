@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// operationWindow is the rolling window of the per-operation success rates
+const operationWindow = 5 * time.Minute
+
+// operationMinRequests is the number of requests of an operation within the
+// window below which its success rate is not judged, a few failures of a
+// rarely used operation are noise
+const operationMinRequests = 20
+
+// Success rates in percent below which /performance reports an operation
+const (
+	operationSuccessWarning  = 99
+	operationSuccessCritical = 95
+)
+
+// operationSet counts the outcomes of the requests of each operation over
+// operationWindow
+type operationSet struct {
+	mu         sync.RWMutex
+	byEndpoint map[string]*sloCounter
+	counters   map[string]*sloCounter
+}
+
+// OperationSnapshot is the success rate of an operation over the rolling
+// window
+type OperationSnapshot struct {
+	Requests    int64   `json:"requests"`
+	Failed      int64   `json:"failed"`
+	SuccessRate float64 `json:"success_rate_percent"` // 100 without requests
+}
+
+// RegisterOperation counts requests to endpoints towards the success rate of
+// operation, e.g. "insert" for its REST and RPC paths. Requests fail when
+// answered with a 5xx status
+func (m *Metrics) RegisterOperation(operation string, endpoints ...string) {
+	m.operations.mu.Lock()
+	defer m.operations.mu.Unlock()
+
+	if m.operations.counters == nil {
+		m.operations.byEndpoint = make(map[string]*sloCounter)
+		m.operations.counters = make(map[string]*sloCounter)
+	}
+	counter, ok := m.operations.counters[operation]
+	if !ok {
+		counter = newSLOCounter(SLO{Name: operation, Windows: []time.Duration{operationWindow}})
+		m.operations.counters[operation] = counter
+	}
+	for _, endpoint := range endpoints {
+		m.operations.byEndpoint[endpoint] = counter
+	}
+}
+
+// recordOperation counts a request to endpoint towards its operation, if any
+func (m *Metrics) recordOperation(endpoint string, success bool) {
+	m.operations.mu.RLock()
+	counter := m.operations.byEndpoint[endpoint]
+	m.operations.mu.RUnlock()
+
+	if counter != nil {
+		counter.record(success, time.Now())
+	}
+}
+
+// snapshot returns the success rate of every registered operation
+func (ops *operationSet) snapshot() map[string]*OperationSnapshot {
+	ops.mu.RLock()
+	defer ops.mu.RUnlock()
+
+	now := time.Now()
+	result := make(map[string]*OperationSnapshot, len(ops.counters))
+	for operation, counter := range ops.counters {
+		window := counter.report(now).Windows[0]
+		result[operation] = &OperationSnapshot{
+			Requests:    window.Total,
+			Failed:      window.Total - window.Good,
+			SuccessRate: window.Compliance * 100,
+		}
+	}
+	return result
+}
+
+// checkOperations reports the operation with the lowest success rate when
+// it falls below operationSuccessWarning. The global error rate hides an
+// operation failing often when the others are busier
+func (s *MetricsSnapshot) checkOperations(status *HealthStatus) {
+	names := make([]string, 0, len(s.Operations))
+	for operation := range s.Operations {
+		names = append(names, operation)
+	}
+	sort.Strings(names)
+
+	var worst string
+	for _, operation := range names {
+		op := s.Operations[operation]
+		if op.Requests < operationMinRequests || op.SuccessRate >= operationSuccessWarning {
+			continue
+		}
+		if worst == "" || op.SuccessRate < s.Operations[worst].SuccessRate {
+			worst = operation
+		}
+	}
+	if worst == "" {
+		return
+	}
+
+	op := s.Operations[worst]
+	if op.SuccessRate < operationSuccessCritical {
+		status.Status = "critical"
+		status.Score -= 20
+	} else {
+		if status.Status != "critical" {
+			status.Status = "warning"
+		}
+		status.Score -= 10
+	}
+	status.Issues = append(status.Issues, fmt.Sprintf(
+		"Low %s success rate: %.1f%% over the last %v (%d of %d requests failed)",
+		worst, op.SuccessRate, operationWindow, op.Failed, op.Requests))
+	status.Recommendations = append(status.Recommendations, fmt.Sprintf(
+		"Investigate the failing %s requests first, their logs and the repository calls behind them", worst))
+}
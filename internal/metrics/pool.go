@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// poolWaitWarning is the average wait for a connection during the last
+// sample above which /performance reports an exhausted pool
+const poolWaitWarning = 10 * time.Millisecond
+
+// poolStats keeps the latest connection pool statistics per pool together
+// with what changed since the previous sample
+type poolStats struct {
+	mu    sync.Mutex
+	pools map[string]*poolSample
+}
+
+// poolSample is the latest sample of a pool
+type poolSample struct {
+	stats sql.DBStats
+	// recentWaits and recentWait are the waits for a connection since the
+	// previous sample
+	recentWaits int64
+	recentWait  time.Duration
+}
+
+// PoolSnapshot represents the statistics of a database connection pool
+type PoolSnapshot struct {
+	MaxOpen           int     `json:"max_open"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"in_use"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"wait_count"`
+	WaitDurationMs    float64 `json:"wait_duration_ms"`
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+	RecentWaitCount   int64   `json:"recent_wait_count"`
+	RecentAvgWaitMs   float64 `json:"recent_avg_wait_ms"`
+}
+
+// record stores a sample of a pool and returns the sample before it, zero
+// for the first one
+func (ps *poolStats) record(pool string, stats sql.DBStats) sql.DBStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.pools == nil {
+		ps.pools = make(map[string]*poolSample)
+	}
+
+	// The first sample holds the waits since the pool was opened, which are
+	// not recent
+	sample, ok := ps.pools[pool]
+	if !ok {
+		ps.pools[pool] = &poolSample{stats: stats}
+		return sql.DBStats{}
+	}
+
+	previous := sample.stats
+	ps.pools[pool] = &poolSample{
+		stats:       stats,
+		recentWaits: stats.WaitCount - previous.WaitCount,
+		recentWait:  stats.WaitDuration - previous.WaitDuration,
+	}
+	return previous
+}
+
+// snapshot returns the statistics of every pool
+func (ps *poolStats) snapshot() map[string]*PoolSnapshot {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	result := make(map[string]*PoolSnapshot, len(ps.pools))
+	for pool, sample := range ps.pools {
+		snapshot := &PoolSnapshot{
+			MaxOpen:           sample.stats.MaxOpenConnections,
+			Open:              sample.stats.OpenConnections,
+			InUse:             sample.stats.InUse,
+			Idle:              sample.stats.Idle,
+			WaitCount:         sample.stats.WaitCount,
+			WaitDurationMs:    float64(sample.stats.WaitDuration.Microseconds()) / 1000,
+			MaxIdleClosed:     sample.stats.MaxIdleClosed,
+			MaxLifetimeClosed: sample.stats.MaxLifetimeClosed,
+			RecentWaitCount:   sample.recentWaits,
+		}
+		if sample.recentWaits > 0 {
+			snapshot.RecentAvgWaitMs = float64(sample.recentWait.Microseconds()) / 1000 / float64(sample.recentWaits)
+		}
+		result[pool] = snapshot
+	}
+
+	return result
+}
+
+// SetPoolStats records a sample of the statistics of a database connection
+// pool, e.g. "main" or "inbox"
+func (m *Metrics) SetPoolStats(pool string, stats sql.DBStats) {
+	previous := m.pools.record(pool, stats)
+
+	if m.prometheus != nil {
+		m.prometheus.SetPoolStats(pool, stats.InUse, stats.Idle, stats.MaxOpenConnections,
+			stats.WaitCount-previous.WaitCount, stats.WaitDuration-previous.WaitDuration,
+			stats.MaxIdleClosed-previous.MaxIdleClosed)
+	}
+}
+
+// checkPools reports pools whose connection requests waited longer than
+// poolWaitWarning on average since the previous sample. Pool exhaustion
+// otherwise only shows up as a high response time
+func (s *MetricsSnapshot) checkPools(status *HealthStatus) {
+	pools := make([]string, 0, len(s.Pools))
+	for pool := range s.Pools {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+
+	for _, pool := range pools {
+		stats := s.Pools[pool]
+		if stats.RecentWaitCount == 0 || stats.RecentAvgWaitMs < float64(poolWaitWarning.Milliseconds()) {
+			continue
+		}
+
+		if status.Status == "healthy" {
+			status.Status = "warning"
+		}
+		status.Score -= 15
+		status.Issues = append(status.Issues, fmt.Sprintf(
+			"Connection pool %s exhausted: %d requests waited %.1fms on average for a connection (%d/%d in use)",
+			pool, stats.RecentWaitCount, stats.RecentAvgWaitMs, stats.InUse, stats.MaxOpen))
+		status.Recommendations = append(status.Recommendations,
+			"Lower the request concurrency limit or look for slow queries holding connections of the "+pool+" pool")
+	}
+}
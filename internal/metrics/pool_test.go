@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoolStats_Exhaustion(t *testing.T) {
+	m := NewMetrics()
+
+	m.SetPoolStats("main", sql.DBStats{MaxOpenConnections: 25, OpenConnections: 5, InUse: 2, Idle: 3, WaitCount: 100, WaitDuration: 5 * time.Second})
+	pool := m.GetSnapshot().Pools["main"]
+	if pool == nil || pool.InUse != 2 || pool.WaitCount != 100 || pool.WaitDurationMs != 5000 {
+		t.Fatalf("Unexpected pool snapshot: %+v", pool)
+	}
+
+	// Waits before the first sample are not recent
+	if health := m.GetSnapshot().GetHealthStatus(); health.Status != "healthy" {
+		t.Errorf("Expected a healthy status after the first sample, got %+v", health)
+	}
+	m.SetPoolStats("main", sql.DBStats{MaxOpenConnections: 25, OpenConnections: 5, InUse: 2, Idle: 3, WaitCount: 100, WaitDuration: 5 * time.Second})
+	if health := m.GetSnapshot().GetHealthStatus(); health.Status != "healthy" {
+		t.Errorf("Expected a healthy status without new waits, got %+v", health)
+	}
+
+	// 20 waits of 50ms on average
+	m.SetPoolStats("main", sql.DBStats{MaxOpenConnections: 25, OpenConnections: 25, InUse: 25, WaitCount: 120, WaitDuration: 6 * time.Second})
+	snapshot := m.GetSnapshot()
+	if pool := snapshot.Pools["main"]; pool.RecentWaitCount != 20 || pool.RecentAvgWaitMs != 50 {
+		t.Errorf("Expected 20 recent waits of 50ms, got %d of %.1fms", pool.RecentWaitCount, pool.RecentAvgWaitMs)
+	}
+	health := snapshot.GetHealthStatus()
+	if health.Status != "warning" || len(health.Issues) != 1 || !strings.Contains(health.Issues[0], "Connection pool main exhausted") {
+		t.Errorf("Expected a pool exhaustion warning, got %+v", health)
+	}
+
+	// Short waits are not reported
+	m.SetPoolStats("main", sql.DBStats{MaxOpenConnections: 25, OpenConnections: 25, InUse: 20, Idle: 5, WaitCount: 130, WaitDuration: 6*time.Second + 10*time.Millisecond})
+	if health := m.GetSnapshot().GetHealthStatus(); health.Status != "healthy" {
+		t.Errorf("Expected a healthy status with short waits, got %+v", health)
+	}
+}
@@ -2,7 +2,8 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"mit-service/internal/version"
+	"strconv"
 	"time"
 )
 
@@ -12,78 +13,463 @@ type PrometheusMetrics struct {
 	httpRequestsTotal      *prometheus.CounterVec
 	httpRequestDuration    *prometheus.HistogramVec
 	httpActiveConnections  prometheus.Gauge
+	httpResponseSize       *prometheus.HistogramVec
+	httpInFlight           *prometheus.GaugeVec
+	httpResponses          *prometheus.CounterVec
+	httpCollapsedPaths     prometheus.Counter
 
 	// Task metrics
 	tasksTotal             *prometheus.CounterVec
 	taskDuration           *prometheus.HistogramVec
 	queueDepth             prometheus.Gauge
 	maxQueueDepth          prometheus.Gauge
+	batchSize              prometheus.Gauge
+	workerUtilization      prometheus.Gauge
+	taskLag                *prometheus.HistogramVec
+	oldestPendingAge       prometheus.Gauge
+	workerUtilizations     *prometheus.GaugeVec
+	throttleEvents         *prometheus.CounterVec
+	coalescedTasks         prometheus.Counter
+
+	// Tenant metrics, only recorded when tenant labels are on
+	tenantRequests         *prometheus.CounterVec
+	tenantRequestDuration  *prometheus.HistogramVec
+	tenantTasks            *prometheus.CounterVec
+	tenantTaskDuration     *prometheus.HistogramVec
+	tenantQueueDepth       *prometheus.GaugeVec
+
+	// Repository metrics
+	repositoryCalls        *prometheus.CounterVec
+	repositoryCallDuration *prometheus.HistogramVec
+
+	// Retention metrics
+	retentionRecords       *prometheus.CounterVec
+
+	// Load shedding metrics
+	shedRequests           *prometheus.CounterVec
+	concurrencyRejections  *prometheus.CounterVec
+
+	// Enrichment metrics
+	enrichmentRequests     *prometheus.CounterVec
+	enrichmentCircuitOpen  prometheus.Gauge
+
+	// Table metrics
+	tableSizeBytes         *prometheus.GaugeVec
+	tableIndexSizeBytes    *prometheus.GaugeVec
+	tableLiveTuples        *prometheus.GaugeVec
+	tableDeadTuples        *prometheus.GaugeVec
+
+	// Integrity verification metrics
+	integrityMismatched    prometheus.Gauge
+	integrityUnhashed      prometheus.Gauge
+	integrityLastRun       prometheus.Gauge
+
+	// Replication metrics
+	replicationLag         prometheus.Gauge
+	replicationChanges     *prometheus.CounterVec
+	replicationConflicts   *prometheus.CounterVec
+
+	// MQTT bridge metrics
+	mqttMessages           *prometheus.CounterVec
+	mqttConnected          prometheus.Gauge
+
+	// AMQP consumer metrics
+	amqpMessages           *prometheus.CounterVec
+	amqpConnected          prometheus.Gauge
+
+	// Object store ingestion metrics
+	ingestFiles            *prometheus.CounterVec
+
+	// Search index metrics
+	searchIndexLag         prometheus.Gauge
+	searchIndexDocuments   *prometheus.CounterVec
+
+	// Analytics export metrics
+	analyticsRows          *prometheus.CounterVec
+	analyticsFailures      prometheus.Counter
+	analyticsLastSuccess   prometheus.Gauge
+
+	// Failed task digest metrics
+	digestsSent            *prometheus.CounterVec
+
+	// Shadow repository metrics
+	shadowWrites           *prometheus.CounterVec
+	shadowReads            *prometheus.CounterVec
+
+	// Query plan metrics
+	queryPlanCost          *prometheus.GaugeVec
+	planRegressions        *prometheus.CounterVec
+
+	// Connection pool metrics
+	poolConnections        *prometheus.GaugeVec
+	poolMaxOpen            *prometheus.GaugeVec
+	poolWaits              *prometheus.CounterVec
+	poolWaitSeconds        *prometheus.CounterVec
+	poolMaxIdleClosed      *prometheus.CounterVec
 
 	// System metrics
 	goroutineCount         prometheus.Gauge
 	memoryUsage            prometheus.Gauge
 	uptimeSeconds          prometheus.Gauge
+	buildInfo              *prometheus.GaugeVec
 }
 
 // NewPrometheusMetrics creates a new Prometheus metrics instance
-func NewPrometheusMetrics() *PrometheusMetrics {
-	return &PrometheusMetrics{
-		httpRequestsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+func NewPrometheusMetrics(opts ...Option) *PrometheusMetrics {
+	var histograms histogramOptions
+	for _, opt := range opts {
+		opt(&histograms)
+	}
+
+	pm := &PrometheusMetrics{
+		httpRequestsTotal: register(prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "mit_service_http_requests_total",
 			Help: "Total number of HTTP requests",
-		}, []string{"method", "endpoint", "status"}),
+		}, []string{"method", "endpoint", "status"})),
 
-		httpRequestDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
-			Name:    "mit_service_http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		}, []string{"method", "endpoint"}),
+		httpRequestDuration: register(prometheus.NewHistogramVec(histograms.durationOpts(
+			"mit_service_http_request_duration_seconds",
+			"HTTP request duration in seconds",
+			histograms.httpBuckets,
+		), []string{"method", "endpoint"})),
 
-		httpActiveConnections: promauto.NewGauge(prometheus.GaugeOpts{
+		httpActiveConnections: register(prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "mit_service_http_active_connections",
 			Help: "Number of active HTTP connections",
-		}),
+		})),
+
+		httpResponseSize: register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mit_service_http_response_size_bytes",
+			Help:    "HTTP response body size in bytes",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+		}, []string{"method", "endpoint"})),
 
-		tasksTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+		httpInFlight: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_http_requests_in_flight",
+			Help: "Number of HTTP requests being served by endpoint",
+		}, []string{"endpoint"})),
+
+		httpCollapsedPaths: register(prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mit_service_http_collapsed_paths_total",
+			Help: "HTTP requests to paths that are not routes, recorded with the endpoint label \"other\"",
+		})),
+
+		httpResponses: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_http_responses_total",
+			Help: "Total number of HTTP responses by status code class (2xx, 3xx, 4xx, 5xx)",
+		}, []string{"endpoint", "code_class"})),
+
+		tasksTotal: register(prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "mit_service_tasks_total",
 			Help: "Total number of tasks processed",
-		}, []string{"operation", "status"}),
+		}, []string{"operation", "status"})),
 
-		taskDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
-			Name:    "mit_service_task_duration_seconds", 
-			Help:    "Task processing duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		}, []string{"operation"}),
+		taskDuration: register(prometheus.NewHistogramVec(histograms.durationOpts(
+			"mit_service_task_duration_seconds",
+			"Task processing duration in seconds",
+			histograms.taskBuckets,
+		), []string{"operation"})),
 
-		queueDepth: promauto.NewGauge(prometheus.GaugeOpts{
+		queueDepth: register(prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "mit_service_queue_depth",
 			Help: "Current queue depth",
-		}),
+		})),
 
-		maxQueueDepth: promauto.NewGauge(prometheus.GaugeOpts{
+		maxQueueDepth: register(prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "mit_service_max_queue_depth",
 			Help: "Maximum queue depth observed",
-		}),
+		})),
+
+		tenantRequests: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_tenant_http_requests_total",
+			Help: "HTTP requests of tenants by status code class, allowlisted tenants by name and the others as \"other\"",
+		}, []string{"tenant", "endpoint", "code_class"})),
+
+		tenantRequestDuration: register(prometheus.NewHistogramVec(histograms.durationOpts(
+			"mit_service_tenant_http_request_duration_seconds",
+			"HTTP request duration of tenants in seconds",
+			histograms.httpBuckets,
+		), []string{"tenant"})),
+
+		tenantTasks: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_tenant_tasks_total",
+			Help: "Tasks of tenants processed",
+		}, []string{"tenant", "operation", "status"})),
+
+		tenantTaskDuration: register(prometheus.NewHistogramVec(histograms.durationOpts(
+			"mit_service_tenant_task_duration_seconds",
+			"Task processing duration of tenants in seconds",
+			histograms.taskBuckets,
+		), []string{"tenant"})),
+
+		tenantQueueDepth: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_tenant_queue_depth",
+			Help: "Pending and processing tasks of tenants",
+		}, []string{"tenant"})),
+
+		batchSize: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_inbox_batch_size",
+			Help: "Current inbox worker batch size",
+		})),
+
+		taskLag: register(prometheus.NewHistogramVec(histograms.durationOpts(
+			"mit_service_task_lag_seconds",
+			"Time from enqueueing a task to applying it successfully, retries included",
+			prometheus.ExponentialBuckets(0.005, 2, 16), // 5ms to ~3min
+		), []string{"operation"})),
+
+		oldestPendingAge: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_inbox_oldest_pending_age_seconds",
+			Help: "Age of the oldest pending task, zero without a backlog",
+		})),
+
+		workerUtilization: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_inbox_worker_utilization_percent",
+			Help: "Percentage of time the inbox workers spent processing tasks since the previous sample",
+		})),
+
+		workerUtilizations: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_inbox_worker_goroutine_utilization_percent",
+			Help: "Percentage of time each inbox worker goroutine spent processing tasks since the previous sample",
+		}, []string{"worker"})),
+
+		throttleEvents: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_worker_throttle_events_total",
+			Help: "Number of inbox worker polls throttled due to resource pressure",
+		}, []string{"reason"})),
+
+		coalescedTasks: register(prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mit_service_inbox_coalesced_tasks_total",
+			Help: "Update tasks completed without a write because a later update to the same record superseded them",
+		})),
+
+		repositoryCalls: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_repository_calls_total",
+			Help: "Total number of repository calls",
+		}, []string{"repository", "method", "status"})),
+
+		repositoryCallDuration: register(prometheus.NewHistogramVec(histograms.durationOpts(
+			"mit_service_repository_call_duration_seconds",
+			"Repository call duration in seconds",
+			nil,
+		), []string{"repository", "method"})),
+
+		retentionRecords: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_retention_records_total",
+			Help: "Records deleted by retention rules, or matched in dry-run mode",
+		}, []string{"prefix", "mode"})),
+
+		shedRequests: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_shed_requests_total",
+			Help: "Requests rejected by load shedding",
+		}, []string{"endpoint", "priority"})),
 
-		goroutineCount: promauto.NewGauge(prometheus.GaugeOpts{
+		concurrencyRejections: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_concurrency_rejected_total",
+			Help: "Requests rejected because their route reached its concurrency limit",
+		}, []string{"endpoint"})),
+
+		enrichmentRequests: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_enrichment_requests_total",
+			Help: "Calls to the external enrichment service by outcome",
+		}, []string{"status"})),
+
+		enrichmentCircuitOpen: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_enrichment_circuit_open",
+			Help: "Whether the enrichment circuit breaker is open (1) or closed (0)",
+		})),
+
+		tableSizeBytes: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_table_size_bytes",
+			Help: "Total table size including indexes and TOAST in bytes",
+		}, []string{"table"})),
+
+		tableIndexSizeBytes: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_table_index_size_bytes",
+			Help: "Table index size in bytes",
+		}, []string{"table"})),
+
+		tableLiveTuples: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_table_live_tuples",
+			Help: "Estimated number of live rows in the table",
+		}, []string{"table"})),
+
+		tableDeadTuples: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_table_dead_tuples",
+			Help: "Estimated number of dead rows awaiting vacuum",
+		}, []string{"table"})),
+
+		integrityMismatched: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_integrity_mismatched_records",
+			Help: "Records whose value did not match its stored hash in the last integrity verification",
+		})),
+
+		integrityUnhashed: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_integrity_unhashed_records",
+			Help: "Records without a stored hash in the last integrity verification",
+		})),
+
+		integrityLastRun: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_integrity_last_verification_timestamp_seconds",
+			Help: "Unix time the last integrity verification completed",
+		})),
+
+		replicationLag: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_replication_lag_seconds",
+			Help: "Age of the oldest change not yet replicated to the secondary, zero when caught up",
+		})),
+
+		replicationChanges: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_replication_changes_total",
+			Help: "Changes replicated to the secondary by result",
+		}, []string{"result"})),
+
+		replicationConflicts: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_replication_conflicts_total",
+			Help: "Changes that found the secondary out of step, by the winning side",
+		}, []string{"winner"})),
+
+		mqttMessages: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_mqtt_messages_total",
+			Help: "MQTT messages received by the bridge, by topic filter and result",
+		}, []string{"topic", "result"})),
+
+		mqttConnected: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_mqtt_connected",
+			Help: "Whether the MQTT bridge is connected to the broker (1) or not (0)",
+		})),
+
+		amqpMessages: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_amqp_messages_total",
+			Help: "Write commands consumed from the AMQP queue by result",
+		}, []string{"result"})),
+
+		amqpConnected: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_amqp_connected",
+			Help: "Whether the AMQP consumer is consuming its queue (1) or not (0)",
+		})),
+
+		ingestFiles: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_ingest_files_total",
+			Help: "Files ingested from the object store by status",
+		}, []string{"status"})),
+
+		searchIndexLag: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_search_index_lag_seconds",
+			Help: "Age of the oldest change not yet mirrored into the search index",
+		})),
+
+		searchIndexDocuments: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_search_index_documents_total",
+			Help: "Documents written to the search index by result (indexed, deleted, failed)",
+		}, []string{"result"})),
+
+		analyticsRows: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_analytics_rows_total",
+			Help: "Rows exported to the analytics warehouse by table",
+		}, []string{"table"})),
+
+		analyticsFailures: register(prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mit_service_analytics_export_failures_total",
+			Help: "Failed analytics exports",
+		})),
+
+		analyticsLastSuccess: register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mit_service_analytics_last_success_timestamp_seconds",
+			Help: "Unix time of the start of the last successful analytics export",
+		})),
+
+		digestsSent: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_digests_sent_total",
+			Help: "Failed task digests sent by target and result (sent, failed)",
+		}, []string{"target", "result"})),
+
+		shadowWrites: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_shadow_writes_total",
+			Help: "Writes mirrored to the shadow repository by operation and result (applied, failed)",
+		}, []string{"operation", "result"})),
+
+		shadowReads: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_shadow_read_comparisons_total",
+			Help: "Sampled reads compared with the shadow repository by result (match, mismatch, missing, error)",
+		}, []string{"result"})),
+
+		queryPlanCost: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_query_plan_cost",
+			Help: "Estimated total cost of the latest plan of a hot query",
+		}, []string{"query"})),
+
+		planRegressions: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_query_plan_regressions_total",
+			Help: "Plan regressions of hot queries by reason (seq_scan, cost)",
+		}, []string{"query", "reason"})),
+
+		poolConnections: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_db_pool_connections",
+			Help: "Database connections of a pool by state (in_use, idle)",
+		}, []string{"pool", "state"})),
+
+		poolMaxOpen: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_db_pool_max_open_connections",
+			Help: "Maximum number of open connections of a pool",
+		}, []string{"pool"})),
+
+		poolWaits: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_db_pool_waits_total",
+			Help: "Connection requests that waited for a free connection of a pool",
+		}, []string{"pool"})),
+
+		poolWaitSeconds: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_db_pool_wait_seconds_total",
+			Help: "Time spent waiting for a free connection of a pool",
+		}, []string{"pool"})),
+
+		poolMaxIdleClosed: register(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mit_service_db_pool_max_idle_closed_total",
+			Help: "Connections of a pool closed because the idle pool was full",
+		}, []string{"pool"})),
+
+		goroutineCount: register(prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "mit_service_goroutines",
 			Help: "Number of goroutines",
-		}),
+		})),
 
-		memoryUsage: promauto.NewGauge(prometheus.GaugeOpts{
+		memoryUsage: register(prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "mit_service_memory_usage_bytes",
 			Help: "Memory usage in bytes",
-		}),
+		})),
 
-		uptimeSeconds: promauto.NewGauge(prometheus.GaugeOpts{
+		uptimeSeconds: register(prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: "mit_service_uptime_seconds",
 			Help: "Service uptime in seconds",
-		}),
+		})),
+
+		buildInfo: register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mit_service_build_info",
+			Help: "Always 1, labelled with the version of the running build",
+		}, []string{"version", "commit", "go_version"})),
+	}
+
+	info := version.Get()
+	pm.buildInfo.WithLabelValues(info.Version, info.Commit, info.GoVersion).Set(1)
+
+	return pm
+}
+
+// register registers a collector with the default registry, returning the
+// already registered collector when one with the same descriptor exists
+func register[T prometheus.Collector](c T) T {
+	if err := prometheus.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(T)
+		}
+		panic(err)
 	}
+	return c
 }
 
 // RecordHTTPRequest records an HTTP request metric
-func (pm *PrometheusMetrics) RecordHTTPRequest(method, endpoint string, statusCode int, duration time.Duration) {
+func (pm *PrometheusMetrics) RecordHTTPRequest(method, endpoint string, statusCode int, size int64, duration time.Duration) {
 	status := "success"
 	if statusCode >= 400 {
 		status = "error"
@@ -91,6 +477,18 @@ func (pm *PrometheusMetrics) RecordHTTPRequest(method, endpoint string, statusCo
 
 	pm.httpRequestsTotal.WithLabelValues(method, endpoint, status).Inc()
 	pm.httpRequestDuration.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+	pm.httpResponseSize.WithLabelValues(method, endpoint).Observe(float64(size))
+	pm.httpResponses.WithLabelValues(endpoint, strconv.Itoa(statusCode/100)+"xx").Inc()
+}
+
+// RecordCollapsedPath counts a request recorded under the "other" endpoint
+func (pm *PrometheusMetrics) RecordCollapsedPath() {
+	pm.httpCollapsedPaths.Inc()
+}
+
+// AddHTTPInFlight adds delta to the requests in flight of endpoint
+func (pm *PrometheusMetrics) AddHTTPInFlight(endpoint string, delta float64) {
+	pm.httpInFlight.WithLabelValues(endpoint).Add(delta)
 }
 
 // SetActiveConnections sets the active connections count
@@ -104,12 +502,217 @@ func (pm *PrometheusMetrics) RecordTask(operation, status string, duration time.
 	pm.taskDuration.WithLabelValues(operation).Observe(duration.Seconds())
 }
 
+// ObserveTaskLag records the time from enqueueing a task to applying it
+func (pm *PrometheusMetrics) ObserveTaskLag(operation string, lag time.Duration) {
+	pm.taskLag.WithLabelValues(operation).Observe(lag.Seconds())
+}
+
+// SetOldestPendingAge sets the age of the oldest pending task
+func (pm *PrometheusMetrics) SetOldestPendingAge(age time.Duration) {
+	pm.oldestPendingAge.Set(age.Seconds())
+}
+
 // SetQueueMetrics sets queue-related metrics
 func (pm *PrometheusMetrics) SetQueueMetrics(current, max int64) {
 	pm.queueDepth.Set(float64(current))
 	pm.maxQueueDepth.Set(float64(max))
 }
 
+// SetBatchSize sets the current inbox worker batch size
+func (pm *PrometheusMetrics) SetBatchSize(size int) {
+	pm.batchSize.Set(float64(size))
+}
+
+// SetWorkerUtilization sets the percentage of time the inbox workers were
+// busy, overall and per worker goroutine
+func (pm *PrometheusMetrics) SetWorkerUtilization(utilization float64, byWorker []float64) {
+	pm.workerUtilization.Set(utilization)
+	for worker, u := range byWorker {
+		pm.workerUtilizations.WithLabelValues(strconv.Itoa(worker)).Set(u)
+	}
+}
+
+// RecordCoalescedTask counts an update task superseded by a later one
+func (pm *PrometheusMetrics) RecordCoalescedTask() {
+	pm.coalescedTasks.Inc()
+}
+
+// RecordThrottleEvent records a worker throttle event
+func (pm *PrometheusMetrics) RecordThrottleEvent(reason string) {
+	pm.throttleEvents.WithLabelValues(reason).Inc()
+}
+
+// RecordRepositoryCall records a repository call metric
+func (pm *PrometheusMetrics) RecordRepositoryCall(repository, method, status string, duration time.Duration) {
+	pm.repositoryCalls.WithLabelValues(repository, method, status).Inc()
+	pm.repositoryCallDuration.WithLabelValues(repository, method).Observe(duration.Seconds())
+}
+
+// RecordShedRequest records a request rejected by load shedding
+func (pm *PrometheusMetrics) RecordShedRequest(endpoint, priority string) {
+	pm.shedRequests.WithLabelValues(endpoint, priority).Inc()
+}
+
+// RecordConcurrencyRejection records a request rejected by a route concurrency limit
+func (pm *PrometheusMetrics) RecordConcurrencyRejection(endpoint string) {
+	pm.concurrencyRejections.WithLabelValues(endpoint).Inc()
+}
+
+// RecordEnrichment records the outcome of an enrichment call
+func (pm *PrometheusMetrics) RecordEnrichment(status string) {
+	pm.enrichmentRequests.WithLabelValues(status).Inc()
+}
+
+// SetEnrichmentCircuitOpen records the enrichment circuit breaker state
+func (pm *PrometheusMetrics) SetEnrichmentCircuitOpen(open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	pm.enrichmentCircuitOpen.Set(value)
+}
+
+// RecordRetention records records handled by a retention rule
+func (pm *PrometheusMetrics) RecordRetention(prefix string, dryRun bool, count int) {
+	mode := "delete"
+	if dryRun {
+		mode = "dry_run"
+	}
+	pm.retentionRecords.WithLabelValues(prefix, mode).Add(float64(count))
+}
+
+// SetTableStats sets table size and bloat metrics
+func (pm *PrometheusMetrics) SetTableStats(table string, totalBytes, indexBytes, liveTuples, deadTuples int64) {
+	pm.tableSizeBytes.WithLabelValues(table).Set(float64(totalBytes))
+	pm.tableIndexSizeBytes.WithLabelValues(table).Set(float64(indexBytes))
+	pm.tableLiveTuples.WithLabelValues(table).Set(float64(liveTuples))
+	pm.tableDeadTuples.WithLabelValues(table).Set(float64(deadTuples))
+}
+
+// SetIntegrityResult sets the outcome of an integrity verification
+func (pm *PrometheusMetrics) SetIntegrityResult(mismatched, unhashed int, finishedAt time.Time) {
+	pm.integrityMismatched.Set(float64(mismatched))
+	pm.integrityUnhashed.Set(float64(unhashed))
+	pm.integrityLastRun.Set(float64(finishedAt.Unix()))
+}
+
+// SetReplicationLag sets the replication lag
+func (pm *PrometheusMetrics) SetReplicationLag(lag time.Duration) {
+	pm.replicationLag.Set(lag.Seconds())
+}
+
+// RecordReplicationChange counts a replicated change by result
+func (pm *PrometheusMetrics) RecordReplicationChange(result string) {
+	pm.replicationChanges.WithLabelValues(result).Inc()
+}
+
+// RecordReplicationConflict counts a replication conflict by the side that won
+func (pm *PrometheusMetrics) RecordReplicationConflict(winner string) {
+	pm.replicationConflicts.WithLabelValues(winner).Inc()
+}
+
+// RecordMQTTMessage counts an MQTT message by topic filter and result
+func (pm *PrometheusMetrics) RecordMQTTMessage(topic, result string) {
+	pm.mqttMessages.WithLabelValues(topic, result).Inc()
+}
+
+// SetMQTTConnected sets the MQTT connection state
+func (pm *PrometheusMetrics) SetMQTTConnected(connected bool) {
+	if connected {
+		pm.mqttConnected.Set(1)
+	} else {
+		pm.mqttConnected.Set(0)
+	}
+}
+
+// RecordAMQPMessage counts a consumed AMQP message by result
+func (pm *PrometheusMetrics) RecordAMQPMessage(result string) {
+	pm.amqpMessages.WithLabelValues(result).Inc()
+}
+
+// SetAMQPConnected sets the AMQP consumer state
+func (pm *PrometheusMetrics) SetAMQPConnected(connected bool) {
+	if connected {
+		pm.amqpConnected.Set(1)
+	} else {
+		pm.amqpConnected.Set(0)
+	}
+}
+
+// RecordIngestFile counts an ingested file by status
+func (pm *PrometheusMetrics) RecordIngestFile(status string) {
+	pm.ingestFiles.WithLabelValues(status).Inc()
+}
+
+// SetSearchIndexLag sets the search index lag
+func (pm *PrometheusMetrics) SetSearchIndexLag(lag time.Duration) {
+	pm.searchIndexLag.Set(lag.Seconds())
+}
+
+// RecordSearchIndexDocuments counts documents written to the search index by result
+func (pm *PrometheusMetrics) RecordSearchIndexDocuments(result string, count int) {
+	pm.searchIndexDocuments.WithLabelValues(result).Add(float64(count))
+}
+
+// RecordAnalyticsRows counts rows exported to a warehouse table
+func (pm *PrometheusMetrics) RecordAnalyticsRows(table string, count int) {
+	pm.analyticsRows.WithLabelValues(table).Add(float64(count))
+}
+
+// RecordAnalyticsFailure counts a failed analytics export
+func (pm *PrometheusMetrics) RecordAnalyticsFailure() {
+	pm.analyticsFailures.Inc()
+}
+
+// SetAnalyticsLastSuccess sets the time of the last successful analytics export
+func (pm *PrometheusMetrics) SetAnalyticsLastSuccess(t time.Time) {
+	pm.analyticsLastSuccess.Set(float64(t.Unix()))
+}
+
+// RecordDigestSent counts a failed task digest sent to a target
+func (pm *PrometheusMetrics) RecordDigestSent(target string, success bool) {
+	result := "sent"
+	if !success {
+		result = "failed"
+	}
+	pm.digestsSent.WithLabelValues(target, result).Inc()
+}
+
+// RecordShadowWrite counts a write mirrored to the shadow repository
+func (pm *PrometheusMetrics) RecordShadowWrite(operation string, success bool) {
+	result := "applied"
+	if !success {
+		result = "failed"
+	}
+	pm.shadowWrites.WithLabelValues(operation, result).Inc()
+}
+
+// RecordShadowRead counts a read compared with the shadow repository
+func (pm *PrometheusMetrics) RecordShadowRead(result string) {
+	pm.shadowReads.WithLabelValues(result).Inc()
+}
+
+// SetQueryPlanCost sets the estimated cost of the latest plan of a query
+func (pm *PrometheusMetrics) SetQueryPlanCost(query string, cost float64) {
+	pm.queryPlanCost.WithLabelValues(query).Set(cost)
+}
+
+// RecordPlanRegression counts a plan regression of a query
+func (pm *PrometheusMetrics) RecordPlanRegression(query, reason string) {
+	pm.planRegressions.WithLabelValues(query, reason).Inc()
+}
+
+// SetPoolStats sets the connection gauges of a pool and adds the waits
+// and closed connections since the previous sample to the counters
+func (pm *PrometheusMetrics) SetPoolStats(pool string, inUse, idle, maxOpen int, waits int64, waited time.Duration, maxIdleClosed int64) {
+	pm.poolConnections.WithLabelValues(pool, "in_use").Set(float64(inUse))
+	pm.poolConnections.WithLabelValues(pool, "idle").Set(float64(idle))
+	pm.poolMaxOpen.WithLabelValues(pool).Set(float64(maxOpen))
+	pm.poolWaits.WithLabelValues(pool).Add(float64(waits))
+	pm.poolWaitSeconds.WithLabelValues(pool).Add(waited.Seconds())
+	pm.poolMaxIdleClosed.WithLabelValues(pool).Add(float64(maxIdleClosed))
+}
+
 // SetSystemMetrics sets system-level metrics
 func (pm *PrometheusMetrics) SetSystemMetrics(goroutines int, memoryBytes uint64, uptimeDuration time.Duration) {
 	pm.goroutineCount.Set(float64(goroutines))
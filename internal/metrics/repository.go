@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Repository call statuses
+const (
+	RepositoryStatusSuccess  = "success"
+	RepositoryStatusNotFound = "not_found"
+	RepositoryStatusConflict = "conflict"
+	RepositoryStatusError    = "error"
+
+	// RepositoryStatusCancelled marks calls aborted by a cancelled or expired
+	// context, e.g. when the HTTP client disconnected
+	RepositoryStatusCancelled = "cancelled"
+
+	// RepositoryStatusTimeout marks calls exceeding their query deadline
+	RepositoryStatusTimeout = "timeout"
+)
+
+// repositoryStats aggregates repository call statistics per method
+type repositoryStats struct {
+	mu      sync.Mutex
+	methods map[string]*repositoryMethodStats
+}
+
+// repositoryMethodStats holds counters for a single repository method
+type repositoryMethodStats struct {
+	calls     int64
+	errors    int64
+	cancelled int64
+	totalTime time.Duration
+	maxTime   time.Duration
+}
+
+// RepositoryMethodSnapshot represents call statistics of a repository method
+type RepositoryMethodSnapshot struct {
+	Calls        int64   `json:"calls"`
+	Errors       int64   `json:"errors"`
+	Cancelled    int64   `json:"cancelled"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	MaxLatencyMs float64 `json:"max_latency_ms"`
+}
+
+// record adds a call to the statistics of repository.method
+func (rs *repositoryStats) record(repository, method, status string, duration time.Duration) {
+	key := repository + "." + method
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.methods == nil {
+		rs.methods = make(map[string]*repositoryMethodStats)
+	}
+
+	stats, ok := rs.methods[key]
+	if !ok {
+		stats = &repositoryMethodStats{}
+		rs.methods[key] = stats
+	}
+
+	stats.calls++
+	stats.totalTime += duration
+	if duration > stats.maxTime {
+		stats.maxTime = duration
+	}
+	switch status {
+	case RepositoryStatusError, RepositoryStatusTimeout:
+		stats.errors++
+	case RepositoryStatusCancelled:
+		stats.cancelled++
+	}
+}
+
+// snapshot returns per-method statistics keyed by "repository.Method"
+func (rs *repositoryStats) snapshot() map[string]*RepositoryMethodSnapshot {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	result := make(map[string]*RepositoryMethodSnapshot, len(rs.methods))
+	for key, stats := range rs.methods {
+		snapshot := &RepositoryMethodSnapshot{
+			Calls:        stats.calls,
+			Errors:       stats.errors,
+			Cancelled:    stats.cancelled,
+			MaxLatencyMs: float64(stats.maxTime.Microseconds()) / 1000,
+		}
+		if stats.calls > 0 {
+			snapshot.ErrorRate = float64(stats.errors) / float64(stats.calls)
+			snapshot.AvgLatencyMs = float64(stats.totalTime.Microseconds()) / 1000 / float64(stats.calls)
+		}
+		result[key] = snapshot
+	}
+
+	return result
+}
+
+// RecordRepositoryCall records a repository call with its outcome status
+func (m *Metrics) RecordRepositoryCall(repository, method, status string, duration time.Duration) {
+	m.repository.record(repository, method, status, duration)
+
+	if m.prometheus != nil {
+		m.prometheus.RecordRepositoryCall(repository, method, status, duration)
+	}
+}
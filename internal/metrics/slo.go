@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SLO kinds
+const (
+	SLOKindHTTP = "http" // requests matched by endpoint, bad when 5xx or slow
+	SLOKindTask = "task" // inbox tasks matched by operation, bad when failed or completed late
+)
+
+// sloBucket is the resolution of the rolling windows
+const sloBucket = time.Minute
+
+// SLO is a service level objective: Objective of the matching events must be
+// good, i.e. succeed within Threshold, over each of the rolling Windows
+type SLO struct {
+	Name      string
+	Kind      string
+	Targets   []string // endpoints or operations, "*" matches all
+	Threshold time.Duration
+	Objective float64 // e.g. 0.99
+	Windows   []time.Duration
+}
+
+// ParseSLOs parses ";"-separated SLO definitions of the form
+// "<name>=<kind>:<targets> <threshold> <objective>% <windows>", e.g.
+// "writes=http:/insert,/update,/delete 200ms 99% 1h,24h; tasks=task:* 30s 99% 1h"
+func ParseSLOs(spec string) ([]SLO, error) {
+	var slos []SLO
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		slo, err := parseSLO(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SLO %q: %w", entry, err)
+		}
+		slos = append(slos, slo)
+	}
+	return slos, nil
+}
+
+func parseSLO(entry string) (SLO, error) {
+	name, definition, ok := strings.Cut(entry, "=")
+	fields := strings.Fields(definition)
+	if !ok || strings.TrimSpace(name) == "" || len(fields) != 4 {
+		return SLO{}, fmt.Errorf("expected <name>=<kind>:<targets> <threshold> <objective>%% <windows>")
+	}
+
+	kind, targets, ok := strings.Cut(fields[0], ":")
+	if !ok || (kind != SLOKindHTTP && kind != SLOKindTask) || targets == "" {
+		return SLO{}, fmt.Errorf("expected http:<endpoints> or task:<operations>")
+	}
+
+	threshold, err := time.ParseDuration(fields[1])
+	if err != nil || threshold <= 0 {
+		return SLO{}, fmt.Errorf("invalid threshold %q", fields[1])
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		return SLO{}, fmt.Errorf("invalid objective %q, expected a percentage below 100", fields[2])
+	}
+
+	var windows []time.Duration
+	for _, w := range strings.Split(fields[3], ",") {
+		window, err := time.ParseDuration(w)
+		if err != nil || window < sloBucket {
+			return SLO{}, fmt.Errorf("invalid window %q, expected at least %v", w, sloBucket)
+		}
+		windows = append(windows, window)
+	}
+
+	return SLO{
+		Name:      strings.TrimSpace(name),
+		Kind:      kind,
+		Targets:   strings.Split(targets, ","),
+		Threshold: threshold,
+		Objective: percent / 100,
+		Windows:   windows,
+	}, nil
+}
+
+// matches reports whether an event of kind for target counts towards the SLO
+func (s *SLO) matches(kind, target string) bool {
+	if s.Kind != kind {
+		return false
+	}
+	for _, t := range s.Targets {
+		if t == "*" || t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// SLOReport is the compliance of one SLO
+type SLOReport struct {
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"`
+	Targets   []string          `json:"targets"`
+	Threshold string            `json:"threshold"`
+	Objective float64           `json:"objective"`
+	Windows   []SLOWindowReport `json:"windows"`
+}
+
+// SLOWindowReport is the compliance of an SLO over one rolling window
+type SLOWindowReport struct {
+	Window     string  `json:"window"`
+	Total      int64   `json:"total"`
+	Good       int64   `json:"good"`
+	Compliance float64 `json:"compliance"` // good/total, 1 without events
+	Met        bool    `json:"met"`
+
+	// ErrorBudgetRemaining is the fraction of allowed bad events not yet
+	// spent, negative once the budget is exhausted
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+}
+
+// sloCounter counts good and total events in minute buckets covering the
+// longest window of its SLO
+type sloCounter struct {
+	slo SLO
+
+	mu      sync.Mutex
+	buckets []sloCount
+}
+
+type sloCount struct {
+	minute      int64 // unix minute the counts belong to
+	good, total int64
+}
+
+func newSLOCounter(slo SLO) *sloCounter {
+	longest := time.Duration(0)
+	for _, w := range slo.Windows {
+		if w > longest {
+			longest = w
+		}
+	}
+	return &sloCounter{slo: slo, buckets: make([]sloCount, int(longest/sloBucket)+1)}
+}
+
+func (c *sloCounter) record(good bool, now time.Time) {
+	minute := now.Unix() / int64(sloBucket/time.Second)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := &c.buckets[minute%int64(len(c.buckets))]
+	if b.minute != minute {
+		*b = sloCount{minute: minute}
+	}
+	b.total++
+	if good {
+		b.good++
+	}
+}
+
+func (c *sloCounter) report(now time.Time) SLOReport {
+	minute := now.Unix() / int64(sloBucket/time.Second)
+	report := SLOReport{
+		Name:      c.slo.Name,
+		Kind:      c.slo.Kind,
+		Targets:   c.slo.Targets,
+		Threshold: c.slo.Threshold.String(),
+		Objective: c.slo.Objective,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, window := range c.slo.Windows {
+		oldest := minute - int64(window/sloBucket) + 1
+
+		w := SLOWindowReport{Window: window.String(), Compliance: 1}
+		for _, b := range c.buckets {
+			if b.minute >= oldest && b.minute <= minute {
+				w.Total += b.total
+				w.Good += b.good
+			}
+		}
+
+		if w.Total > 0 {
+			w.Compliance = float64(w.Good) / float64(w.Total)
+		}
+		budget := 1 - c.slo.Objective
+		w.ErrorBudgetRemaining = 1 - (1-w.Compliance)/budget
+		w.Met = w.Compliance >= c.slo.Objective
+
+		report.Windows = append(report.Windows, w)
+	}
+
+	return report
+}
+
+// SetSLOs replaces the tracked SLOs, resetting their counts
+func (m *Metrics) SetSLOs(slos []SLO) {
+	counters := make([]*sloCounter, 0, len(slos))
+	for _, slo := range slos {
+		counters = append(counters, newSLOCounter(slo))
+	}
+
+	m.mu.Lock()
+	m.slos = counters
+	m.mu.Unlock()
+}
+
+// recordSLOEvent counts an event towards the matching SLOs
+func (m *Metrics) recordSLOEvent(kind, target string, success bool, latency time.Duration) {
+	m.mu.RLock()
+	counters := m.slos
+	m.mu.RUnlock()
+
+	now := time.Now()
+	for _, c := range counters {
+		if c.slo.matches(kind, target) {
+			c.record(success && latency <= c.slo.Threshold, now)
+		}
+	}
+}
+
+// SLOReports reports the compliance and error budget of every SLO
+func (m *Metrics) SLOReports() []SLOReport {
+	m.mu.RLock()
+	counters := m.slos
+	m.mu.RUnlock()
+
+	now := time.Now()
+	reports := make([]SLOReport, 0, len(counters))
+	for _, c := range counters {
+		reports = append(reports, c.report(now))
+	}
+	return reports
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseSLOs(t *testing.T) {
+	slos, err := ParseSLOs("writes=http:/insert,/update 200ms 99.5% 1h,24h; tasks=task:* 30s 99% 1h")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(slos) != 2 {
+		t.Fatalf("Expected 2 SLOs, got %d", len(slos))
+	}
+
+	writes := slos[0]
+	if writes.Kind != SLOKindHTTP || len(writes.Targets) != 2 || writes.Threshold != 200*time.Millisecond ||
+		writes.Objective != 0.995 || len(writes.Windows) != 2 {
+		t.Errorf("Unexpected SLO: %+v", writes)
+	}
+
+	for _, spec := range []string{"writes", "w=db:* 1s 99% 1h", "w=http:* 1s 100% 1h", "w=http:* 1s 99% 1s", "w=http:* fast 99% 1h"} {
+		if _, err := ParseSLOs(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestSLOCounter_RollingWindows(t *testing.T) {
+	c := newSLOCounter(SLO{Name: "w", Kind: SLOKindHTTP, Targets: []string{"*"}, Threshold: time.Second,
+		Objective: 0.9, Windows: []time.Duration{time.Hour, 2 * time.Hour}})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// 90 minutes ago: 10 bad events, only in the 2h window
+	for i := 0; i < 10; i++ {
+		c.record(false, now.Add(-90*time.Minute))
+	}
+	// Within the last hour: 95 good, 5 bad
+	for i := 0; i < 100; i++ {
+		c.record(i >= 5, now.Add(-time.Duration(i)*time.Second))
+	}
+
+	report := c.report(now)
+	hour, twoHours := report.Windows[0], report.Windows[1]
+
+	if hour.Total != 100 || hour.Good != 95 || !hour.Met {
+		t.Errorf("Unexpected 1h window: %+v", hour)
+	}
+	if math.Abs(hour.ErrorBudgetRemaining-0.5) > 1e-9 {
+		t.Errorf("Expected half the 1h error budget left, got %v", hour.ErrorBudgetRemaining)
+	}
+
+	if twoHours.Total != 110 || twoHours.Good != 95 || twoHours.Met || twoHours.ErrorBudgetRemaining >= 0 {
+		t.Errorf("Expected the 2h budget to be exhausted, got %+v", twoHours)
+	}
+}
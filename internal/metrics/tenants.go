@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// otherTenant labels the metrics of tenants that are not allowlisted
+const otherTenant = "other"
+
+// tenantSet is the allowlist of tenants whose metrics are labelled with
+// their name
+type tenantSet struct {
+	mu    sync.RWMutex
+	known map[string]bool
+}
+
+// SetTenantLabels turns on the per-tenant request, task and queue depth
+// metrics. The tenants listed are labelled by name, every other tenant is
+// recorded as "other", which bounds the cardinality of the series however
+// many tenants there are. Without tenants the per-tenant metrics are off
+func (m *Metrics) SetTenantLabels(tenants ...string) {
+	m.tenants.mu.Lock()
+	defer m.tenants.mu.Unlock()
+
+	m.tenants.known = nil
+	for _, tenant := range tenants {
+		if m.tenants.known == nil {
+			m.tenants.known = make(map[string]bool)
+		}
+		m.tenants.known[tenant] = true
+	}
+}
+
+// TenantLabels reports whether the per-tenant metrics are on
+func (m *Metrics) TenantLabels() bool {
+	m.tenants.mu.RLock()
+	defer m.tenants.mu.RUnlock()
+	return m.tenants.known != nil
+}
+
+// tenantLabel returns the label of tenant, false when the per-tenant
+// metrics are off or the request has no tenant
+func (m *Metrics) tenantLabel(tenant string) (string, bool) {
+	m.tenants.mu.RLock()
+	defer m.tenants.mu.RUnlock()
+
+	if m.tenants.known == nil || tenant == "" {
+		return "", false
+	}
+	if m.tenants.known[tenant] {
+		return tenant, true
+	}
+	return otherTenant, true
+}
+
+// RecordTenantRequest records an HTTP request of tenant, see SetTenantLabels
+func (m *Metrics) RecordTenantRequest(tenant, endpoint string, statusCode int, duration time.Duration) {
+	label, ok := m.tenantLabel(tenant)
+	if !ok || m.prometheus == nil {
+		return
+	}
+	endpoint, _ = m.endpointLabel(endpoint)
+	m.prometheus.tenantRequests.WithLabelValues(label, endpoint, strconv.Itoa(statusCode/100)+"xx").Inc()
+	m.prometheus.tenantRequestDuration.WithLabelValues(label).Observe(duration.Seconds())
+}
+
+// RecordTenantTask records a task execution of tenant, see SetTenantLabels
+func (m *Metrics) RecordTenantTask(tenant, operation string, duration time.Duration, success bool) {
+	label, ok := m.tenantLabel(tenant)
+	if !ok || m.prometheus == nil {
+		return
+	}
+	status := "success"
+	if !success {
+		status = "error"
+	}
+	m.prometheus.tenantTasks.WithLabelValues(label, operation, status).Inc()
+	m.prometheus.tenantTaskDuration.WithLabelValues(label).Observe(duration.Seconds())
+}
+
+// SetTenantQueueDepth sets the queue depth of each tenant from the open
+// tasks by tenant. Allowlisted tenants without open tasks are set to zero,
+// the other tenants are summed up as "other"
+func (m *Metrics) SetTenantQueueDepth(depths map[string]int) {
+	if !m.TenantLabels() || m.prometheus == nil {
+		return
+	}
+
+	m.tenants.mu.RLock()
+	defer m.tenants.mu.RUnlock()
+
+	var other int
+	for tenant, depth := range depths {
+		if !m.tenants.known[tenant] {
+			other += depth
+		}
+	}
+	for tenant := range m.tenants.known {
+		m.prometheus.tenantQueueDepth.WithLabelValues(tenant).Set(float64(depths[tenant]))
+	}
+	m.prometheus.tenantQueueDepth.WithLabelValues(otherTenant).Set(float64(other))
+}
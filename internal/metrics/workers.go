@@ -0,0 +1,38 @@
+package metrics
+
+import "fmt"
+
+// workerBusyWarning is the inbox worker utilization in percent above which
+// /performance recommends more workers
+const workerBusyWarning = 90
+
+// SetWorkerUtilization sets the percentage of time the inbox workers spent
+// processing tasks since the previous sample, overall and per worker
+// goroutine
+func (m *Metrics) SetWorkerUtilization(utilization float64, byWorker []float64) {
+	m.mu.Lock()
+	m.workerUtilization = utilization
+	m.workerUtilizations = append(m.workerUtilizations[:0], byWorker...)
+	m.mu.Unlock()
+
+	if m.prometheus != nil {
+		m.prometheus.SetWorkerUtilization(utilization, byWorker)
+	}
+}
+
+// checkWorkers reports inbox workers busy nearly all the time, which queue
+// tasks faster than they are processed once the load grows further
+func (s *MetricsSnapshot) checkWorkers(status *HealthStatus) {
+	if s.WorkerUtilization < workerBusyWarning {
+		return
+	}
+
+	if status.Status == "healthy" {
+		status.Status = "warning"
+	}
+	status.Score -= 10
+	status.Issues = append(status.Issues, fmt.Sprintf(
+		"Inbox workers busy %.0f%% of the time (%d workers)", s.WorkerUtilization, len(s.WorkerUtilizationByWorker)))
+	status.Recommendations = append(status.Recommendations,
+		"Raise INBOX_WORKER_COUNT or INBOX_BATCH_CONCURRENCY")
+}
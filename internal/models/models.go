@@ -1,37 +1,377 @@
 package models
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// Record represents a database record with id and JSON value
+// Record represents a database record with id and JSON value. The value is
+// kept as the JSON it was written or stored as, so records pass through the
+// service without being decoded, keeping field order and number precision;
+// DecodeValue and DecodedValue decode it where it is inspected
 type Record struct {
-	ID    string      `json:"id" db:"id"`
-	Value interface{} `json:"value" db:"value"`
+	ID    string          `json:"id" db:"id"`
+	Type  string          `json:"type,omitempty" db:"type"`
+	Value json.RawMessage `json:"value" db:"value"`
+
+	// Hash is the SHA-256 of the value stored with it, empty for records
+	// written before hashes were kept
+	Hash string `json:"hash,omitempty" db:"value_hash"`
+
+	// Encoding is EncodingProtobuf for values stored as protobuf, whose
+	// Value is then the encoded message of the proto type named by Type as
+	// a base64 JSON string, see ProtoValue
+	Encoding string `json:"encoding,omitempty" db:"value_encoding"`
+
+	// Version starts at 1 on insert and grows by one with every update, for
+	// writes expecting the record unchanged since it was read
+	Version int64 `json:"version,omitempty" db:"version"`
+}
+
+// EncodingProtobuf marks values stored as protobuf messages
+const EncodingProtobuf = "protobuf"
+
+// ProtoValue returns the value of a record holding the encoded message data
+func ProtoValue(data []byte) json.RawMessage {
+	encoded, _ := json.Marshal(data)
+	return encoded
+}
+
+// ProtoData returns the encoded message of a protobuf record
+func (r *Record) ProtoData() ([]byte, error) {
+	var encoded string
+	if err := json.Unmarshal(r.Value, &encoded); err != nil {
+		return nil, fmt.Errorf("record '%s' does not hold a protobuf message", r.ID)
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// EncodeValue returns the JSON encoding of a value for Record.Value. Values
+// that are JSON already are kept as they are
+func EncodeValue(value interface{}) (json.RawMessage, error) {
+	switch v := value.(type) {
+	case json.RawMessage:
+		return v, nil
+	case nil:
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// MustEncodeValue is EncodeValue for values known to encode, such as
+// decoded JSON
+func MustEncodeValue(value interface{}) json.RawMessage {
+	encoded, err := EncodeValue(value)
+	if err != nil {
+		panic(fmt.Sprintf("models: failed to encode value: %v", err))
+	}
+	return encoded
+}
+
+// IsObjectValue reports whether a raw JSON value is an object, looking at its
+// first byte only: the value is assumed to be valid JSON
+func IsObjectValue(value json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(value)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// IsEmptyValue reports whether a raw JSON value is missing, null or an
+// object without members, the values a write may not carry
+func IsEmptyValue(value json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return true
+	}
+	return trimmed[0] == '{' && len(bytes.TrimSpace(trimmed[1:len(trimmed)-1])) == 0
+}
+
+// UnmarshalValue is json.Unmarshal decoding numbers as json.Number rather
+// than float64, so large integers and decimals survive being decoded and
+// encoded again
+func UnmarshalValue(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// DecodeValue decodes the value into v, numbers as json.Number
+func (r *Record) DecodeValue(v interface{}) error {
+	if err := UnmarshalValue(r.Value, v); err != nil {
+		return fmt.Errorf("failed to decode value of record '%s': %w", r.ID, err)
+	}
+	return nil
 }
 
-// InsertRequest represents the request payload for insert operation
+// DecodedValue returns the value decoded into maps, slices and
+// json.Numbers, nil for a record without value
+func (r *Record) DecodedValue() (interface{}, error) {
+	if len(r.Value) == 0 {
+		return nil, nil
+	}
+	var value interface{}
+	if err := r.DecodeValue(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// RecordWithPendingChanges is a record read together with the queued writes
+// that have not been applied to it yet
+type RecordWithPendingChanges struct {
+	*Record
+	PendingChanges bool     `json:"pending_changes"`
+	PendingTaskIDs []string `json:"pending_task_ids,omitempty"`
+}
+
+// ValueHash returns the hex SHA-256 of the JSON encoding of value. Object
+// keys are encoded sorted, so equal values hash the same regardless of the
+// key order they were written with. Raw JSON is decoded first for the
+// same reason, with numbers in their float64 form unless that loses
+// precision
+func ValueHash(value interface{}) (string, error) {
+	if raw, ok := value.(json.RawMessage); ok {
+		var decoded interface{}
+		if len(raw) > 0 {
+			if err := UnmarshalValue(raw, &decoded); err != nil {
+				return "", err
+			}
+		}
+		value = canonicalNumbers(decoded)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return HashJSON(encoded), nil
+}
+
+// canonicalNumbers replaces the numbers of a decoded value that float64
+// holds exactly by their float64, so a number hashes the same however it
+// is written (PostgreSQL drops exponents) and like it did before numbers
+// were kept as written. Other numbers keep their digits
+func canonicalNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = canonicalNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = canonicalNumbers(item)
+		}
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return value
+		}
+		written, ok := new(big.Rat).SetString(string(v))
+		shortest, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+		if ok && written.Cmp(shortest) == 0 {
+			return f
+		}
+	}
+	return value
+}
+
+// HashJSON returns the hex SHA-256 of an encoded value
+func HashJSON(encoded []byte) string {
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// InsertRequest represents the request payload for insert operation. The ID
+// may be omitted when the service generates IDs. Value is the JSON object as
+// sent, decoded only by the transforms, scripts and schemas inspecting it
 type InsertRequest struct {
-	ID    string                 `json:"id" binding:"required,min=1"`
-	Value map[string]interface{} `json:"value" binding:"required"`
+	ID    string          `json:"id"`
+	Type  string          `json:"type,omitempty"` // optional record type, validated against its schema
+	Value json.RawMessage `json:"value" binding:"required"`
+
+	// Reservation is the token of a reservation of ID, required while the
+	// ID is reserved
+	Reservation string `json:"reservation,omitempty"`
+
+	// TaskID is the ID of the queued task, generated when empty. A client
+	// supplying its own can retry the request safely: an ID already used
+	// fails with ErrTaskExists
+	TaskID string `json:"task_id,omitempty"`
+}
+
+// ReserveRequest represents the request payload for reserving a record ID
+type ReserveRequest struct {
+	ID    string `json:"id" binding:"required,min=1"`
+	Lease string `json:"lease,omitempty"` // how long the ID is held, e.g. "30s"
+}
+
+// Reservation is a claim on an unused record ID: until ExpiresAt only
+// inserts presenting Token may create the record
+type Reservation struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // UpdateRequest represents the request payload for update operation
 type UpdateRequest struct {
-	ID    string                 `json:"id" binding:"required,min=1"`
-	Value map[string]interface{} `json:"value" binding:"required"`
+	ID    string          `json:"id" binding:"required,min=1"`
+	Value json.RawMessage `json:"value" binding:"required"`
+
+	// ExpectedVersion, when set, fails the update with ErrVersionConflict
+	// unless the record still has this version
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
+
+	// TaskID is the ID of the queued task, see InsertRequest
+	TaskID string `json:"task_id,omitempty"`
 }
 
 // DeleteRequest represents the request payload for delete operation
 type DeleteRequest struct {
 	ID string `json:"id" binding:"required,min=1"`
+
+	// ExpectedVersion, when set, fails the delete with ErrVersionConflict
+	// unless the record still has this version
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
+
+	// TaskID is the ID of the queued task, see InsertRequest
+	TaskID string `json:"task_id,omitempty"`
+}
+
+// WriteCommand is a record write received from a message queue rather than
+// the HTTP API. Value is required for insert and update
+type WriteCommand struct {
+	Operation string          `json:"operation"` // "insert", "update" or "delete"
+	ID        string          `json:"id"`
+	Type      string          `json:"type,omitempty"` // insert only
+	Value     json.RawMessage `json:"value,omitempty"`
+}
+
+// EnqueueTaskRequest represents the request payload for a custom task operation
+type EnqueueTaskRequest struct {
+	Operation string          `json:"operation"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	TaskID    string          `json:"task_id,omitempty"` // see InsertRequest
+}
+
+// TaskExistsResponse is the 409 answer to a write reusing a task ID, with
+// the state of the task that holds it. Task is left out when another
+// tenant queued it
+type TaskExistsResponse struct {
+	Error string     `json:"error"`
+	Task  *InboxTask `json:"task,omitempty"`
+}
+
+// EnqueueTaskResponse represents the response for a queued custom task
+type EnqueueTaskResponse struct {
+	Message string `json:"message"`
+	TaskID  string `json:"task_id"`
+}
+
+// SimulateTaskRequest is the task run through the worker pipeline by
+// POST /tasks/simulate
+type SimulateTaskRequest struct {
+	Operation string          `json:"operation"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+
+	// ApplyTransforms applies the write transforms to the value of an
+	// insert or update first, as for a task queued by /insert or /update
+	ApplyTransforms bool `json:"apply_transforms,omitempty"`
+}
+
+// TaskSimulation is the outcome of a task run through the worker pipeline
+// without persisting it
+type TaskSimulation struct {
+	Operation string `json:"operation"`
+	RecordID  string `json:"record_id,omitempty"`
+
+	// Status is the status the task would end in, TaskStatusCompleted or
+	// TaskStatusFailed; Retryable is set when the worker would retry it
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+
+	// Result is the result the task would complete with
+	Result *TaskResult `json:"result,omitempty"`
+
+	// Payload is the payload as the task is applied, after transforms and
+	// enrichment
+	Payload json.RawMessage   `json:"payload"`
+	Steps   []*SimulationStep `json:"steps"`
+
+	// Before and After are the record the task targets before and after it
+	// is applied, nil when it does not exist
+	Before *Record `json:"before,omitempty"`
+	After  *Record `json:"after,omitempty"`
+}
+
+// SimulationStep is one stage of the worker pipeline a simulated task
+// passed through, e.g. "validate" or "apply"
+type SimulationStep struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"duration_ms"`
+	Skipped    bool    `json:"skipped,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// GetRecordRequest is the request of the RPC Get method
+type GetRecordRequest struct {
+	ID string `json:"id"`
+
+	// ConsistencyToken waits until the write of the token is applied
+	ConsistencyToken string `json:"consistency_token,omitempty"`
+}
+
+// ListRecordsRequest is the request of the RPC ListRecords method
+type ListRecordsRequest struct {
+	Type   string `json:"type,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+}
+
+// ListTasksRequest is the request of the RPC ListTasks method
+type ListTasksRequest struct {
+	Status string `json:"status,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
 }
 
 // SuccessResponse represents a successful operation response
 type SuccessResponse struct {
 	Message string `json:"message"`
+
+	// ID is the record ID of an insert, generated when the request had none
+	ID string `json:"id,omitempty"`
+
+	// ConsistencyToken identifies a queued write. Passing it to /get waits
+	// until the write has been applied
+	ConsistencyToken string `json:"consistency_token,omitempty"`
+}
+
+// InsertBatchResponse represents the response of a batch insert
+type InsertBatchResponse struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+
+	// ConsistencyTokens identify the queued inserts and IDs are their
+	// record IDs, in request order
+	ConsistencyTokens []string `json:"consistency_tokens"`
+	IDs               []string `json:"ids"`
 }
 
 // ErrorResponse represents an error response
@@ -49,8 +389,70 @@ type InboxTask struct {
 	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
 	Retries   int             `json:"retries" db:"retries"`
 	Error     string          `json:"error,omitempty" db:"error"`
+	TenantID  string          `json:"tenant_id,omitempty" db:"tenant_id"` // Tenant that queued the task, empty without tenancy
+	Trace     *TaskTrace      `json:"trace,omitempty" db:"trace"`         // Processing trace of the last attempt, only with task tracing
+	Result    *TaskResult     `json:"result,omitempty" db:"result"`       // Result of the operation, set when the task completes
+}
+
+// TaskResult is the machine-readable result of a completed task, telling
+// apart outcomes that are all a success, e.g. an insert that created the
+// record from one that found it already there
+type TaskResult struct {
+	Outcome      string `json:"outcome"`
+	RowsAffected int64  `json:"rows_affected"` // records written, 0 for custom operations which do not report it
+}
+
+// Outcomes of a task result
+const (
+	TaskOutcomeCreated        = "created"         // insert wrote the record
+	TaskOutcomeIdempotentNoop = "idempotent_noop" // insert found the record with the same value
+	TaskOutcomeUpdated        = "updated"
+	TaskOutcomeDeleted        = "deleted"
+	TaskOutcomeSuperseded     = "superseded" // update coalesced into a later update of the record
+	TaskOutcomeApplied        = "applied"    // custom operation ran
+)
+
+// TaskTrace is the structured record of one processing attempt of a task:
+// the pipeline stages it went through and the decisions the worker took
+type TaskTrace struct {
+	Attempt    int               `json:"attempt"`
+	Worker     int               `json:"worker"`
+	StartedAt  time.Time         `json:"started_at"`
+	DurationMs float64           `json:"duration_ms"`
+	Outcome    string            `json:"outcome"` // task status the attempt left: completed, failed or pending for a retry
+	Error      string            `json:"error,omitempty"`
+	Stages     []*TaskTraceStage `json:"stages"`
+	Decisions  []*TaskDecision   `json:"decisions"`
+}
+
+// TaskTraceStage is a pipeline stage of a traced attempt
+type TaskTraceStage struct {
+	Name       string  `json:"name"` // "validate", "transform" or "persist"
+	StartMs    float64 `json:"start_ms"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// TaskDecision is a decision the worker took on a traced attempt, e.g. to
+// treat an insert of an existing identical record as done
+type TaskDecision struct {
+	Decision string `json:"decision"`
+	Stage    string `json:"stage,omitempty"` // stage the decision was taken in, empty outside the stages
+	Detail   string `json:"detail"`
 }
 
+// Decisions of a task trace
+const (
+	TaskDecisionIdempotentSkip        = "idempotent-skip"
+	TaskDecisionUnenriched            = "unenriched"
+	TaskDecisionCoalesced             = "coalesced"
+	TaskDecisionVersionConflict       = "version-conflict"
+	TaskDecisionSchemaViolation       = "schema-violation"
+	TaskDecisionDependencyUnavailable = "dependency-unavailable"
+	TaskDecisionDependencyTimeout     = "dependency-timeout"
+	TaskDecisionMaxRetries            = "max-retries"
+)
+
 // TaskStatus constants
 const (
 	TaskStatusPending    = "pending"
@@ -68,19 +470,34 @@ const (
 
 // InsertTaskPayload represents the payload for insert task
 type InsertTaskPayload struct {
-	ID    string                 `json:"id"`
-	Value map[string]interface{} `json:"value"`
+	ID    string          `json:"id"`
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value"`
+
+	// Proto is the encoded message of a protobuf value, set instead of Value
+	Proto []byte `json:"proto,omitempty"`
 }
 
 // UpdateTaskPayload represents the payload for update task
 type UpdateTaskPayload struct {
-	ID    string                 `json:"id"`
-	Value map[string]interface{} `json:"value"`
+	ID    string          `json:"id"`
+	Value json.RawMessage `json:"value"`
+
+	// Proto is the encoded message of a protobuf value, set instead of Value
+	Proto []byte `json:"proto,omitempty"`
+
+	// ExpectedVersion is the version the record must have when the task is
+	// applied, 0 for any
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
 }
 
 // DeleteTaskPayload represents the payload for delete task
 type DeleteTaskPayload struct {
 	ID string `json:"id"`
+
+	// ExpectedVersion is the version the record must have when the task is
+	// applied, 0 for any
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
 }
 
 // TaskStats represents statistics about inbox tasks
@@ -90,6 +507,9 @@ type TaskStats struct {
 	ProcessingTasks int `json:"processing_tasks"`
 	CompletedTasks  int `json:"completed_tasks"`
 	FailedTasks     int `json:"failed_tasks"`
+
+	// OldestPendingAt is the creation time of the oldest pending task
+	OldestPendingAt *time.Time `json:"oldest_pending_at,omitempty"`
 }
 
 // TasksListResponse represents the response for tasks list
@@ -101,7 +521,905 @@ type TasksListResponse struct {
 	Stats  *TaskStats   `json:"stats,omitempty"`
 }
 
+// TaskStatusRequest is the body of POST /tasks/status
+type TaskStatusRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// TaskStatus is the current state of a task in a bulk status query
+type TaskStatus struct {
+	ID        string      `json:"id"`
+	Status    string      `json:"status"`
+	Retries   int         `json:"retries"`
+	Error     string      `json:"error,omitempty"`
+	Result    *TaskResult `json:"result,omitempty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// TaskStatusResponse holds the statuses of the tasks queried, in request
+// order, and the IDs of no task
+type TaskStatusResponse struct {
+	Tasks   []*TaskStatus `json:"tasks"`
+	Missing []string      `json:"missing"`
+}
+
 // Common errors
 var (
-	ErrInvalidTaskOperation = errors.New("invalid task operation")
+	ErrInvalidTaskOperation   = errors.New("invalid task operation")
+	ErrRecordNotFound         = errors.New("not found")
+	ErrRecordExists           = errors.New("already exists")
+	ErrQueryTimeout           = errors.New("query timeout")
+	ErrInvalidSnapshotName    = errors.New("invalid snapshot name")
+	ErrSnapshotsUnsupported   = errors.New("snapshots are not enabled")
+	ErrAccessStatsDisabled    = errors.New("access statistics are not enabled")
+	ErrScanRunning            = errors.New("scan already running")
+	ErrHistoryUnsupported     = errors.New("record history is not enabled")
+	ErrVersionNotFound        = errors.New("version not found")
+	ErrVersionConflict        = errors.New("version conflict")
+	ErrInvalidToken           = errors.New("invalid consistency token")
+	ErrConsistencyTimeout     = errors.New("write not applied in time")
+	ErrWriteFailed            = errors.New("write failed")
+	ErrReplicationDisabled    = errors.New("replication is not enabled")
+	ErrIngestDisabled         = errors.New("ingestion is not enabled")
+	ErrIngestFileNotFound     = errors.New("ingest file not found")
+	ErrSearchDisabled         = errors.New("search is not enabled")
+	ErrInvalidSearch          = errors.New("invalid search")
+	ErrAnalyticsDisabled      = errors.New("analytics export is not enabled")
+	ErrDigestDisabled         = errors.New("failed task digest is not enabled")
+	ErrInvalidReprocess       = errors.New("invalid reprocess request")
+	ErrInvalidVerify          = errors.New("invalid verify request")
+	ErrShadowDisabled         = errors.New("shadow writes are not enabled")
+	ErrCutoverNotReady        = errors.New("shadow is not ready to be promoted")
+	ErrInvalidCutover         = errors.New("invalid cutover request")
+	ErrUnknownRecordType      = errors.New("unknown record type")
+	ErrSchemaValidation       = errors.New("schema validation failed")
+	ErrInvalidSchema          = errors.New("invalid schema")
+	ErrInvalidProto           = errors.New("invalid protobuf value")
+	ErrExplainUnsupported     = errors.New("query plans are not supported by this backend")
+	ErrInvalidExplain         = errors.New("invalid explain request")
+	ErrSchemaCheckUnsupported = errors.New("schema checks are not supported by this backend")
+	ErrReservationsDisabled   = errors.New("reservations are not enabled")
+	ErrInvalidReservation     = errors.New("invalid reservation")
+	ErrRecordReserved         = errors.New("record ID is reserved")
+	ErrReservationExpired     = errors.New("reservation expired")
+	ErrIDRequired             = errors.New("record ID is required")
+	ErrCollectionNotFound     = errors.New("collection not found")
+	ErrSystemRecord           = errors.New("ID is reserved for system records")
+	ErrRecordReferenced       = errors.New("record is referenced")
+	ErrInvalidTraversal       = errors.New("invalid traversal")
+	ErrInvalidComposite       = errors.New("invalid composite request")
+	ErrTooManySubscribers     = errors.New("too many change subscribers")
+	ErrTaskExists             = errors.New("task ID is already used")
+	ErrInvalidTaskID          = errors.New("invalid task ID")
+	ErrInvalidPatch           = errors.New("invalid patch")
+)
+
+// RecordFilter selects records for listing
+type RecordFilter struct {
+	Type          string    // only records of this type, empty for any
+	Prefix        string    // only IDs starting with this prefix
+	ExcludePrefix string    // skip IDs starting with this prefix
+	AfterID       string    // only IDs sorting after this one, for keyset paging
+	WrittenBefore time.Time // only records last written before this time, zero for any
+	Limit         int
+	Offset        int
+}
+
+// TaskFilter selects the inbox tasks listed, newest first
+type TaskFilter struct {
+	Status        string // only tasks of this status, empty for any
+	TenantID      string // only tasks queued by this tenant, empty for any
+	Prefix        string // only IDs starting with this prefix
+	ExcludePrefix string // skip IDs starting with this prefix
+	Limit         int
+	Offset        int
+}
+
+// RecordsListResponse represents the response for records list
+type RecordsListResponse struct {
+	Records []*Record `json:"records"`
+	Type    string    `json:"type,omitempty"`
+	Limit   int       `json:"limit"`
+	Offset  int       `json:"offset"`
+}
+
+// CollectionStats describes a collection, a named set of records with its
+// own keyspace
+type CollectionStats struct {
+	Name      string    `json:"name"`
+	Records   int       `json:"records"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CollectionsListResponse represents the response for collections list
+type CollectionsListResponse struct {
+	Collections []*CollectionStats `json:"collections"`
+}
+
+// RecordType is a named record type and its JSON Schema
+type RecordType struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// ProtoType is a record type whose values are protobuf messages of Message,
+// described by a serialized FileDescriptorSet including its imports
+type ProtoType struct {
+	Name          string `json:"name"`
+	Message       string `json:"message"`
+	DescriptorSet []byte `json:"descriptor_set"`
+}
+
+// ProtoWriteRequest writes a protobuf value. Type names the proto type; it
+// is read from the stored record on updates
+type ProtoWriteRequest struct {
+	ID   string
+	Type string
+	Data []byte
+}
+
+// TableStats describes the on-disk size and dead-tuple estimate of a table,
+// summed over its partitions
+type TableStats struct {
+	Table          string     `json:"table"`
+	TotalBytes     int64      `json:"total_bytes"`
+	TableBytes     int64      `json:"table_bytes"`
+	IndexBytes     int64      `json:"index_bytes"`
+	LiveTuples     int64      `json:"live_tuples"`
+	DeadTuples     int64      `json:"dead_tuples"`
+	DeadTupleRatio float64    `json:"dead_tuple_ratio"`
+	LastVacuum     *time.Time `json:"last_vacuum,omitempty"`
+	LastAutovacuum *time.Time `json:"last_autovacuum,omitempty"`
+}
+
+// RecordAccessStats counts the reads and writes of a record. With sampling
+// the counts are estimates
+type RecordAccessStats struct {
+	ID          string     `json:"id"`
+	Reads       int64      `json:"reads"`
+	Writes      int64      `json:"writes"`
+	LastReadAt  *time.Time `json:"last_read_at,omitempty"`
+	LastWriteAt *time.Time `json:"last_write_at,omitempty"`
+}
+
+// Value change operations of a record diff
+const (
+	ChangeAdd     = "add"
+	ChangeRemove  = "remove"
+	ChangeReplace = "replace"
+)
+
+// ValueChange is one difference between two values. Path is a JSON Pointer
+// (RFC 6901) to the changed member, Old and New are unset for additions and
+// removals respectively
+type ValueChange struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// RecordDiff is the difference between two versions of a record value
+type RecordDiff struct {
+	ID          string         `json:"id"`
+	FromVersion int            `json:"from_version"`
+	ToVersion   int            `json:"to_version"`
+	Changes     []*ValueChange `json:"changes"`
+}
+
+// Operations of record history entries
+const (
+	HistoryInsert = "insert"
+	HistoryUpdate = "update"
+	HistoryDelete = "delete"
+)
+
+// RecordHistoryEntry is a record as left by an insert or update, or as it
+// was when deleted. Versions restart at 1 when a deleted record is inserted
+// again
+type RecordHistoryEntry struct {
+	ID        string          `json:"id"`
+	Version   int64           `json:"version"`
+	Operation string          `json:"operation"`
+	Type      string          `json:"type,omitempty"`
+	Value     json.RawMessage `json:"value"`
+	Encoding  string          `json:"encoding,omitempty"`
+	ChangedAt time.Time       `json:"changed_at"`
+}
+
+// Record returns the record the entry holds
+func (e *RecordHistoryEntry) Record() *Record {
+	return &Record{ID: e.ID, Type: e.Type, Value: e.Value, Encoding: e.Encoding, Version: e.Version}
+}
+
+// RecordHistoryPage is a page of the history of a record, oldest first
+type RecordHistoryPage struct {
+	ID      string                `json:"id"`
+	Entries []*RecordHistoryEntry `json:"entries"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+}
+
+// RecordReference is a reference between two records: a field of a record
+// holding the ID of another, with what happens to the referencing record
+// when the other one is deleted
+type RecordReference struct {
+	ID       string `json:"id"`             // the other record
+	Type     string `json:"type,omitempty"` // its type, known for referencing records
+	Field    string `json:"field"`
+	OnDelete string `json:"on_delete"`
+}
+
+// RecordReferences lists the references of a record to other records and
+// the records referencing it
+type RecordReferences struct {
+	ID           string             `json:"id"`
+	References   []*RecordReference `json:"references"`
+	ReferencedBy []*RecordReference `json:"referenced_by"`
+
+	// Truncated is set when more records reference the record than listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ReferenceEdge is a reference followed by a traversal
+type ReferenceEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Field string `json:"field"`
+}
+
+// Traversal is the subgraph of the records reachable from a record along
+// its references
+type Traversal struct {
+	Start   string          `json:"start"`
+	Depth   int             `json:"depth"`
+	Records []*Record       `json:"records"` // start first, then by distance
+	Edges   []ReferenceEdge `json:"edges"`
+
+	// Missing lists referenced records that do not exist
+	Missing []string `json:"missing,omitempty"`
+
+	// Truncated is set when more records were reachable than returned
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ChangeEvent is a record write applied by the inbox worker, streamed to
+// the subscribers of /ws
+type ChangeEvent struct {
+	Operation string    `json:"operation"`
+	ID        string    `json:"id"`
+	TaskID    string    `json:"task_id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ChangeFilter selects the changes of a subscription: those of the records
+// listed in IDs, if any, whose ID starts with Prefix. The zero filter
+// selects every change
+type ChangeFilter struct {
+	IDs    []string `json:"ids,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+}
+
+// Matches reports whether the filter selects the changes of the record id
+func (f ChangeFilter) Matches(id string) bool {
+	return strings.HasPrefix(id, f.Prefix) && (len(f.IDs) == 0 || slices.Contains(f.IDs, id))
+}
+
+// CompositeDocument is a record with the records it references inlined into
+// its value
+type CompositeDocument struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type,omitempty"`
+	Version int64           `json:"version,omitempty"`
+	Value   json.RawMessage `json:"value"`
+	Depth   int             `json:"depth"`
+
+	// Cached is set when the document was served from the composite cache
+	Cached bool `json:"cached"`
+}
+
+// Access statistics orderings of the hottest records
+const (
+	AccessOrderReads  = "reads"
+	AccessOrderWrites = "writes"
+	AccessOrderTotal  = "total"
+)
+
+// SnapshotInfo describes a repository snapshot saved to disk
+type SnapshotInfo struct {
+	Name      string    `json:"name"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	Records   int       `json:"records,omitempty"`
+	Tasks     int       `json:"tasks,omitempty"`
+}
+
+// RetentionReport describes the outcome of one retention rule evaluation
+type RetentionReport struct {
+	Prefix  string    `json:"prefix"`
+	MaxAge  string    `json:"max_age"`
+	Cutoff  time.Time `json:"cutoff"`
+	Matched int       `json:"matched"`
+	Deleted int       `json:"deleted"`
+	Kept    int       `json:"kept,omitempty"` // expired records a restricting reference keeps
+	DryRun  bool      `json:"dry_run"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Background scan states
+const (
+	ScanRunning   = "running"
+	ScanCompleted = "completed"
+	ScanFailed    = "failed"
+)
+
+// DuplicateReport is the outcome of a scan for records with identical values
+type DuplicateReport struct {
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Scanned    int        `json:"scanned_records"`
+
+	// Duplicates counts the records sharing their value with an earlier one,
+	// i.e. the records that could be removed
+	Duplicates int                 `json:"duplicate_records"`
+	Clusters   []*DuplicateCluster `json:"clusters"`
+	Truncated  bool                `json:"truncated,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// DuplicateCluster lists the IDs of records whose values hash the same
+type DuplicateCluster struct {
+	Hash  string   `json:"hash"`
+	Count int      `json:"count"`
+	IDs   []string `json:"ids"`
+}
+
+// IntegrityReport is the outcome of re-hashing stored values and comparing
+// them with their stored hashes
+type IntegrityReport struct {
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Scanned    int        `json:"scanned_records"`
+
+	// Unhashed counts records written before hashes were kept
+	Unhashed   int                  `json:"unhashed_records"`
+	Mismatched int                  `json:"mismatched_records"`
+	Mismatches []*IntegrityMismatch `json:"mismatches"`
+	Truncated  bool                 `json:"truncated,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// IntegrityMismatch is a record whose value no longer matches its hash
+type IntegrityMismatch struct {
+	ID           string `json:"id"`
+	StoredHash   string `json:"stored_hash"`
+	ComputedHash string `json:"computed_hash"`
+}
+
+// Replication conflict policies. A change conflicts when it finds the
+// secondary out of step: an insert of a record the secondary already holds
+// with a different value, or an update of a record the secondary lacks
+const (
+	ConflictSourceWins = "source-wins"
+	ConflictTargetWins = "target-wins"
+)
+
+// ReplicationStatus describes the replication of changes to the secondary
+type ReplicationStatus struct {
+	ConflictPolicy string `json:"conflict_policy"`
+
+	// Cursor is the completion time of the last replicated change
+	Cursor     time.Time `json:"cursor"`
+	LagSeconds float64   `json:"lag_seconds"`
+
+	Applied   int64  `json:"applied"`
+	Unchanged int64  `json:"unchanged"`
+	Conflicts int64  `json:"conflicts"`
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+
+	// Backfill is the running or last backfill, nil when none was started
+	Backfill *BackfillReport `json:"backfill,omitempty"`
+}
+
+// BackfillReport is the outcome of copying every record to the secondary
+type BackfillReport struct {
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Scanned    int        `json:"scanned_records"`
+	Copied     int        `json:"copied_records"`
+	Conflicts  int        `json:"conflicts"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ExportPage is a page of records exported in ID order
+type ExportPage struct {
+	Records []*Record `json:"records"`
+
+	// NextAfterID continues the export, empty on the last page
+	NextAfterID string `json:"next_after_id,omitempty"`
+}
+
+// ImportRequest is a batch of records written directly to the repository,
+// bypassing the inbox, write transforms and script rules
+type ImportRequest struct {
+	Records []*Record `json:"records"`
+
+	// Overwrite replaces existing records holding a different value,
+	// otherwise they are kept and counted as skipped
+	Overwrite bool `json:"overwrite"`
+
+	// DryRun only counts what the import would do
+	DryRun bool `json:"dry_run"`
+}
+
+// ImportResult counts what an import did, or would do in a dry run
+type ImportResult struct {
+	DryRun    bool           `json:"dry_run"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Skipped   int            `json:"skipped"`
+	Failed    int            `json:"failed"`
+	Errors    []*ImportError `json:"errors,omitempty"`
+}
+
+// ImportError is a record that could not be imported
+type ImportError struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// CloneRequest copies the records of another instance into this one through
+// the source's export endpoint
+type CloneRequest struct {
+	SourceURL string `json:"source_url"`
+
+	// SourceToken is the admin token of the source instance
+	SourceToken string `json:"source_token,omitempty"`
+
+	// Only records whose ID starts with Prefix and not with ExcludePrefix
+	Prefix        string `json:"prefix,omitempty"`
+	ExcludePrefix string `json:"exclude_prefix,omitempty"`
+
+	Overwrite bool `json:"overwrite"`
+	DryRun    bool `json:"dry_run"`
+}
+
+// CloneReport is the outcome of cloning records from another instance
+type CloneReport struct {
+	Status     string     `json:"status"`
+	SourceURL  string     `json:"source_url"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Pages      int        `json:"pages"`
+	Fetched    int        `json:"fetched_records"`
+	ImportResult
+	Error string `json:"error,omitempty"`
+}
+
+// ObjectInfo describes a file in an object store
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// IngestPending is the status of a file waiting to be ingested; running,
+// completed and failed files use the scan statuses
+const IngestPending = "pending"
+
+// IngestFile is the progress of ingesting one file of the watched bucket
+type IngestFile struct {
+	Key        string     `json:"key"`
+	ETag       string     `json:"etag"`
+	Size       int64      `json:"size"`
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	// Rows counts the lines read, Resumed those skipped because an earlier
+	// attempt imported them, Invalid those the mapping rejected
+	Rows    int `json:"rows"`
+	Resumed int `json:"resumed"`
+	Invalid int `json:"invalid"`
+	ImportResult
+	Error string `json:"error,omitempty"`
+}
+
+// IngestNotification announces new files to ingest: either Keys, or the
+// Records of an S3 event notification, whose keys are URL-encoded
+type IngestNotification struct {
+	Keys    []string `json:"keys,omitempty"`
+	Records []struct {
+		S3 struct {
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records,omitempty"`
+}
+
+// SearchIndexStatus is the progress of mirroring records into the search index
+type SearchIndexStatus struct {
+	Index string `json:"index"`
+
+	// Cursor is the completion time of the last indexed change
+	Cursor     time.Time `json:"cursor"`
+	LagSeconds float64   `json:"lag_seconds"`
+
+	Indexed   int64  `json:"indexed"`
+	Deleted   int64  `json:"deleted"`
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+
+	// Reindex is the running or last reindex, nil when none was started
+	Reindex *ReindexReport `json:"reindex,omitempty"`
+}
+
+// ReindexReport is the outcome of indexing every record
+type ReindexReport struct {
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Scanned    int        `json:"scanned_records"`
+	Indexed    int        `json:"indexed_records"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// AnalyticsStatus is the progress of the analytics export
+type AnalyticsStatus struct {
+	Warehouse string `json:"warehouse"`
+
+	// Cursor is the completion time of the last exported task
+	Cursor      time.Time  `json:"cursor"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+
+	ExportedChanges int64 `json:"exported_changes"`
+	ExportedTasks   int64 `json:"exported_tasks"`
+
+	Failures            int64  `json:"failures"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+
+	// Alerting is set while a failure alert is open
+	Alerting bool `json:"alerting"`
+}
+
+// Analytics alert types
+const (
+	AnalyticsAlertFailing   = "failing"
+	AnalyticsAlertRecovered = "recovered"
+)
+
+// AnalyticsAlert is posted to the alert webhook when the export keeps
+// failing and when it recovers
+type AnalyticsAlert struct {
+	Type      string    `json:"type"`
+	Warehouse string    `json:"warehouse"`
+	Failures  int       `json:"consecutive_failures"`
+	Error     string    `json:"error,omitempty"`
+	Cursor    time.Time `json:"cursor"`
+}
+
+// FailedTaskDigest summarizes the tasks that failed for good, exhausting
+// their retries, between From and To
+type FailedTaskDigest struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Total int       `json:"total"`
+
+	ByOperation map[string]int `json:"by_operation"`
+
+	// Groups counts the failures by operation and error class, largest first
+	Groups []*FailedTaskGroup `json:"groups"`
+}
+
+// FailedTaskGroup is the failures of one operation with one error class
+type FailedTaskGroup struct {
+	Operation  string `json:"operation"`
+	ErrorClass string `json:"error_class"`
+	Count      int    `json:"count"`
+
+	// SampleIDs are the first failed tasks, SampleError the full error of
+	// the first one
+	SampleIDs   []string `json:"sample_ids"`
+	SampleError string   `json:"sample_error"`
+}
+
+// Reprocess sources
+const (
+	ReprocessSourceTasks   = "tasks"
+	ReprocessSourceHistory = "history"
 )
+
+// ReprocessRequest selects finished writes to run through the processing
+// pipeline again, e.g. after fixing a transformation
+type ReprocessRequest struct {
+	// Source is "tasks", the finished inbox tasks, or "history"
+	Source string `json:"source"`
+
+	// From and To bound the time the tasks finished, To defaults to now
+	From time.Time  `json:"from"`
+	To   *time.Time `json:"to,omitempty"`
+
+	// FromID and ToID bound the record IDs, both inclusive and optional
+	FromID string `json:"from_id,omitempty"`
+	ToID   string `json:"to_id,omitempty"`
+
+	// Operations and Statuses filter the tasks, Statuses defaults to
+	// completed and failed
+	Operations []string `json:"operations,omitempty"`
+	Statuses   []string `json:"statuses,omitempty"`
+
+	// Rate is the number of tasks enqueued per second
+	Rate float64 `json:"rate,omitempty"`
+
+	// Limit stops after this many matching tasks, 0 for no limit
+	Limit int `json:"limit,omitempty"`
+
+	// DryRun reports the matching tasks without enqueuing anything
+	DryRun bool `json:"dry_run"`
+}
+
+// ReprocessReport is the outcome of a reprocessing run
+type ReprocessReport struct {
+	Status     string            `json:"status"`
+	Request    *ReprocessRequest `json:"request"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+
+	// Scanned tasks were read, Matched passed the filters; of those
+	// Enqueued were queued again, Skipped target records that no longer
+	// exist and Failed were rejected, e.g. by schema validation
+	Scanned  int `json:"scanned_tasks"`
+	Matched  int `json:"matched_tasks"`
+	Enqueued int `json:"enqueued_tasks"`
+	Skipped  int `json:"skipped_tasks"`
+	Failed   int `json:"failed_tasks"`
+
+	// SampleIDs are the first matching tasks, Failures the first rejections
+	SampleIDs []string `json:"sample_ids"`
+	Failures  []string `json:"failures,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyRequest selects the completed tasks a verify run replays against the
+// shadow repository
+type VerifyRequest struct {
+	// From is the time the first replayed task finished; the replay runs
+	// until now so the shadow can be compared with the current records
+	From time.Time `json:"from"`
+
+	// FromID and ToID bound the record IDs, both inclusive and optional
+	FromID string `json:"from_id,omitempty"`
+	ToID   string `json:"to_id,omitempty"`
+
+	Operations []string `json:"operations,omitempty"`
+
+	// ApplyTransforms rewrites insert and update values with the current
+	// write transformations before they are applied, to preview a change
+	ApplyTransforms bool `json:"apply_transforms"`
+
+	// Limit stops after this many replayed tasks, 0 for no limit
+	Limit int `json:"limit,omitempty"`
+}
+
+// Divergence kinds
+const (
+	DivergenceApplyFailed      = "apply_failed"
+	DivergenceMissingInShadow  = "missing_in_shadow"
+	DivergenceMissingInPrimary = "missing_in_primary"
+	DivergenceValueMismatch    = "value_mismatch"
+	DivergenceTypeMismatch     = "type_mismatch"
+)
+
+// Divergence is a difference between the primary and the shadow repository
+type Divergence struct {
+	Kind     string `json:"kind"`
+	RecordID string `json:"record_id"`
+
+	// TaskID and Error are set when applying the task failed
+	TaskID string `json:"task_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Changes turn the primary value into the shadow value
+	Changes []*ValueChange `json:"changes,omitempty"`
+}
+
+// VerifyReport is the outcome of replaying tasks against the shadow
+type VerifyReport struct {
+	Status     string         `json:"status"`
+	Request    *VerifyRequest `json:"request"`
+	Shadow     string         `json:"shadow"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+
+	// Scanned tasks were read and Replayed applied to the shadow; Skipped
+	// tasks changed records the shadow did not have when the replay reached
+	// them, such records are not compared
+	Scanned  int `json:"scanned_tasks"`
+	Replayed int `json:"replayed_tasks"`
+	Skipped  int `json:"skipped_tasks"`
+
+	// Compared records were checked after the replay, Divergent of them
+	// differ or failed to apply
+	Compared  int `json:"compared_records"`
+	Divergent int `json:"divergent_records"`
+
+	// Divergences lists the first differences found
+	Divergences []*Divergence `json:"divergences"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Divergence kinds found while mirroring to the shadow
+const (
+	DivergenceWriteFailed = "write_failed"
+	DivergenceReadFailed  = "read_failed"
+)
+
+// ShadowStatus is the state of mirroring writes to the shadow repository
+type ShadowStatus struct {
+	MirroredWrites int64 `json:"mirrored_writes"`
+	FailedWrites   int64 `json:"failed_writes"`
+
+	// ReadSampleRate is the share of reads compared with the shadow
+	ReadSampleRate float64 `json:"read_sample_rate"`
+	ComparedReads  int64   `json:"compared_reads"`
+	MatchingReads  int64   `json:"matching_reads"`
+	DivergentReads int64   `json:"divergent_reads"`
+
+	// RecentDivergences are the last failed writes and divergent reads,
+	// newest first
+	RecentDivergences []*Divergence `json:"recent_divergences"`
+
+	Backfill *BackfillReport `json:"backfill,omitempty"`
+
+	// Primary is the backend serving records, BackendShadow after a cutover
+	Primary string `json:"primary"`
+
+	Cutover *CutoverReport `json:"cutover,omitempty"`
+}
+
+// Backends a cutover moves records between
+const (
+	BackendOriginal = "original"
+	BackendShadow   = "shadow"
+)
+
+// CutoverRequest configures promoting the shadow backend to primary
+type CutoverRequest struct {
+	// Force promotes without a completed backfill and keeps the promotion
+	// when the verification finds divergences
+	Force bool `json:"force"`
+
+	// VerifyLimit compares at most this many records after switching, 0 for
+	// all of them
+	VerifyLimit int `json:"verify_limit,omitempty"`
+}
+
+// CutoverReport is the outcome of swapping the primary and shadow backends
+type CutoverReport struct {
+	Status     string          `json:"status"`
+	Request    *CutoverRequest `json:"request"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+
+	// From and To are the backends serving records before and after
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// DrainSeconds is how long the worker took to finish its claimed tasks
+	DrainSeconds float64 `json:"drain_seconds"`
+
+	// Compared records of the previous primary were read from the new one,
+	// Divergent of them are missing or differ
+	Compared    int           `json:"compared_records"`
+	Divergent   int           `json:"divergent_records"`
+	Divergences []*Divergence `json:"divergences"`
+
+	// RolledBack is set when the divergences switched the backends back
+	RolledBack bool `json:"rolled_back"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// StartupStatus is the response of the startup probe
+type StartupStatus struct {
+	Ready bool          `json:"ready"`
+	Steps []StartupStep `json:"steps"`
+}
+
+// StartupStep is one step an instance completes before it takes traffic
+type StartupStep struct {
+	Name        string     `json:"name"`
+	Done        bool       `json:"done"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Detail      string     `json:"detail,omitempty"`
+}
+
+// ReadinessStatus is the response of the readiness probe
+type ReadinessStatus struct {
+	Ready  bool            `json:"ready"`
+	Worker *WorkerLiveness `json:"worker"`
+
+	// Age of the oldest pending task in seconds, zero without a backlog
+	OldestPendingAgeSeconds float64 `json:"oldest_pending_age_seconds"`
+
+	// Issues explains why the instance is not ready
+	Issues []string `json:"issues,omitempty"`
+}
+
+// SchemaReport compares the live database schema with the one the service
+// expects
+type SchemaReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	InSync    bool      `json:"in_sync"`
+
+	// ExpectedMigrationVersion is the migration databases migrated with
+	// migrate must be at
+	ExpectedMigrationVersion int            `json:"expected_migration_version"`
+	Drift                    []*SchemaDrift `json:"drift"`
+}
+
+// SchemaDrift is a difference between the live schema and the expected one
+type SchemaDrift struct {
+	Table  string `json:"table"`
+	Column string `json:"column,omitempty"`
+	Issue  string `json:"issue"`
+}
+
+// SelfTestReport is the outcome of a synthetic write/read cycle on a
+// throwaway record
+type SelfTestReport struct {
+	Passed   bool   `json:"passed"`
+	RecordID string `json:"record_id"`
+
+	// ViaInbox is set when the writes were queued and applied by the inbox
+	// worker rather than written to the repository directly
+	ViaInbox   bool            `json:"via_inbox"`
+	Steps      []*SelfTestStep `json:"steps"`
+	DurationMs float64         `json:"duration_ms"`
+}
+
+// SelfTestStep is one step of a self-test, e.g. "insert" or "get"
+type SelfTestStep struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// WorkerLiveness describes the inbox worker goroutines
+type WorkerLiveness struct {
+	Running      bool       `json:"running"`
+	Workers      int        `json:"workers"`
+	AliveWorkers int        `json:"alive_workers"`
+	LastSuccess  *time.Time `json:"last_success,omitempty"`
+
+	// Seconds since the last successfully processed task, -1 when none was
+	SinceLastSuccessSeconds float64 `json:"since_last_success_seconds"`
+}
+
+// QueryPlan is the EXPLAIN ANALYZE output of one query behind an endpoint
+type QueryPlan struct {
+	Name        string          `json:"name"`
+	Query       string          `json:"query"`
+	Args        []interface{}   `json:"args"`
+	PlanningMs  float64         `json:"planning_ms"`
+	ExecutionMs float64         `json:"execution_ms"`
+	Plan        json.RawMessage `json:"plan"`
+}
+
+// ExplainReport lists the query plans of an endpoint called with params
+type ExplainReport struct {
+	Endpoint string            `json:"endpoint"`
+	Params   map[string]string `json:"params,omitempty"`
+	Queries  []*QueryPlan      `json:"queries"`
+}
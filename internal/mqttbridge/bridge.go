@@ -0,0 +1,238 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+)
+
+// Message results recorded in metrics
+const (
+	ResultQueued    = "queued"    // the write task was queued
+	ResultInvalid   = "invalid"   // the payload is not a usable value, dropped
+	ResultRejected  = "rejected"  // the service refused the write, dropped
+	ResultFailed    = "failed"    // the write could not be queued, left for redelivery
+	ResultUnmatched = "unmatched" // no route matches the topic, dropped
+)
+
+// Writer queues record writes, implemented by *service.Service
+type Writer interface {
+	Insert(ctx context.Context, req *models.InsertRequest) (*models.InboxTask, error)
+	Update(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error)
+}
+
+// Config configures the bridge
+type Config struct {
+	// BrokerURL is the broker address, e.g. tcp://broker:1883 or ssl://broker:8883
+	BrokerURL string
+	ClientID  string
+	Username  string
+	Password  string
+
+	// QoS is the subscription QoS. With QoS 1 and 2 a message is acknowledged
+	// only once its write is queued, so the broker redelivers it otherwise
+	QoS byte
+
+	// CleanSession discards the broker session on connect; keep it off so
+	// messages published while the bridge is down are delivered later
+	CleanSession bool
+
+	Routes []Route
+
+	// WriteTimeout bounds queuing the write of one message; failed writes
+	// are retried WriteRetries times before the message is left unacknowledged
+	WriteTimeout time.Duration
+	WriteRetries int
+}
+
+// Bridge subscribes to the routed topics and queues their messages as writes
+type Bridge struct {
+	cfg     Config
+	writer  Writer
+	metrics *metrics.Metrics
+	client  mqtt.Client
+
+	// retryDelay is the first delay between write attempts, doubled after each
+	retryDelay time.Duration
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// New validates the configuration and returns a bridge that is not connected
+// yet
+func New(cfg Config, writer Writer, metrics *metrics.Metrics) (*Bridge, error) {
+	if cfg.BrokerURL == "" {
+		return nil, errors.New("MQTT broker URL is required")
+	}
+	if cfg.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d, use 0, 1 or 2", cfg.QoS)
+	}
+	if len(cfg.Routes) == 0 {
+		return nil, errors.New("at least one MQTT route is required")
+	}
+	for _, route := range cfg.Routes {
+		if err := route.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+
+	return &Bridge{
+		cfg:        cfg,
+		writer:     writer,
+		metrics:    metrics,
+		retryDelay: 200 * time.Millisecond,
+		stopCh:     make(chan struct{}),
+	}, nil
+}
+
+// Start connects to the broker. Subscriptions are made on every (re)connect;
+// an unreachable broker is retried in the background
+func (b *Bridge) Start() error {
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.cfg.BrokerURL).
+		SetClientID(b.cfg.ClientID).
+		SetUsername(b.cfg.Username).
+		SetPassword(b.cfg.Password).
+		SetCleanSession(b.cfg.CleanSession).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(true).
+		SetAutoAckDisabled(true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("MQTT bridge: connection lost: %v", err)
+			b.metrics.SetMQTTConnected(false)
+		})
+
+	b.client = mqtt.NewClient(opts)
+	token := b.client.Connect()
+	if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+	}
+	return nil
+}
+
+// Stop disconnects from the broker, waiting briefly for the message in
+// progress
+func (b *Bridge) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+		if b.client != nil {
+			b.client.Disconnect(1000)
+		}
+		b.metrics.SetMQTTConnected(false)
+	})
+}
+
+// onConnect subscribes to the route filters
+func (b *Bridge) onConnect(client mqtt.Client) {
+	b.metrics.SetMQTTConnected(true)
+
+	filters := make(map[string]byte, len(b.cfg.Routes))
+	for _, route := range b.cfg.Routes {
+		filters[route.Filter] = b.cfg.QoS
+	}
+
+	token := client.SubscribeMultiple(filters, func(_ mqtt.Client, msg mqtt.Message) {
+		if b.handle(msg.Topic(), msg.Payload()) != ResultFailed {
+			msg.Ack()
+		}
+	})
+	if token.Wait() && token.Error() != nil {
+		log.Printf("MQTT bridge: failed to subscribe: %v", token.Error())
+		return
+	}
+	log.Printf("MQTT bridge: connected to %s, subscribed to %d topic filters", b.cfg.BrokerURL, len(filters))
+}
+
+// handle queues the write of a message and returns its result. Only a failed
+// write is worth redelivering, everything else would fail again
+func (b *Bridge) handle(topic string, payload []byte) string {
+	route, captures, ok := b.route(topic)
+	if !ok {
+		b.metrics.RecordMQTTMessage("", ResultUnmatched)
+		return ResultUnmatched
+	}
+
+	result := b.write(route, topic, captures, payload)
+	b.metrics.RecordMQTTMessage(route.Filter, result)
+	return result
+}
+
+// route returns the first route matching the topic
+func (b *Bridge) route(topic string) (Route, []string, bool) {
+	for _, route := range b.cfg.Routes {
+		if captures, ok := route.match(topic); ok {
+			return route, captures, true
+		}
+	}
+	return Route{}, nil, false
+}
+
+// write queues the write of a message, retrying failures
+func (b *Bridge) write(route Route, topic string, captures []string, payload []byte) string {
+	id := route.recordID(topic, captures)
+	value, err := decodeValue(payload)
+	if err != nil {
+		log.Printf("MQTT bridge: dropping message on %s: %v", topic, err)
+		return ResultInvalid
+	}
+
+	delay := b.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := b.queue(route.Operation, id, value)
+		if err == nil {
+			return ResultQueued
+		}
+		if isRejection(err) {
+			log.Printf("MQTT bridge: dropping %s of record %s from %s: %v", route.Operation, id, topic, err)
+			return ResultRejected
+		}
+		if attempt >= b.cfg.WriteRetries {
+			log.Printf("MQTT bridge: failed to queue %s of record %s from %s, leaving it for redelivery: %v", route.Operation, id, topic, err)
+			return ResultFailed
+		}
+
+		select {
+		case <-b.stopCh:
+			return ResultFailed
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// queue queues one write
+func (b *Bridge) queue(operation, id string, value json.RawMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.WriteTimeout)
+	defer cancel()
+
+	var err error
+	if operation == models.TaskOperationInsert {
+		_, err = b.writer.Insert(ctx, &models.InsertRequest{ID: id, Value: value})
+	} else {
+		_, err = b.writer.Update(ctx, &models.UpdateRequest{ID: id, Value: value})
+	}
+	return err
+}
+
+// isRejection reports whether the service refused the write itself, as
+// opposed to failing to queue it
+func isRejection(err error) bool {
+	return errors.Is(err, models.ErrSchemaValidation) ||
+		errors.Is(err, models.ErrUnknownRecordType) ||
+		errors.Is(err, models.ErrRecordNotFound)
+}
@@ -0,0 +1,145 @@
+package mqttbridge
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+)
+
+// fakeWriter records queued writes and fails the next failures of them
+type fakeWriter struct {
+	failures int
+	err      error
+
+	inserts []*models.InsertRequest
+	updates []*models.UpdateRequest
+}
+
+func (w *fakeWriter) Insert(ctx context.Context, req *models.InsertRequest) (*models.InboxTask, error) {
+	if w.failures > 0 {
+		w.failures--
+		return nil, w.err
+	}
+	w.inserts = append(w.inserts, req)
+	return &models.InboxTask{ID: "task"}, nil
+}
+
+func (w *fakeWriter) Update(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error) {
+	if w.failures > 0 {
+		w.failures--
+		return nil, w.err
+	}
+	w.updates = append(w.updates, req)
+	return &models.InboxTask{ID: "task"}, nil
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("devices/+/state=update:device-{1}, sensors/#=insert")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Route{
+		{Filter: "devices/+/state", Operation: "update", IDTemplate: "device-{1}"},
+		{Filter: "sensors/#", Operation: "insert", IDTemplate: "{topic}"},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, routes)
+	}
+
+	for _, spec := range []string{
+		"devices/+/state",
+		"devices/+/state=delete",
+		"devices/#/state=insert",
+		"devices/a+/state=insert",
+		"devices/+/state=insert:device-{2}",
+		"devices/+/state=insert:device-{1",
+	} {
+		if _, err := ParseRoutes(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestRoute_Match(t *testing.T) {
+	tests := []struct {
+		filter   string
+		topic    string
+		captures []string
+		ok       bool
+	}{
+		{"devices/+/state", "devices/d1/state", []string{"d1"}, true},
+		{"devices/+/state", "devices/d1/state/extra", nil, false},
+		{"devices/+/state", "devices/d1", nil, false},
+		{"sensors/#", "sensors/hall/temp", []string{"hall/temp"}, true},
+		{"sensors/#", "sensors", []string{""}, true},
+		{"#", "$SYS/broker/load", nil, false},
+		{"a/b", "a/b", nil, true},
+	}
+
+	for _, tt := range tests {
+		captures, ok := Route{Filter: tt.filter}.match(tt.topic)
+		if ok != tt.ok || (ok && !reflect.DeepEqual(captures, tt.captures)) {
+			t.Errorf("%s on %s: expected %v %v, got %v %v", tt.filter, tt.topic, tt.captures, tt.ok, captures, ok)
+		}
+	}
+}
+
+func TestBridge_Handle(t *testing.T) {
+	routes, err := ParseRoutes("devices/+/state=update:device-{1},sensors/+/+=insert:{1}.{2}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	writer := &fakeWriter{}
+	bridge, err := New(Config{BrokerURL: "tcp://localhost:1883", QoS: 1, Routes: routes}, writer, metrics.NewMetrics())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bridge.retryDelay = 0
+
+	tests := []struct {
+		topic    string
+		payload  string
+		expected string
+	}{
+		{"devices/d1/state", `{"on": true}`, ResultQueued},
+		{"sensors/hall/temp", `21.5`, ResultQueued},
+		{"sensors/hall/temp", `not json`, ResultInvalid},
+		{"sensors/hall/temp", `{}`, ResultInvalid},
+		{"lights/l1", `{"on": true}`, ResultUnmatched},
+	}
+	for _, tt := range tests {
+		if result := bridge.handle(tt.topic, []byte(tt.payload)); result != tt.expected {
+			t.Errorf("%s %s: expected %s, got %s", tt.topic, tt.payload, tt.expected, result)
+		}
+	}
+
+	if len(writer.updates) != 1 || writer.updates[0].ID != "device-d1" || string(writer.updates[0].Value) != `{"on": true}` {
+		t.Errorf("Expected update of device-d1, got %+v", writer.updates)
+	}
+	if len(writer.inserts) != 1 || writer.inserts[0].ID != "hall.temp" || string(writer.inserts[0].Value) != `{"value":21.5}` {
+		t.Errorf("Expected insert of hall.temp wrapping the value, got %+v", writer.inserts)
+	}
+
+	// Failures to queue are retried, then left for redelivery
+	writer.err = errors.New("database unavailable")
+	writer.failures = 2
+	bridge.cfg.WriteRetries = 2
+	if result := bridge.handle("devices/d2/state", []byte(`{"on": false}`)); result != ResultQueued {
+		t.Errorf("Expected the write queued after retries, got %s", result)
+	}
+	writer.failures = 3
+	if result := bridge.handle("devices/d2/state", []byte(`{"on": false}`)); result != ResultFailed {
+		t.Errorf("Expected the write failed after retries, got %s", result)
+	}
+
+	// Writes the service refuses are dropped without retrying
+	writer.err = models.ErrSchemaValidation
+	writer.failures = 1
+	if result := bridge.handle("devices/d3/state", []byte(`{"on": 1}`)); result != ResultRejected {
+		t.Errorf("Expected the write rejected, got %s", result)
+	}
+}
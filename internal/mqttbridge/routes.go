@@ -0,0 +1,155 @@
+// Package mqttbridge subscribes to MQTT topics and turns the messages into
+// insert and update tasks, for writers that cannot speak HTTP reliably
+package mqttbridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mit-service/internal/models"
+)
+
+// Route maps messages of a topic filter to writes
+type Route struct {
+	// Filter is an MQTT topic filter, + and # wildcards allowed
+	Filter string
+
+	// Operation is models.TaskOperationInsert or models.TaskOperationUpdate
+	Operation string
+
+	// IDTemplate builds the record ID from the topic: {topic} is the whole
+	// topic, {1}, {2}, ... the topic levels matched by the wildcards in order
+	IDTemplate string
+}
+
+// ParseRoutes parses routes in the form "filter=operation[:id template]",
+// e.g. "devices/+/state=update:device-{1},sensors/#=insert". Without a
+// template the topic is the record ID
+func ParseRoutes(spec string) ([]Route, error) {
+	var routes []Route
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		filter, target, ok := strings.Cut(entry, "=")
+		if !ok || filter == "" {
+			return nil, fmt.Errorf("invalid MQTT route %q, expected filter=operation[:id template]", entry)
+		}
+		operation, template, _ := strings.Cut(target, ":")
+		if template == "" {
+			template = "{topic}"
+		}
+
+		route := Route{Filter: filter, Operation: operation, IDTemplate: template}
+		if err := route.validate(); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// validate checks the operation, the filter wildcards and the template
+// placeholders
+func (r Route) validate() error {
+	if r.Operation != models.TaskOperationInsert && r.Operation != models.TaskOperationUpdate {
+		return fmt.Errorf("MQTT route %s: unknown operation %q, use insert or update", r.Filter, r.Operation)
+	}
+
+	levels := strings.Split(r.Filter, "/")
+	wildcards := 0
+	for i, level := range levels {
+		switch {
+		case level == "+":
+			wildcards++
+		case level == "#":
+			if i != len(levels)-1 {
+				return fmt.Errorf("MQTT route %s: # must be the last level", r.Filter)
+			}
+			wildcards++
+		case strings.ContainsAny(level, "+#"):
+			return fmt.Errorf("MQTT route %s: wildcards must fill a whole level", r.Filter)
+		}
+	}
+
+	for rest := r.IDTemplate; ; {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			return nil
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return fmt.Errorf("MQTT route %s: unclosed placeholder in %q", r.Filter, r.IDTemplate)
+		}
+		name := rest[start+1 : start+end]
+		if name != "topic" {
+			n, err := strconv.Atoi(name)
+			if err != nil || n < 1 || n > wildcards {
+				return fmt.Errorf("MQTT route %s: unknown placeholder {%s}, the filter has %d wildcards", r.Filter, name, wildcards)
+			}
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+// match returns the topic levels matched by the wildcards of the filter, and
+// whether the topic matches at all
+func (r Route) match(topic string) ([]string, bool) {
+	filterLevels := strings.Split(r.Filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	// Wildcards at the first level do not match topics starting with $
+	if strings.HasPrefix(topic, "$") && (filterLevels[0] == "+" || filterLevels[0] == "#") {
+		return nil, false
+	}
+
+	var captures []string
+	for i, level := range filterLevels {
+		if level == "#" {
+			return append(captures, strings.Join(topicLevels[i:], "/")), true
+		}
+		if i >= len(topicLevels) {
+			return nil, false
+		}
+		switch level {
+		case "+":
+			captures = append(captures, topicLevels[i])
+		case topicLevels[i]:
+		default:
+			return nil, false
+		}
+	}
+	return captures, len(filterLevels) == len(topicLevels)
+}
+
+// recordID fills the ID template with the topic and the wildcard captures
+func (r Route) recordID(topic string, captures []string) string {
+	replacements := []string{"{topic}", topic}
+	for i, capture := range captures {
+		replacements = append(replacements, "{"+strconv.Itoa(i+1)+"}", capture)
+	}
+	return strings.NewReplacer(replacements...).Replace(r.IDTemplate)
+}
+
+// decodeValue returns the record value of a message payload. JSON objects
+// are used as they are, other JSON values are wrapped as {"value": ...}
+func decodeValue(payload []byte) (json.RawMessage, error) {
+	var value json.RawMessage
+	if err := models.UnmarshalValue(payload, &value); err != nil {
+		return nil, fmt.Errorf("payload is not JSON: %w", err)
+	}
+	if string(value) == "null" {
+		return nil, fmt.Errorf("payload is null")
+	}
+	if models.IsObjectValue(value) {
+		if models.IsEmptyValue(value) {
+			return nil, fmt.Errorf("payload is an empty object")
+		}
+		return value, nil
+	}
+	return json.RawMessage(`{"value":` + string(value) + `}`), nil
+}
@@ -0,0 +1,208 @@
+// Package notify delivers failed task digests to Slack and by email
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// FormatDigest renders a digest as plain text, one line per operation and
+// per error class followed by the sample task IDs
+func FormatDigest(digest *models.FailedTaskDigest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d failed tasks between %s and %s\n",
+		digest.Total, digest.From.UTC().Format(time.RFC3339), digest.To.UTC().Format(time.RFC3339))
+
+	operations := make([]string, 0, len(digest.ByOperation))
+	for operation := range digest.ByOperation {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		fmt.Fprintf(&b, "  %s: %d\n", operation, digest.ByOperation[operation])
+	}
+
+	for _, group := range digest.Groups {
+		fmt.Fprintf(&b, "\n%d × %s: %s\n", group.Count, group.Operation, group.ErrorClass)
+		fmt.Fprintf(&b, "  e.g. %s\n", strings.Join(group.SampleIDs, ", "))
+	}
+	return b.String()
+}
+
+// Slack posts digests to a Slack incoming webhook
+type Slack struct {
+	webhookURL string
+	http       *http.Client
+}
+
+// NewSlack creates a Slack sender for an incoming webhook URL
+func NewSlack(webhookURL string, timeout time.Duration) (*Slack, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.New("invalid Slack webhook URL")
+	}
+	return &Slack{webhookURL: webhookURL, http: &http.Client{Timeout: timeout}}, nil
+}
+
+// Name returns the target name used in logs and metrics
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+// Send posts the digest as a preformatted message
+func (s *Slack) Send(ctx context.Context, digest *models.FailedTaskDigest) error {
+	body, err := json.Marshal(map[string]string{"text": "```" + FormatDigest(digest) + "```"})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		// The webhook URL is a secret, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to post to Slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Slack returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// SMTPConfig configures the mail server digests are sent through
+type SMTPConfig struct {
+	// Addr is the host:port of the server, STARTTLS is used when offered
+	Addr string
+
+	// Username and Password authenticate with PLAIN auth when set
+	Username string
+	Password string
+
+	From string
+	To   []string
+
+	// Timeout bounds connecting and sending
+	Timeout time.Duration
+}
+
+// SMTP mails digests
+type SMTP struct {
+	cfg  SMTPConfig
+	host string
+}
+
+// NewSMTP creates an SMTP sender
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %w", cfg.Addr, err)
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("SMTP needs a sender and at least one recipient")
+	}
+	for _, address := range append([]string{cfg.From}, cfg.To...) {
+		if strings.ContainsAny(address, "\r\n") {
+			return nil, fmt.Errorf("invalid email address %q", address)
+		}
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("SMTP timeout must be positive, got %v", cfg.Timeout)
+	}
+	return &SMTP{cfg: cfg, host: host}, nil
+}
+
+// Name returns the target name used in logs and metrics
+func (s *SMTP) Name() string {
+	return "smtp"
+}
+
+// Send mails the digest to every recipient
+func (s *SMTP) Send(ctx context.Context, digest *models.FailedTaskDigest) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s.cfg.Addr, err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range s.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(digest)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message builds the mail with headers and CRLF line endings
+func (s *SMTP) message(digest *models.FailedTaskDigest) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: [mit-service] %d failed tasks\r\n", digest.Total)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(FormatDigest(digest), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func testDigest() *models.FailedTaskDigest {
+	from := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	return &models.FailedTaskDigest{
+		From:        from,
+		To:          from.Add(time.Hour),
+		Total:       3,
+		ByOperation: map[string]int{"update": 2, "insert": 1},
+		Groups: []*models.FailedTaskGroup{
+			{Operation: "update", ErrorClass: "record not found", Count: 2, SampleIDs: []string{"task_1", "task_2"}},
+			{Operation: "insert", ErrorClass: "record already exists", Count: 1, SampleIDs: []string{"task_3"}},
+		},
+	}
+}
+
+func TestFormatDigest(t *testing.T) {
+	text := FormatDigest(testDigest())
+	for _, expected := range []string{
+		"3 failed tasks between 2024-01-01T10:00:00Z and 2024-01-01T11:00:00Z",
+		"  insert: 1\n  update: 2\n",
+		"2 × update: record not found\n  e.g. task_1, task_2",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q in digest, got:\n%s", expected, text)
+		}
+	}
+}
+
+func TestSlack_Send(t *testing.T) {
+	var text string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		text = body["text"]
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	slack, err := NewSlack(server.URL+"/hooks/secret", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := slack.Send(context.Background(), testDigest()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(text, "record not found") {
+		t.Errorf("Expected the digest posted, got %q", text)
+	}
+
+	status = http.StatusForbidden
+	if err := slack.Send(context.Background(), testDigest()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the status in the error, got %v", err)
+	}
+
+	server.Close()
+	if err := slack.Send(context.Background(), testDigest()); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected an error without the webhook URL, got %v", err)
+	}
+}
+
+// serveSMTP accepts one connection and answers the commands of a plain SMTP
+// session, returning the received message
+func serveSMTP(listener net.Listener) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250 localhost")
+			case command == "DATA":
+				inData = true
+				reply("354 Go ahead")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return received
+}
+
+func TestSMTP_Send(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+	received := serveSMTP(listener)
+
+	sender, err := NewSMTP(SMTPConfig{
+		Addr:    listener.Addr().String(),
+		From:    "mit-service@example.com",
+		To:      []string{"ops@example.com", "oncall@example.com"},
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := sender.Send(context.Background(), testDigest()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	message := <-received
+	for _, expected := range []string{
+		"To: ops@example.com, oncall@example.com\r\n",
+		"Subject: [mit-service] 3 failed tasks\r\n",
+		"2 × update: record not found\r\n",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected %q in message, got:\n%s", expected, message)
+		}
+	}
+}
+
+func TestNewSMTP_Invalid(t *testing.T) {
+	for _, cfg := range []SMTPConfig{
+		{Addr: "localhost", From: "a@example.com", To: []string{"b@example.com"}, Timeout: time.Second},
+		{Addr: "localhost:25", To: []string{"b@example.com"}, Timeout: time.Second},
+		{Addr: "localhost:25", From: "a@example.com", Timeout: time.Second},
+		{Addr: "localhost:25", From: "a@example.com\r\nBcc: c@example.com", To: []string{"b@example.com"}, Timeout: time.Second},
+		{Addr: "localhost:25", From: "a@example.com", To: []string{"b@example.com"}},
+	} {
+		if _, err := NewSMTP(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Package objectstore reads files from object storage
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"mit-service/internal/models"
+)
+
+// S3Store reads the objects of one S3 bucket
+type S3Store struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3Store creates a store using the default AWS credential chain. An
+// endpoint selects an S3-compatible service such as MinIO, addressed with
+// path-style URLs
+func NewS3Store(ctx context.Context, bucket, region, endpoint string) (*S3Store, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &S3Store{client: client, bucket: bucket}, nil
+}
+
+// List returns the objects under prefix in key order
+func (s *S3Store) List(ctx context.Context, prefix string) ([]*models.ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	var objects []*models.ObjectInfo
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %w", s.bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, &models.ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				ETag:         strings.Trim(aws.ToString(object.ETag), `"`),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// Open returns the content of an object
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return out.Body, nil
+}
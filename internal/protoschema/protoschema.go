@@ -0,0 +1,88 @@
+// Package protoschema validates protobuf encoded record values against a
+// message of a registered descriptor set and renders them as JSON
+package protoschema
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Schema is a compiled protobuf message type
+type Schema struct {
+	message protoreflect.MessageType
+
+	// types resolves the extensions and Any fields of the descriptor set
+	types *dynamicpb.Types
+}
+
+// Compile builds the message named message, e.g. "acme.v1.User", from a
+// serialized FileDescriptorSet as written by
+// protoc --include_imports --descriptor_set_out
+func Compile(descriptorSet []byte, message string) (*Schema, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("message %q: %w", message, err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message", message)
+	}
+
+	return &Schema{
+		message: dynamicpb.NewMessageType(messageDescriptor),
+		types:   dynamicpb.NewTypes(files),
+	}, nil
+}
+
+// Validate checks that data is an encoded message of the schema with all
+// required fields set
+func (s *Schema) Validate(data []byte) error {
+	_, err := s.decode(data)
+	return err
+}
+
+// JSON renders an encoded message as a JSON object, using the proto field
+// names
+func (s *Schema) JSON(data []byte) (map[string]interface{}, error) {
+	message, err := s.decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := protojson.MarshalOptions{UseProtoNames: true, Resolver: s.types}.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", s.message.Descriptor().FullName(), err)
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", s.message.Descriptor().FullName(), err)
+	}
+	return value, nil
+}
+
+// decode unmarshals data into a new message of the schema
+func (s *Schema) decode(data []byte) (proto.Message, error) {
+	message := s.message.New().Interface()
+	if err := (proto.UnmarshalOptions{Resolver: s.types}).Unmarshal(data, message); err != nil {
+		return nil, fmt.Errorf("not a valid %s: %w", s.message.Descriptor().FullName(), err)
+	}
+	return message, nil
+}
@@ -0,0 +1,89 @@
+package protoschema
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// userDescriptorSet describes acme.v1.User with a required name and an age
+func userDescriptorSet(t *testing.T) []byte {
+	t.Helper()
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("acme/v1/user.proto"),
+		Package: proto.String("acme.v1"),
+		Syntax:  proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name: proto.String("full_name"), Number: proto.Int32(1),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum(),
+					Type:  descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				{
+					Name: proto.String("age"), Number: proto.Int32(2),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:  descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+				},
+			},
+		}},
+	}}}
+
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("Failed to marshal descriptor set: %v", err)
+	}
+	return data
+}
+
+func TestSchema(t *testing.T) {
+	s, err := Compile(userDescriptorSet(t), "acme.v1.User")
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+
+	var user []byte
+	user = protowire.AppendTag(user, 1, protowire.BytesType)
+	user = protowire.AppendString(user, "Ada")
+	user = protowire.AppendTag(user, 2, protowire.VarintType)
+	user = protowire.AppendVarint(user, 36)
+
+	if err := s.Validate(user); err != nil {
+		t.Errorf("Expected valid message, got %v", err)
+	}
+	value, err := s.JSON(user)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value["full_name"] != "Ada" || value["age"] != 36.0 {
+		t.Errorf("Unexpected rendering %v", value)
+	}
+
+	// The required name is missing
+	var nameless []byte
+	nameless = protowire.AppendTag(nameless, 2, protowire.VarintType)
+	nameless = protowire.AppendVarint(nameless, 36)
+	if err := s.Validate(nameless); err == nil {
+		t.Error("Expected an error for a missing required field")
+	}
+	if err := s.Validate([]byte{0xff, 0xff}); err == nil {
+		t.Error("Expected an error for malformed data")
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	for name, message := range map[string]string{
+		"unknown message": "acme.v1.Account",
+		"not a message":   "acme.v1",
+	} {
+		if _, err := Compile(userDescriptorSet(t), message); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Compile([]byte("not a descriptor set"), "acme.v1.User"); err == nil {
+		t.Error("Expected an error for an invalid descriptor set")
+	}
+}
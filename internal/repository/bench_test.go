@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mit-service/internal/config"
+	"mit-service/internal/models"
+)
+
+// benchmarkBackends runs fn against every available backend. PostgreSQL is
+// configured with the DB_* variables and only used when E2E_POSTGRES is set
+func benchmarkBackends(b *testing.B, fn func(b *testing.B, repo Repository)) {
+	b.Run("mock", func(b *testing.B) {
+		fn(b, NewMockRepository())
+	})
+
+	b.Run("postgres", func(b *testing.B) {
+		if os.Getenv("E2E_POSTGRES") == "" {
+			b.Skip("set E2E_POSTGRES=1 to benchmark PostgreSQL")
+		}
+
+		repo, err := NewPostgresRepository(config.LoadConfig().Database.ConnectionString())
+		if err != nil {
+			b.Fatalf("Failed to connect to PostgreSQL: %v", err)
+		}
+		defer repo.Close()
+
+		fn(b, repo)
+	})
+}
+
+// benchPrefix makes record IDs unique per benchmark run
+func benchPrefix() string {
+	return fmt.Sprintf("bench_%d_", time.Now().UnixNano())
+}
+
+// benchValue is a small record value typical of the API
+var benchValue = map[string]interface{}{
+	"name":  "John Doe",
+	"email": "john@example.com",
+	"age":   30,
+}
+
+func BenchmarkInsert(b *testing.B) {
+	benchmarkBackends(b, func(b *testing.B, repo Repository) {
+		ctx := context.Background()
+		prefix := benchPrefix()
+		var n int64
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				id := fmt.Sprintf("%s%d", prefix, atomic.AddInt64(&n, 1))
+				if err := repo.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(benchValue)}); err != nil {
+					b.Fatalf("Insert failed: %v", err)
+				}
+			}
+		})
+		b.StopTimer()
+
+		cleanupBenchRecords(b, repo, prefix)
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkBackends(b, func(b *testing.B, repo Repository) {
+		ctx := context.Background()
+		prefix := benchPrefix()
+
+		const records = 1000
+		for i := 0; i < records; i++ {
+			id := fmt.Sprintf("%s%d", prefix, i)
+			if err := repo.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(benchValue)}); err != nil {
+				b.Fatalf("Insert failed: %v", err)
+			}
+		}
+		var n int64
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				id := fmt.Sprintf("%s%d", prefix, atomic.AddInt64(&n, 1)%records)
+				if _, err := repo.Get(ctx, id); err != nil {
+					b.Fatalf("Get failed: %v", err)
+				}
+			}
+		})
+		b.StopTimer()
+
+		cleanupBenchRecords(b, repo, prefix)
+	})
+}
+
+// cleanupBenchRecords removes the records a benchmark created
+func cleanupBenchRecords(b *testing.B, repo Repository, prefix string) {
+	ctx := context.Background()
+	for {
+		records, err := repo.ListRecords(ctx, models.RecordFilter{Prefix: prefix, Limit: 1000})
+		if err != nil {
+			b.Logf("Failed to clean up benchmark records: %v", err)
+			return
+		}
+		for _, record := range records {
+			if err := repo.Delete(ctx, record.ID); err != nil {
+				b.Logf("Failed to clean up benchmark records: %v", err)
+				return
+			}
+		}
+		if len(records) < 1000 {
+			return
+		}
+	}
+}
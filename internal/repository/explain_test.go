@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+// stubExplainer records the endpoints it explains
+type stubExplainer struct {
+	name      string
+	endpoints []string
+}
+
+func (e *stubExplainer) ExplainQueries(ctx context.Context, endpoint string, params url.Values, analyze bool) ([]*models.QueryPlan, error) {
+	e.endpoints = append(e.endpoints, endpoint)
+	return []*models.QueryPlan{{Name: e.name}}, nil
+}
+
+func TestExplainQueries_Routing(t *testing.T) {
+	ctx := context.Background()
+	records, inbox := &stubExplainer{name: "records"}, &stubExplainer{name: "inbox"}
+	m := &RepositoryManager{explainers: map[string]QueryExplainer{"records": records, "inbox_tasks": inbox}}
+
+	for endpoint, expected := range map[string]string{"/get": "records", "/records": "records", "/tasks": "inbox", "/stats": "inbox"} {
+		plans, err := m.ExplainQueries(ctx, endpoint, url.Values{"id": {"a"}}, true)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", endpoint, err)
+		}
+		if plans[0].Name != expected {
+			t.Errorf("%s: expected the %s database, got %s", endpoint, expected, plans[0].Name)
+		}
+	}
+
+	if _, err := m.ExplainQueries(ctx, "/insert", nil, true); !errors.Is(err, models.ErrInvalidExplain) {
+		t.Errorf("Expected ErrInvalidExplain, got %v", err)
+	}
+	mock := NewMockRepository()
+	unsupported := &RepositoryManager{Record: mock, Inbox: mock}
+	if _, err := unsupported.ExplainQueries(ctx, "/get", nil, true); !errors.Is(err, models.ErrExplainUnsupported) {
+		t.Errorf("Expected ErrExplainUnsupported, got %v", err)
+	}
+}
+
+func TestExplainedEndpoints_Queries(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		params   url.Values
+		queries  []string
+		err      bool
+	}{
+		{"/get", url.Values{"id": {"a"}}, []string{"Get"}, false},
+		{"/get", nil, nil, true},
+		{"/records", url.Values{"type": {"order"}, "limit": {"10"}}, []string{"ListRecords"}, false},
+		{"/records", url.Values{"limit": {"1000"}}, nil, true},
+		{"/tasks", url.Values{"status": {"failed"}}, []string{"ListTasks", "GetTaskStats"}, false},
+		{"/tasks", url.Values{"offset": {"-1"}}, nil, true},
+		{"/stats", nil, []string{"GetTaskStats"}, false},
+	}
+
+	for _, tt := range tests {
+		queries, err := explainedEndpoints[tt.endpoint].queries(tt.params)
+		if tt.err {
+			if !errors.Is(err, models.ErrInvalidExplain) {
+				t.Errorf("%s %v: expected ErrInvalidExplain, got %v", tt.endpoint, tt.params, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s %v: unexpected error: %v", tt.endpoint, tt.params, err)
+		}
+
+		var names []string
+		for _, q := range queries {
+			names = append(names, q.name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.queries, ",") {
+			t.Errorf("%s %v: expected %v, got %v", tt.endpoint, tt.params, tt.queries, names)
+		}
+	}
+
+	// The listing query is the one ListRecords runs
+	queries, _ := explainedEndpoints["/records"].queries(url.Values{"type": {"order"}})
+	if !strings.Contains(queries[0].query, "type = $1") || len(queries[0].args) != 4 {
+		t.Errorf("Unexpected listing query %q %v", queries[0].query, queries[0].args)
+	}
+}
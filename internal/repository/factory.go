@@ -1,8 +1,17 @@
 package repository
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log"
 	"mit-service/internal/config"
+	"mit-service/internal/metrics"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 // NewRepository creates a new repository based on configuration
@@ -23,34 +32,259 @@ func NewRepository(cfg *config.Config) (Repository, error) {
 	}
 }
 
-// NewRepositoryManager creates a new repository manager with separate DBs
-func NewRepositoryManager(cfg *config.Config) (*RepositoryManager, error) {
+// NewRepositoryManager creates a new repository manager with separate DBs,
+// or a shared one in single-database mode. When appMetrics is not nil every
+// repository call is instrumented
+func NewRepositoryManager(cfg *config.Config, appMetrics *metrics.Metrics) (*RepositoryManager, error) {
+	manager, err := newRepositoryManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return Instrument(manager, appMetrics), nil
+}
+
+// newRepositoryManager creates the uninstrumented repositories for the configured backend
+func newRepositoryManager(cfg *config.Config) (*RepositoryManager, error) {
 	switch cfg.Repository.Type {
 	case "postgres":
-		// Create separate repositories for main and inbox DBs
-		recordRepo, err := NewPostgresRecordRepository(cfg.Database.ConnectionString())
-		if err != nil {
-			return nil, fmt.Errorf("failed to create postgres record repository: %w", err)
+		switch cfg.Repository.DBMode {
+		case config.DBModeSingle:
+			repo, err := connectPostgres("main", &cfg.Database, &cfg.Repository)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Using single-database mode (%s)", cfg.Database.Address())
+
+			return &RepositoryManager{
+				Record:      repo,
+				Inbox:       repo,
+				Tx:          repo,
+				AccessStats: repo,
+				History:     historyStore(repo, &cfg.Repository),
+				tableStats:  sharedTableStats(repo),
+				explainers:  sharedExplainers(repo),
+				pools:       map[string]PoolStatsProvider{"main": repo},
+				schemas:     sharedSchemas(repo),
+			}, nil
+
+		case config.DBModeSplit, "":
+			if cfg.Database.ConnectionString() == cfg.InboxDB.ConnectionString() {
+				log.Printf("Main and inbox databases are identical (%s), sharing one connection pool",
+					cfg.Database.Address())
+
+				repo, err := connectPostgres("main", &cfg.Database, &cfg.Repository)
+				if err != nil {
+					return nil, err
+				}
+				return &RepositoryManager{
+					Record:      repo,
+					Inbox:       repo,
+					Tx:          repo,
+					AccessStats: repo,
+					History:     historyStore(repo, &cfg.Repository),
+					tableStats:  sharedTableStats(repo),
+					explainers:  sharedExplainers(repo),
+					pools:       map[string]PoolStatsProvider{"main": repo},
+					schemas:     sharedSchemas(repo),
+				}, nil
+			}
+
+			// Create separate repositories for main and inbox DBs
+			recordRepo, err := connectPostgres("main", &cfg.Database, &cfg.Repository)
+			if err != nil {
+				return nil, err
+			}
+
+			inboxRepo, err := connectPostgres("inbox", &cfg.InboxDB, &cfg.Repository)
+			if err != nil {
+				recordRepo.Close()
+				return nil, err
+			}
+
+			return &RepositoryManager{
+				Record:      recordRepo,
+				Inbox:       inboxRepo,
+				AccessStats: recordRepo,
+				History:     historyStore(recordRepo, &cfg.Repository),
+				tableStats: []tableStatsSource{
+					{provider: recordRepo, tables: []string{"records"}},
+					{provider: inboxRepo, tables: []string{"inbox_tasks"}},
+				},
+				explainers: map[string]QueryExplainer{"records": recordRepo, "inbox_tasks": inboxRepo},
+				pools:      map[string]PoolStatsProvider{"main": recordRepo, "inbox": inboxRepo},
+				schemas: []schemaSource{
+					{checker: recordRepo, tables: []string{"records"}},
+					{checker: inboxRepo, tables: []string{"inbox_tasks"}},
+				},
+			}, nil
+
+		default:
+			return nil, fmt.Errorf("unsupported database mode: %s", cfg.Repository.DBMode)
 		}
 
-		inboxRepo, err := NewPostgresInboxRepository(cfg.InboxDB.ConnectionString())
-		if err != nil {
-			return nil, fmt.Errorf("failed to create postgres inbox repository: %w", err)
+	case "mock":
+		repo := NewMockRepository()
+		manager := &RepositoryManager{
+			Record:      repo,
+			Inbox:       repo,
+			Tx:          repo,
+			AccessStats: repo,
+			History:     historyStore(repo, &cfg.Repository),
+			tableStats:  sharedTableStats(repo),
+		}
+
+		if cfg.Repository.SnapshotDir != "" {
+			store, err := NewSnapshotStore(cfg.Repository.SnapshotDir, repo)
+			if err != nil {
+				return nil, err
+			}
+			manager.Snapshots = store
+
+			if err := loadStartupSnapshot(store, cfg.Repository.SnapshotName); err != nil {
+				return nil, err
+			}
 		}
 
-		return &RepositoryManager{
-			Record: recordRepo,
-			Inbox:  inboxRepo,
-		}, nil
+		return manager, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported repository type: %s", cfg.Repository.Type)
+	}
+}
+
+// NewReplicaRepository connects to the secondary database changes are
+// replicated to. The mock backend replicates to a separate in-memory store
+func NewReplicaRepository(cfg *config.Config) (RecordRepository, error) {
+	switch cfg.Repository.Type {
+	case "postgres":
+		return connectPostgres("replica", &cfg.ReplicaDB, &cfg.Repository)
 
 	case "mock":
-		repo := NewMockRepository()
-		return &RepositoryManager{
-			Record: repo,
-			Inbox:  repo,
-		}, nil
+		return NewMockRepository(), nil
 
 	default:
 		return nil, fmt.Errorf("unsupported repository type: %s", cfg.Repository.Type)
 	}
 }
+
+// NewShadowRepository connects to the shadow database verify runs replay
+// tasks against. The mock backend uses a separate in-memory store
+func NewShadowRepository(cfg *config.Config) (RecordRepository, error) {
+	switch cfg.Repository.Type {
+	case "postgres":
+		return connectPostgres("shadow", &cfg.ShadowDB, &cfg.Repository)
+
+	case "mock":
+		return NewMockRepository(), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported repository type: %s", cfg.Repository.Type)
+	}
+}
+
+// loadStartupSnapshot restores the named snapshot if it was saved before, so
+// mock data survives restarts
+func loadStartupSnapshot(store *SnapshotStore, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	info, err := store.Load(context.Background(), name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("No snapshot '%s' to restore, starting empty", name)
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("Restored snapshot '%s' (%d records, %d tasks)", name, info.Records, info.Tasks)
+	return nil
+}
+
+// sharedExplainers explains the queries of both tables with a single repository
+func sharedExplainers(explainer QueryExplainer) map[string]QueryExplainer {
+	return map[string]QueryExplainer{"records": explainer, "inbox_tasks": explainer}
+}
+
+// sharedTableStats reports both tables from a single repository
+func sharedTableStats(provider TableStatsProvider) []tableStatsSource {
+	return []tableStatsSource{{provider: provider, tables: []string{"records", "inbox_tasks"}}}
+}
+
+// historyStore returns store when record history is enabled, nil otherwise
+func historyStore(store HistoryStore, repoCfg *config.RepositoryConfig) HistoryStore {
+	if !repoCfg.RecordHistory {
+		return nil
+	}
+	return store
+}
+
+// sharedSchemas checks both tables with a single repository
+func sharedSchemas(checker SchemaChecker) []schemaSource {
+	return []schemaSource{{checker: checker, tables: []string{"records", "inbox_tasks"}}}
+}
+
+// connectPostgres connects to a PostgreSQL database, retrying with exponential
+// backoff so the service tolerates databases that start after it does
+func connectPostgres(name string, dbCfg *config.DatabaseConfig, repoCfg *config.RepositoryConfig) (*PostgresRepository, error) {
+	connector, err := newConnector(dbCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s database (%s): %w", name, dbCfg.Address(), err)
+	}
+
+	backoff := repoCfg.ConnectBackoff
+	attempts := repoCfg.ConnectRetries + 1
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		repo, err := NewPostgresRepositoryWithConnector(connector, SchemaOptions{
+			RecordPartitions: repoCfg.RecordPartitions,
+			PartitionInbox:   repoCfg.PartitionInbox,
+			RecordHistory:    repoCfg.RecordHistory,
+		})
+		if err == nil {
+			repo.SetQueryTimeouts(repoCfg.ReadTimeout, repoCfg.WriteTimeout)
+			if attempt > 1 {
+				log.Printf("Connected to %s database (%s) after %d attempts", name, dbCfg.Address(), attempt)
+			}
+			return repo, nil
+		}
+		lastErr = err
+
+		if attempt == attempts {
+			break
+		}
+
+		log.Printf("Failed to connect to %s database (%s), attempt %d/%d, retrying in %v: %v",
+			name, dbCfg.Address(), attempt, attempts, backoff, err)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if repoCfg.ConnectMaxBackoff > 0 && backoff > repoCfg.ConnectMaxBackoff {
+			backoff = repoCfg.ConnectMaxBackoff
+		}
+	}
+
+	return nil, fmt.Errorf("%s database (%s) unavailable after %d attempts: %w",
+		name, dbCfg.Address(), attempts, lastErr)
+}
+
+// newConnector returns the connector for a database, authenticating with
+// RDS IAM tokens when enabled
+func newConnector(dbCfg *config.DatabaseConfig) (driver.Connector, error) {
+	if !dbCfg.IAMAuth {
+		return pq.NewConnector(dbCfg.ConnectionString())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	connector, err := newIAMConnector(ctx, dbCfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Using IAM authentication for %s in %s", dbCfg.Address(), connector.region)
+	return connector, nil
+}
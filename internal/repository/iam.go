@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/lib/pq"
+)
+
+// RDS IAM tokens are valid for 15 minutes for opening connections; they are
+// regenerated well before that. Open connections outlive their token
+const (
+	iamTokenLifetime = 15 * time.Minute
+	iamTokenRefresh  = 10 * time.Minute
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body, signed into IAM tokens
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// iamConnector opens PostgreSQL connections authenticated with AWS RDS IAM
+// tokens, so every new pool connection gets a valid token
+type iamConnector struct {
+	db          *config.DatabaseConfig
+	region      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+// newIAMConnector creates a connector using the default AWS credential chain
+// (environment, shared config, web identity, instance role)
+func newIAMConnector(ctx context.Context, db *config.DatabaseConfig) (*iamConnector, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	region := db.Region
+	if region == "" {
+		region = awsCfg.Region
+	}
+	if region == "" {
+		return nil, fmt.Errorf("IAM authentication requires AWS_REGION")
+	}
+
+	return &iamConnector{
+		db:          db,
+		region:      region,
+		credentials: awsCfg.Credentials,
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// Connect opens a connection with the current token
+func (c *iamConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := pq.NewConnector(c.db.ConnectionStringWithPassword(token))
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Driver returns the PostgreSQL driver
+func (c *iamConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// authToken returns a cached token, generating a new one when it is due
+func (c *iamConnector) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.refreshAt) {
+		return c.token, nil
+	}
+
+	creds, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	token, err := buildIAMAuthToken(ctx, c.signer, creds, net.JoinHostPort(c.db.Host, c.db.Port), c.region, c.db.User, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	c.token, c.refreshAt = token, time.Now().Add(iamTokenRefresh)
+	return token, nil
+}
+
+// buildIAMAuthToken builds an RDS IAM authentication token: a SigV4
+// presigned "connect" request for the user, without its scheme
+func buildIAMAuthToken(ctx context.Context, signer *v4.Signer, creds aws.Credentials, endpoint, region, user string, now time.Time) (string, error) {
+	query := url.Values{
+		"Action":        {"connect"},
+		"DBUser":        {user},
+		"X-Amz-Expires": {fmt.Sprint(int(iamTokenLifetime.Seconds()))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+endpoint+"/?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create IAM token request: %w", err)
+	}
+
+	signed, _, err := signer.PresignHTTP(ctx, creds, req, emptyPayloadHash, "rds-db", region, now.UTC())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign IAM token: %w", err)
+	}
+	return strings.TrimPrefix(signed, "https://"), nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+func TestBuildIAMAuthToken(t *testing.T) {
+	creds := aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	token, err := buildIAMAuthToken(context.Background(), v4.NewSigner(), creds, "db.example.com:5432", "eu-west-1", "app", now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(token, "db.example.com:5432/?") {
+		t.Fatalf("Expected token to start with the endpoint, got %s", token)
+	}
+	query, err := url.ParseQuery(token[strings.Index(token, "?")+1:])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"Action":           "connect",
+		"DBUser":           "app",
+		"X-Amz-Expires":    "900",
+		"X-Amz-Date":       "20240102T030405Z",
+		"X-Amz-Credential": "AKIDEXAMPLE/20240102/eu-west-1/rds-db/aws4_request",
+	}
+	for key, value := range expected {
+		if got := query.Get(key); got != value {
+			t.Errorf("Expected %s=%s, got %s", key, value, got)
+		}
+	}
+	if query.Get("X-Amz-Signature") == "" {
+		t.Error("Expected a signature")
+	}
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Instrument wraps the manager's repositories so every call records count,
+// latency and outcome per method in the given metrics
+func Instrument(m *RepositoryManager, appMetrics *metrics.Metrics) *RepositoryManager {
+	if appMetrics == nil {
+		return m
+	}
+
+	instrumented := &RepositoryManager{
+		Snapshots:   m.Snapshots,
+		AccessStats: m.AccessStats,
+		History:     m.History,
+		shared:      m.shared || any(m.Record) == any(m.Inbox),
+		tableStats:  m.tableStats,
+		explainers:  m.explainers,
+		pools:       m.pools,
+		schemas:     m.schemas,
+	}
+
+	if m.Record != nil {
+		instrumented.Record = &instrumentedRecordRepository{next: m.Record, metrics: appMetrics}
+	}
+	if m.Inbox != nil {
+		instrumented.Inbox = &instrumentedInboxRepository{next: m.Inbox, metrics: appMetrics}
+	}
+	if m.Tx != nil {
+		instrumented.Tx = &instrumentedTransactor{next: m.Tx, metrics: appMetrics}
+	}
+
+	return instrumented
+}
+
+// observeCall records a repository call outcome
+func observeCall(m *metrics.Metrics, repo, method string, start time.Time, err error) {
+	m.RecordRepositoryCall(repo, method, callStatus(err), time.Since(start))
+}
+
+// callStatus classifies a repository error. Expected outcomes such as missing
+// or duplicate records are reported separately so they don't count as errors
+func callStatus(err error) string {
+	switch {
+	case err == nil:
+		return metrics.RepositoryStatusSuccess
+	case errors.Is(err, models.ErrQueryTimeout):
+		return metrics.RepositoryStatusTimeout
+	case isCancellation(err):
+		return metrics.RepositoryStatusCancelled
+	case errors.Is(err, models.ErrRecordNotFound):
+		return metrics.RepositoryStatusNotFound
+	case errors.Is(err, models.ErrRecordExists), errors.Is(err, models.ErrVersionConflict):
+		return metrics.RepositoryStatusConflict
+	default:
+		return metrics.RepositoryStatusError
+	}
+}
+
+// isCancellation reports whether err was caused by a cancelled or expired
+// context, including PostgreSQL's query_canceled error
+func isCancellation(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// instrumentedRecordRepository records metrics for a RecordRepository
+type instrumentedRecordRepository struct {
+	next    RecordRepository
+	metrics *metrics.Metrics
+}
+
+// Insert creates a new record
+func (r *instrumentedRecordRepository) Insert(ctx context.Context, record *models.Record) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "Insert", start, err) }(time.Now())
+	return r.next.Insert(ctx, record)
+}
+
+// Update modifies an existing record
+func (r *instrumentedRecordRepository) Update(ctx context.Context, record *models.Record) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "Update", start, err) }(time.Now())
+	return r.next.Update(ctx, record)
+}
+
+// Delete removes a record by ID
+func (r *instrumentedRecordRepository) Delete(ctx context.Context, id string) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "Delete", start, err) }(time.Now())
+	return r.next.Delete(ctx, id)
+}
+
+// UpdateIfVersion modifies a record that still has the expected version
+func (r *instrumentedRecordRepository) UpdateIfVersion(ctx context.Context, record *models.Record, expected int64) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "UpdateIfVersion", start, err) }(time.Now())
+	return r.next.UpdateIfVersion(ctx, record, expected)
+}
+
+// DeleteIfVersion removes a record that still has the expected version
+func (r *instrumentedRecordRepository) DeleteIfVersion(ctx context.Context, id string, expected int64) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "DeleteIfVersion", start, err) }(time.Now())
+	return r.next.DeleteIfVersion(ctx, id, expected)
+}
+
+// Get retrieves a record by ID
+func (r *instrumentedRecordRepository) Get(ctx context.Context, id string) (result *models.Record, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "Get", start, err) }(time.Now())
+	return r.next.Get(ctx, id)
+}
+
+// ListRecords retrieves records matching filter
+func (r *instrumentedRecordRepository) ListRecords(ctx context.Context, filter models.RecordFilter) (result []*models.Record, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "ListRecords", start, err) }(time.Now())
+	return r.next.ListRecords(ctx, filter)
+}
+
+// CountExpiredRecords counts records matching a retention rule
+func (r *instrumentedRecordRepository) CountExpiredRecords(ctx context.Context, prefix string, cutoff time.Time) (count int, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "record", "CountExpiredRecords", start, err) }(time.Now())
+	return r.next.CountExpiredRecords(ctx, prefix, cutoff)
+}
+
+// Close closes the underlying repository
+func (r *instrumentedRecordRepository) Close() error {
+	return r.next.Close()
+}
+
+// instrumentedInboxRepository records metrics for an InboxRepository
+type instrumentedInboxRepository struct {
+	next    InboxRepository
+	metrics *metrics.Metrics
+}
+
+// CreateTask creates a new task in the inbox
+func (r *instrumentedInboxRepository) CreateTask(ctx context.Context, task *models.InboxTask) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "CreateTask", start, err) }(time.Now())
+	return r.next.CreateTask(ctx, task)
+}
+
+// CreateTasks creates several tasks in the inbox at once
+func (r *instrumentedInboxRepository) CreateTasks(ctx context.Context, tasks []*models.InboxTask) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "CreateTasks", start, err) }(time.Now())
+	return r.next.CreateTasks(ctx, tasks)
+}
+
+// GetPendingTasks retrieves pending tasks from the inbox
+func (r *instrumentedInboxRepository) GetPendingTasks(ctx context.Context, limit int) (result []*models.InboxTask, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "GetPendingTasks", start, err) }(time.Now())
+	return r.next.GetPendingTasks(ctx, limit)
+}
+
+// ListTasks retrieves the tasks selected by filter with pagination
+func (r *instrumentedInboxRepository) ListTasks(ctx context.Context, filter models.TaskFilter) (result []*models.InboxTask, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "ListTasks", start, err) }(time.Now())
+	return r.next.ListTasks(ctx, filter)
+}
+
+// GetTask retrieves a task by ID
+func (r *instrumentedInboxRepository) GetTask(ctx context.Context, taskID string) (result *models.InboxTask, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "GetTask", start, err) }(time.Now())
+	return r.next.GetTask(ctx, taskID)
+}
+
+// GetTasksByIDs retrieves the tasks with the IDs
+func (r *instrumentedInboxRepository) GetTasksByIDs(ctx context.Context, taskIDs []string) (result []*models.InboxTask, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "GetTasksByIDs", start, err) }(time.Now())
+	return r.next.GetTasksByIDs(ctx, taskIDs)
+}
+
+// GetOpenTasksForRecord retrieves the pending or processing tasks of a record
+func (r *instrumentedInboxRepository) GetOpenTasksForRecord(ctx context.Context, recordID string, limit int) (result []*models.InboxTask, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "GetOpenTasksForRecord", start, err) }(time.Now())
+	return r.next.GetOpenTasksForRecord(ctx, recordID, limit)
+}
+
+// GetCompletedTasksAfter retrieves completed tasks in completion order
+func (r *instrumentedInboxRepository) GetCompletedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) (result []*models.InboxTask, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "GetCompletedTasksAfter", start, err) }(time.Now())
+	return r.next.GetCompletedTasksAfter(ctx, after, afterID, limit)
+}
+
+// GetFinishedTasksAfter retrieves completed and failed tasks in completion order
+func (r *instrumentedInboxRepository) GetFinishedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) (result []*models.InboxTask, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "GetFinishedTasksAfter", start, err) }(time.Now())
+	return r.next.GetFinishedTasksAfter(ctx, after, afterID, limit)
+}
+
+// GetTaskStats returns statistics about tasks by status
+func (r *instrumentedInboxRepository) GetTaskStats(ctx context.Context) (result *models.TaskStats, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "GetTaskStats", start, err) }(time.Now())
+	return r.next.GetTaskStats(ctx)
+}
+
+// CountOpenTasksByTenant counts the open tasks of each tenant
+func (r *instrumentedInboxRepository) CountOpenTasksByTenant(ctx context.Context) (result map[string]int, err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "CountOpenTasksByTenant", start, err) }(time.Now())
+	return r.next.CountOpenTasksByTenant(ctx)
+}
+
+// UpdateTaskStatus updates the status of a task
+func (r *instrumentedInboxRepository) UpdateTaskStatus(ctx context.Context, taskID string, status string, errorMsg string) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "UpdateTaskStatus", start, err) }(time.Now())
+	return r.next.UpdateTaskStatus(ctx, taskID, status, errorMsg)
+}
+
+// CompleteTask marks a task completed with its result
+func (r *instrumentedInboxRepository) CompleteTask(ctx context.Context, taskID string, result *models.TaskResult) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "CompleteTask", start, err) }(time.Now())
+	return r.next.CompleteTask(ctx, taskID, result)
+}
+
+// IncrementTaskRetries increments the retry count for a task
+func (r *instrumentedInboxRepository) IncrementTaskRetries(ctx context.Context, taskID string) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "IncrementTaskRetries", start, err) }(time.Now())
+	return r.next.IncrementTaskRetries(ctx, taskID)
+}
+
+// SetTaskTrace stores the processing trace of a task
+func (r *instrumentedInboxRepository) SetTaskTrace(ctx context.Context, taskID string, trace *models.TaskTrace) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "SetTaskTrace", start, err) }(time.Now())
+	return r.next.SetTaskTrace(ctx, taskID, trace)
+}
+
+// DeleteCompletedTasks removes completed tasks older than specified duration
+func (r *instrumentedInboxRepository) DeleteCompletedTasks(ctx context.Context, olderThanHours int) (err error) {
+	defer func(start time.Time) { observeCall(r.metrics, "inbox", "DeleteCompletedTasks", start, err) }(time.Now())
+	return r.next.DeleteCompletedTasks(ctx, olderThanHours)
+}
+
+// Close closes the underlying repository
+func (r *instrumentedInboxRepository) Close() error {
+	return r.next.Close()
+}
+
+// instrumentedRepository combines instrumented record and inbox repositories
+// for transaction-scoped repositories
+type instrumentedRepository struct {
+	*instrumentedRecordRepository
+	*instrumentedInboxRepository
+}
+
+// Close closes the underlying repository
+func (r *instrumentedRepository) Close() error {
+	return r.instrumentedRecordRepository.Close()
+}
+
+// instrumentedTransactor records transaction metrics and instruments the
+// transaction-scoped repository passed to callers
+type instrumentedTransactor struct {
+	next    Transactor
+	metrics *metrics.Metrics
+}
+
+// WithinTransaction runs fn within a transaction
+func (t *instrumentedTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context, repo Repository) error) (err error) {
+	defer func(start time.Time) { observeCall(t.metrics, "tx", "WithinTransaction", start, err) }(time.Now())
+
+	return t.next.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+		return fn(ctx, &instrumentedRepository{
+			instrumentedRecordRepository: &instrumentedRecordRepository{next: repo, metrics: t.metrics},
+			instrumentedInboxRepository:  &instrumentedInboxRepository{next: repo, metrics: t.metrics},
+		})
+	})
+}
@@ -2,7 +2,12 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"mit-service/internal/models"
+	"net/url"
+	"time"
 )
 
 // RecordRepository defines the interface for record operations
@@ -16,36 +21,81 @@ type RecordRepository interface {
 	// Delete removes a record by ID
 	Delete(ctx context.Context, id string) error
 
+	// UpdateIfVersion modifies an existing record that still has version
+	// expected, failing with models.ErrVersionConflict otherwise
+	UpdateIfVersion(ctx context.Context, record *models.Record, expected int64) error
+
+	// DeleteIfVersion removes a record that still has version expected,
+	// failing with models.ErrVersionConflict otherwise
+	DeleteIfVersion(ctx context.Context, id string, expected int64) error
+
 	// Get retrieves a record by ID
 	Get(ctx context.Context, id string) (*models.Record, error)
 
+	// ListRecords retrieves records matching filter ordered by ID
+	ListRecords(ctx context.Context, filter models.RecordFilter) ([]*models.Record, error)
+
+	// CountExpiredRecords counts records whose ID starts with prefix and that
+	// were last written before cutoff
+	CountExpiredRecords(ctx context.Context, prefix string, cutoff time.Time) (int, error)
+
 	// Close closes the repository connection
 	Close() error
 }
 
 // InboxRepository defines the interface for inbox pattern operations
 type InboxRepository interface {
-	// CreateTask creates a new task in the inbox
+	// CreateTask creates a new task in the inbox, failing with
+	// models.ErrTaskExists when a task already has its ID
 	CreateTask(ctx context.Context, task *models.InboxTask) error
 
+	// CreateTasks creates several tasks in the inbox at once, all of them
+	// or none, failing like CreateTask
+	CreateTasks(ctx context.Context, tasks []*models.InboxTask) error
+
+	// GetTask retrieves a task by ID
+	GetTask(ctx context.Context, taskID string) (*models.InboxTask, error)
+
+	// GetTasksByIDs retrieves the tasks with the IDs in a single query, in
+	// no particular order and leaving out unknown IDs
+	GetTasksByIDs(ctx context.Context, taskIDs []string) ([]*models.InboxTask, error)
+
 	// GetPendingTasks retrieves pending tasks from the inbox
 	GetPendingTasks(ctx context.Context, limit int) ([]*models.InboxTask, error)
 
-	// GetTasksByStatus retrieves tasks by status with pagination
-	GetTasksByStatus(ctx context.Context, status string, limit, offset int) ([]*models.InboxTask, error)
+	// GetOpenTasksForRecord retrieves up to limit pending or processing tasks
+	// whose payload targets the record, oldest first
+	GetOpenTasksForRecord(ctx context.Context, recordID string, limit int) ([]*models.InboxTask, error)
 
-	// GetAllTasks retrieves all tasks with pagination
-	GetAllTasks(ctx context.Context, limit, offset int) ([]*models.InboxTask, error)
+	// GetCompletedTasksAfter retrieves up to limit completed tasks ordered by
+	// completion time and ID, starting after the given position
+	GetCompletedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) ([]*models.InboxTask, error)
+
+	// GetFinishedTasksAfter is GetCompletedTasksAfter including failed tasks
+	GetFinishedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) ([]*models.InboxTask, error)
+
+	// ListTasks retrieves the tasks selected by filter with pagination
+	ListTasks(ctx context.Context, filter models.TaskFilter) ([]*models.InboxTask, error)
 
 	// GetTaskStats returns statistics about tasks by status
 	GetTaskStats(ctx context.Context) (*models.TaskStats, error)
 
+	// CountOpenTasksByTenant counts the pending and processing tasks of
+	// each tenant, leaving out tasks queued without a tenant
+	CountOpenTasksByTenant(ctx context.Context) (map[string]int, error)
+
 	// UpdateTaskStatus updates the status of a task
 	UpdateTaskStatus(ctx context.Context, taskID string, status string, errorMsg string) error
 
+	// CompleteTask marks a task completed with the result of its operation
+	CompleteTask(ctx context.Context, taskID string, result *models.TaskResult) error
+
 	// IncrementTaskRetries increments the retry count for a task
 	IncrementTaskRetries(ctx context.Context, taskID string) error
 
+	// SetTaskTrace stores the processing trace of a task's last attempt
+	SetTaskTrace(ctx context.Context, taskID string, trace *models.TaskTrace) error
+
 	// DeleteCompletedTasks removes completed tasks older than specified duration
 	DeleteCompletedTasks(ctx context.Context, olderThanHours int) error
 
@@ -59,8 +109,174 @@ type Repository interface {
 	InboxRepository
 }
 
+// Transactor runs operations spanning records and inbox atomically.
+// Only available when both live in the same database
+type Transactor interface {
+	// WithinTransaction runs fn with a transaction-scoped repository,
+	// committing if fn returns nil and rolling back otherwise
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error
+}
+
 // RepositoryManager provides access to all repositories
 type RepositoryManager struct {
 	Record RecordRepository
 	Inbox  InboxRepository
+
+	// Tx is set when records and inbox share a database, nil in split mode
+	Tx Transactor
+
+	// Snapshots saves and restores named snapshots, nil unless the mock
+	// repository runs with a snapshot directory
+	Snapshots *SnapshotStore
+
+	// AccessStats stores per-record access counts, kept next to the records
+	AccessStats AccessStatsStore
+
+	// History reads the history of records, kept next to the records. Nil
+	// unless record history is enabled
+	History HistoryStore
+
+	// shared is set when Record and Inbox wrap the same underlying repository
+	shared bool
+
+	// tableStats lists where table statistics come from
+	tableStats []tableStatsSource
+
+	// explainers explain the queries reading each table, empty for
+	// backends without query plans
+	explainers map[string]QueryExplainer
+
+	// pools are the database connection pools by name ("main", "inbox"),
+	// empty for backends without a pool
+	pools map[string]PoolStatsProvider
+
+	// schemas lists where the live schema of each table is checked, empty
+	// for backends without a schema
+	schemas []schemaSource
+}
+
+// Close closes all repositories, closing a shared repository only once
+func (m *RepositoryManager) Close() error {
+	var errs []error
+
+	if m.Record != nil {
+		if err := m.Record.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("record repository: %w", err))
+		}
+	}
+
+	if m.Inbox != nil && !m.shared && any(m.Inbox) != any(m.Record) {
+		if err := m.Inbox.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("inbox repository: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// AccessStatsStore persists per-record read and write counts
+type AccessStatsStore interface {
+	// RecordAccess adds the counts to the stored ones and advances the
+	// last access times
+	RecordAccess(ctx context.Context, stats []*models.RecordAccessStats) error
+
+	// HottestRecords returns the most accessed records ordered by reads,
+	// writes or their total
+	HottestRecords(ctx context.Context, limit int, orderBy string) ([]*models.RecordAccessStats, error)
+}
+
+// HistoryStore reads the append-only history of record writes
+type HistoryStore interface {
+	// RecordHistory returns the history entries of a record, oldest first
+	RecordHistory(ctx context.Context, id string, limit, offset int) ([]*models.RecordHistoryEntry, error)
+
+	// RecordVersion returns the latest insert or update of a record that
+	// left it at version, ErrVersionNotFound if there is none
+	RecordVersion(ctx context.Context, id string, version int64) (*models.RecordHistoryEntry, error)
+}
+
+// TableStatsProvider reports table size and bloat estimates
+type TableStatsProvider interface {
+	// TableStats returns statistics for the named tables that exist
+	TableStats(ctx context.Context, tables ...string) ([]*models.TableStats, error)
+}
+
+// PoolStatsProvider reports the statistics of a database connection pool
+type PoolStatsProvider interface {
+	PoolStats() sql.DBStats
+}
+
+// PoolStats returns the statistics of each connection pool by name
+func (m *RepositoryManager) PoolStats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats, len(m.pools))
+	for name, pool := range m.pools {
+		stats[name] = pool.PoolStats()
+	}
+	return stats
+}
+
+// tableStatsSource ties a provider to the tables it holds
+type tableStatsSource struct {
+	provider TableStatsProvider
+	tables   []string
+}
+
+// TableStats returns size and bloat statistics for the records and inbox
+// tables, querying each database once
+func (m *RepositoryManager) TableStats(ctx context.Context) ([]*models.TableStats, error) {
+	var stats []*models.TableStats
+	for _, source := range m.tableStats {
+		tableStats, err := source.provider.TableStats(ctx, source.tables...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get table stats for %v: %w", source.tables, err)
+		}
+		stats = append(stats, tableStats...)
+	}
+
+	return stats, nil
+}
+
+// schemaSource ties a schema checker to the tables it holds
+type schemaSource struct {
+	checker SchemaChecker
+	tables  []string
+}
+
+// CheckSchema compares the live schema of the records and inbox tables with
+// the expected one, querying each database once
+func (m *RepositoryManager) CheckSchema(ctx context.Context) (*models.SchemaReport, error) {
+	if len(m.schemas) == 0 {
+		return nil, models.ErrSchemaCheckUnsupported
+	}
+
+	report := &models.SchemaReport{
+		CheckedAt:                time.Now(),
+		ExpectedMigrationVersion: SchemaMigrationVersion,
+		Drift:                    []*models.SchemaDrift{},
+	}
+	for _, source := range m.schemas {
+		drift, err := source.checker.CheckSchema(ctx, source.tables...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check schema of %v: %w", source.tables, err)
+		}
+		report.Drift = append(report.Drift, drift...)
+	}
+	report.InSync = len(report.Drift) == 0
+
+	return report, nil
+}
+
+// ExplainQueries returns the query plans of the queries behind an endpoint,
+// run on the database holding the table they read
+func (m *RepositoryManager) ExplainQueries(ctx context.Context, endpoint string, params url.Values, analyze bool) ([]*models.QueryPlan, error) {
+	explained, err := lookupExplainedEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	explainer := m.explainers[explained.table]
+	if explainer == nil {
+		return nil, models.ErrExplainUnsupported
+	}
+	return explainer.ExplainQueries(ctx, endpoint, params, analyze)
 }
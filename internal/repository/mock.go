@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"mit-service/internal/models"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,15 +16,34 @@ import (
 type MockRepository struct {
 	records    map[string]*models.Record
 	inboxTasks map[string]*models.InboxTask
-	recordsMu  sync.RWMutex
-	tasksMu    sync.RWMutex
+
+	// writtenAt tracks when each record was last written, guarded by recordsMu
+	writtenAt map[string]time.Time
+
+	// history holds the writes of each record, oldest first, guarded by
+	// recordsMu
+	history map[string][]*models.RecordHistoryEntry
+
+	// accessStats holds per-record access counts, guarded by statsMu
+	accessStats map[string]*models.RecordAccessStats
+
+	recordsMu sync.RWMutex
+	tasksMu   sync.RWMutex
+	statsMu   sync.Mutex
+
+	// txMu is read-locked by transactions and locked by snapshots, which
+	// must not see a transaction half applied
+	txMu sync.RWMutex
 }
 
 // NewMockRepository creates a new mock repository
 func NewMockRepository() *MockRepository {
 	return &MockRepository{
-		records:    make(map[string]*models.Record),
-		inboxTasks: make(map[string]*models.InboxTask),
+		records:     make(map[string]*models.Record),
+		inboxTasks:  make(map[string]*models.InboxTask),
+		writtenAt:   make(map[string]time.Time),
+		history:     make(map[string][]*models.RecordHistoryEntry),
+		accessStats: make(map[string]*models.RecordAccessStats),
 	}
 }
 
@@ -28,82 +51,283 @@ func NewMockRepository() *MockRepository {
 
 // Insert creates a new record
 func (r *MockRepository) Insert(ctx context.Context, record *models.Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.recordsMu.Lock()
 	defer r.recordsMu.Unlock()
 
 	if _, exists := r.records[record.ID]; exists {
-		return fmt.Errorf("record with id '%s' already exists", record.ID)
+		return fmt.Errorf("record with id '%s' %w", record.ID, models.ErrRecordExists)
+	}
+
+	hash, err := models.ValueHash(record.Value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
 	}
 
 	// Deep copy the record to avoid shared memory issues
 	recordCopy := &models.Record{
-		ID:    record.ID,
-		Value: record.Value,
+		ID:       record.ID,
+		Type:     record.Type,
+		Value:    append(json.RawMessage(nil), record.Value...),
+		Hash:     hash,
+		Encoding: record.Encoding,
+		Version:  1,
 	}
 
 	r.records[record.ID] = recordCopy
+	r.writtenAt[record.ID] = time.Now()
+	r.appendHistory(models.HistoryInsert, recordCopy)
 	return nil
 }
 
 // Update modifies an existing record
 func (r *MockRepository) Update(ctx context.Context, record *models.Record) error {
+	return r.update(ctx, record, 0)
+}
+
+// UpdateIfVersion modifies an existing record that still has version expected
+func (r *MockRepository) UpdateIfVersion(ctx context.Context, record *models.Record, expected int64) error {
+	return r.update(ctx, record, expected)
+}
+
+// update modifies an existing record with version expected, any for 0
+func (r *MockRepository) update(ctx context.Context, record *models.Record, expected int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.recordsMu.Lock()
 	defer r.recordsMu.Unlock()
 
-	if _, exists := r.records[record.ID]; !exists {
-		return fmt.Errorf("record with id '%s' not found", record.ID)
+	existing, exists := r.records[record.ID]
+	if !exists {
+		return fmt.Errorf("record with id '%s' %w", record.ID, models.ErrRecordNotFound)
+	}
+	if expected != 0 && existing.Version != expected {
+		return fmt.Errorf("record with id '%s' has version %d, expected %d: %w", record.ID, existing.Version, expected, models.ErrVersionConflict)
 	}
 
-	// Deep copy the record to avoid shared memory issues
+	hash, err := models.ValueHash(record.Value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	// Deep copy the record to avoid shared memory issues. Like the postgres
+	// repository, updates keep the type
+	recordType := record.Type
+	if recordType == "" {
+		recordType = existing.Type
+	}
 	recordCopy := &models.Record{
-		ID:    record.ID,
-		Value: record.Value,
+		ID:       record.ID,
+		Type:     recordType,
+		Value:    append(json.RawMessage(nil), record.Value...),
+		Hash:     hash,
+		Encoding: record.Encoding,
+		Version:  existing.Version + 1,
 	}
 
 	r.records[record.ID] = recordCopy
+	r.writtenAt[record.ID] = time.Now()
+	r.appendHistory(models.HistoryUpdate, recordCopy)
 	return nil
 }
 
 // Delete removes a record by ID
 func (r *MockRepository) Delete(ctx context.Context, id string) error {
+	return r.delete(ctx, id, 0)
+}
+
+// DeleteIfVersion removes a record that still has version expected
+func (r *MockRepository) DeleteIfVersion(ctx context.Context, id string, expected int64) error {
+	return r.delete(ctx, id, expected)
+}
+
+// delete removes a record with version expected, any for 0
+func (r *MockRepository) delete(ctx context.Context, id string, expected int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.recordsMu.Lock()
 	defer r.recordsMu.Unlock()
 
-	if _, exists := r.records[id]; !exists {
-		return fmt.Errorf("record with id '%s' not found", id)
+	existing, exists := r.records[id]
+	if !exists {
+		return fmt.Errorf("record with id '%s' %w", id, models.ErrRecordNotFound)
+	}
+	if expected != 0 && existing.Version != expected {
+		return fmt.Errorf("record with id '%s' has version %d, expected %d: %w", id, existing.Version, expected, models.ErrVersionConflict)
 	}
 
 	delete(r.records, id)
+	delete(r.writtenAt, id)
+	r.appendHistory(models.HistoryDelete, existing)
 	return nil
 }
 
+// appendHistory adds a write of record to its history, recordsMu must be
+// held. Stored records are never modified, entries share their values
+func (r *MockRepository) appendHistory(operation string, record *models.Record) {
+	r.history[record.ID] = append(r.history[record.ID], &models.RecordHistoryEntry{
+		ID:        record.ID,
+		Version:   record.Version,
+		Operation: operation,
+		Type:      record.Type,
+		Value:     record.Value,
+		Encoding:  record.Encoding,
+		ChangedAt: time.Now(),
+	})
+}
+
 // Get retrieves a record by ID
 func (r *MockRepository) Get(ctx context.Context, id string) (*models.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.recordsMu.RLock()
 	defer r.recordsMu.RUnlock()
 
 	record, exists := r.records[id]
 	if !exists {
-		return nil, fmt.Errorf("record with id '%s' not found", id)
+		return nil, fmt.Errorf("record with id '%s' %w", id, models.ErrRecordNotFound)
 	}
 
 	// Return a copy to avoid shared memory issues
 	recordCopy := &models.Record{
-		ID:    record.ID,
-		Value: record.Value,
+		ID:       record.ID,
+		Type:     record.Type,
+		Value:    record.Value,
+		Hash:     record.Hash,
+		Encoding: record.Encoding,
+		Version:  record.Version,
 	}
 
 	return recordCopy, nil
 }
 
+// ListRecords retrieves records matching filter ordered by ID
+func (r *MockRepository) ListRecords(ctx context.Context, filter models.RecordFilter) ([]*models.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.recordsMu.RLock()
+	defer r.recordsMu.RUnlock()
+
+	var matched []*models.Record
+	for id, record := range r.records {
+		if filter.Type != "" && record.Type != filter.Type {
+			continue
+		}
+		if !strings.HasPrefix(id, filter.Prefix) {
+			continue
+		}
+		if filter.ExcludePrefix != "" && strings.HasPrefix(id, filter.ExcludePrefix) {
+			continue
+		}
+		if filter.AfterID != "" && id <= filter.AfterID {
+			continue
+		}
+		if !filter.WrittenBefore.IsZero() && !r.writtenAt[id].Before(filter.WrittenBefore) {
+			continue
+		}
+		matched = append(matched, &models.Record{
+			ID:       record.ID,
+			Type:     record.Type,
+			Value:    record.Value,
+			Hash:     record.Hash,
+			Encoding: record.Encoding,
+			Version:  record.Version,
+		})
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	records := []*models.Record{}
+	if filter.Offset < len(matched) {
+		end := filter.Offset + filter.Limit
+		if end > len(matched) {
+			end = len(matched)
+		}
+		records = matched[filter.Offset:end]
+	}
+
+	return records, nil
+}
+
+// CountExpiredRecords counts records whose ID starts with prefix and that
+// were last written before cutoff
+func (r *MockRepository) CountExpiredRecords(ctx context.Context, prefix string, cutoff time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.recordsMu.RLock()
+	defer r.recordsMu.RUnlock()
+
+	count := 0
+	for id := range r.records {
+		if r.expired(id, prefix, cutoff) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// expired reports whether a record matches a retention rule, recordsMu must be held
+func (r *MockRepository) expired(id, prefix string, cutoff time.Time) bool {
+	writtenAt, ok := r.writtenAt[id]
+	return ok && strings.HasPrefix(id, prefix) && writtenAt.Before(cutoff)
+}
+
 // Inbox operations
 
 // CreateTask creates a new task in the inbox
 func (r *MockRepository) CreateTask(ctx context.Context, task *models.InboxTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.tasksMu.Lock()
 	defer r.tasksMu.Unlock()
 
-	// Deep copy the task
+	if _, exists := r.inboxTasks[task.ID]; exists {
+		return fmt.Errorf("task with id '%s' %w", task.ID, models.ErrTaskExists)
+	}
+	r.storeTask(task)
+	return nil
+}
+
+// CreateTasks creates several tasks in the inbox at once
+func (r *MockRepository) CreateTasks(ctx context.Context, tasks []*models.InboxTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.tasksMu.Lock()
+	defer r.tasksMu.Unlock()
+
+	ids := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		if _, exists := r.inboxTasks[task.ID]; exists || ids[task.ID] {
+			return fmt.Errorf("task with id '%s' %w", task.ID, models.ErrTaskExists)
+		}
+		ids[task.ID] = true
+	}
+	for _, task := range tasks {
+		r.storeTask(task)
+	}
+	return nil
+}
+
+// storeTask stores a deep copy of task, tasksMu must be held
+func (r *MockRepository) storeTask(task *models.InboxTask) {
 	taskCopy := &models.InboxTask{
 		ID:        task.ID,
 		Operation: task.Operation,
@@ -113,119 +337,209 @@ func (r *MockRepository) CreateTask(ctx context.Context, task *models.InboxTask)
 		UpdatedAt: task.UpdatedAt,
 		Retries:   task.Retries,
 		Error:     task.Error,
+		TenantID:  task.TenantID,
 	}
 	copy(taskCopy.Payload, task.Payload)
 
 	r.inboxTasks[task.ID] = taskCopy
-	return nil
 }
 
-// GetPendingTasks retrieves pending tasks from the inbox
-func (r *MockRepository) GetPendingTasks(ctx context.Context, limit int) ([]*models.InboxTask, error) {
+// GetTask retrieves a task by ID
+func (r *MockRepository) GetTask(ctx context.Context, taskID string) (*models.InboxTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.tasksMu.RLock()
 	defer r.tasksMu.RUnlock()
 
-	var pendingTasks []*models.InboxTask
-	count := 0
+	task, exists := r.inboxTasks[taskID]
+	if !exists {
+		return nil, fmt.Errorf("task with id '%s' %w", taskID, models.ErrRecordNotFound)
+	}
+	return r.copyTask(task), nil
+}
 
-	// Collect pending tasks (note: order is not guaranteed in map iteration)
-	for _, task := range r.inboxTasks {
-		if task.Status == models.TaskStatusPending && count < limit {
-			// Return a copy to avoid shared memory issues
-			taskCopy := &models.InboxTask{
-				ID:        task.ID,
-				Operation: task.Operation,
-				Payload:   make([]byte, len(task.Payload)),
-				Status:    task.Status,
-				CreatedAt: task.CreatedAt,
-				UpdatedAt: task.UpdatedAt,
-				Retries:   task.Retries,
-				Error:     task.Error,
-			}
-			copy(taskCopy.Payload, task.Payload)
+// GetTasksByIDs retrieves the tasks with the IDs, leaving out unknown IDs
+func (r *MockRepository) GetTasksByIDs(ctx context.Context, taskIDs []string) ([]*models.InboxTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-			pendingTasks = append(pendingTasks, taskCopy)
-			count++
+	r.tasksMu.RLock()
+	defer r.tasksMu.RUnlock()
+
+	var tasks []*models.InboxTask
+	for _, id := range taskIDs {
+		if task, exists := r.inboxTasks[id]; exists {
+			tasks = append(tasks, r.copyTask(task))
+		}
+	}
+	return tasks, nil
+}
+
+// GetPendingTasks retrieves pending tasks from the inbox and marks them as processing,
+// oldest first, mirroring the claim semantics of the PostgreSQL repository
+func (r *MockRepository) GetPendingTasks(ctx context.Context, limit int) ([]*models.InboxTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.tasksMu.Lock()
+	defer r.tasksMu.Unlock()
+
+	var pending []*models.InboxTask
+	for _, task := range r.inboxTasks {
+		if task.Status == models.TaskStatusPending {
+			pending = append(pending, task)
 		}
 	}
 
-	return pendingTasks, nil
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+
+	claimed := make([]*models.InboxTask, 0, len(pending))
+	for _, task := range pending {
+		task.Status = models.TaskStatusProcessing
+		task.UpdatedAt = time.Now()
+		// Return a copy to avoid shared memory issues
+		claimed = append(claimed, r.copyTask(task))
+	}
+
+	return claimed, nil
 }
 
-// GetTasksByStatus retrieves tasks by status with pagination
-func (r *MockRepository) GetTasksByStatus(ctx context.Context, status string, limit, offset int) ([]*models.InboxTask, error) {
+// GetOpenTasksForRecord retrieves the pending or processing tasks whose
+// payload targets the record, oldest first
+func (r *MockRepository) GetOpenTasksForRecord(ctx context.Context, recordID string, limit int) ([]*models.InboxTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.tasksMu.RLock()
 	defer r.tasksMu.RUnlock()
 
-	var filteredTasks []*models.InboxTask
+	var tasks []*models.InboxTask
 	for _, task := range r.inboxTasks {
-		if task.Status == status {
-			// Return a copy to avoid shared memory issues
-			taskCopy := r.copyTask(task)
-			filteredTasks = append(filteredTasks, taskCopy)
+		if task.Status != models.TaskStatusPending && task.Status != models.TaskStatusProcessing {
+			continue
+		}
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(task.Payload, &payload) == nil && payload.ID == recordID {
+			tasks = append(tasks, r.copyTask(task))
 		}
 	}
 
-	// Sort by created_at DESC (newest first)
-	// Note: This is a simple implementation, in real scenarios you might want to use a more efficient sorting
-	for i := 0; i < len(filteredTasks)-1; i++ {
-		for j := i + 1; j < len(filteredTasks); j++ {
-			if filteredTasks[i].CreatedAt.Before(filteredTasks[j].CreatedAt) {
-				filteredTasks[i], filteredTasks[j] = filteredTasks[j], filteredTasks[i]
-			}
-		}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
 	}
+	return tasks, nil
+}
 
-	// Apply pagination
-	start := offset
-	if start >= len(filteredTasks) {
-		return []*models.InboxTask{}, nil
+// GetCompletedTasksAfter retrieves up to limit completed tasks ordered by
+// completion time and ID, starting after the given position
+func (r *MockRepository) GetCompletedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) ([]*models.InboxTask, error) {
+	return r.tasksAfter(ctx, after, afterID, limit, models.TaskStatusCompleted)
+}
+
+// GetFinishedTasksAfter retrieves up to limit completed or failed tasks
+// ordered by completion time and ID, starting after the given position
+func (r *MockRepository) GetFinishedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) ([]*models.InboxTask, error) {
+	return r.tasksAfter(ctx, after, afterID, limit, models.TaskStatusCompleted, models.TaskStatusFailed)
+}
+
+// tasksAfter retrieves up to limit tasks in one of statuses ordered by
+// update time and ID, starting after the given position
+func (r *MockRepository) tasksAfter(ctx context.Context, after time.Time, afterID string, limit int, statuses ...string) ([]*models.InboxTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	end := start + limit
-	if end > len(filteredTasks) {
-		end = len(filteredTasks)
+	r.tasksMu.RLock()
+	defer r.tasksMu.RUnlock()
+
+	var tasks []*models.InboxTask
+	for _, task := range r.inboxTasks {
+		if !slices.Contains(statuses, task.Status) {
+			continue
+		}
+		if task.UpdatedAt.After(after) || (task.UpdatedAt.Equal(after) && task.ID > afterID) {
+			tasks = append(tasks, r.copyTask(task))
+		}
 	}
 
-	return filteredTasks[start:end], nil
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].UpdatedAt.Equal(tasks[j].UpdatedAt) {
+			return tasks[i].UpdatedAt.Before(tasks[j].UpdatedAt)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
 }
 
-// GetAllTasks retrieves all tasks with pagination
-func (r *MockRepository) GetAllTasks(ctx context.Context, limit, offset int) ([]*models.InboxTask, error) {
+// ListTasks retrieves the tasks selected by filter with pagination
+func (r *MockRepository) ListTasks(ctx context.Context, filter models.TaskFilter) ([]*models.InboxTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.tasksMu.RLock()
 	defer r.tasksMu.RUnlock()
 
-	var allTasks []*models.InboxTask
+	var filteredTasks []*models.InboxTask
 	for _, task := range r.inboxTasks {
-		taskCopy := r.copyTask(task)
-		allTasks = append(allTasks, taskCopy)
+		if filter.Status != "" && task.Status != filter.Status {
+			continue
+		}
+		if filter.TenantID != "" && task.TenantID != filter.TenantID {
+			continue
+		}
+		if !strings.HasPrefix(task.ID, filter.Prefix) {
+			continue
+		}
+		if filter.ExcludePrefix != "" && strings.HasPrefix(task.ID, filter.ExcludePrefix) {
+			continue
+		}
+		// Return a copy to avoid shared memory issues
+		filteredTasks = append(filteredTasks, r.copyTask(task))
 	}
 
 	// Sort by created_at DESC (newest first)
-	for i := 0; i < len(allTasks)-1; i++ {
-		for j := i + 1; j < len(allTasks); j++ {
-			if allTasks[i].CreatedAt.Before(allTasks[j].CreatedAt) {
-				allTasks[i], allTasks[j] = allTasks[j], allTasks[i]
-			}
-		}
-	}
+	sort.Slice(filteredTasks, func(i, j int) bool {
+		return filteredTasks[i].CreatedAt.After(filteredTasks[j].CreatedAt)
+	})
 
 	// Apply pagination
-	start := offset
-	if start >= len(allTasks) {
+	start := filter.Offset
+	if start >= len(filteredTasks) {
 		return []*models.InboxTask{}, nil
 	}
 
-	end := start + limit
-	if end > len(allTasks) {
-		end = len(allTasks)
+	end := start + filter.Limit
+	if end > len(filteredTasks) {
+		end = len(filteredTasks)
 	}
 
-	return allTasks[start:end], nil
+	return filteredTasks[start:end], nil
 }
 
 // GetTaskStats returns statistics about tasks by status
 func (r *MockRepository) GetTaskStats(ctx context.Context) (*models.TaskStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.tasksMu.RLock()
 	defer r.tasksMu.RUnlock()
 
@@ -237,6 +551,10 @@ func (r *MockRepository) GetTaskStats(ctx context.Context) (*models.TaskStats, e
 		switch task.Status {
 		case models.TaskStatusPending:
 			stats.PendingTasks++
+			if stats.OldestPendingAt == nil || task.CreatedAt.Before(*stats.OldestPendingAt) {
+				createdAt := task.CreatedAt
+				stats.OldestPendingAt = &createdAt
+			}
 		case models.TaskStatusProcessing:
 			stats.ProcessingTasks++
 		case models.TaskStatusCompleted:
@@ -249,8 +567,31 @@ func (r *MockRepository) GetTaskStats(ctx context.Context) (*models.TaskStats, e
 	return stats, nil
 }
 
+// CountOpenTasksByTenant counts the pending and processing tasks of each
+// tenant
+func (r *MockRepository) CountOpenTasksByTenant(ctx context.Context) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.tasksMu.RLock()
+	defer r.tasksMu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, task := range r.inboxTasks {
+		if task.TenantID != "" && (task.Status == models.TaskStatusPending || task.Status == models.TaskStatusProcessing) {
+			counts[task.TenantID]++
+		}
+	}
+	return counts, nil
+}
+
 // UpdateTaskStatus updates the status of a task
 func (r *MockRepository) UpdateTaskStatus(ctx context.Context, taskID string, status string, errorMsg string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.tasksMu.Lock()
 	defer r.tasksMu.Unlock()
 
@@ -266,8 +607,37 @@ func (r *MockRepository) UpdateTaskStatus(ctx context.Context, taskID string, st
 	return nil
 }
 
+// CompleteTask marks a task completed with the result of its operation
+func (r *MockRepository) CompleteTask(ctx context.Context, taskID string, result *models.TaskResult) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.tasksMu.Lock()
+	defer r.tasksMu.Unlock()
+
+	task, exists := r.inboxTasks[taskID]
+	if !exists {
+		return fmt.Errorf("task with id '%s' not found", taskID)
+	}
+
+	task.Status = models.TaskStatusCompleted
+	task.UpdatedAt = time.Now()
+	task.Error = ""
+	if result != nil {
+		resultCopy := *result
+		task.Result = &resultCopy
+	}
+
+	return nil
+}
+
 // IncrementTaskRetries increments the retry count for a task
 func (r *MockRepository) IncrementTaskRetries(ctx context.Context, taskID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.tasksMu.Lock()
 	defer r.tasksMu.Unlock()
 
@@ -282,8 +652,30 @@ func (r *MockRepository) IncrementTaskRetries(ctx context.Context, taskID string
 	return nil
 }
 
+// SetTaskTrace stores the processing trace of a task
+func (r *MockRepository) SetTaskTrace(ctx context.Context, taskID string, trace *models.TaskTrace) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.tasksMu.Lock()
+	defer r.tasksMu.Unlock()
+
+	task, exists := r.inboxTasks[taskID]
+	if !exists {
+		return fmt.Errorf("task with id '%s' not found", taskID)
+	}
+
+	task.Trace = copyTaskTrace(trace)
+	return nil
+}
+
 // DeleteCompletedTasks removes completed tasks older than specified duration
 func (r *MockRepository) DeleteCompletedTasks(ctx context.Context, olderThanHours int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.tasksMu.Lock()
 	defer r.tasksMu.Unlock()
 
@@ -299,6 +691,23 @@ func (r *MockRepository) DeleteCompletedTasks(ctx context.Context, olderThanHour
 	return nil
 }
 
+// WithinTransaction runs fn with a transaction-scoped repository that logs
+// how to undo each of its writes, and replays the log if fn fails. Only the
+// records and tasks fn wrote are restored, transactions run concurrently
+// and are not isolated from writes of the same records or tasks by others
+func (r *MockRepository) WithinTransaction(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	r.txMu.RLock()
+	defer r.txMu.RUnlock()
+
+	tx := &mockTx{MockRepository: r}
+	if err := fn(ctx, tx); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	return nil
+}
+
 // Close closes the repository (no-op for mock)
 func (r *MockRepository) Close() error {
 	return nil
@@ -312,13 +721,40 @@ func (r *MockRepository) GetAllRecords() map[string]*models.Record {
 	result := make(map[string]*models.Record)
 	for id, record := range r.records {
 		result[id] = &models.Record{
-			ID:    record.ID,
-			Value: record.Value,
+			ID:       record.ID,
+			Type:     record.Type,
+			Value:    record.Value,
+			Hash:     record.Hash,
+			Encoding: record.Encoding,
+			Version:  record.Version,
 		}
 	}
 	return result
 }
 
+// Seed stores a copy of record as is, keeping its version, e.g. to set up
+// a scratch repository with records read from another
+func (r *MockRepository) Seed(record *models.Record) {
+	r.recordsMu.Lock()
+	defer r.recordsMu.Unlock()
+
+	recordCopy := *record
+	recordCopy.Value = append(json.RawMessage(nil), record.Value...)
+	r.records[record.ID] = &recordCopy
+	r.writtenAt[record.ID] = time.Now()
+}
+
+// SetValueForTesting replaces a stored value without updating its hash,
+// simulating an out-of-band edit (helper method for testing)
+func (r *MockRepository) SetValueForTesting(id string, value interface{}) {
+	r.recordsMu.Lock()
+	defer r.recordsMu.Unlock()
+
+	if record, ok := r.records[id]; ok {
+		r.records[id] = &models.Record{ID: record.ID, Type: record.Type, Value: models.MustEncodeValue(value), Hash: record.Hash, Encoding: record.Encoding, Version: record.Version}
+	}
+}
+
 // GetAllTasksForTesting returns all inbox tasks (helper method for testing)
 func (r *MockRepository) GetAllTasksForTesting() map[string]*models.InboxTask {
 	r.tasksMu.RLock()
@@ -342,7 +778,163 @@ func (r *MockRepository) copyTask(task *models.InboxTask) *models.InboxTask {
 		UpdatedAt: task.UpdatedAt,
 		Retries:   task.Retries,
 		Error:     task.Error,
+		TenantID:  task.TenantID,
 	}
 	copy(taskCopy.Payload, task.Payload)
+	taskCopy.Trace = copyTaskTrace(task.Trace)
+	if task.Result != nil {
+		result := *task.Result
+		taskCopy.Result = &result
+	}
 	return taskCopy
 }
+
+// copyTaskTrace copies a trace through JSON, nil for nil
+func copyTaskTrace(trace *models.TaskTrace) *models.TaskTrace {
+	if trace == nil {
+		return nil
+	}
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return nil
+	}
+	var traceCopy models.TaskTrace
+	if err := json.Unmarshal(data, &traceCopy); err != nil {
+		return nil
+	}
+	return &traceCopy
+}
+
+// TableStats reports row counts for the in-memory tables. There is no storage
+// to measure, so sizes and dead tuples are always zero
+func (r *MockRepository) TableStats(ctx context.Context, tables ...string) ([]*models.TableStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var stats []*models.TableStats
+	for _, table := range tables {
+		switch table {
+		case "records":
+			r.recordsMu.RLock()
+			stats = append(stats, &models.TableStats{Table: table, LiveTuples: int64(len(r.records))})
+			r.recordsMu.RUnlock()
+		case "inbox_tasks":
+			r.tasksMu.RLock()
+			stats = append(stats, &models.TableStats{Table: table, LiveTuples: int64(len(r.inboxTasks))})
+			r.tasksMu.RUnlock()
+		}
+	}
+
+	return stats, nil
+}
+
+// RecordAccess adds access counts to the in-memory statistics
+func (r *MockRepository) RecordAccess(ctx context.Context, stats []*models.RecordAccessStats) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+
+	for _, s := range stats {
+		stored, ok := r.accessStats[s.ID]
+		if !ok {
+			stored = &models.RecordAccessStats{ID: s.ID}
+			r.accessStats[s.ID] = stored
+		}
+		stored.Reads += s.Reads
+		stored.Writes += s.Writes
+		stored.LastReadAt = laterTime(stored.LastReadAt, s.LastReadAt)
+		stored.LastWriteAt = laterTime(stored.LastWriteAt, s.LastWriteAt)
+	}
+	return nil
+}
+
+// HottestRecords returns the records with the highest access counts
+func (r *MockRepository) HottestRecords(ctx context.Context, limit int, orderBy string) ([]*models.RecordAccessStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var count func(s *models.RecordAccessStats) int64
+	switch orderBy {
+	case models.AccessOrderReads:
+		count = func(s *models.RecordAccessStats) int64 { return s.Reads }
+	case models.AccessOrderWrites:
+		count = func(s *models.RecordAccessStats) int64 { return s.Writes }
+	case models.AccessOrderTotal:
+		count = func(s *models.RecordAccessStats) int64 { return s.Reads + s.Writes }
+	default:
+		return nil, fmt.Errorf("unknown access stats ordering %q", orderBy)
+	}
+
+	r.statsMu.Lock()
+	stats := make([]*models.RecordAccessStats, 0, len(r.accessStats))
+	for _, s := range r.accessStats {
+		copied := *s
+		stats = append(stats, &copied)
+	}
+	r.statsMu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if ci, cj := count(stats[i]), count(stats[j]); ci != cj {
+			return ci > cj
+		}
+		return stats[i].ID < stats[j].ID
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// laterTime returns the later of two optional times
+func laterTime(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+// RecordHistory returns the history entries of a record, oldest first
+func (r *MockRepository) RecordHistory(ctx context.Context, id string, limit, offset int) ([]*models.RecordHistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.recordsMu.RLock()
+	defer r.recordsMu.RUnlock()
+
+	history := r.history[id]
+	start := min(offset, len(history))
+	end := min(start+limit, len(history))
+
+	entries := make([]*models.RecordHistoryEntry, 0, end-start)
+	for _, entry := range history[start:end] {
+		copied := *entry
+		entries = append(entries, &copied)
+	}
+	return entries, nil
+}
+
+// RecordVersion returns the latest insert or update of a record that left
+// it at version
+func (r *MockRepository) RecordVersion(ctx context.Context, id string, version int64) (*models.RecordHistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.recordsMu.RLock()
+	defer r.recordsMu.RUnlock()
+
+	history := r.history[id]
+	for i := len(history) - 1; i >= 0; i-- {
+		if entry := history[i]; entry.Version == version && entry.Operation != models.HistoryDelete {
+			copied := *entry
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("version %d of record '%s': %w", version, id, models.ErrVersionNotFound)
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// mockTx is the repository a mock transaction hands to its function. Each
+// write saves the state of the records or tasks it touches first, so a
+// rollback restores exactly what the transaction wrote
+type mockTx struct {
+	*MockRepository
+
+	mu   sync.Mutex
+	undo []func()
+}
+
+// WithinTransaction joins the transaction, a failing fn undoes its own
+// writes before the error reaches the caller
+func (tx *mockTx) WithinTransaction(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	nested := &mockTx{MockRepository: tx.MockRepository}
+	if err := fn(ctx, nested); err != nil {
+		nested.rollback()
+		return err
+	}
+
+	tx.mu.Lock()
+	tx.undo = append(tx.undo, nested.undo...)
+	tx.mu.Unlock()
+	return nil
+}
+
+// Insert creates a new record
+func (tx *mockTx) Insert(ctx context.Context, record *models.Record) error {
+	return tx.writeRecords(func() error { return tx.MockRepository.Insert(ctx, record) }, record.ID)
+}
+
+// Update modifies an existing record
+func (tx *mockTx) Update(ctx context.Context, record *models.Record) error {
+	return tx.writeRecords(func() error { return tx.MockRepository.Update(ctx, record) }, record.ID)
+}
+
+// UpdateIfVersion modifies an existing record that still has version expected
+func (tx *mockTx) UpdateIfVersion(ctx context.Context, record *models.Record, expected int64) error {
+	return tx.writeRecords(func() error { return tx.MockRepository.UpdateIfVersion(ctx, record, expected) }, record.ID)
+}
+
+// Delete removes a record by ID
+func (tx *mockTx) Delete(ctx context.Context, id string) error {
+	return tx.writeRecords(func() error { return tx.MockRepository.Delete(ctx, id) }, id)
+}
+
+// DeleteIfVersion removes a record that still has version expected
+func (tx *mockTx) DeleteIfVersion(ctx context.Context, id string, expected int64) error {
+	return tx.writeRecords(func() error { return tx.MockRepository.DeleteIfVersion(ctx, id, expected) }, id)
+}
+
+// CreateTask creates a new task in the inbox
+func (tx *mockTx) CreateTask(ctx context.Context, task *models.InboxTask) error {
+	return tx.writeTasks(func() error { return tx.MockRepository.CreateTask(ctx, task) }, task.ID)
+}
+
+// CreateTasks creates several tasks in the inbox at once
+func (tx *mockTx) CreateTasks(ctx context.Context, tasks []*models.InboxTask) error {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return tx.writeTasks(func() error { return tx.MockRepository.CreateTasks(ctx, tasks) }, ids...)
+}
+
+// UpdateTaskStatus updates the status of a task
+func (tx *mockTx) UpdateTaskStatus(ctx context.Context, taskID string, status string, errorMsg string) error {
+	return tx.writeTasks(func() error { return tx.MockRepository.UpdateTaskStatus(ctx, taskID, status, errorMsg) }, taskID)
+}
+
+// CompleteTask marks a task completed with the result of its operation
+func (tx *mockTx) CompleteTask(ctx context.Context, taskID string, result *models.TaskResult) error {
+	return tx.writeTasks(func() error { return tx.MockRepository.CompleteTask(ctx, taskID, result) }, taskID)
+}
+
+// IncrementTaskRetries increments the retry count for a task
+func (tx *mockTx) IncrementTaskRetries(ctx context.Context, taskID string) error {
+	return tx.writeTasks(func() error { return tx.MockRepository.IncrementTaskRetries(ctx, taskID) }, taskID)
+}
+
+// SetTaskTrace stores the processing trace of a task
+func (tx *mockTx) SetTaskTrace(ctx context.Context, taskID string, trace *models.TaskTrace) error {
+	return tx.writeTasks(func() error { return tx.MockRepository.SetTaskTrace(ctx, taskID, trace) }, taskID)
+}
+
+// DeleteCompletedTasks removes completed tasks older than specified duration
+func (tx *mockTx) DeleteCompletedTasks(ctx context.Context, olderThanHours int) error {
+	cutoffTime := time.Now().Add(-time.Duration(olderThanHours) * time.Hour)
+
+	tx.tasksMu.RLock()
+	var ids []string
+	for id, task := range tx.inboxTasks {
+		if (task.Status == models.TaskStatusCompleted || task.Status == models.TaskStatusFailed) &&
+			task.UpdatedAt.Before(cutoffTime) {
+			ids = append(ids, id)
+		}
+	}
+	tx.tasksMu.RUnlock()
+
+	return tx.writeTasks(func() error { return tx.MockRepository.DeleteCompletedTasks(ctx, olderThanHours) }, ids...)
+}
+
+// writeRecords runs write after saving the records with the IDs, logging
+// their restore once write succeeds
+func (tx *mockTx) writeRecords(write func() error, ids ...string) error {
+	type savedRecord struct {
+		record    *models.Record
+		writtenAt time.Time
+		history   int
+	}
+
+	// Stored records are never modified, saving the pointers is enough
+	tx.recordsMu.RLock()
+	saved := make(map[string]savedRecord, len(ids))
+	for _, id := range ids {
+		saved[id] = savedRecord{tx.records[id], tx.writtenAt[id], len(tx.history[id])}
+	}
+	tx.recordsMu.RUnlock()
+
+	if err := write(); err != nil {
+		return err
+	}
+
+	tx.log(func() {
+		tx.recordsMu.Lock()
+		defer tx.recordsMu.Unlock()
+		for id, s := range saved {
+			if s.record != nil {
+				tx.records[id] = s.record
+				tx.writtenAt[id] = s.writtenAt
+			} else {
+				delete(tx.records, id)
+				delete(tx.writtenAt, id)
+			}
+			if s.history > 0 {
+				tx.history[id] = tx.history[id][:s.history]
+			} else {
+				delete(tx.history, id)
+			}
+		}
+	})
+	return nil
+}
+
+// writeTasks runs write after saving copies of the tasks with the IDs,
+// logging their restore once write succeeds
+func (tx *mockTx) writeTasks(write func() error, ids ...string) error {
+	// Tasks are modified in place, so they are copied
+	tx.tasksMu.RLock()
+	saved := make(map[string]*models.InboxTask, len(ids))
+	for _, id := range ids {
+		if task, ok := tx.inboxTasks[id]; ok {
+			saved[id] = tx.copyTask(task)
+		} else {
+			saved[id] = nil
+		}
+	}
+	tx.tasksMu.RUnlock()
+
+	if err := write(); err != nil {
+		return err
+	}
+
+	tx.log(func() {
+		tx.tasksMu.Lock()
+		defer tx.tasksMu.Unlock()
+		for id, task := range saved {
+			if task != nil {
+				tx.inboxTasks[id] = task
+			} else {
+				delete(tx.inboxTasks, id)
+			}
+		}
+	})
+	return nil
+}
+
+// log appends an undo step to the transaction
+func (tx *mockTx) log(undo func()) {
+	tx.mu.Lock()
+	tx.undo = append(tx.undo, undo)
+	tx.mu.Unlock()
+}
+
+// rollback undoes the writes of the transaction, latest first
+func (tx *mockTx) rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.undo = nil
+}
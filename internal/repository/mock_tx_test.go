@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestMockRepository_WithinTransaction(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockRepository()
+	errFail := errors.New("fail")
+
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: json.RawMessage(`{"n": 1}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.CreateTask(ctx, &models.InboxTask{ID: "task_1", Status: models.TaskStatusPending}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err := mock.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+		if err := repo.Update(ctx, &models.Record{ID: "user_1", Value: json.RawMessage(`{"n": 2}`)}); err != nil {
+			return err
+		}
+		if err := repo.Insert(ctx, &models.Record{ID: "user_2", Value: json.RawMessage(`{}`)}); err != nil {
+			return err
+		}
+		if err := repo.CompleteTask(ctx, "task_1", nil); err != nil {
+			return err
+		}
+
+		// Writes made outside the transaction meanwhile survive its rollback
+		if err := mock.Insert(ctx, &models.Record{ID: "user_3", Value: json.RawMessage(`{}`)}); err != nil {
+			return err
+		}
+		if err := mock.CreateTask(ctx, &models.InboxTask{ID: "task_2", Status: models.TaskStatusPending}); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+
+	record, err := mock.Get(ctx, "user_1")
+	if err != nil || record.Version != 1 || string(record.Value) != `{"n": 1}` {
+		t.Errorf("Expected user_1 restored to version 1, got %+v, %v", record, err)
+	}
+	if history, _ := mock.RecordHistory(ctx, "user_1", 10, 0); len(history) != 1 {
+		t.Errorf("Expected the update dropped from the history, got %d entries", len(history))
+	}
+	if _, err := mock.Get(ctx, "user_2"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected user_2 rolled back, got %v", err)
+	}
+	if task, _ := mock.GetTask(ctx, "task_1"); task.Status != models.TaskStatusPending {
+		t.Errorf("Expected task_1 pending again, got %s", task.Status)
+	}
+	if _, err := mock.Get(ctx, "user_3"); err != nil {
+		t.Errorf("Expected user_3 written outside the transaction kept, got %v", err)
+	}
+	if _, err := mock.GetTask(ctx, "task_2"); err != nil {
+		t.Errorf("Expected task_2 created outside the transaction kept, got %v", err)
+	}
+
+	// A failing nested transaction undoes only its own writes
+	err = mock.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+		if err := repo.Delete(ctx, "user_3"); err != nil {
+			return err
+		}
+		nested := repo.(Transactor).WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+			if err := repo.Delete(ctx, "user_1"); err != nil {
+				return err
+			}
+			return errFail
+		})
+		if !errors.Is(nested, errFail) {
+			t.Errorf("Expected the error of the nested fn, got %v", nested)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := mock.Get(ctx, "user_1"); err != nil {
+		t.Errorf("Expected user_1 restored by the nested rollback, got %v", err)
+	}
+	if _, err := mock.Get(ctx, "user_3"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected the committed delete of user_3 kept, got %v", err)
+	}
+}
+
+func TestMockRepository_ConcurrentTransactions(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockRepository()
+
+	// A transaction waiting on another does not block it
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- mock.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+			close(started)
+			<-release
+			return repo.Insert(ctx, &models.Record{ID: "user_1", Value: json.RawMessage(`{}`)})
+		})
+	}()
+	<-started
+
+	finished := make(chan error)
+	go func() {
+		finished <- mock.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+			return repo.Insert(ctx, &models.Record{ID: "user_2", Value: json.RawMessage(`{}`)})
+		})
+	}()
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the second transaction to run while the first one is open")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
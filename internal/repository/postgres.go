@@ -3,30 +3,107 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"mit-service/internal/models"
+	"mit-service/internal/reqtrace"
 
 	"github.com/lib/pq"
-	_ "github.com/lib/pq"
 )
 
+// querier is the subset of *sql.DB and *sql.Tx used by the repository
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// tracedQuerier records the statements of traced requests, see reqtrace
+type tracedQuerier struct {
+	querier
+}
+
+func (q tracedQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := q.querier.ExecContext(ctx, query, args...)
+	reqtrace.FromContext(ctx).Query(query, len(args), time.Since(start), err)
+	return result, err
+}
+
+func (q tracedQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := q.querier.QueryContext(ctx, query, args...)
+	reqtrace.FromContext(ctx).Query(query, len(args), time.Since(start), err)
+	return rows, err
+}
+
+func (q tracedQuerier) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := q.querier.QueryRowContext(ctx, query, args...)
+	reqtrace.FromContext(ctx).Query(query, len(args), time.Since(start), row.Err())
+	return row
+}
+
 // PostgresRepository implements Repository interface using PostgreSQL
 type PostgresRepository struct {
 	db *sql.DB
+	q  querier // db, or the transaction for transaction-scoped repositories
+
+	// Per-operation deadlines, zero means no deadline beyond the caller's
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// inboxPartitioned is set when inbox_tasks is partitioned by day
+	inboxPartitioned bool
+}
+
+// SchemaOptions controls how tables are laid out when the schema is created
+type SchemaOptions struct {
+	// RecordPartitions hash-partitions the records table by id into this many
+	// partitions, zero keeps a plain table
+	RecordPartitions int
+
+	// PartitionInbox range-partitions the inbox_tasks table by created_at into
+	// daily partitions, so cleanup can drop whole partitions
+	PartitionInbox bool
+
+	// RecordHistory appends every write of a record to records_history.
+	// Without it the trigger filling the table is dropped, the table kept
+	RecordHistory bool
 }
 
 // NewPostgresRepository creates a new PostgreSQL repository
 func NewPostgresRepository(connectionString string) (*PostgresRepository, error) {
-	db, err := sql.Open("postgres", connectionString)
+	return NewPostgresRepositoryWithSchema(connectionString, SchemaOptions{})
+}
+
+// NewPostgresRepositoryWithSchema creates a new PostgreSQL repository, creating
+// missing tables according to schema
+func NewPostgresRepositoryWithSchema(connectionString string, schema SchemaOptions) (*PostgresRepository, error) {
+	connector, err := pq.NewConnector(connectionString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
+	return NewPostgresRepositoryWithConnector(connector, schema)
+}
+
+// NewPostgresRepositoryWithConnector creates a PostgreSQL repository opening
+// its connections through connector, e.g. one authenticating with tokens
+func NewPostgresRepositoryWithConnector(connector driver.Connector, schema SchemaOptions) (*PostgresRepository, error) {
+	db := sql.OpenDB(connector)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
 	// Test the connection
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
@@ -35,10 +112,11 @@ func NewPostgresRepository(connectionString string) (*PostgresRepository, error)
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(time.Minute * 5)
 
-	repo := &PostgresRepository{db: db}
+	repo := &PostgresRepository{db: db, q: tracedQuerier{db}}
 
 	// Initialize database schema
-	if err := repo.initSchema(); err != nil {
+	if err := repo.initSchema(ctx, schema); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
@@ -46,14 +124,31 @@ func NewPostgresRepository(connectionString string) (*PostgresRepository, error)
 }
 
 // initSchema creates the required tables
-func (r *PostgresRepository) initSchema() error {
+func (r *PostgresRepository) initSchema(ctx context.Context, schema SchemaOptions) error {
+	if schema.RecordPartitions > 0 {
+		if err := r.initPartitionedRecords(ctx, schema.RecordPartitions); err != nil {
+			return err
+		}
+	} else {
+		if _, err := r.db.ExecContext(ctx, recordsTableDDL); err != nil {
+			return fmt.Errorf("failed to execute query: %s, error: %w", recordsTableDDL, err)
+		}
+	}
+
+	if schema.PartitionInbox {
+		if err := r.initPartitionedInbox(ctx); err != nil {
+			return err
+		}
+	}
+
+	// The table statement is a no-op when the partitioned table was created above
 	queries := []string{
-		`CREATE TABLE IF NOT EXISTS records (
-			id VARCHAR(255) PRIMARY KEY,
-			value JSONB NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-		)`,
+		`ALTER TABLE records ADD COLUMN IF NOT EXISTS type VARCHAR(255)`,
+		`CREATE INDEX IF NOT EXISTS idx_records_type ON records(type)`,
+		`ALTER TABLE records ADD COLUMN IF NOT EXISTS value_hash CHAR(64)`,
+		`ALTER TABLE records ADD COLUMN IF NOT EXISTS value_encoding VARCHAR(16)`,
+		`ALTER TABLE records ADD COLUMN IF NOT EXISTS value_proto BYTEA`,
+		`ALTER TABLE records ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1`,
 		`CREATE TABLE IF NOT EXISTS inbox_tasks (
 			id VARCHAR(255) PRIMARY KEY,
 			operation VARCHAR(50) NOT NULL,
@@ -64,12 +159,28 @@ func (r *PostgresRepository) initSchema() error {
 			retries INTEGER DEFAULT 0,
 			error TEXT
 		)`,
+		`ALTER TABLE inbox_tasks ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255) NOT NULL DEFAULT ''`,
+		`ALTER TABLE inbox_tasks ADD COLUMN IF NOT EXISTS trace JSONB`,
+		`ALTER TABLE inbox_tasks ADD COLUMN IF NOT EXISTS result JSONB`,
 		`CREATE INDEX IF NOT EXISTS idx_inbox_tasks_status ON inbox_tasks(status)`,
 		`CREATE INDEX IF NOT EXISTS idx_inbox_tasks_created_at ON inbox_tasks(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_inbox_tasks_open_record ON inbox_tasks ((payload->>'id'))
+			WHERE status IN ('pending', 'processing')`,
+		`CREATE INDEX IF NOT EXISTS idx_inbox_tasks_completed ON inbox_tasks (updated_at, id)
+			WHERE status = 'completed'`,
+		`CREATE INDEX IF NOT EXISTS idx_inbox_tasks_finished ON inbox_tasks (updated_at, id)
+			WHERE status IN ('completed', 'failed')`,
+		recordAccessStatsDDL,
+	}
+	queries = append(queries, recordHistoryDDL...)
+	if schema.RecordHistory {
+		queries = append(queries, createRecordHistoryTrigger)
+	} else {
+		queries = append(queries, dropRecordHistoryTrigger)
 	}
 
 	for _, query := range queries {
-		if _, err := r.db.Exec(query); err != nil {
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
 			return fmt.Errorf("failed to execute query: %s, error: %w", query, err)
 		}
 	}
@@ -79,18 +190,77 @@ func (r *PostgresRepository) initSchema() error {
 
 // Record operations
 
+// recordColumns are the record columns read by Get and ListRecords, in the
+// order decodeValue expects
+const recordColumns = `id, COALESCE(type, ''), value, COALESCE(value_hash, ''), COALESCE(value_encoding, ''), value_proto, version`
+
+// Queries shared with ExplainQueries
+const (
+	getRecordQuery = `SELECT ` + recordColumns + ` FROM records WHERE id = $1`
+
+	taskStatsQuery = `SELECT 
+				COUNT(*) as total,
+				COUNT(CASE WHEN status = 'pending' THEN 1 END) as pending,
+				COUNT(CASE WHEN status = 'processing' THEN 1 END) as processing,
+				COUNT(CASE WHEN status = 'completed' THEN 1 END) as completed,
+				COUNT(CASE WHEN status = 'failed' THEN 1 END) as failed,
+				MIN(CASE WHEN status = 'pending' THEN created_at END) as oldest_pending
+			  FROM inbox_tasks`
+)
+
+// encodeValue returns the value and protobuf columns and the hash of a
+// record. Protobuf values are stored as bytes with a JSON null value. The
+// hash is taken of the canonical encoding, the JSON is stored as written
+func encodeValue(record *models.Record) (valueJSON, proto []byte, hash string, err error) {
+	if record.Encoding == models.EncodingProtobuf {
+		proto, err = record.ProtoData()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		hash, err = models.ValueHash(proto)
+		return []byte("null"), proto, hash, err
+	}
+
+	valueJSON, err = json.Marshal(record.Value)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to marshal value: %w", err)
+	}
+	hash, err = models.ValueHash(record.Value)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to hash value: %w", err)
+	}
+	return valueJSON, nil, hash, nil
+}
+
+// decodeValue sets the value of a scanned record. JSON values are kept as
+// the JSONB text, they are only decoded where they are inspected
+func decodeValue(record *models.Record, valueJSON, proto []byte) {
+	if record.Encoding == models.EncodingProtobuf {
+		record.Value = models.ProtoValue(proto)
+		return
+	}
+	record.Value = valueJSON
+}
+
 // Insert creates a new record
-func (r *PostgresRepository) Insert(ctx context.Context, record *models.Record) error {
-	valueJSON, err := json.Marshal(record.Value)
+func (r *PostgresRepository) Insert(ctx context.Context, record *models.Record) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	valueJSON, proto, hash, err := encodeValue(record)
 	if err != nil {
-		return fmt.Errorf("failed to marshal value: %w", err)
+		return err
 	}
 
-	query := `INSERT INTO records (id, value) VALUES ($1, $2)`
-	_, err = r.db.ExecContext(ctx, query, record.ID, valueJSON)
+	query := `INSERT INTO records (id, type, value, value_hash, value_encoding, value_proto)
+			  VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), $6)`
+	err = r.withSavepoint(ctx, func() error {
+		_, err := r.q.ExecContext(ctx, query, record.ID, record.Type, valueJSON, hash, record.Encoding, proto)
+		return err
+	})
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return fmt.Errorf("record with id '%s' already exists", record.ID)
+			return fmt.Errorf("record with id '%s' %w", record.ID, models.ErrRecordExists)
 		}
 		return fmt.Errorf("failed to insert record: %w", err)
 	}
@@ -100,13 +270,27 @@ func (r *PostgresRepository) Insert(ctx context.Context, record *models.Record)
 
 // Update modifies an existing record
 func (r *PostgresRepository) Update(ctx context.Context, record *models.Record) error {
-	valueJSON, err := json.Marshal(record.Value)
+	return r.update(ctx, record, 0)
+}
+
+// UpdateIfVersion modifies an existing record that still has version expected
+func (r *PostgresRepository) UpdateIfVersion(ctx context.Context, record *models.Record, expected int64) error {
+	return r.update(ctx, record, expected)
+}
+
+// update modifies an existing record with version expected, any for 0
+func (r *PostgresRepository) update(ctx context.Context, record *models.Record, expected int64) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	valueJSON, proto, hash, err := encodeValue(record)
 	if err != nil {
-		return fmt.Errorf("failed to marshal value: %w", err)
+		return err
 	}
 
-	query := `UPDATE records SET value = $2, updated_at = NOW() WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, record.ID, valueJSON)
+	query := `UPDATE records SET value = $2, value_hash = $3, value_encoding = NULLIF($4, ''), value_proto = $5,
+			  version = version + 1, updated_at = NOW() WHERE id = $1 AND ($6::bigint = 0 OR version = $6)`
+	result, err := r.q.ExecContext(ctx, query, record.ID, valueJSON, hash, record.Encoding, proto, expected)
 	if err != nil {
 		return fmt.Errorf("failed to update record: %w", err)
 	}
@@ -117,7 +301,7 @@ func (r *PostgresRepository) Update(ctx context.Context, record *models.Record)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("record with id '%s' not found", record.ID)
+		return r.missingOrConflict(ctx, record.ID, expected)
 	}
 
 	return nil
@@ -125,8 +309,21 @@ func (r *PostgresRepository) Update(ctx context.Context, record *models.Record)
 
 // Delete removes a record by ID
 func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM records WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
+	return r.delete(ctx, id, 0)
+}
+
+// DeleteIfVersion removes a record that still has version expected
+func (r *PostgresRepository) DeleteIfVersion(ctx context.Context, id string, expected int64) error {
+	return r.delete(ctx, id, expected)
+}
+
+// delete removes a record with version expected, any for 0
+func (r *PostgresRepository) delete(ctx context.Context, id string, expected int64) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	query := `DELETE FROM records WHERE id = $1 AND ($2::bigint = 0 OR version = $2)`
+	result, err := r.q.ExecContext(ctx, query, id, expected)
 	if err != nil {
 		return fmt.Errorf("failed to delete record: %w", err)
 	}
@@ -137,55 +334,223 @@ func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("record with id '%s' not found", id)
+		return r.missingOrConflict(ctx, id, expected)
 	}
 
 	return nil
 }
 
+// missingOrConflict returns the error of a write with version expected that
+// matched no row: the record is gone or, when it still exists, has another
+// version
+func (r *PostgresRepository) missingOrConflict(ctx context.Context, id string, expected int64) error {
+	notFound := fmt.Errorf("record with id '%s' %w", id, models.ErrRecordNotFound)
+	if expected == 0 {
+		return notFound
+	}
+
+	var version int64
+	err := r.q.QueryRowContext(ctx, `SELECT version FROM records WHERE id = $1`, id).Scan(&version)
+	if err == sql.ErrNoRows {
+		return notFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read record version: %w", err)
+	}
+	return fmt.Errorf("record with id '%s' has version %d, expected %d: %w", id, version, expected, models.ErrVersionConflict)
+}
+
 // Get retrieves a record by ID
-func (r *PostgresRepository) Get(ctx context.Context, id string) (*models.Record, error) {
-	query := `SELECT id, value FROM records WHERE id = $1`
-	row := r.db.QueryRowContext(ctx, query, id)
+func (r *PostgresRepository) Get(ctx context.Context, id string) (_ *models.Record, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	row := r.q.QueryRowContext(ctx, getRecordQuery, id)
 
 	var record models.Record
-	var valueJSON []byte
+	var valueJSON, proto []byte
 
-	err := row.Scan(&record.ID, &valueJSON)
+	err = row.Scan(&record.ID, &record.Type, &valueJSON, &record.Hash, &record.Encoding, &proto, &record.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("record with id '%s' not found", id)
+			return nil, fmt.Errorf("record with id '%s' %w", id, models.ErrRecordNotFound)
 		}
 		return nil, fmt.Errorf("failed to scan record: %w", err)
 	}
 
-	if err := json.Unmarshal(valueJSON, &record.Value); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal value: %w", err)
+	decodeValue(&record, valueJSON, proto)
+	return &record, nil
+}
+
+// ListRecords retrieves records matching filter ordered by ID
+func (r *PostgresRepository) ListRecords(ctx context.Context, filter models.RecordFilter) (_ []*models.Record, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query, args := listRecordsQuery(filter)
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []*models.Record{}
+	for rows.Next() {
+		var record models.Record
+		var valueJSON, proto []byte
+		if err := rows.Scan(&record.ID, &record.Type, &valueJSON, &record.Hash, &record.Encoding, &proto, &record.Version); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		decodeValue(&record, valueJSON, proto)
+		records = append(records, &record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return &record, nil
+	return records, nil
+}
+
+// listRecordsQuery builds the query and arguments of ListRecords
+func listRecordsQuery(filter models.RecordFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Type != "" {
+		addCondition("type = $%d", filter.Type)
+	}
+	if filter.Prefix != "" {
+		addCondition("id LIKE $%d", likePrefix(filter.Prefix))
+	}
+	if filter.ExcludePrefix != "" {
+		addCondition("id NOT LIKE $%d", likePrefix(filter.ExcludePrefix))
+	}
+	if filter.AfterID != "" {
+		addCondition("id > $%d", filter.AfterID)
+	}
+	if !filter.WrittenBefore.IsZero() {
+		addCondition("updated_at < $%d", filter.WrittenBefore)
+	}
+
+	query := `SELECT ` + recordColumns + ` FROM records`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	return query, args
+}
+
+// CountExpiredRecords counts records whose ID starts with prefix and that
+// were last written before cutoff
+func (r *PostgresRepository) CountExpiredRecords(ctx context.Context, prefix string, cutoff time.Time) (_ int, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT COUNT(*) FROM records WHERE id LIKE $1 AND updated_at < $2`
+
+	var count int
+	err = r.q.QueryRowContext(ctx, query, likePrefix(prefix), cutoff).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count expired records: %w", err)
+	}
+
+	return count, nil
+}
+
+// likePrefix builds a LIKE pattern matching strings starting with prefix,
+// escaping the LIKE wildcards it may contain (e.g. the "_" in "tmp_")
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
 }
 
 // Inbox operations
 
 // CreateTask creates a new task in the inbox
-func (r *PostgresRepository) CreateTask(ctx context.Context, task *models.InboxTask) error {
-	query := `INSERT INTO inbox_tasks (id, operation, payload, status, created_at, updated_at, retries) 
-			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
+func (r *PostgresRepository) CreateTask(ctx context.Context, task *models.InboxTask) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
 
-	_, err := r.db.ExecContext(ctx, query,
+	query := r.claimTaskIDs(`VALUES ($1)`) + `INSERT INTO inbox_tasks (id, operation, payload, status, created_at, updated_at, retries, tenant_id) 
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = r.q.ExecContext(ctx, query,
 		task.ID, task.Operation, task.Payload, task.Status,
-		task.CreatedAt, task.UpdatedAt, task.Retries)
+		task.CreatedAt, task.UpdatedAt, task.Retries, task.TenantID)
 
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return fmt.Errorf("task with id '%s' %w", task.ID, models.ErrTaskExists)
+		}
 		return fmt.Errorf("failed to create inbox task: %w", err)
 	}
 
 	return nil
 }
 
+// claimTaskIDs returns the WITH clause claiming the IDs of the tasks an
+// INSERT INTO inbox_tasks creates in inbox_task_ids, selected by ids. Only
+// the partitioned inbox needs it: its primary key includes created_at, so
+// it does not keep IDs unique, while the primary key of inbox_task_ids
+// fails the statement with a unique violation on a reused ID
+func (r *PostgresRepository) claimTaskIDs(ids string) string {
+	if !r.inboxPartitioned {
+		return ""
+	}
+	return `WITH claimed AS (INSERT INTO ` + inboxTaskIDsTable + ` (id) ` + ids + `) `
+}
+
+// CreateTasks creates several tasks in the inbox with a single multi-row
+// insert
+func (r *PostgresRepository) CreateTasks(ctx context.Context, tasks []*models.InboxTask) (err error) {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	ids := make([]string, len(tasks))
+	operations := make([]string, len(tasks))
+	payloads := make([]string, len(tasks))
+	statuses := make([]string, len(tasks))
+	createdAt := make([]string, len(tasks))
+	updatedAt := make([]string, len(tasks))
+	retries := make([]int64, len(tasks))
+	tenants := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i], operations[i], payloads[i], statuses[i] = task.ID, task.Operation, string(task.Payload), task.Status
+		createdAt[i] = task.CreatedAt.Format(time.RFC3339Nano)
+		updatedAt[i] = task.UpdatedAt.Format(time.RFC3339Nano)
+		retries[i] = int64(task.Retries)
+		tenants[i] = task.TenantID
+	}
+
+	query := r.claimTaskIDs(`SELECT unnest($1::text[])`) + `INSERT INTO inbox_tasks (id, operation, payload, status, created_at, updated_at, retries, tenant_id)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::jsonb[], $4::text[], $5::timestamptz[], $6::timestamptz[], $7::int[], $8::text[])`
+
+	_, err = r.q.ExecContext(ctx, query, pq.Array(ids), pq.Array(operations), pq.Array(payloads),
+		pq.Array(statuses), pq.Array(createdAt), pq.Array(updatedAt), pq.Array(retries), pq.Array(tenants))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return fmt.Errorf("failed to create inbox tasks: %s: %w", pqErr.Detail, models.ErrTaskExists)
+		}
+		return fmt.Errorf("failed to create inbox tasks: %w", err)
+	}
+
+	return nil
+}
+
 // GetPendingTasks retrieves pending tasks from the inbox and atomically marks them as processing
-func (r *PostgresRepository) GetPendingTasks(ctx context.Context, limit int) ([]*models.InboxTask, error) {
+func (r *PostgresRepository) GetPendingTasks(ctx context.Context, limit int) (_ []*models.InboxTask, err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
 	// Use UPDATE ... RETURNING to atomically claim tasks
 	query := `UPDATE inbox_tasks 
 			  SET status = $1, updated_at = NOW() 
@@ -196,9 +561,9 @@ func (r *PostgresRepository) GetPendingTasks(ctx context.Context, limit int) ([]
 			      LIMIT $3 
 			      FOR UPDATE SKIP LOCKED
 			  ) 
-			  RETURNING id, operation, payload, status, created_at, updated_at, retries, error`
+			  RETURNING id, operation, payload, status, created_at, updated_at, retries, error, tenant_id, result`
 
-	rows, err := r.db.QueryContext(ctx, query, models.TaskStatusProcessing, models.TaskStatusPending, limit)
+	rows, err := r.q.QueryContext(ctx, query, models.TaskStatusProcessing, models.TaskStatusPending, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to claim pending tasks: %w", err)
 	}
@@ -220,17 +585,15 @@ func (r *PostgresRepository) GetPendingTasks(ctx context.Context, limit int) ([]
 	return tasks, nil
 }
 
-// GetTasksByStatus retrieves tasks by status with pagination
-func (r *PostgresRepository) GetTasksByStatus(ctx context.Context, status string, limit, offset int) ([]*models.InboxTask, error) {
-	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error
-			  FROM inbox_tasks 
-			  WHERE status = $1 
-			  ORDER BY created_at DESC 
-			  LIMIT $2 OFFSET $3`
+// ListTasks retrieves the tasks selected by filter with pagination
+func (r *PostgresRepository) ListTasks(ctx context.Context, filter models.TaskFilter) (_ []*models.InboxTask, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
 
-	rows, err := r.db.QueryContext(ctx, query, status, limit, offset)
+	query, args := listTasksQuery(filter)
+	rows, err := r.q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query tasks by status: %w", err)
+		return nil, fmt.Errorf("failed to query tasks: %w", err)
 	}
 	defer rows.Close()
 
@@ -250,16 +613,179 @@ func (r *PostgresRepository) GetTasksByStatus(ctx context.Context, status string
 	return tasks, nil
 }
 
-// GetAllTasks retrieves all tasks with pagination
-func (r *PostgresRepository) GetAllTasks(ctx context.Context, limit, offset int) ([]*models.InboxTask, error) {
-	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error
-			  FROM inbox_tasks 
-			  ORDER BY created_at DESC 
-			  LIMIT $1 OFFSET $2`
+// listTasksQuery builds the query of ListTasks, shared with ExplainQueries
+func listTasksQuery(filter models.TaskFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.TenantID != "" {
+		addCondition("tenant_id = $%d", filter.TenantID)
+	}
+	if filter.Prefix != "" {
+		addCondition("id LIKE $%d", likePrefix(filter.Prefix))
+	}
+	if filter.ExcludePrefix != "" {
+		addCondition("id NOT LIKE $%d", likePrefix(filter.ExcludePrefix))
+	}
+
+	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error, tenant_id, result FROM inbox_tasks`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	return query, args
+}
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+// GetTask retrieves a task by ID
+func (r *PostgresRepository) GetTask(ctx context.Context, taskID string) (_ *models.InboxTask, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error, tenant_id, result, trace
+			  FROM inbox_tasks
+			  WHERE id = $1`
+
+	var trace []byte
+	task, err := r.scanTask(r.q.QueryRowContext(ctx, query, taskID), &trace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query all tasks: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("task with id '%s' %w", taskID, models.ErrRecordNotFound)
+		}
+		return nil, err
+	}
+
+	// Only the task detail carries the trace, the lists leave it out
+	if trace != nil {
+		task.Trace = &models.TaskTrace{}
+		if err := json.Unmarshal(trace, task.Trace); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal task trace: %w", err)
+		}
+	}
+	return task, nil
+}
+
+// GetTasksByIDs retrieves the tasks with the IDs in a single query
+func (r *PostgresRepository) GetTasksByIDs(ctx context.Context, taskIDs []string) (_ []*models.InboxTask, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error, tenant_id, result
+			  FROM inbox_tasks
+			  WHERE id = ANY($1)`
+
+	rows, err := r.q.QueryContext(ctx, query, pq.Array(taskIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tasks by ID: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*models.InboxTask
+	for rows.Next() {
+		task, err := r.scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// GetOpenTasksForRecord retrieves the pending or processing tasks whose
+// payload targets the record, using the partial index on the payload ID
+func (r *PostgresRepository) GetOpenTasksForRecord(ctx context.Context, recordID string, limit int) (_ []*models.InboxTask, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error, tenant_id, result
+			  FROM inbox_tasks
+			  WHERE payload->>'id' = $1 AND status IN ('pending', 'processing')
+			  ORDER BY created_at ASC
+			  LIMIT $2`
+
+	rows, err := r.q.QueryContext(ctx, query, recordID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*models.InboxTask
+	for rows.Next() {
+		task, err := r.scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// GetCompletedTasksAfter retrieves up to limit completed tasks ordered by
+// completion time and ID, starting after the given position
+func (r *PostgresRepository) GetCompletedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) (_ []*models.InboxTask, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error, tenant_id, result
+			  FROM inbox_tasks
+			  WHERE status = 'completed' AND (updated_at, id) > ($1, $2)
+			  ORDER BY updated_at ASC, id ASC
+			  LIMIT $3`
+
+	rows, err := r.q.QueryContext(ctx, query, after, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query completed tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*models.InboxTask
+	for rows.Next() {
+		task, err := r.scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// GetFinishedTasksAfter retrieves up to limit completed or failed tasks
+// ordered by completion time and ID, starting after the given position
+func (r *PostgresRepository) GetFinishedTasksAfter(ctx context.Context, after time.Time, afterID string, limit int) (_ []*models.InboxTask, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT id, operation, payload, status, created_at, updated_at, retries, error, tenant_id, result
+			  FROM inbox_tasks
+			  WHERE status IN ('completed', 'failed') AND (updated_at, id) > ($1, $2)
+			  ORDER BY updated_at ASC, id ASC
+			  LIMIT $3`
+
+	rows, err := r.q.QueryContext(ctx, query, after, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query finished tasks: %w", err)
 	}
 	defer rows.Close()
 
@@ -280,39 +806,72 @@ func (r *PostgresRepository) GetAllTasks(ctx context.Context, limit, offset int)
 }
 
 // GetTaskStats returns statistics about tasks by status
-func (r *PostgresRepository) GetTaskStats(ctx context.Context) (*models.TaskStats, error) {
-	query := `SELECT 
-				COUNT(*) as total,
-				COUNT(CASE WHEN status = 'pending' THEN 1 END) as pending,
-				COUNT(CASE WHEN status = 'processing' THEN 1 END) as processing,
-				COUNT(CASE WHEN status = 'completed' THEN 1 END) as completed,
-				COUNT(CASE WHEN status = 'failed' THEN 1 END) as failed
-			  FROM inbox_tasks`
+func (r *PostgresRepository) GetTaskStats(ctx context.Context) (_ *models.TaskStats, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
 
-	row := r.db.QueryRowContext(ctx, query)
+	row := r.q.QueryRowContext(ctx, taskStatsQuery)
 
 	var stats models.TaskStats
-	err := row.Scan(&stats.TotalTasks, &stats.PendingTasks, &stats.ProcessingTasks,
-		&stats.CompletedTasks, &stats.FailedTasks)
+	var oldestPending sql.NullTime
+	err = row.Scan(&stats.TotalTasks, &stats.PendingTasks, &stats.ProcessingTasks,
+		&stats.CompletedTasks, &stats.FailedTasks, &oldestPending)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get task stats: %w", err)
 	}
+	if oldestPending.Valid {
+		stats.OldestPendingAt = &oldestPending.Time
+	}
 
 	return &stats, nil
 }
 
+// CountOpenTasksByTenant counts the pending and processing tasks of each
+// tenant
+func (r *PostgresRepository) CountOpenTasksByTenant(ctx context.Context) (_ map[string]int, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT tenant_id, COUNT(*)
+			  FROM inbox_tasks
+			  WHERE status IN ('pending', 'processing') AND tenant_id <> ''
+			  GROUP BY tenant_id`
+	rows, err := r.q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count open tasks by tenant: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var tenant string
+		var count int
+		if err := rows.Scan(&tenant, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan tenant task count: %w", err)
+		}
+		counts[tenant] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return counts, nil
+}
+
 // Helper function to scan task from rows
-func (r *PostgresRepository) scanTask(scanner interface{}) (*models.InboxTask, error) {
+func (r *PostgresRepository) scanTask(scanner interface{}, extra ...interface{}) (*models.InboxTask, error) {
 	var task models.InboxTask
 	var errorStr sql.NullString
+	var result []byte
 
 	type Scanner interface {
 		Scan(dest ...interface{}) error
 	}
 
 	s := scanner.(Scanner)
-	err := s.Scan(&task.ID, &task.Operation, &task.Payload, &task.Status,
-		&task.CreatedAt, &task.UpdatedAt, &task.Retries, &errorStr)
+	dest := []interface{}{&task.ID, &task.Operation, &task.Payload, &task.Status,
+		&task.CreatedAt, &task.UpdatedAt, &task.Retries, &errorStr, &task.TenantID, &result}
+	err := s.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan task: %w", err)
 	}
@@ -320,17 +879,26 @@ func (r *PostgresRepository) scanTask(scanner interface{}) (*models.InboxTask, e
 	if errorStr.Valid {
 		task.Error = errorStr.String
 	}
+	if result != nil {
+		task.Result = &models.TaskResult{}
+		if err := json.Unmarshal(result, task.Result); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal task result: %w", err)
+		}
+	}
 
 	return &task, nil
 }
 
 // UpdateTaskStatus updates the status of a task
-func (r *PostgresRepository) UpdateTaskStatus(ctx context.Context, taskID string, status string, errorMsg string) error {
+func (r *PostgresRepository) UpdateTaskStatus(ctx context.Context, taskID string, status string, errorMsg string) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
 	query := `UPDATE inbox_tasks 
 			  SET status = $2, updated_at = NOW(), error = $3
 			  WHERE id = $1`
 
-	_, err := r.db.ExecContext(ctx, query, taskID, status, errorMsg)
+	_, err = r.q.ExecContext(ctx, query, taskID, status, errorMsg)
 	if err != nil {
 		return fmt.Errorf("failed to update task status: %w", err)
 	}
@@ -338,13 +906,58 @@ func (r *PostgresRepository) UpdateTaskStatus(ctx context.Context, taskID string
 	return nil
 }
 
+// CompleteTask marks a task completed with the result of its operation
+func (r *PostgresRepository) CompleteTask(ctx context.Context, taskID string, result *models.TaskResult) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task result: %w", err)
+	}
+
+	query := `UPDATE inbox_tasks 
+			  SET status = $2, updated_at = NOW(), error = '', result = $3
+			  WHERE id = $1`
+
+	_, err = r.q.ExecContext(ctx, query, taskID, models.TaskStatusCompleted, data)
+	if err != nil {
+		return fmt.Errorf("failed to complete task: %w", err)
+	}
+
+	return nil
+}
+
+// SetTaskTrace stores the processing trace of a task's last attempt
+func (r *PostgresRepository) SetTaskTrace(ctx context.Context, taskID string, trace *models.TaskTrace) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task trace: %w", err)
+	}
+
+	query := `UPDATE inbox_tasks SET trace = $2 WHERE id = $1`
+
+	_, err = r.q.ExecContext(ctx, query, taskID, data)
+	if err != nil {
+		return fmt.Errorf("failed to set task trace: %w", err)
+	}
+
+	return nil
+}
+
 // IncrementTaskRetries increments the retry count for a task
-func (r *PostgresRepository) IncrementTaskRetries(ctx context.Context, taskID string) error {
+func (r *PostgresRepository) IncrementTaskRetries(ctx context.Context, taskID string) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
 	query := `UPDATE inbox_tasks 
 			  SET retries = retries + 1, updated_at = NOW()
 			  WHERE id = $1`
 
-	_, err := r.db.ExecContext(ctx, query, taskID)
+	_, err = r.q.ExecContext(ctx, query, taskID)
 	if err != nil {
 		return fmt.Errorf("failed to increment task retries: %w", err)
 	}
@@ -353,12 +966,33 @@ func (r *PostgresRepository) IncrementTaskRetries(ctx context.Context, taskID st
 }
 
 // DeleteCompletedTasks removes completed tasks older than specified duration
-func (r *PostgresRepository) DeleteCompletedTasks(ctx context.Context, olderThanHours int) error {
+func (r *PostgresRepository) DeleteCompletedTasks(ctx context.Context, olderThanHours int) (err error) {
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	if r.inboxPartitioned {
+		// Dropping whole partitions is cheap, the DELETE below then only
+		// has to deal with partitions still holding live tasks
+		cutoff := time.Now().Add(-time.Duration(olderThanHours) * time.Hour)
+		if err := r.dropInboxPartitions(ctx, cutoff); err != nil {
+			return err
+		}
+		if err := r.ensureInboxPartitions(ctx, time.Now()); err != nil {
+			// New tasks still land in the default partition, keep cleaning up
+			log.Printf("Failed to prepare inbox partitions: %v", err)
+		}
+	}
+
 	query := `DELETE FROM inbox_tasks 
 			  WHERE status IN ($1, $2) 
 			  AND updated_at < NOW() - INTERVAL '%d hours'`
+	if r.inboxPartitioned {
+		// Release the IDs of the deleted tasks
+		query = `WITH deleted AS (` + query + ` RETURNING id)
+			  DELETE FROM ` + inboxTaskIDsTable + ` WHERE id IN (SELECT id FROM deleted)`
+	}
 
-	_, err := r.db.ExecContext(ctx, fmt.Sprintf(query, olderThanHours),
+	_, err = r.q.ExecContext(ctx, fmt.Sprintf(query, olderThanHours),
 		models.TaskStatusCompleted, models.TaskStatusFailed)
 	if err != nil {
 		return fmt.Errorf("failed to delete completed tasks: %w", err)
@@ -367,6 +1001,113 @@ func (r *PostgresRepository) DeleteCompletedTasks(ctx context.Context, olderThan
 	return nil
 }
 
+// SetQueryTimeouts sets per-operation deadlines for reads and writes
+func (r *PostgresRepository) SetQueryTimeouts(read, write time.Duration) {
+	r.readTimeout = read
+	r.writeTimeout = write
+}
+
+// withDeadline bounds ctx by the per-operation timeout. The returned finish
+// function releases the context and, when the operation ran out of time because
+// of this deadline or the server's statement_timeout, replaces the error with one
+// wrapping models.ErrQueryTimeout. Cancellation by the caller is left untouched
+func (r *PostgresRepository) withDeadline(ctx context.Context, timeout time.Duration) (context.Context, func(*error)) {
+	parent := ctx
+	cancel := func() {}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	return ctx, func(errp *error) {
+		cancel()
+
+		err := *errp
+		if err == nil || parent.Err() != nil || errors.Is(err, models.ErrQueryTimeout) {
+			return
+		}
+
+		var pqErr *pq.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &pqErr) && pqErr.Code == "57014") {
+			*errp = fmt.Errorf("%w: %v", models.ErrQueryTimeout, err)
+		}
+	}
+}
+
+// inTransaction reports whether the repository is bound to a transaction
+func (r *PostgresRepository) inTransaction() bool {
+	q := r.q
+	if traced, ok := q.(tracedQuerier); ok {
+		q = traced.querier
+	}
+	_, ok := q.(*sql.Tx)
+	return ok
+}
+
+// withSavepoint runs fn inside a savepoint when the repository is bound to a
+// transaction, so an expected failure (e.g. duplicate key) does not abort the
+// whole transaction and callers can keep using it
+func (r *PostgresRepository) withSavepoint(ctx context.Context, fn func() error) error {
+	if !r.inTransaction() {
+		return fn()
+	}
+
+	if _, err := r.q.ExecContext(ctx, "SAVEPOINT repo_op"); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	if err := fn(); err != nil {
+		if _, rbErr := r.q.ExecContext(ctx, "ROLLBACK TO SAVEPOINT repo_op"); rbErr != nil {
+			log.Printf("Failed to rollback to savepoint: %v", rbErr)
+		}
+		return err
+	}
+
+	if _, err := r.q.ExecContext(ctx, "RELEASE SAVEPOINT repo_op"); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+
+	return nil
+}
+
+// WithinTransaction runs fn with a repository bound to a single database
+// transaction, committing when fn succeeds and rolling back otherwise
+func (r *PostgresRepository) WithinTransaction(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	if r.inTransaction() {
+		// Already inside a transaction, join it
+		return fn(ctx, r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	txRepo := &PostgresRepository{
+		db:               r.db,
+		q:                tracedQuerier{tx},
+		readTimeout:      r.readTimeout,
+		writeTimeout:     r.writeTimeout,
+		inboxPartitioned: r.inboxPartitioned,
+	}
+	if err := fn(ctx, txRepo); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("Failed to rollback transaction: %v", rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// PoolStats returns the statistics of the connection pool
+func (r *PostgresRepository) PoolStats() sql.DBStats {
+	return r.db.Stats()
+}
+
 // Close closes the database connection
 func (r *PostgresRepository) Close() error {
 	return r.db.Close()
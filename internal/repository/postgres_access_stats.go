@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"mit-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// recordAccessStatsDDL creates the per-record access counters. Rows are not
+// removed with their records, so counts survive a delete and re-insert
+const recordAccessStatsDDL = `CREATE TABLE IF NOT EXISTS record_access_stats (
+			id VARCHAR(255) PRIMARY KEY,
+			reads BIGINT NOT NULL DEFAULT 0,
+			writes BIGINT NOT NULL DEFAULT 0,
+			last_read_at TIMESTAMP WITH TIME ZONE,
+			last_write_at TIMESTAMP WITH TIME ZONE
+		)`
+
+// accessOrderColumns maps HottestRecords orderings to SQL expressions
+var accessOrderColumns = map[string]string{
+	models.AccessOrderReads:  "reads",
+	models.AccessOrderWrites: "writes",
+	models.AccessOrderTotal:  "reads + writes",
+}
+
+// RecordAccess adds a batch of access counts in a single upsert
+func (r *PostgresRepository) RecordAccess(ctx context.Context, stats []*models.RecordAccessStats) (err error) {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	ctx, finish := r.withDeadline(ctx, r.writeTimeout)
+	defer finish(&err)
+
+	ids := make([]string, len(stats))
+	reads := make([]int64, len(stats))
+	writes := make([]int64, len(stats))
+	lastReads := make([]sql.NullString, len(stats))
+	lastWrites := make([]sql.NullString, len(stats))
+	for i, s := range stats {
+		ids[i], reads[i], writes[i] = s.ID, s.Reads, s.Writes
+		lastReads[i] = timestampText(s.LastReadAt)
+		lastWrites[i] = timestampText(s.LastWriteAt)
+	}
+
+	query := `INSERT INTO record_access_stats AS s (id, reads, writes, last_read_at, last_write_at)
+		SELECT * FROM unnest($1::text[], $2::bigint[], $3::bigint[], $4::timestamptz[], $5::timestamptz[])
+		ON CONFLICT (id) DO UPDATE SET
+			reads = s.reads + EXCLUDED.reads,
+			writes = s.writes + EXCLUDED.writes,
+			last_read_at = GREATEST(s.last_read_at, EXCLUDED.last_read_at),
+			last_write_at = GREATEST(s.last_write_at, EXCLUDED.last_write_at)`
+
+	_, err = r.q.ExecContext(ctx, query, pq.Array(ids), pq.Array(reads), pq.Array(writes),
+		pq.Array(lastReads), pq.Array(lastWrites))
+	if err != nil {
+		return fmt.Errorf("failed to record access stats: %w", err)
+	}
+	return nil
+}
+
+// HottestRecords returns the records with the highest access counts
+func (r *PostgresRepository) HottestRecords(ctx context.Context, limit int, orderBy string) (_ []*models.RecordAccessStats, err error) {
+	column, ok := accessOrderColumns[orderBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown access stats ordering %q", orderBy)
+	}
+
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT id, reads, writes, last_read_at, last_write_at
+		  FROM record_access_stats
+		 ORDER BY ` + column + ` DESC, id
+		 LIMIT $1`
+
+	rows, err := r.q.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query access stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*models.RecordAccessStats
+	for rows.Next() {
+		var s models.RecordAccessStats
+		var lastRead, lastWrite sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Reads, &s.Writes, &lastRead, &lastWrite); err != nil {
+			return nil, fmt.Errorf("failed to scan access stats: %w", err)
+		}
+		if lastRead.Valid {
+			s.LastReadAt = &lastRead.Time
+		}
+		if lastWrite.Valid {
+			s.LastWriteAt = &lastWrite.Time
+		}
+		stats = append(stats, &s)
+	}
+
+	return stats, rows.Err()
+}
+
+// timestampText formats t as a timestamptz array element, NULL when unset
+func timestampText(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(time.RFC3339Nano), Valid: true}
+}
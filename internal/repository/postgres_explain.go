@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mit-service/internal/models"
+)
+
+// QueryExplainer returns the query plans of the queries behind an endpoint.
+// With analyze the queries are executed and the plans carry timings,
+// without it they are only planned
+type QueryExplainer interface {
+	ExplainQueries(ctx context.Context, endpoint string, params url.Values, analyze bool) ([]*models.QueryPlan, error)
+}
+
+// explainedQuery is a canned query issued by an endpoint
+type explainedQuery struct {
+	name  string
+	query string
+	args  []interface{}
+}
+
+// explainedEndpoint lists the queries of an endpoint and the table they
+// read, which decides the database they run on in split mode
+type explainedEndpoint struct {
+	table   string
+	queries func(params url.Values) ([]explainedQuery, error)
+}
+
+// explainedEndpoints are the endpoints whose queries can be explained.
+// Limits and offsets default like the endpoints do
+var explainedEndpoints = map[string]explainedEndpoint{
+	"/get": {table: "records", queries: func(params url.Values) ([]explainedQuery, error) {
+		id := params.Get("id")
+		if id == "" {
+			return nil, fmt.Errorf("%w: /get needs an id", models.ErrInvalidExplain)
+		}
+		return []explainedQuery{{"Get", getRecordQuery, []interface{}{id}}}, nil
+	}},
+	"/records": {table: "records", queries: func(params url.Values) ([]explainedQuery, error) {
+		limit, offset, err := explainPage(params)
+		if err != nil {
+			return nil, err
+		}
+		query, args := listRecordsQuery(models.RecordFilter{
+			Type:          params.Get("type"),
+			ExcludePrefix: "_system/",
+			Limit:         limit,
+			Offset:        offset,
+		})
+		return []explainedQuery{{"ListRecords", query, args}}, nil
+	}},
+	"/tasks": {table: "inbox_tasks", queries: func(params url.Values) ([]explainedQuery, error) {
+		limit, offset, err := explainPage(params)
+		if err != nil {
+			return nil, err
+		}
+		query, args := listTasksQuery(models.TaskFilter{
+			Status:        params.Get("status"),
+			ExcludePrefix: "_system/",
+			Limit:         limit,
+			Offset:        offset,
+		})
+		return []explainedQuery{{"ListTasks", query, args}, {"GetTaskStats", taskStatsQuery, nil}}, nil
+	}},
+	"/stats": {table: "inbox_tasks", queries: func(params url.Values) ([]explainedQuery, error) {
+		return []explainedQuery{{"GetTaskStats", taskStatsQuery, nil}}, nil
+	}},
+}
+
+// ExplainedEndpoints returns the endpoints whose queries can be explained
+func ExplainedEndpoints() []string {
+	endpoints := make([]string, 0, len(explainedEndpoints))
+	for endpoint := range explainedEndpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// lookupExplainedEndpoint returns an explained endpoint, wrapping
+// models.ErrInvalidExplain for unknown ones
+func lookupExplainedEndpoint(endpoint string) (explainedEndpoint, error) {
+	explained, ok := explainedEndpoints[endpoint]
+	if !ok {
+		return explainedEndpoint{}, fmt.Errorf("%w: endpoint must be one of %s", models.ErrInvalidExplain,
+			strings.Join(ExplainedEndpoints(), ", "))
+	}
+	return explained, nil
+}
+
+// explainPage parses the limit and offset parameters, 50 and 0 by default
+func explainPage(params url.Values) (limit, offset int, err error) {
+	limit, offset = 50, 0
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > 100 {
+			return 0, 0, fmt.Errorf("%w: limit must be between 1 and 100", models.ErrInvalidExplain)
+		}
+	}
+	if v := params.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must not be negative", models.ErrInvalidExplain)
+		}
+	}
+	return limit, offset, nil
+}
+
+// ExplainQueries runs EXPLAIN, or EXPLAIN ANALYZE with analyze, for the
+// queries of an endpoint. Analyzed queries are executed, they are all reads
+func (r *PostgresRepository) ExplainQueries(ctx context.Context, endpoint string, params url.Values, analyze bool) (_ []*models.QueryPlan, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	explained, err := lookupExplainedEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	queries, err := explained.queries(params)
+	if err != nil {
+		return nil, err
+	}
+
+	explain := "EXPLAIN (FORMAT JSON) "
+	if analyze {
+		explain = "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "
+	}
+
+	plans := make([]*models.QueryPlan, 0, len(queries))
+	for _, q := range queries {
+		var output []byte
+		err := r.q.QueryRowContext(ctx, explain+q.query, q.args...).Scan(&output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to explain %s: %w", q.name, err)
+		}
+
+		var result []struct {
+			Plan      json.RawMessage `json:"Plan"`
+			Planning  float64         `json:"Planning Time"`
+			Execution float64         `json:"Execution Time"`
+		}
+		if err := json.Unmarshal(output, &result); err != nil || len(result) != 1 {
+			return nil, fmt.Errorf("unexpected plan of %s: %s", q.name, output)
+		}
+
+		args := q.args
+		if args == nil {
+			args = []interface{}{}
+		}
+		plans = append(plans, &models.QueryPlan{
+			Name:        q.name,
+			Query:       q.query,
+			Args:        args,
+			PlanningMs:  result[0].Planning,
+			ExecutionMs: result[0].Execution,
+			Plan:        result[0].Plan,
+		})
+	}
+	return plans, nil
+}
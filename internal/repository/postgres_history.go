@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"mit-service/internal/models"
+)
+
+// recordHistoryDDL creates the history table and the trigger function
+// appending to it. The trigger catches every write, including those of
+// retention, imports and transactions, with the version the write left
+var recordHistoryDDL = []string{
+	`CREATE TABLE IF NOT EXISTS records_history (
+			seq BIGSERIAL PRIMARY KEY,
+			id VARCHAR(255) NOT NULL,
+			version BIGINT NOT NULL,
+			operation VARCHAR(16) NOT NULL,
+			type VARCHAR(255),
+			value JSONB,
+			value_encoding VARCHAR(16),
+			value_proto BYTEA,
+			changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)`,
+	`CREATE INDEX IF NOT EXISTS idx_records_history_id ON records_history (id, seq)`,
+	`CREATE OR REPLACE FUNCTION records_history_append() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				INSERT INTO records_history (id, version, operation, type, value, value_encoding, value_proto)
+				VALUES (OLD.id, OLD.version, 'delete', OLD.type, OLD.value, OLD.value_encoding, OLD.value_proto);
+				RETURN OLD;
+			END IF;
+			INSERT INTO records_history (id, version, operation, type, value, value_encoding, value_proto)
+			VALUES (NEW.id, NEW.version, lower(TG_OP), NEW.type, NEW.value, NEW.value_encoding, NEW.value_proto);
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+}
+
+// The trigger filling records_history, created when record history is
+// enabled and dropped when it is not. Instances starting together may both
+// try to create it, the check only narrows the window
+const (
+	createRecordHistoryTrigger = `DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'records_history' AND tgrelid = 'records'::regclass) THEN
+				CREATE TRIGGER records_history AFTER INSERT OR UPDATE OR DELETE ON records
+					FOR EACH ROW EXECUTE FUNCTION records_history_append();
+			END IF;
+		END
+		$$`
+	dropRecordHistoryTrigger = `DROP TRIGGER IF EXISTS records_history ON records`
+)
+
+// historyColumns are the columns read by scanHistoryEntry
+const historyColumns = `id, version, operation, COALESCE(type, ''), value, COALESCE(value_encoding, ''), value_proto, changed_at`
+
+// RecordHistory returns the history entries of a record, oldest first
+func (r *PostgresRepository) RecordHistory(ctx context.Context, id string, limit, offset int) (_ []*models.RecordHistoryEntry, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT ` + historyColumns + `
+		  FROM records_history
+		 WHERE id = $1
+		 ORDER BY seq
+		 LIMIT $2 OFFSET $3`
+
+	rows, err := r.q.QueryContext(ctx, query, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query record history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.RecordHistoryEntry{}
+	for rows.Next() {
+		entry, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// RecordVersion returns the latest insert or update of a record that left
+// it at version
+func (r *PostgresRepository) RecordVersion(ctx context.Context, id string, version int64) (_ *models.RecordHistoryEntry, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT ` + historyColumns + `
+		  FROM records_history
+		 WHERE id = $1 AND version = $2 AND operation <> 'delete'
+		 ORDER BY seq DESC
+		 LIMIT 1`
+
+	entry, err := scanHistoryEntry(r.q.QueryRowContext(ctx, query, id, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("version %d of record '%s': %w", version, id, models.ErrVersionNotFound)
+		}
+		return nil, err
+	}
+	return entry, nil
+}
+
+// scanHistoryEntry scans a row of historyColumns, returning sql.ErrNoRows
+// unwrapped
+func scanHistoryEntry(scanner interface{ Scan(dest ...any) error }) (*models.RecordHistoryEntry, error) {
+	var entry models.RecordHistoryEntry
+	var valueJSON, proto []byte
+
+	err := scanner.Scan(&entry.ID, &entry.Version, &entry.Operation, &entry.Type, &valueJSON, &entry.Encoding, &proto, &entry.ChangedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan history entry: %w", err)
+	}
+
+	record := models.Record{Encoding: entry.Encoding}
+	decodeValue(&record, valueJSON, proto)
+	entry.Value = record.Value
+	return &entry, nil
+}
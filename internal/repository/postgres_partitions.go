@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// recordsTableDDL creates the plain, unpartitioned records table
+const recordsTableDDL = `CREATE TABLE IF NOT EXISTS records (
+			id VARCHAR(255) PRIMARY KEY,
+			type VARCHAR(255),
+			value JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`
+
+// initPartitionedRecords creates the records table hash-partitioned by id.
+// PostgreSQL routes every statement to the right partition on its own, so
+// the repository queries stay the same for both layouts. An existing table is
+// never converted: a plain table or a different partition count is only
+// reported, since repartitioning means rewriting every row
+func (r *PostgresRepository) initPartitionedRecords(ctx context.Context, partitions int) error {
+	var exists, partitioned bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT c.oid IS NOT NULL, p.partrelid IS NOT NULL
+		   FROM (SELECT to_regclass('records') AS oid) c
+		   LEFT JOIN pg_partitioned_table p ON p.partrelid = c.oid`).Scan(&exists, &partitioned)
+	if err != nil {
+		return fmt.Errorf("failed to inspect records table: %w", err)
+	}
+
+	if exists && !partitioned {
+		log.Printf("Records table already exists unpartitioned, ignoring %d configured partitions", partitions)
+		return nil
+	}
+
+	if !exists {
+		query := `CREATE TABLE IF NOT EXISTS records (
+			id VARCHAR(255) PRIMARY KEY,
+			type VARCHAR(255),
+			value JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		) PARTITION BY HASH (id)`
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create partitioned records table: %w", err)
+		}
+	}
+
+	var existing int
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'records'::regclass`).Scan(&existing)
+	if err != nil {
+		return fmt.Errorf("failed to count records partitions: %w", err)
+	}
+
+	if existing > 0 && existing != partitions {
+		log.Printf("Records table has %d partitions, ignoring %d configured partitions", existing, partitions)
+		return nil
+	}
+
+	for i := 0; i < partitions; i++ {
+		query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS records_p%d PARTITION OF records
+			FOR VALUES WITH (MODULUS %d, REMAINDER %d)`, i, partitions, i)
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create records partition %d: %w", i, err)
+		}
+	}
+
+	if !exists {
+		log.Printf("Created records table with %d hash partitions", partitions)
+	}
+
+	return nil
+}
+
+// inboxPartitionsAhead is how many days of future inbox partitions are kept
+// ready, so a missed cleanup run does not send new tasks to the default partition
+const inboxPartitionsAhead = 3
+
+// inboxPartitionPrefix names daily inbox partitions, followed by YYYYMMDD
+const inboxPartitionPrefix = "inbox_tasks_p"
+
+// inboxTaskIDsTable holds the IDs of the tasks of the partitioned inbox,
+// keeping them unique across the partitions, see claimTaskIDs
+const inboxTaskIDsTable = "inbox_task_ids"
+
+// initPartitionedInbox creates the inbox_tasks table range-partitioned by
+// created_at with one partition per day and a default partition catching
+// anything outside the prepared range. An existing plain table is kept as is
+func (r *PostgresRepository) initPartitionedInbox(ctx context.Context) error {
+	var exists, partitioned bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT c.oid IS NOT NULL, p.partrelid IS NOT NULL
+		   FROM (SELECT to_regclass('inbox_tasks') AS oid) c
+		   LEFT JOIN pg_partitioned_table p ON p.partrelid = c.oid`).Scan(&exists, &partitioned)
+	if err != nil {
+		return fmt.Errorf("failed to inspect inbox_tasks table: %w", err)
+	}
+
+	if exists && !partitioned {
+		log.Printf("Inbox table already exists unpartitioned, cleanup will keep using DELETE")
+		return nil
+	}
+
+	if !exists {
+		// The partition key has to be part of the primary key
+		queries := []string{
+			`CREATE TABLE IF NOT EXISTS inbox_tasks (
+				id VARCHAR(255) NOT NULL,
+				operation VARCHAR(50) NOT NULL,
+				payload JSONB NOT NULL,
+				status VARCHAR(50) NOT NULL DEFAULT 'pending',
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+				retries INTEGER DEFAULT 0,
+				error TEXT,
+				tenant_id VARCHAR(255) NOT NULL DEFAULT '',
+				trace JSONB,
+				result JSONB,
+				PRIMARY KEY (id, created_at)
+			) PARTITION BY RANGE (created_at)`,
+			`CREATE TABLE IF NOT EXISTS inbox_tasks_default PARTITION OF inbox_tasks DEFAULT`,
+		}
+		for _, query := range queries {
+			if _, err := r.db.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("failed to create partitioned inbox table: %w", err)
+			}
+		}
+		log.Printf("Created inbox table partitioned by day")
+	}
+
+	r.inboxPartitioned = true
+
+	if err := r.initInboxTaskIDs(ctx); err != nil {
+		return err
+	}
+	return r.ensureInboxPartitions(ctx, time.Now())
+}
+
+// initInboxTaskIDs creates the inbox_task_ids table, claiming the IDs of the
+// tasks already queued when it is new
+func (r *PostgresRepository) initInboxTaskIDs(ctx context.Context) error {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, inboxTaskIDsTable).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", inboxTaskIDsTable, err)
+	}
+	if exists {
+		return nil
+	}
+
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS ` + inboxTaskIDsTable + ` (id VARCHAR(255) PRIMARY KEY)`,
+		`INSERT INTO ` + inboxTaskIDsTable + ` (id) SELECT id FROM inbox_tasks ON CONFLICT DO NOTHING`,
+	}
+	for _, query := range queries {
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create %s table: %w", inboxTaskIDsTable, err)
+		}
+	}
+	return nil
+}
+
+// ensureInboxPartitions creates the daily partitions from the day of now up to
+// inboxPartitionsAhead days later
+func (r *PostgresRepository) ensureInboxPartitions(ctx context.Context, now time.Time) error {
+	day := now.UTC().Truncate(24 * time.Hour)
+
+	for i := 0; i <= inboxPartitionsAhead; i++ {
+		from := day.AddDate(0, 0, i)
+		if err := r.createInboxPartition(ctx, from, from.AddDate(0, 0, 1)); err != nil {
+			return fmt.Errorf("failed to create inbox partition for %s: %w", from.Format("2006-01-02"), err)
+		}
+	}
+
+	return nil
+}
+
+// createInboxPartition creates the partition of the tasks created from from
+// until to. PostgreSQL refuses a partition for a range the default partition
+// holds rows of, which happens once the partition was missing on that day, so
+// the partition is created detached, those rows are moved into it and then it
+// is attached, all in one transaction
+func (r *PostgresRepository) createInboxPartition(ctx context.Context, from, to time.Time) error {
+	name := inboxPartitionPrefix + from.Format("20060102")
+
+	var exists bool
+	if err := r.q.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	return r.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+		tx := repo.(*PostgresRepository)
+
+		// Holds off new tasks in the default partition and other instances
+		// creating the same partition until the commit
+		if _, err := tx.q.ExecContext(ctx, `LOCK TABLE inbox_tasks_default IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+		if err := tx.q.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+
+		table := pq.QuoteIdentifier(name)
+		if _, err := tx.q.ExecContext(ctx, `CREATE TABLE `+table+` (LIKE inbox_tasks INCLUDING DEFAULTS)`); err != nil {
+			return err
+		}
+		result, err := tx.q.ExecContext(ctx, `WITH moved AS (
+				DELETE FROM inbox_tasks_default WHERE created_at >= $1 AND created_at < $2 RETURNING *
+			)
+			INSERT INTO `+table+` SELECT * FROM moved`, from, to)
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf(`ALTER TABLE inbox_tasks ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`,
+			table, from.Format(time.RFC3339), to.Format(time.RFC3339))
+		if _, err := tx.q.ExecContext(ctx, query); err != nil {
+			return err
+		}
+
+		if moved, _ := result.RowsAffected(); moved > 0 {
+			log.Printf("Moved %d tasks from the default inbox partition into %s", moved, name)
+		}
+		return nil
+	})
+}
+
+// dropInboxPartitions drops daily partitions that ended before cutoff and only
+// hold completed or failed tasks last updated before cutoff, which is exactly
+// what the cleanup DELETE would have removed from them
+func (r *PostgresRepository) dropInboxPartitions(ctx context.Context, cutoff time.Time) error {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT c.relname
+		   FROM pg_inherits i
+		   JOIN pg_class c ON c.oid = i.inhrelid
+		  WHERE i.inhparent = 'inbox_tasks'::regclass
+		    AND c.relname LIKE $1
+		  ORDER BY c.relname`, inboxPartitionPrefix+"%")
+	if err != nil {
+		return fmt.Errorf("failed to list inbox partitions: %w", err)
+	}
+
+	var candidates []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan inbox partition: %w", err)
+		}
+
+		day, err := time.Parse("20060102", strings.TrimPrefix(name, inboxPartitionPrefix))
+		if err != nil {
+			continue // not one of ours
+		}
+		if !day.AddDate(0, 0, 1).After(cutoff) {
+			candidates = append(candidates, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating inbox partitions: %w", err)
+	}
+
+	for _, name := range candidates {
+		var dropped bool
+		// The partition is locked before it is inspected, so a task retried
+		// or requeued meanwhile keeps it alive. The IDs of the tasks are
+		// released with the partition
+		err := r.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+			tx := repo.(*PostgresRepository)
+			table := pq.QuoteIdentifier(name)
+
+			var exists bool
+			if err := tx.q.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil || !exists {
+				return err
+			}
+			if _, err := tx.q.ExecContext(ctx, `LOCK TABLE `+table+` IN ACCESS EXCLUSIVE MODE`); err != nil {
+				return err
+			}
+
+			var live bool
+			query := fmt.Sprintf(`SELECT EXISTS (
+				SELECT 1 FROM %s WHERE status NOT IN ($1, $2) OR updated_at >= $3
+			)`, table)
+			err := tx.q.QueryRowContext(ctx, query,
+				models.TaskStatusCompleted, models.TaskStatusFailed, cutoff).Scan(&live)
+			if err != nil || live {
+				return err
+			}
+
+			query = fmt.Sprintf(`DELETE FROM %s WHERE id IN (SELECT id FROM %s)`, inboxTaskIDsTable, table)
+			if _, err := tx.q.ExecContext(ctx, query); err != nil {
+				return err
+			}
+			if _, err := tx.q.ExecContext(ctx, "DROP TABLE "+table); err != nil {
+				return err
+			}
+			dropped = true
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to drop inbox partition %s: %w", name, err)
+		}
+		if dropped {
+			log.Printf("Dropped inbox partition %s", name)
+		}
+	}
+
+	return nil
+}
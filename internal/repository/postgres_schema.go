@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"mit-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// SchemaChecker compares the live schema of tables with the one the service
+// expects
+type SchemaChecker interface {
+	// CheckSchema returns the differences of the named tables, none when
+	// they match
+	CheckSchema(ctx context.Context, tables ...string) ([]*models.SchemaDrift, error)
+}
+
+// SchemaMigrationVersion is the latest migration in migrations/. Databases
+// migrated with migrate, which keeps its version in schema_migrations, must
+// be at this version; schemas created by the service itself are not
+// versioned
+const SchemaMigrationVersion = 1
+
+// expectedColumn is a column as initSchema creates it
+type expectedColumn struct {
+	name     string
+	dataType string // as reported by information_schema.columns
+}
+
+// expectedColumns are the columns of each table. Columns added out of band
+// are not drift, the service ignores them
+var expectedColumns = map[string][]expectedColumn{
+	"records": {
+		{"id", "character varying"},
+		{"type", "character varying"},
+		{"value", "jsonb"},
+		{"created_at", "timestamp with time zone"},
+		{"updated_at", "timestamp with time zone"},
+		{"value_hash", "character"},
+		{"value_encoding", "character varying"},
+		{"value_proto", "bytea"},
+		{"version", "bigint"},
+	},
+	"inbox_tasks": {
+		{"id", "character varying"},
+		{"operation", "character varying"},
+		{"payload", "jsonb"},
+		{"status", "character varying"},
+		{"created_at", "timestamp with time zone"},
+		{"updated_at", "timestamp with time zone"},
+		{"retries", "integer"},
+		{"error", "text"},
+		{"tenant_id", "character varying"},
+		{"trace", "jsonb"},
+		{"result", "jsonb"},
+	},
+}
+
+// CheckSchema compares the columns of the named tables with the expected
+// ones and, when the database is migrated with migrate, its migration
+// version with SchemaMigrationVersion
+func (r *PostgresRepository) CheckSchema(ctx context.Context, tables ...string) (_ []*models.SchemaDrift, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT table_name, column_name, data_type
+		  FROM information_schema.columns
+		 WHERE table_schema = current_schema() AND table_name = ANY($1)`
+	rows, err := r.q.QueryContext(ctx, query, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query columns: %w", err)
+	}
+	defer rows.Close()
+
+	live := make(map[string]map[string]string)
+	for rows.Next() {
+		var table, column, dataType string
+		if err := rows.Scan(&table, &column, &dataType); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		if live[table] == nil {
+			live[table] = make(map[string]string)
+		}
+		live[table][column] = dataType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	drift := compareColumns(tables, live)
+
+	migration, err := r.checkMigration(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if migration != nil {
+		drift = append(drift, migration)
+	}
+	return drift, nil
+}
+
+// compareColumns reports the expected tables and columns missing from live,
+// which holds the column types of each table, and columns of another type
+func compareColumns(tables []string, live map[string]map[string]string) []*models.SchemaDrift {
+	var drift []*models.SchemaDrift
+	for _, table := range tables {
+		columns, ok := live[table]
+		if !ok {
+			drift = append(drift, &models.SchemaDrift{Table: table, Issue: "table is missing"})
+			continue
+		}
+		for _, expected := range expectedColumns[table] {
+			dataType, ok := columns[expected.name]
+			switch {
+			case !ok:
+				drift = append(drift, &models.SchemaDrift{Table: table, Column: expected.name, Issue: "column is missing"})
+			case dataType != expected.dataType:
+				drift = append(drift, &models.SchemaDrift{Table: table, Column: expected.name,
+					Issue: fmt.Sprintf("type is %s, expected %s", dataType, expected.dataType)})
+			}
+		}
+	}
+	return drift
+}
+
+// checkMigration reports a database migrated with migrate that is not at
+// SchemaMigrationVersion or whose last migration failed halfway
+func (r *PostgresRepository) checkMigration(ctx context.Context) (*models.SchemaDrift, error) {
+	var managed bool
+	err := r.q.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&managed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	if !managed {
+		return nil, nil
+	}
+
+	var version int64
+	var dirty bool
+	err = r.q.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration version: %w", err)
+	}
+
+	switch {
+	case dirty:
+		return &models.SchemaDrift{Table: "schema_migrations",
+			Issue: fmt.Sprintf("migration %d is dirty, it failed halfway", version)}, nil
+	case version != SchemaMigrationVersion:
+		return &models.SchemaDrift{Table: "schema_migrations",
+			Issue: fmt.Sprintf("at migration %d, expected %d", version, SchemaMigrationVersion)}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+// stubSchemaChecker reports the same drift for every check
+type stubSchemaChecker struct {
+	drift []*models.SchemaDrift
+}
+
+func (c *stubSchemaChecker) CheckSchema(ctx context.Context, tables ...string) ([]*models.SchemaDrift, error) {
+	return c.drift, nil
+}
+
+func TestCompareColumns(t *testing.T) {
+	records := make(map[string]string)
+	for _, column := range expectedColumns["records"] {
+		records[column.name] = column.dataType
+	}
+	records["extra"] = "text"
+
+	if drift := compareColumns([]string{"records"}, map[string]map[string]string{"records": records}); len(drift) != 0 {
+		t.Fatalf("Expected no drift for the expected columns, got %+v", drift[0])
+	}
+
+	delete(records, "version")
+	records["value"] = "json"
+	drift := compareColumns([]string{"records", "inbox_tasks"}, map[string]map[string]string{"records": records})
+
+	expected := []models.SchemaDrift{
+		{Table: "records", Column: "value", Issue: "type is json, expected jsonb"},
+		{Table: "records", Column: "version", Issue: "column is missing"},
+		{Table: "inbox_tasks", Issue: "table is missing"},
+	}
+	if len(drift) != len(expected) {
+		t.Fatalf("Expected %d differences, got %d", len(expected), len(drift))
+	}
+	for i := range expected {
+		if *drift[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], *drift[i])
+		}
+	}
+}
+
+func TestCheckSchema_Manager(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := (&RepositoryManager{}).CheckSchema(ctx); !errors.Is(err, models.ErrSchemaCheckUnsupported) {
+		t.Fatalf("Expected ErrSchemaCheckUnsupported, got %v", err)
+	}
+
+	m := &RepositoryManager{schemas: []schemaSource{
+		{checker: &stubSchemaChecker{}, tables: []string{"records"}},
+		{checker: &stubSchemaChecker{drift: []*models.SchemaDrift{{Table: "inbox_tasks", Issue: "table is missing"}}}, tables: []string{"inbox_tasks"}},
+	}}
+	report, err := m.CheckSchema(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.InSync || len(report.Drift) != 1 || report.ExpectedMigrationVersion != SchemaMigrationVersion {
+		t.Errorf("Expected the inbox drift, got %+v", report)
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"mit-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// TableStats returns size and dead-tuple estimates for the given tables. The
+// figures of partitioned tables are summed over their partitions; dead tuples
+// come from the statistics collector and are estimates
+func (r *PostgresRepository) TableStats(ctx context.Context, tables ...string) (_ []*models.TableStats, err error) {
+	ctx, finish := r.withDeadline(ctx, r.readTimeout)
+	defer finish(&err)
+
+	query := `SELECT t.name,
+			SUM(pg_total_relation_size(p.relid)),
+			SUM(pg_relation_size(p.relid)),
+			SUM(pg_indexes_size(p.relid)),
+			SUM(COALESCE(s.n_live_tup, 0)),
+			SUM(COALESCE(s.n_dead_tup, 0)),
+			MAX(s.last_vacuum),
+			MAX(s.last_autovacuum)
+		  FROM unnest($1::text[]) AS t(name)
+		  CROSS JOIN LATERAL pg_partition_tree(to_regclass(t.name)) p
+		  LEFT JOIN pg_stat_user_tables s ON s.relid = p.relid::oid
+		 WHERE p.isleaf
+		 GROUP BY t.name
+		 ORDER BY t.name`
+
+	rows, err := r.q.QueryContext(ctx, query, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*models.TableStats
+	for rows.Next() {
+		var s models.TableStats
+		var lastVacuum, lastAutovacuum sql.NullTime
+		err := rows.Scan(&s.Table, &s.TotalBytes, &s.TableBytes, &s.IndexBytes,
+			&s.LiveTuples, &s.DeadTuples, &lastVacuum, &lastAutovacuum)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table stats: %w", err)
+		}
+
+		if total := s.LiveTuples + s.DeadTuples; total > 0 {
+			s.DeadTupleRatio = float64(s.DeadTuples) / float64(total)
+		}
+		if lastVacuum.Valid {
+			s.LastVacuum = &lastVacuum.Time
+		}
+		if lastAutovacuum.Valid {
+			s.LastAutovacuum = &lastAutovacuum.Time
+		}
+		stats = append(stats, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return stats, nil
+}
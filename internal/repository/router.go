@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// RecordRouter is a RecordRepository passing every call to its current
+// target. Route moves the calls to another repository while requests run,
+// e.g. to promote a shadow backend to primary
+type RecordRouter struct {
+	mu     sync.RWMutex
+	target RecordRepository
+	origin RecordRepository
+}
+
+// NewRecordRouter creates a router passing calls to target
+func NewRecordRouter(target RecordRepository) *RecordRouter {
+	return &RecordRouter{target: target, origin: target}
+}
+
+// RouteRecords puts a router in front of the manager's records and returns
+// it. Transactions spanning records and inbox run without a transaction once
+// the records are routed away from the inbox database
+func RouteRecords(m *RepositoryManager) *RecordRouter {
+	router := NewRecordRouter(m.Record)
+
+	m.shared = m.shared || any(m.Record) == any(m.Inbox)
+	m.Record = router
+	if m.Tx != nil {
+		m.Tx = &routedTransactor{next: m.Tx, router: router, inbox: m.Inbox}
+	}
+	return router
+}
+
+// Target returns the repository calls currently go to
+func (r *RecordRouter) Target() RecordRepository {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.target
+}
+
+// Route sends the following calls to target and returns the previous one.
+// Calls running meanwhile may still reach the previous target
+func (r *RecordRouter) Route(target RecordRepository) RecordRepository {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.target
+	r.target = target
+	return previous
+}
+
+// Rerouted reports whether calls go elsewhere than when the router was created
+func (r *RecordRouter) Rerouted() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return any(r.target) != any(r.origin)
+}
+
+// Insert creates a new record
+func (r *RecordRouter) Insert(ctx context.Context, record *models.Record) error {
+	return r.Target().Insert(ctx, record)
+}
+
+// Update modifies an existing record
+func (r *RecordRouter) Update(ctx context.Context, record *models.Record) error {
+	return r.Target().Update(ctx, record)
+}
+
+// Delete removes a record by ID
+func (r *RecordRouter) Delete(ctx context.Context, id string) error {
+	return r.Target().Delete(ctx, id)
+}
+
+// UpdateIfVersion modifies a record that still has the expected version
+func (r *RecordRouter) UpdateIfVersion(ctx context.Context, record *models.Record, expected int64) error {
+	return r.Target().UpdateIfVersion(ctx, record, expected)
+}
+
+// DeleteIfVersion removes a record that still has the expected version
+func (r *RecordRouter) DeleteIfVersion(ctx context.Context, id string, expected int64) error {
+	return r.Target().DeleteIfVersion(ctx, id, expected)
+}
+
+// Get retrieves a record by ID
+func (r *RecordRouter) Get(ctx context.Context, id string) (*models.Record, error) {
+	return r.Target().Get(ctx, id)
+}
+
+// ListRecords retrieves records matching filter ordered by ID
+func (r *RecordRouter) ListRecords(ctx context.Context, filter models.RecordFilter) ([]*models.Record, error) {
+	return r.Target().ListRecords(ctx, filter)
+}
+
+// CountExpiredRecords counts expired records with the prefix
+func (r *RecordRouter) CountExpiredRecords(ctx context.Context, prefix string, cutoff time.Time) (int, error) {
+	return r.Target().CountExpiredRecords(ctx, prefix, cutoff)
+}
+
+// Close closes the repository the router was created with. Repositories
+// routed to later are closed by whoever opened them
+func (r *RecordRouter) Close() error {
+	return r.origin.Close()
+}
+
+// routedTransactor runs transactions only while the records are still in
+// the database of the transactor
+type routedTransactor struct {
+	next   Transactor
+	router *RecordRouter
+	inbox  InboxRepository
+}
+
+// WithinTransaction runs fn in a transaction, or directly once the records
+// are routed elsewhere
+func (t *routedTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	if !t.router.Rerouted() {
+		return t.next.WithinTransaction(ctx, fn)
+	}
+	return fn(ctx, &splitRepository{RecordRepository: t.router, InboxRepository: t.inbox})
+}
+
+// splitRepository combines records and inbox living in different databases
+type splitRepository struct {
+	RecordRepository
+	InboxRepository
+}
+
+// Close is never called on a transaction-scoped repository
+func (r *splitRepository) Close() error {
+	return nil
+}
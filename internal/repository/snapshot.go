@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// snapshotVersion is bumped whenever the snapshot format changes
+const snapshotVersion = 1
+
+// snapshotExt is the file extension of snapshots on disk
+const snapshotExt = ".json"
+
+// snapshotNamePattern keeps snapshot names safe to use as file names
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// mockSnapshot is the on-disk format of a mock repository snapshot
+type mockSnapshot struct {
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"created_at"`
+	Records   []*models.Record    `json:"records"`
+	Tasks     []*models.InboxTask `json:"tasks"`
+}
+
+// SaveSnapshot writes the full repository state to w. It waits for running
+// transactions, so the snapshot never contains half-applied tasks
+func (r *MockRepository) SaveSnapshot(w io.Writer) (*models.SnapshotInfo, error) {
+	r.txMu.Lock()
+	records := r.GetAllRecords()
+	tasks := r.GetAllTasksForTesting()
+	r.txMu.Unlock()
+
+	snapshot := mockSnapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Records:   make([]*models.Record, 0, len(records)),
+		Tasks:     make([]*models.InboxTask, 0, len(tasks)),
+	}
+	for _, record := range records {
+		snapshot.Records = append(snapshot.Records, record)
+	}
+	for _, task := range tasks {
+		snapshot.Tasks = append(snapshot.Tasks, task)
+	}
+
+	// Stable order keeps snapshots diffable
+	sort.Slice(snapshot.Records, func(i, j int) bool { return snapshot.Records[i].ID < snapshot.Records[j].ID })
+	sort.Slice(snapshot.Tasks, func(i, j int) bool { return snapshot.Tasks[i].CreatedAt.Before(snapshot.Tasks[j].CreatedAt) })
+
+	if err := json.NewEncoder(w).Encode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	return &models.SnapshotInfo{
+		CreatedAt: snapshot.CreatedAt,
+		Records:   len(snapshot.Records),
+		Tasks:     len(snapshot.Tasks),
+	}, nil
+}
+
+// LoadSnapshot replaces the repository state with a snapshot read from rd.
+// Tasks that were being processed when the snapshot was taken are reset to
+// pending, since no worker owns them anymore
+func (r *MockRepository) LoadSnapshot(rd io.Reader) (*models.SnapshotInfo, error) {
+	var snapshot mockSnapshot
+	if err := json.NewDecoder(rd).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	// Write times are not part of the snapshot, retention counts from the restore
+	now := time.Now()
+	records := make(map[string]*models.Record, len(snapshot.Records))
+	writtenAt := make(map[string]time.Time, len(snapshot.Records))
+	for _, record := range snapshot.Records {
+		records[record.ID] = record
+		writtenAt[record.ID] = now
+	}
+
+	tasks := make(map[string]*models.InboxTask, len(snapshot.Tasks))
+	for _, task := range snapshot.Tasks {
+		if task.Status == models.TaskStatusProcessing {
+			task.Status = models.TaskStatusPending
+		}
+		tasks[task.ID] = task
+	}
+
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+
+	// History and access counts are not part of the snapshot either, those
+	// of the replaced records would describe records it does not contain
+	r.recordsMu.Lock()
+	r.records = records
+	r.writtenAt = writtenAt
+	r.history = make(map[string][]*models.RecordHistoryEntry)
+	r.recordsMu.Unlock()
+
+	r.statsMu.Lock()
+	r.accessStats = make(map[string]*models.RecordAccessStats)
+	r.statsMu.Unlock()
+
+	r.tasksMu.Lock()
+	r.inboxTasks = tasks
+	r.tasksMu.Unlock()
+
+	return &models.SnapshotInfo{
+		CreatedAt: snapshot.CreatedAt,
+		Records:   len(records),
+		Tasks:     len(tasks),
+	}, nil
+}
+
+// SnapshotStore saves and restores named snapshots of a mock repository in a
+// directory, one file per snapshot
+type SnapshotStore struct {
+	dir  string
+	repo *MockRepository
+}
+
+// NewSnapshotStore creates a snapshot store in dir, creating it if needed
+func NewSnapshotStore(dir string, repo *MockRepository) (*SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	return &SnapshotStore{dir: dir, repo: repo}, nil
+}
+
+// Save writes the current repository state as the named snapshot, replacing
+// an existing snapshot of the same name atomically
+func (s *SnapshotStore) Save(ctx context.Context, name string) (*models.SnapshotInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	info, err := s.repo.SaveSnapshot(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write snapshot '%s': %w", name, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot '%s': %w", name, err)
+	}
+
+	if stat, err := os.Stat(path); err == nil {
+		info.SizeBytes = stat.Size()
+	}
+	info.Name = name
+
+	return info, nil
+}
+
+// Load replaces the repository state with the named snapshot. A missing
+// snapshot yields an error wrapping fs.ErrNotExist
+func (s *SnapshotStore) Load(ctx context.Context, name string) (*models.SnapshotInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("snapshot '%s' not found: %w", name, err)
+		}
+		return nil, fmt.Errorf("failed to open snapshot '%s': %w", name, err)
+	}
+	defer f.Close()
+
+	info, err := s.repo.LoadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot '%s': %w", name, err)
+	}
+
+	if stat, err := f.Stat(); err == nil {
+		info.SizeBytes = stat.Size()
+	}
+	info.Name = name
+
+	return info, nil
+}
+
+// List returns the saved snapshots, newest first
+func (s *SnapshotStore) List(ctx context.Context) ([]*models.SnapshotInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	snapshots := []*models.SnapshotInfo{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), snapshotExt)
+		if entry.IsDir() || !ok || !snapshotNamePattern.MatchString(name) {
+			continue
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			continue // removed while listing
+		}
+
+		snapshots = append(snapshots, &models.SnapshotInfo{
+			Name:      name,
+			SizeBytes: stat.Size(),
+			CreatedAt: stat.ModTime().UTC(),
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt) })
+
+	return snapshots, nil
+}
+
+// path returns the file of the named snapshot
+func (s *SnapshotStore) path(name string) (string, error) {
+	if !snapshotNamePattern.MatchString(name) {
+		return "", fmt.Errorf("%w: %q", models.ErrInvalidSnapshotName, name)
+	}
+	return filepath.Join(s.dir, name+snapshotExt), nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+func TestMockRepository_LoadSnapshot(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockRepository()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: json.RawMessage(`{"n": 1}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := mock.SaveSnapshot(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Writes and reads after the snapshot are forgotten by its restore
+	if err := mock.Update(ctx, &models.Record{ID: "user_1", Value: json.RawMessage(`{"n": 2}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.Insert(ctx, &models.Record{ID: "user_2", Value: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.RecordAccess(ctx, []*models.RecordAccessStats{{ID: "user_2", Reads: 3}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info, err := mock.LoadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Records != 1 {
+		t.Errorf("Expected 1 record restored, got %d", info.Records)
+	}
+
+	if history, _ := mock.RecordHistory(ctx, "user_1", 10, 0); len(history) != 0 {
+		t.Errorf("Expected the history of user_1 reset, got %d entries", len(history))
+	}
+	if history, _ := mock.RecordHistory(ctx, "user_2", 10, 0); len(history) != 0 {
+		t.Errorf("Expected no history for user_2, got %d entries", len(history))
+	}
+	if stats, _ := mock.HottestRecords(ctx, 10, ""); len(stats) != 0 {
+		t.Errorf("Expected the access stats reset, got %d records", len(stats))
+	}
+}
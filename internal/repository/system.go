@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// SystemRecordPrefix is the ID prefix reserved for system records: the
+// records the service keeps in-band, such as record types, reservations
+// and the records of sandboxes, tenants and collections
+const SystemRecordPrefix = "_system/"
+
+// IsSystemID reports whether id is the ID of a system record
+func IsSystemID(id string) bool {
+	return strings.HasPrefix(id, SystemRecordPrefix)
+}
+
+// recordScopeKey is the context key of the record scope of a request
+type recordScopeKey struct{}
+
+// recordScope is the record scope of a context, nil for system access
+type recordScope struct {
+	prefix string
+}
+
+// WithRecordScope confines the record accesses with ctx to the records an
+// API client may name under prefix: IDs starting with prefix that are not
+// system IDs past it. The guarded repositories reject other accesses with
+// models.ErrSystemRecord. Contexts without a scope reach every record
+func WithRecordScope(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, recordScopeKey{}, &recordScope{prefix: prefix})
+}
+
+// WithSystemAccess lifts the record scope of ctx, for the accesses of the
+// service to system records on behalf of a request
+func WithSystemAccess(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(recordScopeKey{}).(*recordScope); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, recordScopeKey{}, (*recordScope)(nil))
+}
+
+// CheckRecordID fails with models.ErrSystemRecord when the record scope of
+// ctx does not include the record id
+func CheckRecordID(ctx context.Context, id string) error {
+	scope, _ := ctx.Value(recordScopeKey{}).(*recordScope)
+	if scope == nil {
+		return nil
+	}
+	rest, ok := strings.CutPrefix(id, scope.prefix)
+	if !ok || IsSystemID(rest) {
+		return fmt.Errorf("%w: '%s'", models.ErrSystemRecord, strings.TrimPrefix(id, scope.prefix))
+	}
+	return nil
+}
+
+// Guard wraps the manager's repositories so accesses with a record scope
+// cannot reach records outside it, see WithRecordScope. Record writes are
+// checked when their task is queued, the worker applying them unscoped
+func Guard(m *RepositoryManager) *RepositoryManager {
+	guarded := *m
+	if m.Record != nil {
+		guarded.Record = &guardedRecordRepository{RecordRepository: m.Record}
+	}
+	if m.Inbox != nil {
+		guarded.Inbox = &guardedInboxRepository{InboxRepository: m.Inbox}
+	}
+	if m.Tx != nil {
+		guarded.Tx = &guardedTransactor{next: m.Tx}
+	}
+	if m.History != nil {
+		guarded.History = &guardedHistoryStore{next: m.History}
+	}
+	guarded.shared = m.shared || any(m.Record) == any(m.Inbox)
+	return &guarded
+}
+
+// guardedRecordRepository checks the record scope of record accesses
+type guardedRecordRepository struct {
+	RecordRepository
+}
+
+// Insert creates a record within the scope of ctx
+func (r *guardedRecordRepository) Insert(ctx context.Context, record *models.Record) error {
+	if err := CheckRecordID(ctx, record.ID); err != nil {
+		return err
+	}
+	return r.RecordRepository.Insert(ctx, record)
+}
+
+// Update modifies a record within the scope of ctx
+func (r *guardedRecordRepository) Update(ctx context.Context, record *models.Record) error {
+	if err := CheckRecordID(ctx, record.ID); err != nil {
+		return err
+	}
+	return r.RecordRepository.Update(ctx, record)
+}
+
+// Delete removes a record within the scope of ctx
+func (r *guardedRecordRepository) Delete(ctx context.Context, id string) error {
+	if err := CheckRecordID(ctx, id); err != nil {
+		return err
+	}
+	return r.RecordRepository.Delete(ctx, id)
+}
+
+// UpdateIfVersion modifies a record within the scope of ctx
+func (r *guardedRecordRepository) UpdateIfVersion(ctx context.Context, record *models.Record, expected int64) error {
+	if err := CheckRecordID(ctx, record.ID); err != nil {
+		return err
+	}
+	return r.RecordRepository.UpdateIfVersion(ctx, record, expected)
+}
+
+// DeleteIfVersion removes a record within the scope of ctx
+func (r *guardedRecordRepository) DeleteIfVersion(ctx context.Context, id string, expected int64) error {
+	if err := CheckRecordID(ctx, id); err != nil {
+		return err
+	}
+	return r.RecordRepository.DeleteIfVersion(ctx, id, expected)
+}
+
+// Get retrieves a record within the scope of ctx
+func (r *guardedRecordRepository) Get(ctx context.Context, id string) (*models.Record, error) {
+	if err := CheckRecordID(ctx, id); err != nil {
+		return nil, err
+	}
+	return r.RecordRepository.Get(ctx, id)
+}
+
+// ListRecords lists records within the scope of ctx, leaving out the
+// system records below it
+func (r *guardedRecordRepository) ListRecords(ctx context.Context, filter models.RecordFilter) ([]*models.Record, error) {
+	if err := CheckRecordID(ctx, filter.Prefix); err != nil {
+		return nil, err
+	}
+	if scope, _ := ctx.Value(recordScopeKey{}).(*recordScope); scope != nil {
+		filter.ExcludePrefix = scope.prefix + SystemRecordPrefix
+	}
+	return r.RecordRepository.ListRecords(ctx, filter)
+}
+
+// CountExpiredRecords counts records within the scope of ctx
+func (r *guardedRecordRepository) CountExpiredRecords(ctx context.Context, prefix string, cutoff time.Time) (int, error) {
+	if err := CheckRecordID(ctx, prefix); err != nil {
+		return 0, err
+	}
+	return r.RecordRepository.CountExpiredRecords(ctx, prefix, cutoff)
+}
+
+// guardedInboxRepository checks the record scope of the record writes it
+// queues
+type guardedInboxRepository struct {
+	InboxRepository
+}
+
+// CreateTask queues a task, a record write only within the scope of ctx
+func (r *guardedInboxRepository) CreateTask(ctx context.Context, task *models.InboxTask) error {
+	if err := checkTask(ctx, task); err != nil {
+		return err
+	}
+	return r.InboxRepository.CreateTask(ctx, task)
+}
+
+// CreateTasks queues tasks, record writes only within the scope of ctx
+func (r *guardedInboxRepository) CreateTasks(ctx context.Context, tasks []*models.InboxTask) error {
+	for _, task := range tasks {
+		if err := checkTask(ctx, task); err != nil {
+			return err
+		}
+	}
+	return r.InboxRepository.CreateTasks(ctx, tasks)
+}
+
+// GetOpenTasksForRecord retrieves the open tasks of a record within the
+// scope of ctx
+func (r *guardedInboxRepository) GetOpenTasksForRecord(ctx context.Context, recordID string, limit int) ([]*models.InboxTask, error) {
+	if err := CheckRecordID(ctx, recordID); err != nil {
+		return nil, err
+	}
+	return r.InboxRepository.GetOpenTasksForRecord(ctx, recordID, limit)
+}
+
+// checkTask checks the record written by an insert, update or delete task
+func checkTask(ctx context.Context, task *models.InboxTask) error {
+	switch task.Operation {
+	case models.TaskOperationInsert, models.TaskOperationUpdate, models.TaskOperationDelete:
+	default:
+		return nil
+	}
+
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid %s task payload: %w", task.Operation, err)
+	}
+	return CheckRecordID(ctx, payload.ID)
+}
+
+// guardedTransactor guards the transaction-scoped repository passed to
+// callers
+type guardedTransactor struct {
+	next Transactor
+}
+
+// WithinTransaction runs fn within a transaction
+func (t *guardedTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context, repo Repository) error) error {
+	return t.next.WithinTransaction(ctx, func(ctx context.Context, repo Repository) error {
+		return fn(ctx, &guardedRepository{
+			guardedRecordRepository: &guardedRecordRepository{RecordRepository: repo},
+			guardedInboxRepository:  &guardedInboxRepository{InboxRepository: repo},
+		})
+	})
+}
+
+// guardedRepository is a guarded transaction-scoped Repository
+type guardedRepository struct {
+	*guardedRecordRepository
+	*guardedInboxRepository
+}
+
+// Close closes the underlying repository
+func (r *guardedRepository) Close() error {
+	return r.guardedRecordRepository.Close()
+}
+
+// guardedHistoryStore checks the record scope of history reads
+type guardedHistoryStore struct {
+	next HistoryStore
+}
+
+// RecordHistory returns the history of a record within the scope of ctx
+func (h *guardedHistoryStore) RecordHistory(ctx context.Context, id string, limit, offset int) ([]*models.RecordHistoryEntry, error) {
+	if err := CheckRecordID(ctx, id); err != nil {
+		return nil, err
+	}
+	return h.next.RecordHistory(ctx, id, limit, offset)
+}
+
+// RecordVersion returns a version of a record within the scope of ctx
+func (h *guardedHistoryStore) RecordVersion(ctx context.Context, id string, version int64) (*models.RecordHistoryEntry, error) {
+	if err := CheckRecordID(ctx, id); err != nil {
+		return nil, err
+	}
+	return h.next.RecordVersion(ctx, id, version)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+func TestGuard_RecordScope(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockRepository()
+	m := Guard(&RepositoryManager{Record: mock, Inbox: mock})
+
+	for _, id := range []string{"user_1", "_system/flags", "_system/sandbox/acme/user_1", "_system/sandbox/acme/_system/reservations/user_1"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		prefix  string
+		id      string
+		allowed bool
+	}{
+		{"flat record", "", "user_1", true},
+		{"system record", "", "_system/flags", false},
+		{"sandbox record", "_system/sandbox/acme/", "_system/sandbox/acme/user_1", true},
+		{"system record of the sandbox", "_system/sandbox/acme/", "_system/sandbox/acme/_system/reservations/user_1", false},
+		{"record outside the sandbox", "_system/sandbox/acme/", "user_1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoped := WithRecordScope(ctx, tt.prefix)
+			_, err := m.Record.Get(scoped, tt.id)
+			if tt.allowed && err != nil {
+				t.Errorf("Expected %s readable, got %v", tt.id, err)
+			}
+			if !tt.allowed && !errors.Is(err, models.ErrSystemRecord) {
+				t.Errorf("Expected ErrSystemRecord reading %s, got %v", tt.id, err)
+			}
+			if _, err := m.Record.Get(WithSystemAccess(scoped), tt.id); err != nil {
+				t.Errorf("Expected %s readable with system access, got %v", tt.id, err)
+			}
+		})
+	}
+
+	records, err := m.Record.ListRecords(WithRecordScope(ctx, ""), models.RecordFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "user_1" {
+		t.Errorf("Expected only user_1 listed, got %d records", len(records))
+	}
+
+	payload, _ := json.Marshal(models.DeleteTaskPayload{ID: "_system/flags"})
+	task := &models.InboxTask{ID: "task-1", Operation: models.TaskOperationDelete, Payload: payload, Status: models.TaskStatusPending}
+	if err := m.Inbox.CreateTask(WithRecordScope(ctx, ""), task); !errors.Is(err, models.ErrSystemRecord) {
+		t.Errorf("Expected the delete of a system record rejected, got %v", err)
+	}
+	if err := m.Inbox.CreateTask(ctx, task); err != nil {
+		t.Errorf("Expected the unscoped delete queued, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package reqtrace collects a verbose trace of a single request: the time
+// spent in each layer, the SQL executed and the cache lookups. Traces travel
+// in the request context; all methods are no-ops on a nil *Trace, so code
+// can record unconditionally
+package reqtrace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxEntries bounds the spans, queries and cache lookups kept per trace
+const maxEntries = 200
+
+// Span is the time spent in one call of a layer
+type Span struct {
+	Layer      string  `json:"layer"` // "handler", "service" or "repository"
+	Name       string  `json:"name"`
+	StartMs    float64 `json:"start_ms"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Query is one SQL statement
+type Query struct {
+	SQL        string  `json:"sql"`
+	Args       int     `json:"args"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// CacheLookup is one lookup of an in-process cache
+type CacheLookup struct {
+	Cache string `json:"cache"`
+	Key   string `json:"key"`
+	Hit   bool   `json:"hit"`
+}
+
+// Report is the collected trace
+type Report struct {
+	TotalMs   float64       `json:"total_ms"`
+	Spans     []Span        `json:"spans"`
+	Queries   []Query       `json:"queries"`
+	Cache     []CacheLookup `json:"cache"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// Trace records the events of a request
+type Trace struct {
+	start time.Time
+
+	mu     sync.Mutex
+	report Report
+}
+
+// New starts a trace
+func New() *Trace {
+	return &Trace{
+		start:  time.Now(),
+		report: Report{Spans: []Span{}, Queries: []Query{}, Cache: []CacheLookup{}},
+	}
+}
+
+type contextKey struct{}
+
+// WithTrace returns a context carrying t
+func WithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the trace of ctx, nil when the request is not traced
+func FromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(contextKey{}).(*Trace)
+	return t
+}
+
+// Span starts timing a call of layer and returns the function ending it,
+// e.g. defer trace.Span("service", "Get")()
+func (t *Trace) Span(layer, name string) func() {
+	if t == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.full(len(t.report.Spans)) {
+			return
+		}
+		t.report.Spans = append(t.report.Spans, Span{
+			Layer:      layer,
+			Name:       name,
+			StartMs:    ms(start.Sub(t.start)),
+			DurationMs: ms(time.Since(start)),
+		})
+	}
+}
+
+// Query records an SQL statement with the number of its arguments; their
+// values are left out as they may hold record data
+func (t *Trace) Query(sql string, args int, d time.Duration, err error) {
+	if t == nil {
+		return
+	}
+
+	q := Query{SQL: sql, Args: args, DurationMs: ms(d)}
+	if err != nil {
+		q.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.full(len(t.report.Queries)) {
+		t.report.Queries = append(t.report.Queries, q)
+	}
+}
+
+// CacheLookup records a lookup of cache
+func (t *Trace) CacheLookup(cache, key string, hit bool) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.full(len(t.report.Cache)) {
+		t.report.Cache = append(t.report.Cache, CacheLookup{Cache: cache, Key: key, Hit: hit})
+	}
+}
+
+// Report returns a copy of the trace so far
+func (t *Trace) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := t.report
+	report.TotalMs = ms(time.Since(t.start))
+	report.Spans = append([]Span{}, t.report.Spans...)
+	report.Queries = append([]Query{}, t.report.Queries...)
+	report.Cache = append([]CacheLookup{}, t.report.Cache...)
+	return report
+}
+
+// full reports whether a list reached maxEntries, marking the trace
+// truncated. Callers hold t.mu
+func (t *Trace) full(entries int) bool {
+	if entries < maxEntries {
+		return false
+	}
+	t.report.Truncated = true
+	return true
+}
+
+// ms converts a duration to fractional milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,54 @@
+package reqtrace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	trace := New()
+	ctx := WithTrace(context.Background(), trace)
+
+	end := FromContext(ctx).Span("service", "Get")
+	FromContext(ctx).Query("SELECT 1", 0, time.Millisecond, nil)
+	FromContext(ctx).Query("SELECT $1", 1, time.Millisecond, errors.New("boom"))
+	FromContext(ctx).CacheLookup("schema", "user", true)
+	end()
+
+	report := trace.Report()
+	if len(report.Spans) != 1 || report.Spans[0].Name != "Get" {
+		t.Errorf("Unexpected spans %+v", report.Spans)
+	}
+	if len(report.Queries) != 2 || report.Queries[1].Args != 1 || report.Queries[1].Error != "boom" {
+		t.Errorf("Unexpected queries %+v", report.Queries)
+	}
+	if len(report.Cache) != 1 || !report.Cache[0].Hit {
+		t.Errorf("Unexpected cache lookups %+v", report.Cache)
+	}
+}
+
+func TestTrace_Untraced(t *testing.T) {
+	trace := FromContext(context.Background())
+	if trace != nil {
+		t.Fatalf("Expected no trace, got %v", trace)
+	}
+
+	// Recording on a nil trace is a no-op
+	trace.Span("service", "Get")()
+	trace.Query("SELECT 1", 0, time.Millisecond, nil)
+	trace.CacheLookup("schema", "user", false)
+}
+
+func TestTrace_Truncated(t *testing.T) {
+	trace := New()
+	for i := 0; i < maxEntries+10; i++ {
+		trace.Query("SELECT 1", 0, 0, nil)
+	}
+
+	report := trace.Report()
+	if len(report.Queries) != maxEntries || !report.Truncated {
+		t.Errorf("Expected %d queries and a truncated trace, got %d, %v", maxEntries, len(report.Queries), report.Truncated)
+	}
+}
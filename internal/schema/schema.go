@@ -0,0 +1,455 @@
+// Package schema implements the subset of JSON Schema used to validate typed
+// records: type, enum, const, properties, required, additionalProperties,
+// items, min/max bounds for numbers, strings and arrays, and pattern.
+// Unsupported keywords are rejected when compiling so a schema never
+// silently validates less than its author expects. The x-reference
+// extension marks top-level properties holding the ID of another record
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *bool
+	items                *Schema
+	minimum              *float64
+	maximum              *float64
+	minLength            *int
+	maxLength            *int
+	minItems             *int
+	maxItems             *int
+	pattern              *regexp.Regexp
+	reference            *Reference
+}
+
+// What happens to the records referencing a deleted record
+const (
+	// OnDeleteNone leaves them as they are
+	OnDeleteNone = "none"
+	// OnDeleteRestrict keeps the referenced record from being deleted
+	OnDeleteRestrict = "restrict"
+	// OnDeleteCascade deletes them too
+	OnDeleteCascade = "cascade"
+	// OnDeleteSetNull sets their reference to null
+	OnDeleteSetNull = "set-null"
+)
+
+// Reference is a property holding the ID of another record, declared with
+// {"x-reference": {"on_delete": "restrict"}}
+type Reference struct {
+	Field    string
+	OnDelete string
+}
+
+// annotations are accepted and ignored
+var annotations = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"title":       true,
+	"description": true,
+	"examples":    true,
+	"default":     true,
+}
+
+// validTypes lists the JSON Schema type names
+var validTypes = map[string]bool{
+	"object":  true,
+	"array":   true,
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"null":    true,
+}
+
+// Compile parses a JSON Schema document
+func Compile(raw []byte) (*Schema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	return compile(doc, "#")
+}
+
+// CompileValue compiles a schema that was already decoded from JSON,
+// numbers as float64 or json.Number
+func CompileValue(doc interface{}) (*Schema, error) {
+	return compile(floatNumbers(doc), "#")
+}
+
+// compile builds a schema from a decoded JSON document at the given location
+func compile(doc interface{}, at string) (*Schema, error) {
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object", at)
+	}
+
+	s := &Schema{}
+	for key, value := range obj {
+		var err error
+		switch key {
+		case "type":
+			s.types, err = compileTypes(value)
+		case "enum":
+			values, ok := value.([]interface{})
+			if !ok || len(values) == 0 {
+				err = fmt.Errorf("must be a non-empty array")
+			}
+			s.enum = values
+		case "const":
+			s.constValue, s.hasConst = value, true
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("must be an object")
+				break
+			}
+			s.properties = make(map[string]*Schema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = compile(prop, at+"/properties/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			s.required, err = compileStrings(value)
+		case "additionalProperties":
+			allowed, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("only boolean values are supported")
+			}
+			s.additionalProperties = &allowed
+		case "items":
+			s.items, err = compile(value, at+"/items")
+			if err != nil {
+				return nil, err
+			}
+		case "minimum":
+			s.minimum, err = compileNumber(value)
+		case "maximum":
+			s.maximum, err = compileNumber(value)
+		case "minLength":
+			s.minLength, err = compileCount(value)
+		case "maxLength":
+			s.maxLength, err = compileCount(value)
+		case "minItems":
+			s.minItems, err = compileCount(value)
+		case "maxItems":
+			s.maxItems, err = compileCount(value)
+		case "pattern":
+			str, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("must be a string")
+				break
+			}
+			s.pattern, err = regexp.Compile(str)
+		case "x-reference":
+			s.reference, err = compileReference(value, at)
+		default:
+			if !annotations[key] {
+				err = fmt.Errorf("unsupported keyword")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", at, key, err)
+		}
+	}
+
+	return s, nil
+}
+
+// compileReference compiles the x-reference of the property at at, which
+// must be a top-level property
+func compileReference(value interface{}, at string) (*Reference, error) {
+	field, ok := strings.CutPrefix(at, "#/properties/")
+	if !ok || strings.Contains(field, "/") {
+		return nil, fmt.Errorf("only top-level properties can be references")
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an object")
+	}
+
+	ref := &Reference{Field: field, OnDelete: OnDeleteNone}
+	for key, value := range obj {
+		if key != "on_delete" {
+			return nil, fmt.Errorf("unsupported member %q", key)
+		}
+		onDelete, _ := value.(string)
+		switch onDelete {
+		case OnDeleteNone, OnDeleteRestrict, OnDeleteCascade, OnDeleteSetNull:
+			ref.OnDelete = onDelete
+		default:
+			return nil, fmt.Errorf("on_delete must be none, restrict, cascade or set-null")
+		}
+	}
+	return ref, nil
+}
+
+// References returns the references declared on the top-level properties,
+// sorted by field
+func (s *Schema) References() []Reference {
+	var refs []Reference
+	for _, prop := range s.properties {
+		if prop.reference != nil {
+			refs = append(refs, *prop.reference)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Field < refs[j].Field })
+	return refs
+}
+
+func compileTypes(value interface{}) ([]string, error) {
+	var types []string
+	switch v := value.(type) {
+	case string:
+		types = []string{v}
+	case []interface{}:
+		var err error
+		if types, err = compileStrings(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("must be a string or an array of strings")
+	}
+
+	for _, t := range types {
+		if !validTypes[t] {
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+	return types, nil
+}
+
+func compileStrings(value interface{}) ([]string, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an array of strings")
+	}
+
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be an array of strings")
+		}
+		result = append(result, str)
+	}
+	return result, nil
+}
+
+func compileNumber(value interface{}) (*float64, error) {
+	n, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return &n, nil
+}
+
+func compileCount(value interface{}) (*int, error) {
+	n, ok := value.(float64)
+	if !ok || n < 0 || n != math.Trunc(n) {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	count := int(n)
+	return &count, nil
+}
+
+// ValidationError lists every violation found in a value
+type ValidationError struct {
+	Violations []string
+}
+
+// Error implements error
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Violations, "; ")
+}
+
+// Validate checks a decoded JSON value against the schema, returning a
+// *ValidationError describing all violations. Numbers may be float64 or
+// json.Number; bounds are checked on their float64 value
+func (s *Schema) Validate(value interface{}) error {
+	var violations []string
+	s.validate(value, "", &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// validate appends the violations of value at path
+func (s *Schema) validate(value interface{}, path string, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		location := path
+		if location == "" {
+			location = "value"
+		}
+		*violations = append(*violations, location+": "+fmt.Sprintf(format, args...))
+	}
+
+	if n, ok := value.(json.Number); ok {
+		value = floatNumbers(n)
+	}
+
+	if len(s.types) > 0 && !matchesType(value, s.types) {
+		fail("expected %s, got %s", strings.Join(s.types, " or "), typeName(value))
+		return
+	}
+
+	if s.hasConst && !equal(value, s.constValue) {
+		fail("must equal %v", s.constValue)
+	}
+
+	if len(s.enum) > 0 {
+		found := false
+		for _, allowed := range s.enum {
+			if equal(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names) // deterministic violation order
+
+		for _, name := range names {
+			if prop, ok := s.properties[name]; ok {
+				prop.validate(v[name], joinPath(path, name), violations)
+			} else if s.additionalProperties != nil && !*s.additionalProperties {
+				fail("unexpected property %q", name)
+			}
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+
+	case string:
+		length := len([]rune(v))
+		if s.minLength != nil && length < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %q", s.pattern.String())
+		}
+
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+	}
+}
+
+// matchesType reports whether value is one of the JSON types
+func matchesType(value interface{}, types []string) bool {
+	actual := typeName(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the JSON Schema type of a decoded JSON value
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// equal compares decoded JSON values
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(floatNumbers(a), floatNumbers(b))
+}
+
+// floatNumbers returns a decoded JSON value with its json.Numbers replaced
+// by float64s, leaving value itself unchanged
+func floatNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = floatNumbers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = floatNumbers(item)
+		}
+		return converted
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// joinPath appends a property name to a dotted path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
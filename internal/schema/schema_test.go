@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(`{
+		"type": "object",
+		"required": ["email", "age"],
+		"additionalProperties": false,
+		"properties": {
+			"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"role": {"enum": ["admin", "user"]}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to compile schema: %v", err)
+	}
+
+	valid := decode(t, `{"email": "a@b.c", "age": 30, "tags": ["x"], "role": "user"}`)
+	if err := s.Validate(valid); err != nil {
+		t.Errorf("Expected valid document, got %v", err)
+	}
+
+	invalid := decode(t, `{"email": "nope", "age": 1.5, "tags": ["x", 1, "z"], "role": "root", "extra": true}`)
+	err = s.Validate(invalid)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+
+	// age type, email pattern, extra property, role enum, tags length and tags[1] type
+	if got := len(validationErr.Violations); got != 6 {
+		t.Errorf("Expected 6 violations, got %d: %v", got, validationErr.Violations)
+	}
+}
+
+func TestCompile_RejectsUnsupportedKeywords(t *testing.T) {
+	for _, raw := range []string{
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"type": "text"}`,
+		`{"properties": {"a": {"minLength": -1}}}`,
+		`{"properties": {"a": {"x-reference": {"on_delete": "drop"}}}}`,
+		`{"properties": {"a": {"properties": {"b": {"x-reference": {}}}}}}`,
+		`{"x-reference": {}}`,
+		`[]`,
+	} {
+		if _, err := Compile([]byte(raw)); err == nil {
+			t.Errorf("Expected compile error for %s", raw)
+		}
+	}
+}
+
+func TestSchema_References(t *testing.T) {
+	s, err := Compile([]byte(`{"type": "object", "properties": {
+		"owner": {"type": "string", "x-reference": {"on_delete": "cascade"}},
+		"manager": {"type": ["string", "null"], "x-reference": {}},
+		"name": {"type": "string"}
+	}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	refs := s.References()
+	expected := []Reference{{Field: "manager", OnDelete: OnDeleteNone}, {Field: "owner", OnDelete: OnDeleteCascade}}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected %v, got %v", expected, refs)
+	}
+}
+
+func decode(t *testing.T, raw string) interface{} {
+	t.Helper()
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatalf("Failed to decode %s: %v", raw, err)
+	}
+	return value
+}
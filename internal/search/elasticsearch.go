@@ -0,0 +1,222 @@
+// Package search writes records to and queries an Elasticsearch or
+// OpenSearch index over the REST API both share
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// Config configures the connection to the cluster
+type Config struct {
+	// URL is the cluster address, e.g. http://localhost:9200
+	URL   string
+	Index string
+
+	// APIKey is sent as an ApiKey authorization, otherwise Username and
+	// Password as basic authentication when set
+	APIKey   string
+	Username string
+	Password string
+
+	// Timeout bounds every request
+	Timeout time.Duration
+}
+
+// Client indexes and searches the documents of one index
+type Client struct {
+	cfg  Config
+	base string
+	http *http.Client
+}
+
+// document is the indexed form of a record
+type document struct {
+	ID    string      `json:"id"`
+	Type  string      `json:"type,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// New creates a client for cfg.Index
+func New(cfg Config) (*Client, error) {
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid search URL %q", cfg.URL)
+	}
+	if cfg.Index == "" || strings.ContainsAny(cfg.Index, "/?#,*") {
+		return nil, fmt.Errorf("invalid search index %q", cfg.Index)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("search timeout must be positive, got %v", cfg.Timeout)
+	}
+
+	return &Client{
+		cfg:  cfg,
+		base: strings.TrimRight(cfg.URL, "/"),
+		http: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Index returns the name of the index
+func (c *Client) Index() string {
+	return c.cfg.Index
+}
+
+// Bulk indexes records under their IDs and deletes the documents of
+// deletes in one request. Deleting a missing document is not an error
+func (c *Client) Bulk(ctx context.Context, records []*models.Record, deletes []string) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, record := range records {
+		enc.Encode(map[string]interface{}{"index": map[string]string{"_index": c.cfg.Index, "_id": record.ID}})
+		if err := enc.Encode(document{ID: record.ID, Type: record.Type, Value: record.Value}); err != nil {
+			return fmt.Errorf("failed to encode record %s: %w", record.ID, err)
+		}
+	}
+	for _, id := range deletes {
+		enc.Encode(map[string]interface{}{"delete": map[string]string{"_index": c.cfg.Index, "_id": id}})
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bulk request returned %d: %s", resp.StatusCode, errorReason(resp.Body))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	failed, first := 0, ""
+	for _, item := range result.Items {
+		for action, outcome := range item {
+			if outcome.Status < 300 || (action == "delete" && outcome.Status == http.StatusNotFound) {
+				continue
+			}
+			if failed == 0 {
+				first = fmt.Sprintf("%s %s: %s", action, outcome.ID, string(outcome.Error))
+			}
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d bulk actions failed, first %s", failed, first)
+}
+
+// Search runs a search request against the index and returns the response
+// of the cluster unchanged. params are passed as URL parameters (q, size,
+// from, sort, ...) and body, when not empty, as the query DSL. Requests the
+// cluster refuses return models.ErrInvalidSearch
+func (c *Client) Search(ctx context.Context, params url.Values, body []byte) (json.RawMessage, error) {
+	path := "/" + url.PathEscape(c.cfg.Index) + "/_search"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	resp, err := c.do(ctx, http.MethodPost, path, "application/json", reader)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		response, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read search response: %w", err)
+		}
+		return response, nil
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidSearch, errorReason(resp.Body))
+	default:
+		return nil, fmt.Errorf("search returned %d: %s", resp.StatusCode, errorReason(resp.Body))
+	}
+}
+
+// do sends a request to the cluster
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case c.cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.cfg.APIKey)
+	case c.cfg.Username != "":
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// errorReason extracts the reason of an error response, the root cause
+// when the cluster reports one
+func errorReason(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, maxErrorBody))
+
+	var response struct {
+		Error struct {
+			Reason    string `json:"reason"`
+			RootCause []struct {
+				Reason string `json:"reason"`
+			} `json:"root_cause"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil || response.Error.Reason == "" {
+		// Older clusters and proxies answer with a plain string
+		var reason struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &reason) == nil && reason.Error != "" {
+			return reason.Error
+		}
+		return strings.TrimSpace(string(data))
+	}
+	if len(response.Error.RootCause) > 0 && response.Error.RootCause[0].Reason != "" {
+		return response.Error.RootCause[0].Reason
+	}
+	return response.Error.Reason
+}
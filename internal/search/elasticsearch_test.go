@@ -0,0 +1,113 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := New(Config{URL: server.URL, Index: "records", APIKey: "key", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return client
+}
+
+func TestClient_Bulk(t *testing.T) {
+	var body, auth string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("Unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		io.WriteString(w, `{"errors": true, "items": [
+			{"index": {"_id": "a", "status": 201}},
+			{"delete": {"_id": "b", "status": 404}}
+		]}`)
+	})
+
+	records := []*models.Record{{ID: "a", Type: "user", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})}}
+	if err := client.Bulk(context.Background(), records, []string{"b"}); err != nil {
+		t.Fatalf("Expected deleting a missing document to succeed, got %v", err)
+	}
+
+	expected := `{"index":{"_id":"a","_index":"records"}}
+{"id":"a","type":"user","value":{"name":"Ada"}}
+{"delete":{"_id":"b","_index":"records"}}
+`
+	if body != expected {
+		t.Errorf("Expected bulk body %q, got %q", expected, body)
+	}
+	if auth != "ApiKey key" {
+		t.Errorf("Expected ApiKey authorization, got %q", auth)
+	}
+}
+
+func TestClient_BulkFailures(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"errors": true, "items": [
+			{"index": {"_id": "a", "status": 200}},
+			{"index": {"_id": "b", "status": 400, "error": {"type": "mapper_parsing_exception"}}}
+		]}`)
+	})
+
+	records := []*models.Record{{ID: "a", Value: models.MustEncodeValue(1)}, {ID: "b", Value: models.MustEncodeValue("x")}}
+	err := client.Bulk(context.Background(), records, nil)
+	if err == nil || !strings.Contains(err.Error(), "1 bulk actions failed, first index b") {
+		t.Errorf("Expected the failed action reported, got %v", err)
+	}
+}
+
+func TestClient_Search(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/records/_search" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("q") == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error": {"root_cause": [{"reason": "Failed to parse query [bad]"}], "reason": "all shards failed"}, "status": 400}`)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		io.WriteString(w, `{"hits": {"total": {"value": 0}}, "echo": `+string(data)+`}`)
+	})
+
+	response, err := client.Search(context.Background(), url.Values{"size": {"1"}}, []byte(`{"query":{"match_all":{}}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(response), `"echo": {"query":{"match_all":{}}}`) {
+		t.Errorf("Expected the response unchanged, got %s", response)
+	}
+
+	_, err = client.Search(context.Background(), url.Values{"q": {"bad"}}, nil)
+	if !errors.Is(err, models.ErrInvalidSearch) || !strings.Contains(err.Error(), "Failed to parse query [bad]") {
+		t.Errorf("Expected ErrInvalidSearch with the root cause, got %v", err)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{URL: "localhost:9200", Index: "records", Timeout: time.Second},
+		{URL: "http://localhost:9200", Index: "records/_doc", Timeout: time.Second},
+		{URL: "http://localhost:9200", Index: "records"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
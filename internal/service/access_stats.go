@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// maxPendingAccessStats bounds the records counted between two flushes.
+// Accesses of further records are dropped until the next flush
+const maxPendingAccessStats = 10000
+
+// accessTracker counts record reads and writes in memory and periodically
+// adds them to the access stats table in one batch, so tracking costs no
+// query per request. With a sample rate below one only a share of the
+// accesses is counted, each weighted by the inverse rate
+type accessTracker struct {
+	store      repository.AccessStatsStore
+	sampleRate float64
+	weight     int64
+	interval   time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*models.RecordAccessStats
+	dropped int64
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// newAccessTracker creates a tracker flushing to store every interval. The
+// sample rate is clamped to (0, 1]
+func newAccessTracker(store repository.AccessStatsStore, sampleRate float64, interval time.Duration) *accessTracker {
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+
+	return &accessTracker{
+		store:      store,
+		sampleRate: sampleRate,
+		weight:     int64(math.Round(1 / sampleRate)),
+		interval:   interval,
+		pending:    make(map[string]*models.RecordAccessStats),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Start flushes the counted accesses on every tick
+func (t *accessTracker) Start() {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-t.stopCh:
+				return
+			case <-ticker.C:
+				t.flush()
+			}
+		}
+	}()
+}
+
+// Stop stops the tracker and flushes what was counted since the last tick
+func (t *accessTracker) Stop() {
+	t.once.Do(func() { close(t.stopCh) })
+	t.wg.Wait()
+	t.flush()
+}
+
+// track counts an access of the record, a read unless write is set
+func (t *accessTracker) track(id string, write bool) {
+	if t == nil || id == "" {
+		return
+	}
+	if t.sampleRate < 1 && rand.Float64() >= t.sampleRate {
+		return
+	}
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.pending[id]
+	if !ok {
+		if len(t.pending) >= maxPendingAccessStats {
+			t.dropped++
+			return
+		}
+		s = &models.RecordAccessStats{ID: id}
+		t.pending[id] = s
+	}
+
+	if write {
+		s.Writes += t.weight
+		s.LastWriteAt = &now
+	} else {
+		s.Reads += t.weight
+		s.LastReadAt = &now
+	}
+}
+
+// flush writes the counted accesses and starts counting afresh. Counts of a
+// failed flush are dropped rather than carried over, keeping memory bounded
+func (t *accessTracker) flush() {
+	t.mu.Lock()
+	pending, dropped := t.pending, t.dropped
+	t.pending = make(map[string]*models.RecordAccessStats, len(pending))
+	t.dropped = 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Access stats: dropped %d accesses, more than %d records accessed between flushes",
+			dropped, maxPendingAccessStats)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	stats := make([]*models.RecordAccessStats, 0, len(pending))
+	for _, s := range pending {
+		stats = append(stats, s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := t.store.RecordAccess(ctx, stats); err != nil {
+		log.Printf("Access stats: failed to flush %d records: %v", len(stats), err)
+	}
+}
+
+// StartAccessStats counts record reads and writes, sampling the given share
+// of accesses and writing the counts every flushInterval
+func (s *Service) StartAccessStats(sampleRate float64, flushInterval time.Duration) {
+	if s.repo.AccessStats == nil {
+		log.Printf("Access stats are not supported by the repository")
+		return
+	}
+
+	s.accessStats = newAccessTracker(s.repo.AccessStats, sampleRate, flushInterval)
+	s.accessStats.Start()
+}
+
+// HottestRecords returns the most accessed records ordered by reads, writes
+// or their total. Counts lag behind by up to one flush interval
+func (s *Service) HottestRecords(ctx context.Context, limit int, orderBy string) ([]*models.RecordAccessStats, error) {
+	if s.accessStats == nil {
+		return nil, models.ErrAccessStatsDisabled
+	}
+
+	stats, err := s.repo.AccessStats.HottestRecords(ctx, limit, orderBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access stats: %w", err)
+	}
+	return stats, nil
+}
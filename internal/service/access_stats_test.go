@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_AccessStats(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock, AccessStats: mock}
+	ctx := context.Background()
+
+	svc := NewService(repo, metrics.NewMetrics())
+	if _, err := svc.HottestRecords(ctx, 10, models.AccessOrderTotal); !errors.Is(err, models.ErrAccessStatsDisabled) {
+		t.Fatalf("Expected ErrAccessStatsDisabled before starting, got %v", err)
+	}
+
+	for _, id := range []string{"hot", "warm"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// The flush interval is long, so counts reach the store on Stop only
+	svc.StartAccessStats(1, time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Get(ctx, "hot"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if _, err := svc.Get(ctx, "warm"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Get(ctx, "missing"); err == nil {
+		t.Fatal("Expected an error for a missing record")
+	}
+	if _, err := svc.Update(ctx, &models.UpdateRequest{ID: "warm", Value: models.MustEncodeValue(map[string]interface{}{"k": "w"})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc.Close()
+
+	tests := []struct {
+		by       string
+		expected []string
+	}{
+		{models.AccessOrderReads, []string{"hot", "warm"}},
+		{models.AccessOrderWrites, []string{"warm", "hot"}},
+		{models.AccessOrderTotal, []string{"hot", "warm"}},
+	}
+	for _, tt := range tests {
+		stats, err := svc.HottestRecords(ctx, 10, tt.by)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(stats) != len(tt.expected) {
+			t.Fatalf("Expected %d records by %s, got %d", len(tt.expected), tt.by, len(stats))
+		}
+		for i, id := range tt.expected {
+			if stats[i].ID != id {
+				t.Errorf("Expected %s at position %d by %s, got %s", id, i, tt.by, stats[i].ID)
+			}
+		}
+	}
+
+	stats, _ := svc.HottestRecords(ctx, 1, models.AccessOrderReads)
+	if len(stats) != 1 || stats[0].Reads != 3 || stats[0].Writes != 0 || stats[0].LastReadAt == nil {
+		t.Errorf("Expected 3 reads of the hottest record, got %+v", stats[0])
+	}
+}
+
+func TestAccessTracker_Sampling(t *testing.T) {
+	mock := repository.NewMockRepository()
+	tracker := newAccessTracker(mock, 0.25, time.Hour)
+
+	const accesses = 20000
+	for i := 0; i < accesses; i++ {
+		tracker.track("a", false)
+	}
+	tracker.flush()
+
+	stats, err := mock.HottestRecords(context.Background(), 1, models.AccessOrderReads)
+	if err != nil || len(stats) != 1 {
+		t.Fatalf("Expected one record, got %v %v", stats, err)
+	}
+
+	// Sampled counts are weighted by 4, the estimate lands near the truth
+	if stats[0].Reads%4 != 0 || stats[0].Reads < accesses*9/10 || stats[0].Reads > accesses*11/10 {
+		t.Errorf("Expected an estimate near %d in steps of 4, got %d", accesses, stats[0].Reads)
+	}
+}
@@ -0,0 +1,500 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// analyticsAlertTimeout bounds a post to the alert webhook
+const analyticsAlertTimeout = 5 * time.Second
+
+// analyticsColumnPattern matches the column names of mapped value fields
+var analyticsColumnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// analyticsChangeColumns are the columns of every change row, mapped value
+// fields may not reuse them
+var analyticsChangeColumns = map[string]bool{
+	"task_id": true, "record_id": true, "record_type": true, "operation": true,
+	"changed_at": true, "deleted": true, "value": true, "value_hash": true,
+}
+
+// Warehouse receives the rows of the analytics export
+type Warehouse interface {
+	// Name identifies the warehouse in the export status
+	Name() string
+
+	// Insert appends rows to table, keys are column names
+	Insert(ctx context.Context, table string, rows []map[string]interface{}) error
+}
+
+// AnalyticsColumn copies the field of record values at Path into Column of
+// the changes table
+type AnalyticsColumn struct {
+	Column string
+	Path   []string
+}
+
+// ParseAnalyticsColumns parses a comma-separated list of column=field
+// mappings, e.g. "customer_id=customer.id,total=total". Fields are dotted
+// paths into record values
+func ParseAnalyticsColumns(spec string) ([]AnalyticsColumn, error) {
+	var columns []AnalyticsColumn
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		column, field, ok := strings.Cut(part, "=")
+		column, field = strings.TrimSpace(column), strings.TrimSpace(field)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid analytics column %q, expected column=field", part)
+		}
+		if !analyticsColumnPattern.MatchString(column) {
+			return nil, fmt.Errorf("invalid analytics column name %q", column)
+		}
+		if analyticsChangeColumns[column] || seen[column] {
+			return nil, fmt.Errorf("analytics column %q is already defined", column)
+		}
+		seen[column] = true
+
+		columns = append(columns, AnalyticsColumn{Column: column, Path: strings.Split(field, ".")})
+	}
+
+	return columns, nil
+}
+
+// AnalyticsConfig configures the export of record changes and task
+// telemetry to a warehouse
+type AnalyticsConfig struct {
+	// Interval is how often changes are exported, BatchSize bounds the
+	// tasks read per query and so the rows per insert
+	Interval  time.Duration
+	BatchSize int
+
+	// Lookback is how far back the first export starts when there is no
+	// saved cursor, SettleDelay holds back tasks completed more recently
+	Lookback    time.Duration
+	SettleDelay time.Duration
+
+	// ChangesTable receives a row per record change, TasksTable a row per
+	// completed or failed task
+	ChangesTable string
+	TasksTable   string
+
+	// IncludeValue adds the JSON of the record value to change rows,
+	// Columns copies single fields of it into their own columns
+	IncludeValue bool
+	Columns      []AnalyticsColumn
+
+	// StateFile keeps the cursor so a restart continues where the last
+	// export stopped, empty keeps it in memory only
+	StateFile string
+
+	// AlertWebhookURL is posted a models.AnalyticsAlert once AlertAfter
+	// consecutive exports failed, and again when an export succeeds
+	AlertWebhookURL string
+	AlertAfter      int
+}
+
+// analyticsCursor is the saved position of the export
+type analyticsCursor struct {
+	Cursor  time.Time `json:"cursor"`
+	AfterID string    `json:"after_id"`
+}
+
+// exporter ships finished tasks and the changes they made to the warehouse
+// on a schedule. Rows are written at least once: a batch is exported again
+// when its insert into the tasks table fails, or after a restart when its
+// cursor could not be saved
+type exporter struct {
+	s         *Service
+	warehouse Warehouse
+	cfg       AnalyticsConfig
+	alerts    *http.Client
+
+	mu      sync.Mutex
+	status  models.AnalyticsStatus
+	afterID string
+
+	triggerCh chan struct{}
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	once      sync.Once
+}
+
+// StartAnalyticsExport starts exporting to warehouse every cfg.Interval
+func (s *Service) StartAnalyticsExport(warehouse Warehouse, cfg AnalyticsConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("analytics interval must be positive, got %v", cfg.Interval)
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("analytics batch size must be positive, got %d", cfg.BatchSize)
+	}
+	if cfg.ChangesTable == "" || cfg.TasksTable == "" {
+		return errors.New("analytics tables are required")
+	}
+
+	x := &exporter{
+		s:         s,
+		warehouse: warehouse,
+		cfg:       cfg,
+		alerts:    &http.Client{Timeout: analyticsAlertTimeout},
+		triggerCh: make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		status: models.AnalyticsStatus{
+			Warehouse: warehouse.Name(),
+			Cursor:    time.Now().Add(-cfg.Lookback),
+		},
+	}
+	if err := x.loadCursor(); err != nil {
+		return err
+	}
+	s.analytics = x
+
+	x.wg.Add(1)
+	go x.run()
+	return nil
+}
+
+// AnalyticsStatus returns the progress of the analytics export
+func (s *Service) AnalyticsStatus() (*models.AnalyticsStatus, error) {
+	if s.analytics == nil {
+		return nil, models.ErrAnalyticsDisabled
+	}
+
+	x := s.analytics
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	status := x.status
+	return &status, nil
+}
+
+// TriggerAnalyticsExport exports now instead of at the next interval
+func (s *Service) TriggerAnalyticsExport() error {
+	if s.analytics == nil {
+		return models.ErrAnalyticsDisabled
+	}
+
+	select {
+	case s.analytics.triggerCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run exports every interval and on triggers until stopped
+func (x *exporter) run() {
+	defer x.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-x.stopCh
+		cancel()
+	}()
+
+	ticker := time.NewTicker(x.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		x.export(ctx)
+
+		select {
+		case <-x.stopCh:
+			return
+		case <-ticker.C:
+		case <-x.triggerCh:
+		}
+	}
+}
+
+// export ships every settled task finished since the cursor
+func (x *exporter) export(ctx context.Context) {
+	started := time.Now()
+	x.mu.Lock()
+	x.status.LastRun = &started
+	x.mu.Unlock()
+
+	for {
+		more, err := x.exportBatch(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				x.fail(err)
+			}
+			return
+		}
+		if !more {
+			break
+		}
+	}
+	x.succeed(started)
+}
+
+// exportBatch exports the next batch of settled tasks and reports whether
+// more are waiting
+func (x *exporter) exportBatch(ctx context.Context) (bool, error) {
+	x.mu.Lock()
+	cursor, afterID := x.status.Cursor, x.afterID
+	x.mu.Unlock()
+
+	tasks, err := x.s.repo.Inbox.GetFinishedTasksAfter(ctx, cursor, afterID, x.cfg.BatchSize)
+	if err != nil {
+		return false, fmt.Errorf("failed to read finished tasks: %w", err)
+	}
+
+	full := len(tasks) == x.cfg.BatchSize
+	settled := time.Now().Add(-x.cfg.SettleDelay)
+	for i, task := range tasks {
+		if task.UpdatedAt.After(settled) {
+			tasks, full = tasks[:i], false
+			break
+		}
+	}
+	if len(tasks) == 0 {
+		return false, nil
+	}
+
+	changes, err := x.changeRows(ctx, tasks)
+	if err != nil {
+		return false, err
+	}
+	if err := x.warehouse.Insert(ctx, x.cfg.ChangesTable, changes); err != nil {
+		return false, err
+	}
+	if err := x.warehouse.Insert(ctx, x.cfg.TasksTable, taskRows(tasks)); err != nil {
+		return false, err
+	}
+	x.s.metrics.RecordAnalyticsRows(x.cfg.ChangesTable, len(changes))
+	x.s.metrics.RecordAnalyticsRows(x.cfg.TasksTable, len(tasks))
+
+	last := tasks[len(tasks)-1]
+	x.mu.Lock()
+	x.status.Cursor, x.afterID = last.UpdatedAt, last.ID
+	x.status.ExportedChanges += int64(len(changes))
+	x.status.ExportedTasks += int64(len(tasks))
+	x.mu.Unlock()
+
+	if err := x.saveCursor(); err != nil {
+		return false, err
+	}
+	return full, nil
+}
+
+// changeRows returns a row per completed task that changed a record, with
+// the state of the record at export time
+func (x *exporter) changeRows(ctx context.Context, tasks []*models.InboxTask) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	for _, task := range tasks {
+		if task.Status != models.TaskStatusCompleted {
+			continue
+		}
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(task.Payload, &payload); err != nil || payload.ID == "" {
+			// Custom operations without a record ID changed no record
+			continue
+		}
+
+		row := map[string]interface{}{
+			"task_id":    task.ID,
+			"record_id":  payload.ID,
+			"operation":  task.Operation,
+			"changed_at": task.UpdatedAt.UTC(),
+		}
+
+		record, err := x.s.repo.Record.Get(ctx, payload.ID)
+		if errors.Is(err, models.ErrRecordNotFound) {
+			row["deleted"] = true
+			rows = append(rows, row)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record %s: %w", payload.ID, err)
+		}
+
+		row["deleted"] = false
+		row["record_type"] = record.Type
+		row["value_hash"] = record.Hash
+		if x.cfg.IncludeValue {
+			value, err := json.Marshal(record.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode record %s: %w", payload.ID, err)
+			}
+			row["value"] = string(value)
+		}
+		var object map[string]interface{}
+		if record.DecodeValue(&object) == nil && object != nil {
+			for _, column := range x.cfg.Columns {
+				row[column.Column] = lookupField(object, column.Path)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// taskRows returns the telemetry row of every task
+func taskRows(tasks []*models.InboxTask) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		// Failed tasks and tasks completed before results were kept have
+		// no outcome
+		var result models.TaskResult
+		if task.Result != nil {
+			result = *task.Result
+		}
+		rows = append(rows, map[string]interface{}{
+			"task_id":       task.ID,
+			"operation":     task.Operation,
+			"status":        task.Status,
+			"outcome":       result.Outcome,
+			"rows_affected": result.RowsAffected,
+			"retries":       task.Retries,
+			"error":         task.Error,
+			"created_at":    task.CreatedAt.UTC(),
+			"finished_at":   task.UpdatedAt.UTC(),
+			"duration_ms":   task.UpdatedAt.Sub(task.CreatedAt).Milliseconds(),
+		})
+	}
+	return rows
+}
+
+// succeed records a completed export, resolving an open alert
+func (x *exporter) succeed(started time.Time) {
+	x.s.metrics.SetAnalyticsLastSuccess(started)
+
+	x.mu.Lock()
+	x.status.LastSuccess = &started
+	x.status.ConsecutiveFailures = 0
+	x.status.LastError = ""
+	resolved := x.status.Alerting
+	x.status.Alerting = false
+	alert := models.AnalyticsAlert{Type: models.AnalyticsAlertRecovered, Warehouse: x.status.Warehouse, Cursor: x.status.Cursor}
+	x.mu.Unlock()
+
+	if resolved {
+		log.Printf("Analytics export: recovered")
+		x.alert(alert)
+	}
+}
+
+// fail records a failed export, the unexported tasks are retried on the
+// next run. An alert is raised once AlertAfter runs in a row failed
+func (x *exporter) fail(err error) {
+	log.Printf("Analytics export: %v", err)
+	x.s.metrics.RecordAnalyticsFailure()
+
+	x.mu.Lock()
+	x.status.Failures++
+	x.status.ConsecutiveFailures++
+	x.status.LastError = err.Error()
+	raise := !x.status.Alerting && x.cfg.AlertAfter > 0 && x.status.ConsecutiveFailures >= x.cfg.AlertAfter
+	if raise {
+		x.status.Alerting = true
+	}
+	alert := models.AnalyticsAlert{
+		Type:      models.AnalyticsAlertFailing,
+		Warehouse: x.status.Warehouse,
+		Failures:  x.status.ConsecutiveFailures,
+		Error:     err.Error(),
+		Cursor:    x.status.Cursor,
+	}
+	x.mu.Unlock()
+
+	if raise {
+		log.Printf("Analytics export: failing after %d attempts", alert.Failures)
+		x.alert(alert)
+	}
+}
+
+// alert posts an alert to the webhook
+func (x *exporter) alert(alert models.AnalyticsAlert) {
+	if x.cfg.AlertWebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	resp, err := x.alerts.Post(x.cfg.AlertWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Analytics alert webhook failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Analytics alert webhook returned %s", resp.Status)
+	}
+}
+
+// loadCursor restores the position saved by the last run
+func (x *exporter) loadCursor() error {
+	if x.cfg.StateFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(x.cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read analytics state: %w", err)
+	}
+
+	var saved analyticsCursor
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid analytics state: %w", err)
+	}
+	x.status.Cursor, x.afterID = saved.Cursor, saved.AfterID
+	return nil
+}
+
+// saveCursor atomically writes the position of the export
+func (x *exporter) saveCursor() error {
+	if x.cfg.StateFile == "" {
+		return nil
+	}
+
+	x.mu.Lock()
+	data, err := json.Marshal(analyticsCursor{Cursor: x.status.Cursor, AfterID: x.afterID})
+	x.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(x.cfg.StateFile), 0o755); err != nil {
+		return fmt.Errorf("failed to save analytics state: %w", err)
+	}
+	if err := os.WriteFile(x.cfg.StateFile+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to save analytics state: %w", err)
+	}
+	if err := os.Rename(x.cfg.StateFile+".tmp", x.cfg.StateFile); err != nil {
+		return fmt.Errorf("failed to save analytics state: %w", err)
+	}
+	return nil
+}
+
+// Stop stops the exporter, waiting for a running export
+func (x *exporter) Stop() {
+	x.once.Do(func() { close(x.stopCh) })
+	x.wg.Wait()
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// fakeWarehouse keeps inserted rows per table, failing inserts while err is set
+type fakeWarehouse struct {
+	mu   sync.Mutex
+	err  error
+	rows map[string][]map[string]interface{}
+}
+
+func (f *fakeWarehouse) Name() string {
+	return "fake"
+}
+
+func (f *fakeWarehouse) Insert(ctx context.Context, table string, rows []map[string]interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.rows[table] = append(f.rows[table], rows...)
+	return nil
+}
+
+func (f *fakeWarehouse) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeWarehouse) count(table string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.rows[table])
+}
+
+// finishTask creates a task and moves it to status
+func finishTask(t *testing.T, mock *repository.MockRepository, id, operation, payload, status string) {
+	t.Helper()
+	ctx := context.Background()
+	task := &models.InboxTask{
+		ID:        id,
+		Operation: operation,
+		Payload:   []byte(payload),
+		Status:    models.TaskStatusPending,
+		CreatedAt: time.Now(),
+	}
+	if err := mock.CreateTask(ctx, task); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.UpdateTaskStatus(ctx, id, status, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+}
+
+func TestService_AnalyticsExport(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+
+	value := map[string]interface{}{"customer": map[string]interface{}{"id": "c1"}, "total": 10.0}
+	if err := mock.Insert(ctx, &models.Record{ID: "a", Type: "order", Value: models.MustEncodeValue(value)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	finishTask(t, mock, "task_1", models.TaskOperationInsert, `{"id":"a"}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_2", models.TaskOperationDelete, `{"id":"b"}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_3", models.TaskOperationUpdate, `{"id":"c"}`, models.TaskStatusFailed)
+	finishTask(t, mock, "task_4", "reindex", `{}`, models.TaskStatusCompleted)
+
+	var alertsMu sync.Mutex
+	var alerts []models.AnalyticsAlert
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert models.AnalyticsAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		alertsMu.Lock()
+		alerts = append(alerts, alert)
+		alertsMu.Unlock()
+	}))
+	defer webhook.Close()
+
+	columns, err := ParseAnalyticsColumns("customer_id=customer.id, total=total")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg := AnalyticsConfig{
+		Interval:        10 * time.Millisecond,
+		BatchSize:       3,
+		Lookback:        time.Hour,
+		ChangesTable:    "record_changes",
+		TasksTable:      "task_events",
+		IncludeValue:    true,
+		Columns:         columns,
+		StateFile:       filepath.Join(t.TempDir(), "analytics.json"),
+		AlertWebhookURL: webhook.URL,
+		AlertAfter:      2,
+	}
+
+	// The warehouse is down at first, an alert is raised after two failures
+	warehouse := &fakeWarehouse{err: errors.New("warehouse unavailable"), rows: map[string][]map[string]interface{}{}}
+	svc := NewService(repo, metrics.NewMetrics())
+	if err := svc.StartAnalyticsExport(warehouse, cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "a failure alert", func() bool {
+		status, _ := svc.AnalyticsStatus()
+		return status.Alerting
+	})
+	warehouse.setErr(nil)
+
+	var status *models.AnalyticsStatus
+	waitFor(t, "the export", func() bool {
+		status, _ = svc.AnalyticsStatus()
+		return status.ExportedTasks == 4 && !status.Alerting
+	})
+	svc.Close()
+
+	if status.ExportedChanges != 2 || status.ConsecutiveFailures != 0 || status.Failures < 2 || status.LastSuccess == nil {
+		t.Errorf("Expected 2 changes exported after the failures, got %+v", status)
+	}
+
+	changes := warehouse.rows["record_changes"]
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 change rows, got %v", changes)
+	}
+	inserted := changes[0]
+	if inserted["record_id"] != "a" || inserted["record_type"] != "order" || inserted["deleted"] != false ||
+		inserted["customer_id"] != "c1" || inserted["total"] != json.Number("10") || inserted["value"] == "" {
+		t.Errorf("Unexpected change row %v", inserted)
+	}
+	if deleted := changes[1]; deleted["record_id"] != "b" || deleted["deleted"] != true {
+		t.Errorf("Expected the delete exported, got %v", deleted)
+	}
+	if failed := warehouse.rows["task_events"][2]; failed["task_id"] != "task_3" || failed["status"] != models.TaskStatusFailed {
+		t.Errorf("Expected the failed task exported, got %v", failed)
+	}
+
+	alertsMu.Lock()
+	if len(alerts) != 2 || alerts[0].Type != models.AnalyticsAlertFailing || alerts[0].Failures != 2 ||
+		alerts[1].Type != models.AnalyticsAlertRecovered {
+		t.Errorf("Expected a failing and a recovered alert, got %+v", alerts)
+	}
+	alertsMu.Unlock()
+
+	// A restart continues from the saved cursor
+	finishTask(t, mock, "task_5", models.TaskOperationUpdate, `{"id":"a"}`, models.TaskStatusCompleted)
+	restarted := NewService(repo, metrics.NewMetrics())
+	defer restarted.Close()
+	if err := restarted.StartAnalyticsExport(warehouse, cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the next export", func() bool {
+		return warehouse.count("task_events") == 5
+	})
+	if count := warehouse.count("record_changes"); count != 3 {
+		t.Errorf("Expected only the new change exported, got %d change rows", count)
+	}
+}
+
+func TestParseAnalyticsColumns_Invalid(t *testing.T) {
+	for _, spec := range []string{"total", "total=", "1total=total", "record_id=id", "a=x,a=y"} {
+		if _, err := ParseAnalyticsColumns(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
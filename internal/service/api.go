@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// API is the service surface used by the HTTP handlers. *Service implements
+// it; tests and alternative implementations can provide their own
+type API interface {
+	// Record writes are queued and applied by the inbox worker. The ID of
+	// the queued task is the write's consistency token
+	Insert(ctx context.Context, req *models.InsertRequest) (*models.InboxTask, error)
+	InsertBatch(ctx context.Context, reqs []*models.InsertRequest) ([]*models.InboxTask, error)
+	Update(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error)
+	Patch(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error)
+	Delete(ctx context.Context, req *models.DeleteRequest) (*models.InboxTask, error)
+	WaitForWrite(ctx context.Context, token string) error
+	Reserve(ctx context.Context, id string, lease time.Duration) (*models.Reservation, error)
+
+	// Record reads
+	Get(ctx context.Context, id string) (*models.Record, error)
+	PendingChanges(ctx context.Context, id string) ([]string, error)
+	ListRecords(ctx context.Context, recordType string, limit, offset int) (*models.RecordsListResponse, error)
+	DiffRecord(ctx context.Context, id string, fromVersion, toVersion int) (*models.RecordDiff, error)
+	RecordHistory(ctx context.Context, id string, limit, offset int) (*models.RecordHistoryPage, error)
+	RecordReferences(ctx context.Context, id string) (*models.RecordReferences, error)
+	Traverse(ctx context.Context, start string, depth int) (*models.Traversal, error)
+	Composite(ctx context.Context, id string, opts CompositeOptions) (*models.CompositeDocument, error)
+	SubscribeChanges(ctx context.Context, filter models.ChangeFilter) (<-chan *models.ChangeEvent, error)
+	Search(ctx context.Context, params url.Values, body []byte) (json.RawMessage, error)
+
+	// Collections, the records of a collection are read and written with
+	// a context of WithCollection
+	ListCollections(ctx context.Context) (*models.CollectionsListResponse, error)
+	GetCollection(ctx context.Context, name string) (*models.CollectionStats, error)
+
+	// Inbox tasks
+	EnqueueTask(ctx context.Context, req *models.EnqueueTaskRequest) (*models.InboxTask, error)
+	SimulateTask(ctx context.Context, req *models.SimulateTaskRequest) (*models.TaskSimulation, error)
+	GetTasks(ctx context.Context, status string, limit, offset int) (*models.TasksListResponse, error)
+	GetTask(ctx context.Context, id string) (*models.InboxTask, error)
+	GetTaskStatuses(ctx context.Context, ids []string) (*models.TaskStatusResponse, error)
+	GetTaskStats(ctx context.Context) (*models.TaskStats, error)
+
+	// Record types
+	PutRecordType(ctx context.Context, recordType *models.RecordType) error
+	GetRecordType(ctx context.Context, name string) (*models.RecordType, error)
+	ListRecordTypes(ctx context.Context) ([]*models.RecordType, error)
+	DeleteRecordType(ctx context.Context, name string) error
+
+	// Protobuf values
+	PutProtoType(ctx context.Context, protoType *models.ProtoType) error
+	GetProtoType(ctx context.Context, name string) (*models.ProtoType, error)
+	ListProtoTypes(ctx context.Context) ([]*models.ProtoType, error)
+	DeleteProtoType(ctx context.Context, name string) error
+	InsertProto(ctx context.Context, req *models.ProtoWriteRequest) (*models.InboxTask, error)
+	UpdateProto(ctx context.Context, req *models.ProtoWriteRequest) (*models.InboxTask, error)
+	RenderRecord(ctx context.Context, record *models.Record) (*models.Record, error)
+
+	// Probes
+	StartupStatus() *models.StartupStatus
+	Readiness(ctx context.Context) *models.ReadinessStatus
+	SelfTest(ctx context.Context, viaInbox bool) *models.SelfTestReport
+
+	// Administration
+	GetTableStats(ctx context.Context) ([]*models.TableStats, error)
+	CheckSchema(ctx context.Context) (*models.SchemaReport, error)
+	Explain(ctx context.Context, endpoint string, params url.Values) (*models.ExplainReport, error)
+	HottestRecords(ctx context.Context, limit int, orderBy string) ([]*models.RecordAccessStats, error)
+	EvaluateRetention(ctx context.Context, dryRun bool) []*models.RetentionReport
+	StartDuplicateScan() (*models.DuplicateReport, error)
+	DuplicateReport() *models.DuplicateReport
+	StartIntegrityCheck() (*models.IntegrityReport, error)
+	IntegrityReport() *models.IntegrityReport
+	ReplicationStatus() (*models.ReplicationStatus, error)
+	ExportRecords(ctx context.Context, filter models.RecordFilter) (*models.ExportPage, error)
+	ImportRecords(ctx context.Context, req *models.ImportRequest) (*models.ImportResult, error)
+	StartClone(req *models.CloneRequest) (*models.CloneReport, error)
+	CloneReport() *models.CloneReport
+	StartReprocess(req *models.ReprocessRequest) (*models.ReprocessReport, error)
+	ReprocessReport() *models.ReprocessReport
+	StartVerify(req *models.VerifyRequest) (*models.VerifyReport, error)
+	VerifyReport() *models.VerifyReport
+	StartReplicationBackfill() (*models.BackfillReport, error)
+	ShadowStatus() (*models.ShadowStatus, error)
+	StartShadowBackfill() (*models.BackfillReport, error)
+	StartCutover(req *models.CutoverRequest) (*models.CutoverReport, error)
+	CutoverReport() *models.CutoverReport
+	IngestFiles() ([]*models.IngestFile, error)
+	IngestFile(key string) (*models.IngestFile, error)
+	NotifyIngest(keys []string) error
+	SearchIndexStatus() (*models.SearchIndexStatus, error)
+	StartSearchReindex() (*models.ReindexReport, error)
+	AnalyticsStatus() (*models.AnalyticsStatus, error)
+	TriggerAnalyticsExport() error
+	PendingDigest(ctx context.Context) (*models.FailedTaskDigest, error)
+	TriggerDigest() error
+	ListSnapshots(ctx context.Context) ([]*models.SnapshotInfo, error)
+	SaveSnapshot(ctx context.Context, name string) (*models.SnapshotInfo, error)
+	LoadSnapshot(ctx context.Context, name string) (*models.SnapshotInfo, error)
+}
+
+var _ API = (*Service)(nil)
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// batchSizer adapts the worker batch size using AIMD (additive increase,
+// multiplicative decrease): the size grows by one after every healthy batch
+// and is halved when a batch is slow or has too many errors
+type batchSizer struct {
+	mu            sync.Mutex
+	current       int
+	min           int
+	max           int
+	targetLatency time.Duration
+	maxErrorRate  float64
+}
+
+// newBatchSizer creates a batch sizer starting at initial, bounded by [min, max]
+func newBatchSizer(initial, min, max int, targetLatency time.Duration, maxErrorRate float64) *batchSizer {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+
+	b := &batchSizer{
+		min:           min,
+		max:           max,
+		targetLatency: targetLatency,
+		maxErrorRate:  maxErrorRate,
+	}
+	b.current = b.clamp(initial)
+
+	return b
+}
+
+// Size returns the batch size to use for the next poll
+func (b *batchSizer) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.current
+}
+
+// Observe adjusts the batch size based on the outcome of a batch: claimed
+// tasks were taken from the queue, of which processed were left after
+// coalescing, failed failed, and busy is the time spent processing each of
+// them, summed. Latency is per task, however concurrently they ran
+func (b *batchSizer) Observe(claimed, processed, failed int, busy time.Duration) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if processed == 0 {
+		return b.current
+	}
+
+	errorRate := float64(failed) / float64(processed)
+	avgLatency := busy / time.Duration(processed)
+
+	if errorRate > b.maxErrorRate || (b.targetLatency > 0 && avgLatency > b.targetLatency) {
+		b.current = b.clamp(b.current / 2)
+	} else if claimed >= b.current {
+		// Only grow when the batch was full, otherwise the queue is the limit
+		b.current = b.clamp(b.current + 1)
+	}
+
+	return b.current
+}
+
+// clamp bounds size to the configured range
+func (b *batchSizer) clamp(size int) int {
+	if size < b.min {
+		return b.min
+	}
+	if size > b.max {
+		return b.max
+	}
+	return size
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchSizer_AIMD(t *testing.T) {
+	sizer := newBatchSizer(4, 2, 6, 10*time.Millisecond, 0.1)
+
+	// Full, fast, error-free batches grow the size additively up to max
+	for i := 0; i < 5; i++ {
+		sizer.Observe(sizer.Size(), sizer.Size(), 0, time.Millisecond)
+	}
+	if got := sizer.Size(); got != 6 {
+		t.Errorf("Expected batch size to grow to max 6, got %d", got)
+	}
+
+	// A partial batch means the queue is drained and the size must not grow
+	sizer = newBatchSizer(4, 2, 6, 10*time.Millisecond, 0.1)
+	sizer.Observe(2, 2, 0, time.Millisecond)
+	if got := sizer.Size(); got != 4 {
+		t.Errorf("Expected batch size to stay at 4 after partial batch, got %d", got)
+	}
+
+	// Errors above the threshold halve the size
+	sizer.Observe(4, 4, 2, time.Millisecond)
+	if got := sizer.Size(); got != 2 {
+		t.Errorf("Expected batch size to halve to 2 on errors, got %d", got)
+	}
+
+	// Slow batches shrink but never below min
+	sizer.Observe(2, 2, 0, time.Second)
+	if got := sizer.Size(); got != 2 {
+		t.Errorf("Expected batch size to stay at min 2, got %d", got)
+	}
+}
+
+func TestBatchSizer_CoalescedAndConcurrentBatches(t *testing.T) {
+	// A full batch coalesced into fewer tasks still grows the size
+	sizer := newBatchSizer(4, 1, 10, 10*time.Millisecond, 0.1)
+	sizer.Observe(4, 1, 0, time.Millisecond)
+	if got := sizer.Size(); got != 5 {
+		t.Errorf("Expected batch size to grow to 5 after a coalesced full batch, got %d", got)
+	}
+
+	// Latency is that of each task, not the wall time of the batch divided
+	// by its tasks: four tasks of 20ms run in parallel are still slow
+	sizer.Observe(5, 4, 0, 4*20*time.Millisecond)
+	if got := sizer.Size(); got != 2 {
+		t.Errorf("Expected batch size to halve to 2 on slow tasks, got %d", got)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// maxChangeSubscribers bounds the concurrent change subscriptions
+const maxChangeSubscribers = 1000
+
+// changeBufferSize is the number of changes buffered for a subscriber, which
+// is dropped when it falls further behind so the worker never waits on it
+const changeBufferSize = 256
+
+// changeFeed fans the record writes applied by the worker out to the
+// change subscribers
+type changeFeed struct {
+	mu          sync.Mutex
+	subscribers map[*changeSubscriber]struct{}
+}
+
+// changeSubscriber is a change subscription
+type changeSubscriber struct {
+	// prefix is the scope prefix of the subscriber, whose IDs it is sent
+	// changes under, and keyspace that of the task IDs it is sent
+	prefix   string
+	keyspace string
+	filter   models.ChangeFilter
+	events   chan *models.ChangeEvent
+}
+
+// newChangeFeed creates a change feed without subscribers
+func newChangeFeed() *changeFeed {
+	return &changeFeed{subscribers: make(map[*changeSubscriber]struct{})}
+}
+
+// SubscribeChanges returns the changes of the records of the scope of ctx
+// the worker of this instance applies from now on, selected by filter, with
+// the IDs the caller knows the records by. The channel is closed once ctx
+// is done, or when the caller falls more than changeBufferSize changes
+// behind
+func (s *Service) SubscribeChanges(ctx context.Context, filter models.ChangeFilter) (<-chan *models.ChangeEvent, error) {
+	sub := &changeSubscriber{
+		prefix:   scopePrefix(ctx),
+		keyspace: keyspacePrefix(ctx),
+		filter:   filter,
+		events:   make(chan *models.ChangeEvent, changeBufferSize),
+	}
+
+	f := s.changes
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.subscribers) >= maxChangeSubscribers {
+		return nil, fmt.Errorf("%w: at most %d", models.ErrTooManySubscribers, maxChangeSubscribers)
+	}
+	f.subscribers[sub] = struct{}{}
+
+	context.AfterFunc(ctx, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.remove(sub)
+	})
+	return sub.events, nil
+}
+
+// remove ends a subscription, the lock held
+func (f *changeFeed) remove(sub *changeSubscriber) {
+	if _, ok := f.subscribers[sub]; ok {
+		delete(f.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// publish sends the write of task to the subscribers it is selected by
+func (f *changeFeed) publish(task *models.InboxTask) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.subscribers) == 0 {
+		return
+	}
+
+	id := payloadRecordID(task.Payload)
+	changedAt := time.Now().UTC()
+	for sub := range f.subscribers {
+		rest, ok := strings.CutPrefix(id, sub.prefix)
+		if !ok || repository.IsSystemID(rest) || !sub.filter.Matches(rest) {
+			continue
+		}
+		select {
+		case sub.events <- &models.ChangeEvent{Operation: task.Operation, ID: rest, TaskID: strings.TrimPrefix(task.ID, sub.keyspace), ChangedAt: changedAt}:
+		default:
+			log.Printf("Dropping change subscriber %d changes behind", changeBufferSize)
+			f.remove(sub)
+		}
+	}
+}
+
+// middleware publishes the record writes of tasks once they are persisted
+func (f *changeFeed) middleware(next TaskStep) TaskStep {
+	return func(ctx context.Context, task *models.InboxTask) error {
+		if err := next(ctx, task); err != nil {
+			return err
+		}
+		switch task.Operation {
+		case models.TaskOperationInsert, models.TaskOperationUpdate, models.TaskOperationDelete:
+			f.publish(task)
+		}
+		return nil
+	}
+}
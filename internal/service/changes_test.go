@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestService_SubscribeChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, _ := newMockService()
+	defer svc.Close()
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+
+	acme := WithTenant(ctx, "acme")
+	all, err := svc.SubscribeChanges(ctx, models.ChangeFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	users, err := svc.SubscribeChanges(acme, models.ChangeFilter{Prefix: "user_"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	value := map[string]interface{}{"name": "Ada"}
+	for _, write := range []struct {
+		ctx context.Context
+		id  string
+	}{{ctx, "user_1"}, {acme, "order_1"}, {acme, "user_2"}} {
+		if _, err := svc.Insert(write.ctx, &models.InsertRequest{ID: write.id, Value: models.MustEncodeValue(value)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if _, err := svc.Delete(acme, &models.DeleteRequest{ID: "user_2"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	next := func(events <-chan *models.ChangeEvent) *models.ChangeEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a change")
+			return nil
+		}
+	}
+
+	// Tenant records are system records outside the tenant
+	if event := next(all); event.ID != "user_1" || event.Operation != models.TaskOperationInsert || event.TaskID == "" {
+		t.Errorf("Expected the insert of user_1, got %+v", event)
+	}
+	if event := next(users); event.ID != "user_2" || event.Operation != models.TaskOperationInsert {
+		t.Errorf("Expected the insert of user_2 under its tenant ID, got %+v", event)
+	}
+	if event := next(users); event.ID != "user_2" || event.Operation != models.TaskOperationDelete {
+		t.Errorf("Expected the delete of user_2, got %+v", event)
+	}
+	select {
+	case event := <-all:
+		t.Errorf("Expected no tenant change outside the tenant, got %+v", event)
+	default:
+	}
+
+	cancel()
+	waitFor(t, "the subscriptions to end", func() bool {
+		_, open := <-all
+		return !open
+	})
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"mit-service/internal/models"
+)
+
+// WithCoalescing coalesces runs of updates to the same record within a
+// claimed batch to the latest one, for records whose ID starts with one of
+// prefixes ("*" matches every record). Producers sending full state
+// snapshots then cost one write per batch instead of one per snapshot.
+// The superseded updates are completed once the latest one is applied
+func WithCoalescing(prefixes []string) WorkerOption {
+	return func(w *InboxWorker) {
+		w.coalescePrefixes = prefixes
+	}
+}
+
+// coalescible reports whether updates to the record may be coalesced
+func (w *InboxWorker) coalescible(recordID string) bool {
+	for _, prefix := range w.coalescePrefixes {
+		if prefix == "*" || strings.HasPrefix(recordID, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// coalesceTasks drops updates followed by another update to the same record
+// before any other task touches it, since updates replace the whole value.
+// The dropped tasks are kept under the task superseding them until it is
+// settled. Updates expecting a version are applied as they are, they must
+// see the versions left by the updates before them
+func (w *InboxWorker) coalesceTasks(workerID int, tasks []*models.InboxTask) []*models.InboxTask {
+	if len(w.coalescePrefixes) == 0 || len(tasks) < 2 {
+		return tasks
+	}
+
+	// latest is the index of the last update of each record since the last
+	// other task touching it
+	latest := make(map[string]int)
+	dropped := make(map[int]bool)
+	superseded := make(map[string][]*models.InboxTask)
+
+	for i, task := range tasks {
+		recordID := taskRecordID(task)
+		id, decoded := strings.CutPrefix(recordID, "record:")
+		if task.Operation != models.TaskOperationUpdate || !decoded || !w.coalescible(id) || expectsVersion(task) {
+			delete(latest, recordID)
+			continue
+		}
+
+		if prev, ok := latest[recordID]; ok {
+			previous := tasks[prev]
+			dropped[prev] = true
+			superseded[task.ID] = append(superseded[previous.ID], previous)
+			delete(superseded, previous.ID)
+		}
+		latest[recordID] = i
+	}
+
+	if len(dropped) == 0 {
+		return tasks
+	}
+
+	kept := make([]*models.InboxTask, 0, len(tasks)-len(dropped))
+	for i, task := range tasks {
+		if !dropped[i] {
+			kept = append(kept, task)
+		}
+	}
+	for id, tasks := range superseded {
+		w.coalesced.Store(id, tasks)
+	}
+
+	log.Printf("Worker %d: coalesced %d updates", workerID, len(dropped))
+	return kept
+}
+
+// settleCoalesced completes the updates superseded by task once it is
+// applied. When it fails they go back to pending, so they are retried
+// along with it
+func (w *InboxWorker) settleCoalesced(ctx context.Context, workerID int, task *models.InboxTask, applied bool) {
+	entry, ok := w.coalesced.LoadAndDelete(task.ID)
+	if !ok {
+		return
+	}
+
+	status := models.TaskStatusCompleted
+	if !applied {
+		status = models.TaskStatusPending
+	}
+	for _, superseded := range entry.([]*models.InboxTask) {
+		var err error
+		if applied {
+			err = w.repo.Inbox.CompleteTask(ctx, superseded.ID, &models.TaskResult{Outcome: models.TaskOutcomeSuperseded})
+		} else {
+			err = w.repo.Inbox.UpdateTaskStatus(ctx, superseded.ID, status, "")
+		}
+		if err != nil {
+			log.Printf("Worker %d: failed to update coalesced task %s status to %s: %v", workerID, superseded.ID, status, err)
+			continue
+		}
+		if applied {
+			w.metrics.RecordCoalescedTask()
+		}
+	}
+}
+
+// expectsVersion reports whether a task only applies to a record version
+func expectsVersion(task *models.InboxTask) bool {
+	var payload struct {
+		ExpectedVersion int64 `json:"expected_version"`
+	}
+	return json.Unmarshal(task.Payload, &payload) == nil && payload.ExpectedVersion != 0
+}
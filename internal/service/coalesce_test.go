@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestCoalesceTasks(t *testing.T) {
+	w := &InboxWorker{coalescePrefixes: []string{"sensor_"}}
+	update := func(id, record string) *models.InboxTask {
+		return &models.InboxTask{ID: id, Operation: models.TaskOperationUpdate, Payload: []byte(`{"id":"` + record + `"}`)}
+	}
+	tasks := []*models.InboxTask{
+		update("t1", "sensor_1"),
+		update("t2", "sensor_1"),
+		update("t3", "user_1"),
+		update("t4", "user_1"),
+		update("t5", "sensor_1"),
+		{ID: "t6", Operation: models.TaskOperationDelete, Payload: []byte(`{"id":"sensor_1"}`)},
+		update("t7", "sensor_1"),
+		update("t8", "sensor_2"),
+	}
+
+	kept := w.coalesceTasks(0, tasks)
+
+	var ids []string
+	for _, task := range kept {
+		ids = append(ids, task.ID)
+	}
+	expected := []string{"t3", "t4", "t5", "t6", "t7", "t8"}
+	if len(ids) != len(expected) {
+		t.Fatalf("Expected tasks %v, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Fatalf("Expected tasks %v, got %v", expected, ids)
+		}
+	}
+
+	superseded, ok := w.coalesced.Load("t5")
+	if !ok || len(superseded.([]*models.InboxTask)) != 2 {
+		t.Errorf("Expected t5 to supersede t1 and t2, got %v", superseded)
+	}
+}
+
+func TestService_CoalescedUpdates(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "sensor_1", Value: models.MustEncodeValue(map[string]interface{}{"temp": 1})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var tasks []*models.InboxTask
+	for temp := 2; temp <= 4; temp++ {
+		task, err := svc.Update(ctx, &models.UpdateRequest{ID: "sensor_1", Value: models.MustEncodeValue(map[string]interface{}{"temp": temp})})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond, WithCoalescing([]string{"sensor_"}))
+	waitFor(t, "the updates", func() bool {
+		for _, task := range tasks {
+			if stored, _ := mock.GetTask(ctx, task.ID); stored == nil || stored.Status != models.TaskStatusCompleted {
+				return false
+			}
+		}
+		return true
+	})
+
+	record, err := mock.Get(ctx, "sensor_1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var value map[string]interface{}
+	if err := record.DecodeValue(&value); err != nil || value["temp"] != json.Number("4") {
+		t.Errorf("Expected the latest value, got %s", record.Value)
+	}
+
+	for i, task := range tasks {
+		expected := models.TaskOutcomeSuperseded
+		if i == len(tasks)-1 {
+			expected = models.TaskOutcomeUpdated
+		}
+		if stored, _ := mock.GetTask(ctx, task.ID); stored.Result == nil || stored.Result.Outcome != expected {
+			t.Errorf("Expected update %d %s, got %+v", i, expected, stored.Result)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// CollectionRecordPrefix is the ID prefix of the records of collections,
+// followed by the collection name. They are system records, so they never
+// show up outside their collection
+const CollectionRecordPrefix = "_system/collections/"
+
+// collectionIndexPrefix is the ID prefix of the records registering each
+// collection, written on the first insert into it
+const collectionIndexPrefix = "_system/collection-index/"
+
+// ValidCollectionName reports whether name can name a collection: up to 64
+// letters, digits, '_', '.' and '-', starting with a letter or digit
+func ValidCollectionName(name string) bool {
+	return scopeName.MatchString(name)
+}
+
+// collectionContextKey is the context key of the collection of a request
+type collectionContextKey struct{}
+
+// WithCollection returns a context whose record reads and writes are
+// confined to the collection name, within the sandbox and tenant of ctx if
+// any
+func WithCollection(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, collectionContextKey{}, name)
+}
+
+// CollectionFromContext returns the collection of ctx, empty for the flat
+// keyspace
+func CollectionFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(collectionContextKey{}).(string)
+	return name
+}
+
+// collectionPrefix returns the ID prefix of the records of the collection
+// of ctx, empty outside a collection
+func collectionPrefix(ctx context.Context) string {
+	if name := CollectionFromContext(ctx); name != "" {
+		return CollectionRecordPrefix + name + "/"
+	}
+	return ""
+}
+
+// collectionEntry is the value of a collection index record
+type collectionEntry struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// registerCollection adds the collection of ctx to the index unless it is
+// known to be there. Sandbox collections are looked up every time, their
+// index records are purged with the sandbox
+func (s *Service) registerCollection(ctx context.Context) error {
+	name := CollectionFromContext(ctx)
+	if name == "" {
+		return nil
+	}
+	id := keyspacePrefix(ctx) + collectionIndexPrefix + name
+	if _, ok := s.collections.Load(id); ok {
+		return nil
+	}
+
+	value, err := models.EncodeValue(collectionEntry{Name: name, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	err = s.repo.Record.Insert(repository.WithSystemAccess(ctx), &models.Record{ID: id, Value: value})
+	if err != nil && !errors.Is(err, models.ErrRecordExists) {
+		return fmt.Errorf("failed to register collection %s: %w", name, err)
+	}
+
+	if sandboxPrefix(ctx) == "" {
+		s.collections.Store(id, struct{}{})
+	}
+	return nil
+}
+
+// ListCollections lists the collections of the keyspace of ctx with their
+// record counts
+func (s *Service) ListCollections(ctx context.Context) (*models.CollectionsListResponse, error) {
+	ctx = repository.WithSystemAccess(ctx)
+	prefix := keyspacePrefix(ctx) + collectionIndexPrefix
+	response := &models.CollectionsListResponse{Collections: []*models.CollectionStats{}}
+
+	filter := models.RecordFilter{Prefix: prefix, Limit: 1000}
+	for {
+		records, err := s.repo.Record.ListRecords(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list collections: %w", err)
+		}
+		for _, record := range records {
+			stats, err := s.collectionStats(ctx, record)
+			if err != nil {
+				return nil, err
+			}
+			response.Collections = append(response.Collections, stats)
+		}
+		if len(records) < filter.Limit {
+			return response, nil
+		}
+		filter.AfterID = records[len(records)-1].ID
+	}
+}
+
+// GetCollection returns the stats of the collection name, failing with
+// models.ErrCollectionNotFound before the first insert into it
+func (s *Service) GetCollection(ctx context.Context, name string) (*models.CollectionStats, error) {
+	ctx = repository.WithSystemAccess(ctx)
+	record, err := s.repo.Record.Get(ctx, keyspacePrefix(ctx)+collectionIndexPrefix+name)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return nil, fmt.Errorf("collection '%s': %w", name, models.ErrCollectionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+	return s.collectionStats(ctx, record)
+}
+
+// collectionStats counts the records of the collection of an index record.
+// ctx must have system access
+func (s *Service) collectionStats(ctx context.Context, record *models.Record) (*models.CollectionStats, error) {
+	var entry collectionEntry
+	if err := record.DecodeValue(&entry); err != nil {
+		return nil, fmt.Errorf("invalid collection index record %s: %w", record.ID, err)
+	}
+
+	// Every record was last written before a cutoff in the future
+	prefix := keyspacePrefix(ctx) + CollectionRecordPrefix + entry.Name + "/"
+	count, err := s.repo.Record.CountExpiredRecords(ctx, prefix, time.Now().Add(time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count records of collection %s: %w", entry.Name, err)
+	}
+
+	return &models.CollectionStats{
+		Name:      entry.Name,
+		Records:   count,
+		CreatedAt: entry.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestService_Collections(t *testing.T) {
+	ctx := context.Background()
+	orders := WithCollection(ctx, "orders")
+	svc, _ := newMockService()
+	defer svc.Close()
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+
+	insert := func(ctx context.Context, id, name string) {
+		t.Helper()
+		task, err := svc.Insert(ctx, &models.InsertRequest{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"name": name})})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := svc.WaitForWrite(ctx, task.ID); err != nil {
+			t.Fatalf("Insert of %s not applied: %v", name, err)
+		}
+	}
+	insert(ctx, "a", "flat")
+	insert(orders, "a", "order")
+	insert(orders, "b", "order")
+	insert(WithCollection(WithSandbox(ctx, "acme"), "orders"), "a", "sandbox")
+
+	record, err := svc.Get(orders, "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record.ID != "a" || valueField(record, "name") != "order" {
+		t.Errorf("Expected the collection record as a, got %s: %v", record.ID, valueField(record, "name"))
+	}
+	record, err = svc.Get(ctx, "a")
+	if err != nil || valueField(record, "name") != "flat" {
+		t.Fatalf("Expected the flat record untouched, got %+v, %v", record, err)
+	}
+	if _, err := svc.Get(ctx, "b"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected b only in the collection, got %v", err)
+	}
+
+	list, err := svc.ListRecords(ctx, "", 10, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(list.Records) != 1 || list.Records[0].ID != "a" {
+		t.Errorf("Expected only the flat record listed, got %+v", list.Records)
+	}
+	list, err = svc.ListRecords(orders, "", 10, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(list.Records) != 2 || list.Records[0].ID != "a" || list.Records[1].ID != "b" {
+		t.Errorf("Expected the two orders listed, got %+v", list.Records)
+	}
+
+	collections, err := svc.ListCollections(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(collections.Collections) != 1 || collections.Collections[0].Name != "orders" || collections.Collections[0].Records != 2 {
+		t.Errorf("Expected orders with 2 records, got %+v", collections.Collections)
+	}
+	stats, err := svc.GetCollection(WithSandbox(ctx, "acme"), "orders")
+	if err != nil || stats.Records != 1 {
+		t.Errorf("Expected the sandbox orders with 1 record, got %+v, %v", stats, err)
+	}
+	if _, err := svc.GetCollection(ctx, "users"); !errors.Is(err, models.ErrCollectionNotFound) {
+		t.Errorf("Expected an unknown collection, got %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/reqtrace"
+)
+
+// CompositeOptions selects how a composite document is assembled
+type CompositeOptions struct {
+	// Depth is how many references deep records are inlined
+	Depth int
+
+	// Fields maps the reference fields to inline to the member receiving
+	// the referenced record, the field itself to replace the ID. Nil
+	// inlines every reference in place
+	Fields map[string]string
+}
+
+// ParseCompositeFields parses the reference fields to inline, e.g.
+// "customer:customer_doc,owner": the customer is inlined next to its ID as
+// customer_doc, the owner in place of its ID
+func ParseCompositeFields(spec string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		field, target, mapped := strings.Cut(entry, ":")
+		field, target = strings.TrimSpace(field), strings.TrimSpace(target)
+		if !mapped {
+			target = field
+		}
+		if field == "" || target == "" {
+			return nil, fmt.Errorf("%w: invalid field mapping %q, expected field or field:member", models.ErrInvalidComposite, entry)
+		}
+		fields[field] = target
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: no fields to inline", models.ErrInvalidComposite)
+	}
+	return fields, nil
+}
+
+// WithCompositeCache caches up to size composite documents for at most ttl.
+// The writes the worker applies drop the documents holding the records they
+// change; ttl bounds how long writes of other instances go unseen
+func WithCompositeCache(size int, ttl time.Duration) Option {
+	return func(s *Service) {
+		s.composites = newCompositeCache(size, ttl)
+	}
+}
+
+// Composite returns the record id with the records it references inlined
+// into its value, opts.Depth references deep. References to records that do
+// not exist, are out of reach or are already being inlined (cycles) are
+// left as IDs, as are the references of protobuf records
+func (s *Service) Composite(ctx context.Context, id string, opts CompositeOptions) (*models.CompositeDocument, error) {
+	defer reqtrace.FromContext(ctx).Span("service", "Composite")()
+
+	if opts.Depth < 0 || opts.Depth > MaxTraversalDepth {
+		return nil, fmt.Errorf("%w: depth must be between 0 and %d", models.ErrInvalidComposite, MaxTraversalDepth)
+	}
+
+	key := compositeKey(scoped(ctx, id), opts)
+	if doc := s.composites.get(key); doc != nil {
+		return doc, nil
+	}
+	generation := s.composites.currentGeneration()
+
+	record, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &compositeAssembly{s: s, ctx: ctx, opts: opts, deps: []string{scoped(ctx, id)}}
+	doc := &models.CompositeDocument{
+		ID:      record.ID,
+		Type:    record.Type,
+		Version: record.Version,
+		Value:   record.Value,
+		Depth:   opts.Depth,
+	}
+	value, err := a.inline(record, opts.Depth, map[string]bool{id: true})
+	if err != nil {
+		return nil, err
+	}
+	if value != nil {
+		if doc.Value, err = models.EncodeValue(value); err != nil {
+			return nil, err
+		}
+	}
+
+	s.composites.put(key, doc, a.deps, generation)
+	return doc, nil
+}
+
+// compositeKey identifies the composite document of the stored record id
+func compositeKey(id string, opts CompositeOptions) string {
+	key := id + "\x00" + strconv.Itoa(opts.Depth)
+	if opts.Fields == nil {
+		return key
+	}
+	fields := make([]string, 0, len(opts.Fields))
+	for field, target := range opts.Fields {
+		fields = append(fields, field+":"+target)
+	}
+	sort.Strings(fields)
+	return key + "\x00" + strings.Join(fields, ",")
+}
+
+// compositeAssembly assembles a composite document
+type compositeAssembly struct {
+	s    *Service
+	ctx  context.Context
+	opts CompositeOptions
+
+	// deps are the stored IDs of the records read, missing ones included,
+	// whose writes invalidate the document
+	deps []string
+}
+
+// inline returns the value of record with the records it references
+// inlined, depth references deep, nil when it is not a JSON object. path
+// holds the records being inlined
+func (a *compositeAssembly) inline(record *models.Record, depth int, path map[string]bool) (map[string]interface{}, error) {
+	var value map[string]interface{}
+	if record.Encoding != "" || record.DecodeValue(&value) != nil {
+		return nil, nil
+	}
+	if depth == 0 {
+		return value, nil
+	}
+
+	refs, err := a.s.outgoingReferences(a.ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		member := ref.Field
+		if a.opts.Fields != nil {
+			var ok bool
+			if member, ok = a.opts.Fields[ref.Field]; !ok {
+				continue
+			}
+		}
+		if path[ref.ID] {
+			continue
+		}
+
+		a.deps = append(a.deps, scoped(a.ctx, ref.ID))
+		child, err := a.s.Get(a.ctx, ref.ID)
+		if errors.Is(err, models.ErrRecordNotFound) || errors.Is(err, models.ErrSystemRecord) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		path[ref.ID] = true
+		inlined, err := a.inline(child, depth-1, path)
+		delete(path, ref.ID)
+		if err != nil {
+			return nil, err
+		}
+		if inlined != nil {
+			value[member] = inlined
+		}
+	}
+	return value, nil
+}
+
+// compositeCache is an LRU cache of composite documents. A nil cache
+// caches nothing
+type compositeCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	lru     *list.List
+	entries map[string]*list.Element
+
+	// dependents maps stored record IDs to the keys of the documents
+	// holding them
+	dependents map[string]map[string]bool
+
+	// generation grows with every invalidation, so documents assembled
+	// meanwhile are not stored
+	generation uint64
+}
+
+// compositeEntry is a cached composite document
+type compositeEntry struct {
+	key      string
+	doc      *models.CompositeDocument
+	deps     []string
+	storedAt time.Time
+}
+
+// newCompositeCache creates a cache of size documents, nil for size 0
+func newCompositeCache(size int, ttl time.Duration) *compositeCache {
+	if size <= 0 {
+		return nil
+	}
+	return &compositeCache{
+		size:       size,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		dependents: make(map[string]map[string]bool),
+	}
+}
+
+// get returns a copy of the cached document of key marked as cached, nil
+// when there is none
+func (c *compositeCache) get(key string) *models.CompositeDocument {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*compositeEntry)
+	if c.ttl > 0 && time.Since(entry.storedAt) > c.ttl {
+		c.remove(elem)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+
+	copied := *entry.doc
+	copied.Cached = true
+	return &copied
+}
+
+// currentGeneration returns the generation to pass to put
+func (c *compositeCache) currentGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches the document of key assembled from the records deps, unless a
+// write was applied since generation
+func (c *compositeCache) put(key string, doc *models.CompositeDocument, deps []string, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	for c.lru.Len() >= c.size {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[key] = c.lru.PushFront(&compositeEntry{key: key, doc: doc, deps: deps, storedAt: time.Now()})
+	for _, id := range deps {
+		if c.dependents[id] == nil {
+			c.dependents[id] = make(map[string]bool)
+		}
+		c.dependents[id][key] = true
+	}
+}
+
+// invalidate drops the documents holding the stored record id
+func (c *compositeCache) invalidate(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key := range c.dependents[id] {
+		if elem, ok := c.entries[key]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// remove drops a cached document, the lock held
+func (c *compositeCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*compositeEntry)
+	delete(c.entries, entry.key)
+	for _, id := range entry.deps {
+		delete(c.dependents[id], entry.key)
+		if len(c.dependents[id]) == 0 {
+			delete(c.dependents, id)
+		}
+	}
+}
+
+// middleware invalidates the documents holding the record a task wrote
+// once it is persisted
+func (c *compositeCache) middleware(next TaskStep) TaskStep {
+	return func(ctx context.Context, task *models.InboxTask) error {
+		if err := next(ctx, task); err != nil {
+			return err
+		}
+		switch task.Operation {
+		case models.TaskOperationInsert, models.TaskOperationUpdate, models.TaskOperationDelete:
+			var payload struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(task.Payload, &payload) == nil {
+				c.invalidate(payload.ID)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_Composite(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithCompositeCache(10, time.Minute))
+	defer svc.Close()
+
+	ref := map[string]interface{}{"type": "string", "x-reference": map[string]interface{}{}}
+	for name, props := range map[string]map[string]interface{}{
+		"customer": {"name": map[string]interface{}{"type": "string"}, "manager": ref},
+		"order":    {"customer": ref, "owner": ref},
+	} {
+		err := svc.PutRecordType(ctx, &models.RecordType{Name: name, Schema: map[string]interface{}{"type": "object", "properties": props}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for id, record := range map[string]*models.Record{
+		"c_1": {Type: "customer", Value: json.RawMessage(`{"name": "Ada", "manager": "c_2"}`)},
+		"c_2": {Type: "customer", Value: json.RawMessage(`{"name": "Bob", "manager": "c_1"}`)},
+		"o_1": {Type: "order", Value: json.RawMessage(`{"customer": "c_1", "owner": "gone"}`)},
+	} {
+		record.ID = id
+		if err := mock.Insert(ctx, record); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	compose := func(opts CompositeOptions) map[string]interface{} {
+		t.Helper()
+		doc, err := svc.Composite(ctx, "o_1", opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var value map[string]interface{}
+		if err := json.Unmarshal(doc.Value, &value); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return value
+	}
+
+	// The cycle back to c_1 and the missing owner are left as IDs
+	value := compose(CompositeOptions{Depth: 5})
+	customer, _ := value["customer"].(map[string]interface{})
+	manager, _ := customer["manager"].(map[string]interface{})
+	if customer["name"] != "Ada" || manager["name"] != "Bob" || manager["manager"] != "c_1" || value["owner"] != "gone" {
+		t.Errorf("Expected the customer and its manager inlined, got %v", value)
+	}
+
+	fields, err := ParseCompositeFields("customer:customer_doc")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	value = compose(CompositeOptions{Depth: 1, Fields: fields})
+	customer, _ = value["customer_doc"].(map[string]interface{})
+	if value["customer"] != "c_1" || customer["manager"] != "c_2" {
+		t.Errorf("Expected the customer next to its ID, got %v", value)
+	}
+
+	doc, err := svc.Composite(ctx, "o_1", CompositeOptions{Depth: 1, Fields: fields})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !doc.Cached {
+		t.Error("Expected the second read served from the cache")
+	}
+
+	// Updating an inlined record drops the documents holding it
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	if _, err := svc.Update(ctx, &models.UpdateRequest{ID: "c_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Eve", "manager": "c_2"})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the composite to be rebuilt", func() bool {
+		customer, _ := compose(CompositeOptions{Depth: 1, Fields: fields})["customer_doc"].(map[string]interface{})
+		return customer["name"] == "Eve"
+	})
+
+	if _, err := svc.Composite(ctx, "o_1", CompositeOptions{Depth: MaxTraversalDepth + 1}); err == nil {
+		t.Error("Expected a depth past the limit rejected")
+	}
+}
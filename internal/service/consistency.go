@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// defaultConsistencyWait bounds how long a read waits for a write
+const defaultConsistencyWait = 5 * time.Second
+
+// Poll intervals while waiting for a write, doubling up to the maximum
+const (
+	minConsistencyPoll = 5 * time.Millisecond
+	maxConsistencyPoll = 100 * time.Millisecond
+)
+
+// WithConsistencyWait bounds how long WaitForWrite waits for a queued write
+// to be applied
+func WithConsistencyWait(maxWait time.Duration) Option {
+	return func(s *Service) {
+		s.consistencyWait = maxWait
+	}
+}
+
+// WaitForWrite waits until the write identified by the consistency token
+// returned from Insert, Update or Delete has been applied, giving callers
+// read-your-writes semantics over the inbox. A task that no longer exists
+// was completed and cleaned up. It fails with ErrConsistencyTimeout when
+// the write is still queued after the configured wait, and with
+// ErrWriteFailed when the task ran out of retries. Tokens name the tasks of
+// the caller's keyspace, see newTaskID
+func (s *Service) WaitForWrite(ctx context.Context, token string) error {
+	if token == "" || len(token) > 255 {
+		return models.ErrInvalidToken
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.consistencyWait)
+	defer cancel()
+
+	poll := minConsistencyPoll
+	for {
+		task, err := s.repo.Inbox.GetTask(ctx, scopedTaskID(ctx, token))
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			return nil
+		case err != nil && ctx.Err() == nil:
+			return fmt.Errorf("failed to get task: %w", err)
+		case err == nil && !taskVisible(ctx, task):
+			return models.ErrInvalidToken
+		case err == nil && task.Status == models.TaskStatusCompleted:
+			return nil
+		case err == nil && task.Status == models.TaskStatusFailed:
+			return fmt.Errorf("%w: %s", models.ErrWriteFailed, task.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %v", models.ErrConsistencyTimeout, s.consistencyWait)
+			}
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+		poll = min(2*poll, maxConsistencyPoll)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_WaitForWrite(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	ctx := context.Background()
+
+	svc := NewService(repo, metrics.NewMetrics(), WithConsistencyWait(100*time.Millisecond))
+	defer svc.Close()
+
+	task, err := svc.Insert(ctx, &models.InsertRequest{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Nothing applies the write without a worker
+	if err := svc.WaitForWrite(ctx, task.ID); !errors.Is(err, models.ErrConsistencyTimeout) {
+		t.Fatalf("Expected ErrConsistencyTimeout, got %v", err)
+	}
+
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond)
+	svc.consistencyWait = 5 * time.Second
+	if err := svc.WaitForWrite(ctx, task.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Get(ctx, "a"); err != nil {
+		t.Errorf("Expected the record to be readable after the wait, got %v", err)
+	}
+
+	// Completed tasks that were cleaned up count as applied
+	if err := svc.WaitForWrite(ctx, "cleaned-up"); err != nil {
+		t.Errorf("Expected a missing task to count as applied, got %v", err)
+	}
+
+	// Updating a missing record fails once retries run out
+	task, err = svc.Update(ctx, &models.UpdateRequest{ID: "missing", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := svc.WaitForWrite(ctx, task.ID); !errors.Is(err, models.ErrWriteFailed) {
+		t.Errorf("Expected ErrWriteFailed, got %v", err)
+	}
+
+	if err := svc.WaitForWrite(ctx, ""); !errors.Is(err, models.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an empty token, got %v", err)
+	}
+}
+
+func TestService_PendingChanges(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	ctx := context.Background()
+
+	svc := NewService(repo, metrics.NewMetrics())
+	defer svc.Close()
+
+	first, _ := svc.Insert(ctx, &models.InsertRequest{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"k": 1})})
+	time.Sleep(time.Millisecond)
+	second, _ := svc.Update(ctx, &models.UpdateRequest{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"k": 2})})
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "b", Value: models.MustEncodeValue(map[string]interface{}{"k": 1})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ids, err := svc.PendingChanges(ctx, "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != first.ID || ids[1] != second.ID {
+		t.Errorf("Expected tasks %s and %s, got %v", first.ID, second.ID, ids)
+	}
+
+	if err := mock.UpdateTaskStatus(ctx, first.ID, models.TaskStatusCompleted, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ids, _ := svc.PendingChanges(ctx, "a"); len(ids) != 1 || ids[0] != second.ID {
+		t.Errorf("Expected only %s after the insert completed, got %v", second.ID, ids)
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// maxCutoverDivergences bounds the divergences listed in a cutover report
+const maxCutoverDivergences = 100
+
+// StartCutover promotes the shadow backend to primary in the background. It
+// pauses the inbox worker until the tasks it claimed are processed, swaps
+// the backends so records are read from and written to the promoted one and
+// mirrored to the previous primary, then compares the records of the
+// previous primary with the promoted one before the worker resumes. Without
+// req.Force divergences switch the backends back. Running it again swaps
+// the backends back
+func (s *Service) StartCutover(req *models.CutoverRequest) (*models.CutoverReport, error) {
+	if s.mirror == nil || s.primaryRouter == nil {
+		return nil, models.ErrShadowDisabled
+	}
+	if req.VerifyLimit < 0 {
+		return nil, fmt.Errorf("%w: verify_limit must not be negative", models.ErrInvalidCutover)
+	}
+
+	// A backfill copies records between the backends, it must not run while
+	// they are swapped
+	backfill := s.mirror.backfill.last()
+	if backfill != nil && backfill.Status == models.ScanRunning {
+		return nil, fmt.Errorf("%w: a backfill is running", models.ErrCutoverNotReady)
+	}
+	// The original primary holds every record, only the first promotion
+	// needs the shadow backfilled
+	if !req.Force && !s.primaryRouter.Rerouted() && (backfill == nil || backfill.Status != models.ScanCompleted) {
+		return nil, fmt.Errorf("%w: run a shadow backfill first", models.ErrCutoverNotReady)
+	}
+
+	from, to := models.BackendOriginal, models.BackendShadow
+	if s.primaryRouter.Rerouted() {
+		from, to = to, from
+	}
+	report := &models.CutoverReport{
+		Status:      models.ScanRunning,
+		Request:     req,
+		StartedAt:   time.Now(),
+		From:        from,
+		To:          to,
+		Divergences: []*models.Divergence{},
+	}
+
+	err := s.cutover.start(report, func(ctx context.Context) *models.CutoverReport {
+		result := *report
+		defer func() {
+			now := time.Now()
+			result.FinishedAt = &now
+		}()
+
+		if err := s.runCutover(ctx, req, &result); err != nil {
+			result.Status = models.ScanFailed
+			result.Error = err.Error()
+			log.Printf("Cutover to the %s backend failed: %v", to, err)
+		} else {
+			result.Status = models.ScanCompleted
+			log.Printf("Cutover completed: the %s backend is primary, %d records compared", to, result.Compared)
+		}
+		return &result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// CutoverReport returns the running or last finished cutover, nil when none
+// was started
+func (s *Service) CutoverReport() *models.CutoverReport {
+	return s.cutover.last()
+}
+
+// runCutover drains the worker, swaps the backends and verifies the
+// promoted one, switching back when it diverges
+func (s *Service) runCutover(ctx context.Context, req *models.CutoverRequest, report *models.CutoverReport) error {
+	if s.worker != nil {
+		start := time.Now()
+		s.worker.Pause()
+		defer s.worker.Resume()
+		report.DrainSeconds = time.Since(start).Seconds()
+	}
+
+	previous := s.swapBackends()
+	log.Printf("Cutover: switched records to the %s backend, verifying", report.To)
+
+	err := s.compareCutover(ctx, req, previous, report)
+	if err == nil && report.Divergent > 0 && !req.Force {
+		err = fmt.Errorf("%d records diverge", report.Divergent)
+	}
+	if err != nil {
+		s.swapBackends()
+		report.RolledBack = true
+		return fmt.Errorf("switched back to the %s backend: %w", report.From, err)
+	}
+	return nil
+}
+
+// swapBackends makes the shadow backend primary and the primary the shadow,
+// returning the previous primary
+func (s *Service) swapBackends() repository.RecordRepository {
+	previous := s.primaryRouter.Route(s.shadowRouter.Target())
+	s.shadowRouter.Route(previous)
+	return previous
+}
+
+// compareCutover reads every record of the previous primary from the
+// promoted one, up to req.VerifyLimit records
+func (s *Service) compareCutover(ctx context.Context, req *models.CutoverRequest, previous repository.RecordRepository, report *models.CutoverReport) error {
+	filter := models.RecordFilter{Limit: scanPageSize}
+	for {
+		records, err := previous.ListRecords(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to list records of the %s backend: %w", report.From, err)
+		}
+
+		for _, record := range records {
+			if req.VerifyLimit > 0 && report.Compared >= req.VerifyLimit {
+				return nil
+			}
+			promoted, err := s.repo.Record.Get(ctx, record.ID)
+			if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+				return fmt.Errorf("failed to read record %s: %w", record.ID, err)
+			}
+			report.Compared++
+
+			var divergence *models.Divergence
+			switch {
+			case promoted == nil:
+				divergence = &models.Divergence{Kind: models.DivergenceMissingInPrimary, RecordID: record.ID}
+			case promoted.Type != record.Type:
+				divergence = &models.Divergence{
+					Kind: models.DivergenceTypeMismatch, RecordID: record.ID,
+					Error: fmt.Sprintf("type %q in primary, %q in shadow", promoted.Type, record.Type),
+				}
+			case !sameRecord(promoted, record):
+				divergence = &models.Divergence{
+					Kind: models.DivergenceValueMismatch, RecordID: record.ID,
+					Changes: diffRecordValues(promoted, record),
+				}
+			}
+			if divergence == nil {
+				continue
+			}
+			report.Divergent++
+			if len(report.Divergences) < maxCutoverDivergences {
+				report.Divergences = append(report.Divergences, divergence)
+			}
+		}
+
+		if len(records) < filter.Limit {
+			return nil
+		}
+		filter.AfterID = records[len(records)-1].ID
+	}
+}
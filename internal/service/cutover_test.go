@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// waitForCutover waits for the running cutover to finish
+func waitForCutover(t *testing.T, svc *Service) *models.CutoverReport {
+	t.Helper()
+	var report *models.CutoverReport
+	waitFor(t, "the cutover", func() bool {
+		report = svc.CutoverReport()
+		return report != nil && report.Status != models.ScanRunning
+	})
+	return report
+}
+
+func TestService_Cutover(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	shadow := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithShadowRepository(shadow))
+	defer svc.Close()
+
+	if _, err := svc.StartCutover(&models.CutoverRequest{}); !errors.Is(err, models.ErrShadowDisabled) {
+		t.Errorf("Expected ErrShadowDisabled, got %v", err)
+	}
+	if err := svc.StartShadowWrites(ShadowConfig{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond)
+
+	if err := mock.Insert(ctx, &models.Record{ID: "old", Value: models.MustEncodeValue(map[string]interface{}{"n": 1.0})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.StartCutover(&models.CutoverRequest{}); !errors.Is(err, models.ErrCutoverNotReady) {
+		t.Fatalf("Expected ErrCutoverNotReady before the backfill, got %v", err)
+	}
+	if _, err := svc.StartCutover(&models.CutoverRequest{VerifyLimit: -1}); !errors.Is(err, models.ErrInvalidCutover) {
+		t.Errorf("Expected ErrInvalidCutover, got %v", err)
+	}
+
+	if _, err := svc.StartShadowBackfill(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the backfill", func() bool {
+		status, _ := svc.ShadowStatus()
+		return status.Backfill.Status != models.ScanRunning
+	})
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"n": 1.0})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the mirrored insert", func() bool {
+		status, _ := svc.ShadowStatus()
+		return status.MirroredWrites == 1
+	})
+
+	// Promote the shadow
+	if _, err := svc.StartCutover(&models.CutoverRequest{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report := waitForCutover(t, svc)
+	if report.Status != models.ScanCompleted || report.From != models.BackendOriginal || report.To != models.BackendShadow ||
+		report.Compared != 2 || report.Divergent != 0 || report.RolledBack {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if status, _ := svc.ShadowStatus(); status.Primary != models.BackendShadow {
+		t.Errorf("Expected the shadow to be primary, got %s", status.Primary)
+	}
+
+	// Writes now go to the promoted backend and are mirrored to the original
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "b", Value: models.MustEncodeValue(map[string]interface{}{"n": 2.0})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the mirrored insert", func() bool {
+		status, _ := svc.ShadowStatus()
+		return status.MirroredWrites == 2
+	})
+	if _, err := shadow.Get(ctx, "b"); err != nil {
+		t.Errorf("Expected the insert in the promoted backend, got %v", err)
+	}
+	if _, err := mock.Get(ctx, "b"); err != nil {
+		t.Errorf("Expected the insert mirrored to the original backend, got %v", err)
+	}
+	if record, err := svc.Get(ctx, "b"); err != nil || valueField(record, "n") != json.Number("2") {
+		t.Errorf("Expected reads from the promoted backend, got %v, %v", record, err)
+	}
+
+	// Switching back finds the original diverged and stays on the shadow
+	if err := mock.Update(ctx, &models.Record{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"n": 5.0})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.StartCutover(&models.CutoverRequest{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report = waitForCutover(t, svc)
+	if report.Status != models.ScanFailed || !report.RolledBack || report.Divergent != 1 ||
+		report.Divergences[0].Kind != models.DivergenceValueMismatch || report.Divergences[0].RecordID != "a" {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if status, _ := svc.ShadowStatus(); status.Primary != models.BackendShadow {
+		t.Errorf("Expected the shadow to stay primary, got %s", status.Primary)
+	}
+
+	// Forcing it keeps the switch
+	if _, err := svc.StartCutover(&models.CutoverRequest{Force: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report = waitForCutover(t, svc)
+	if report.Status != models.ScanCompleted || report.RolledBack || report.Divergent != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if status, _ := svc.ShadowStatus(); status.Primary != models.BackendOriginal {
+		t.Errorf("Expected the original to be primary again, got %s", status.Primary)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mit-service/internal/models"
+)
+
+// DiffRecord returns the changes of a record value between two versions,
+// read from the record history. A version the record reached more than once,
+// after being deleted and inserted again, is its latest one
+func (s *Service) DiffRecord(ctx context.Context, id string, fromVersion, toVersion int) (*models.RecordDiff, error) {
+	if s.repo.History == nil {
+		return nil, models.ErrHistoryUnsupported
+	}
+
+	from, err := s.repo.History.RecordVersion(ctx, scoped(ctx, id), int64(fromVersion))
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.repo.History.RecordVersion(ctx, scoped(ctx, id), int64(toVersion))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.RecordDiff{
+		ID:          id,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Changes:     diffRecordValues(from.Record(), to.Record()),
+	}, nil
+}
+
+// diffValues returns the changes turning from into to. Objects are compared
+// member by member in key order; arrays of equal length element by element,
+// otherwise they are replaced as a whole
+func diffValues(from, to interface{}) []*models.ValueChange {
+	changes := []*models.ValueChange{}
+	appendDiff(&changes, "", from, to)
+	return changes
+}
+
+// diffRecordValues returns the changes turning the value of from into the
+// value of to. Values that are not valid JSON are compared as null
+func diffRecordValues(from, to *models.Record) []*models.ValueChange {
+	fromValue, _ := from.DecodedValue()
+	toValue, _ := to.DecodedValue()
+	return diffValues(fromValue, toValue)
+}
+
+// appendDiff appends the changes between from and to found below path
+func appendDiff(changes *[]*models.ValueChange, path string, from, to interface{}) {
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if fromIsObject && toIsObject {
+		keys := make([]string, 0, len(fromObject)+len(toObject))
+		for key := range fromObject {
+			keys = append(keys, key)
+		}
+		for key := range toObject {
+			if _, ok := fromObject[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			memberPath := path + "/" + escapePointerToken(key)
+			oldValue, inFrom := fromObject[key]
+			newValue, inTo := toObject[key]
+			switch {
+			case !inFrom:
+				*changes = append(*changes, &models.ValueChange{Op: models.ChangeAdd, Path: memberPath, New: newValue})
+			case !inTo:
+				*changes = append(*changes, &models.ValueChange{Op: models.ChangeRemove, Path: memberPath, Old: oldValue})
+			default:
+				appendDiff(changes, memberPath, oldValue, newValue)
+			}
+		}
+		return
+	}
+
+	fromArray, fromIsArray := from.([]interface{})
+	toArray, toIsArray := to.([]interface{})
+	if fromIsArray && toIsArray && len(fromArray) == len(toArray) {
+		for i := range fromArray {
+			appendDiff(changes, path+"/"+strconv.Itoa(i), fromArray[i], toArray[i])
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, &models.ValueChange{Op: models.ChangeReplace, Path: path, Old: from, New: to})
+	}
+}
+
+// pointerEscaper escapes a JSON Pointer reference token
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// escapePointerToken escapes an object key for use in a JSON Pointer
+func escapePointerToken(key string) string {
+	return pointerEscaper.Replace(key)
+}
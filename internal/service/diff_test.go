@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+func TestDiffValues(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatalf("Invalid test value %s: %v", s, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		expected []*models.ValueChange
+	}{
+		{"equal", `{"a": 1, "b": [1, 2]}`, `{"b": [1, 2], "a": 1}`, []*models.ValueChange{}},
+		{
+			"members added, removed and replaced",
+			`{"name": "Ada", "age": 36, "tmp": true}`,
+			`{"name": "Ada Lovelace", "age": 36, "email": "ada@example.com"}`,
+			[]*models.ValueChange{
+				{Op: models.ChangeAdd, Path: "/email", New: "ada@example.com"},
+				{Op: models.ChangeReplace, Path: "/name", Old: "Ada", New: "Ada Lovelace"},
+				{Op: models.ChangeRemove, Path: "/tmp", Old: true},
+			},
+		},
+		{
+			"nested object and array element",
+			`{"address": {"city": "London"}, "tags": ["a", "b"]}`,
+			`{"address": {"city": "Paris"}, "tags": ["a", "c"]}`,
+			[]*models.ValueChange{
+				{Op: models.ChangeReplace, Path: "/address/city", Old: "London", New: "Paris"},
+				{Op: models.ChangeReplace, Path: "/tags/1", Old: "b", New: "c"},
+			},
+		},
+		{
+			"resized array replaced whole",
+			`{"tags": ["a"]}`,
+			`{"tags": ["a", "b"]}`,
+			[]*models.ValueChange{
+				{Op: models.ChangeReplace, Path: "/tags", Old: []interface{}{"a"}, New: []interface{}{"a", "b"}},
+			},
+		},
+		{
+			"type change and escaped keys",
+			`{"a/b": 1, "c~d": {"x": 1}}`,
+			`{"a/b": "1", "c~d": 2}`,
+			[]*models.ValueChange{
+				{Op: models.ChangeReplace, Path: "/a~1b", Old: float64(1), New: "1"},
+				{Op: models.ChangeReplace, Path: "/c~0d", Old: map[string]interface{}{"x": float64(1)}, New: float64(2)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := diffValues(decode(tt.from), decode(tt.to))
+			if !reflect.DeepEqual(changes, tt.expected) {
+				got, _ := json.Marshal(changes)
+				want, _ := json.Marshal(tt.expected)
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// digestBatchSize bounds the tasks read per query while building a digest
+const digestBatchSize = 500
+
+// maxErrorClassLength truncates error classes
+const maxErrorClassLength = 120
+
+var (
+	// quotedPattern and numberPattern match the parts of error messages
+	// that differ between otherwise identical failures
+	quotedPattern = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	numberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// DigestSender delivers failed task digests, e.g. to Slack or by email
+type DigestSender interface {
+	// Name identifies the target in logs and metrics
+	Name() string
+	Send(ctx context.Context, digest *models.FailedTaskDigest) error
+}
+
+// DigestConfig configures the failed task digest
+type DigestConfig struct {
+	// Interval is how often a digest is sent, none when no task failed
+	Interval time.Duration
+
+	// SampleSize is the number of task IDs listed per group
+	SampleSize int
+}
+
+// digester periodically sends a digest of the tasks that failed since the
+// last one it delivered
+type digester struct {
+	s       *Service
+	senders []DigestSender
+	cfg     DigestConfig
+
+	// mu serializes runs and guards the position of the last digest sent
+	mu      sync.Mutex
+	cursor  time.Time
+	afterID string
+
+	triggerCh chan struct{}
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	once      sync.Once
+}
+
+// StartFailedTaskDigest starts sending a digest of failed tasks to senders
+// every cfg.Interval, beginning with the tasks failing from now on
+func (s *Service) StartFailedTaskDigest(senders []DigestSender, cfg DigestConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("digest interval must be positive, got %v", cfg.Interval)
+	}
+	if cfg.SampleSize <= 0 {
+		return fmt.Errorf("digest sample size must be positive, got %d", cfg.SampleSize)
+	}
+	if len(senders) == 0 {
+		return errors.New("digest needs a target")
+	}
+
+	d := &digester{
+		s:         s,
+		senders:   senders,
+		cfg:       cfg,
+		cursor:    time.Now(),
+		triggerCh: make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+	}
+	s.digest = d
+
+	d.wg.Add(1)
+	go d.run()
+	return nil
+}
+
+// PendingDigest returns the digest of the tasks failed since the last one
+// sent, without sending it
+func (s *Service) PendingDigest(ctx context.Context) (*models.FailedTaskDigest, error) {
+	if s.digest == nil {
+		return nil, models.ErrDigestDisabled
+	}
+
+	d := s.digest
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	digest, _, _, err := d.build(ctx)
+	return digest, err
+}
+
+// TriggerDigest sends the pending digest now instead of at the next interval
+func (s *Service) TriggerDigest() error {
+	if s.digest == nil {
+		return models.ErrDigestDisabled
+	}
+
+	select {
+	case s.digest.triggerCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run sends a digest every interval and on triggers until stopped
+func (d *digester) run() {
+	defer d.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-d.stopCh
+		cancel()
+	}()
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+		case <-d.triggerCh:
+		}
+		d.send(ctx)
+	}
+}
+
+// send delivers the pending digest to every target. The position only
+// advances once all of them accepted it, so a target that was down gets the
+// failures at the next interval
+func (d *digester) send(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	digest, cursor, afterID, err := d.build(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Digest: failed to read failed tasks: %v", err)
+		}
+		return
+	}
+	if digest.Total == 0 {
+		d.cursor, d.afterID = cursor, afterID
+		return
+	}
+
+	delivered := true
+	for _, sender := range d.senders {
+		if err := sender.Send(ctx, digest); err != nil {
+			log.Printf("Digest: failed to send to %s: %v", sender.Name(), err)
+			d.s.metrics.RecordDigestSent(sender.Name(), false)
+			delivered = false
+			continue
+		}
+		d.s.metrics.RecordDigestSent(sender.Name(), true)
+	}
+	if !delivered {
+		return
+	}
+
+	log.Printf("Digest: sent %d failed tasks", digest.Total)
+	d.cursor, d.afterID = cursor, afterID
+}
+
+// build summarizes the tasks failed after the position of the last digest
+// and returns the position after them. The caller holds d.mu
+func (d *digester) build(ctx context.Context) (*models.FailedTaskDigest, time.Time, string, error) {
+	digest := &models.FailedTaskDigest{
+		From:        d.cursor,
+		To:          time.Now(),
+		ByOperation: make(map[string]int),
+		Groups:      []*models.FailedTaskGroup{},
+	}
+	groups := make(map[[2]string]*models.FailedTaskGroup)
+
+	cursor, afterID := d.cursor, d.afterID
+	for {
+		tasks, err := d.s.repo.Inbox.GetFinishedTasksAfter(ctx, cursor, afterID, digestBatchSize)
+		if err != nil {
+			return nil, time.Time{}, "", err
+		}
+
+		for _, task := range tasks {
+			if task.UpdatedAt.After(digest.To) {
+				// Failed while building, left for the next digest
+				tasks = nil
+				break
+			}
+			cursor, afterID = task.UpdatedAt, task.ID
+			if task.Status != models.TaskStatusFailed {
+				continue
+			}
+
+			digest.Total++
+			digest.ByOperation[task.Operation]++
+
+			class := errorClass(task.Error)
+			key := [2]string{task.Operation, class}
+			group, ok := groups[key]
+			if !ok {
+				group = &models.FailedTaskGroup{Operation: task.Operation, ErrorClass: class, SampleError: task.Error}
+				groups[key] = group
+				digest.Groups = append(digest.Groups, group)
+			}
+			group.Count++
+			if len(group.SampleIDs) < d.cfg.SampleSize {
+				group.SampleIDs = append(group.SampleIDs, task.ID)
+			}
+		}
+
+		if len(tasks) < digestBatchSize {
+			break
+		}
+	}
+
+	sort.SliceStable(digest.Groups, func(i, j int) bool { return digest.Groups[i].Count > digest.Groups[j].Count })
+	return digest, cursor, afterID, nil
+}
+
+// errorClass reduces an error message to its root cause with quoted values
+// and numbers masked, so failures differing only in IDs are counted together
+func errorClass(message string) string {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return "unknown"
+	}
+
+	message = quotedPattern.ReplaceAllString(message, `"…"`)
+	if i := strings.LastIndex(message, ": "); i >= 0 && i+2 < len(message) {
+		message = message[i+2:]
+	}
+	message = numberPattern.ReplaceAllString(message, "N")
+	if runes := []rune(message); len(runes) > maxErrorClassLength {
+		message = string(runes[:maxErrorClassLength]) + "…"
+	}
+	return message
+}
+
+// Stop stops the digest, failures not sent yet are not reported
+func (d *digester) Stop() {
+	d.once.Do(func() { close(d.stopCh) })
+	d.wg.Wait()
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// fakeDigestSender keeps the digests sent, failing while err is set
+type fakeDigestSender struct {
+	mu      sync.Mutex
+	err     error
+	digests []*models.FailedTaskDigest
+}
+
+func (f *fakeDigestSender) Name() string {
+	return "fake"
+}
+
+func (f *fakeDigestSender) Send(ctx context.Context, digest *models.FailedTaskDigest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		err := f.err
+		f.err = nil
+		return err
+	}
+	f.digests = append(f.digests, digest)
+	return nil
+}
+
+func (f *fakeDigestSender) sent() []*models.FailedTaskDigest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*models.FailedTaskDigest(nil), f.digests...)
+}
+
+// failTask creates a task that failed with message
+func failTask(t *testing.T, mock *repository.MockRepository, id, operation, message string) {
+	t.Helper()
+	finishTask(t, mock, id, operation, `{}`, models.TaskStatusPending)
+	if err := mock.UpdateTaskStatus(context.Background(), id, models.TaskStatusFailed, message); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+}
+
+func TestService_FailedTaskDigest(t *testing.T) {
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics())
+	defer svc.Close()
+
+	if _, err := svc.PendingDigest(context.Background()); !errors.Is(err, models.ErrDigestDisabled) {
+		t.Errorf("Expected ErrDigestDisabled, got %v", err)
+	}
+
+	// The first send fails, the failures are kept for the next one
+	sender := &fakeDigestSender{err: errors.New("webhook unavailable")}
+	if err := svc.StartFailedTaskDigest([]DigestSender{sender}, DigestConfig{Interval: time.Hour, SampleSize: 2}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	failTask(t, mock, "task_1", models.TaskOperationUpdate, `failed to update record "a": record not found`)
+	failTask(t, mock, "task_2", models.TaskOperationUpdate, `failed to update record "b": record not found`)
+	failTask(t, mock, "task_3", models.TaskOperationUpdate, `failed to update record "c": record not found`)
+	failTask(t, mock, "task_4", models.TaskOperationInsert, "connection reset after 30s")
+	finishTask(t, mock, "task_5", models.TaskOperationInsert, `{}`, models.TaskStatusCompleted)
+
+	digest, err := svc.PendingDigest(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if digest.Total != 4 || digest.ByOperation[models.TaskOperationUpdate] != 3 || len(digest.Groups) != 2 {
+		t.Fatalf("Expected 4 failures in 2 groups, got %+v", digest)
+	}
+	group := digest.Groups[0]
+	if group.ErrorClass != "record not found" || group.Count != 3 || len(group.SampleIDs) != 2 || group.SampleIDs[0] != "task_1" {
+		t.Errorf("Unexpected group %+v", group)
+	}
+	if class := digest.Groups[1].ErrorClass; class != "connection reset after Ns" {
+		t.Errorf("Expected the number masked, got %q", class)
+	}
+
+	svc.TriggerDigest()
+	waitFor(t, "the failed send", func() bool {
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+		return sender.err == nil
+	})
+	if len(sender.sent()) != 0 {
+		t.Fatal("Expected the first send to fail")
+	}
+
+	svc.TriggerDigest()
+	waitFor(t, "the digest", func() bool { return len(sender.sent()) == 1 })
+	if total := sender.sent()[0].Total; total != 4 {
+		t.Errorf("Expected the failures of the failed send, got %d", total)
+	}
+
+	// Only failures after the sent digest are pending
+	failTask(t, mock, "task_6", models.TaskOperationDelete, "record not found")
+	digest, err = svc.PendingDigest(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if digest.Total != 1 || digest.Groups[0].SampleIDs[0] != "task_6" {
+		t.Errorf("Expected only the new failure, got %+v", digest)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "unknown",
+		"record not found":                  "record not found",
+		`failed to insert record 'x': boom`: "boom",
+		`invalid value "a: b"`:              `invalid value "…"`,
+		"timeout after 1500ms on shard 3":   "timeout after Nms on shard N",
+	}
+	for message, expected := range tests {
+		if class := errorClass(message); class != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, message, class)
+		}
+	}
+}
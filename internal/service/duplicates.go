@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// maxDuplicateClusters bounds the clusters kept in a report, the largest
+// are kept
+const maxDuplicateClusters = 1000
+
+// StartDuplicateScan starts scanning all records for identical values in the
+// background and returns the running report. Only one scan runs at a time
+func (s *Service) StartDuplicateScan() (*models.DuplicateReport, error) {
+	report := &models.DuplicateReport{
+		Status:    models.ScanRunning,
+		StartedAt: time.Now(),
+		Clusters:  []*models.DuplicateCluster{},
+	}
+
+	err := s.duplicates.start(report, func(ctx context.Context) *models.DuplicateReport {
+		result := s.scanDuplicates(ctx, report.StartedAt)
+		if result.Error != "" {
+			log.Printf("Duplicate scan failed after %d records: %s", result.Scanned, result.Error)
+		} else {
+			log.Printf("Duplicate scan finished: %d records scanned, %d duplicates in %d clusters",
+				result.Scanned, result.Duplicates, len(result.Clusters))
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// DuplicateReport returns the running or last finished duplicate scan, nil
+// when none was started
+func (s *Service) DuplicateReport() *models.DuplicateReport {
+	return s.duplicates.last()
+}
+
+// scanDuplicates groups all records by value hash. Only the first ID of
+// every hash is kept in memory until a second record with the same hash
+// turns up
+func (s *Service) scanDuplicates(ctx context.Context, startedAt time.Time) *models.DuplicateReport {
+	report := &models.DuplicateReport{
+		Status:    models.ScanCompleted,
+		StartedAt: startedAt,
+		Clusters:  []*models.DuplicateCluster{},
+	}
+	defer func() {
+		now := time.Now()
+		report.FinishedAt = &now
+	}()
+
+	first := make(map[string]string)
+	clusters := make(map[string][]string)
+
+	err := s.scanRecords(ctx, func(record *models.Record) {
+		hash, err := models.ValueHash(record.Value)
+		if err != nil {
+			return
+		}
+		report.Scanned++
+
+		firstID, seen := first[hash]
+		if !seen {
+			first[hash] = record.ID
+			return
+		}
+		if len(clusters[hash]) == 0 {
+			clusters[hash] = []string{firstID}
+		}
+		clusters[hash] = append(clusters[hash], record.ID)
+		report.Duplicates++
+	})
+	if err != nil {
+		report.Status = models.ScanFailed
+		report.Error = fmt.Sprintf("failed to list records: %v", err)
+		return report
+	}
+
+	for hash, ids := range clusters {
+		report.Clusters = append(report.Clusters, &models.DuplicateCluster{Hash: hash, Count: len(ids), IDs: ids})
+	}
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		a, b := report.Clusters[i], report.Clusters[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.IDs[0] < b.IDs[0]
+	})
+	if len(report.Clusters) > maxDuplicateClusters {
+		report.Clusters = report.Clusters[:maxDuplicateClusters]
+		report.Truncated = true
+	}
+
+	return report
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_DuplicateScan(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	ctx := context.Background()
+
+	values := map[string]map[string]interface{}{
+		"legacy_1": {"name": "Ada", "age": 36},
+		"legacy_2": {"age": 36, "name": "Ada"},
+		"legacy_3": {"name": "Ada", "age": 36},
+		"new_1":    {"sku": "X-1"},
+		"new_2":    {"sku": "X-1"},
+		"unique":   {"sku": "X-2"},
+	}
+	for id, value := range values {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(value)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	svc := NewService(repo, metrics.NewMetrics())
+	defer svc.Close()
+
+	if report := svc.DuplicateReport(); report != nil {
+		t.Fatalf("Expected no report before the first scan, got %+v", report)
+	}
+
+	report, err := svc.StartDuplicateScan()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Status != models.ScanRunning {
+		t.Errorf("Expected a running scan, got %s", report.Status)
+	}
+	if _, err := svc.StartDuplicateScan(); err != nil && !errors.Is(err, models.ErrScanRunning) {
+		t.Errorf("Expected ErrScanRunning for a second scan, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for report.Status == models.ScanRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the duplicate scan")
+		}
+		time.Sleep(10 * time.Millisecond)
+		report = svc.DuplicateReport()
+	}
+
+	if report.Status != models.ScanCompleted || report.FinishedAt == nil {
+		t.Fatalf("Expected a completed scan, got %+v", report)
+	}
+	if report.Scanned != len(values) || report.Duplicates != 3 {
+		t.Errorf("Expected %d scanned and 3 duplicates, got %d and %d", len(values), report.Scanned, report.Duplicates)
+	}
+
+	var clusters [][]string
+	for _, cluster := range report.Clusters {
+		clusters = append(clusters, cluster.IDs)
+	}
+	expected := [][]string{{"legacy_1", "legacy_2", "legacy_3"}, {"new_1", "new_2"}}
+	if !reflect.DeepEqual(clusters, expected) {
+		t.Errorf("Expected clusters %v, got %v", expected, clusters)
+	}
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+)
+
+// maxEnrichmentResponse bounds the enrichment response body
+const maxEnrichmentResponse = 1 << 20
+
+// errCircuitOpen is returned while the enrichment circuit breaker is open
+var errCircuitOpen = errors.New("enrichment circuit breaker is open")
+
+// EnrichmentConfig configures the external HTTP enrichment step
+type EnrichmentConfig struct {
+	URL        string
+	Operations []string // task operations to enrich
+	Timeout    time.Duration
+	Retries    int
+	RetryDelay time.Duration
+
+	// The circuit opens after FailureThreshold consecutive failures and lets
+	// a single trial call through after OpenDuration
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	// FailOpen persists values unenriched while the service is unavailable
+	// instead of retrying the task
+	FailOpen bool
+}
+
+// enrichmentRequest is sent to the enrichment service
+type enrichmentRequest struct {
+	Operation string                 `json:"operation"`
+	ID        string                 `json:"id"`
+	Value     map[string]interface{} `json:"value"`
+}
+
+// Enricher augments task values by calling an external HTTP service before
+// they are persisted. The service answers with a JSON object whose fields
+// are merged into the value
+type Enricher struct {
+	cfg        EnrichmentConfig
+	client     *http.Client
+	metrics    *metrics.Metrics
+	breaker    *circuitBreaker
+	operations map[string]bool
+}
+
+// NewEnricher creates an enricher for the configured operations
+func NewEnricher(cfg EnrichmentConfig, metrics *metrics.Metrics) *Enricher {
+	operations := make(map[string]bool, len(cfg.Operations))
+	for _, op := range cfg.Operations {
+		if op = strings.TrimSpace(op); op != "" {
+			operations[op] = true
+		}
+	}
+
+	return &Enricher{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		metrics:    metrics,
+		breaker:    newCircuitBreaker(cfg.FailureThreshold, cfg.OpenDuration),
+		operations: operations,
+	}
+}
+
+// Enabled reports whether tasks of operation are enriched
+func (e *Enricher) Enabled(operation string) bool {
+	return e.operations[operation]
+}
+
+// EnrichPayload enriches the "value" object of a task payload, returning the
+// payload unchanged when it has none
+func (e *Enricher) EnrichPayload(ctx context.Context, operation string, payload json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload, nil
+	}
+
+	var value map[string]interface{}
+	if err := models.UnmarshalValue(fields["value"], &value); err != nil || value == nil {
+		return payload, nil
+	}
+	var id string
+	_ = json.Unmarshal(fields["id"], &id)
+
+	if err := e.Enrich(ctx, operation, id, value); err != nil {
+		if e.cfg.FailOpen && !errors.Is(err, context.Canceled) {
+			taskTraceFromContext(ctx).decide(models.TaskDecisionUnenriched, "Enrichment of %s %s failed, persisting unenriched: %v", operation, id, err)
+			return payload, nil
+		}
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal enriched value: %w", err)
+	}
+	fields["value"] = encoded
+
+	return json.Marshal(fields)
+}
+
+// Enrich calls the enrichment service and merges its answer into value,
+// retrying failed calls while the circuit stays closed
+func (e *Enricher) Enrich(ctx context.Context, operation, id string, value map[string]interface{}) error {
+	var lastErr error
+	for attempt := 0; attempt <= e.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(e.cfg.RetryDelay):
+			}
+		}
+
+		if !e.breaker.allow() {
+			e.metrics.RecordEnrichment("circuit_open")
+			return errCircuitOpen
+		}
+
+		fields, err := e.call(ctx, operation, id, value)
+		e.metrics.SetEnrichmentCircuitOpen(e.breaker.record(err == nil))
+		if err == nil {
+			e.metrics.RecordEnrichment("success")
+			for k, v := range fields {
+				value[k] = v
+			}
+			return nil
+		}
+
+		e.metrics.RecordEnrichment("error")
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lastErr = err
+	}
+
+	return fmt.Errorf("enrichment failed after %d attempts: %w", e.cfg.Retries+1, lastErr)
+}
+
+// call performs one enrichment request
+func (e *Enricher) call(ctx context.Context, operation, id string, value map[string]interface{}) (map[string]interface{}, error) {
+	body, err := json.Marshal(&enrichmentRequest{Operation: operation, ID: id, Value: value})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal enrichment request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create enrichment request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrichment service returned %s", resp.Status)
+	}
+
+	// Numbers stay json.Number, so large integers are merged unrounded
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxEnrichmentResponse))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("invalid enrichment response: %w", err)
+	}
+	return fields, nil
+}
+
+// circuitBreaker stops calls to a failing dependency. After threshold
+// consecutive failures it opens for openFor, then lets one trial call through
+// (half-open) whose outcome closes or reopens it
+type circuitBreaker struct {
+	threshold int
+	openFor   time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// newCircuitBreaker creates a breaker, a threshold below one disables it
+func newCircuitBreaker(threshold int, openFor time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, openFor: openFor}
+}
+
+// allow reports whether a call may proceed
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold < 1 || b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record records a call outcome and reports whether the circuit is open
+func (b *circuitBreaker) record(success bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return false
+	}
+
+	b.failures++
+	if b.threshold < 1 || b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = time.Now().Add(b.openFor)
+	return true
+}
+
+// WithEnricher enriches the values of tasks whose operation is enabled on e
+// before they are persisted
+func WithEnricher(e *Enricher) WorkerOption {
+	return func(w *InboxWorker) {
+		w.enricher = e
+	}
+}
+
+// enrichTask enriches the task payload in place. It runs in the transform
+// stage, before the transaction applying the task, so no database
+// transaction waits on HTTP
+func (w *InboxWorker) enrichTask(ctx context.Context, task *models.InboxTask) error {
+	if w.enricher == nil || !w.enricher.Enabled(task.Operation) {
+		return nil
+	}
+
+	payload, err := w.enricher.EnrichPayload(ctx, task.Operation, task.Payload)
+	if err != nil {
+		return err
+	}
+	if err := w.validateEnriched(ctx, task.Operation, payload); err != nil {
+		return err
+	}
+	task.Payload = payload
+	return nil
+}
+
+// validateEnriched validates an enriched value against the schema of its
+// record type again, since the enrichment fields are merged after the value
+// was validated when the task was queued. The type is the one of the insert,
+// or of the stored record for other operations
+func (w *InboxWorker) validateEnriched(ctx context.Context, operation string, payload json.RawMessage) error {
+	if w.schemas == nil {
+		return nil
+	}
+
+	var fields struct {
+		ID    string          `json:"id"`
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(payload, &fields); err != nil || len(fields.Value) == 0 {
+		return nil
+	}
+
+	recordType := fields.Type
+	if recordType == "" && operation != models.TaskOperationInsert {
+		hasTypes, err := w.schemas.hasTypes(ctx)
+		if err != nil || !hasTypes {
+			return err
+		}
+		record, err := w.repo.Record.Get(ctx, fields.ID)
+		if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+			return fmt.Errorf("failed to load record type: %w", err)
+		}
+		if record != nil {
+			recordType = record.Type
+		}
+	}
+	if recordType == "" {
+		return nil
+	}
+
+	var value interface{}
+	if err := models.UnmarshalValue(fields.Value, &value); err != nil {
+		return fmt.Errorf("failed to decode enriched value: %w", err)
+	}
+	if err := w.schemas.validate(ctx, recordType, value); err != nil {
+		return fmt.Errorf("enriched value rejected: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestEnricher_EnrichPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req enrichmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"country": "DE", "source": req.Operation})
+	}))
+	defer server.Close()
+
+	enricher := NewEnricher(EnrichmentConfig{
+		URL:        server.URL,
+		Operations: []string{"insert"},
+		Timeout:    time.Second,
+	}, metrics.NewMetrics())
+
+	if !enricher.Enabled("insert") || enricher.Enabled("update") {
+		t.Fatal("Expected enrichment for insert only")
+	}
+
+	payload, err := enricher.EnrichPayload(context.Background(), "insert", []byte(`{"id":"a","value":{"name":"x"}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var decoded struct {
+		ID    string                 `json:"id"`
+		Value map[string]interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("Invalid payload: %v", err)
+	}
+	if decoded.ID != "a" || decoded.Value["name"] != "x" || decoded.Value["country"] != "DE" || decoded.Value["source"] != "insert" {
+		t.Errorf("Unexpected enriched payload: %s", payload)
+	}
+}
+
+func TestEnricher_NumberPrecision(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"score": 12345678901234567891}`))
+	}))
+	defer server.Close()
+
+	enricher := NewEnricher(EnrichmentConfig{
+		URL:        server.URL,
+		Operations: []string{"insert"},
+		Timeout:    time.Second,
+	}, metrics.NewMetrics())
+
+	payload, err := enricher.EnrichPayload(context.Background(), "insert", []byte(`{"id":"a","value":{"balance":12345678901234567890}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := `{"id":"a","value":{"balance":12345678901234567890,"score":12345678901234567891}}`; string(payload) != expected {
+		t.Errorf("Expected %s, got %s", expected, payload)
+	}
+}
+
+func TestEnricher_CircuitBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	enricher := NewEnricher(EnrichmentConfig{
+		URL:              server.URL,
+		Operations:       []string{"insert"},
+		Timeout:          time.Second,
+		Retries:          1,
+		FailureThreshold: 2,
+		OpenDuration:     time.Hour,
+	}, metrics.NewMetrics())
+
+	ctx := context.Background()
+	if err := enricher.Enrich(ctx, "insert", "a", map[string]interface{}{}); err == nil || errors.Is(err, errCircuitOpen) {
+		t.Fatalf("Expected enrichment failure, got %v", err)
+	}
+	if err := enricher.Enrich(ctx, "insert", "a", map[string]interface{}{}); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("Expected open circuit, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected 2 calls before the circuit opened, got %d", n)
+	}
+
+	enricher.cfg.FailOpen = true
+	payload := []byte(`{"id":"a","value":{"name":"x"}}`)
+	enriched, err := enricher.EnrichPayload(ctx, "insert", payload)
+	if err != nil || string(enriched) != string(payload) {
+		t.Errorf("Expected unenriched payload with fail-open, got %s, %v", enriched, err)
+	}
+}
+
+func TestService_EnrichmentSchemaValidation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"age": "unknown"}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics())
+	defer svc.Close()
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"age": map[string]interface{}{"type": "integer"}},
+	}
+	if err := svc.PutRecordType(ctx, &models.RecordType{Name: "user", Schema: schema}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	enricher := NewEnricher(EnrichmentConfig{URL: server.URL, Operations: []string{"insert"}, Timeout: time.Second}, metrics.NewMetrics())
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 3, time.Hour, WithEnricher(enricher))
+
+	task, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_1", Type: "user", Value: models.MustEncodeValue(map[string]interface{}{"age": json.Number("30")})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The value passed validation when queued, the enriched one fails it
+	// without waiting for the hour-long retry delay
+	waitFor(t, "the task failed", func() bool {
+		stored, _ := mock.GetTask(ctx, task.ID)
+		return stored.Status == models.TaskStatusFailed
+	})
+	stored, _ := mock.GetTask(ctx, task.ID)
+	if !strings.Contains(stored.Error, "enriched value rejected") {
+		t.Errorf("Expected the task failed by the schema, got %+v", stored)
+	}
+	if _, err := mock.Get(ctx, "user_1"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected the record not persisted, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"mit-service/internal/models"
+)
+
+// RecordHistory returns a page of the writes of a record, oldest first.
+// Records without any write kept are not found, deleted records keep their
+// history
+func (s *Service) RecordHistory(ctx context.Context, id string, limit, offset int) (*models.RecordHistoryPage, error) {
+	if s.repo.History == nil {
+		return nil, models.ErrHistoryUnsupported
+	}
+
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := s.repo.History.RecordHistory(ctx, scoped(ctx, id), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get record history: %w", err)
+	}
+	for _, entry := range entries {
+		entry.ID = unscoped(ctx, entry.ID)
+	}
+	if len(entries) == 0 && offset == 0 {
+		return nil, fmt.Errorf("history of record '%s': %w", id, models.ErrRecordNotFound)
+	}
+
+	return &models.RecordHistoryPage{ID: id, Entries: entries, Limit: limit, Offset: offset}, nil
+}
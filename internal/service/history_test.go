@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_RecordHistory(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock, History: mock}, metrics.NewMetrics())
+	defer svc.Close()
+
+	write := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	write(mock.Insert(ctx, &models.Record{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})}))
+	write(mock.Update(ctx, &models.Record{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada Lovelace"})}))
+	write(mock.Delete(ctx, "user_1"))
+
+	page, err := svc.RecordHistory(ctx, "user_1", 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	operations := []string{models.HistoryInsert, models.HistoryUpdate, models.HistoryDelete}
+	if len(page.Entries) != len(operations) {
+		t.Fatalf("Expected %d entries, got %d", len(operations), len(page.Entries))
+	}
+	for i, operation := range operations {
+		if page.Entries[i].Operation != operation {
+			t.Errorf("Expected entry %d to be a %s, got %s", i, operation, page.Entries[i].Operation)
+		}
+	}
+	if page.Entries[2].Version != 2 || valueField(page.Entries[2].Record(), "name") != "Ada Lovelace" {
+		t.Errorf("Expected the delete to keep the last value, got %+v", page.Entries[2])
+	}
+
+	if page, _ := svc.RecordHistory(ctx, "user_1", 1, 1); len(page.Entries) != 1 || page.Entries[0].Operation != models.HistoryUpdate {
+		t.Errorf("Expected the second page to hold the update, got %+v", page.Entries)
+	}
+	if _, err := svc.RecordHistory(ctx, "user_2", 10, 0); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound for a record without history, got %v", err)
+	}
+
+	// Diffs read the versions from the history, deleted records included
+	diff, err := svc.DiffRecord(ctx, "user_1", 1, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(diff.Changes) != 1 || diff.Changes[0].Path != "/name" || diff.Changes[0].New != "Ada Lovelace" {
+		t.Errorf("Expected the name replaced, got %+v", diff.Changes)
+	}
+	if _, err := svc.DiffRecord(ctx, "user_1", 1, 3); !errors.Is(err, models.ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+
+	// Without a history store both fail as unsupported
+	plain, _ := newMockService()
+	defer plain.Close()
+	if _, err := plain.RecordHistory(ctx, "user_1", 10, 0); !errors.Is(err, models.ErrHistoryUnsupported) {
+		t.Errorf("Expected ErrHistoryUnsupported, got %v", err)
+	}
+	if _, err := plain.DiffRecord(ctx, "user_1", 1, 2); !errors.Is(err, models.ErrHistoryUnsupported) {
+		t.Errorf("Expected ErrHistoryUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mit-service/internal/models"
+)
+
+// IDStrategy generates the IDs of records inserted without one
+type IDStrategy func() (string, error)
+
+// ParseIDStrategy returns the strategy named name: "uuidv7" or "ulid", both
+// sorting by creation time, or nil for "none" and ""
+func ParseIDStrategy(name string) (IDStrategy, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return nil, nil
+	case "uuidv7":
+		return newUUIDv7, nil
+	case "ulid":
+		return newULID, nil
+	default:
+		return nil, fmt.Errorf("unknown ID strategy %q, expected none, uuidv7 or ulid", name)
+	}
+}
+
+// WithIDStrategy generates the IDs of records inserted without one with
+// strategy; without it inserts need an ID
+func WithIDStrategy(strategy IDStrategy) Option {
+	return func(s *Service) {
+		s.idStrategy = strategy
+	}
+}
+
+// assignID sets the ID of an insert without one, failing with
+// models.ErrIDRequired when IDs are not generated
+func (s *Service) assignID(req *models.InsertRequest) error {
+	if req.ID != "" {
+		return nil
+	}
+	if s.idStrategy == nil {
+		return models.ErrIDRequired
+	}
+
+	id, err := s.idStrategy()
+	if err != nil {
+		return fmt.Errorf("failed to generate record ID: %w", err)
+	}
+	req.ID = id
+	return nil
+}
+
+func newUUIDv7() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// crockford is the base32 alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: a 48-bit millisecond timestamp and 80 random
+// bits in 26 base32 characters. IDs of the same millisecond do not sort
+// in creation order
+func newULID() (string, error) {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
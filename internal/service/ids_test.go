@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestParseIDStrategy(t *testing.T) {
+	for _, name := range []string{"", "none", " NONE "} {
+		if strategy, err := ParseIDStrategy(name); err != nil || strategy != nil {
+			t.Errorf("Expected no strategy for %q, got %v", name, err)
+		}
+	}
+	if _, err := ParseIDStrategy("uuidv4"); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+
+	uuidv7, _ := ParseIDStrategy("uuidv7")
+	id, err := uuidv7()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parsed, err := uuid.Parse(id); err != nil || parsed.Version() != 7 {
+		t.Errorf("Expected a UUIDv7, got %s", id)
+	}
+
+	ulid, _ := ParseIDStrategy("ulid")
+	first, _ := ulid()
+	time.Sleep(2 * time.Millisecond)
+	second, _ := ulid()
+	if !regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`).MatchString(first) {
+		t.Errorf("Expected a ULID, got %s", first)
+	}
+	if first >= second {
+		t.Errorf("Expected ULIDs sorting by time, got %s before %s", first, second)
+	}
+}
+
+func TestService_GeneratedIDs(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	if _, err := svc.Insert(ctx, &models.InsertRequest{Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})}); !errors.Is(err, models.ErrIDRequired) {
+		t.Errorf("Expected an ID required without strategy, got %v", err)
+	}
+
+	mock := repository.NewMockRepository()
+	svc = NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithIDStrategy(newULID))
+	defer svc.Close()
+
+	req := &models.InsertRequest{Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})}
+	task, err := svc.Insert(WithSandbox(ctx, "acme"), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(req.ID) != 26 {
+		t.Fatalf("Expected a generated ID set on the request, got %q", req.ID)
+	}
+	var payload models.InsertTaskPayload
+	json.Unmarshal(task.Payload, &payload)
+	if payload.ID != req.ID {
+		t.Errorf("Expected the generated ID in the task payload as the sandbox knows it, got %q", payload.ID)
+	}
+
+	reqs := []*models.InsertRequest{{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})}, {Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})}}
+	if _, err := svc.InsertBatch(ctx, reqs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reqs[0].ID != "user_1" || len(reqs[1].ID) != 26 || strings.HasPrefix(reqs[1].ID, SandboxRecordPrefix) {
+		t.Errorf("Expected only the record without ID to get one, got %q and %q", reqs[0].ID, reqs[1].ID)
+	}
+}
+
+func TestService_ClientTaskIDs(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	task, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"}), TaskID: "import-42"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.ID != "import-42" {
+		t.Errorf("Expected the task queued under the client's ID, got %q", task.ID)
+	}
+	if _, err := svc.Update(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"k": "w"}), TaskID: "import-42"}); !errors.Is(err, models.ErrTaskExists) {
+		t.Errorf("Expected a reused task ID rejected, got %v", err)
+	}
+	if _, err := svc.Delete(ctx, &models.DeleteRequest{ID: "user_1", TaskID: " import-43"}); !errors.Is(err, models.ErrInvalidTaskID) {
+		t.Errorf("Expected a task ID with surrounding spaces rejected, got %v", err)
+	}
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_2", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"}), TaskID: strings.Repeat("x", maxTaskIDLength+1)}); !errors.Is(err, models.ErrInvalidTaskID) {
+		t.Errorf("Expected a too long task ID rejected, got %v", err)
+	}
+
+	reqs := []*models.InsertRequest{
+		{ID: "user_2", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"}), TaskID: "import-44"},
+		{ID: "user_3", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"}), TaskID: "import-44"},
+	}
+	if _, err := svc.InsertBatch(ctx, reqs); !errors.Is(err, models.ErrTaskExists) {
+		t.Errorf("Expected a task ID repeated in the batch rejected, got %v", err)
+	}
+	if _, err := svc.GetTask(ctx, "import-44"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected nothing of the rejected batch queued, got %v", err)
+	}
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_2", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"}), TaskID: "_system/tenants/acme/import-42"}); !errors.Is(err, models.ErrInvalidTaskID) {
+		t.Errorf("Expected a task ID in the system namespace rejected, got %v", err)
+	}
+
+	// Task IDs are namespaced by keyspace
+	acme := WithTenant(ctx, "acme")
+	task, err = svc.Insert(acme, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"}), TaskID: "import-42"})
+	if err != nil {
+		t.Fatalf("Expected the task ID of another keyspace free, got %v", err)
+	}
+	if task.ID != "import-42" {
+		t.Errorf("Expected the task returned under the client's ID, got %q", task.ID)
+	}
+	if got, err := svc.GetTask(acme, "import-42"); err != nil || got.TenantID != "acme" {
+		t.Errorf("Expected the task of acme, got %+v, %v", got, err)
+	}
+	if got, err := svc.GetTask(ctx, "import-42"); err != nil || got.TenantID != "" {
+		t.Errorf("Expected the task outside the tenants, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// Export page sizes
+const (
+	defaultExportLimit = 1000
+	maxExportLimit     = 10000
+)
+
+// maxImportErrors bounds the failed records listed in an import result
+const maxImportErrors = 100
+
+// cloneRequestTimeout bounds each export request sent to a clone source
+const cloneRequestTimeout = 30 * time.Second
+
+// ExportRecords returns a page of records in ID order. Pass the returned
+// NextAfterID as filter.AfterID to read the next page
+func (s *Service) ExportRecords(ctx context.Context, filter models.RecordFilter) (*models.ExportPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultExportLimit
+	}
+	filter.Limit = min(filter.Limit, maxExportLimit)
+	filter.Offset = 0
+
+	records, err := s.repo.Record.ListRecords(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+	if records == nil {
+		records = []*models.Record{}
+	}
+
+	page := &models.ExportPage{Records: records}
+	if len(records) == filter.Limit {
+		page.NextAfterID = records[len(records)-1].ID
+	}
+	return page, nil
+}
+
+// ImportRecords writes the records directly to the repository. Records that
+// already exist with the same value are left alone, ones with a different
+// value are replaced only with req.Overwrite. A record that cannot be written
+// is reported in the result without failing the others
+func (s *Service) ImportRecords(ctx context.Context, req *models.ImportRequest) (*models.ImportResult, error) {
+	result := &models.ImportResult{DryRun: req.DryRun}
+	for _, record := range req.Records {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		s.importRecord(ctx, record, req, result)
+	}
+	return result, nil
+}
+
+// importRecord imports one record and counts the outcome
+func (s *Service) importRecord(ctx context.Context, record *models.Record, req *models.ImportRequest, result *models.ImportResult) {
+	fail := func(id string, err error) {
+		result.Failed++
+		if len(result.Errors) < maxImportErrors {
+			result.Errors = append(result.Errors, &models.ImportError{ID: id, Error: err.Error()})
+		}
+	}
+
+	if record == nil || strings.TrimSpace(record.ID) == "" {
+		fail("", errors.New("ID cannot be empty"))
+		return
+	}
+	if len(record.Value) == 0 {
+		fail(record.ID, errors.New("value cannot be empty"))
+		return
+	}
+
+	// The stored hash is recomputed rather than trusted
+	copied := *record
+	copied.Hash = ""
+	record = &copied
+
+	existing, err := s.repo.Record.Get(ctx, record.ID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		fail(record.ID, err)
+		return
+	}
+
+	switch {
+	case existing == nil:
+		if !req.DryRun {
+			if err := s.repo.Record.Insert(ctx, record); err != nil {
+				fail(record.ID, err)
+				return
+			}
+		}
+		result.Created++
+	case sameRecord(existing, record):
+		result.Unchanged++
+	case !req.Overwrite:
+		result.Skipped++
+	default:
+		if !req.DryRun {
+			if err := s.repo.Record.Update(ctx, record); err != nil {
+				fail(record.ID, err)
+				return
+			}
+		}
+		result.Updated++
+	}
+}
+
+// StartClone starts copying the records of another instance into this one in
+// the background, reading them page by page from the source's
+// /admin/export endpoint. Only one clone runs at a time
+func (s *Service) StartClone(req *models.CloneRequest) (*models.CloneReport, error) {
+	report := &models.CloneReport{
+		Status:       models.ScanRunning,
+		SourceURL:    req.SourceURL,
+		StartedAt:    time.Now(),
+		ImportResult: models.ImportResult{DryRun: req.DryRun},
+	}
+
+	err := s.clones.start(report, func(ctx context.Context) *models.CloneReport {
+		result := *report
+		defer func() {
+			now := time.Now()
+			result.FinishedAt = &now
+		}()
+
+		if err := s.clone(ctx, req, &result); err != nil {
+			result.Status = models.ScanFailed
+			result.Error = err.Error()
+			log.Printf("Clone from %s failed after %d records: %v", req.SourceURL, result.Fetched, err)
+			return &result
+		}
+
+		result.Status = models.ScanCompleted
+		log.Printf("Clone from %s completed: %d fetched, %d created, %d updated, %d skipped, %d failed (dry run: %t)",
+			req.SourceURL, result.Fetched, result.Created, result.Updated, result.Skipped, result.Failed, req.DryRun)
+		return &result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// CloneReport returns the running or last finished clone, nil when none was
+// started
+func (s *Service) CloneReport() *models.CloneReport {
+	return s.clones.last()
+}
+
+// clone pages through the source's export and imports every page
+func (s *Service) clone(ctx context.Context, req *models.CloneRequest, report *models.CloneReport) error {
+	client := &http.Client{Timeout: cloneRequestTimeout}
+	importReq := &models.ImportRequest{Overwrite: req.Overwrite, DryRun: req.DryRun}
+
+	afterID := ""
+	for {
+		page, err := fetchExportPage(ctx, client, req, afterID)
+		if err != nil {
+			return err
+		}
+		report.Pages++
+		report.Fetched += len(page.Records)
+
+		for _, record := range page.Records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			s.importRecord(ctx, record, importReq, &report.ImportResult)
+		}
+
+		if page.NextAfterID == "" {
+			return nil
+		}
+		afterID = page.NextAfterID
+	}
+}
+
+// fetchExportPage reads the export page after afterID from the clone source
+func fetchExportPage(ctx context.Context, client *http.Client, req *models.CloneRequest, afterID string) (*models.ExportPage, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(defaultExportLimit))
+	if req.Prefix != "" {
+		query.Set("prefix", req.Prefix)
+	}
+	if req.ExcludePrefix != "" {
+		query.Set("exclude_prefix", req.ExcludePrefix)
+	}
+	if afterID != "" {
+		query.Set("after_id", afterID)
+	}
+	endpoint := strings.TrimRight(req.SourceURL, "/") + "/admin/export?" + query.Encode()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL: %w", err)
+	}
+	if req.SourceToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+req.SourceToken)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export from source: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("source export returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var page models.ExportPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("invalid export page from source: %w", err)
+	}
+	return &page, nil
+}
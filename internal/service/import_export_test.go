@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func newMockService() (*Service, *repository.MockRepository) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	return NewService(repo, metrics.NewMetrics()), mock
+}
+
+// valueField returns a member of the object value of a record, nil when the
+// value is not an object
+func valueField(record *models.Record, key string) interface{} {
+	var value map[string]interface{}
+	record.DecodeValue(&value)
+	return value[key]
+}
+
+func TestService_ImportRecords(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	for id, value := range map[string]string{"same": "v", "changed": "old"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(value)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	records := []*models.Record{
+		{ID: "new", Value: models.MustEncodeValue("v")},
+		{ID: "same", Value: models.MustEncodeValue("v"), Hash: "forged"},
+		{ID: "changed", Value: models.MustEncodeValue("new")},
+		{ID: " ", Value: models.MustEncodeValue("v")},
+	}
+
+	tests := []struct {
+		name      string
+		overwrite bool
+		dryRun    bool
+		expected  models.ImportResult
+		changed   interface{}
+	}{
+		{"dry run", true, true, models.ImportResult{DryRun: true, Created: 1, Updated: 1, Unchanged: 1, Failed: 1}, "old"},
+		{"keep existing", false, false, models.ImportResult{Created: 1, Unchanged: 1, Skipped: 1, Failed: 1}, "old"},
+		{"overwrite", true, false, models.ImportResult{Unchanged: 2, Updated: 1, Failed: 1}, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := svc.ImportRecords(ctx, &models.ImportRequest{
+				Records:   records,
+				Overwrite: tt.overwrite,
+				DryRun:    tt.dryRun,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(result.Errors) != 1 {
+				t.Errorf("Expected 1 import error, got %v", result.Errors)
+			}
+			result.Errors = nil
+			if !reflect.DeepEqual(*result, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *result)
+			}
+
+			record, err := mock.Get(ctx, "changed")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if value, _ := record.DecodedValue(); value != tt.changed {
+				t.Errorf("Expected changed record value %v, got %s", tt.changed, record.Value)
+			}
+		})
+	}
+}
+
+func TestService_Clone(t *testing.T) {
+	ctx := context.Background()
+	source, sourceMock := newMockService()
+	defer source.Close()
+
+	for i := 0; i < 2500; i++ {
+		id := "user_" + strconv.Itoa(i)
+		if err := sourceMock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"n": i})}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := sourceMock.Insert(ctx, &models.Record{ID: "order_1", Value: models.MustEncodeValue("o")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The source serves its export the way the admin endpoint does
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		page, err := source.ExportRecords(r.Context(), models.RecordFilter{
+			Prefix:  query.Get("prefix"),
+			AfterID: query.Get("after_id"),
+			Limit:   limit,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	if report := svc.CloneReport(); report != nil {
+		t.Fatalf("Expected no report before the first clone, got %+v", report)
+	}
+
+	report, err := svc.StartClone(&models.CloneRequest{SourceURL: server.URL, SourceToken: "secret", Prefix: "user_"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.StartClone(&models.CloneRequest{SourceURL: server.URL}); err != nil && !errors.Is(err, models.ErrScanRunning) {
+		t.Errorf("Expected ErrScanRunning for a second clone, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for report.Status == models.ScanRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the clone")
+		}
+		time.Sleep(10 * time.Millisecond)
+		report = svc.CloneReport()
+	}
+
+	if report.Status != models.ScanCompleted || report.Pages != 3 || report.Fetched != 2500 || report.Created != 2500 {
+		t.Fatalf("Expected 2500 records cloned in 3 pages, got %+v", report)
+	}
+	if _, err := mock.Get(ctx, "order_1"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected records outside the prefix to be filtered, got %v", err)
+	}
+
+	// Without the token the clone fails with the source's answer
+	if report, err = svc.StartClone(&models.CloneRequest{SourceURL: server.URL}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for report.Status == models.ScanRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the clone")
+		}
+		time.Sleep(10 * time.Millisecond)
+		report = svc.CloneReport()
+	}
+	if report.Status != models.ScanFailed || !strings.Contains(report.Error, "401") {
+		t.Errorf("Expected a failed clone without the token, got %+v", report)
+	}
+}
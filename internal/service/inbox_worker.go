@@ -3,13 +3,17 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"mit-service/internal/metrics"
 	"mit-service/internal/models"
 	"mit-service/internal/repository"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
 // InboxWorker processes tasks from the inbox using worker pattern
@@ -21,10 +25,75 @@ type InboxWorker struct {
 	pollInterval time.Duration
 	maxRetries   int
 	retryDelay   time.Duration
+	sizer        *batchSizer
+	concurrency  int
+	throttler    *throttler
+	operations   *OperationRegistry
+	enricher     *Enricher
+	schemas      *schemaRegistry // validates enriched values, see validateEnriched
+	middleware   []TaskMiddleware
+	writes       []TaskMiddleware
+	tracing      bool // record a trace of each task attempt, see WithTaskTracing
+	pipeline     TaskStep
+	heartbeats   []int64 // per worker goroutine, unix nanoseconds of the last poll
+	lastSuccess  int64   // unix nanoseconds of the last successful task
+	busy         []int64 // per worker goroutine, nanoseconds spent processing finished batches
+	busySince    []int64 // per worker goroutine, unix nanoseconds the running batch started, 0 when idle
 	stopCh       chan struct{}
 	wg           sync.WaitGroup
 	running      bool
 	mu           sync.RWMutex
+
+	// gate is held for reading while a batch is processed, Pause holds it
+	// for writing
+	gate sync.RWMutex
+
+	// dependencyTimeout fails tasks still hitting an unavailable dependency
+	// this long after they were queued, 0 retries them indefinitely
+	dependencyTimeout time.Duration
+
+	// coalescePrefixes are the record ID prefixes whose updates are
+	// coalesced, coalesced holds the updates superseded by each task ID
+	coalescePrefixes []string
+	coalesced        sync.Map
+}
+
+// WorkerOption configures optional inbox worker behaviour
+type WorkerOption func(*InboxWorker)
+
+// WithAdaptiveBatching makes the worker adapt its batch size between min and
+// max based on per-task latency and error rate of recent batches
+func WithAdaptiveBatching(min, max int, targetLatency time.Duration, maxErrorRate float64) WorkerOption {
+	return func(w *InboxWorker) {
+		w.sizer = newBatchSizer(w.batchSize, min, max, targetLatency, maxErrorRate)
+	}
+}
+
+// WithBatchConcurrency processes up to n tasks of a batch in parallel.
+// Tasks targeting the same record are still applied one after another
+// in the order they were claimed
+func WithBatchConcurrency(n int) WorkerOption {
+	return func(w *InboxWorker) {
+		w.concurrency = n
+	}
+}
+
+// WithThrottling makes the worker halve its batch size and process serially
+// while process memory (in MB) or goroutine count exceed the given limits.
+// A zero limit disables that check
+func WithThrottling(maxMemoryMB, maxGoroutines int) WorkerOption {
+	return func(w *InboxWorker) {
+		w.throttler = newThrottler(w.metrics, maxMemoryMB, maxGoroutines)
+	}
+}
+
+// WithDependencyRetryTimeout fails tasks that hit an unavailable dependency
+// once d has passed since they were queued. These attempts do not count
+// against the retry budget, so without a timeout they are retried forever
+func WithDependencyRetryTimeout(d time.Duration) WorkerOption {
+	return func(w *InboxWorker) {
+		w.dependencyTimeout = d
+	}
 }
 
 // NewInboxWorker creates a new inbox worker
@@ -36,8 +105,9 @@ func NewInboxWorker(
 	pollInterval time.Duration,
 	maxRetries int,
 	retryDelay time.Duration,
+	opts ...WorkerOption,
 ) *InboxWorker {
-	return &InboxWorker{
+	w := &InboxWorker{
 		repo:         repo,
 		metrics:      metrics,
 		workerCount:  workerCount,
@@ -45,8 +115,19 @@ func NewInboxWorker(
 		pollInterval: pollInterval,
 		maxRetries:   maxRetries,
 		retryDelay:   retryDelay,
+		operations:   NewOperationRegistry(),
+		heartbeats:   make([]int64, workerCount),
+		busy:         make([]int64, workerCount),
+		busySince:    make([]int64, workerCount),
 		stopCh:       make(chan struct{}),
 	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.pipeline = w.buildPipeline()
+
+	return w
 }
 
 // Start starts the inbox worker
@@ -64,6 +145,7 @@ func (w *InboxWorker) Start() {
 	// Start worker goroutines
 	for i := 0; i < w.workerCount; i++ {
 		w.wg.Add(1)
+		w.beat(i)
 		go w.worker(i)
 	}
 
@@ -88,11 +170,27 @@ func (w *InboxWorker) Stop() {
 	log.Println("Inbox worker stopped")
 }
 
+// Pause stops claiming tasks and waits for the claimed ones to be processed.
+// Tasks queued meanwhile wait for Resume
+func (w *InboxWorker) Pause() {
+	w.gate.Lock()
+	log.Println("Inbox worker paused")
+}
+
+// Resume continues claiming tasks after Pause
+func (w *InboxWorker) Resume() {
+	w.gate.Unlock()
+	log.Println("Inbox worker resumed")
+}
+
 // worker processes tasks from the inbox
 func (w *InboxWorker) worker(workerID int) {
 	defer w.wg.Done()
 	log.Printf("Worker %d started", workerID)
 
+	// A worker that has exited no longer counts as alive
+	defer atomic.StoreInt64(&w.heartbeats[workerID], 0)
+
 	ticker := time.NewTicker(w.pollInterval)
 	defer ticker.Stop()
 
@@ -102,7 +200,18 @@ func (w *InboxWorker) worker(workerID int) {
 			log.Printf("Worker %d stopping", workerID)
 			return
 		case <-ticker.C:
+			w.beat(workerID)
+			if !w.gate.TryRLock() {
+				// Paused
+				continue
+			}
+			started := time.Now()
+			atomic.StoreInt64(&w.busySince[workerID], started.UnixNano())
 			w.processTasks(workerID)
+			atomic.AddInt64(&w.busy[workerID], int64(time.Since(started)))
+			atomic.StoreInt64(&w.busySince[workerID], 0)
+			w.gate.RUnlock()
+			w.beat(workerID)
 		}
 	}
 }
@@ -112,7 +221,24 @@ func (w *InboxWorker) processTasks(workerID int) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	tasks, err := w.repo.Inbox.GetPendingTasks(ctx, w.batchSize)
+	batchSize := w.batchSize
+	if w.sizer != nil {
+		batchSize = w.sizer.Size()
+	}
+
+	// Back off under resource pressure
+	concurrency := w.concurrency
+	if w.throttler != nil {
+		if throttled, _ := w.throttler.Check(); throttled {
+			batchSize = batchSize / 2
+			if batchSize < 1 {
+				batchSize = 1
+			}
+			concurrency = 1
+		}
+	}
+
+	tasks, err := w.repo.Inbox.GetPendingTasks(ctx, batchSize)
 	if err != nil {
 		log.Printf("Worker %d: failed to get pending tasks: %v", workerID, err)
 		return
@@ -124,9 +250,6 @@ func (w *InboxWorker) processTasks(workerID int) {
 
 	log.Printf("Worker %d: processing %d tasks", workerID, len(tasks))
 
-	// Update queue depth metrics
-	w.metrics.SetQueueDepth(int64(len(tasks)))
-
 	// Log task details
 	for _, task := range tasks {
 		log.Printf("Worker %d: found task %s (operation: %s, status: %s, retries: %d, age: %v)",
@@ -134,68 +257,240 @@ func (w *InboxWorker) processTasks(workerID int) {
 			time.Since(task.CreatedAt).Round(time.Second))
 	}
 
+	claimed := len(tasks)
+	tasks = w.coalesceTasks(workerID, tasks)
+
+	failed, busy := w.processBatch(ctx, workerID, tasks, concurrency)
+
+	if w.sizer != nil {
+		newSize := w.sizer.Observe(claimed, len(tasks), failed, busy)
+		if newSize != batchSize {
+			log.Printf("Worker %d: adjusted batch size %d -> %d", workerID, batchSize, newSize)
+		}
+		w.metrics.SetBatchSize(newSize)
+	}
+}
+
+// processBatch processes the claimed tasks and returns the number of failures
+// and the time spent processing each task, summed. With batch concurrency
+// enabled, tasks are grouped by record ID and the groups run in parallel
+// while each group is processed serially to keep ordering
+func (w *InboxWorker) processBatch(ctx context.Context, workerID int, tasks []*models.InboxTask, concurrency int) (int, time.Duration) {
+	var failed, busy int64
+	process := func(task *models.InboxTask) {
+		start := time.Now()
+		if !w.processTask(ctx, workerID, task) {
+			atomic.AddInt64(&failed, 1)
+		}
+		atomic.AddInt64(&busy, int64(time.Since(start)))
+	}
+
+	if concurrency <= 1 || len(tasks) <= 1 {
+		for _, task := range tasks {
+			process(task)
+		}
+		return int(failed), time.Duration(busy)
+	}
+
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+
+	for _, group := range groupTasksByRecord(tasks) {
+		group := group
+		g.Go(func() error {
+			for _, task := range group {
+				process(task)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	return int(failed), time.Duration(busy)
+}
+
+// groupTasksByRecord splits tasks into per-record groups, preserving the
+// order of groups and of tasks within each group
+func groupTasksByRecord(tasks []*models.InboxTask) [][]*models.InboxTask {
+	index := make(map[string]int)
+	var groups [][]*models.InboxTask
+
 	for _, task := range tasks {
-		w.processTask(ctx, workerID, task)
+		key := taskRecordID(task)
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], task)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []*models.InboxTask{task})
 	}
+
+	return groups
 }
 
-// processTask processes a single task
-func (w *InboxWorker) processTask(ctx context.Context, workerID int, task *models.InboxTask) {
+// taskRecordID returns the record ID a task operates on, falling back to the
+// task ID when the payload cannot be decoded so such tasks run on their own
+func taskRecordID(task *models.InboxTask) string {
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(task.Payload, &payload); err != nil || payload.ID == "" {
+		return "task:" + task.ID
+	}
+	return "record:" + payload.ID
+}
+
+// processTask processes a single task and reports whether it succeeded
+func (w *InboxWorker) processTask(ctx context.Context, workerID int, task *models.InboxTask) bool {
 	startTime := time.Now()
-	log.Printf("Worker %d: starting processing task %s (operation: %s)", workerID, task.ID, task.Operation)
+	var trace *taskTrace
+	if w.tracing {
+		trace = newTaskTrace(workerID, task)
+		ctx = withTaskTrace(ctx, trace)
+	}
+	trace.note("Worker %d: starting processing task %s (operation: %s)", workerID, task.ID, task.Operation)
+	if entry, ok := w.coalesced.Load(task.ID); ok && trace != nil {
+		trace.decide(models.TaskDecisionCoalesced, "Task %s supersedes %d coalesced updates", task.ID, len(entry.([]*models.InboxTask)))
+	}
 
 	// Task is already marked as processing by GetPendingTasks
-	var processErr error
-
-	// Process task based on operation
-	switch task.Operation {
-	case models.TaskOperationInsert:
-		processErr = w.processInsertTask(ctx, task.Payload)
-	case models.TaskOperationUpdate:
-		processErr = w.processUpdateTask(ctx, task.Payload)
-	case models.TaskOperationDelete:
-		processErr = w.processDeleteTask(ctx, task.Payload)
-	default:
-		processErr = models.ErrInvalidTaskOperation
-	}
+	processErr := w.pipeline(ctx, task)
 
 	if processErr != nil {
-		w.handleTaskError(ctx, workerID, task, processErr)
+		w.settleCoalesced(ctx, workerID, task, false)
+		outcome := w.handleTaskError(ctx, workerID, task, processErr)
+		w.saveTrace(ctx, workerID, task, trace, outcome, processErr)
 		// Record failed task metrics with operation details
 		duration := time.Since(startTime)
 		w.metrics.RecordTaskExecutionWithDetails(string(task.Operation), duration, false)
+		w.metrics.RecordTenantTask(task.TenantID, task.Operation, duration, false)
+		return false
+	}
+
+	if w.repo.Tx == nil {
+		// Mark task as completed
+		updateErr := w.repo.Inbox.CompleteTask(ctx, task.ID, task.Result)
+		if updateErr != nil {
+			log.Printf("Worker %d: failed to update task %s status to completed: %v", workerID, task.ID, updateErr)
+			w.settleCoalesced(ctx, workerID, task, false)
+			w.saveTrace(ctx, workerID, task, trace, models.TaskStatusProcessing, updateErr)
+			return false
+		}
+	}
+	w.settleCoalesced(ctx, workerID, task, true)
+
+	atomic.StoreInt64(&w.lastSuccess, time.Now().UnixNano())
+	w.metrics.RecordTaskCompletion(task.Operation, time.Since(task.CreatedAt), true)
+	duration := time.Since(startTime)
+	trace.note("Worker %d: task %s completed successfully in %v", workerID, task.ID, duration.Round(time.Millisecond))
+	w.saveTrace(ctx, workerID, task, trace, models.TaskStatusCompleted, nil)
+	// Record successful task metrics with operation details
+	w.metrics.RecordTaskExecutionWithDetails(string(task.Operation), duration, true)
+	w.metrics.RecordTenantTask(task.TenantID, task.Operation, duration, true)
+	return true
+}
+
+// saveTrace stores the trace of an attempt that left task with status
+// outcome, if the attempt was traced
+func (w *InboxWorker) saveTrace(ctx context.Context, workerID int, task *models.InboxTask, trace *taskTrace, outcome string, err error) {
+	if trace == nil {
 		return
 	}
+	if err := w.repo.Inbox.SetTaskTrace(ctx, task.ID, trace.finish(outcome, err)); err != nil {
+		log.Printf("Worker %d: failed to store trace of task %s: %v", workerID, task.ID, err)
+	}
+}
 
-	// Mark task as completed
-	updateErr := w.repo.Inbox.UpdateTaskStatus(ctx, task.ID, models.TaskStatusCompleted, "")
-	if updateErr != nil {
-		log.Printf("Worker %d: failed to update task %s status to completed: %v", workerID, task.ID, updateErr)
-	} else {
-		duration := time.Since(startTime)
-		log.Printf("Worker %d: task %s completed successfully in %v", workerID, task.ID, duration.Round(time.Millisecond))
-		// Record successful task metrics with operation details
-		w.metrics.RecordTaskExecutionWithDetails(string(task.Operation), duration, true)
+// persistTask applies the task to the records. When records and inbox share a
+// database the change is applied and the task marked completed in one
+// transaction so neither can happen without the other
+func (w *InboxWorker) persistTask(ctx context.Context, task *models.InboxTask) (err error) {
+	end := taskTraceFromContext(ctx).enter("persist")
+	defer func() { end(err) }()
+
+	if w.repo.Tx == nil {
+		return applyTask(ctx, w.operations, w.repo.Record, task)
+	}
+
+	return w.repo.Tx.WithinTransaction(ctx, func(ctx context.Context, tx repository.Repository) error {
+		if err := applyTask(ctx, w.operations, tx, task); err != nil {
+			return err
+		}
+		if err := tx.CompleteTask(ctx, task.ID, task.Result); err != nil {
+			return fmt.Errorf("failed to update task status to completed: %w", err)
+		}
+		return nil
+	})
+}
+
+// applyTask applies the task's operation to the given record repository and
+// sets the task's result, looking custom operations up in operations. It is
+// how the worker persists a task and how anything else replaying one applies it
+func applyTask(ctx context.Context, operations *OperationRegistry, records repository.RecordRepository, task *models.InboxTask) error {
+	var result *models.TaskResult
+	var err error
+	switch task.Operation {
+	case models.TaskOperationInsert:
+		result, err = processInsertTask(ctx, records, task.Payload)
+	case models.TaskOperationUpdate:
+		result, err = processUpdateTask(ctx, records, task.Payload)
+	case models.TaskOperationDelete:
+		result, err = processDeleteTask(ctx, records, task.Payload)
+	default:
+		// Custom operations do not report the records they wrote
+		err = applyCustomTask(ctx, operations, records, task)
+		result = &models.TaskResult{Outcome: models.TaskOutcomeApplied}
+	}
+	if err != nil {
+		return err
 	}
+	task.Result = result
+	return nil
 }
 
-// handleTaskError handles task processing errors
-func (w *InboxWorker) handleTaskError(ctx context.Context, workerID int, task *models.InboxTask, processErr error) {
+// handleTaskError handles task processing errors and returns the status it
+// leaves the task in, pending when it is retried
+func (w *InboxWorker) handleTaskError(ctx context.Context, workerID int, task *models.InboxTask, processErr error) string {
+	trace := taskTraceFromContext(ctx)
 	log.Printf("Worker %d: task %s failed: %v", workerID, task.ID, processErr)
 
-	// Increment retry count
-	err := w.repo.Inbox.IncrementTaskRetries(ctx, task.ID)
-	if err != nil {
-		log.Printf("Worker %d: failed to increment retries for task %s: %v", workerID, task.ID, err)
+	// Query timeouts and an open enrichment circuit point at an overloaded
+	// dependency rather than a bad task, so they are retried without
+	// consuming the retry budget until the dependency timeout
+	timedOut := errors.Is(processErr, models.ErrQueryTimeout) || errors.Is(processErr, errCircuitOpen)
+	if timedOut && w.dependencyTimeout > 0 && time.Since(task.CreatedAt) >= w.dependencyTimeout {
+		trace.decide(models.TaskDecisionDependencyTimeout, "Worker %d: task %s still hits an unavailable dependency after %v, marking as failed", workerID, task.ID, w.dependencyTimeout)
+		return w.failTask(ctx, workerID, task, processErr)
 	}
 
-	// Check if max retries exceeded
-	if task.Retries >= w.maxRetries {
-		log.Printf("Worker %d: task %s exceeded max retries (%d), marking as failed", workerID, task.ID, w.maxRetries)
-		err = w.repo.Inbox.UpdateTaskStatus(ctx, task.ID, models.TaskStatusFailed, processErr.Error())
+	var err error
+	if timedOut {
+		trace.decide(models.TaskDecisionDependencyUnavailable, "Worker %d: task %s hit an unavailable dependency, retrying without counting the attempt", workerID, task.ID)
+	} else {
+		// Increment retry count
+		err = w.repo.Inbox.IncrementTaskRetries(ctx, task.ID)
 		if err != nil {
-			log.Printf("Worker %d: failed to update task %s status to failed: %v", workerID, task.ID, err)
+			log.Printf("Worker %d: failed to increment retries for task %s: %v", workerID, task.ID, err)
 		}
+	}
+
+	// A record changed since the write expected it unchanged stays changed,
+	// and an enriched value violating its schema is rejected again, so both
+	// fail without retries
+	conflict := errors.Is(processErr, models.ErrVersionConflict)
+	invalid := errors.Is(processErr, models.ErrSchemaValidation)
+
+	// Check if max retries exceeded
+	if !timedOut && (conflict || invalid || task.Retries >= w.maxRetries) {
+		switch {
+		case conflict:
+			trace.decide(models.TaskDecisionVersionConflict, "Worker %d: task %s hit a version conflict, marking as failed", workerID, task.ID)
+		case invalid:
+			trace.decide(models.TaskDecisionSchemaViolation, "Worker %d: task %s violates the schema of its record type, marking as failed", workerID, task.ID)
+		default:
+			trace.decide(models.TaskDecisionMaxRetries, "Worker %d: task %s exceeded max retries (%d), marking as failed", workerID, task.ID, w.maxRetries)
+		}
+		return w.failTask(ctx, workerID, task, processErr)
 	} else {
 		// Schedule retry by marking as pending again after delay
 		go func() {
@@ -210,9 +505,20 @@ func (w *InboxWorker) handleTaskError(ctx context.Context, workerID int, task *m
 				log.Printf("Worker %d: task %s scheduled for retry (attempt %d)", workerID, task.ID, task.Retries+2)
 			}
 		}()
+		return models.TaskStatusPending
 	}
 }
 
+// failTask marks a task failed with processErr and returns its status
+func (w *InboxWorker) failTask(ctx context.Context, workerID int, task *models.InboxTask, processErr error) string {
+	w.metrics.RecordTaskCompletion(task.Operation, time.Since(task.CreatedAt), false)
+	err := w.repo.Inbox.UpdateTaskStatus(ctx, task.ID, models.TaskStatusFailed, processErr.Error())
+	if err != nil {
+		log.Printf("Worker %d: failed to update task %s status to failed: %v", workerID, task.ID, err)
+	}
+	return models.TaskStatusFailed
+}
+
 // cleanupWorker periodically cleans up completed and failed tasks
 func (w *InboxWorker) cleanupWorker() {
 	defer w.wg.Done()
@@ -233,77 +539,96 @@ func (w *InboxWorker) cleanupWorker() {
 }
 
 // processInsertTask processes an insert task
-func (w *InboxWorker) processInsertTask(ctx context.Context, payload []byte) error {
+func processInsertTask(ctx context.Context, records repository.RecordRepository, payload []byte) (*models.TaskResult, error) {
 	var taskPayload models.InsertTaskPayload
-	if err := json.Unmarshal(payload, &taskPayload); err != nil {
-		return fmt.Errorf("failed to unmarshal insert payload: %w", err)
+	if err := models.UnmarshalValue(payload, &taskPayload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal insert payload: %w", err)
 	}
 
 	record := &models.Record{
 		ID:    taskPayload.ID,
+		Type:  taskPayload.Type,
 		Value: taskPayload.Value,
 	}
+	if taskPayload.Proto != nil {
+		record.Value, record.Encoding = models.ProtoValue(taskPayload.Proto), models.EncodingProtobuf
+	}
 
-	if err := w.repo.Record.Insert(ctx, record); err != nil {
+	if err := records.Insert(ctx, record); err != nil {
 		// Check if error is due to duplicate key (idempotency check)
-		if err.Error() == fmt.Sprintf("record with id '%s' already exists", record.ID) {
+		if errors.Is(err, models.ErrRecordExists) {
 			// Record already exists, check if it has the same value (idempotent operation)
-			existingRecord, getErr := w.repo.Record.Get(ctx, record.ID)
+			existingRecord, getErr := records.Get(ctx, record.ID)
 			if getErr != nil {
-				return fmt.Errorf("failed to verify existing record: %w", getErr)
+				return nil, fmt.Errorf("failed to verify existing record: %w", getErr)
 			}
 			
 			// Compare values to ensure idempotency
-			existingValueJSON, _ := json.Marshal(existingRecord.Value)
-			newValueJSON, _ := json.Marshal(record.Value)
-			if string(existingValueJSON) == string(newValueJSON) {
-				log.Printf("Record with ID %s already exists with same value (idempotent operation)", record.ID)
-				return nil // Success - idempotent operation
+			existingHash, _ := models.ValueHash(existingRecord.Value)
+			newHash, _ := models.ValueHash(record.Value)
+			if existingHash == newHash {
+				taskTraceFromContext(ctx).decide(models.TaskDecisionIdempotentSkip, "Record with ID %s already exists with same value (idempotent operation)", record.ID)
+				return &models.TaskResult{Outcome: models.TaskOutcomeIdempotentNoop}, nil // Success - idempotent operation
 			}
 			
 			// Values are different - this is a conflict
-			return fmt.Errorf("record with id '%s' already exists but with different value", record.ID)
+			return nil, fmt.Errorf("record with id '%s' already exists but with different value", record.ID)
 		}
-		return fmt.Errorf("failed to insert record: %w", err)
+		return nil, fmt.Errorf("failed to insert record: %w", err)
 	}
 
-	log.Printf("Successfully inserted record with ID: %s", record.ID)
-	return nil
+	taskTraceFromContext(ctx).note("Successfully inserted record with ID: %s", record.ID)
+	return &models.TaskResult{Outcome: models.TaskOutcomeCreated, RowsAffected: 1}, nil
 }
 
 // processUpdateTask processes an update task
-func (w *InboxWorker) processUpdateTask(ctx context.Context, payload []byte) error {
+func processUpdateTask(ctx context.Context, records repository.RecordRepository, payload []byte) (*models.TaskResult, error) {
 	var taskPayload models.UpdateTaskPayload
-	if err := json.Unmarshal(payload, &taskPayload); err != nil {
-		return fmt.Errorf("failed to unmarshal update payload: %w", err)
+	if err := models.UnmarshalValue(payload, &taskPayload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal update payload: %w", err)
 	}
 
 	record := &models.Record{
 		ID:    taskPayload.ID,
 		Value: taskPayload.Value,
 	}
+	if taskPayload.Proto != nil {
+		record.Value, record.Encoding = models.ProtoValue(taskPayload.Proto), models.EncodingProtobuf
+	}
 
-	if err := w.repo.Record.Update(ctx, record); err != nil {
-		return fmt.Errorf("failed to update record: %w", err)
+	var err error
+	if taskPayload.ExpectedVersion != 0 {
+		err = records.UpdateIfVersion(ctx, record, taskPayload.ExpectedVersion)
+	} else {
+		err = records.Update(ctx, record)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update record: %w", err)
 	}
 
-	log.Printf("Successfully updated record with ID: %s", record.ID)
-	return nil
+	taskTraceFromContext(ctx).note("Successfully updated record with ID: %s", record.ID)
+	return &models.TaskResult{Outcome: models.TaskOutcomeUpdated, RowsAffected: 1}, nil
 }
 
 // processDeleteTask processes a delete task
-func (w *InboxWorker) processDeleteTask(ctx context.Context, payload []byte) error {
+func processDeleteTask(ctx context.Context, records repository.RecordRepository, payload []byte) (*models.TaskResult, error) {
 	var taskPayload models.DeleteTaskPayload
 	if err := json.Unmarshal(payload, &taskPayload); err != nil {
-		return fmt.Errorf("failed to unmarshal delete payload: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal delete payload: %w", err)
 	}
 
-	if err := w.repo.Record.Delete(ctx, taskPayload.ID); err != nil {
-		return fmt.Errorf("failed to delete record: %w", err)
+	var err error
+	if taskPayload.ExpectedVersion != 0 {
+		err = records.DeleteIfVersion(ctx, taskPayload.ID, taskPayload.ExpectedVersion)
+	} else {
+		err = records.Delete(ctx, taskPayload.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete record: %w", err)
 	}
 
-	log.Printf("Successfully deleted record with ID: %s", taskPayload.ID)
-	return nil
+	taskTraceFromContext(ctx).note("Successfully deleted record with ID: %s", taskPayload.ID)
+	return &models.TaskResult{Outcome: models.TaskOutcomeDeleted, RowsAffected: 1}, nil
 }
 
 // cleanupOldTasks removes completed and failed tasks older than 24 hours
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestGroupTasksByRecord_PreservesOrder(t *testing.T) {
+	tasks := []*models.InboxTask{
+		{ID: "t1", Payload: []byte(`{"id":"a"}`)},
+		{ID: "t2", Payload: []byte(`{"id":"b"}`)},
+		{ID: "t3", Payload: []byte(`{"id":"a"}`)},
+		{ID: "t4", Payload: []byte(`not json`)},
+		{ID: "t5", Payload: []byte(`{"id":"b"}`)},
+	}
+
+	groups := groupTasksByRecord(tasks)
+
+	expected := [][]string{{"t1", "t3"}, {"t2", "t5"}, {"t4"}}
+	if len(groups) != len(expected) {
+		t.Fatalf("Expected %d groups, got %d", len(expected), len(groups))
+	}
+
+	for i, group := range groups {
+		if len(group) != len(expected[i]) {
+			t.Fatalf("Group %d: expected %d tasks, got %d", i, len(expected[i]), len(group))
+		}
+		for j, task := range group {
+			if task.ID != expected[i][j] {
+				t.Errorf("Group %d position %d: expected %s, got %s", i, j, expected[i][j], task.ID)
+			}
+		}
+	}
+}
+
+func TestInboxWorker_NumberPrecision(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	value := json.RawMessage(`{"total": 12345678901234567891, "rate": 0.10}`)
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "bill_1", Value: value}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond)
+
+	var record *models.Record
+	waitFor(t, "the insert", func() bool {
+		record, _ = mock.Get(ctx, "bill_1")
+		return record != nil
+	})
+	if raw := string(record.Value); !strings.Contains(raw, "12345678901234567891") || !strings.Contains(raw, "0.10") {
+		t.Errorf("Expected the numbers kept as written, got %s", raw)
+	}
+
+	hash := func(raw string) string {
+		h, err := models.ValueHash(json.RawMessage(raw))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return h
+	}
+	if hash(`{"n": 12345678901234567891}`) == hash(`{"n": 12345678901234567892}`) {
+		t.Error("Expected large integers differing in the last digit to hash differently")
+	}
+	if hash(`{"n": 1e2}`) != hash(`{"n": 100}`) || hash(`{"n": 0.10}`) != hash(`{"n": 0.1}`) {
+		t.Error("Expected equal numbers to hash the same however they are written")
+	}
+}
+
+func TestInboxWorker_KeyOrder(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	schema := map[string]interface{}{"type": "object", "properties": map[string]interface{}{"n": map[string]interface{}{"type": "number"}}}
+	if err := svc.PutRecordType(ctx, &models.RecordType{Name: "counter", Schema: schema}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Values pass through as sent, including those a schema validates
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "plain", Value: json.RawMessage(`{"n": 1, "a": 2}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "typed", Type: "counter", Value: json.RawMessage(`{"n": 1, "a": 2}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Update(ctx, &models.UpdateRequest{ID: "typed", Value: json.RawMessage(`{"n": 3, "a": 4}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond)
+
+	expected := map[string]string{"plain": `{"n":1,"a":2}`, "typed": `{"n":3,"a":4}`}
+	waitFor(t, "the writes", func() bool {
+		record, _ := mock.Get(ctx, "typed")
+		return record != nil && record.Version == 2
+	})
+	for id, value := range expected {
+		record, err := mock.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(record.Value) != value {
+			t.Errorf("%s: expected %s, got %s", id, value, record.Value)
+		}
+	}
+}
+
+func TestInboxWorker_TaskResults(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: json.RawMessage(`{"name": "Ada"}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	queue := func(task *models.InboxTask, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return task.ID
+	}
+	expected := map[string]models.TaskResult{
+		queue(svc.Insert(ctx, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})})): {Outcome: models.TaskOutcomeIdempotentNoop},
+		queue(svc.Insert(ctx, &models.InsertRequest{ID: "user_2", Value: models.MustEncodeValue(map[string]interface{}{"name": "Bob"})})): {Outcome: models.TaskOutcomeCreated, RowsAffected: 1},
+		queue(svc.Update(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Eve"})})): {Outcome: models.TaskOutcomeUpdated, RowsAffected: 1},
+	}
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	waitFor(t, "the writes", func() bool {
+		stats, _ := mock.GetTaskStats(ctx)
+		return stats.CompletedTasks == len(expected)
+	})
+	deleted := queue(svc.Delete(ctx, &models.DeleteRequest{ID: "user_2"}))
+	expected[deleted] = models.TaskResult{Outcome: models.TaskOutcomeDeleted, RowsAffected: 1}
+	waitFor(t, "the delete", func() bool {
+		task, _ := mock.GetTask(ctx, deleted)
+		return task.Status == models.TaskStatusCompleted
+	})
+
+	for id, result := range expected {
+		task, err := svc.GetTask(ctx, id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if task.Result == nil || *task.Result != result {
+			t.Errorf("Expected task %s %+v, got %+v", task.Operation, result, task.Result)
+		}
+	}
+}
+
+func TestInboxWorker_DependencyRetryTimeout(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	w := NewInboxWorker(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), 1, 10, time.Hour, 3, time.Millisecond,
+		WithDependencyRetryTimeout(time.Minute))
+
+	fresh := &models.InboxTask{ID: "fresh", Status: models.TaskStatusProcessing, CreatedAt: time.Now()}
+	stale := &models.InboxTask{ID: "stale", Status: models.TaskStatusProcessing, CreatedAt: time.Now().Add(-time.Hour)}
+	for _, task := range []*models.InboxTask{fresh, stale} {
+		if err := mock.CreateTask(ctx, task); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if status := w.handleTaskError(ctx, 0, fresh, models.ErrQueryTimeout); status != models.TaskStatusPending {
+		t.Errorf("Expected a query timeout of a fresh task retried, got %s", status)
+	}
+	if status := w.handleTaskError(ctx, 0, stale, errCircuitOpen); status != models.TaskStatusFailed {
+		t.Errorf("Expected a task past the dependency timeout failed, got %s", status)
+	}
+	waitFor(t, "the retry of the fresh task", func() bool {
+		task, _ := mock.GetTask(ctx, "fresh")
+		return task.Status == models.TaskStatusPending
+	})
+	for _, id := range []string{"fresh", "stale"} {
+		if task, _ := mock.GetTask(ctx, id); task.Retries != 0 {
+			t.Errorf("Expected dependency errors of %s not to count as retries, got %d", id, task.Retries)
+		}
+	}
+	if task, _ := mock.GetTask(ctx, "stale"); task.Status != models.TaskStatusFailed || !strings.Contains(task.Error, "circuit") {
+		t.Errorf("Expected the stale task failed with the dependency error, got %s %q", task.Status, task.Error)
+	}
+}
+
+func TestService_GetTaskStatuses(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	first, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_2", Value: models.MustEncodeValue(map[string]interface{}{"name": "Bob"})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	waitFor(t, "the inserts", func() bool {
+		task, _ := svc.GetTask(ctx, second.ID)
+		return task.Status == models.TaskStatusCompleted
+	})
+
+	response, err := svc.GetTaskStatuses(ctx, []string{second.ID, "nope", first.ID, second.ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(response.Tasks) != 2 || response.Tasks[0].ID != second.ID || response.Tasks[1].ID != first.ID {
+		t.Fatalf("Expected each task once in request order, got %+v", response.Tasks)
+	}
+	if status := response.Tasks[0]; status.Status != models.TaskStatusCompleted || status.Result == nil || status.Result.Outcome != models.TaskOutcomeCreated {
+		t.Errorf("Expected the completed insert with its result, got %+v", status)
+	}
+	if len(response.Missing) != 1 || response.Missing[0] != "nope" {
+		t.Errorf("Expected the unknown ID missing, got %v", response.Missing)
+	}
+}
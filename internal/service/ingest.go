@@ -0,0 +1,403 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/importer"
+	"mit-service/internal/models"
+)
+
+// ingestStateFile holds the status of every file seen, in IngestConfig.StateDir
+const ingestStateFile = "ingest-state.json"
+
+// ObjectStore lists and reads the files of a bucket
+type ObjectStore interface {
+	List(ctx context.Context, prefix string) ([]*models.ObjectInfo, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// IngestConfig configures the ingestion of NDJSON files from an object store
+type IngestConfig struct {
+	// Prefix selects the watched files, Interval is how often it is listed
+	Prefix   string
+	Interval time.Duration
+
+	// StateDir keeps the file statuses and the checkpoints of files being
+	// ingested, so a restart resumes instead of starting over
+	StateDir string
+
+	// BatchSize is the number of records imported at once, Overwrite
+	// replaces existing records holding a different value
+	BatchSize int
+	Overwrite bool
+
+	// Mapping turns the lines of a file into records
+	Mapping importer.Mapping
+}
+
+// ingester watches an object store prefix and imports every new or changed
+// NDJSON file through the bulk import, one file at a time
+type ingester struct {
+	s     *Service
+	store ObjectStore
+	cfg   IngestConfig
+
+	mu    sync.Mutex
+	files map[string]*models.IngestFile
+
+	// retry holds failed files a notification asked to ingest again
+	retry map[string]bool
+
+	notifyCh chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// StartIngest watches cfg.Prefix of the store and ingests its NDJSON files
+// (.ndjson or .jsonl, optionally gzipped) in the background
+func (s *Service) StartIngest(store ObjectStore, cfg IngestConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("ingest interval must be positive, got %v", cfg.Interval)
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("ingest batch size must be positive, got %d", cfg.BatchSize)
+	}
+	if cfg.Mapping.IDField == "" {
+		return errors.New("ingest ID field is required")
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create ingest state directory: %w", err)
+	}
+
+	w := &ingester{
+		s:        s,
+		store:    store,
+		cfg:      cfg,
+		files:    make(map[string]*models.IngestFile),
+		retry:    make(map[string]bool),
+		notifyCh: make(chan struct{}, 1),
+	}
+	if err := w.loadState(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.wg.Add(1)
+	go w.run(ctx)
+
+	s.ingest = w
+	return nil
+}
+
+// IngestFiles returns the status of every file seen under the watched
+// prefix, ordered by key
+func (s *Service) IngestFiles() ([]*models.IngestFile, error) {
+	if s.ingest == nil {
+		return nil, models.ErrIngestDisabled
+	}
+
+	w := s.ingest
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	files := make([]*models.IngestFile, 0, len(w.files))
+	for _, file := range w.files {
+		copied := *file
+		files = append(files, &copied)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	return files, nil
+}
+
+// IngestFile returns the status of one file
+func (s *Service) IngestFile(key string) (*models.IngestFile, error) {
+	if s.ingest == nil {
+		return nil, models.ErrIngestDisabled
+	}
+
+	w := s.ingest
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	file, ok := w.files[key]
+	if !ok {
+		return nil, models.ErrIngestFileNotFound
+	}
+	copied := *file
+	return &copied, nil
+}
+
+// NotifyIngest lists the watched prefix now instead of at the next interval,
+// e.g. on an S3 event notification. Failed files among keys are retried
+func (s *Service) NotifyIngest(keys []string) error {
+	if s.ingest == nil {
+		return models.ErrIngestDisabled
+	}
+
+	w := s.ingest
+	w.mu.Lock()
+	for _, key := range keys {
+		if file, ok := w.files[key]; ok && file.Status == models.ScanFailed {
+			w.retry[key] = true
+		}
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.notifyCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Stop cancels the file being ingested, which is resumed from its
+// checkpoint on the next start, and waits for the watcher to exit
+func (w *ingester) Stop() {
+	w.stopOnce.Do(func() {
+		w.cancel()
+		w.wg.Wait()
+	})
+}
+
+// run polls the prefix every interval and on notifications
+func (w *ingester) run(ctx context.Context) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.notifyCh:
+		}
+	}
+}
+
+// poll lists the prefix, registers new and changed files and ingests the
+// ones not completed yet
+func (w *ingester) poll(ctx context.Context) {
+	objects, err := w.store.List(ctx, w.cfg.Prefix)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Ingest: failed to list %s: %v", w.cfg.Prefix, err)
+		}
+		return
+	}
+
+	var queued []*models.ObjectInfo
+	w.mu.Lock()
+	for _, object := range objects {
+		if !ingestible(object.Key) {
+			continue
+		}
+
+		file, ok := w.files[object.Key]
+		if !ok || file.ETag != object.ETag {
+			if ok {
+				// The file was replaced, its old checkpoint does not apply
+				os.Remove(w.checkpointPath(object.Key))
+			}
+			file = &models.IngestFile{Key: object.Key, ETag: object.ETag, Size: object.Size, Status: models.IngestPending}
+			w.files[object.Key] = file
+		}
+
+		switch {
+		case file.Status == models.ScanFailed && w.retry[object.Key]:
+			delete(w.retry, object.Key)
+			file.Status = models.IngestPending
+			queued = append(queued, object)
+		case file.Status == models.IngestPending:
+			queued = append(queued, object)
+		}
+	}
+	w.mu.Unlock()
+
+	if len(queued) > 0 {
+		w.saveState()
+	}
+	for _, object := range queued {
+		if ctx.Err() != nil {
+			return
+		}
+		w.ingestFile(ctx, object)
+	}
+}
+
+// ingestFile imports one file, resuming from its checkpoint
+func (w *ingester) ingestFile(ctx context.Context, object *models.ObjectInfo) {
+	started := time.Now()
+	w.update(object.Key, func(file *models.IngestFile) {
+		file.Status = models.ScanRunning
+		file.StartedAt = &started
+		file.FinishedAt = nil
+		file.Error = ""
+	})
+	log.Printf("Ingest: importing %s (%d bytes)", object.Key, object.Size)
+
+	progress, err := w.load(ctx, object)
+	if progress != nil {
+		w.update(object.Key, func(file *models.IngestFile) { setIngestProgress(file, progress) })
+	}
+
+	if ctx.Err() != nil {
+		// Stopping, the checkpoint resumes the file on the next start
+		w.update(object.Key, func(file *models.IngestFile) { file.Status = models.IngestPending })
+		return
+	}
+
+	finished := time.Now()
+	status := models.ScanCompleted
+	if err != nil {
+		status = models.ScanFailed
+		log.Printf("Ingest: failed to import %s: %v", object.Key, err)
+	} else {
+		log.Printf("Ingest: imported %s in %v", object.Key, finished.Sub(started).Round(time.Millisecond))
+	}
+	w.update(object.Key, func(file *models.IngestFile) {
+		file.Status = status
+		file.FinishedAt = &finished
+		if err != nil {
+			file.Error = err.Error()
+		}
+	})
+	w.s.metrics.RecordIngestFile(status)
+}
+
+// load reads the file and imports its records in batches
+func (w *ingester) load(ctx context.Context, object *models.ObjectInfo) (*importer.Progress, error) {
+	body, err := w.store.Open(ctx, object.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer body.Close()
+
+	var input io.Reader = body
+	if strings.HasSuffix(object.Key, ".gz") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress file: %w", err)
+		}
+		defer gz.Close()
+		input = gz
+	}
+
+	reader, err := importer.NewReader(importer.FormatJSONLines, input)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := w.cfg.Mapping
+	return importer.Load(ctx, reader, &mapping, importer.Options{
+		BatchSize:  w.cfg.BatchSize,
+		Overwrite:  w.cfg.Overwrite,
+		Input:      object.Key + "@" + object.ETag,
+		Checkpoint: w.checkpointPath(object.Key),
+		Retries:    3,
+		RetryDelay: time.Second,
+		Import:     w.s.ImportRecords,
+		Progress: func(p *importer.Progress) {
+			w.update(object.Key, func(file *models.IngestFile) { setIngestProgress(file, p) })
+		},
+	})
+}
+
+// update changes the status of a file and persists the state
+func (w *ingester) update(key string, fn func(*models.IngestFile)) {
+	w.mu.Lock()
+	if file, ok := w.files[key]; ok {
+		fn(file)
+	}
+	w.mu.Unlock()
+	w.saveState()
+}
+
+// setIngestProgress copies the counts of a load into the file status
+func setIngestProgress(file *models.IngestFile, p *importer.Progress) {
+	file.Rows = p.Rows
+	file.Resumed = p.Resumed
+	file.Invalid = p.Invalid
+	file.ImportResult = p.ImportResult
+	file.ImportResult.Errors = append([]*models.ImportError(nil), p.Errors...)
+}
+
+// checkpointPath returns the importer checkpoint of a file
+func (w *ingester) checkpointPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(w.cfg.StateDir, hex.EncodeToString(sum[:8])+".checkpoint")
+}
+
+// loadState restores the file statuses of the last run. Files that were
+// being ingested are pending again and resume from their checkpoints
+func (w *ingester) loadState() error {
+	data, err := os.ReadFile(filepath.Join(w.cfg.StateDir, ingestStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ingest state: %w", err)
+	}
+
+	var files []*models.IngestFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		return fmt.Errorf("invalid ingest state: %w", err)
+	}
+	for _, file := range files {
+		if file.Status == models.ScanRunning {
+			file.Status = models.IngestPending
+		}
+		w.files[file.Key] = file
+	}
+	return nil
+}
+
+// saveState atomically writes the file statuses
+func (w *ingester) saveState() {
+	w.mu.Lock()
+	files := make([]*models.IngestFile, 0, len(w.files))
+	for _, file := range w.files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	data, err := json.Marshal(files)
+	w.mu.Unlock()
+	if err != nil {
+		log.Printf("Ingest: failed to encode state: %v", err)
+		return
+	}
+
+	path := filepath.Join(w.cfg.StateDir, ingestStateFile)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		log.Printf("Ingest: failed to save state: %v", err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		log.Printf("Ingest: failed to save state: %v", err)
+	}
+}
+
+// ingestible reports whether a key names an NDJSON file
+func ingestible(key string) bool {
+	key = strings.TrimSuffix(key, ".gz")
+	return strings.HasSuffix(key, ".ndjson") || strings.HasSuffix(key, ".jsonl")
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mit-service/internal/importer"
+	"mit-service/internal/models"
+)
+
+// fakeObjectStore holds files in memory, the ETag of a file is its content
+type fakeObjectStore struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (f *fakeObjectStore) put(key, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[key] = content
+}
+
+func (f *fakeObjectStore) List(ctx context.Context, prefix string) ([]*models.ObjectInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var objects []*models.ObjectInfo
+	for key, content := range f.files {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, &models.ObjectInfo{Key: key, ETag: content, Size: int64(len(content))})
+		}
+	}
+	return objects, nil
+}
+
+func (f *fakeObjectStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	content, ok := f.files[key]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+// ingestStatus returns the status of a file, empty while it is unknown
+func ingestStatus(svc *Service, key string) string {
+	file, err := svc.IngestFile(key)
+	if err != nil {
+		return ""
+	}
+	return file.Status
+}
+
+func TestService_Ingest(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"id": "c", "n": 3}` + "\n"))
+	gz.Close()
+
+	store := &fakeObjectStore{files: map[string]string{
+		"in/a.ndjson":    `{"id": "a", "n": 1}` + "\n" + `{"n": 0}` + "\n" + `{"id": "b", "n": 2}` + "\n",
+		"in/c.jsonl.gz":  compressed.String(),
+		"in/bad.ndjson":  `{"id": "d"`,
+		"in/readme.txt":  "not ingested",
+		"other/e.ndjson": `{"id": "e", "n": 5}`,
+	}}
+	cfg := IngestConfig{
+		Prefix:    "in/",
+		Interval:  time.Hour,
+		StateDir:  t.TempDir(),
+		BatchSize: 2,
+		Mapping:   importer.Mapping{IDField: "id", IDPrefix: "r-"},
+	}
+
+	svc, mock := newMockService()
+	if err := svc.StartIngest(store, cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitFor(t, "files ingested", func() bool {
+		return ingestStatus(svc, "in/a.ndjson") == models.ScanCompleted &&
+			ingestStatus(svc, "in/c.jsonl.gz") == models.ScanCompleted &&
+			ingestStatus(svc, "in/bad.ndjson") == models.ScanFailed
+	})
+
+	file, _ := svc.IngestFile("in/a.ndjson")
+	if file.Rows != 3 || file.Invalid != 1 || file.Created != 2 || file.FinishedAt == nil {
+		t.Errorf("Expected 3 rows, 1 invalid and 2 created, got %+v", file)
+	}
+	for _, id := range []string{"r-a", "r-b", "r-c"} {
+		if _, err := mock.Get(context.Background(), id); err != nil {
+			t.Errorf("Expected record %s imported: %v", id, err)
+		}
+	}
+	if _, err := svc.IngestFile("in/readme.txt"); !errors.Is(err, models.ErrIngestFileNotFound) {
+		t.Errorf("Expected files other than NDJSON ignored, got %v", err)
+	}
+	if files, _ := svc.IngestFiles(); len(files) != 3 {
+		t.Errorf("Expected 3 files, got %d", len(files))
+	}
+
+	// A notification retries a failed file
+	store.mu.Lock()
+	store.files["in/bad.ndjson"] = `{"id": "d"}`
+	store.mu.Unlock()
+	svc.ingest.mu.Lock()
+	svc.ingest.files["in/bad.ndjson"].ETag = `{"id": "d"}`
+	svc.ingest.mu.Unlock()
+	if err := svc.NotifyIngest([]string{"in/bad.ndjson"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "failed file retried", func() bool {
+		return ingestStatus(svc, "in/bad.ndjson") == models.ScanCompleted
+	})
+
+	// A new file is picked up on notification, a replaced one ingested again
+	store.put("in/f.ndjson", `{"id": "f", "n": 6}`)
+	store.put("in/a.ndjson", `{"id": "a", "n": 10}`)
+	svc.NotifyIngest(nil)
+	waitFor(t, "new and replaced files ingested", func() bool {
+		file, _ := svc.IngestFile("in/a.ndjson")
+		return ingestStatus(svc, "in/f.ndjson") == models.ScanCompleted &&
+			file.Status == models.ScanCompleted && file.Rows == 1
+	})
+	svc.Close()
+
+	// The state survives a restart, completed files are not ingested again
+	restarted, _ := newMockService()
+	defer restarted.Close()
+	if err := restarted.StartIngest(store, cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	file, err := restarted.IngestFile("in/f.ndjson")
+	if err != nil || file.Status != models.ScanCompleted {
+		t.Errorf("Expected the completed status restored, got %+v, %v", file, err)
+	}
+}
+
+func TestService_IngestDisabled(t *testing.T) {
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	if _, err := svc.IngestFiles(); !errors.Is(err, models.ErrIngestDisabled) {
+		t.Errorf("Expected ErrIngestDisabled, got %v", err)
+	}
+	if err := svc.NotifyIngest(nil); !errors.Is(err, models.ErrIngestDisabled) {
+		t.Errorf("Expected ErrIngestDisabled, got %v", err)
+	}
+}
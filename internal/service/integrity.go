@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// maxIntegrityMismatches bounds the mismatches listed in a report
+const maxIntegrityMismatches = 1000
+
+// StartIntegrityCheck starts re-hashing every stored value in the background
+// and comparing it with the hash stored on write, which finds corrupted
+// values and edits made outside the service. Only one check runs at a time
+func (s *Service) StartIntegrityCheck() (*models.IntegrityReport, error) {
+	report := &models.IntegrityReport{
+		Status:     models.ScanRunning,
+		StartedAt:  time.Now(),
+		Mismatches: []*models.IntegrityMismatch{},
+	}
+
+	err := s.integrity.start(report, func(ctx context.Context) *models.IntegrityReport {
+		result := s.verifyIntegrity(ctx, report.StartedAt)
+		if result.Error != "" {
+			log.Printf("Integrity check failed after %d records: %s", result.Scanned, result.Error)
+			return result
+		}
+
+		s.metrics.SetIntegrityResult(result.Mismatched, result.Unhashed, *result.FinishedAt)
+		if result.Mismatched > 0 {
+			log.Printf("Integrity check found %d of %d records not matching their hash",
+				result.Mismatched, result.Scanned)
+		} else {
+			log.Printf("Integrity check passed: %d records verified, %d without hash",
+				result.Scanned-result.Unhashed, result.Unhashed)
+		}
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// IntegrityReport returns the running or last finished integrity check, nil
+// when none was started
+func (s *Service) IntegrityReport() *models.IntegrityReport {
+	return s.integrity.last()
+}
+
+// verifyIntegrity compares the hash of every stored value with its stored
+// hash. Records written before hashes were kept are only counted
+func (s *Service) verifyIntegrity(ctx context.Context, startedAt time.Time) *models.IntegrityReport {
+	report := &models.IntegrityReport{
+		Status:     models.ScanCompleted,
+		StartedAt:  startedAt,
+		Mismatches: []*models.IntegrityMismatch{},
+	}
+	defer func() {
+		now := time.Now()
+		report.FinishedAt = &now
+	}()
+
+	err := s.scanRecords(ctx, func(record *models.Record) {
+		report.Scanned++
+		if record.Hash == "" {
+			report.Unhashed++
+			return
+		}
+
+		hash, err := models.ValueHash(record.Value)
+		if err == nil && hash == record.Hash {
+			return
+		}
+
+		report.Mismatched++
+		if len(report.Mismatches) < maxIntegrityMismatches {
+			report.Mismatches = append(report.Mismatches, &models.IntegrityMismatch{
+				ID:           record.ID,
+				StoredHash:   record.Hash,
+				ComputedHash: hash,
+			})
+		} else {
+			report.Truncated = true
+		}
+	})
+	if err != nil {
+		report.Status = models.ScanFailed
+		report.Error = fmt.Sprintf("failed to list records: %v", err)
+	}
+
+	return report
+}
+
+// integrityMonitor starts an integrity check every interval
+type integrityMonitor struct {
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// StartIntegrityMonitor runs an integrity check every interval, skipping a
+// tick while an admin-triggered check is still running
+func (s *Service) StartIntegrityMonitor(interval time.Duration) {
+	m := &integrityMonitor{stopCh: make(chan struct{})}
+	s.integrityMonitor = m
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+				if _, err := s.StartIntegrityCheck(); err != nil && !errors.Is(err, models.ErrScanRunning) {
+					log.Printf("Integrity monitor: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops starting new checks, a running check is stopped with the service
+func (m *integrityMonitor) Stop() {
+	m.once.Do(func() { close(m.stopCh) })
+	m.wg.Wait()
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_IntegrityCheck(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"id": id})}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	record, _ := mock.Get(ctx, "a")
+	expected, _ := models.ValueHash(map[string]interface{}{"id": "a"})
+	if record.Hash != expected {
+		t.Fatalf("Expected stored hash %s, got %s", expected, record.Hash)
+	}
+
+	// An edit that bypassed the service leaves the old hash behind
+	mock.SetValueForTesting("b", map[string]interface{}{"id": "tampered"})
+
+	svc := NewService(repo, metrics.NewMetrics())
+	defer svc.Close()
+
+	report, err := svc.StartIntegrityCheck()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for report.Status == models.ScanRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the integrity check")
+		}
+		time.Sleep(10 * time.Millisecond)
+		report = svc.IntegrityReport()
+	}
+
+	if report.Status != models.ScanCompleted || report.Scanned != 3 {
+		t.Fatalf("Expected a completed check of 3 records, got %+v", report)
+	}
+	if report.Mismatched != 1 || len(report.Mismatches) != 1 || report.Mismatches[0].ID != "b" {
+		t.Fatalf("Expected record b to mismatch, got %+v", report.Mismatches)
+	}
+	if m := report.Mismatches[0]; m.StoredHash == m.ComputedHash {
+		t.Errorf("Expected different stored and computed hashes, got %s", m.StoredHash)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/repository"
+)
+
+// metricsCollector periodically samples runtime stats, the database
+// connection pools, the inbox queue depth (also per tenant with tenant
+// labels) and backlog age and the worker utilization into the metrics, so
+// snapshots and Prometheus scrapes read current values without computing
+// them. Sampling the pools regularly also
+// makes requests waiting for connections show up as pool exhaustion rather
+// than just a high response time
+type metricsCollector struct {
+	repo     *repository.RepositoryManager
+	metrics  *metrics.Metrics
+	worker   func() *InboxWorker
+	interval time.Duration
+
+	// lastSample and lastBusy are the time and busy time of each worker
+	// goroutine of the previous sample, utilization is measured between
+	// samples
+	lastSample time.Time
+	lastBusy   []int64
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// newMetricsCollector creates a collector sampling every interval. worker
+// returns the inbox worker, nil while it is not running
+func newMetricsCollector(repo *repository.RepositoryManager, m *metrics.Metrics, worker func() *InboxWorker, interval time.Duration) *metricsCollector {
+	return &metricsCollector{
+		repo:     repo,
+		metrics:  m,
+		worker:   worker,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start samples once right away and then on every tick
+func (c *metricsCollector) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		c.collect()
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case <-ticker.C:
+				c.collect()
+			}
+		}
+	}()
+}
+
+// Stop stops the collector and waits for a running sample to finish
+func (c *metricsCollector) Stop() {
+	c.once.Do(func() { close(c.stopCh) })
+	c.wg.Wait()
+}
+
+// collect takes a sample of every source
+func (c *metricsCollector) collect() {
+	c.metrics.UpdateSystemMetrics()
+
+	for pool, stats := range c.repo.PoolStats() {
+		c.metrics.SetPoolStats(pool, stats)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	stats, err := c.repo.Inbox.GetTaskStats(ctx)
+	if err != nil {
+		log.Printf("Metrics collector: failed to get task stats: %v", err)
+	} else {
+		c.metrics.SetQueueDepth(int64(stats.PendingTasks + stats.ProcessingTasks))
+
+		var age time.Duration
+		if stats.OldestPendingAt != nil {
+			age = time.Since(*stats.OldestPendingAt)
+		}
+		c.metrics.SetOldestPendingAge(age)
+	}
+
+	if c.metrics.TenantLabels() {
+		depths, err := c.repo.Inbox.CountOpenTasksByTenant(ctx)
+		if err != nil {
+			log.Printf("Metrics collector: failed to count tasks by tenant: %v", err)
+		} else {
+			c.metrics.SetTenantQueueDepth(depths)
+		}
+	}
+
+	c.collectUtilization()
+}
+
+// collectUtilization sets the percentage of the time since the previous
+// sample each worker goroutine spent processing batches, and their average.
+// The first sample only records the starting point
+func (c *metricsCollector) collectUtilization() {
+	w := c.worker()
+	if w == nil || w.workerCount == 0 {
+		return
+	}
+
+	now := time.Now()
+	busy := workerBusyTimes(w, now)
+	previous, previousBusy := c.lastSample, c.lastBusy
+	c.lastSample, c.lastBusy = now, busy
+	elapsed := now.Sub(previous)
+	if previous.IsZero() || len(previousBusy) != len(busy) || elapsed <= 0 {
+		return
+	}
+
+	byWorker := make([]float64, len(busy))
+	var total float64
+	for i := range busy {
+		utilization := float64(busy[i]-previousBusy[i]) / float64(elapsed) * 100
+		// Batches finishing while a sample is taken may be counted twice
+		utilization = math.Max(0, math.Min(utilization, 100))
+		byWorker[i] = utilization
+		total += utilization
+	}
+	c.metrics.SetWorkerUtilization(total/float64(len(busy)), byWorker)
+}
+
+// workerBusyTimes returns the time each worker goroutine has spent
+// processing batches until now, including a running batch
+func workerBusyTimes(w *InboxWorker, now time.Time) []int64 {
+	busy := make([]int64, len(w.busy))
+	for i := range busy {
+		busy[i] = atomic.LoadInt64(&w.busy[i])
+		if since := atomic.LoadInt64(&w.busySince[i]); since > 0 {
+			busy[i] += now.UnixNano() - since
+		}
+	}
+	return busy
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestMetricsCollector_Collect(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	for _, id := range []string{"user_1", "user_2", "user_3"} {
+		if _, err := svc.Insert(ctx, &models.InsertRequest{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"name": id})}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	worker := &InboxWorker{workerCount: 2, busy: make([]int64, 2), busySince: make([]int64, 2)}
+	collector := newMetricsCollector(svc.repo, svc.metrics, func() *InboxWorker { return worker }, time.Hour)
+
+	// Snapshots only report what was sampled
+	if snapshot := svc.metrics.GetSnapshot(); snapshot.GoroutineCount != 0 || snapshot.QueueDepth != 0 {
+		t.Errorf("Expected nothing sampled yet, got %d goroutines and depth %d", snapshot.GoroutineCount, snapshot.QueueDepth)
+	}
+
+	collector.collect()
+	snapshot := svc.metrics.GetSnapshot()
+	if snapshot.GoroutineCount == 0 || snapshot.MemoryUsageMB == 0 {
+		t.Errorf("Expected runtime stats sampled, got %d goroutines and %vMB", snapshot.GoroutineCount, snapshot.MemoryUsageMB)
+	}
+	if snapshot.QueueDepth != 3 {
+		t.Errorf("Expected a queue depth of 3, got %d", snapshot.QueueDepth)
+	}
+	if snapshot.OldestPendingAge <= 0 {
+		t.Errorf("Expected the age of the oldest pending task, got %v", snapshot.OldestPendingAge)
+	}
+
+	// Over the second since the last sample, one worker finished a batch
+	// of half a second and the other has been running one all the time
+	now := time.Now()
+	collector.lastSample = now.Add(-time.Second)
+	worker.busy[0] = int64(500 * time.Millisecond)
+	worker.busySince[1] = now.Add(-2 * time.Second).UnixNano()
+	collector.lastBusy = []int64{0, int64(time.Second)}
+	collector.collect()
+
+	snapshot = svc.metrics.GetSnapshot()
+	byWorker := snapshot.WorkerUtilizationByWorker
+	if len(byWorker) != 2 || byWorker[0] < 45 || byWorker[0] > 50 || byWorker[1] < 95 {
+		t.Errorf("Expected workers busy about 50%% and 100%% of the time, got %v", byWorker)
+	}
+	if snapshot.WorkerUtilization < 70 || snapshot.WorkerUtilization > 75 {
+		t.Errorf("Expected a utilization of about 75%%, got %v", snapshot.WorkerUtilization)
+	}
+	if health := snapshot.GetHealthStatus(); len(health.Issues) != 0 {
+		t.Errorf("Expected no issues below 90%%, got %v", health.Issues)
+	}
+}
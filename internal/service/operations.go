@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+	"mit-service/internal/schema"
+)
+
+// TaskHandler applies a custom task. records is bound to the transaction
+// completing the task when records and inbox share a database
+type TaskHandler func(ctx context.Context, records repository.RecordRepository, payload json.RawMessage) error
+
+// TaskOperation is a custom inbox task operation
+type TaskOperation struct {
+	// Name is stored as the task operation, e.g. "reindex"
+	Name string
+
+	// PayloadSchema validates payloads at enqueue time and again before the
+	// handler runs, nil accepts any JSON payload
+	PayloadSchema *schema.Schema
+
+	// Handler applies the task
+	Handler TaskHandler
+}
+
+// OperationRegistry holds the custom task operations known to the service
+// and its worker
+type OperationRegistry struct {
+	mu  sync.RWMutex
+	ops map[string]*TaskOperation
+}
+
+// NewOperationRegistry creates an empty registry
+func NewOperationRegistry() *OperationRegistry {
+	return &OperationRegistry{ops: make(map[string]*TaskOperation)}
+}
+
+// Register adds a custom operation. Built-in operations cannot be replaced
+func (r *OperationRegistry) Register(op TaskOperation) error {
+	if op.Name == "" || op.Handler == nil {
+		return fmt.Errorf("task operation needs a name and a handler")
+	}
+	if isBuiltinOperation(op.Name) {
+		return fmt.Errorf("task operation '%s' is built in", op.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.ops[op.Name]; exists {
+		return fmt.Errorf("task operation '%s' is already registered", op.Name)
+	}
+	r.ops[op.Name] = &op
+	return nil
+}
+
+// Lookup returns a registered custom operation
+func (r *OperationRegistry) Lookup(name string) (*TaskOperation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	op, ok := r.ops[name]
+	return op, ok
+}
+
+// Names returns the registered custom operation names, sorted
+func (r *OperationRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.ops))
+	for name := range r.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validatePayload checks a payload against the operation's schema
+func (op *TaskOperation) validatePayload(payload json.RawMessage) error {
+	if op.PayloadSchema == nil {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return fmt.Errorf("%w for operation '%s': invalid JSON: %v", models.ErrSchemaValidation, op.Name, err)
+	}
+	if err := op.PayloadSchema.Validate(value); err != nil {
+		return fmt.Errorf("%w for operation '%s': %v", models.ErrSchemaValidation, op.Name, err)
+	}
+	return nil
+}
+
+// isBuiltinOperation reports whether name is insert, update or delete
+func isBuiltinOperation(name string) bool {
+	switch name {
+	case models.TaskOperationInsert, models.TaskOperationUpdate, models.TaskOperationDelete:
+		return true
+	}
+	return false
+}
+
+// WithOperationRegistry makes the worker process the custom operations of
+// registry, sharing it with the service that enqueues them
+func WithOperationRegistry(registry *OperationRegistry) WorkerOption {
+	return func(w *InboxWorker) {
+		w.operations = registry
+	}
+}
+
+// WithTaskOperation registers a custom operation on the worker
+func WithTaskOperation(op TaskOperation) WorkerOption {
+	return func(w *InboxWorker) {
+		if err := w.operations.Register(op); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterOperation adds a custom operation the worker can process
+func (w *InboxWorker) RegisterOperation(op TaskOperation) error {
+	return w.operations.Register(op)
+}
+
+// applyCustomTask runs a custom operation registered in operations
+func applyCustomTask(ctx context.Context, operations *OperationRegistry, records repository.RecordRepository, task *models.InboxTask) error {
+	op, ok := operations.Lookup(task.Operation)
+	if !ok {
+		return fmt.Errorf("%w: %s", models.ErrInvalidTaskOperation, task.Operation)
+	}
+
+	if err := op.validatePayload(task.Payload); err != nil {
+		return err
+	}
+	return op.Handler(ctx, records, task.Payload)
+}
+
+// RegisterOperation adds a custom task operation that can be enqueued
+// through the service and processed by its worker
+func (s *Service) RegisterOperation(op TaskOperation) error {
+	return s.operations.Register(op)
+}
+
+// EnqueueTask queues a task of a registered custom operation
+func (s *Service) EnqueueTask(ctx context.Context, req *models.EnqueueTaskRequest) (*models.InboxTask, error) {
+	op, ok := s.operations.Lookup(req.Operation)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidTaskOperation, req.Operation)
+	}
+
+	payload := req.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage(`{}`)
+	}
+	if err := op.validatePayload(payload); err != nil {
+		return nil, err
+	}
+
+	taskID, err := newTaskID(ctx, req.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	task := &models.InboxTask{
+		ID:        taskID,
+		Operation: req.Operation,
+		Payload:   payload,
+		Status:    models.TaskStatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Retries:   0,
+	}
+	if err := s.repo.Inbox.CreateTask(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to create %s task: %w", req.Operation, err)
+	}
+
+	return unscopedTask(ctx, task), nil
+}
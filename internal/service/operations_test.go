@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+	"mit-service/internal/schema"
+)
+
+func TestOperationRegistry_CustomTask(t *testing.T) {
+	payloadSchema, err := schema.Compile([]byte(`{"type":"object","required":["id"]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var reindexed string
+	registry := NewOperationRegistry()
+	err = registry.Register(TaskOperation{
+		Name:          "reindex",
+		PayloadSchema: payloadSchema,
+		Handler: func(ctx context.Context, records repository.RecordRepository, payload json.RawMessage) error {
+			var p struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return err
+			}
+			reindexed = p.ID
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	handler := func(context.Context, repository.RecordRepository, json.RawMessage) error { return nil }
+	if err := registry.Register(TaskOperation{Name: "reindex", Handler: handler}); err == nil {
+		t.Error("Expected error registering a duplicate operation")
+	}
+	if err := registry.Register(TaskOperation{Name: models.TaskOperationInsert, Handler: handler}); err == nil {
+		t.Error("Expected error replacing a built-in operation")
+	}
+
+	records := repository.NewMockRepository()
+	ctx := context.Background()
+
+	task := &models.InboxTask{Operation: "reindex", Payload: []byte(`{"id":"rec-1"}`)}
+	if err := applyCustomTask(ctx, registry, records, task); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reindexed != "rec-1" {
+		t.Errorf("Expected handler to reindex rec-1, got %q", reindexed)
+	}
+
+	task = &models.InboxTask{Operation: "reindex", Payload: []byte(`{}`)}
+	if err := applyCustomTask(ctx, registry, records, task); !errors.Is(err, models.ErrSchemaValidation) {
+		t.Errorf("Expected schema validation error, got %v", err)
+	}
+
+	task = &models.InboxTask{Operation: "enrich", Payload: []byte(`{}`)}
+	if err := applyCustomTask(ctx, registry, records, task); !errors.Is(err, models.ErrInvalidTaskOperation) {
+		t.Errorf("Expected invalid operation error, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"mit-service/internal/models"
+)
+
+// Patch queues the update of a record to its current value merged with
+// req.Value as a JSON merge patch (RFC 7386): members set to null are
+// removed, objects are merged recursively and other values replace the
+// current ones. The value is merged when the patch is requested; only a
+// patch expecting a version fails with ErrVersionConflict when a write was
+// applied in between, others overwrite it
+func (s *Service) Patch(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error) {
+	record, err := s.Get(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Encoding == models.EncodingProtobuf {
+		return nil, fmt.Errorf("%w: record '%s' holds a protobuf message", models.ErrInvalidPatch, req.ID)
+	}
+	current, err := record.DecodedValue()
+	if err != nil {
+		return nil, err
+	}
+
+	var patch map[string]interface{}
+	if !models.IsObjectValue(req.Value) || models.UnmarshalValue(req.Value, &patch) != nil {
+		return nil, fmt.Errorf("%w: the patch must be a JSON object", models.ErrInvalidPatch)
+	}
+	merged, err := json.Marshal(mergePatch(current, patch))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode patched value: %w", err)
+	}
+
+	patched := *req
+	patched.Value = merged
+	return s.Update(ctx, &patched)
+}
+
+// mergePatch applies patch to target as RFC 7386 describes, a target that
+// is not an object is replaced. Objects of target are modified in place
+func mergePatch(target interface{}, patch map[string]interface{}) map[string]interface{} {
+	merged, ok := target.(map[string]interface{})
+	if !ok {
+		merged = map[string]interface{}{}
+	}
+	for name, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(merged, name)
+		case map[string]interface{}:
+			merged[name] = mergePatch(merged[name], value)
+		default:
+			merged[name] = value
+		}
+	}
+	return merged
+}
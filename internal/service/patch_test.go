@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestService_Patch(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	value := json.RawMessage(`{"name": "Ada", "balance": 12345678901234567890, "address": {"city": "London", "zip": "N1"}, "tags": ["a"]}`)
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: value}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	record, _ := mock.Get(ctx, "user_1")
+
+	patch := func() *models.InboxTask {
+		t.Helper()
+		task, err := svc.Patch(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{
+			"name":    nil,
+			"address": map[string]interface{}{"zip": nil, "street": "Main St"},
+			"tags":    []interface{}{"b"},
+		})})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return task
+	}
+	task := patch()
+	// A patch queued right after it, e.g. a client retrying, is not failed
+	// by the first one
+	second := patch()
+	var payload models.UpdateTaskPayload
+	json.Unmarshal(second.Payload, &payload)
+	if payload.ExpectedVersion != 0 {
+		t.Errorf("Expected the update to expect no version, got %d", payload.ExpectedVersion)
+	}
+
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	waitFor(t, "the patches", func() bool {
+		first, _ := mock.GetTask(ctx, task.ID)
+		second, _ := mock.GetTask(ctx, second.ID)
+		return first.Status == models.TaskStatusCompleted && second.Status == models.TaskStatusCompleted
+	})
+	patched, _ := mock.Get(ctx, "user_1")
+	var got interface{}
+	patched.DecodeValue(&got)
+	gotJSON, _ := json.Marshal(got)
+	if expected := `{"address":{"city":"London","street":"Main St"},"balance":12345678901234567890,"tags":["b"]}`; string(gotJSON) != expected {
+		t.Errorf("Expected %s merged, got %s", expected, gotJSON)
+	}
+
+	// A stale expected version is not replaced by the version read
+	if _, err := svc.Patch(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Eve"}), ExpectedVersion: record.Version}); !errors.Is(err, models.ErrVersionConflict) {
+		t.Errorf("Expected a version conflict, got %v", err)
+	}
+	if _, err := svc.Patch(ctx, &models.UpdateRequest{ID: "user_2", Value: models.MustEncodeValue(map[string]interface{}{"name": "Eve"})}); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected a missing record not found, got %v", err)
+	}
+
+	if err := mock.Insert(ctx, &models.Record{ID: "msg_1", Type: "msg", Value: models.ProtoValue([]byte{8, 1}), Encoding: models.EncodingProtobuf}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Patch(ctx, &models.UpdateRequest{ID: "msg_1", Value: models.MustEncodeValue(map[string]interface{}{"id": 2})}); !errors.Is(err, models.ErrInvalidPatch) {
+		t.Errorf("Expected protobuf records rejected, got %v", err)
+	}
+}
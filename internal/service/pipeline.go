@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"mit-service/internal/models"
+)
+
+// TaskStep processes a task
+type TaskStep func(ctx context.Context, task *models.InboxTask) error
+
+// TaskMiddleware wraps the rest of the task pipeline. Work done before
+// calling next sees the validated and enriched task; work done after next
+// returns nil runs once the task is persisted, e.g. publishing events or
+// sending notifications. Returning an error fails the task and retries the
+// whole pipeline, so work after persist must tolerate running again
+type TaskMiddleware func(next TaskStep) TaskStep
+
+// WithTaskMiddleware adds middleware to the task pipeline. Middleware runs in
+// the order given, between the built-in validate/transform stages and persist
+func WithTaskMiddleware(middleware ...TaskMiddleware) WorkerOption {
+	return func(w *InboxWorker) {
+		w.middleware = append(w.middleware, middleware...)
+	}
+}
+
+// withWriteMiddleware adds the middleware acting on persisted writes. It runs
+// innermost, after the middleware added with WithTaskMiddleware
+func withWriteMiddleware(middleware ...TaskMiddleware) WorkerOption {
+	return func(w *InboxWorker) {
+		w.writes = append(w.writes, middleware...)
+	}
+}
+
+// buildPipeline chains validate → transform → middleware → persist
+func (w *InboxWorker) buildPipeline() TaskStep {
+	middleware := append(slices.Clone(w.middleware), w.writes...)
+	return w.validateStage(w.transformStage(chainMiddleware(middleware, w.persistTask)))
+}
+
+// chainMiddleware wraps step in middleware, the first running outermost
+func chainMiddleware(middleware []TaskMiddleware, step TaskStep) TaskStep {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		step = middleware[i](step)
+	}
+	return step
+}
+
+// validateStage rejects tasks of unknown operations before any other stage
+func (w *InboxWorker) validateStage(next TaskStep) TaskStep {
+	return func(ctx context.Context, task *models.InboxTask) error {
+		end := taskTraceFromContext(ctx).enter("validate")
+		err := validateOperation(w.operations, task.Operation)
+		end(err)
+		if err != nil {
+			return err
+		}
+		return next(ctx, task)
+	}
+}
+
+// validateOperation rejects operations that are neither built in nor
+// registered in operations
+func validateOperation(operations *OperationRegistry, operation string) error {
+	if isBuiltinOperation(operation) {
+		return nil
+	}
+	if _, ok := operations.Lookup(operation); !ok {
+		return fmt.Errorf("%w: %s", models.ErrInvalidTaskOperation, operation)
+	}
+	return nil
+}
+
+// transformStage enriches the task payload before it is persisted
+func (w *InboxWorker) transformStage(next TaskStep) TaskStep {
+	return func(ctx context.Context, task *models.InboxTask) error {
+		end := taskTraceFromContext(ctx).enter("transform")
+		err := w.enrichTask(ctx, task)
+		end(err)
+		if err != nil {
+			return err
+		}
+		return next(ctx, task)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestInboxWorker_PipelineMiddleware(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+
+	var calls []string
+	trace := func(name string) TaskMiddleware {
+		return func(next TaskStep) TaskStep {
+			return func(ctx context.Context, task *models.InboxTask) error {
+				calls = append(calls, name+":before")
+				if err := next(ctx, task); err != nil {
+					return err
+				}
+				if _, err := mock.Get(ctx, "a"); err != nil {
+					t.Errorf("%s: expected record to be persisted: %v", name, err)
+				}
+				calls = append(calls, name+":after")
+				return nil
+			}
+		}
+	}
+
+	w := NewInboxWorker(repo, metrics.NewMetrics(), 1, 1, time.Second, 1, time.Second,
+		WithTaskMiddleware(trace("publish"), trace("notify")))
+
+	ctx := context.Background()
+	task := &models.InboxTask{
+		ID:        "t1",
+		Operation: models.TaskOperationInsert,
+		Payload:   []byte(`{"id":"a","value":{"name":"x"}}`),
+	}
+	if err := w.pipeline(ctx, task); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"publish:before", "notify:before", "notify:after", "publish:after"}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Call %d: expected %s, got %s", i, expected[i], calls[i])
+		}
+	}
+
+	// Unknown operations are rejected before any middleware runs
+	calls = nil
+	err := w.pipeline(ctx, &models.InboxTask{ID: "t2", Operation: "reindex", Payload: []byte(`{}`)})
+	if !errors.Is(err, models.ErrInvalidTaskOperation) {
+		t.Errorf("Expected invalid operation error, got %v", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("Expected no middleware calls, got %v", calls)
+	}
+}
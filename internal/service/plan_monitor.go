@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// monitoredEndpoints are the endpoints whose queries the plan monitor
+// watches, with the parameters they are planned with. /get is planned for a
+// sample record ID
+var monitoredEndpoints = []struct {
+	endpoint string
+	params   url.Values
+}{
+	{"/get", nil},
+	{"/records", nil},
+	{"/tasks", url.Values{"status": {string(models.TaskStatusPending)}}},
+}
+
+// planSummary is what the plan monitor compares between two plans of a query
+type planSummary struct {
+	cost float64
+	// seqScans are the relations read by sequential scans
+	seqScans []string
+}
+
+// planBaseline is the last healthy plan of a query
+type planBaseline struct {
+	planSummary
+	// regressed is set while the latest plan is a regression of the
+	// baseline, so a regression is reported once
+	regressed bool
+}
+
+// planMonitor periodically plans the hot queries and reports plans that
+// turn into sequential scans or whose cost jumps beyond costFactor times
+// the baseline, catching index regressions after migrations
+type planMonitor struct {
+	repo       *repository.RepositoryManager
+	metrics    *metrics.Metrics
+	interval   time.Duration
+	costFactor float64
+
+	// explain plans the queries of an endpoint without running them
+	explain func(ctx context.Context, endpoint string, params url.Values) ([]*models.QueryPlan, error)
+
+	mu        sync.Mutex
+	baselines map[string]*planBaseline
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// newPlanMonitor creates a monitor planning the hot queries every interval
+func newPlanMonitor(repo *repository.RepositoryManager, m *metrics.Metrics, interval time.Duration, costFactor float64) *planMonitor {
+	return &planMonitor{
+		repo:       repo,
+		metrics:    m,
+		interval:   interval,
+		costFactor: costFactor,
+		explain: func(ctx context.Context, endpoint string, params url.Values) ([]*models.QueryPlan, error) {
+			return repo.ExplainQueries(ctx, endpoint, params, false)
+		},
+		baselines: make(map[string]*planBaseline),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start collects once right away and then on every tick
+func (p *planMonitor) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		p.collect()
+		for {
+			select {
+			case <-p.stopCh:
+				return
+			case <-ticker.C:
+				p.collect()
+			}
+		}
+	}()
+}
+
+// Stop stops the monitor and waits for a running collection to finish
+func (p *planMonitor) Stop() {
+	p.once.Do(func() { close(p.stopCh) })
+	p.wg.Wait()
+}
+
+// collect plans the monitored queries and compares them with their baselines
+func (p *planMonitor) collect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, monitored := range monitoredEndpoints {
+		params := monitored.params
+		if monitored.endpoint == "/get" {
+			id, err := p.sampleID(ctx)
+			if err != nil {
+				log.Printf("Plan monitor: failed to pick a record for /get: %v", err)
+				continue
+			}
+			if id == "" {
+				continue
+			}
+			params = url.Values{"id": {id}}
+		}
+
+		plans, err := p.explain(ctx, monitored.endpoint, params)
+		if err != nil {
+			log.Printf("Plan monitor: failed to plan %s: %v", monitored.endpoint, err)
+			continue
+		}
+		for _, plan := range plans {
+			summary, err := summarizePlan(plan.Plan)
+			if err != nil {
+				log.Printf("Plan monitor: %s: %v", plan.Name, err)
+				continue
+			}
+			p.observe(plan.Name, summary)
+		}
+	}
+}
+
+// sampleID returns the ID of a stored record to plan /get with, empty when
+// there are no records
+func (p *planMonitor) sampleID(ctx context.Context) (string, error) {
+	records, err := p.repo.Record.ListRecords(ctx, models.RecordFilter{ExcludePrefix: "_system/", Limit: 1})
+	if err != nil || len(records) == 0 {
+		return "", err
+	}
+	return records[0].ID, nil
+}
+
+// observe compares the latest plan of a query with its baseline. A healthy
+// plan becomes the new baseline; a regression keeps the old one, so the cost
+// does not creep up unnoticed, and is reported when it first appears
+func (p *planMonitor) observe(query string, summary planSummary) {
+	p.metrics.SetQueryPlanCost(query, summary.cost)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	baseline, ok := p.baselines[query]
+	if !ok {
+		p.baselines[query] = &planBaseline{planSummary: summary}
+		return
+	}
+
+	reason, detail := "", ""
+	if scans := newSeqScans(baseline.seqScans, summary.seqScans); len(scans) > 0 {
+		reason, detail = "seq_scan", fmt.Sprintf("sequential scan of %v", scans)
+	} else if baseline.cost > 0 && summary.cost > baseline.cost*p.costFactor {
+		reason, detail = "cost", fmt.Sprintf("cost %.2f, was %.2f", summary.cost, baseline.cost)
+	}
+
+	if reason == "" {
+		if baseline.regressed {
+			log.Printf("Plan monitor: plan of %s recovered (cost %.2f)", query, summary.cost)
+		}
+		p.baselines[query] = &planBaseline{planSummary: summary}
+		return
+	}
+	if !baseline.regressed {
+		baseline.regressed = true
+		p.metrics.RecordPlanRegression(query, reason)
+		log.Printf("Plan monitor: plan of %s regressed: %s", query, detail)
+	}
+}
+
+// newSeqScans returns the relations in current scanned sequentially that
+// were not in baseline
+func newSeqScans(baseline, current []string) []string {
+	known := make(map[string]bool, len(baseline))
+	for _, relation := range baseline {
+		known[relation] = true
+	}
+
+	var added []string
+	for _, relation := range current {
+		if !known[relation] {
+			added = append(added, relation)
+		}
+	}
+	return added
+}
+
+// planNode is the part of an EXPLAIN (FORMAT JSON) plan node the monitor reads
+type planNode struct {
+	NodeType  string     `json:"Node Type"`
+	Relation  string     `json:"Relation Name"`
+	TotalCost float64    `json:"Total Cost"`
+	Plans     []planNode `json:"Plans"`
+}
+
+// summarizePlan returns the total cost of a plan and the relations it scans
+// sequentially
+func summarizePlan(plan json.RawMessage) (planSummary, error) {
+	var root planNode
+	if err := json.Unmarshal(plan, &root); err != nil {
+		return planSummary{}, fmt.Errorf("failed to parse plan: %w", err)
+	}
+
+	summary := planSummary{cost: root.TotalCost}
+	var walk func(node planNode)
+	walk = func(node planNode) {
+		if node.NodeType == "Seq Scan" {
+			summary.seqScans = append(summary.seqScans, node.Relation)
+		}
+		for _, child := range node.Plans {
+			walk(child)
+		}
+	}
+	walk(root)
+	return summary, nil
+}
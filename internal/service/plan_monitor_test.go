@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestPlanMonitor_Regressions(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: models.MustEncodeValue("v")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	indexScan := `{"Node Type": "Index Scan", "Relation Name": "records", "Total Cost": 8.3}`
+	plan := indexScan
+	var getParams url.Values
+	monitor := newPlanMonitor(svc.repo, svc.metrics, time.Hour, 5)
+	monitor.explain = func(ctx context.Context, endpoint string, params url.Values) ([]*models.QueryPlan, error) {
+		if endpoint != "/get" {
+			return nil, nil
+		}
+		getParams = params
+		return []*models.QueryPlan{{Name: "Get", Plan: json.RawMessage(plan)}}, nil
+	}
+
+	check := func(step string, regressed bool, cost float64) {
+		t.Helper()
+		monitor.collect()
+		baseline := monitor.baselines["Get"]
+		if baseline == nil {
+			t.Fatalf("%s: expected a baseline for Get", step)
+		}
+		if baseline.regressed != regressed || baseline.cost != cost {
+			t.Errorf("%s: expected regressed %v at cost %v, got %v at %v", step, regressed, cost, baseline.regressed, baseline.cost)
+		}
+	}
+
+	check("baseline", false, 8.3)
+	if getParams.Get("id") != "user_1" {
+		t.Errorf("Expected /get to be planned for user_1, got %v", getParams)
+	}
+
+	// A cheaper plan becomes the baseline
+	plan = `{"Node Type": "Index Scan", "Relation Name": "records", "Total Cost": 4.2}`
+	check("cheaper", false, 4.2)
+
+	// A sequential scan regresses and keeps the old baseline
+	plan = `{"Node Type": "Gather", "Total Cost": 30.0, "Plans": [{"Node Type": "Seq Scan", "Relation Name": "records", "Total Cost": 25.0}]}`
+	check("seq scan", true, 4.2)
+
+	plan = `{"Node Type": "Index Scan", "Relation Name": "records", "Total Cost": 4.5}`
+	check("recovered", false, 4.5)
+
+	// Cost beyond the factor regresses, within it does not
+	plan = `{"Node Type": "Index Scan", "Relation Name": "records", "Total Cost": 20.0}`
+	check("within factor", false, 20)
+	plan = `{"Node Type": "Index Scan", "Relation Name": "records", "Total Cost": 101.0}`
+	check("cost", true, 20)
+}
+
+func TestSummarizePlan(t *testing.T) {
+	summary, err := summarizePlan(json.RawMessage(`{"Node Type": "Hash Join", "Total Cost": 12.5, "Plans": [
+		{"Node Type": "Seq Scan", "Relation Name": "inbox_tasks"},
+		{"Node Type": "Hash", "Plans": [{"Node Type": "Seq Scan", "Relation Name": "records"}]}
+	]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.cost != 12.5 || len(summary.seqScans) != 2 || summary.seqScans[1] != "records" {
+		t.Errorf("Expected cost 12.5 with scans of inbox_tasks and records, got %+v", summary)
+	}
+
+	if _, err := summarizePlan(json.RawMessage(`[`)); err == nil {
+		t.Error("Expected an error for an invalid plan")
+	}
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mit-service/internal/models"
+	"mit-service/internal/protoschema"
+	"mit-service/internal/repository"
+	"mit-service/internal/reqtrace"
+)
+
+// protoRecordPrefix is where proto types are stored, next to the JSON
+// Schemas of record types
+const protoRecordPrefix = "_system/proto/"
+
+// cachedProto is a compiled proto type, nil when the type does not exist
+type cachedProto struct {
+	schema   *protoschema.Schema
+	loadedAt time.Time
+}
+
+// protoRegistry resolves proto types to compiled messages, caching lookups
+type protoRegistry struct {
+	records repository.RecordRepository
+
+	mu    sync.Mutex
+	cache map[string]cachedProto
+}
+
+// newProtoRegistry creates a registry reading proto types from records
+func newProtoRegistry(records repository.RecordRepository) *protoRegistry {
+	return &protoRegistry{
+		records: records,
+		cache:   make(map[string]cachedProto),
+	}
+}
+
+// lookup returns the compiled message of a proto type, wrapping
+// models.ErrUnknownRecordType when the type is not registered
+func (r *protoRegistry) lookup(ctx context.Context, name string) (*protoschema.Schema, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[name]
+	r.mu.Unlock()
+
+	fresh := ok && time.Since(cached.loadedAt) <= schemaCacheTTL
+	reqtrace.FromContext(ctx).CacheLookup("proto", name, fresh)
+	if !fresh {
+		record, err := r.records.Get(repository.WithSystemAccess(ctx), protoRecordPrefix+name)
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			cached = cachedProto{loadedAt: time.Now()}
+		case err != nil:
+			return nil, fmt.Errorf("failed to load proto type '%s': %w", name, err)
+		default:
+			protoType, err := protoTypeFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			compiled, err := protoschema.Compile(protoType.DescriptorSet, protoType.Message)
+			if err != nil {
+				return nil, fmt.Errorf("stored proto type '%s' is invalid: %w", name, err)
+			}
+			cached = cachedProto{schema: compiled, loadedAt: time.Now()}
+		}
+
+		r.mu.Lock()
+		r.cache[name] = cached
+		r.mu.Unlock()
+	}
+
+	if cached.schema == nil {
+		return nil, fmt.Errorf("proto type '%s': %w", name, models.ErrUnknownRecordType)
+	}
+	return cached.schema, nil
+}
+
+// invalidate drops a cached lookup after a local change
+func (r *protoRegistry) invalidate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, name)
+}
+
+// PutProtoType registers or replaces a proto type. Existing records are not
+// revalidated
+func (s *Service) PutProtoType(ctx context.Context, protoType *models.ProtoType) error {
+	if err := validateRecordTypeName(protoType.Name); err != nil {
+		return err
+	}
+	if _, err := protoschema.Compile(protoType.DescriptorSet, protoType.Message); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrInvalidSchema, err)
+	}
+
+	// Stored as JSON, so the descriptor set becomes a base64 string
+	encoded, err := json.Marshal(protoType)
+	if err != nil {
+		return fmt.Errorf("failed to encode proto type '%s': %w", protoType.Name, err)
+	}
+
+	record := &models.Record{ID: protoRecordPrefix + protoType.Name, Value: encoded}
+	err = s.repo.Record.Update(ctx, record)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		err = s.repo.Record.Insert(ctx, record)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store proto type '%s': %w", protoType.Name, err)
+	}
+
+	s.protos.invalidate(protoType.Name)
+	return nil
+}
+
+// GetProtoType returns a registered proto type
+func (s *Service) GetProtoType(ctx context.Context, name string) (*models.ProtoType, error) {
+	if err := validateRecordTypeName(name); err != nil {
+		return nil, err
+	}
+
+	record, err := s.repo.Record.Get(repository.WithSystemAccess(ctx), protoRecordPrefix+name)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return nil, fmt.Errorf("proto type '%s': %w", name, models.ErrUnknownRecordType)
+		}
+		return nil, fmt.Errorf("failed to get proto type '%s': %w", name, err)
+	}
+	return protoTypeFromRecord(record)
+}
+
+// ListProtoTypes returns all registered proto types
+func (s *Service) ListProtoTypes(ctx context.Context) ([]*models.ProtoType, error) {
+	types := []*models.ProtoType{}
+
+	filter := models.RecordFilter{Prefix: protoRecordPrefix, Limit: scanPageSize}
+	for {
+		records, err := s.repo.Record.ListRecords(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list proto types: %w", err)
+		}
+
+		for _, record := range records {
+			protoType, err := protoTypeFromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			types = append(types, protoType)
+		}
+		if len(records) < filter.Limit {
+			return types, nil
+		}
+		filter.AfterID = records[len(records)-1].ID
+	}
+}
+
+// DeleteProtoType removes a proto type. Types still used by records are kept
+// and the call fails with models.ErrRecordExists
+func (s *Service) DeleteProtoType(ctx context.Context, name string) error {
+	if err := validateRecordTypeName(name); err != nil {
+		return err
+	}
+
+	inUse, err := s.repo.Record.ListRecords(ctx, models.RecordFilter{Type: name, Limit: 1})
+	if err != nil {
+		return fmt.Errorf("failed to check proto type '%s' usage: %w", name, err)
+	}
+	if len(inUse) > 0 {
+		return fmt.Errorf("proto type '%s' is used by records and %w", name, models.ErrRecordExists)
+	}
+
+	if err := s.repo.Record.Delete(ctx, protoRecordPrefix+name); err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return fmt.Errorf("proto type '%s': %w", name, models.ErrUnknownRecordType)
+		}
+		return fmt.Errorf("failed to delete proto type '%s': %w", name, err)
+	}
+
+	s.protos.invalidate(name)
+	return nil
+}
+
+// InsertProto creates a record with a protobuf value asynchronously and
+// returns the queued task. The value is validated against its proto type;
+// transformations, scripts and JSON Schemas do not apply to it
+func (s *Service) InsertProto(ctx context.Context, req *models.ProtoWriteRequest) (*models.InboxTask, error) {
+	req = scopedProto(ctx, req)
+	if err := s.validateProto(ctx, req.Type, req.Data); err != nil {
+		return nil, err
+	}
+	if err := s.registerCollection(ctx); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(&models.InsertTaskPayload{ID: req.ID, Type: req.Type, Proto: req.Data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal insert payload: %w", err)
+	}
+
+	task := &models.InboxTask{
+		ID:        scopedTaskID(ctx, uuid.New().String()),
+		Operation: models.TaskOperationInsert,
+		Payload:   payload,
+		Status:    models.TaskStatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Retries:   0,
+		TenantID:  TenantFromContext(ctx),
+	}
+
+	if err := s.repo.Inbox.CreateTask(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to create insert task: %w", err)
+	}
+
+	s.accessStats.track(req.ID, true)
+	return unscopedTask(ctx, task), nil
+}
+
+// UpdateProto replaces the protobuf value of a record asynchronously and
+// returns the queued task. The record must exist and is validated against
+// its stored proto type; req.Type, when set, must match it
+func (s *Service) UpdateProto(ctx context.Context, req *models.ProtoWriteRequest) (*models.InboxTask, error) {
+	req = scopedProto(ctx, req)
+	record, err := s.repo.Record.Get(ctx, req.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load record type: %w", err)
+	}
+	if record.Encoding != models.EncodingProtobuf {
+		return nil, fmt.Errorf("%w: record '%s' is not stored as protobuf", models.ErrInvalidProto, req.ID)
+	}
+	if req.Type != "" && req.Type != record.Type {
+		return nil, fmt.Errorf("%w: record '%s' is of proto type '%s'", models.ErrInvalidProto, req.ID, record.Type)
+	}
+	if err := s.validateProto(ctx, record.Type, req.Data); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(&models.UpdateTaskPayload{ID: req.ID, Proto: req.Data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update payload: %w", err)
+	}
+
+	task := &models.InboxTask{
+		ID:        scopedTaskID(ctx, uuid.New().String()),
+		Operation: models.TaskOperationUpdate,
+		Payload:   payload,
+		Status:    models.TaskStatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Retries:   0,
+		TenantID:  TenantFromContext(ctx),
+	}
+
+	if err := s.enqueueForExisting(ctx, req.ID, 0, task); err != nil {
+		return nil, fmt.Errorf("failed to create update task: %w", err)
+	}
+
+	s.accessStats.track(req.ID, true)
+	return unscopedTask(ctx, task), nil
+}
+
+// RenderRecord returns a copy of a protobuf record with its value rendered
+// as JSON. Other records are returned as they are
+func (s *Service) RenderRecord(ctx context.Context, record *models.Record) (*models.Record, error) {
+	if record.Encoding != models.EncodingProtobuf {
+		return record, nil
+	}
+
+	compiled, err := s.protos.lookup(ctx, record.Type)
+	if err != nil {
+		return nil, err
+	}
+	data, err := record.ProtoData()
+	if err != nil {
+		return nil, err
+	}
+	value, err := compiled.JSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render record '%s': %w", record.ID, err)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render record '%s': %w", record.ID, err)
+	}
+
+	rendered := *record
+	rendered.Value, rendered.Encoding = encoded, ""
+	return &rendered, nil
+}
+
+// validateProto checks data against a proto type
+func (s *Service) validateProto(ctx context.Context, typeName string, data []byte) error {
+	if typeName == "" {
+		return fmt.Errorf("%w: a proto type is required", models.ErrInvalidProto)
+	}
+	compiled, err := s.protos.lookup(ctx, typeName)
+	if err != nil {
+		return err
+	}
+	if err := compiled.Validate(data); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrInvalidProto, err)
+	}
+	return nil
+}
+
+// protoTypeFromRecord converts a stored proto type record
+func protoTypeFromRecord(record *models.Record) (*models.ProtoType, error) {
+	var protoType models.ProtoType
+	if err := record.DecodeValue(&protoType); err != nil {
+		return nil, fmt.Errorf("failed to read proto type record '%s': %w", record.ID, err)
+	}
+	protoType.Name = strings.TrimPrefix(record.ID, protoRecordPrefix)
+	return &protoType, nil
+}
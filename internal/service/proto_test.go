@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"mit-service/internal/models"
+)
+
+// userProtoType is acme.v1.User with a required full_name and an age
+func userProtoType(t *testing.T) *models.ProtoType {
+	t.Helper()
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("acme/v1/user.proto"),
+		Package: proto.String("acme.v1"),
+		Syntax:  proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name: proto.String("full_name"), Number: proto.Int32(1),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum(),
+					Type:  descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				{
+					Name: proto.String("age"), Number: proto.Int32(2),
+					Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:  descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+				},
+			},
+		}},
+	}}}
+
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("Failed to marshal descriptor set: %v", err)
+	}
+	return &models.ProtoType{Name: "user", Message: "acme.v1.User", DescriptorSet: data}
+}
+
+// encodeUser encodes an acme.v1.User
+func encodeUser(name string, age uint64) []byte {
+	var data []byte
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	data = protowire.AppendString(data, name)
+	data = protowire.AppendTag(data, 2, protowire.VarintType)
+	return protowire.AppendVarint(data, age)
+}
+
+func TestService_ProtoTypes(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	invalid := userProtoType(t)
+	invalid.Message = "acme.v1.Account"
+	if err := svc.PutProtoType(ctx, invalid); !errors.Is(err, models.ErrInvalidSchema) {
+		t.Errorf("Expected ErrInvalidSchema, got %v", err)
+	}
+
+	if err := svc.PutProtoType(ctx, userProtoType(t)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	protoType, err := svc.GetProtoType(ctx, "user")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if protoType.Message != "acme.v1.User" || len(protoType.DescriptorSet) == 0 {
+		t.Errorf("Unexpected proto type %+v", protoType)
+	}
+	types, err := svc.ListProtoTypes(ctx)
+	if err != nil || len(types) != 1 || types[0].Name != "user" {
+		t.Errorf("Expected the user type, got %v, %v", types, err)
+	}
+
+	if err := svc.DeleteProtoType(ctx, "user"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.GetProtoType(ctx, "user"); !errors.Is(err, models.ErrUnknownRecordType) {
+		t.Errorf("Expected ErrUnknownRecordType, got %v", err)
+	}
+}
+
+func TestService_ProtoValues(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	if err := svc.PutProtoType(ctx, userProtoType(t)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Messages are validated before they are queued
+	_, err := svc.InsertProto(ctx, &models.ProtoWriteRequest{ID: "user_1", Type: "account", Data: encodeUser("Ada", 36)})
+	if !errors.Is(err, models.ErrUnknownRecordType) {
+		t.Errorf("Expected ErrUnknownRecordType, got %v", err)
+	}
+	nameless := protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), 36)
+	_, err = svc.InsertProto(ctx, &models.ProtoWriteRequest{ID: "user_1", Type: "user", Data: nameless})
+	if !errors.Is(err, models.ErrInvalidProto) {
+		t.Errorf("Expected ErrInvalidProto, got %v", err)
+	}
+
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond)
+	if _, err := svc.InsertProto(ctx, &models.ProtoWriteRequest{ID: "user_1", Type: "user", Data: encodeUser("Ada", 36)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var record *models.Record
+	waitFor(t, "the insert", func() bool {
+		record, _ = mock.Get(ctx, "user_1")
+		return record != nil
+	})
+	if record.Encoding != models.EncodingProtobuf || record.Type != "user" {
+		t.Errorf("Expected a protobuf record of type user, got %+v", record)
+	}
+
+	rendered, err := svc.RenderRecord(ctx, record)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var value map[string]interface{}
+	rendered.DecodeValue(&value)
+	if value["full_name"] != "Ada" || value["age"] != json.Number("36") || rendered.Encoding != "" {
+		t.Errorf("Expected the message rendered as JSON, got %+v", rendered)
+	}
+
+	// Updates keep the proto type of the record
+	_, err = svc.UpdateProto(ctx, &models.ProtoWriteRequest{ID: "user_1", Type: "account", Data: encodeUser("Ada", 37)})
+	if !errors.Is(err, models.ErrInvalidProto) {
+		t.Errorf("Expected ErrInvalidProto for another type, got %v", err)
+	}
+	if _, err := svc.UpdateProto(ctx, &models.ProtoWriteRequest{ID: "user_1", Data: encodeUser("Ada", 37)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the update", func() bool {
+		record, _ = mock.Get(ctx, "user_1")
+		rendered, err = svc.RenderRecord(ctx, record)
+		return err == nil && valueField(rendered, "age") == json.Number("37")
+	})
+
+	if err := svc.DeleteProtoType(ctx, "user"); !errors.Is(err, models.ErrRecordExists) {
+		t.Errorf("Expected ErrRecordExists for a type in use, got %v", err)
+	}
+	if _, err := svc.UpdateProto(ctx, &models.ProtoWriteRequest{ID: "missing", Data: encodeUser("Ada", 1)}); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// defaultWorkerStallTimeout is how long a worker goroutine may go without
+// polling before it counts as wedged. It exceeds the 30s batch deadline
+const defaultWorkerStallTimeout = 2 * time.Minute
+
+// WithReadinessThresholds sets when the readiness probe fails: a worker
+// goroutine that has not polled for stallTimeout is wedged, and a pending
+// task older than maxBacklogAge means the backlog is not drained (zero
+// disables the backlog check)
+func WithReadinessThresholds(stallTimeout, maxBacklogAge time.Duration) Option {
+	return func(s *Service) {
+		s.stallTimeout = stallTimeout
+		s.maxBacklogAge = maxBacklogAge
+	}
+}
+
+// beat records that a worker goroutine is polling
+func (w *InboxWorker) beat(workerID int) {
+	atomic.StoreInt64(&w.heartbeats[workerID], time.Now().UnixNano())
+}
+
+// liveness reports the worker goroutines that polled within stallTimeout
+func (w *InboxWorker) liveness(stallTimeout time.Duration) *models.WorkerLiveness {
+	w.mu.RLock()
+	running := w.running
+	w.mu.RUnlock()
+
+	now := time.Now()
+	liveness := &models.WorkerLiveness{
+		Running:                 running,
+		Workers:                 w.workerCount,
+		SinceLastSuccessSeconds: -1,
+	}
+
+	for i := range w.heartbeats {
+		beat := atomic.LoadInt64(&w.heartbeats[i])
+		if beat != 0 && now.Sub(time.Unix(0, beat)) <= stallTimeout {
+			liveness.AliveWorkers++
+		}
+	}
+
+	if last := atomic.LoadInt64(&w.lastSuccess); last != 0 {
+		at := time.Unix(0, last)
+		liveness.LastSuccess = &at
+		liveness.SinceLastSuccessSeconds = now.Sub(at).Seconds()
+	}
+
+	return liveness
+}
+
+// Readiness reports whether the instance can serve traffic: the inbox worker
+// runs, all its goroutines poll, and the backlog is moving. Unlike /health it
+// notices a dead or wedged worker
+func (s *Service) Readiness(ctx context.Context) *models.ReadinessStatus {
+	status := &models.ReadinessStatus{Ready: true}
+	fail := func(format string, args ...interface{}) {
+		status.Ready = false
+		status.Issues = append(status.Issues, fmt.Sprintf(format, args...))
+	}
+
+	if s.worker == nil {
+		status.Worker = &models.WorkerLiveness{SinceLastSuccessSeconds: -1}
+		fail("inbox worker not started")
+	} else {
+		status.Worker = s.worker.liveness(s.stallTimeout)
+		if !status.Worker.Running {
+			fail("inbox worker stopped")
+		} else if status.Worker.AliveWorkers < status.Worker.Workers {
+			fail("%d of %d inbox workers have not polled for %v",
+				status.Worker.Workers-status.Worker.AliveWorkers, status.Worker.Workers, s.stallTimeout)
+		}
+	}
+
+	stats, err := s.repo.Inbox.GetTaskStats(ctx)
+	if err != nil {
+		fail("failed to read inbox: %v", err)
+		return status
+	}
+
+	if stats.OldestPendingAt != nil {
+		age := time.Since(*stats.OldestPendingAt)
+		status.OldestPendingAgeSeconds = age.Seconds()
+
+		if s.maxBacklogAge > 0 && age > s.maxBacklogAge {
+			fail("oldest pending task is %v old, limit %v", age.Round(time.Second), s.maxBacklogAge)
+		}
+
+		// Tasks are waiting but none has succeeded for a while
+		if age > s.stallTimeout && status.Worker.Running &&
+			(status.Worker.LastSuccess == nil || time.Since(*status.Worker.LastSuccess) > s.stallTimeout) {
+			fail("no task succeeded for %v while tasks are pending", s.stallTimeout)
+		}
+	}
+
+	return status
+}
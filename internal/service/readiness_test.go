@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_Readiness(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	ctx := context.Background()
+
+	svc := NewService(repo, metrics.NewMetrics(), WithReadinessThresholds(time.Minute, time.Hour))
+	if status := svc.Readiness(ctx); status.Ready {
+		t.Fatal("Expected not ready before the worker starts")
+	}
+
+	svc.StartInboxWorker(2, 1, time.Hour, 1, time.Second)
+	defer svc.Close()
+
+	status := svc.Readiness(ctx)
+	if !status.Ready || status.Worker.AliveWorkers != 2 {
+		t.Fatalf("Expected ready with 2 alive workers, got %+v %v", status.Worker, status.Issues)
+	}
+
+	// A worker stuck in a batch stops polling
+	atomic.StoreInt64(&svc.worker.heartbeats[1], time.Now().Add(-2*time.Minute).UnixNano())
+	status = svc.Readiness(ctx)
+	if status.Ready || status.Worker.AliveWorkers != 1 {
+		t.Errorf("Expected a wedged worker to fail readiness, got %+v", status.Worker)
+	}
+	svc.worker.beat(1)
+
+	// An old backlog nobody drains
+	err := mock.CreateTask(ctx, &models.InboxTask{
+		ID:        "old",
+		Operation: models.TaskOperationInsert,
+		Payload:   []byte(`{"id":"a","value":{}}`),
+		Status:    models.TaskStatusPending,
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	status = svc.Readiness(ctx)
+	if status.Ready || status.OldestPendingAgeSeconds < 7200 {
+		t.Fatalf("Expected an old backlog to fail readiness, got %+v", status)
+	}
+	if !strings.Contains(strings.Join(status.Issues, "; "), "no task succeeded") {
+		t.Errorf("Expected a stalled backlog issue, got %v", status.Issues)
+	}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+	"mit-service/internal/reqtrace"
+	"mit-service/internal/schema"
+)
+
+// maxReferences bounds the referencing records listed for a record, and the
+// records a delete may cascade to
+const maxReferences = 1000
+
+// referencingType is a record type declaring references
+type referencingType struct {
+	name string
+	refs []schema.Reference
+}
+
+// referrer is a record referencing another in one of its fields
+type referrer struct {
+	record *models.Record
+	ref    schema.Reference
+}
+
+// referencingTypes returns the record types whose schemas declare references
+func (s *Service) referencingTypes(ctx context.Context) ([]referencingType, error) {
+	hasTypes, err := s.schemas.hasTypes(ctx)
+	if err != nil || !hasTypes {
+		return nil, err
+	}
+	recordTypes, err := s.ListRecordTypes(repository.WithSystemAccess(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var types []referencingType
+	for _, recordType := range recordTypes {
+		compiled, err := s.schemas.lookup(ctx, recordType.Name)
+		if errors.Is(err, models.ErrUnknownRecordType) {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if refs := compiled.References(); len(refs) > 0 {
+			types = append(types, referencingType{name: recordType.Name, refs: refs})
+		}
+	}
+	return types, nil
+}
+
+// scanReferences calls fn with the records of the scope of ctx referencing
+// one of targets, IDs as callers know them, until fn returns false. It reads
+// every record of the referencing types
+func (s *Service) scanReferences(ctx context.Context, types []referencingType, targets map[string]bool, fn func(target string, r referrer) bool) error {
+	prefix := scopePrefix(ctx)
+	for _, t := range types {
+		filter := models.RecordFilter{
+			Type:          t.name,
+			Prefix:        prefix,
+			ExcludePrefix: prefix + repository.SystemRecordPrefix,
+			Limit:         scanPageSize,
+		}
+		for {
+			records, err := s.repo.Record.ListRecords(ctx, filter)
+			if err != nil {
+				return fmt.Errorf("failed to scan records of type '%s' for references: %w", t.name, err)
+			}
+			for _, record := range records {
+				var value map[string]interface{}
+				if record.Encoding != "" || record.DecodeValue(&value) != nil {
+					continue
+				}
+				for _, ref := range t.refs {
+					target, _ := value[ref.Field].(string)
+					if targets[target] && !fn(target, referrer{record: record, ref: ref}) {
+						return nil
+					}
+				}
+			}
+
+			if len(records) < filter.Limit {
+				break
+			}
+			filter.AfterID = records[len(records)-1].ID
+		}
+	}
+	return nil
+}
+
+// RecordReferences returns the references of the record id to other
+// records and the records referencing it, up to maxReferences of them
+func (s *Service) RecordReferences(ctx context.Context, id string) (*models.RecordReferences, error) {
+	defer reqtrace.FromContext(ctx).Span("service", "RecordReferences")()
+
+	record, err := s.repo.Record.Get(ctx, scoped(ctx, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get record: %w", err)
+	}
+
+	outgoing, err := s.outgoingReferences(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	response := &models.RecordReferences{
+		ID:           id,
+		References:   outgoing,
+		ReferencedBy: []*models.RecordReference{},
+	}
+
+	types, err := s.referencingTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = s.scanReferences(ctx, types, map[string]bool{id: true}, func(_ string, r referrer) bool {
+		if len(response.ReferencedBy) == maxReferences {
+			response.Truncated = true
+			return false
+		}
+		response.ReferencedBy = append(response.ReferencedBy, &models.RecordReference{
+			ID:       unscoped(ctx, r.record.ID),
+			Type:     r.record.Type,
+			Field:    r.ref.Field,
+			OnDelete: r.ref.OnDelete,
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// outgoingReferences returns the references of record to other records,
+// sorted by field
+func (s *Service) outgoingReferences(ctx context.Context, record *models.Record) ([]*models.RecordReference, error) {
+	refs := []*models.RecordReference{}
+	if record.Type == "" || record.Encoding != "" {
+		return refs, nil
+	}
+
+	compiled, err := s.schemas.lookup(ctx, record.Type)
+	if errors.Is(err, models.ErrUnknownRecordType) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var value map[string]interface{}
+	if err := record.DecodeValue(&value); err != nil {
+		return refs, nil
+	}
+
+	for _, ref := range compiled.References() {
+		if target, _ := value[ref.Field].(string); target != "" {
+			refs = append(refs, &models.RecordReference{
+				ID:       target,
+				Field:    ref.Field,
+				OnDelete: ref.OnDelete,
+			})
+		}
+	}
+	return refs, nil
+}
+
+// nulledRecord is a referencing record whose references to deleted records
+// are set to null
+type nulledRecord struct {
+	record *models.Record
+	fields []string
+}
+
+// referenceTasks applies the on_delete rules of the records referencing the
+// stored record id. It fails with models.ErrRecordReferenced while a record
+// restricts the delete, and otherwise returns the tasks deleting the records
+// it cascades to and setting references to null, created from createdAt.
+// Nulled references keep the version of their record, so a concurrent
+// update fails the task rather than being overwritten
+func (s *Service) referenceTasks(ctx context.Context, id string, createdAt time.Time) ([]*models.InboxTask, error) {
+	types, err := s.referencingTypes(ctx)
+	if err != nil || len(types) == 0 {
+		return nil, err
+	}
+
+	deleted := map[string]bool{id: true}
+	var cascaded []*models.Record
+	var nulled []*nulledRecord
+	nulledByID := make(map[string]*nulledRecord)
+	var restricted []referrer
+
+	// Each round finds the records referencing those deleted by the last one
+	var tooMany bool
+	targets := map[string]bool{unscoped(ctx, id): true}
+	for len(targets) > 0 && !tooMany {
+		next := make(map[string]bool)
+		err := s.scanReferences(ctx, types, targets, func(_ string, r referrer) bool {
+			switch r.ref.OnDelete {
+			case schema.OnDeleteRestrict:
+				restricted = append(restricted, r)
+			case schema.OnDeleteCascade:
+				if deleted[r.record.ID] {
+					break
+				}
+				if len(cascaded) == maxReferences {
+					tooMany = true
+					return false
+				}
+				deleted[r.record.ID] = true
+				cascaded = append(cascaded, r.record)
+				next[unscoped(ctx, r.record.ID)] = true
+			case schema.OnDeleteSetNull:
+				entry := nulledByID[r.record.ID]
+				if entry == nil {
+					entry = &nulledRecord{record: r.record}
+					nulledByID[r.record.ID] = entry
+					nulled = append(nulled, entry)
+				}
+				entry.fields = append(entry.fields, r.ref.Field)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		targets = next
+	}
+	if tooMany {
+		return nil, fmt.Errorf("%w: the delete would cascade to more than %d records", models.ErrRecordReferenced, maxReferences)
+	}
+
+	for _, r := range restricted {
+		if !deleted[r.record.ID] {
+			return nil, fmt.Errorf("%w by '%s' in field '%s'", models.ErrRecordReferenced, unscoped(ctx, r.record.ID), r.ref.Field)
+		}
+	}
+
+	var tasks []*models.InboxTask
+	taskTime := func() time.Time {
+		return createdAt.Add(time.Duration(len(tasks)+1) * time.Microsecond)
+	}
+	for _, entry := range nulled {
+		if deleted[entry.record.ID] {
+			continue
+		}
+		var value map[string]interface{}
+		if err := entry.record.DecodeValue(&value); err != nil {
+			return nil, fmt.Errorf("invalid value of record '%s': %w", unscoped(ctx, entry.record.ID), err)
+		}
+		for _, field := range entry.fields {
+			value[field] = nil
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode value of record '%s': %w", unscoped(ctx, entry.record.ID), err)
+		}
+		task, err := newRecordTask(ctx, models.TaskOperationUpdate, &models.UpdateTaskPayload{
+			ID:              entry.record.ID,
+			Value:           encoded,
+			ExpectedVersion: entry.record.Version,
+		}, taskTime())
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	for _, record := range cascaded {
+		task, err := newRecordTask(ctx, models.TaskOperationDelete, &models.DeleteTaskPayload{ID: record.ID}, taskTime())
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// newRecordTask builds the task of a record write created at createdAt
+func newRecordTask(ctx context.Context, operation string, payload interface{}, createdAt time.Time) (*models.InboxTask, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", operation, err)
+	}
+	return &models.InboxTask{
+		ID:        scopedTaskID(ctx, uuid.New().String()),
+		Operation: operation,
+		Payload:   encoded,
+		Status:    models.TaskStatusPending,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		TenantID:  TenantFromContext(ctx),
+	}, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestService_References(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	reference := func(onDelete string) map[string]interface{} {
+		return map[string]interface{}{"type": []interface{}{"string", "null"}, "x-reference": map[string]interface{}{"on_delete": onDelete}}
+	}
+	for name, props := range map[string]map[string]interface{}{
+		"customer": {"name": map[string]interface{}{"type": "string"}},
+		"order":    {"customer": reference("cascade"), "referrer": reference("set-null")},
+		"line":     {"order": reference("cascade")},
+		"invoice":  {"order": reference("restrict")},
+	} {
+		err := svc.PutRecordType(ctx, &models.RecordType{Name: name, Schema: map[string]interface{}{"type": "object", "properties": props}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	for _, req := range []*models.InsertRequest{
+		{ID: "c_1", Type: "customer", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})},
+		{ID: "c_2", Type: "customer", Value: models.MustEncodeValue(map[string]interface{}{"name": "Bob"})},
+		{ID: "o_1", Type: "order", Value: models.MustEncodeValue(map[string]interface{}{"customer": "c_1"})},
+		{ID: "o_2", Type: "order", Value: models.MustEncodeValue(map[string]interface{}{"customer": "c_2", "referrer": "c_1"})},
+		{ID: "l_1", Type: "line", Value: models.MustEncodeValue(map[string]interface{}{"order": "o_1"})},
+		{ID: "i_1", Type: "invoice", Value: models.MustEncodeValue(map[string]interface{}{"order": "o_2"})},
+	} {
+		if _, err := svc.Insert(ctx, req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	waitFor(t, "the inserts", func() bool {
+		_, err := mock.Get(ctx, "i_1")
+		return err == nil
+	})
+
+	refs, err := svc.RecordReferences(ctx, "o_2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(refs.References) != 2 || refs.References[0].ID != "c_2" || refs.References[1].ID != "c_1" {
+		t.Errorf("Expected o_2 referencing c_2 and c_1, got %+v", refs.References)
+	}
+	if len(refs.ReferencedBy) != 1 || refs.ReferencedBy[0].ID != "i_1" || refs.ReferencedBy[0].OnDelete != "restrict" {
+		t.Errorf("Expected o_2 referenced by i_1, got %+v", refs.ReferencedBy)
+	}
+
+	if _, err := svc.Delete(ctx, &models.DeleteRequest{ID: "c_2"}); !errors.Is(err, models.ErrRecordReferenced) {
+		t.Errorf("Expected the delete restricted through the cascade to o_2, got %v", err)
+	}
+
+	// Deleting c_1 deletes o_1 and its line, and clears the referrer of o_2
+	if _, err := svc.Delete(ctx, &models.DeleteRequest{ID: "c_1"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the cascade", func() bool {
+		o2, _ := mock.Get(ctx, "o_2")
+		_, err := mock.Get(ctx, "l_1")
+		return errors.Is(err, models.ErrRecordNotFound) && o2 != nil && valueField(o2, "referrer") == nil
+	})
+	if _, err := mock.Get(ctx, "o_1"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected o_1 deleted with c_1, got %v", err)
+	}
+	o2, _ := mock.Get(ctx, "o_2")
+	if valueField(o2, "customer") != "c_2" {
+		t.Errorf("Expected the other references of o_2 kept, got %v", valueField(o2, "customer"))
+	}
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// Replication change results, used as metric labels
+const (
+	replicationApplied   = "applied"
+	replicationUnchanged = "unchanged"
+	replicationSkipped   = "skipped"
+	replicationFailed    = "failed"
+)
+
+// ReplicationConfig configures replication of changes to a secondary database
+type ReplicationConfig struct {
+	// Interval is how often the change stream is polled, BatchSize bounds
+	// the changes read per query
+	Interval  time.Duration
+	BatchSize int
+
+	// ConflictPolicy is models.ConflictSourceWins or models.ConflictTargetWins
+	ConflictPolicy string
+
+	// Lookback is how far back the change stream is replayed on start
+	Lookback time.Duration
+
+	// SettleDelay holds back changes completed more recently than this, so a
+	// task committed with an earlier completion time is not skipped
+	SettleDelay time.Duration
+}
+
+// replicator tails the completed inbox tasks and brings the records they
+// touched to the same state on the secondary. Changes are replicated as the
+// current source record rather than the task payload, so replaying a change
+// is harmless and the cursor is kept in memory only
+type replicator struct {
+	source  *repository.RepositoryManager
+	target  repository.RecordRepository
+	metrics *metrics.Metrics
+	cfg     ReplicationConfig
+
+	mu      sync.Mutex
+	status  models.ReplicationStatus
+	afterID string
+
+	// backfill copies every record, started by StartReplicationBackfill
+	backfill scanJob[models.BackfillReport]
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// StartReplication starts replicating changes to target, beginning with the
+// changes completed within the configured lookback
+func (s *Service) StartReplication(target repository.RecordRepository, cfg ReplicationConfig) error {
+	switch cfg.ConflictPolicy {
+	case models.ConflictSourceWins, models.ConflictTargetWins:
+	default:
+		return fmt.Errorf("unknown conflict policy %q, expected %s or %s",
+			cfg.ConflictPolicy, models.ConflictSourceWins, models.ConflictTargetWins)
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("replication batch size must be positive, got %d", cfg.BatchSize)
+	}
+
+	r := &replicator{
+		source:  s.repo,
+		target:  target,
+		metrics: s.metrics,
+		cfg:     cfg,
+		stopCh:  make(chan struct{}),
+		status: models.ReplicationStatus{
+			ConflictPolicy: cfg.ConflictPolicy,
+			Cursor:         time.Now().Add(-cfg.Lookback),
+		},
+	}
+	s.replication = r
+
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+// ReplicationStatus returns the progress of replication
+func (s *Service) ReplicationStatus() (*models.ReplicationStatus, error) {
+	if s.replication == nil {
+		return nil, models.ErrReplicationDisabled
+	}
+
+	r := s.replication
+	r.mu.Lock()
+	status := r.status
+	r.mu.Unlock()
+
+	status.Backfill = r.backfill.last()
+	return &status, nil
+}
+
+// StartReplicationBackfill starts copying every record to the secondary in
+// the background, catching up a new secondary or one that fell behind the
+// retained change stream. Records deleted from the source before the
+// lookback are not removed from the secondary
+func (s *Service) StartReplicationBackfill() (*models.BackfillReport, error) {
+	if s.replication == nil {
+		return nil, models.ErrReplicationDisabled
+	}
+
+	r := s.replication
+	report := &models.BackfillReport{Status: models.ScanRunning, StartedAt: time.Now()}
+
+	err := r.backfill.start(report, func(ctx context.Context) *models.BackfillReport {
+		result := *report
+		defer func() {
+			now := time.Now()
+			result.FinishedAt = &now
+		}()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var copyErr error
+		err := s.scanRecords(ctx, func(record *models.Record) {
+			if copyErr != nil {
+				return
+			}
+			result.Scanned++
+
+			outcome, conflict, err := r.copyRecord(ctx, record, models.TaskOperationInsert)
+			if err != nil {
+				copyErr = fmt.Errorf("failed to copy record %s: %w", record.ID, err)
+				cancel()
+				return
+			}
+			if conflict {
+				result.Conflicts++
+			}
+			if outcome == replicationApplied {
+				result.Copied++
+			}
+		})
+		if copyErr != nil {
+			err = copyErr
+		}
+
+		if err != nil {
+			result.Status = models.ScanFailed
+			result.Error = err.Error()
+			log.Printf("Replication backfill failed after %d records: %v", result.Scanned, err)
+		} else {
+			result.Status = models.ScanCompleted
+			log.Printf("Replication backfill completed: %d records scanned, %d copied, %d conflicts",
+				result.Scanned, result.Copied, result.Conflicts)
+		}
+		return &result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// run polls the change stream until stopped
+func (r *replicator) run() {
+	defer r.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-r.stopCh
+		cancel()
+	}()
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the backlog before waiting for the next tick
+		for more := true; more; {
+			more = r.replicateBatch(ctx)
+		}
+
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicateBatch replicates the next batch of settled changes and reports
+// whether more are waiting
+func (r *replicator) replicateBatch(ctx context.Context) bool {
+	r.mu.Lock()
+	cursor, afterID := r.status.Cursor, r.afterID
+	r.mu.Unlock()
+
+	tasks, err := r.source.Inbox.GetCompletedTasksAfter(ctx, cursor, afterID, r.cfg.BatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.fail(fmt.Errorf("failed to read changes: %w", err), nil)
+		}
+		return false
+	}
+
+	settled := time.Now().Add(-r.cfg.SettleDelay)
+	for _, task := range tasks {
+		if task.UpdatedAt.After(settled) {
+			r.setLag(task.UpdatedAt)
+			return false
+		}
+
+		outcome, conflict, err := r.replicate(ctx, task)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.fail(fmt.Errorf("failed to replicate task %s: %w", task.ID, err), task)
+			}
+			return false
+		}
+		r.advance(task, outcome, conflict)
+	}
+
+	if len(tasks) < r.cfg.BatchSize {
+		r.setLag(time.Time{})
+		return false
+	}
+	r.setLag(tasks[len(tasks)-1].UpdatedAt)
+	return ctx.Err() == nil
+}
+
+// replicate brings the record a task touched to its current source state
+func (r *replicator) replicate(ctx context.Context, task *models.InboxTask) (string, bool, error) {
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(task.Payload, &payload); err != nil || payload.ID == "" {
+		// Custom operations without a record ID have nothing to replicate
+		return replicationUnchanged, false, nil
+	}
+
+	record, err := r.source.Record.Get(ctx, payload.ID)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		err := r.target.Delete(ctx, payload.ID)
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return replicationUnchanged, false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return replicationApplied, false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read source record: %w", err)
+	}
+
+	return r.copyRecord(ctx, record, task.Operation)
+}
+
+// copyRecord writes record to the secondary unless it already holds it,
+// applying the conflict policy when the secondary is out of step with the
+// operation, and reports whether there was a conflict
+func (r *replicator) copyRecord(ctx context.Context, record *models.Record, operation string) (string, bool, error) {
+	existing, err := r.target.Get(ctx, record.ID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		return "", false, fmt.Errorf("failed to read target record: %w", err)
+	}
+
+	if existing == nil {
+		conflict := operation == models.TaskOperationUpdate
+		if conflict && r.cfg.ConflictPolicy == models.ConflictTargetWins {
+			r.metrics.RecordReplicationConflict("target")
+			return replicationSkipped, true, nil
+		}
+		if conflict {
+			r.metrics.RecordReplicationConflict("source")
+		}
+		if err := r.target.Insert(ctx, record); err != nil {
+			return "", conflict, err
+		}
+		return replicationApplied, conflict, nil
+	}
+
+	if sameRecord(existing, record) {
+		return replicationUnchanged, false, nil
+	}
+
+	conflict := operation == models.TaskOperationInsert
+	if conflict && r.cfg.ConflictPolicy == models.ConflictTargetWins {
+		r.metrics.RecordReplicationConflict("target")
+		return replicationSkipped, true, nil
+	}
+	if conflict {
+		r.metrics.RecordReplicationConflict("source")
+	}
+	if err := r.target.Update(ctx, record); err != nil {
+		return "", conflict, err
+	}
+	return replicationApplied, conflict, nil
+}
+
+// sameRecord reports whether two records have the same type and value
+func sameRecord(a, b *models.Record) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	hashA, errA := recordHash(a)
+	hashB, errB := recordHash(b)
+	return errA == nil && errB == nil && hashA == hashB
+}
+
+// recordHash returns the stored value hash, computing it for records
+// written before hashes were kept
+func recordHash(record *models.Record) (string, error) {
+	if record.Hash != "" {
+		return record.Hash, nil
+	}
+	value, err := record.DecodedValue()
+	if err != nil {
+		return "", err
+	}
+	return models.ValueHash(value)
+}
+
+// advance moves the cursor past a replicated task
+func (r *replicator) advance(task *models.InboxTask, outcome string, conflict bool) {
+	r.metrics.RecordReplicationChange(outcome)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.Cursor, r.afterID = task.UpdatedAt, task.ID
+	switch outcome {
+	case replicationApplied:
+		r.status.Applied++
+	case replicationUnchanged:
+		r.status.Unchanged++
+	}
+	if conflict {
+		r.status.Conflicts++
+	}
+}
+
+// fail records a failed poll, the change is retried on the next one
+func (r *replicator) fail(err error, task *models.InboxTask) {
+	log.Printf("Replication: %v", err)
+	r.metrics.RecordReplicationChange(replicationFailed)
+	if task != nil {
+		r.setLag(task.UpdatedAt)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Failures++
+	r.status.LastError = err.Error()
+}
+
+// setLag sets the lag to the age of the oldest change not yet replicated,
+// zero when caught up
+func (r *replicator) setLag(oldest time.Time) {
+	var lag time.Duration
+	if !oldest.IsZero() {
+		lag = time.Since(oldest)
+	}
+	r.metrics.SetReplicationLag(lag)
+
+	r.mu.Lock()
+	r.status.LagSeconds = lag.Seconds()
+	r.mu.Unlock()
+}
+
+// Stop stops replication and a running backfill
+func (r *replicator) Stop() {
+	r.once.Do(func() { close(r.stopCh) })
+	r.wg.Wait()
+	r.backfill.stop()
+}
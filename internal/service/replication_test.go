@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestService_Replication(t *testing.T) {
+	tests := []struct {
+		policy    string
+		expected  map[string]interface{}
+		applied   int64
+		conflicts int64
+	}{
+		{
+			policy:    models.ConflictSourceWins,
+			expected:  map[string]interface{}{"a": "source", "b": "source", "local": "target"},
+			applied:   3,
+			conflicts: 2,
+		},
+		{
+			policy:    models.ConflictTargetWins,
+			expected:  map[string]interface{}{"a": "target", "local": "target"},
+			applied:   1,
+			conflicts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			ctx := context.Background()
+			source := repository.NewMockRepository()
+			target := repository.NewMockRepository()
+			repo := &repository.RepositoryManager{Record: source, Inbox: source}
+
+			// The secondary holds a different "a", a record "c" deleted on
+			// the source and a record of its own
+			for id, value := range map[string]string{"a": "target", "c": "target", "local": "target"} {
+				if err := target.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(value)}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			for _, id := range []string{"a", "b"} {
+				if err := source.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue("source")}); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			changes := []struct{ id, operation string }{
+				{"a", models.TaskOperationInsert},
+				{"b", models.TaskOperationUpdate},
+				{"c", models.TaskOperationDelete},
+			}
+			for i, change := range changes {
+				task := &models.InboxTask{
+					ID:        "task_" + change.id,
+					Operation: change.operation,
+					Payload:   []byte(`{"id":"` + change.id + `"}`),
+					Status:    models.TaskStatusPending,
+					CreatedAt: time.Now(),
+				}
+				if err := source.CreateTask(ctx, task); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if err := source.UpdateTaskStatus(ctx, task.ID, models.TaskStatusCompleted, ""); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if i < len(changes)-1 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			svc := NewService(repo, metrics.NewMetrics())
+			defer svc.Close()
+
+			if _, err := svc.ReplicationStatus(); !errors.Is(err, models.ErrReplicationDisabled) {
+				t.Fatalf("Expected ErrReplicationDisabled before starting, got %v", err)
+			}
+
+			err := svc.StartReplication(target, ReplicationConfig{
+				Interval:       10 * time.Millisecond,
+				BatchSize:      2,
+				ConflictPolicy: tt.policy,
+				Lookback:       time.Hour,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var status *models.ReplicationStatus
+			waitFor(t, "replication", func() bool {
+				status, _ = svc.ReplicationStatus()
+				return status.Applied+status.Unchanged+status.Conflicts >= int64(len(changes))
+			})
+
+			values := map[string]interface{}{}
+			records, err := target.ListRecords(ctx, models.RecordFilter{Limit: 10})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, record := range records {
+				values[record.ID], _ = record.DecodedValue()
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("Expected secondary %v, got %v", tt.expected, values)
+			}
+
+			if status.Applied != tt.applied || status.Conflicts != tt.conflicts || status.Failures != 0 {
+				t.Errorf("Expected %d applied and %d conflicts, got %+v", tt.applied, tt.conflicts, status)
+			}
+			if status.LagSeconds != 0 {
+				t.Errorf("Expected no lag once caught up, got %v", status.LagSeconds)
+			}
+		})
+	}
+}
+
+func TestService_ReplicationBackfill(t *testing.T) {
+	ctx := context.Background()
+	source := repository.NewMockRepository()
+	target := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: source, Inbox: source}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := source.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"id": id})}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := target.Insert(ctx, &models.Record{ID: "b", Value: models.MustEncodeValue("stale")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	svc := NewService(repo, metrics.NewMetrics())
+	defer svc.Close()
+
+	err := svc.StartReplication(target, ReplicationConfig{
+		Interval:       time.Hour,
+		BatchSize:      10,
+		ConflictPolicy: models.ConflictSourceWins,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report, err := svc.StartReplicationBackfill()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitFor(t, "the backfill", func() bool {
+		status, _ := svc.ReplicationStatus()
+		report = status.Backfill
+		return report.Status != models.ScanRunning
+	})
+
+	if report.Status != models.ScanCompleted || report.Scanned != 3 || report.Copied != 3 || report.Conflicts != 1 {
+		t.Errorf("Expected 3 records copied with 1 conflict, got %+v", report)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		record, err := target.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if value, _ := record.DecodedValue(); !reflect.DeepEqual(value, map[string]interface{}{"id": id}) {
+			t.Errorf("Expected %s copied, got %s", id, record.Value)
+		}
+	}
+}
+
+func TestService_ReplicationInvalidPolicy(t *testing.T) {
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics())
+	defer svc.Close()
+
+	err := svc.StartReplication(repository.NewMockRepository(), ReplicationConfig{
+		Interval:       time.Second,
+		BatchSize:      10,
+		ConflictPolicy: "newest-wins",
+	})
+	if err == nil {
+		t.Error("Expected an error for an unknown conflict policy")
+	}
+}
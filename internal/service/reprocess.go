@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+const (
+	// defaultReprocessRate and maxReprocessRate bound the tasks enqueued
+	// per second by a reprocessing run
+	defaultReprocessRate = 50
+	maxReprocessRate     = 10000
+
+	// maxReprocessSamples bounds the task IDs and failures in the report
+	maxReprocessSamples = 20
+)
+
+// StartReprocess starts running the finished tasks selected by req through
+// the processing pipeline again in the background. Every task is replayed
+// through the same path as a new write, so the current transformations,
+// scripts and schemas apply: inserts of records that exist since are
+// replayed as updates, updates and deletes of records deleted since are
+// skipped. Replays are queued in the order the tasks finished, so replaying
+// a window older than the last write of a record restores an older value
+func (s *Service) StartReprocess(req *models.ReprocessRequest) (*models.ReprocessReport, error) {
+	if err := validateReprocess(req); err != nil {
+		return nil, err
+	}
+
+	report := &models.ReprocessReport{
+		Status:    models.ScanRunning,
+		Request:   req,
+		StartedAt: time.Now(),
+		SampleIDs: []string{},
+	}
+
+	err := s.reprocess.start(report, func(ctx context.Context) *models.ReprocessReport {
+		result := *report
+		defer func() {
+			now := time.Now()
+			result.FinishedAt = &now
+		}()
+
+		if err := s.replayTasks(ctx, req, &result); err != nil {
+			result.Status = models.ScanFailed
+			result.Error = err.Error()
+			log.Printf("Reprocessing failed after %d tasks: %v", result.Scanned, err)
+		} else {
+			result.Status = models.ScanCompleted
+			log.Printf("Reprocessing completed: %d tasks matched, %d enqueued, %d skipped, %d failed (dry run: %t)",
+				result.Matched, result.Enqueued, result.Skipped, result.Failed, req.DryRun)
+		}
+		return &result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// ReprocessReport returns the running or last finished reprocessing run,
+// nil when none was started
+func (s *Service) ReprocessReport() *models.ReprocessReport {
+	return s.reprocess.last()
+}
+
+// validateReprocess checks req and fills in its defaults
+func validateReprocess(req *models.ReprocessRequest) error {
+	switch req.Source {
+	case "":
+		req.Source = models.ReprocessSourceTasks
+	case models.ReprocessSourceTasks:
+	case models.ReprocessSourceHistory:
+		return models.ErrHistoryUnsupported
+	default:
+		return fmt.Errorf("%w: unknown source %q", models.ErrInvalidReprocess, req.Source)
+	}
+
+	if req.From.IsZero() {
+		return fmt.Errorf("%w: from is required", models.ErrInvalidReprocess)
+	}
+	if req.To == nil {
+		now := time.Now()
+		req.To = &now
+	}
+	if !req.To.After(req.From) {
+		return fmt.Errorf("%w: to must be after from", models.ErrInvalidReprocess)
+	}
+	if req.FromID != "" && req.ToID != "" && req.FromID > req.ToID {
+		return fmt.Errorf("%w: from_id must not be after to_id", models.ErrInvalidReprocess)
+	}
+
+	if len(req.Statuses) == 0 {
+		req.Statuses = []string{models.TaskStatusCompleted, models.TaskStatusFailed}
+	}
+	for _, status := range req.Statuses {
+		if status != models.TaskStatusCompleted && status != models.TaskStatusFailed {
+			return fmt.Errorf("%w: only completed and failed tasks can be reprocessed, got %q", models.ErrInvalidReprocess, status)
+		}
+	}
+
+	if req.Rate == 0 {
+		req.Rate = defaultReprocessRate
+	}
+	if req.Rate < 0 || req.Rate > maxReprocessRate {
+		return fmt.Errorf("%w: rate must be between 0 and %d", models.ErrInvalidReprocess, maxReprocessRate)
+	}
+	if req.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", models.ErrInvalidReprocess)
+	}
+	return nil
+}
+
+// replayTasks reads the finished tasks in the window of req and replays the
+// matching ones, at most req.Rate per second
+func (s *Service) replayTasks(ctx context.Context, req *models.ReprocessRequest, report *models.ReprocessReport) error {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / req.Rate))
+	defer ticker.Stop()
+
+	cursor, afterID := req.From, ""
+	for {
+		tasks, err := s.repo.Inbox.GetFinishedTasksAfter(ctx, cursor, afterID, scanPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			if task.UpdatedAt.After(*req.To) || (req.Limit > 0 && report.Matched >= req.Limit) {
+				return nil
+			}
+			cursor, afterID = task.UpdatedAt, task.ID
+			report.Scanned++
+
+			if !reprocessMatches(req, task) {
+				continue
+			}
+			report.Matched++
+			if len(report.SampleIDs) < maxReprocessSamples {
+				report.SampleIDs = append(report.SampleIDs, task.ID)
+			}
+			if req.DryRun {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+
+			replayed, err := s.replayTask(ctx, task)
+			switch {
+			case err != nil:
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				report.Failed++
+				if len(report.Failures) < maxReprocessSamples {
+					report.Failures = append(report.Failures, fmt.Sprintf("task %s: %v", task.ID, err))
+				}
+			case replayed:
+				report.Enqueued++
+			default:
+				report.Skipped++
+			}
+		}
+
+		if len(tasks) < scanPageSize {
+			return nil
+		}
+	}
+}
+
+// reprocessMatches reports whether task passes the filters of req
+func reprocessMatches(req *models.ReprocessRequest, task *models.InboxTask) bool {
+	if !slices.Contains(req.Statuses, task.Status) {
+		return false
+	}
+	if len(req.Operations) > 0 && !slices.Contains(req.Operations, task.Operation) {
+		return false
+	}
+	if req.FromID == "" && req.ToID == "" {
+		return true
+	}
+	return idInRange(payloadRecordID(task.Payload), req.FromID, req.ToID)
+}
+
+// payloadRecordID returns the record ID of a task payload, empty when it
+// has none
+func payloadRecordID(payload []byte) string {
+	var decoded struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(payload, &decoded) != nil {
+		return ""
+	}
+	return decoded.ID
+}
+
+// replayTask queues the write of task again and reports whether it did; it
+// is skipped when the record it targets no longer exists
+func (s *Service) replayTask(ctx context.Context, task *models.InboxTask) (bool, error) {
+	switch task.Operation {
+	case models.TaskOperationInsert:
+		var payload models.InsertTaskPayload
+		if err := models.UnmarshalValue(task.Payload, &payload); err != nil {
+			return false, fmt.Errorf("failed to unmarshal insert payload: %w", err)
+		}
+		exists, err := s.recordExists(ctx, payload.ID)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			_, err = s.Update(ctx, &models.UpdateRequest{ID: payload.ID, Value: payload.Value})
+		} else {
+			_, err = s.Insert(ctx, &models.InsertRequest{ID: payload.ID, Type: payload.Type, Value: payload.Value})
+		}
+		return err == nil, err
+
+	case models.TaskOperationUpdate:
+		var payload models.UpdateTaskPayload
+		if err := models.UnmarshalValue(task.Payload, &payload); err != nil {
+			return false, fmt.Errorf("failed to unmarshal update payload: %w", err)
+		}
+		exists, err := s.recordExists(ctx, payload.ID)
+		if err != nil || !exists {
+			return false, err
+		}
+		_, err = s.Update(ctx, &models.UpdateRequest{ID: payload.ID, Value: payload.Value})
+		return err == nil, err
+
+	case models.TaskOperationDelete:
+		var payload models.DeleteTaskPayload
+		if err := json.Unmarshal(task.Payload, &payload); err != nil {
+			return false, fmt.Errorf("failed to unmarshal delete payload: %w", err)
+		}
+		exists, err := s.recordExists(ctx, payload.ID)
+		if err != nil || !exists {
+			return false, err
+		}
+		_, err = s.Delete(ctx, &models.DeleteRequest{ID: payload.ID})
+		return err == nil, err
+
+	default:
+		_, err := s.EnqueueTask(ctx, &models.EnqueueTaskRequest{Operation: task.Operation, Payload: task.Payload})
+		return err == nil, err
+	}
+}
+
+// recordExists reports whether the record with id is stored
+func (s *Service) recordExists(ctx context.Context, id string) (bool, error) {
+	_, err := s.repo.Record.Get(ctx, id)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
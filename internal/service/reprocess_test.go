@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// waitForReprocess waits for the running reprocessing run to finish
+func waitForReprocess(t *testing.T, svc *Service) *models.ReprocessReport {
+	t.Helper()
+	var report *models.ReprocessReport
+	waitFor(t, "the reprocessing run", func() bool {
+		report = svc.ReprocessReport()
+		return report != nil && report.Status != models.ScanRunning
+	})
+	return report
+}
+
+func TestService_Reprocess(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	pipeline, err := ParseTransforms("lowercase:email")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithTransforms(pipeline))
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"email": "A@EXAMPLE.COM"})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	from := time.Now()
+	time.Sleep(time.Millisecond)
+	finishTask(t, mock, "task_1", models.TaskOperationInsert, `{"id":"user_1","value":{"email":"A@EXAMPLE.COM"}}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_2", models.TaskOperationInsert, `{"id":"user_2","value":{"email":"B@EXAMPLE.COM"}}`, models.TaskStatusFailed)
+	finishTask(t, mock, "task_3", models.TaskOperationUpdate, `{"id":"user_3","value":{"email":"C@EXAMPLE.COM"}}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_4", models.TaskOperationDelete, `{"id":"user_9"}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_5", models.TaskOperationInsert, `{"id":"other_1","value":{}}`, models.TaskStatusCompleted)
+
+	// A dry run only reports the matching tasks
+	report, err := svc.StartReprocess(&models.ReprocessRequest{From: from, FromID: "user_", ToID: "user_~", DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Status != models.ScanRunning {
+		t.Errorf("Expected running status, got %s", report.Status)
+	}
+	report = waitForReprocess(t, svc)
+	if report.Status != models.ScanCompleted || report.Scanned != 5 || report.Matched != 4 || report.Enqueued != 0 {
+		t.Fatalf("Expected 4 of 5 tasks matched and none enqueued, got %+v", report)
+	}
+	if pending, _ := mock.GetPendingTasks(ctx, 10); len(pending) != 0 {
+		t.Fatalf("Expected nothing enqueued by a dry run, got %d tasks", len(pending))
+	}
+
+	report, err = svc.StartReprocess(&models.ReprocessRequest{From: from, FromID: "user_", ToID: "user_~", Rate: 1000})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report = waitForReprocess(t, svc)
+	if report.Status != models.ScanCompleted || report.Enqueued != 2 || report.Skipped != 2 || report.Failed != 0 {
+		t.Fatalf("Expected 2 tasks enqueued and 2 skipped, got %+v", report)
+	}
+
+	pending, err := mock.GetPendingTasks(ctx, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("Expected 2 replayed tasks, got %d", len(pending))
+	}
+	// The existing record is updated, the failed insert is retried, both
+	// with the current transformations
+	if pending[0].Operation != models.TaskOperationUpdate || payloadRecordID(pending[0].Payload) != "user_1" ||
+		pending[1].Operation != models.TaskOperationInsert || payloadRecordID(pending[1].Payload) != "user_2" {
+		t.Errorf("Unexpected replayed tasks %s %s, %s %s",
+			pending[0].Operation, pending[0].Payload, pending[1].Operation, pending[1].Payload)
+	}
+	if payload := string(pending[1].Payload); payload != `{"id":"user_2","value":{"email":"b@example.com"}}` {
+		t.Errorf("Expected the transformed value, got %s", payload)
+	}
+}
+
+func TestService_ReprocessInvalid(t *testing.T) {
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	from := time.Now().Add(-time.Hour)
+	before := from.Add(-time.Minute)
+	tests := map[string]*models.ReprocessRequest{
+		"missing from":     {},
+		"empty window":     {From: from, To: &before},
+		"inverted ids":     {From: from, FromID: "b", ToID: "a"},
+		"pending status":   {From: from, Statuses: []string{models.TaskStatusPending}},
+		"negative rate":    {From: from, Rate: -1},
+		"unknown source":   {From: from, Source: "backup"},
+		"negative limit":   {From: from, Limit: -1},
+		"rate over limits": {From: from, Rate: maxReprocessRate + 1},
+	}
+	for name, req := range tests {
+		if _, err := svc.StartReprocess(req); !errors.Is(err, models.ErrInvalidReprocess) {
+			t.Errorf("%s: expected ErrInvalidReprocess, got %v", name, err)
+		}
+	}
+
+	if _, err := svc.StartReprocess(&models.ReprocessRequest{From: from, Source: models.ReprocessSourceHistory}); !errors.Is(err, models.ErrHistoryUnsupported) {
+		t.Errorf("Expected ErrHistoryUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// reservationRecordPrefix is the ID prefix of reservations, followed by the
+// reserved ID. Reservations are system records, hidden from listings
+const reservationRecordPrefix = "_system/reservations/"
+
+// defaultReservationLease is the lease of reservations not asking for one,
+// capped at the longest lease
+const defaultReservationLease = time.Minute
+
+// WithReservations enables reserving record IDs for up to maxLease
+func WithReservations(maxLease time.Duration) Option {
+	return func(s *Service) {
+		s.maxReservationLease = maxLease
+	}
+}
+
+// ReservationRetentionRule purges reservations once the longest lease is
+// over, which leaves only expired ones
+func ReservationRetentionRule(maxLease time.Duration) RetentionRule {
+	return RetentionRule{Prefix: reservationRecordPrefix, MaxAge: maxLease}
+}
+
+// reservation is the value of a reservation record
+type reservation struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Reserve claims the unused record ID id for lease, the default lease for
+// 0. Until the lease is over inserts of id must present the token of the
+// reservation; reserving it again fails with models.ErrRecordReserved. An
+// insert queued before the reservation may still take the ID
+func (s *Service) Reserve(ctx context.Context, id string, lease time.Duration) (*models.Reservation, error) {
+	if s.maxReservationLease == 0 {
+		return nil, models.ErrReservationsDisabled
+	}
+	if lease == 0 {
+		lease = min(defaultReservationLease, s.maxReservationLease)
+	}
+	if lease < 0 || lease > s.maxReservationLease {
+		return nil, fmt.Errorf("%w: lease must be positive and at most %v", models.ErrInvalidReservation, s.maxReservationLease)
+	}
+
+	stored := scoped(ctx, id)
+	if _, err := s.repo.Record.Get(ctx, stored); err == nil {
+		return nil, fmt.Errorf("record with id '%s' %w", id, models.ErrRecordExists)
+	} else if !errors.Is(err, models.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	held := reservation{Token: uuid.New().String(), ExpiresAt: time.Now().Add(lease)}
+	value, err := models.EncodeValue(held)
+	if err != nil {
+		return nil, err
+	}
+	record := &models.Record{ID: reservationRecordPrefix + stored, Value: value}
+
+	// Reservations are system records, out of reach of the caller
+	system := repository.WithSystemAccess(ctx)
+	err = s.repo.Record.Insert(system, record)
+	if errors.Is(err, models.ErrRecordExists) {
+		err = s.takeOverReservation(system, id, record)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Reservation{ID: id, Token: held.Token, ExpiresAt: held.ExpiresAt}, nil
+}
+
+// reservation returns the reservation of the stored ID id, nil when it is
+// over, with the version of its record, 0 when there is none
+func (s *Service) reservation(ctx context.Context, id string) (*reservation, int64, error) {
+	record, err := s.repo.Record.Get(repository.WithSystemAccess(ctx), reservationRecordPrefix+id)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var held reservation
+	if err := record.DecodeValue(&held); err != nil {
+		return nil, 0, fmt.Errorf("invalid reservation of '%s': %w", id, err)
+	}
+	if !time.Now().Before(held.ExpiresAt) {
+		return nil, record.Version, nil
+	}
+	return &held, record.Version, nil
+}
+
+// takeOverReservation replaces the expired reservation of id with record.
+// It fails with models.ErrRecordReserved while the reservation is held or
+// when another caller takes it over first. ctx must have system access
+func (s *Service) takeOverReservation(ctx context.Context, id string, record *models.Record) error {
+	current, version, err := s.reservation(ctx, scoped(ctx, id))
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		return fmt.Errorf("record with id '%s': %w until %s", id, models.ErrRecordReserved, current.ExpiresAt.Format(time.RFC3339))
+	}
+
+	if version == 0 {
+		// Purged since the insert failed
+		err = s.repo.Record.Insert(ctx, record)
+	} else {
+		err = s.repo.Record.UpdateIfVersion(ctx, record, version)
+	}
+	if errors.Is(err, models.ErrRecordExists) || errors.Is(err, models.ErrVersionConflict) || errors.Is(err, models.ErrRecordNotFound) {
+		return fmt.Errorf("record with id '%s': %w", id, models.ErrRecordReserved)
+	}
+	return err
+}
+
+// checkReservation fails an insert of the stored ID id while it is reserved
+// with another token than token, and an insert presenting a token once the
+// reservation is over
+func (s *Service) checkReservation(ctx context.Context, id, token string) error {
+	if s.maxReservationLease == 0 {
+		if token != "" {
+			return models.ErrReservationsDisabled
+		}
+		return nil
+	}
+
+	held, _, err := s.reservation(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case held == nil && token != "":
+		return fmt.Errorf("record with id '%s': %w", unscoped(ctx, id), models.ErrReservationExpired)
+	case held != nil && held.Token != token:
+		return fmt.Errorf("record with id '%s': %w", unscoped(ctx, id), models.ErrRecordReserved)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_Reserve(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithReservations(time.Hour))
+	defer svc.Close()
+
+	insert := func(token string) error {
+		_, err := svc.Insert(ctx, &models.InsertRequest{ID: "order_1", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"}), Reservation: token})
+		return err
+	}
+
+	if _, err := svc.Reserve(ctx, "order_1", 2*time.Hour); !errors.Is(err, models.ErrInvalidReservation) {
+		t.Errorf("Expected a lease beyond the maximum rejected, got %v", err)
+	}
+	if err := insert("unknown"); !errors.Is(err, models.ErrReservationExpired) {
+		t.Errorf("Expected a token without reservation rejected, got %v", err)
+	}
+
+	held, err := svc.Reserve(ctx, "order_1", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if held.ID != "order_1" || held.Token == "" || time.Until(held.ExpiresAt) > defaultReservationLease {
+		t.Errorf("Expected a reservation of order_1 with the default lease, got %+v", held)
+	}
+	if _, err := svc.Reserve(ctx, "order_1", 0); !errors.Is(err, models.ErrRecordReserved) {
+		t.Errorf("Expected a second reservation rejected, got %v", err)
+	}
+	if err := insert(""); !errors.Is(err, models.ErrRecordReserved) {
+		t.Errorf("Expected an insert without the token rejected, got %v", err)
+	}
+	if err := insert(held.Token); err != nil {
+		t.Errorf("Expected the insert with the token queued, got %v", err)
+	}
+
+	// An expired reservation is taken over by the next caller
+	mock.Update(ctx, &models.Record{ID: reservationRecordPrefix + "order_1",
+		Value: models.MustEncodeValue(reservation{Token: held.Token, ExpiresAt: time.Now().Add(-time.Second)})})
+	if err := insert(held.Token); !errors.Is(err, models.ErrReservationExpired) {
+		t.Errorf("Expected the expired token rejected, got %v", err)
+	}
+	taken, err := svc.Reserve(ctx, "order_1", time.Minute)
+	if err != nil || taken.Token == held.Token {
+		t.Fatalf("Expected the expired reservation taken over, got %+v, %v", taken, err)
+	}
+
+	mock.Insert(ctx, &models.Record{ID: "order_2", Value: models.MustEncodeValue(map[string]interface{}{"k": "v"})})
+	if _, err := svc.Reserve(ctx, "order_2", 0); !errors.Is(err, models.ErrRecordExists) {
+		t.Errorf("Expected reserving an existing record rejected, got %v", err)
+	}
+
+	disabled, _ := newMockService()
+	defer disabled.Close()
+	if _, err := disabled.Reserve(ctx, "order_1", 0); !errors.Is(err, models.ErrReservationsDisabled) {
+		t.Errorf("Expected reservations disabled by default, got %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// retentionDeleteBatch bounds how many expired records are listed at once
+const retentionDeleteBatch = 1000
+
+// RetentionRule deletes records whose ID starts with Prefix once they have not
+// been written for MaxAge
+type RetentionRule struct {
+	Prefix string
+	MaxAge time.Duration
+}
+
+// ParseRetentionRules parses a comma-separated list of prefix=age rules, e.g.
+// "tmp_=7d,cache_=12h". Ages accept time.ParseDuration units plus "d" for days.
+// Prefixes overlapping the system records are rejected, the service purges
+// those with its own rules
+func ParseRetentionRules(spec string) ([]RetentionRule, error) {
+	var rules []RetentionRule
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		prefix, age, ok := strings.Cut(part, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("invalid retention rule %q, expected prefix=age", part)
+		}
+		if strings.HasPrefix(prefix, repository.SystemRecordPrefix) || strings.HasPrefix(repository.SystemRecordPrefix, prefix) {
+			return nil, fmt.Errorf("invalid retention rule %q, the prefix overlaps the system records under %s", part, repository.SystemRecordPrefix)
+		}
+
+		maxAge, err := parseRetentionAge(strings.TrimSpace(age))
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention rule %q: %w", part, err)
+		}
+
+		rules = append(rules, RetentionRule{Prefix: prefix, MaxAge: maxAge})
+	}
+
+	return rules, nil
+}
+
+// parseRetentionAge parses a positive duration, allowing a "d" (days) suffix
+func parseRetentionAge(age string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(age, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", age)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(age); err != nil {
+			return 0, fmt.Errorf("invalid age %q", age)
+		}
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("age %q must be positive", age)
+	}
+	return d, nil
+}
+
+// WithRetentionRules configures the record retention rules
+func WithRetentionRules(rules []RetentionRule) Option {
+	return func(s *Service) {
+		s.retentionRules = rules
+	}
+}
+
+// EvaluateRetention applies every retention rule. In dry-run mode matching
+// records are only counted. A failing rule is reported and does not stop
+// the others
+func (s *Service) EvaluateRetention(ctx context.Context, dryRun bool) []*models.RetentionReport {
+	reports := make([]*models.RetentionReport, 0, len(s.retentionRules))
+	remove := s.retentionDeleter()
+
+	for _, rule := range s.retentionRules {
+		cutoff := time.Now().Add(-rule.MaxAge)
+		report := &models.RetentionReport{
+			Prefix: rule.Prefix,
+			MaxAge: rule.MaxAge.String(),
+			Cutoff: cutoff,
+			DryRun: dryRun,
+		}
+		reports = append(reports, report)
+
+		matched, err := s.repo.Record.CountExpiredRecords(ctx, rule.Prefix, cutoff)
+		if err != nil {
+			report.Error = err.Error()
+			continue
+		}
+		report.Matched = matched
+
+		if dryRun {
+			s.metrics.RecordRetention(rule.Prefix, true, matched)
+			continue
+		}
+
+		filter := models.RecordFilter{Prefix: rule.Prefix, WrittenBefore: cutoff, Limit: retentionDeleteBatch}
+		if err := s.expireRecords(ctx, remove, filter, report); err != nil {
+			report.Error = err.Error()
+		}
+		s.metrics.RecordRetention(rule.Prefix, false, report.Deleted)
+	}
+
+	return reports
+}
+
+// retentionDeleter returns the step deleting a record the way the worker
+// applies a delete task, through the task middleware and the middleware
+// acting on persisted writes, so subscribers to changes, composite documents
+// and the shadow see it
+func (s *Service) retentionDeleter() TaskStep {
+	middleware := append(slices.Clone(s.taskMiddleware()), s.recordMiddleware()...)
+	return chainMiddleware(middleware, func(ctx context.Context, task *models.InboxTask) error {
+		return applyTask(ctx, s.operations, s.repo.Record, task)
+	})
+}
+
+// expireRecords deletes the records matched by filter in pages, applying the
+// on_delete rules of the records referencing them like a delete request
+// does. Records a reference restricts are kept, and so are those written
+// since they were listed
+func (s *Service) expireRecords(ctx context.Context, remove TaskStep, filter models.RecordFilter, report *models.RetentionReport) error {
+	for {
+		records, err := s.repo.Record.ListRecords(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to list expired records: %w", err)
+		}
+
+		var deleted []string
+		for _, record := range records {
+			ok, err := s.expireRecord(ctx, remove, record, report)
+			if ok {
+				deleted = append(deleted, record.ID)
+			}
+			if err != nil {
+				s.removeFromSearch(deleted)
+				return err
+			}
+		}
+		report.Deleted += len(deleted)
+		s.removeFromSearch(deleted)
+
+		if len(records) < filter.Limit {
+			return nil
+		}
+		filter.AfterID = records[len(records)-1].ID
+	}
+}
+
+// expireRecord deletes an expired record in the scope it was written in and
+// queues the tasks of the records its delete cascades to, reporting whether
+// the record was deleted
+func (s *Service) expireRecord(ctx context.Context, remove TaskStep, record *models.Record, report *models.RetentionReport) (bool, error) {
+	scopeCtx := withScopeOf(ctx, record.ID)
+	task, err := newRecordTask(scopeCtx, models.TaskOperationDelete, &models.DeleteTaskPayload{ID: record.ID, ExpectedVersion: record.Version}, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	related, err := s.referenceTasks(scopeCtx, record.ID, task.CreatedAt)
+	if errors.Is(err, models.ErrRecordReferenced) {
+		report.Kept++
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := remove(ctx, task); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) || errors.Is(err, models.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if len(related) > 0 {
+		if err := s.repo.Inbox.CreateTasks(ctx, related); err != nil {
+			return true, fmt.Errorf("failed to queue the on_delete tasks of '%s': %w", record.ID, err)
+		}
+	}
+	return true, nil
+}
+
+// removeFromSearch drops the documents of records deleted by the retention
+// rules. They queue no task, so the indexer does not see them on the change
+// stream
+func (s *Service) removeFromSearch(ids []string) {
+	if s.search != nil && len(ids) > 0 {
+		s.search.remove(ids)
+	}
+}
+
+// retentionWorker periodically evaluates retention rules
+type retentionWorker struct {
+	service  *Service
+	interval time.Duration
+	dryRun   bool
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// StartRetentionWorker evaluates the retention rules every interval. In
+// dry-run mode nothing is deleted and the would-be deletions are logged
+func (s *Service) StartRetentionWorker(interval time.Duration, dryRun bool) {
+	s.retentionWorker = &retentionWorker{
+		service:  s,
+		interval: interval,
+		dryRun:   dryRun,
+		stopCh:   make(chan struct{}),
+	}
+	s.retentionWorker.Start()
+}
+
+// Start runs the worker until Stop is called
+func (w *retentionWorker) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		log.Printf("Retention worker started (%d rules, dry run: %v)", len(w.service.retentionRules), w.dryRun)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stopCh:
+				log.Println("Retention worker stopping")
+				return
+			case <-ticker.C:
+				w.run()
+			}
+		}
+	}()
+}
+
+// Stop stops the worker and waits for a running evaluation to finish
+func (w *retentionWorker) Stop() {
+	w.once.Do(func() { close(w.stopCh) })
+	w.wg.Wait()
+}
+
+// run evaluates all rules once and logs the outcome
+func (w *retentionWorker) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+	defer cancel()
+
+	for _, report := range w.service.EvaluateRetention(ctx, w.dryRun) {
+		switch {
+		case report.Error != "":
+			log.Printf("Retention worker: rule %s=%s failed after %d deletions: %s",
+				report.Prefix, report.MaxAge, report.Deleted, report.Error)
+		case report.DryRun:
+			log.Printf("Retention worker (dry run): rule %s=%s would delete %d records",
+				report.Prefix, report.MaxAge, report.Matched)
+		case report.Deleted > 0 || report.Kept > 0:
+			log.Printf("Retention worker: rule %s=%s deleted %d records, kept %d referenced ones",
+				report.Prefix, report.MaxAge, report.Deleted, report.Kept)
+		}
+	}
+}
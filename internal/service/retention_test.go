@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestParseRetentionRules(t *testing.T) {
+	rules, err := ParseRetentionRules("tmp_=7d, cache_=12h")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []RetentionRule{
+		{Prefix: "tmp_", MaxAge: 7 * 24 * time.Hour},
+		{Prefix: "cache_", MaxAge: 12 * time.Hour},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(rules))
+	}
+	for i := range expected {
+		if rules[i] != expected[i] {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, expected[i], rules[i])
+		}
+	}
+
+	for _, spec := range []string{"tmp_", "=7d", "tmp_=soon", "tmp_=0d", "tmp_=-1h", "_=1d", "_sys=1d", "_system/sandbox/=1d"} {
+		if _, err := ParseRetentionRules(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestService_EvaluateRetention(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	svc := NewService(repo, metrics.NewMetrics(), WithRetentionRules([]RetentionRule{{Prefix: "tmp_", MaxAge: time.Millisecond}}))
+	defer svc.Close()
+
+	reference := func(onDelete string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "x-reference": map[string]interface{}{"on_delete": onDelete}}
+	}
+	for name, props := range map[string]map[string]interface{}{
+		"item": {},
+		"line": {"item": reference("cascade")},
+		"hold": {"item": reference("restrict")},
+	} {
+		err := svc.PutRecordType(ctx, &models.RecordType{Name: name, Schema: map[string]interface{}{"type": "object", "properties": props}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for _, record := range []*models.Record{
+		{ID: "tmp_1", Type: "item", Value: models.MustEncodeValue(map[string]interface{}{})},
+		{ID: "tmp_2", Type: "item", Value: models.MustEncodeValue(map[string]interface{}{})},
+		{ID: "line_1", Type: "line", Value: models.MustEncodeValue(map[string]interface{}{"item": "tmp_1"})},
+		{ID: "hold_1", Type: "hold", Value: models.MustEncodeValue(map[string]interface{}{"item": "tmp_2"})},
+	} {
+		if err := mock.Insert(ctx, record); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	changes, err := svc.SubscribeChanges(ctx, models.ChangeFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// tmp_2 is kept while hold_1 restricts its delete
+	reports := svc.EvaluateRetention(ctx, false)
+	if reports[0].Matched != 2 || reports[0].Deleted != 1 || reports[0].Kept != 1 || reports[0].Error != "" {
+		t.Fatalf("Expected 1 record deleted and 1 kept, got %+v", reports[0])
+	}
+	if _, err := mock.Get(ctx, "tmp_2"); err != nil {
+		t.Errorf("Expected tmp_2 kept, got %v", err)
+	}
+
+	// The delete is published and recorded like those of the worker
+	select {
+	case event := <-changes:
+		if event.ID != "tmp_1" || event.Operation != models.TaskOperationDelete {
+			t.Errorf("Expected the delete of tmp_1, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("Timed out waiting for the delete of tmp_1")
+	}
+	history, _ := mock.RecordHistory(ctx, "tmp_1", 10, 0)
+	if len(history) != 2 || history[1].Operation != models.HistoryDelete {
+		t.Errorf("Expected the delete of tmp_1 in its history, got %d entries", len(history))
+	}
+
+	// The delete cascades to line_1 through the inbox
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	waitFor(t, "the cascade", func() bool {
+		_, err := mock.Get(ctx, "line_1")
+		return errors.Is(err, models.ErrRecordNotFound)
+	})
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// SandboxRecordPrefix is the ID prefix of sandbox records, followed by the
+// sandbox name. Sandbox records are system records, so they never show up
+// outside their sandbox
+const SandboxRecordPrefix = "_system/sandbox/"
+
+// sandboxContextKey is the context key of the sandbox of a request
+type sandboxContextKey struct{}
+
+// WithSandbox returns a context whose record reads and writes are confined
+// to the sandbox name: callers see the IDs they wrote, stored under the
+// prefix of the sandbox
+func WithSandbox(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, sandboxContextKey{}, name)
+}
+
+// SandboxFromContext returns the sandbox of ctx, empty outside a sandbox
+func SandboxFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(sandboxContextKey{}).(string)
+	return name
+}
+
+// SandboxRetentionRule purges the records of every sandbox once they have
+// not been written for ttl
+func SandboxRetentionRule(ttl time.Duration) RetentionRule {
+	return RetentionRule{Prefix: SandboxRecordPrefix, MaxAge: ttl}
+}
+
+// sandboxPrefix returns the ID prefix of the records of the sandbox of ctx,
+// empty outside a sandbox
+func sandboxPrefix(ctx context.Context) string {
+	if name := SandboxFromContext(ctx); name != "" {
+		return SandboxRecordPrefix + name + "/"
+	}
+	return ""
+}
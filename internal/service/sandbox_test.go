@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_Sandbox(t *testing.T) {
+	ctx := context.Background()
+	sandbox := WithSandbox(ctx, "acme")
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(),
+		WithRetentionRules([]RetentionRule{SandboxRetentionRule(time.Millisecond)}))
+	defer svc.Close()
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+
+	insert := func(ctx context.Context, name string) {
+		t.Helper()
+		task, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": name})})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := svc.WaitForWrite(ctx, task.ID); err != nil {
+			t.Fatalf("Insert of %s not applied: %v", name, err)
+		}
+	}
+	insert(ctx, "Ada")
+	insert(sandbox, "Bob")
+
+	record, err := svc.Get(sandbox, "user_1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record.ID != "user_1" || valueField(record, "name") != "Bob" {
+		t.Errorf("Expected the sandbox record as user_1, got %s: %v", record.ID, valueField(record, "name"))
+	}
+	record, err = svc.Get(ctx, "user_1")
+	if err != nil || valueField(record, "name") != "Ada" {
+		t.Fatalf("Expected the production record untouched, got %+v, %v", record, err)
+	}
+
+	for _, tt := range []struct {
+		ctx  context.Context
+		name string
+	}{{ctx, "Ada"}, {sandbox, "Bob"}} {
+		list, err := svc.ListRecords(tt.ctx, "", 10, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(list.Records) != 1 || list.Records[0].ID != "user_1" || valueField(list.Records[0], "name") != tt.name {
+			t.Errorf("Expected only the record of %s listed, got %+v", tt.name, list.Records)
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	reports := svc.EvaluateRetention(ctx, false)
+	if len(reports) != 1 || reports[0].Deleted != 1 {
+		t.Fatalf("Expected the sandbox record purged, got %+v", reports)
+	}
+	if _, err := svc.Get(sandbox, "user_1"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected the sandbox record gone, got %v", err)
+	}
+	if _, err := svc.Get(ctx, "user_1"); err != nil {
+		t.Errorf("Expected the production record kept, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"mit-service/internal/models"
+)
+
+// scanPageSize is the number of records read per query by background scans
+const scanPageSize = 1000
+
+// scanJob runs one admin-triggered background scan at a time and keeps the
+// report of the running or last finished run
+type scanJob[R any] struct {
+	mu      sync.Mutex
+	running bool
+	report  *R
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// start runs scan in the background, reporting initial until it returns.
+// It fails with ErrScanRunning while a scan is in progress
+func (j *scanJob[R]) start(initial *R, scan func(ctx context.Context) *R) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.running {
+		return models.ErrScanRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	j.running, j.report, j.cancel, j.done = true, initial, cancel, done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		result := scan(ctx)
+
+		j.mu.Lock()
+		j.running, j.report = false, result
+		j.mu.Unlock()
+	}()
+
+	return nil
+}
+
+// last returns a copy of the running or last report, nil before the first run
+func (j *scanJob[R]) last() *R {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.report == nil {
+		return nil
+	}
+	copied := *j.report
+	return &copied
+}
+
+// stop cancels a running scan and waits for it to finish
+func (j *scanJob[R]) stop() {
+	j.mu.Lock()
+	cancel, done := j.cancel, j.done
+	j.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// scanRecords calls fn with every record, paging through them by ID
+func (s *Service) scanRecords(ctx context.Context, fn func(*models.Record)) error {
+	filter := models.RecordFilter{Limit: scanPageSize}
+	for {
+		records, err := s.repo.Record.ListRecords(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			fn(record)
+		}
+
+		if len(records) < filter.Limit {
+			return nil
+		}
+		filter.AfterID = records[len(records)-1].ID
+	}
+}
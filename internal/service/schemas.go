@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+	"mit-service/internal/reqtrace"
+	"mit-service/internal/schema"
+)
+
+// schemaRecordPrefix is where record type schemas are stored, in-band as
+// ordinary records, so every backend persists them without extra tables
+const schemaRecordPrefix = "_system/schemas/"
+
+// schemaCacheTTL bounds how long another instance's schema change can go unseen
+const schemaCacheTTL = time.Minute
+
+// recordTypeNamePattern restricts record type names
+var recordTypeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// cachedSchema is a compiled schema, nil when the type does not exist
+type cachedSchema struct {
+	schema   *schema.Schema
+	loadedAt time.Time
+}
+
+// schemaRegistry resolves record types to compiled schemas, caching lookups
+type schemaRegistry struct {
+	records repository.RecordRepository
+
+	mu    sync.Mutex
+	cache map[string]cachedSchema
+
+	// Whether any type is registered, and when that was checked
+	anyTypes        bool
+	anyTypesChecked time.Time
+}
+
+// newSchemaRegistry creates a registry reading schemas from records
+func newSchemaRegistry(records repository.RecordRepository) *schemaRegistry {
+	return &schemaRegistry{
+		records: records,
+		cache:   make(map[string]cachedSchema),
+	}
+}
+
+// lookup returns the compiled schema of a record type, wrapping
+// models.ErrUnknownRecordType when the type is not registered
+func (r *schemaRegistry) lookup(ctx context.Context, name string) (*schema.Schema, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[name]
+	r.mu.Unlock()
+
+	fresh := ok && time.Since(cached.loadedAt) <= schemaCacheTTL
+	reqtrace.FromContext(ctx).CacheLookup("schema", name, fresh)
+	if !fresh {
+		record, err := r.records.Get(repository.WithSystemAccess(ctx), schemaRecordPrefix+name)
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			cached = cachedSchema{loadedAt: time.Now()}
+		case err != nil:
+			return nil, fmt.Errorf("failed to load schema for record type '%s': %w", name, err)
+		default:
+			var compiled *schema.Schema
+			doc, err := record.DecodedValue()
+			if err == nil {
+				compiled, err = schema.CompileValue(doc)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("stored schema for record type '%s' is invalid: %w", name, err)
+			}
+			cached = cachedSchema{schema: compiled, loadedAt: time.Now()}
+		}
+
+		r.mu.Lock()
+		r.cache[name] = cached
+		r.mu.Unlock()
+	}
+
+	if cached.schema == nil {
+		return nil, fmt.Errorf("record type '%s': %w", name, models.ErrUnknownRecordType)
+	}
+	return cached.schema, nil
+}
+
+// hasTypes reports whether any record type is registered, so untyped
+// deployments skip the extra read validating updates
+func (r *schemaRegistry) hasTypes(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	anyTypes, checked := r.anyTypes, r.anyTypesChecked
+	r.mu.Unlock()
+
+	if time.Since(checked) <= schemaCacheTTL {
+		return anyTypes, nil
+	}
+
+	records, err := r.records.ListRecords(repository.WithSystemAccess(ctx), models.RecordFilter{Prefix: schemaRecordPrefix, Limit: 1})
+	if err != nil {
+		return false, fmt.Errorf("failed to check for record types: %w", err)
+	}
+	anyTypes = len(records) > 0
+
+	r.mu.Lock()
+	r.anyTypes, r.anyTypesChecked = anyTypes, time.Now()
+	r.mu.Unlock()
+
+	return anyTypes, nil
+}
+
+// invalidate drops cached lookups after a local schema change
+func (r *schemaRegistry) invalidate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, name)
+	r.anyTypesChecked = time.Time{}
+}
+
+// validate checks value against the schema of a record type
+func (r *schemaRegistry) validate(ctx context.Context, typeName string, value interface{}) error {
+	compiled, err := r.lookup(ctx, typeName)
+	if err != nil {
+		return err
+	}
+
+	if err := compiled.Validate(value); err != nil {
+		return fmt.Errorf("%w for record type '%s': %v", models.ErrSchemaValidation, typeName, err)
+	}
+	return nil
+}
+
+// withSchemaRegistry makes the worker validate enriched values against the
+// record types of registry, shared with the service
+func withSchemaRegistry(registry *schemaRegistry) WorkerOption {
+	return func(w *InboxWorker) {
+		w.schemas = registry
+	}
+}
+
+// validateRecordTypeName rejects names that cannot be stored
+func validateRecordTypeName(name string) error {
+	if !recordTypeNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: type name must be 1-64 letters, digits, '_', '.' or '-'", models.ErrInvalidSchema)
+	}
+	return nil
+}
+
+// PutRecordType registers or replaces the JSON Schema of a record type.
+// Existing records are not revalidated
+func (s *Service) PutRecordType(ctx context.Context, recordType *models.RecordType) error {
+	if err := validateRecordTypeName(recordType.Name); err != nil {
+		return err
+	}
+	if _, err := schema.CompileValue(recordType.Schema); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrInvalidSchema, err)
+	}
+
+	encoded, err := json.Marshal(recordType.Schema)
+	if err != nil {
+		return fmt.Errorf("failed to encode schema of record type '%s': %w", recordType.Name, err)
+	}
+	record := &models.Record{
+		ID:    schemaRecordPrefix + recordType.Name,
+		Value: encoded,
+	}
+
+	err = s.repo.Record.Update(ctx, record)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		err = s.repo.Record.Insert(ctx, record)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store record type '%s': %w", recordType.Name, err)
+	}
+
+	s.schemas.invalidate(recordType.Name)
+	return nil
+}
+
+// GetRecordType returns a registered record type
+func (s *Service) GetRecordType(ctx context.Context, name string) (*models.RecordType, error) {
+	if err := validateRecordTypeName(name); err != nil {
+		return nil, err
+	}
+
+	record, err := s.repo.Record.Get(repository.WithSystemAccess(ctx), schemaRecordPrefix+name)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return nil, fmt.Errorf("record type '%s': %w", name, models.ErrUnknownRecordType)
+		}
+		return nil, fmt.Errorf("failed to get record type '%s': %w", name, err)
+	}
+
+	return recordTypeFromRecord(record), nil
+}
+
+// ListRecordTypes returns all registered record types
+func (s *Service) ListRecordTypes(ctx context.Context) ([]*models.RecordType, error) {
+	var types []*models.RecordType
+
+	const pageSize = 100
+	for offset := 0; ; offset += pageSize {
+		records, err := s.repo.Record.ListRecords(ctx, models.RecordFilter{
+			Prefix: schemaRecordPrefix,
+			Limit:  pageSize,
+			Offset: offset,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list record types: %w", err)
+		}
+
+		for _, record := range records {
+			types = append(types, recordTypeFromRecord(record))
+		}
+		if len(records) < pageSize {
+			return types, nil
+		}
+	}
+}
+
+// DeleteRecordType removes a record type. Types still used by records are
+// kept and the call fails with models.ErrRecordExists
+func (s *Service) DeleteRecordType(ctx context.Context, name string) error {
+	if err := validateRecordTypeName(name); err != nil {
+		return err
+	}
+
+	inUse, err := s.repo.Record.ListRecords(ctx, models.RecordFilter{Type: name, Limit: 1})
+	if err != nil {
+		return fmt.Errorf("failed to check record type '%s' usage: %w", name, err)
+	}
+	if len(inUse) > 0 {
+		return fmt.Errorf("record type '%s' is used by records and %w", name, models.ErrRecordExists)
+	}
+
+	if err := s.repo.Record.Delete(ctx, schemaRecordPrefix+name); err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return fmt.Errorf("record type '%s': %w", name, models.ErrUnknownRecordType)
+		}
+		return fmt.Errorf("failed to delete record type '%s': %w", name, err)
+	}
+
+	s.schemas.invalidate(name)
+	return nil
+}
+
+// ListRecords lists records, optionally of one type. Internal records
+// (record type schemas) are never listed; in a sandbox or collection only
+// its own records are, without those of the collections within it
+func (s *Service) ListRecords(ctx context.Context, recordType string, limit, offset int) (*models.RecordsListResponse, error) {
+	trace := reqtrace.FromContext(ctx)
+	defer trace.Span("service", "ListRecords")()
+
+	prefix := scopePrefix(ctx)
+	filter := models.RecordFilter{
+		Type:          recordType,
+		Prefix:        prefix,
+		ExcludePrefix: prefix + repository.SystemRecordPrefix,
+		Limit:         limit,
+		Offset:        offset,
+	}
+
+	endRepo := trace.Span("repository", "Record.ListRecords")
+	records, err := s.repo.Record.ListRecords(ctx, filter)
+	endRepo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+	for _, record := range records {
+		record.ID = unscoped(ctx, record.ID)
+	}
+
+	return &models.RecordsListResponse{
+		Records: records,
+		Type:    recordType,
+		Limit:   limit,
+		Offset:  offset,
+	}, nil
+}
+
+// validateUpdate runs the script rules and validates an update against the
+// type of the stored record. Missing records are left to the worker, which
+// reports them as not found
+func (s *Service) validateUpdate(ctx context.Context, id string, value *requestValue) error {
+	recordType, err := s.storedRecordType(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.runScripts(ctx, models.TaskOperationUpdate, id, recordType, value); err != nil {
+		return err
+	}
+
+	if recordType == "" {
+		return nil
+	}
+	return s.validateValue(ctx, recordType, value)
+}
+
+// storedRecordType returns the type of a stored record, skipping the read
+// when no record types are registered
+func (s *Service) storedRecordType(ctx context.Context, id string) (string, error) {
+	hasTypes, err := s.schemas.hasTypes(ctx)
+	if err != nil || !hasTypes {
+		return "", err
+	}
+
+	record, err := s.repo.Record.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to load record type: %w", err)
+	}
+	return record.Type, nil
+}
+
+// recordTypeFromRecord converts a stored schema record
+func recordTypeFromRecord(record *models.Record) *models.RecordType {
+	var schemaDoc map[string]interface{}
+	record.DecodeValue(&schemaDoc)
+	return &models.RecordType{
+		Name:   strings.TrimPrefix(record.ID, schemaRecordPrefix),
+		Schema: schemaDoc,
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// scopeName is the syntax of the names of tenants and collections, which
+// become an ID segment
+var scopeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// keyspacePrefix returns the ID prefix of the keyspace of a request: that
+// of its sandbox, holding the keyspace of each tenant, and of its tenant.
+// Collections are kept within the keyspace. Sandboxes come first so a
+// single retention rule purges all of them
+func keyspacePrefix(ctx context.Context) string {
+	return sandboxPrefix(ctx) + tenantPrefix(ctx)
+}
+
+// scopePrefix returns the ID prefix of the records a request sees: those of
+// its keyspace and collection, empty for the records of the flat keyspace
+func scopePrefix(ctx context.Context) string {
+	return keyspacePrefix(ctx) + collectionPrefix(ctx)
+}
+
+// ConfineToScope confines the record accesses with ctx to the records of its
+// scope, call after setting the sandbox, tenant and collection of ctx. The
+// repository then rejects IDs outside the scope and system IDs within it
+// with models.ErrSystemRecord, while the service reads and writes the
+// system records it keeps on behalf of the request
+func ConfineToScope(ctx context.Context) context.Context {
+	return repository.WithRecordScope(ctx, scopePrefix(ctx))
+}
+
+// withScopeOf returns ctx in the sandbox, tenant and collection of the stored
+// record id, for work on records found outside of a request
+func withScopeOf(ctx context.Context, id string) context.Context {
+	if name, rest, ok := cutScope(id, SandboxRecordPrefix); ok {
+		ctx, id = WithSandbox(ctx, name), rest
+	}
+	if name, rest, ok := cutScope(id, TenantRecordPrefix); ok {
+		ctx, id = WithTenant(ctx, name), rest
+	}
+	if name, _, ok := cutScope(id, CollectionRecordPrefix); ok {
+		ctx = WithCollection(ctx, name)
+	}
+	return ctx
+}
+
+// cutScope splits the ID of a record below prefix into the name of its scope
+// and the rest of the ID
+func cutScope(id, prefix string) (name, rest string, ok bool) {
+	if rest, ok = strings.CutPrefix(id, prefix); !ok {
+		return "", id, false
+	}
+	return strings.Cut(rest, "/")
+}
+
+// scoped returns the stored ID of the record the caller calls id
+func scoped(ctx context.Context, id string) string {
+	return scopePrefix(ctx) + id
+}
+
+// unscoped returns the ID the caller knows a stored record by
+func unscoped(ctx context.Context, id string) string {
+	return strings.TrimPrefix(id, scopePrefix(ctx))
+}
+
+// scopedTaskID returns the stored ID of the task the caller calls id. Task
+// IDs are namespaced by keyspace, collections share the task IDs of theirs
+func scopedTaskID(ctx context.Context, id string) string {
+	return keyspacePrefix(ctx) + id
+}
+
+// unscopedTask returns task with the IDs the caller knows it and the record
+// of its payload by, a copy in a keyspace so the stored task is left as is
+func unscopedTask(ctx context.Context, task *models.InboxTask) *models.InboxTask {
+	prefix := keyspacePrefix(ctx)
+	if prefix == "" {
+		return task
+	}
+	copied := *task
+	copied.ID = strings.TrimPrefix(task.ID, prefix)
+	copied.Payload = unscopedPayload(ctx, task.Payload)
+	return &copied
+}
+
+// unscopedPayload returns a task payload with the ID of its record as the
+// caller knows it. Payloads without a record ID in the scope are returned
+// as they are
+func unscopedPayload(ctx context.Context, payload json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(payload, &fields) != nil {
+		return payload
+	}
+	var id string
+	if json.Unmarshal(fields["id"], &id) != nil || !strings.HasPrefix(id, scopePrefix(ctx)) {
+		return payload
+	}
+	fields["id"], _ = json.Marshal(unscoped(ctx, id))
+	unscopedFields, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return unscopedFields
+}
+
+// taskVisible reports whether the caller of ctx sees task, a task of its
+// keyspace and tenant. Tasks of the keyspaces within it, such as those of
+// sandboxes outside the sandbox, are not seen
+func taskVisible(ctx context.Context, task *models.InboxTask) bool {
+	rest, ok := strings.CutPrefix(task.ID, keyspacePrefix(ctx))
+	return ok && !repository.IsSystemID(rest) && task.TenantID == TenantFromContext(ctx)
+}
+
+// scopedInsert returns req with the stored ID of its record, a copy in a
+// scope so the caller's request is left as is
+func scopedInsert(ctx context.Context, req *models.InsertRequest) *models.InsertRequest {
+	if scopePrefix(ctx) == "" {
+		return req
+	}
+	copied := *req
+	copied.ID = scoped(ctx, req.ID)
+	return &copied
+}
+
+// scopedUpdate is scopedInsert for updates
+func scopedUpdate(ctx context.Context, req *models.UpdateRequest) *models.UpdateRequest {
+	if scopePrefix(ctx) == "" {
+		return req
+	}
+	copied := *req
+	copied.ID = scoped(ctx, req.ID)
+	return &copied
+}
+
+// scopedDelete is scopedInsert for deletes
+func scopedDelete(ctx context.Context, req *models.DeleteRequest) *models.DeleteRequest {
+	if scopePrefix(ctx) == "" {
+		return req
+	}
+	copied := *req
+	copied.ID = scoped(ctx, req.ID)
+	return &copied
+}
+
+// scopedProto is scopedInsert for protobuf writes
+func scopedProto(ctx context.Context, req *models.ProtoWriteRequest) *models.ProtoWriteRequest {
+	if scopePrefix(ctx) == "" {
+		return req
+	}
+	copied := *req
+	copied.ID = scoped(ctx, req.ID)
+	return &copied
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_SystemRecords(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithReservations(time.Hour))
+	defer svc.Close()
+
+	if err := svc.PutRecordType(ctx, &models.RecordType{Name: "user", Schema: map[string]interface{}{"type": "object"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	confined := ConfineToScope(ctx)
+
+	value := map[string]interface{}{"name": "Ada"}
+	if _, err := svc.Insert(confined, &models.InsertRequest{ID: "_system/flags", Value: models.MustEncodeValue(value)}); !errors.Is(err, models.ErrSystemRecord) {
+		t.Errorf("Expected the insert of a system record rejected, got %v", err)
+	}
+	if _, err := svc.Get(confined, schemaRecordPrefix+"user"); !errors.Is(err, models.ErrSystemRecord) {
+		t.Errorf("Expected the read of a record type rejected, got %v", err)
+	}
+	if _, err := svc.Delete(confined, &models.DeleteRequest{ID: schemaRecordPrefix + "user"}); !errors.Is(err, models.ErrSystemRecord) {
+		t.Errorf("Expected the delete of a record type rejected, got %v", err)
+	}
+
+	// The service keeps its system records on behalf of confined requests
+	if _, err := svc.Reserve(confined, "user_1", 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Insert(ConfineToScope(WithCollection(ctx, "archive")), &models.InsertRequest{ID: "user_1", Type: "user", Value: models.MustEncodeValue(value)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.GetCollection(confined, "archive"); err != nil {
+		t.Errorf("Expected the collection registered, got %v", err)
+	}
+
+	sandbox := ConfineToScope(WithSandbox(ctx, "acme"))
+	if _, err := svc.Insert(sandbox, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(value)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Get(sandbox, "_system/reservations/user_1"); !errors.Is(err, models.ErrSystemRecord) {
+		t.Errorf("Expected the system records of the sandbox out of reach, got %v", err)
+	}
+}
+
+func TestService_TasksOfTenant(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	acme := ConfineToScope(WithTenant(ctx, "acme"))
+	task, err := svc.Insert(acme, &models.InsertRequest{ID: "u1", Value: models.MustEncodeValue(map[string]interface{}{"n": 1})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "u2", Value: models.MustEncodeValue(map[string]interface{}{"n": 2})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The tenant sees its task under the IDs it wrote, without the stats of
+	// the tasks of others
+	tasks, err := svc.GetTasks(acme, "", 10, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks.Tasks) != 1 || tasks.Tasks[0].ID != task.ID || payloadRecordID(tasks.Tasks[0].Payload) != "u1" {
+		t.Errorf("Expected the task of u1, got %+v", tasks.Tasks)
+	}
+	if tasks.Stats != nil {
+		t.Errorf("Expected no instance-wide stats for a tenant, got %+v", tasks.Stats)
+	}
+
+	stored, err := svc.GetTask(acme, task.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id := payloadRecordID(stored.Payload); id != "u1" {
+		t.Errorf("Expected the payload of u1 under its tenant ID, got %q", id)
+	}
+
+	if tasks, err := svc.GetTasks(ctx, "", 10, 0); err != nil || tasks.Stats == nil || tasks.Stats.TotalTasks != 2 {
+		t.Errorf("Expected the stats of every task outside a tenant, got %+v, %v", tasks, err)
+	}
+}
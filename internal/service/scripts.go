@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mit-service/internal/models"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// maxScriptLength bounds the source of a single script rule
+const maxScriptLength = 4096
+
+// maxScriptEvaluations bounds the script evaluations running at once. expr
+// cannot interrupt an evaluation, so those outliving their write keep their
+// slot until they finish and later writes wait for one within their limit
+const maxScriptEvaluations = 64
+
+// errScriptTimeout is returned when a script exceeds its time limit
+var errScriptTimeout = errors.New("script exceeded its time limit")
+
+// ScriptRule is an operator-supplied expression evaluated on every write of
+// a record type. A rule without Set is a check that must evaluate to true;
+// a rule with Set stores its result in that field of the value
+type ScriptRule struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // record type, empty or "*" for every write
+	Expr    string `json:"expr"`
+	Set     string `json:"set,omitempty"`
+	Message string `json:"message,omitempty"` // reported when a check fails
+}
+
+// scriptEnv is the environment scripts are evaluated in
+type scriptEnv struct {
+	ID    string                 `expr:"id"`
+	Type  string                 `expr:"type"`
+	Op    string                 `expr:"op"` // "insert" or "update"
+	Value map[string]interface{} `expr:"value"`
+}
+
+// compiledRule is a script rule compiled once at load time
+type compiledRule struct {
+	ScriptRule
+	program *vm.Program
+}
+
+// ScriptRules evaluates validation and enrichment scripts per record type.
+// Scripts are expr-lang expressions, bounded by the language's memory budget,
+// a source length limit and a per-write time limit
+type ScriptRules struct {
+	rules   []compiledRule
+	timeout time.Duration
+	slots   chan struct{} // held by running evaluations
+}
+
+// LoadScriptRules reads a JSON array of script rules from path
+func LoadScriptRules(path string, timeout time.Duration) (*ScriptRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script rules: %w", err)
+	}
+
+	var rules []ScriptRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse script rules %s: %w", path, err)
+	}
+	return NewScriptRules(rules, timeout)
+}
+
+// NewScriptRules compiles script rules. Rules run in the given order, so an
+// enrichment rule can feed a later check
+func NewScriptRules(rules []ScriptRule, timeout time.Duration) (*ScriptRules, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Type == "*" {
+			rule.Type = ""
+		}
+		if strings.TrimSpace(rule.Expr) == "" {
+			return nil, fmt.Errorf("script %s: expr is required", rule.Name)
+		}
+		if len(rule.Expr) > maxScriptLength {
+			return nil, fmt.Errorf("script %s: expr longer than %d bytes", rule.Name, maxScriptLength)
+		}
+
+		opts := []expr.Option{expr.Env(scriptEnv{})}
+		if rule.Set == "" {
+			opts = append(opts, expr.AsBool())
+		}
+		program, err := expr.Compile(rule.Expr, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("script %s: %w", rule.Name, err)
+		}
+
+		compiled = append(compiled, compiledRule{ScriptRule: rule, program: program})
+	}
+
+	return &ScriptRules{rules: compiled, timeout: timeout, slots: make(chan struct{}, maxScriptEvaluations)}, nil
+}
+
+// Len returns the number of rules
+func (s *ScriptRules) Len() int {
+	return len(s.rules)
+}
+
+// sets reports whether a rule matching recordType sets a field of the value
+func (s *ScriptRules) sets(recordType string) bool {
+	for _, rule := range s.rules {
+		if rule.Set != "" && (rule.Type == "" || rule.Type == recordType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs the rules matching recordType against value, modifying it in
+// place. Failed checks and script errors wrap models.ErrSchemaValidation
+func (s *ScriptRules) Apply(ctx context.Context, op, id, recordType string, value map[string]interface{}) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	// Scripts see numbers as float64, which expr computes with, while the
+	// value keeps the numbers as written
+	env := scriptEnv{ID: id, Type: recordType, Op: op, Value: scriptNumbers(value).(map[string]interface{})}
+	for _, rule := range s.rules {
+		if rule.Type != "" && rule.Type != recordType {
+			continue
+		}
+
+		result, err := s.run(ctx, rule.program, env)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			return fmt.Errorf("%w: script %s: %v", models.ErrSchemaValidation, rule.Name, err)
+		}
+
+		if rule.Set != "" {
+			value[rule.Set] = result
+			env.Value[rule.Set] = result
+			continue
+		}
+		if ok, _ := result.(bool); !ok {
+			message := rule.Message
+			if message == "" {
+				message = "check failed"
+			}
+			return fmt.Errorf("%w: script %s: %s", models.ErrSchemaValidation, rule.Name, message)
+		}
+	}
+	return nil
+}
+
+// scriptNumbers returns a copy of a decoded JSON value with its json.Numbers
+// replaced by float64s
+func scriptNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = scriptNumbers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = scriptNumbers(item)
+		}
+		return converted
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// run evaluates a program, giving up once ctx is done. The evaluation itself
+// cannot be interrupted and finishes in the background, bounded by the
+// expr memory budget and holding one of the evaluation slots until then
+func (s *ScriptRules) run(ctx context.Context, program *vm.Program, env scriptEnv) (interface{}, error) {
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, scriptContextError(ctx)
+	}
+
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := expr.Run(program, env)
+		<-s.slots
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-ctx.Done():
+		return nil, scriptContextError(ctx)
+	}
+}
+
+// scriptContextError returns the error of a script run given up as ctx is
+// done, errScriptTimeout once its time limit is over
+func scriptContextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errScriptTimeout
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestScriptRules_Apply(t *testing.T) {
+	rules, err := NewScriptRules([]ScriptRule{
+		{Name: "total", Type: "order", Set: "total", Expr: "value.price * value.qty"},
+		{Name: "positive", Type: "order", Expr: "value.total > 0", Message: "total must be positive"},
+		{Name: "no-test-ids", Type: "*", Expr: "!(id startsWith 'test_')"},
+	}, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	value := map[string]interface{}{"price": 2.5, "qty": 4.0}
+	if err := rules.Apply(ctx, models.TaskOperationInsert, "o1", "order", value); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value["total"] != 10.0 {
+		t.Errorf("Expected total 10, got %v", value["total"])
+	}
+
+	value = map[string]interface{}{"price": 2.5, "qty": 0.0}
+	err = rules.Apply(ctx, models.TaskOperationInsert, "o2", "order", value)
+	if !errors.Is(err, models.ErrSchemaValidation) {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	// Typed rules don't apply to other types, untyped rules do
+	if err := rules.Apply(ctx, models.TaskOperationInsert, "u1", "user", map[string]interface{}{}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	err = rules.Apply(ctx, models.TaskOperationInsert, "test_1", "", map[string]interface{}{})
+	if !errors.Is(err, models.ErrSchemaValidation) {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
+
+func TestNewScriptRules_Invalid(t *testing.T) {
+	for _, rule := range []ScriptRule{
+		{Name: "empty"},
+		{Name: "syntax", Expr: "value.a >"},
+		{Name: "not-bool", Expr: "1 + 1"},
+		{Name: "unknown", Expr: "nosuchvar == 1"},
+	} {
+		if _, err := NewScriptRules([]ScriptRule{rule}, time.Second); err == nil {
+			t.Errorf("Expected error for rule %s", rule.Name)
+		}
+	}
+}
+
+func TestScriptRules_EvaluationSlots(t *testing.T) {
+	rules, err := NewScriptRules([]ScriptRule{{Name: "check", Expr: "true"}}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Evaluations still running past their limit hold every slot
+	for i := 0; i < maxScriptEvaluations; i++ {
+		rules.slots <- struct{}{}
+	}
+	err = rules.Apply(context.Background(), models.TaskOperationInsert, "a", "", map[string]interface{}{})
+	if !errors.Is(err, models.ErrSchemaValidation) || !strings.Contains(err.Error(), errScriptTimeout.Error()) {
+		t.Errorf("Expected a timeout waiting for a slot, got %v", err)
+	}
+
+	<-rules.slots
+	if err := rules.Apply(context.Background(), models.TaskOperationInsert, "a", "", map[string]interface{}{}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if n := len(rules.slots); n != maxScriptEvaluations-1 {
+		t.Errorf("Expected the slot released after the evaluation, %d held", n)
+	}
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+	"mit-service/internal/reqtrace"
+)
+
+// Search index document results, used as metric labels
+const (
+	searchIndexed = "indexed"
+	searchDeleted = "deleted"
+	searchFailed  = "failed"
+)
+
+// SearchIndex is an Elasticsearch or OpenSearch index mirroring the records
+type SearchIndex interface {
+	// Index returns the name of the index
+	Index() string
+
+	// Bulk indexes records and deletes the documents of deletes
+	Bulk(ctx context.Context, records []*models.Record, deletes []string) error
+
+	// Search runs a search request and returns the response of the index
+	Search(ctx context.Context, params url.Values, body []byte) (json.RawMessage, error)
+}
+
+// SearchIndexConfig configures mirroring of changes into a search index
+type SearchIndexConfig struct {
+	// Interval is how often the change stream is polled, BatchSize bounds
+	// the changes read per query and the documents sent per bulk request
+	Interval  time.Duration
+	BatchSize int
+
+	// Lookback is how far back the change stream is replayed on start
+	Lookback time.Duration
+
+	// SettleDelay holds back changes completed more recently than this, so a
+	// task committed with an earlier completion time is not skipped
+	SettleDelay time.Duration
+}
+
+// indexer tails the completed inbox tasks like the replicator and writes the
+// current state of the records they touched to the search index. Indexing a
+// record twice is harmless, so the cursor is kept in memory only
+type indexer struct {
+	source  *repository.RepositoryManager
+	index   SearchIndex
+	metrics *metrics.Metrics
+	cfg     SearchIndexConfig
+
+	mu      sync.Mutex
+	status  models.SearchIndexStatus
+	afterID string
+
+	// removed holds the IDs of records deleted without a task, by the
+	// retention rules, whose documents are deleted with the next batch
+	removed []string
+
+	// reindex indexes every record, started by StartSearchReindex
+	reindex scanJob[models.ReindexReport]
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// StartSearchIndex starts mirroring changes into index, beginning with the
+// changes completed within the configured lookback
+func (s *Service) StartSearchIndex(index SearchIndex, cfg SearchIndexConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("search index interval must be positive, got %v", cfg.Interval)
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("search index batch size must be positive, got %d", cfg.BatchSize)
+	}
+
+	x := &indexer{
+		source:  s.repo,
+		index:   index,
+		metrics: s.metrics,
+		cfg:     cfg,
+		stopCh:  make(chan struct{}),
+		status: models.SearchIndexStatus{
+			Index:  index.Index(),
+			Cursor: time.Now().Add(-cfg.Lookback),
+		},
+	}
+	s.search = x
+
+	x.wg.Add(1)
+	go x.run()
+	return nil
+}
+
+// SearchIndexStatus returns the progress of the search indexer
+func (s *Service) SearchIndexStatus() (*models.SearchIndexStatus, error) {
+	if s.search == nil {
+		return nil, models.ErrSearchDisabled
+	}
+
+	x := s.search
+	x.mu.Lock()
+	status := x.status
+	x.mu.Unlock()
+
+	status.Reindex = x.reindex.last()
+	return &status, nil
+}
+
+// StartSearchReindex starts indexing every record in the background, to fill
+// a new index or one that fell behind the retained change stream. Documents
+// of records deleted before the lookback are not removed
+func (s *Service) StartSearchReindex() (*models.ReindexReport, error) {
+	if s.search == nil {
+		return nil, models.ErrSearchDisabled
+	}
+
+	x := s.search
+	report := &models.ReindexReport{Status: models.ScanRunning, StartedAt: time.Now()}
+
+	err := x.reindex.start(report, func(ctx context.Context) *models.ReindexReport {
+		result := *report
+		defer func() {
+			now := time.Now()
+			result.FinishedAt = &now
+		}()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var batch []*models.Record
+		var bulkErr error
+		flush := func() {
+			if bulkErr != nil || len(batch) == 0 {
+				return
+			}
+			if err := x.index.Bulk(ctx, batch, nil); err != nil {
+				x.metrics.RecordSearchIndexDocuments(searchFailed, len(batch))
+				bulkErr = err
+				cancel()
+				return
+			}
+			x.metrics.RecordSearchIndexDocuments(searchIndexed, len(batch))
+			result.Indexed += len(batch)
+			batch = batch[:0]
+		}
+
+		err := s.scanRecords(ctx, func(record *models.Record) {
+			result.Scanned++
+			batch = append(batch, record)
+			if len(batch) >= x.cfg.BatchSize {
+				flush()
+			}
+		})
+		if err == nil {
+			flush()
+		}
+		if bulkErr != nil {
+			err = bulkErr
+		}
+
+		if err != nil {
+			result.Status = models.ScanFailed
+			result.Error = err.Error()
+			log.Printf("Search reindex failed after %d records: %v", result.Scanned, err)
+		} else {
+			result.Status = models.ScanCompleted
+			log.Printf("Search reindex completed: %d records indexed", result.Indexed)
+		}
+		return &result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// Search passes a search request through to the search index
+func (s *Service) Search(ctx context.Context, params url.Values, body []byte) (json.RawMessage, error) {
+	defer reqtrace.FromContext(ctx).Span("service", "Search")()
+
+	if s.search == nil {
+		return nil, models.ErrSearchDisabled
+	}
+	return s.search.index.Search(ctx, params, body)
+}
+
+// run polls the change stream until stopped
+func (x *indexer) run() {
+	defer x.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-x.stopCh
+		cancel()
+	}()
+
+	ticker := time.NewTicker(x.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the backlog before waiting for the next tick
+		for more := true; more; {
+			more = x.indexBatch(ctx)
+		}
+
+		select {
+		case <-x.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// indexBatch indexes the records touched by the next batch of settled
+// changes in one bulk request and reports whether more are waiting
+func (x *indexer) indexBatch(ctx context.Context) bool {
+	x.mu.Lock()
+	cursor, afterID := x.status.Cursor, x.afterID
+	removed := x.removed[:min(len(x.removed), x.cfg.BatchSize)]
+	x.mu.Unlock()
+
+	tasks, err := x.source.Inbox.GetCompletedTasksAfter(ctx, cursor, afterID, x.cfg.BatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			x.fail(fmt.Errorf("failed to read changes: %w", err), nil, 0)
+		}
+		return false
+	}
+
+	settled := time.Now().Add(-x.cfg.SettleDelay)
+	var pending *models.InboxTask
+	for i, task := range tasks {
+		if task.UpdatedAt.After(settled) {
+			pending = task
+			tasks = tasks[:i]
+			break
+		}
+	}
+
+	records, deletes, err := x.collect(ctx, tasks)
+	deletes = append(deletes, removed...)
+	if err == nil && len(records)+len(deletes) > 0 {
+		err = x.index.Bulk(ctx, records, deletes)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			var oldest *models.InboxTask
+			if len(tasks) > 0 {
+				oldest = tasks[0]
+			}
+			x.fail(fmt.Errorf("failed to index changes: %w", err), oldest, len(records)+len(deletes))
+		}
+		return false
+	}
+	var last *models.InboxTask
+	if len(tasks) > 0 {
+		last = tasks[len(tasks)-1]
+	}
+	x.advance(last, len(removed), len(records), len(deletes))
+
+	switch {
+	case pending != nil:
+		x.setLag(pending.UpdatedAt)
+		return false
+	case len(tasks) < x.cfg.BatchSize:
+		x.setLag(time.Time{})
+		return len(removed) == x.cfg.BatchSize && ctx.Err() == nil
+	}
+	x.setLag(tasks[len(tasks)-1].UpdatedAt)
+	return ctx.Err() == nil
+}
+
+// collect reads the current state of the records touched by tasks, listing
+// the ones that no longer exist for deletion
+func (x *indexer) collect(ctx context.Context, tasks []*models.InboxTask) ([]*models.Record, []string, error) {
+	var records []*models.Record
+	var deletes []string
+	seen := make(map[string]bool)
+
+	for _, task := range tasks {
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(task.Payload, &payload); err != nil || payload.ID == "" || seen[payload.ID] {
+			// Custom operations without a record ID have nothing to index
+			continue
+		}
+		seen[payload.ID] = true
+
+		record, err := x.source.Record.Get(ctx, payload.ID)
+		if errors.Is(err, models.ErrRecordNotFound) {
+			deletes = append(deletes, payload.ID)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read record %s: %w", payload.ID, err)
+		}
+		records = append(records, record)
+	}
+	return records, deletes, nil
+}
+
+// remove queues the deletion of the documents of records deleted without a
+// task. Like the cursor the queue is kept in memory only
+func (x *indexer) remove(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removed = append(x.removed, ids...)
+}
+
+// advance moves the cursor past an indexed batch, nil last when it had no
+// changes, and drops the first drained removed records
+func (x *indexer) advance(last *models.InboxTask, drained, indexed, deleted int) {
+	x.metrics.RecordSearchIndexDocuments(searchIndexed, indexed)
+	x.metrics.RecordSearchIndexDocuments(searchDeleted, deleted)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if last != nil {
+		x.status.Cursor, x.afterID = last.UpdatedAt, last.ID
+	}
+	x.removed = x.removed[drained:]
+	x.status.Indexed += int64(indexed)
+	x.status.Deleted += int64(deleted)
+}
+
+// fail records a failed poll, the batch is retried on the next one
+func (x *indexer) fail(err error, oldest *models.InboxTask, documents int) {
+	log.Printf("Search index: %v", err)
+	x.metrics.RecordSearchIndexDocuments(searchFailed, documents)
+	if oldest != nil {
+		x.setLag(oldest.UpdatedAt)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.status.Failures++
+	x.status.LastError = err.Error()
+}
+
+// setLag sets the lag to the age of the oldest change not yet indexed, zero
+// when caught up
+func (x *indexer) setLag(oldest time.Time) {
+	var lag time.Duration
+	if !oldest.IsZero() {
+		lag = time.Since(oldest)
+	}
+	x.metrics.SetSearchIndexLag(lag)
+
+	x.mu.Lock()
+	x.status.LagSeconds = lag.Seconds()
+	x.mu.Unlock()
+}
+
+// Stop stops the indexer and a running reindex
+func (x *indexer) Stop() {
+	x.once.Do(func() { close(x.stopCh) })
+	x.wg.Wait()
+	x.reindex.stop()
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// fakeSearchIndex keeps indexed documents in memory, failing bulk requests
+// while err is set
+type fakeSearchIndex struct {
+	mu    sync.Mutex
+	err   error
+	docs  map[string]interface{}
+	bulks int
+}
+
+func (f *fakeSearchIndex) Index() string {
+	return "records"
+}
+
+func (f *fakeSearchIndex) Bulk(ctx context.Context, records []*models.Record, deletes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.bulks++
+	for _, record := range records {
+		f.docs[record.ID], _ = record.DecodedValue()
+	}
+	for _, id := range deletes {
+		delete(f.docs, id)
+	}
+	return nil
+}
+
+func (f *fakeSearchIndex) Search(ctx context.Context, params url.Values, body []byte) (json.RawMessage, error) {
+	return json.RawMessage(`{"q":"` + params.Get("q") + `"}`), nil
+}
+
+func (f *fakeSearchIndex) snapshot() map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	docs := make(map[string]interface{}, len(f.docs))
+	for id, value := range f.docs {
+		docs[id] = value
+	}
+	return docs
+}
+
+func TestService_SearchIndex(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+
+	// "a" is written twice, "c" was deleted and is still in the index
+	for _, id := range []string{"a", "b"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue("current " + id)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	changes := []struct{ id, operation string }{
+		{"a", models.TaskOperationInsert},
+		{"b", models.TaskOperationInsert},
+		{"a", models.TaskOperationUpdate},
+		{"c", models.TaskOperationDelete},
+	}
+	for i, change := range changes {
+		task := &models.InboxTask{
+			ID:        "task_" + string(rune('0'+i)),
+			Operation: change.operation,
+			Payload:   []byte(`{"id":"` + change.id + `"}`),
+			Status:    models.TaskStatusPending,
+			CreatedAt: time.Now(),
+		}
+		if err := mock.CreateTask(ctx, task); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := mock.UpdateTaskStatus(ctx, task.ID, models.TaskStatusCompleted, ""); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	index := &fakeSearchIndex{err: errors.New("cluster unavailable"), docs: map[string]interface{}{"c": "deleted"}}
+	svc := NewService(repo, metrics.NewMetrics())
+	defer svc.Close()
+
+	if _, err := svc.SearchIndexStatus(); !errors.Is(err, models.ErrSearchDisabled) {
+		t.Fatalf("Expected ErrSearchDisabled before starting, got %v", err)
+	}
+
+	err := svc.StartSearchIndex(index, SearchIndexConfig{
+		Interval:  10 * time.Millisecond,
+		BatchSize: 10,
+		Lookback:  time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Failed batches are retried until the cluster is back
+	waitFor(t, "a failed bulk request", func() bool {
+		status, _ := svc.SearchIndexStatus()
+		return status.Failures > 0
+	})
+	index.mu.Lock()
+	index.err = nil
+	index.mu.Unlock()
+
+	var status *models.SearchIndexStatus
+	waitFor(t, "the changes indexed", func() bool {
+		status, _ = svc.SearchIndexStatus()
+		return status.Indexed+status.Deleted > 0
+	})
+
+	expected := map[string]interface{}{"a": "current a", "b": "current b"}
+	if docs := index.snapshot(); !reflect.DeepEqual(docs, expected) {
+		t.Errorf("Expected index %v, got %v", expected, docs)
+	}
+	if status.Index != "records" || status.Indexed != 2 || status.Deleted != 1 || status.LastError == "" {
+		t.Errorf("Expected 2 indexed and 1 deleted after a failure, got %+v", status)
+	}
+
+	response, err := svc.Search(ctx, url.Values{"q": {"ada"}}, nil)
+	if err != nil || string(response) != `{"q":"ada"}` {
+		t.Errorf("Expected the index response, got %s, %v", response, err)
+	}
+}
+
+func TestService_SearchIndexRetention(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+
+	for _, id := range []string{"tmp_1", "tmp_2", "user_1"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(id)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	index := &fakeSearchIndex{docs: map[string]interface{}{"tmp_1": "tmp_1", "tmp_2": "tmp_2", "user_1": "user_1"}}
+	svc := NewService(repo, metrics.NewMetrics(), WithRetentionRules([]RetentionRule{{Prefix: "tmp_", MaxAge: time.Millisecond}}))
+	defer svc.Close()
+
+	// A batch size of one drains the deletes over several bulk requests
+	if err := svc.StartSearchIndex(index, SearchIndexConfig{Interval: 10 * time.Millisecond, BatchSize: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reports := svc.EvaluateRetention(ctx, false); reports[0].Deleted != 2 {
+		t.Fatalf("Expected 2 records deleted, got %+v", reports[0])
+	}
+
+	waitFor(t, "the retention deletes indexed", func() bool {
+		status, _ := svc.SearchIndexStatus()
+		return status.Deleted == 2
+	})
+	expected := map[string]interface{}{"user_1": "user_1"}
+	if docs := index.snapshot(); !reflect.DeepEqual(docs, expected) {
+		t.Errorf("Expected index %v, got %v", expected, docs)
+	}
+}
+
+func TestService_SearchReindex(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(id)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	index := &fakeSearchIndex{docs: map[string]interface{}{}}
+	svc := NewService(repo, metrics.NewMetrics())
+	defer svc.Close()
+
+	if err := svc.StartSearchIndex(index, SearchIndexConfig{Interval: time.Hour, BatchSize: 2}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report, err := svc.StartSearchReindex()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	waitFor(t, "the reindex", func() bool {
+		status, _ := svc.SearchIndexStatus()
+		report = status.Reindex
+		return report.Status != models.ScanRunning
+	})
+
+	if report.Status != models.ScanCompleted || report.Scanned != 3 || report.Indexed != 3 {
+		t.Errorf("Expected 3 records indexed, got %+v", report)
+	}
+	if docs := index.snapshot(); len(docs) != 3 || index.bulks != 2 {
+		t.Errorf("Expected 3 documents in 2 bulk requests, got %v in %d", docs, index.bulks)
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mit-service/internal/models"
+)
+
+// selfTestRecordPrefix is the ID prefix of self-test records, hidden from
+// listings like the other system records
+const selfTestRecordPrefix = "_system/selftest/"
+
+// SelfTest inserts, reads, updates and deletes a throwaway record, reading
+// it back after every write, and reports the latency of each step. With
+// viaInbox the writes are queued like API writes and waited for, which needs
+// a running inbox worker; otherwise they go to the repository directly. The
+// test stops at the first failing step and removes the record if it exists
+func (s *Service) SelfTest(ctx context.Context, viaInbox bool) *models.SelfTestReport {
+	start := time.Now()
+	nonce := uuid.New().String()
+	report := &models.SelfTestReport{RecordID: selfTestRecordPrefix + nonce, ViaInbox: viaInbox}
+
+	st := &selfTest{service: s, ctx: ctx, id: report.RecordID, viaInbox: viaInbox}
+	inserted := map[string]interface{}{"nonce": nonce, "step": "insert"}
+	updated := map[string]interface{}{"nonce": nonce, "step": "update"}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"insert", func() error { return st.insert(inserted) }},
+		{"get", func() error { return st.expect(inserted) }},
+		{"update", func() error { return st.update(updated) }},
+		{"get_updated", func() error { return st.expect(updated) }},
+		{"delete", st.delete},
+		{"get_deleted", func() error { return st.expect(nil) }},
+	}
+
+	report.Passed = true
+	for _, step := range steps {
+		stepStart := time.Now()
+		err := step.run()
+		result := &models.SelfTestStep{Name: step.name, DurationMs: float64(time.Since(stepStart).Microseconds()) / 1000}
+		report.Steps = append(report.Steps, result)
+		if err != nil {
+			result.Error = err.Error()
+			report.Passed = false
+			break
+		}
+	}
+
+	if !report.Passed {
+		failed := report.Steps[len(report.Steps)-1]
+		log.Printf("Self-test failed at %s: %s", failed.Name, failed.Error)
+		st.cleanup()
+	}
+	report.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return report
+}
+
+// selfTest runs the steps of a self-test on one record
+type selfTest struct {
+	service  *Service
+	ctx      context.Context
+	id       string
+	viaInbox bool
+}
+
+func (st *selfTest) insert(value map[string]interface{}) error {
+	encoded, err := models.EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	if st.viaInbox {
+		return st.queued(st.service.Insert(st.ctx, &models.InsertRequest{ID: st.id, Value: encoded}))
+	}
+	return st.service.repo.Record.Insert(st.ctx, &models.Record{ID: st.id, Value: encoded})
+}
+
+func (st *selfTest) update(value map[string]interface{}) error {
+	encoded, err := models.EncodeValue(value)
+	if err != nil {
+		return err
+	}
+	if st.viaInbox {
+		return st.queued(st.service.Update(st.ctx, &models.UpdateRequest{ID: st.id, Value: encoded}))
+	}
+	return st.service.repo.Record.Update(st.ctx, &models.Record{ID: st.id, Value: encoded})
+}
+
+func (st *selfTest) delete() error {
+	if st.viaInbox {
+		return st.queued(st.service.Delete(st.ctx, &models.DeleteRequest{ID: st.id}))
+	}
+	return st.service.repo.Record.Delete(st.ctx, st.id)
+}
+
+// queued waits until a queued write is applied
+func (st *selfTest) queued(task *models.InboxTask, err error) error {
+	if err != nil {
+		return err
+	}
+	return st.service.WaitForWrite(st.ctx, task.ID)
+}
+
+// expect reads the record and checks it holds value, or that it is gone
+// for nil
+func (st *selfTest) expect(value map[string]interface{}) error {
+	record, err := st.service.repo.Record.Get(st.ctx, st.id)
+	if value == nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("record still exists after delete")
+	}
+	if err != nil {
+		return err
+	}
+
+	var stored map[string]interface{}
+	if err := record.DecodeValue(&stored); err != nil {
+		return err
+	}
+	if stored["nonce"] != value["nonce"] || stored["step"] != value["step"] {
+		return fmt.Errorf("read %v, expected %v", stored, value)
+	}
+	return nil
+}
+
+// cleanup removes the record of a failed self-test. A write still queued
+// may recreate it; it is hidden from listings either way
+func (st *selfTest) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := st.service.repo.Record.Delete(ctx, st.id)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		log.Printf("Self-test: failed to remove record %s: %v", st.id, err)
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_SelfTest(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithConsistencyWait(200*time.Millisecond))
+	defer svc.Close()
+
+	report := svc.SelfTest(ctx, false)
+	if !report.Passed || len(report.Steps) != 6 {
+		t.Fatalf("Expected the direct self-test to pass all steps, got %+v", report)
+	}
+	if !strings.HasPrefix(report.RecordID, selfTestRecordPrefix) {
+		t.Errorf("Expected a system record, got %s", report.RecordID)
+	}
+
+	// Without a worker the queued insert is never applied
+	report = svc.SelfTest(ctx, true)
+	if report.Passed || len(report.Steps) != 1 || !strings.Contains(report.Steps[0].Error, "not applied") {
+		t.Fatalf("Expected the insert step to time out, got %+v", report.Steps)
+	}
+
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	report = svc.SelfTest(ctx, true)
+	if !report.Passed || !report.ViaInbox {
+		t.Fatalf("Expected the self-test through the inbox to pass, got %+v", report.Steps)
+	}
+	for _, step := range report.Steps {
+		if step.Error != "" {
+			t.Errorf("Unexpected error in step %s: %s", step.Name, step.Error)
+		}
+	}
+
+	// A passing self-test leaves no record behind
+	if _, err := mock.Get(ctx, report.RecordID); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected the self-test record removed, got %v", err)
+	}
+}
@@ -8,6 +8,10 @@ import (
 	"mit-service/internal/metrics"
 	"mit-service/internal/models"
 	"mit-service/internal/repository"
+	"mit-service/internal/reqtrace"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,20 +22,204 @@ type Service struct {
 	repo    *repository.RepositoryManager
 	worker  *InboxWorker
 	metrics *metrics.Metrics
+
+	// tableStatsMonitor periodically exports table statistics
+	tableStatsMonitor *tableStatsMonitor
+
+	// planMonitor periodically checks the plans of hot queries
+	planMonitor *planMonitor
+
+	// metricsCollector periodically samples runtime stats, connection pools,
+	// queue depth and worker utilization
+	metricsCollector *metricsCollector
+
+	// schemas resolves record types to their JSON Schemas, protos to their
+	// protobuf messages
+	schemas *schemaRegistry
+	protos  *protoRegistry
+
+	// transforms rewrites values on insert and update, nil for none
+	transforms *TransformPipeline
+
+	// scripts are operator-supplied validation and enrichment rules, nil for none
+	scripts *ScriptRules
+
+	// operations holds custom task operations, shared with the worker
+	operations *OperationRegistry
+
+	// Record retention rules and the worker applying them
+	retentionRules  []RetentionRule
+	retentionWorker *retentionWorker
+
+	// collections holds the index record IDs of collections known to be
+	// registered
+	collections sync.Map
+
+	// idStrategy generates the IDs of inserts without one, nil when inserts
+	// need an ID
+	idStrategy IDStrategy
+
+	// maxReservationLease is the longest a record ID can be reserved for,
+	// 0 when reservations are disabled
+	maxReservationLease time.Duration
+
+	// transactionalEnqueue verifies the record exists in the same
+	// transaction that enqueues update and delete tasks
+	transactionalEnqueue bool
+
+	// startup tracks the steps reported by the startup probe
+	startup *startupTracker
+
+	// Readiness thresholds, see WithReadinessThresholds
+	stallTimeout  time.Duration
+	maxBacklogAge time.Duration
+
+	// accessStats counts record reads and writes, nil unless started
+	accessStats *accessTracker
+
+	// duplicates runs the duplicate scan started by StartDuplicateScan
+	duplicates scanJob[models.DuplicateReport]
+
+	// consistencyWait bounds how long a read waits for a write to be applied
+	consistencyWait time.Duration
+
+	// integrity runs integrity checks, started by the admin endpoint or
+	// periodically by integrityMonitor
+	integrity        scanJob[models.IntegrityReport]
+	integrityMonitor *integrityMonitor
+
+	// clones runs the clone from another instance started by StartClone
+	clones scanJob[models.CloneReport]
+
+	// reprocess replays finished tasks, started by StartReprocess
+	reprocess scanJob[models.ReprocessReport]
+
+	// verify replays completed tasks against shadow, started by StartVerify;
+	// shadow is nil unless set by WithShadowRepository
+	verify scanJob[models.VerifyReport]
+	shadow repository.RecordRepository
+
+	// primaryRouter and shadowRouter let a cutover swap the primary and the
+	// shadow backend, nil without a shadow
+	primaryRouter *repository.RecordRouter
+	shadowRouter  *repository.RecordRouter
+	cutover       scanJob[models.CutoverReport]
+
+	// mirror copies writes to shadow, nil unless started
+	mirror *shadowMirror
+
+	// replication copies changes to a secondary database, nil unless started
+	replication *replicator
+
+	// ingest imports files from an object store, nil unless started
+	ingest *ingester
+
+	// search mirrors records into a search index, nil unless started
+	search *indexer
+
+	// analytics exports changes to a warehouse, nil unless started
+	analytics *exporter
+
+	// digest reports failed tasks, nil unless started
+	digest *digester
+
+	// composites caches composite documents, nil when disabled
+	composites *compositeCache
+
+	// changes streams the writes the worker applies to subscribers
+	changes *changeFeed
+}
+
+// Option configures optional service behaviour
+type Option func(*Service)
+
+// WithTransactionalEnqueue rejects updates and deletes of missing records at
+// enqueue time by reading the record and creating the task in one transaction.
+// It has no effect unless records and inbox share a database
+func WithTransactionalEnqueue() Option {
+	return func(s *Service) {
+		s.transactionalEnqueue = true
+	}
+}
+
+// WithTransforms applies the pipeline to every inserted and updated value
+func WithTransforms(pipeline *TransformPipeline) Option {
+	return func(s *Service) {
+		s.transforms = pipeline
+	}
+}
+
+// WithScriptRules evaluates the script rules on every insert and update
+func WithScriptRules(rules *ScriptRules) Option {
+	return func(s *Service) {
+		s.scripts = rules
+	}
 }
 
 // NewService creates a new service instance
-func NewService(repo *repository.RepositoryManager, metrics *metrics.Metrics) *Service {
-	return &Service{
-		repo:    repo,
-		metrics: metrics,
+func NewService(repo *repository.RepositoryManager, metrics *metrics.Metrics, opts ...Option) *Service {
+	s := &Service{
+		repo:       repo,
+		metrics:    metrics,
+		operations: NewOperationRegistry(),
+		startup:    newStartupTracker(),
+		changes:    newChangeFeed(),
+
+		stallTimeout:    defaultWorkerStallTimeout,
+		consistencyWait: defaultConsistencyWait,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.shadow != nil {
+		s.primaryRouter = repository.RouteRecords(repo)
+		s.shadowRouter = repository.NewRecordRouter(s.shadow)
+		s.shadow = s.shadowRouter
 	}
+	// Guarded past the router, so promoting the shadow keeps the boundary
+	s.repo = repository.Guard(repo)
+	s.schemas = newSchemaRegistry(s.repo.Record)
+	s.protos = newProtoRegistry(s.repo.Record)
+
+	// The repository manager initializes the schema before the service exists
+	s.startup.complete(StartupStepRepository, "")
+
+	return s
 }
 
 // StartInboxWorker starts the inbox pattern worker
-func (s *Service) StartInboxWorker(workerCount int, batchSize int, pollInterval time.Duration, maxRetries int, retryDelay time.Duration) {
-	s.worker = NewInboxWorker(s.repo, s.metrics, workerCount, batchSize, pollInterval, maxRetries, retryDelay)
+func (s *Service) StartInboxWorker(workerCount int, batchSize int, pollInterval time.Duration, maxRetries int, retryDelay time.Duration, opts ...WorkerOption) {
+	opts = append([]WorkerOption{WithOperationRegistry(s.operations), withSchemaRegistry(s.schemas)}, opts...)
+	opts = append(opts, withWriteMiddleware(s.recordMiddleware()...))
+	s.worker = NewInboxWorker(s.repo, s.metrics, workerCount, batchSize, pollInterval, maxRetries, retryDelay, opts...)
 	s.worker.Start()
+	s.startup.complete(StartupStepInboxWorker, fmt.Sprintf("%d workers", workerCount))
+}
+
+// recordMiddleware returns the middleware acting on persisted record writes,
+// which the deletes of the retention rules go through as well
+func (s *Service) recordMiddleware() []TaskMiddleware {
+	// Outside the composite cache, so subscribers reading a change see it
+	middleware := []TaskMiddleware{s.changes.middleware}
+	if s.composites != nil {
+		middleware = append(middleware, s.composites.middleware)
+	}
+	if s.mirror != nil {
+		// Innermost, so only writes the primary persisted are mirrored
+		middleware = append(middleware, s.mirror.middleware)
+	}
+	return middleware
+}
+
+// taskMiddleware returns the middleware the worker was started with through
+// WithTaskMiddleware, none before it starts
+func (s *Service) taskMiddleware() []TaskMiddleware {
+	if s.worker == nil {
+		return nil
+	}
+	return s.worker.middleware
 }
 
 // StopInboxWorker stops the inbox pattern worker
@@ -41,97 +229,431 @@ func (s *Service) StopInboxWorker() {
 	}
 }
 
-// Insert creates a new record asynchronously using inbox pattern
-func (s *Service) Insert(ctx context.Context, req *models.InsertRequest) error {
+// Insert creates a new record asynchronously using inbox pattern and returns
+// the queued task. A request without ID gets one from the ID strategy
+func (s *Service) Insert(ctx context.Context, req *models.InsertRequest) (*models.InboxTask, error) {
+	trace := reqtrace.FromContext(ctx)
+	defer trace.Span("service", "Insert")()
+
+	if err := s.assignID(req); err != nil {
+		return nil, err
+	}
+	if err := s.registerCollection(ctx); err != nil {
+		return nil, err
+	}
+	req = scopedInsert(ctx, req)
+	task, err := s.insertTask(ctx, req, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	endRepo := trace.Span("repository", "Inbox.CreateTask")
+	err = s.repo.Inbox.CreateTask(ctx, task)
+	endRepo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create insert task: %w", err)
+	}
+
+	s.accessStats.track(req.ID, true)
+	return unscopedTask(ctx, task), nil
+}
+
+// InsertBatch creates records asynchronously like Insert, queueing the
+// tasks of all of them in one repository call. Either every task is queued
+// or none is: an invalid request fails the whole batch
+func (s *Service) InsertBatch(ctx context.Context, reqs []*models.InsertRequest) ([]*models.InboxTask, error) {
+	trace := reqtrace.FromContext(ctx)
+	defer trace.Span("service", "InsertBatch")()
+
+	// Tasks are claimed in creation order, so the tasks of a batch are a
+	// microsecond apart (the precision of PostgreSQL timestamps) to keep
+	// writes of the same record in request order
+	now := time.Now()
+	tasks := make([]*models.InboxTask, len(reqs))
+	taskIDs := make(map[string]bool, len(reqs))
+	for i, req := range reqs {
+		if err := s.assignID(req); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		if req.TaskID != "" && taskIDs[req.TaskID] {
+			return nil, fmt.Errorf("record %d: task with id '%s' %w", i, req.TaskID, models.ErrTaskExists)
+		}
+		taskIDs[req.TaskID] = true
+		req = scopedInsert(ctx, req)
+		task, err := s.insertTask(ctx, req, now.Add(time.Duration(i)*time.Microsecond))
+		if err != nil {
+			return nil, fmt.Errorf("record %d (%s): %w", i, req.ID, err)
+		}
+		tasks[i] = task
+	}
+
+	if err := s.registerCollection(ctx); err != nil {
+		return nil, err
+	}
+
+	endRepo := trace.Span("repository", "Inbox.CreateTasks")
+	err := s.repo.Inbox.CreateTasks(ctx, tasks)
+	endRepo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create insert tasks: %w", err)
+	}
+
+	for i, req := range reqs {
+		s.accessStats.track(scoped(ctx, req.ID), true)
+		tasks[i] = unscopedTask(ctx, tasks[i])
+	}
+	return tasks, nil
+}
+
+// insertTask transforms and validates the value of an insert and builds its
+// task, created at createdAt
+func (s *Service) insertTask(ctx context.Context, req *models.InsertRequest, createdAt time.Time) (*models.InboxTask, error) {
+	value, err := newRequestValue(req.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transformValue(value); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkReservation(ctx, req.ID, req.Reservation); err != nil {
+		return nil, err
+	}
+
+	if err := s.runScripts(ctx, models.TaskOperationInsert, req.ID, req.Type, value); err != nil {
+		return nil, err
+	}
+
+	if req.Type != "" {
+		if err := s.validateValue(ctx, req.Type, value); err != nil {
+			return nil, err
+		}
+	}
+
+	encoded, err := value.encoded()
+	if err != nil {
+		return nil, err
+	}
 	payload, err := json.Marshal(&models.InsertTaskPayload{
 		ID:    req.ID,
-		Value: req.Value,
+		Type:  req.Type,
+		Value: encoded,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal insert payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal insert payload: %w", err)
 	}
 
-	task := &models.InboxTask{
-		ID:        uuid.New().String(),
+	taskID, err := newTaskID(ctx, req.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.InboxTask{
+		ID:        taskID,
 		Operation: models.TaskOperationInsert,
 		Payload:   payload,
 		Status:    models.TaskStatusPending,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
 		Retries:   0,
+		TenantID:  TenantFromContext(ctx),
+	}, nil
+}
+
+// maxTaskIDLength is the longest task ID a client may supply, the width of
+// the id column
+const maxTaskIDLength = 255
+
+// newTaskID returns the stored ID of the task ID a client supplied for a
+// write, a new UUID when it supplied none. Task IDs are namespaced by the
+// keyspace of ctx like record IDs, so the IDs of a keyspace neither collide
+// with nor reveal those of the others
+func newTaskID(ctx context.Context, clientID string) (string, error) {
+	if clientID == "" {
+		return scopedTaskID(ctx, uuid.New().String()), nil
+	}
+	maxLength := maxTaskIDLength - len(keyspacePrefix(ctx))
+	if len(clientID) > maxLength || strings.TrimSpace(clientID) != clientID {
+		return "", fmt.Errorf("%w: at most %d characters without surrounding spaces", models.ErrInvalidTaskID, maxLength)
 	}
+	if strings.HasPrefix(clientID, repository.SystemRecordPrefix) {
+		return "", fmt.Errorf("%w: the %s prefix is reserved", models.ErrInvalidTaskID, repository.SystemRecordPrefix)
+	}
+	return scopedTaskID(ctx, clientID), nil
+}
 
-	if err := s.repo.Inbox.CreateTask(ctx, task); err != nil {
-		return fmt.Errorf("failed to create insert task: %w", err)
+// Update modifies an existing record asynchronously using inbox pattern and
+// returns the queued task
+func (s *Service) Update(ctx context.Context, req *models.UpdateRequest) (*models.InboxTask, error) {
+	defer reqtrace.FromContext(ctx).Span("service", "Update")()
+
+	req = scopedUpdate(ctx, req)
+	value, err := newRequestValue(req.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transformValue(value); err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	if err := s.validateUpdate(ctx, req.ID, value); err != nil {
+		return nil, err
+	}
 
-// Update modifies an existing record asynchronously using inbox pattern
-func (s *Service) Update(ctx context.Context, req *models.UpdateRequest) error {
+	encoded, err := value.encoded()
+	if err != nil {
+		return nil, err
+	}
 	payload, err := json.Marshal(&models.UpdateTaskPayload{
-		ID:    req.ID,
-		Value: req.Value,
+		ID:              req.ID,
+		Value:           encoded,
+		ExpectedVersion: req.ExpectedVersion,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal update payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal update payload: %w", err)
 	}
 
+	taskID, err := newTaskID(ctx, req.TaskID)
+	if err != nil {
+		return nil, err
+	}
 	task := &models.InboxTask{
-		ID:        uuid.New().String(),
+		ID:        taskID,
 		Operation: models.TaskOperationUpdate,
 		Payload:   payload,
 		Status:    models.TaskStatusPending,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Retries:   0,
+		TenantID:  TenantFromContext(ctx),
 	}
 
-	if err := s.repo.Inbox.CreateTask(ctx, task); err != nil {
-		return fmt.Errorf("failed to create update task: %w", err)
+	if err := s.enqueueForExisting(ctx, req.ID, req.ExpectedVersion, task); err != nil {
+		return nil, fmt.Errorf("failed to create update task: %w", err)
 	}
 
-	return nil
+	s.accessStats.track(req.ID, true)
+	return unscopedTask(ctx, task), nil
 }
 
-// Delete removes a record asynchronously using inbox pattern
-func (s *Service) Delete(ctx context.Context, req *models.DeleteRequest) error {
+// Delete removes a record asynchronously using inbox pattern and returns the
+// queued task. The on_delete rules of the records referencing it are applied
+// with it, see referenceTasks
+func (s *Service) Delete(ctx context.Context, req *models.DeleteRequest) (*models.InboxTask, error) {
+	defer reqtrace.FromContext(ctx).Span("service", "Delete")()
+
+	req = scopedDelete(ctx, req)
 	payload, err := json.Marshal(&models.DeleteTaskPayload{
-		ID: req.ID,
+		ID:              req.ID,
+		ExpectedVersion: req.ExpectedVersion,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal delete payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal delete payload: %w", err)
 	}
 
+	taskID, err := newTaskID(ctx, req.TaskID)
+	if err != nil {
+		return nil, err
+	}
 	task := &models.InboxTask{
-		ID:        uuid.New().String(),
+		ID:        taskID,
 		Operation: models.TaskOperationDelete,
 		Payload:   payload,
 		Status:    models.TaskStatusPending,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Retries:   0,
+		TenantID:  TenantFromContext(ctx),
 	}
 
-	if err := s.repo.Inbox.CreateTask(ctx, task); err != nil {
-		return fmt.Errorf("failed to create delete task: %w", err)
+	related, err := s.referenceTasks(ctx, req.ID, task.CreatedAt)
+	if err != nil {
+		return nil, err
 	}
 
+	if err := s.enqueueForExisting(ctx, req.ID, req.ExpectedVersion, task, related...); err != nil {
+		return nil, fmt.Errorf("failed to create delete task: %w", err)
+	}
+
+	s.accessStats.track(req.ID, true)
+	return unscopedTask(ctx, task), nil
+}
+
+// transform applies the configured write transformations to value
+func (s *Service) transform(value map[string]interface{}) error {
+	if s.transforms == nil {
+		return nil
+	}
+	if err := s.transforms.Apply(value); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrSchemaValidation, err)
+	}
+	return nil
+}
+
+// requestValue is the raw JSON object of a write, decoded the first time a
+// transform, script or schema inspects it. It is stored as sent, with its
+// key order and numbers, unless a transform or script may have changed it
+type requestValue struct {
+	raw     json.RawMessage
+	decoded map[string]interface{}
+	changed bool
+}
+
+// newRequestValue rejects raw values that are not JSON objects
+func newRequestValue(raw json.RawMessage) (*requestValue, error) {
+	if !models.IsObjectValue(raw) {
+		return nil, fmt.Errorf("%w: value must be a JSON object", models.ErrSchemaValidation)
+	}
+	return &requestValue{raw: raw}, nil
+}
+
+// object returns the decoded value, to be modified in place when change is
+// set
+func (v *requestValue) object(change bool) (map[string]interface{}, error) {
+	if v.decoded == nil {
+		if err := models.UnmarshalValue(v.raw, &v.decoded); err != nil {
+			return nil, fmt.Errorf("%w: invalid value: %v", models.ErrSchemaValidation, err)
+		}
+	}
+	v.changed = v.changed || change
+	return v.decoded, nil
+}
+
+// encoded returns the value to store, the raw one when nothing changed it
+func (v *requestValue) encoded() (json.RawMessage, error) {
+	if !v.changed {
+		return v.raw, nil
+	}
+	encoded, err := json.Marshal(v.decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value: %w", err)
+	}
+	return encoded, nil
+}
+
+// transformValue applies the configured write transformations to value
+func (s *Service) transformValue(value *requestValue) error {
+	if s.transforms == nil {
+		return nil
+	}
+	object, err := value.object(true)
+	if err != nil {
+		return err
+	}
+	return s.transform(object)
+}
+
+// runScripts runs the script rules of operation against value
+func (s *Service) runScripts(ctx context.Context, operation, id, recordType string, value *requestValue) error {
+	if s.scripts == nil {
+		return nil
+	}
+	object, err := value.object(s.scripts.sets(recordType))
+	if err != nil {
+		return err
+	}
+	return s.scripts.Apply(ctx, operation, id, recordType, object)
+}
+
+// validateValue validates value against the schema of recordType
+func (s *Service) validateValue(ctx context.Context, recordType string, value *requestValue) error {
+	object, err := value.object(false)
+	if err != nil {
+		return err
+	}
+	return s.schemas.validate(ctx, recordType, object)
+}
+
+// enqueueForExisting creates a task for an existing record, and the related
+// tasks of other records with it, all of them or none. With transactional
+// enqueue the record is read in the same transaction that creates the tasks.
+// A write expecting a version is rejected right away when the record already
+// has another one; the worker checks again when it applies the task
+func (s *Service) enqueueForExisting(ctx context.Context, recordID string, expectedVersion int64, task *models.InboxTask, related ...*models.InboxTask) error {
+	defer reqtrace.FromContext(ctx).Span("repository", "Inbox.CreateTask")()
+
+	create := func(ctx context.Context, inbox repository.InboxRepository) error {
+		if len(related) == 0 {
+			return inbox.CreateTask(ctx, task)
+		}
+		return inbox.CreateTasks(ctx, append([]*models.InboxTask{task}, related...))
+	}
+
+	if !s.transactionalEnqueue || s.repo.Tx == nil {
+		if expectedVersion != 0 {
+			if err := checkVersion(ctx, s.repo.Record, recordID, expectedVersion); err != nil {
+				return err
+			}
+		}
+		return create(ctx, s.repo.Inbox)
+	}
+
+	return s.repo.Tx.WithinTransaction(ctx, func(ctx context.Context, tx repository.Repository) error {
+		if err := checkVersion(ctx, tx, recordID, expectedVersion); err != nil {
+			return err
+		}
+		return create(ctx, tx)
+	})
+}
+
+// checkVersion fails with models.ErrVersionConflict unless the record has
+// version expected, 0 only checking that it exists
+func checkVersion(ctx context.Context, records repository.RecordRepository, id string, expected int64) error {
+	record, err := records.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if expected != 0 && record.Version != expected {
+		return fmt.Errorf("record with id '%s' has version %d, expected %d: %w", id, record.Version, expected, models.ErrVersionConflict)
+	}
 	return nil
 }
 
 // Get retrieves a record synchronously (read operations are not queued)
 func (s *Service) Get(ctx context.Context, id string) (*models.Record, error) {
+	trace := reqtrace.FromContext(ctx)
+	defer trace.Span("service", "Get")()
+
+	id = scoped(ctx, id)
+	endRepo := trace.Span("repository", "Record.Get")
 	record, err := s.repo.Record.Get(ctx, id)
+	endRepo()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get record: %w", err)
 	}
 
+	s.accessStats.track(id, false)
+	if s.mirror != nil {
+		s.mirror.compareRead(record)
+	}
+	if scopePrefix(ctx) != "" {
+		// The mirror may still be comparing the stored record
+		copied := *record
+		copied.ID = unscoped(ctx, record.ID)
+		return &copied, nil
+	}
 	return record, nil
 }
 
-// GetTasks retrieves tasks with optional filtering and pagination
+// maxPendingChanges bounds the task IDs reported by PendingChanges
+const maxPendingChanges = 100
+
+// PendingChanges returns the IDs of the queued tasks targeting the record
+// that have not been applied yet, oldest first
+func (s *Service) PendingChanges(ctx context.Context, id string) ([]string, error) {
+	tasks, err := s.repo.Inbox.GetOpenTasksForRecord(ctx, scoped(ctx, id), maxPendingChanges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending changes: %w", err)
+	}
+
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = unscopedTask(ctx, task).ID
+	}
+	return ids, nil
+}
+
+// GetTasks retrieves the tasks of the keyspace of ctx with optional
+// filtering and pagination
 func (s *Service) GetTasks(ctx context.Context, status string, limit, offset int) (*models.TasksListResponse, error) {
 	// Set default values
 	if limit <= 0 {
@@ -144,27 +666,34 @@ func (s *Service) GetTasks(ctx context.Context, status string, limit, offset int
 		offset = 0
 	}
 
-	var tasks []*models.InboxTask
-	var err error
-
-	if status == "" {
-		tasks, err = s.repo.Inbox.GetAllTasks(ctx, limit, offset)
-	} else {
-		tasks, err = s.repo.Inbox.GetTasksByStatus(ctx, status, limit, offset)
-	}
-
+	prefix := keyspacePrefix(ctx)
+	tasks, err := s.repo.Inbox.ListTasks(ctx, models.TaskFilter{
+		Status:        status,
+		TenantID:      TenantFromContext(ctx),
+		Prefix:        prefix,
+		ExcludePrefix: prefix + repository.SystemRecordPrefix,
+		Limit:         limit,
+		Offset:        offset,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tasks: %w", err)
 	}
+	for i, task := range tasks {
+		tasks[i] = unscopedTask(ctx, task)
+	}
 
-	// Get stats
-	stats, err := s.repo.Inbox.GetTaskStats(ctx)
-	if err != nil {
-		log.Printf("Failed to get task stats: %v", err)
-		// Don't fail the request if stats retrieval fails
-	} else {
-		// Update queue depth metrics
-		s.metrics.SetQueueDepth(int64(stats.PendingTasks + stats.ProcessingTasks))
+	// Get stats, which count the tasks of every keyspace and tenant, so
+	// callers confined to theirs do not get them
+	var stats *models.TaskStats
+	if prefix == "" {
+		stats, err = s.repo.Inbox.GetTaskStats(ctx)
+		if err != nil {
+			log.Printf("Failed to get task stats: %v", err)
+			// Don't fail the request if stats retrieval fails
+		} else {
+			// Update queue depth metrics
+			s.metrics.SetQueueDepth(int64(stats.PendingTasks + stats.ProcessingTasks))
+		}
 	}
 
 	response := &models.TasksListResponse{
@@ -178,6 +707,63 @@ func (s *Service) GetTasks(ctx context.Context, status string, limit, offset int
 	return response, nil
 }
 
+// GetTask retrieves an inbox task with the processing trace of its last
+// attempt, which is only recorded with task tracing
+func (s *Service) GetTask(ctx context.Context, id string) (*models.InboxTask, error) {
+	task, err := s.repo.Inbox.GetTask(ctx, scopedTaskID(ctx, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+	if !taskVisible(ctx, task) {
+		return nil, fmt.Errorf("failed to get task: task with id '%s' %w", id, models.ErrRecordNotFound)
+	}
+	return unscopedTask(ctx, task), nil
+}
+
+// GetTaskStatuses retrieves the current statuses of the tasks with the IDs
+// with a single repository query. Tasks are answered in the order of their
+// first ID, the IDs of no task are reported as missing
+func (s *Service) GetTaskStatuses(ctx context.Context, ids []string) (*models.TaskStatusResponse, error) {
+	scopedIDs := make([]string, len(ids))
+	for i, id := range ids {
+		scopedIDs[i] = scopedTaskID(ctx, id)
+	}
+	tasks, err := s.repo.Inbox.GetTasksByIDs(ctx, scopedIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+	byID := make(map[string]*models.InboxTask, len(tasks))
+	for _, task := range tasks {
+		if taskVisible(ctx, task) {
+			byID[task.ID] = task
+		}
+	}
+
+	response := &models.TaskStatusResponse{Tasks: []*models.TaskStatus{}, Missing: []string{}}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		task, ok := byID[scopedTaskID(ctx, id)]
+		if !ok {
+			response.Missing = append(response.Missing, id)
+			continue
+		}
+		response.Tasks = append(response.Tasks, &models.TaskStatus{
+			ID:        task.ID,
+			Status:    task.Status,
+			Retries:   task.Retries,
+			Error:     task.Error,
+			Result:    task.Result,
+			UpdatedAt: task.UpdatedAt,
+		})
+	}
+	return response, nil
+}
+
 // GetTaskStats retrieves statistics about inbox tasks
 func (s *Service) GetTaskStats(ctx context.Context) (*models.TaskStats, error) {
 	stats, err := s.repo.Inbox.GetTaskStats(ctx)
@@ -187,8 +773,129 @@ func (s *Service) GetTaskStats(ctx context.Context) (*models.TaskStats, error) {
 	return stats, nil
 }
 
+// GetTableStats retrieves size and bloat statistics of the records and inbox tables
+func (s *Service) GetTableStats(ctx context.Context) ([]*models.TableStats, error) {
+	stats, err := s.repo.TableStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table stats: %w", err)
+	}
+	return stats, nil
+}
+
+// CheckSchema compares the live database schema with the one the service
+// expects, reporting missing tables and columns, changed column types and
+// migrations other than the expected one
+func (s *Service) CheckSchema(ctx context.Context) (*models.SchemaReport, error) {
+	return s.repo.CheckSchema(ctx)
+}
+
+// Explain runs EXPLAIN ANALYZE for the queries an endpoint issues when
+// called with params, e.g. /get with an id
+func (s *Service) Explain(ctx context.Context, endpoint string, params url.Values) (*models.ExplainReport, error) {
+	plans, err := s.repo.ExplainQueries(ctx, endpoint, params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ExplainReport{Endpoint: endpoint, Queries: plans}
+	if len(params) > 0 {
+		report.Params = make(map[string]string, len(params))
+		for name := range params {
+			report.Params[name] = params.Get(name)
+		}
+	}
+	return report, nil
+}
+
+// ListSnapshots lists the saved repository snapshots
+func (s *Service) ListSnapshots(ctx context.Context) ([]*models.SnapshotInfo, error) {
+	if s.repo.Snapshots == nil {
+		return nil, models.ErrSnapshotsUnsupported
+	}
+	return s.repo.Snapshots.List(ctx)
+}
+
+// SaveSnapshot saves the repository state under name
+func (s *Service) SaveSnapshot(ctx context.Context, name string) (*models.SnapshotInfo, error) {
+	if s.repo.Snapshots == nil {
+		return nil, models.ErrSnapshotsUnsupported
+	}
+	return s.repo.Snapshots.Save(ctx, name)
+}
+
+// LoadSnapshot replaces the repository state with the named snapshot
+func (s *Service) LoadSnapshot(ctx context.Context, name string) (*models.SnapshotInfo, error) {
+	if s.repo.Snapshots == nil {
+		return nil, models.ErrSnapshotsUnsupported
+	}
+	return s.repo.Snapshots.Load(ctx, name)
+}
+
+// StartTableStatsMonitor exports table statistics as metrics every interval
+func (s *Service) StartTableStatsMonitor(interval time.Duration) {
+	s.tableStatsMonitor = newTableStatsMonitor(s.repo, s.metrics, interval)
+	s.tableStatsMonitor.Start()
+}
+
+// StartMetricsCollector samples runtime stats, the database connection
+// pools, the inbox queue depth and the worker utilization into the metrics
+// every interval
+func (s *Service) StartMetricsCollector(interval time.Duration) {
+	s.metricsCollector = newMetricsCollector(s.repo, s.metrics, func() *InboxWorker { return s.worker }, interval)
+	s.metricsCollector.Start()
+}
+
+// StartPlanMonitor plans the hot queries every interval and reports plans
+// that turn into sequential scans or cost more than costFactor times before
+func (s *Service) StartPlanMonitor(interval time.Duration, costFactor float64) {
+	s.planMonitor = newPlanMonitor(s.repo, s.metrics, interval, costFactor)
+	s.planMonitor.Start()
+}
+
 // Close closes the service and its dependencies
 func (s *Service) Close() error {
 	s.StopInboxWorker()
+	if s.tableStatsMonitor != nil {
+		s.tableStatsMonitor.Stop()
+	}
+	if s.planMonitor != nil {
+		s.planMonitor.Stop()
+	}
+	if s.metricsCollector != nil {
+		s.metricsCollector.Stop()
+	}
+	if s.retentionWorker != nil {
+		s.retentionWorker.Stop()
+	}
+	if s.accessStats != nil {
+		s.accessStats.Stop()
+	}
+	if s.integrityMonitor != nil {
+		s.integrityMonitor.Stop()
+	}
+	if s.replication != nil {
+		s.replication.Stop()
+	}
+	if s.ingest != nil {
+		s.ingest.Stop()
+	}
+	if s.search != nil {
+		s.search.Stop()
+	}
+	if s.analytics != nil {
+		s.analytics.Stop()
+	}
+	if s.digest != nil {
+		s.digest.Stop()
+	}
+	s.duplicates.stop()
+	s.integrity.stop()
+	s.clones.stop()
+	s.reprocess.stop()
+	s.verify.stop()
+	s.cutover.stop()
+	if s.mirror != nil {
+		s.mirror.Stop()
+	}
 	return nil
 }
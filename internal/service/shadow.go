@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+const (
+	// maxShadowDivergences bounds the recent divergences kept for the status
+	maxShadowDivergences = 20
+
+	// maxShadowReads bounds the read comparisons running at once, reads
+	// sampled while all are busy are not compared
+	maxShadowReads = 16
+)
+
+// Read comparison results
+const (
+	shadowReadMatch    = "match"
+	shadowReadMismatch = "mismatch"
+	shadowReadMissing  = "missing"
+	shadowReadError    = "error"
+)
+
+// WithShadowRepository sets the shadow repository: verify runs replay tasks
+// against it and StartShadowWrites mirrors writes to it, e.g. a new backend
+// before moving to it. Without one every verify run replays into a new
+// in-memory store
+func WithShadowRepository(records repository.RecordRepository) Option {
+	return func(s *Service) {
+		s.shadow = records
+	}
+}
+
+// ShadowConfig configures mirroring writes to the shadow repository
+type ShadowConfig struct {
+	// ReadSampleRate is the share of reads, between 0 and 1, whose record is
+	// also read from the shadow and compared
+	ReadSampleRate float64
+
+	// ReadTimeout bounds a comparison read from the shadow
+	ReadTimeout time.Duration
+}
+
+// shadowMirror applies every persisted task to the shadow repository too and
+// compares sampled reads, counting where the two diverge
+type shadowMirror struct {
+	s   *Service
+	cfg ShadowConfig
+
+	// reads bounds the running read comparisons, wg waits for them
+	reads chan struct{}
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	status models.ShadowStatus
+
+	// backfill copies every record, started by StartShadowBackfill
+	backfill scanJob[models.BackfillReport]
+}
+
+// StartShadowWrites mirrors the writes of the inbox worker to the shadow
+// repository from now on. It must be called before StartInboxWorker. A write
+// failing on the shadow is counted as a divergence and never fails the task
+func (s *Service) StartShadowWrites(cfg ShadowConfig) error {
+	if s.shadow == nil {
+		return errors.New("shadow writes need a shadow repository")
+	}
+	if cfg.ReadSampleRate < 0 || cfg.ReadSampleRate > 1 {
+		return fmt.Errorf("shadow read sample rate must be between 0 and 1, got %g", cfg.ReadSampleRate)
+	}
+	if cfg.ReadSampleRate > 0 && cfg.ReadTimeout <= 0 {
+		return fmt.Errorf("shadow read timeout must be positive, got %v", cfg.ReadTimeout)
+	}
+
+	s.mirror = &shadowMirror{
+		s:     s,
+		cfg:   cfg,
+		reads: make(chan struct{}, maxShadowReads),
+		status: models.ShadowStatus{
+			ReadSampleRate:    cfg.ReadSampleRate,
+			RecentDivergences: []*models.Divergence{},
+		},
+	}
+	return nil
+}
+
+// ShadowStatus returns the mirrored write and compared read counts
+func (s *Service) ShadowStatus() (*models.ShadowStatus, error) {
+	if s.mirror == nil {
+		return nil, models.ErrShadowDisabled
+	}
+
+	m := s.mirror
+	m.mu.Lock()
+	status := m.status
+	status.RecentDivergences = append([]*models.Divergence(nil), m.status.RecentDivergences...)
+	m.mu.Unlock()
+
+	status.Backfill = m.backfill.last()
+	status.Primary = models.BackendOriginal
+	if s.primaryRouter != nil && s.primaryRouter.Rerouted() {
+		status.Primary = models.BackendShadow
+	}
+	status.Cutover = s.cutover.last()
+	return &status, nil
+}
+
+// StartShadowBackfill starts copying every record to the shadow in the
+// background, so records written before mirroring started can be updated
+// and compared there
+func (s *Service) StartShadowBackfill() (*models.BackfillReport, error) {
+	if s.mirror == nil {
+		return nil, models.ErrShadowDisabled
+	}
+
+	// The backends must not be swapped while records are copied
+	if cutover := s.cutover.last(); cutover != nil && cutover.Status == models.ScanRunning {
+		return nil, models.ErrScanRunning
+	}
+
+	m := s.mirror
+	report := &models.BackfillReport{Status: models.ScanRunning, StartedAt: time.Now()}
+
+	err := m.backfill.start(report, func(ctx context.Context) *models.BackfillReport {
+		result := *report
+		defer func() {
+			now := time.Now()
+			result.FinishedAt = &now
+		}()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var copyErr error
+		err := s.scanRecords(ctx, func(record *models.Record) {
+			if copyErr != nil {
+				return
+			}
+			result.Scanned++
+
+			copied, err := m.copyRecord(ctx, record)
+			if err != nil {
+				copyErr = fmt.Errorf("failed to copy record %s: %w", record.ID, err)
+				cancel()
+				return
+			}
+			if copied {
+				result.Copied++
+			}
+		})
+		if copyErr != nil {
+			err = copyErr
+		}
+
+		if err != nil {
+			result.Status = models.ScanFailed
+			result.Error = err.Error()
+			log.Printf("Shadow backfill failed after %d records: %v", result.Scanned, err)
+		} else {
+			result.Status = models.ScanCompleted
+			log.Printf("Shadow backfill completed: %d records scanned, %d copied", result.Scanned, result.Copied)
+		}
+		return &result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// copyRecord writes record to the shadow unless it holds it already and
+// reports whether it did
+func (m *shadowMirror) copyRecord(ctx context.Context, record *models.Record) (bool, error) {
+	existing, err := m.s.shadow.Get(ctx, record.ID)
+	if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+		return false, fmt.Errorf("failed to read shadow record: %w", err)
+	}
+
+	switch {
+	case existing == nil:
+		err = m.s.shadow.Insert(ctx, record)
+	case sameRecord(existing, record):
+		return false, nil
+	default:
+		err = m.s.shadow.Update(ctx, record)
+	}
+	return err == nil, err
+}
+
+// middleware mirrors a task to the shadow once the primary persisted it
+func (m *shadowMirror) middleware(next TaskStep) TaskStep {
+	return func(ctx context.Context, task *models.InboxTask) error {
+		if err := next(ctx, task); err != nil {
+			return err
+		}
+		m.mirrorWrite(ctx, task)
+		return nil
+	}
+}
+
+// mirrorWrite applies task to the shadow
+func (m *shadowMirror) mirrorWrite(ctx context.Context, task *models.InboxTask) {
+	err := applyTask(ctx, m.s.operations, m.s.shadow, task)
+	m.s.metrics.RecordShadowWrite(task.Operation, err == nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.status.MirroredWrites++
+	if err == nil {
+		return
+	}
+	m.status.FailedWrites++
+	log.Printf("Shadow: failed to mirror task %s: %v", task.ID, err)
+	m.addDivergence(&models.Divergence{
+		Kind:     models.DivergenceWriteFailed,
+		RecordID: payloadRecordID(task.Payload),
+		TaskID:   task.ID,
+		Error:    err.Error(),
+	})
+}
+
+// compareRead compares a sampled record read from the primary with the
+// shadow in the background, so the read is not slowed down
+func (m *shadowMirror) compareRead(record *models.Record) {
+	if m.cfg.ReadSampleRate <= 0 || rand.Float64() >= m.cfg.ReadSampleRate {
+		return
+	}
+	select {
+	case m.reads <- struct{}{}:
+	default:
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() { <-m.reads }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.ReadTimeout)
+		defer cancel()
+
+		result, divergence := shadowReadMatch, (*models.Divergence)(nil)
+		copied, err := m.s.shadow.Get(ctx, record.ID)
+		switch {
+		case errors.Is(err, models.ErrRecordNotFound):
+			result = shadowReadMissing
+			divergence = &models.Divergence{Kind: models.DivergenceMissingInShadow, RecordID: record.ID}
+		case err != nil:
+			result = shadowReadError
+			divergence = &models.Divergence{Kind: models.DivergenceReadFailed, RecordID: record.ID, Error: err.Error()}
+		case copied.Type != record.Type:
+			result = shadowReadMismatch
+			divergence = &models.Divergence{
+				Kind: models.DivergenceTypeMismatch, RecordID: record.ID,
+				Error: fmt.Sprintf("type %q in primary, %q in shadow", record.Type, copied.Type),
+			}
+		case !sameRecord(record, copied):
+			result = shadowReadMismatch
+			divergence = &models.Divergence{
+				Kind: models.DivergenceValueMismatch, RecordID: record.ID,
+				Changes: diffRecordValues(record, copied),
+			}
+		}
+		m.s.metrics.RecordShadowRead(result)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.status.ComparedReads++
+		if divergence == nil {
+			m.status.MatchingReads++
+			return
+		}
+		m.status.DivergentReads++
+		m.addDivergence(divergence)
+	}()
+}
+
+// addDivergence keeps divergence as the most recent one. The caller holds
+// m.mu
+func (m *shadowMirror) addDivergence(divergence *models.Divergence) {
+	recent := append([]*models.Divergence{divergence}, m.status.RecentDivergences...)
+	if len(recent) > maxShadowDivergences {
+		recent = recent[:maxShadowDivergences]
+	}
+	m.status.RecentDivergences = recent
+}
+
+// Stop stops a running backfill and waits for the read comparisons
+func (m *shadowMirror) Stop() {
+	m.backfill.stop()
+	m.wg.Wait()
+}
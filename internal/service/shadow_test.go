@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_ShadowWrites(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	shadow := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithShadowRepository(shadow))
+	defer svc.Close()
+
+	if _, err := svc.ShadowStatus(); !errors.Is(err, models.ErrShadowDisabled) {
+		t.Errorf("Expected ErrShadowDisabled, got %v", err)
+	}
+
+	// Written before mirroring started, only the backfill copies it
+	if err := mock.Insert(ctx, &models.Record{ID: "old", Value: models.MustEncodeValue(map[string]interface{}{"n": 1.0})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := svc.StartShadowWrites(ShadowConfig{ReadSampleRate: 1, ReadTimeout: time.Second}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 1, time.Millisecond)
+
+	if _, err := svc.Insert(ctx, &models.InsertRequest{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"n": 1.0})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Update(ctx, &models.UpdateRequest{ID: "old", Value: models.MustEncodeValue(map[string]interface{}{"n": 2.0})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var status *models.ShadowStatus
+	waitFor(t, "the mirrored writes", func() bool {
+		status, _ = svc.ShadowStatus()
+		return status.MirroredWrites == 2
+	})
+	if status.FailedWrites != 1 || len(status.RecentDivergences) != 1 ||
+		status.RecentDivergences[0].Kind != models.DivergenceWriteFailed || status.RecentDivergences[0].RecordID != "old" {
+		t.Fatalf("Expected the update of the missing record to fail on the shadow, got %+v", status)
+	}
+	if record, err := shadow.Get(ctx, "a"); err != nil || valueField(record, "n") != json.Number("1") {
+		t.Errorf("Expected the insert mirrored, got %v, %v", record, err)
+	}
+
+	// Reads are compared in the background
+	if _, err := svc.Get(ctx, "a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := svc.Get(ctx, "old"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the read comparisons", func() bool {
+		status, _ = svc.ShadowStatus()
+		return status.ComparedReads == 2
+	})
+	if status.MatchingReads != 1 || status.DivergentReads != 1 || status.RecentDivergences[0].Kind != models.DivergenceMissingInShadow {
+		t.Errorf("Expected the missing record to diverge, got %+v", status)
+	}
+
+	// The backfill brings the shadow up to date
+	if _, err := svc.StartShadowBackfill(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the backfill", func() bool {
+		status, _ = svc.ShadowStatus()
+		return status.Backfill != nil && status.Backfill.Status != models.ScanRunning
+	})
+	if status.Backfill.Status != models.ScanCompleted || status.Backfill.Scanned != 2 || status.Backfill.Copied != 1 {
+		t.Errorf("Expected the old record copied, got %+v", status.Backfill)
+	}
+	if record, err := shadow.Get(ctx, "old"); err != nil || valueField(record, "n") != json.Number("2") {
+		t.Errorf("Expected the current value backfilled, got %v, %v", record, err)
+	}
+}
+
+func TestService_StartShadowWritesInvalid(t *testing.T) {
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	if err := svc.StartShadowWrites(ShadowConfig{}); err == nil {
+		t.Error("Expected an error without a shadow repository")
+	}
+
+	svc.shadow = repository.NewMockRepository()
+	for _, cfg := range []ShadowConfig{{ReadSampleRate: 1.5}, {ReadSampleRate: 0.5}} {
+		if err := svc.StartShadowWrites(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
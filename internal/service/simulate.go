@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// SimulateTask runs a task through the stages of the worker pipeline and
+// reports the outcome of each without persisting anything: the task is
+// applied to an in-memory copy of the record it targets. Middleware added
+// with WithTaskMiddleware runs around the apply step like in the worker, the
+// middleware acting on persisted writes does not, so no change is published
+// and the shadow is not written. Custom operations see only the
+// record their payload names by id, which is within the scope of the caller
+// like the IDs of writes
+func (s *Service) SimulateTask(ctx context.Context, req *models.SimulateTaskRequest) (*models.TaskSimulation, error) {
+	payload := req.Payload
+	if len(payload) == 0 {
+		payload = json.RawMessage(`{}`)
+	}
+	id := payloadRecordID(payload)
+	if id != "" {
+		if err := repository.CheckRecordID(ctx, scoped(ctx, id)); err != nil {
+			return nil, err
+		}
+		var err error
+		if payload, err = withPayloadRecordID(payload, scoped(ctx, id)); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	task := &models.InboxTask{
+		ID:        uuid.New().String(),
+		Operation: req.Operation,
+		Payload:   append(json.RawMessage(nil), payload...),
+		Status:    models.TaskStatusProcessing,
+		CreatedAt: now,
+		UpdatedAt: now,
+		TenantID:  TenantFromContext(ctx),
+	}
+
+	scratch := repository.NewMockRepository()
+	apply := chainMiddleware(s.taskMiddleware(), func(ctx context.Context, task *models.InboxTask) error {
+		return applyTask(ctx, s.operations, scratch, task)
+	})
+	result := &models.TaskSimulation{Operation: req.Operation, Steps: []*models.SimulationStep{}}
+
+	steps := []struct {
+		name string
+		skip bool
+		run  func() error
+	}{
+		{"transform", !req.ApplyTransforms, func() (err error) {
+			task, err = s.transformTask(task)
+			return err
+		}},
+		{"validate", false, func() error {
+			return validateOperation(s.operations, task.Operation)
+		}},
+		{"enrich", s.worker == nil || s.worker.enricher == nil || !s.worker.enricher.Enabled(task.Operation), func() error {
+			return s.worker.enrichTask(ctx, task)
+		}},
+		{"apply", false, func() error {
+			before, err := simulationRecord(ctx, s.repo.Record, payloadRecordID(task.Payload))
+			if err != nil {
+				return err
+			}
+			if before != nil {
+				scratch.Seed(before)
+			}
+			result.RecordID, result.Before = id, unscopedRecord(ctx, before)
+			return apply(ctx, task)
+		}},
+	}
+
+	var failure, err error
+	for _, step := range steps {
+		result.Steps = append(result.Steps, &models.SimulationStep{Name: step.name, Skipped: step.skip || failure != nil})
+		if step.skip || failure != nil {
+			continue
+		}
+		stepStart := time.Now()
+		err := step.run()
+		simulated := result.Steps[len(result.Steps)-1]
+		simulated.DurationMs = float64(time.Since(stepStart).Microseconds()) / 1000
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			simulated.Error = err.Error()
+			failure = err
+		}
+	}
+	result.Payload = task.Payload
+	if id != "" {
+		if result.Payload, err = withPayloadRecordID(task.Payload, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if failure != nil {
+		result.Status = models.TaskStatusFailed
+		result.Error = failure.Error()
+		// The worker retries every failure but a version conflict and an
+		// enriched value violating its schema
+		result.Retryable = !errors.Is(failure, models.ErrVersionConflict) && !errors.Is(failure, models.ErrSchemaValidation)
+		return result, nil
+	}
+	result.Status = models.TaskStatusCompleted
+	result.Result = task.Result
+	after, err := simulationRecord(ctx, scratch, payloadRecordID(task.Payload))
+	if err != nil {
+		return nil, err
+	}
+	result.After = unscopedRecord(ctx, after)
+	return result, nil
+}
+
+// withPayloadRecordID returns payload with its id set to id
+func withPayloadRecordID(payload json.RawMessage, id string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("invalid task payload: %w", err)
+	}
+	encoded, err := json.Marshal(id)
+	if err != nil {
+		return nil, err
+	}
+	fields["id"] = encoded
+	return json.Marshal(fields)
+}
+
+// unscopedRecord returns a copy of record with the ID the caller knows it
+// by, nil for nil
+func unscopedRecord(ctx context.Context, record *models.Record) *models.Record {
+	if record == nil {
+		return nil
+	}
+	copied := *record
+	copied.ID = unscoped(ctx, record.ID)
+	return &copied
+}
+
+// simulationRecord reads the record id of a simulated task from records,
+// nil when the task names none or it does not exist
+func simulationRecord(ctx context.Context, records repository.RecordRepository, id string) (*models.Record, error) {
+	if id == "" {
+		return nil, nil
+	}
+	record, err := records.Get(ctx, id)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record %s: %w", id, err)
+	}
+	return record, nil
+}
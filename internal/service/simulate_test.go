@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_SimulateTask(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	pipeline, err := ParseTransforms("lowercase:email")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithTransforms(pipeline))
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"email": "a@example.com"})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := mock.Update(ctx, &models.Record{ID: "a", Value: models.MustEncodeValue(map[string]interface{}{"email": "b@example.com"})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result, err := svc.SimulateTask(ctx, &models.SimulateTaskRequest{
+		Operation:       models.TaskOperationUpdate,
+		Payload:         json.RawMessage(`{"id": "a", "value": {"email": "C@EXAMPLE.COM"}, "expected_version": 2}`),
+		ApplyTransforms: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != models.TaskStatusCompleted || result.Before == nil || result.After == nil {
+		t.Fatalf("Expected the update completed with the record before and after, got %+v", result)
+	}
+	if valueField(result.Before, "email") != "b@example.com" || valueField(result.After, "email") != "c@example.com" || result.After.Version != 3 {
+		t.Errorf("Expected the transformed value applied as version 3, got %s version %d", result.After.Value, result.After.Version)
+	}
+	record, _ := mock.Get(ctx, "a")
+	if valueField(record, "email") != "b@example.com" || record.Version != 2 {
+		t.Errorf("Expected the record left as is, got %s version %d", record.Value, record.Version)
+	}
+	if tasks := mock.GetAllTasksForTesting(); len(tasks) != 0 {
+		t.Errorf("Expected no task queued, got %d", len(tasks))
+	}
+
+	// A stale version fails for good, a malformed payload is retried
+	result, err = svc.SimulateTask(ctx, &models.SimulateTaskRequest{
+		Operation: models.TaskOperationDelete,
+		Payload:   json.RawMessage(`{"id": "a", "expected_version": 1}`),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != models.TaskStatusFailed || result.Retryable || result.Steps[3].Error == "" {
+		t.Errorf("Expected the delete failed at apply without retries, got %+v", result)
+	}
+	result, err = svc.SimulateTask(ctx, &models.SimulateTaskRequest{Operation: models.TaskOperationInsert, Payload: json.RawMessage(`{"id": 7}`)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != models.TaskStatusFailed || !result.Retryable {
+		t.Errorf("Expected the malformed insert failed and retried, got %+v", result)
+	}
+
+	result, err = svc.SimulateTask(ctx, &models.SimulateTaskRequest{Operation: "reindex"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Steps[1].Name != "validate" || result.Steps[1].Error == "" || !result.Steps[3].Skipped {
+		t.Errorf("Expected the unknown operation rejected by validate, got %+v", result.Steps)
+	}
+}
+
+func TestService_SimulateTaskScope(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: TenantRecordPrefix + "acme/a", Value: models.MustEncodeValue(map[string]interface{}{"n": 1})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The payload ID is the caller's, so acme's record is simulated under
+	// its own ID
+	acme := ConfineToScope(WithTenant(ctx, "acme"))
+	result, err := svc.SimulateTask(acme, &models.SimulateTaskRequest{
+		Operation: models.TaskOperationUpdate,
+		Payload:   json.RawMessage(`{"id": "a", "value": {"n": 2}}`),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RecordID != "a" || result.Before == nil || result.Before.ID != "a" || result.After.ID != "a" || payloadRecordID(result.Payload) != "a" {
+		t.Errorf("Expected acme's record a simulated under its own ID, got %+v", result)
+	}
+
+	// Other tenants and anonymous callers cannot name it
+	for _, ctx := range []context.Context{ConfineToScope(WithTenant(ctx, "globex")), ConfineToScope(ctx)} {
+		_, err := svc.SimulateTask(ctx, &models.SimulateTaskRequest{
+			Operation: models.TaskOperationDelete,
+			Payload:   json.RawMessage(`{"id": "` + TenantRecordPrefix + `acme/a"}`),
+		})
+		if !errors.Is(err, models.ErrSystemRecord) {
+			t.Errorf("Expected the record of another tenant rejected, got %v", err)
+		}
+	}
+}
+
+func TestService_SimulateTaskMiddleware(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	rejected := errors.New("rejected by middleware")
+	reject := func(next TaskStep) TaskStep {
+		return func(ctx context.Context, task *models.InboxTask) error {
+			if payloadRecordID(task.Payload) == "blocked" {
+				return rejected
+			}
+			return next(ctx, task)
+		}
+	}
+	svc.StartInboxWorker(1, 10, time.Hour, 1, time.Millisecond, WithTaskMiddleware(reject))
+	defer svc.StopInboxWorker()
+
+	changes, err := svc.SubscribeChanges(ctx, models.ChangeFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The middleware of the worker runs around apply
+	result, err := svc.SimulateTask(ctx, &models.SimulateTaskRequest{
+		Operation: models.TaskOperationInsert,
+		Payload:   json.RawMessage(`{"id": "blocked", "value": {"n": 1}}`),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != models.TaskStatusFailed || result.Steps[3].Error != rejected.Error() {
+		t.Errorf("Expected the insert rejected by the middleware at apply, got %+v", result)
+	}
+
+	// The middleware publishing persisted writes does not
+	result, err = svc.SimulateTask(ctx, &models.SimulateTaskRequest{
+		Operation: models.TaskOperationInsert,
+		Payload:   json.RawMessage(`{"id": "allowed", "value": {"n": 1}}`),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != models.TaskStatusCompleted {
+		t.Fatalf("Expected the insert completed, got %+v", result)
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("Expected no change published, got %+v", change)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
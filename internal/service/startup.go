@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// Startup steps an instance completes before it takes traffic, in order
+const (
+	StartupStepRepository  = "repository"   // connections open and schema initialized
+	StartupStepInboxWorker = "inbox_worker" // worker started
+	StartupStepWarmUp      = "warmup"       // hot records pre-read
+)
+
+var startupSteps = []string{StartupStepRepository, StartupStepInboxWorker, StartupStepWarmUp}
+
+// startupTracker records completed startup steps
+type startupTracker struct {
+	mu    sync.Mutex
+	steps map[string]models.StartupStep
+}
+
+func newStartupTracker() *startupTracker {
+	return &startupTracker{steps: make(map[string]models.StartupStep, len(startupSteps))}
+}
+
+// complete marks a step done
+func (t *startupTracker) complete(name, detail string) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps[name] = models.StartupStep{Name: name, Done: true, CompletedAt: &now, Detail: detail}
+}
+
+// status reports every step, ready once all are done
+func (t *startupTracker) status() *models.StartupStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := &models.StartupStatus{Ready: true}
+	for _, name := range startupSteps {
+		step, ok := t.steps[name]
+		if !ok {
+			step = models.StartupStep{Name: name}
+			status.Ready = false
+		}
+		status.Steps = append(status.Steps, step)
+	}
+	return status
+}
+
+// StartupStatus reports which startup steps have completed
+func (s *Service) StartupStatus() *models.StartupStatus {
+	return s.startup.status()
+}
+
+// WarmUp reads the given hot records so the connection pools and the
+// database buffer cache are warm, and loads the schemas of their types into
+// the schema cache. Missing records and read errors are logged and skipped;
+// the warm-up step completes either way so a bad ID cannot hold an instance
+// out of rotation
+func (s *Service) WarmUp(ctx context.Context, ids []string) int {
+	start := time.Now()
+	warmed := 0
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			log.Printf("Warm-up interrupted after %d of %d records: %v", warmed, len(ids), ctx.Err())
+			break
+		}
+
+		record, err := s.repo.Record.Get(ctx, id)
+		if errors.Is(err, models.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Warm-up of record %s failed: %v", id, err)
+			continue
+		}
+		warmed++
+
+		if record.Type != "" {
+			if _, err := s.schemas.lookup(ctx, record.Type); err != nil {
+				log.Printf("Warm-up of record type %s failed: %v", record.Type, err)
+			}
+		}
+	}
+
+	s.startup.complete(StartupStepWarmUp, fmt.Sprintf("warmed %d of %d records", warmed, len(ids)))
+	log.Printf("Warm-up completed: %d of %d records in %v", warmed, len(ids), time.Since(start))
+	return warmed
+}
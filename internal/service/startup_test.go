@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestService_StartupSteps(t *testing.T) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock}
+	ctx := context.Background()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "hot", Value: models.MustEncodeValue(map[string]interface{}{"x": 1})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	svc := NewService(repo, metrics.NewMetrics())
+	if svc.StartupStatus().Ready {
+		t.Fatal("Expected service not to be ready before the worker starts")
+	}
+
+	svc.StartInboxWorker(1, 1, time.Hour, 1, time.Second)
+	defer svc.Close()
+	if svc.StartupStatus().Ready {
+		t.Fatal("Expected service not to be ready before the warm-up")
+	}
+
+	if warmed := svc.WarmUp(ctx, []string{"hot", "missing"}); warmed != 1 {
+		t.Errorf("Expected 1 warmed record, got %d", warmed)
+	}
+
+	status := svc.StartupStatus()
+	if !status.Ready {
+		t.Fatalf("Expected service to be ready, got %+v", status.Steps)
+	}
+	if len(status.Steps) != 3 || status.Steps[2].Detail != "warmed 1 of 2 records" {
+		t.Errorf("Unexpected steps: %+v", status.Steps)
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/repository"
+)
+
+// tableStatsMonitor periodically exports table size and dead-tuple estimates
+// as gauges, so inbox bloat from task churn shows up on dashboards
+type tableStatsMonitor struct {
+	repo     *repository.RepositoryManager
+	metrics  *metrics.Metrics
+	interval time.Duration
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// newTableStatsMonitor creates a monitor collecting every interval
+func newTableStatsMonitor(repo *repository.RepositoryManager, m *metrics.Metrics, interval time.Duration) *tableStatsMonitor {
+	return &tableStatsMonitor{
+		repo:     repo,
+		metrics:  m,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start collects once right away and then on every tick
+func (t *tableStatsMonitor) Start() {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		t.collect()
+		for {
+			select {
+			case <-t.stopCh:
+				return
+			case <-ticker.C:
+				t.collect()
+			}
+		}
+	}()
+}
+
+// Stop stops the monitor and waits for a running collection to finish
+func (t *tableStatsMonitor) Stop() {
+	t.once.Do(func() { close(t.stopCh) })
+	t.wg.Wait()
+}
+
+// collect queries table statistics and updates the gauges
+func (t *tableStatsMonitor) collect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stats, err := t.repo.TableStats(ctx)
+	if err != nil {
+		log.Printf("Table stats monitor: failed to collect table stats: %v", err)
+		return
+	}
+
+	for _, s := range stats {
+		t.metrics.SetTableStats(s.Table, s.TotalBytes, s.IndexBytes, s.LiveTuples, s.DeadTuples)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+// maxTraceDecisions bounds the decisions kept per task trace
+const maxTraceDecisions = 50
+
+// WithTaskTracing makes the worker record a processing trace of each task
+// attempt - the stages it went through and the decisions taken - and store
+// it on the task instead of logging the steps
+func WithTaskTracing() WorkerOption {
+	return func(w *InboxWorker) {
+		w.tracing = true
+	}
+}
+
+// taskTrace records the processing of one task attempt. It travels in the
+// task context; all methods work on a nil *taskTrace by logging what a trace
+// would record, so the worker records unconditionally
+type taskTrace struct {
+	start time.Time
+
+	mu    sync.Mutex
+	trace models.TaskTrace
+	stage string // stage running, empty between stages
+}
+
+type taskTraceKey struct{}
+
+// newTaskTrace starts the trace of an attempt of task by worker workerID
+func newTaskTrace(workerID int, task *models.InboxTask) *taskTrace {
+	start := time.Now()
+	return &taskTrace{
+		start: start,
+		trace: models.TaskTrace{
+			Attempt:   task.Retries + 1,
+			Worker:    workerID,
+			StartedAt: start,
+			Stages:    []*models.TaskTraceStage{},
+			Decisions: []*models.TaskDecision{},
+		},
+	}
+}
+
+// withTaskTrace returns a context carrying t
+func withTaskTrace(ctx context.Context, t *taskTrace) context.Context {
+	return context.WithValue(ctx, taskTraceKey{}, t)
+}
+
+// taskTraceFromContext returns the trace of ctx, nil when the task is not
+// traced
+func taskTraceFromContext(ctx context.Context) *taskTrace {
+	t, _ := ctx.Value(taskTraceKey{}).(*taskTrace)
+	return t
+}
+
+// enter starts timing stage name and returns the function ending it with
+// the stage's error, e.g. end := trace.enter("persist"); err := ...; end(err)
+func (t *taskTrace) enter(name string) func(err error) {
+	if t == nil {
+		return func(error) {}
+	}
+
+	start := time.Now()
+	t.mu.Lock()
+	t.stage = name
+	t.mu.Unlock()
+	return func(err error) {
+		stage := &models.TaskTraceStage{
+			Name:       name,
+			StartMs:    float64(start.Sub(t.start).Microseconds()) / 1000,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			stage.Error = err.Error()
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.trace.Stages = append(t.trace.Stages, stage)
+		t.stage = ""
+	}
+}
+
+// decide records a decision of the stage running, logging it instead when
+// the task is not traced
+func (t *taskTrace) decide(decision, format string, args ...interface{}) {
+	detail := fmt.Sprintf(format, args...)
+	if t == nil {
+		log.Print(detail)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.trace.Decisions) < maxTraceDecisions {
+		t.trace.Decisions = append(t.trace.Decisions, &models.TaskDecision{Decision: decision, Stage: t.stage, Detail: detail})
+	}
+}
+
+// note logs a step the stages of a trace already show, only when the task
+// is not traced
+func (t *taskTrace) note(format string, args ...interface{}) {
+	if t == nil {
+		log.Printf(format, args...)
+	}
+}
+
+// finish ends the trace with the status the attempt left the task in and
+// returns it
+func (t *taskTrace) finish(outcome string, err error) *models.TaskTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	trace := t.trace
+	trace.DurationMs = float64(time.Since(t.start).Microseconds()) / 1000
+	trace.Outcome = outcome
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	return &trace
+}
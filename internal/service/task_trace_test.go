@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+func TestInboxWorker_TaskTrace(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics())
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: json.RawMessage(`{"name": "Ada"}`)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	inserted, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Both updates expect version 1, the second finds the first applied
+	var conflicting *models.InboxTask
+	for _, name := range []string{"Bob", "Eve"} {
+		conflicting, err = svc.Update(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": name}), ExpectedVersion: 1})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 3, time.Millisecond, WithTaskTracing())
+
+	traced := func(id string) *models.InboxTask {
+		t.Helper()
+		var task *models.InboxTask
+		waitFor(t, "the trace of task "+id, func() bool {
+			task, err = svc.GetTask(ctx, id)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			return task.Trace != nil
+		})
+		return task
+	}
+
+	trace := traced(inserted.ID).Trace
+	var stages []string
+	for _, stage := range trace.Stages {
+		stages = append(stages, stage.Name)
+	}
+	if trace.Outcome != models.TaskStatusCompleted || trace.Attempt != 1 || len(stages) != 3 || stages[0] != "validate" || stages[2] != "persist" {
+		t.Errorf("Expected a completed first attempt through validate, transform and persist, got %+v with stages %v", trace, stages)
+	}
+	if len(trace.Decisions) != 1 || trace.Decisions[0].Decision != models.TaskDecisionIdempotentSkip || trace.Decisions[0].Stage != "persist" {
+		t.Errorf("Expected an idempotent skip while persisting, got %+v", trace.Decisions)
+	}
+
+	trace = traced(conflicting.ID).Trace
+	if trace.Outcome != models.TaskStatusFailed || trace.Error == "" {
+		t.Errorf("Expected the conflicting update failed, got %+v", trace)
+	}
+	if len(trace.Decisions) != 1 || trace.Decisions[0].Decision != models.TaskDecisionVersionConflict || trace.Decisions[0].Stage != "" {
+		t.Errorf("Expected a version conflict decision outside the stages, got %+v", trace.Decisions)
+	}
+
+	if _, err := svc.GetTask(ctx, "nope"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected an unknown task not found, got %v", err)
+	}
+}
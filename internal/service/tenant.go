@@ -0,0 +1,38 @@
+package service
+
+import "context"
+
+// TenantRecordPrefix is the ID prefix of the records of tenants, followed by
+// the tenant ID. Tenant records are system records, so they never show up
+// outside their tenant
+const TenantRecordPrefix = "_system/tenants/"
+
+// ValidTenantID reports whether id can identify a tenant, with the syntax of
+// collection names
+func ValidTenantID(id string) bool {
+	return scopeName.MatchString(id)
+}
+
+// tenantContextKey is the context key of the tenant of a request
+type tenantContextKey struct{}
+
+// WithTenant returns a context whose record reads and writes are confined
+// to the tenant id, and whose tasks are queued as the tenant's
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, id)
+}
+
+// TenantFromContext returns the tenant of ctx, empty without tenancy
+func TenantFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantContextKey{}).(string)
+	return id
+}
+
+// tenantPrefix returns the ID prefix of the records of the tenant of ctx,
+// empty without a tenant
+func tenantPrefix(ctx context.Context) string {
+	if id := TenantFromContext(ctx); id != "" {
+		return TenantRecordPrefix + id + "/"
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestService_Tenants(t *testing.T) {
+	ctx := context.Background()
+	acme, globex := WithTenant(ctx, "acme"), WithTenant(ctx, "globex")
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	// Queued before the worker starts, so the tasks are still open
+	insert := func(ctx context.Context, name string) *models.InboxTask {
+		t.Helper()
+		task, err := svc.Insert(ctx, &models.InsertRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": name})})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return task
+	}
+	acmeTask := insert(acme, "Ada")
+	insert(globex, "Bob")
+	insert(WithCollection(acme, "archive"), "Cy")
+	if acmeTask.TenantID != "acme" {
+		t.Errorf("Expected the task queued as acme's, got %q", acmeTask.TenantID)
+	}
+	counts, err := mock.CountOpenTasksByTenant(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(counts) != 2 || counts["acme"] != 2 || counts["globex"] != 1 {
+		t.Errorf("Expected 2 open tasks of acme and 1 of globex, got %v", counts)
+	}
+
+	svc.StartInboxWorker(1, 10, 5*time.Millisecond, 1, time.Millisecond)
+	if err := svc.WaitForWrite(acme, acmeTask.ID); err != nil {
+		t.Fatalf("Insert not applied: %v", err)
+	}
+	if _, err := svc.GetTask(globex, acmeTask.ID); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected no task of another tenant, got %v", err)
+	}
+	if statuses, err := svc.GetTaskStatuses(globex, []string{acmeTask.ID}); err != nil || len(statuses.Missing) != 1 {
+		t.Errorf("Expected the task of another tenant missing, got %+v, %v", statuses, err)
+	}
+	for _, tt := range []struct {
+		ctx   context.Context
+		tasks int
+	}{{acme, 2}, {globex, 1}, {ctx, 0}, {WithSandbox(acme, "demo"), 0}} {
+		list, err := svc.GetTasks(tt.ctx, "", 10, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(list.Tasks) != tt.tasks {
+			t.Errorf("Expected %d tasks of tenant %q, got %d", tt.tasks, TenantFromContext(tt.ctx), len(list.Tasks))
+		}
+		for _, task := range list.Tasks {
+			if task.TenantID != TenantFromContext(tt.ctx) || strings.HasPrefix(task.ID, "_system/") {
+				t.Errorf("Expected the tasks of tenant %q under their own IDs, got %s of %q", TenantFromContext(tt.ctx), task.ID, task.TenantID)
+			}
+		}
+	}
+	waitFor(t, "the inserts", func() bool {
+		counts, _ := mock.CountOpenTasksByTenant(ctx)
+		return len(counts) == 0
+	})
+
+	for _, tt := range []struct {
+		ctx  context.Context
+		name string
+	}{{acme, "Ada"}, {globex, "Bob"}} {
+		record, err := svc.Get(tt.ctx, "user_1")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if record.ID != "user_1" || valueField(record, "name") != tt.name {
+			t.Errorf("Expected the record of %s as user_1, got %s: %v", tt.name, record.ID, valueField(record, "name"))
+		}
+		list, err := svc.ListRecords(tt.ctx, "", 10, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(list.Records) != 1 || valueField(list.Records[0], "name") != tt.name {
+			t.Errorf("Expected only the record of %s listed, got %+v", tt.name, list.Records)
+		}
+	}
+	if _, err := svc.Get(ctx, "user_1"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected no record outside the tenants, got %v", err)
+	}
+
+	collections, err := svc.ListCollections(globex)
+	if err != nil || len(collections.Collections) != 0 {
+		t.Errorf("Expected no collections of globex, got %+v, %v", collections, err)
+	}
+	if stats, err := svc.GetCollection(acme, "archive"); err != nil || stats.Records != 1 {
+		t.Errorf("Expected the archive of acme with 1 record, got %+v, %v", stats, err)
+	}
+}
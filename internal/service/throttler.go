@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mit-service/internal/metrics"
+)
+
+// throttleCheckInterval limits how often runtime stats are sampled, since
+// reading memory stats briefly stops the world
+const throttleCheckInterval = time.Second
+
+// throttler decides whether the worker should back off based on process
+// memory and goroutine counts
+type throttler struct {
+	metrics        *metrics.Metrics
+	maxMemoryBytes uint64
+	maxGoroutines  int
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	throttled bool
+	reason    string
+}
+
+// newThrottler creates a throttler; a zero threshold disables that check
+func newThrottler(m *metrics.Metrics, maxMemoryMB int, maxGoroutines int) *throttler {
+	return &throttler{
+		metrics:        m,
+		maxMemoryBytes: uint64(maxMemoryMB) * 1024 * 1024,
+		maxGoroutines:  maxGoroutines,
+	}
+}
+
+// Check reports whether the worker is currently throttled and why
+func (t *throttler) Check() (bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Since(t.lastCheck) < throttleCheckInterval {
+		return t.throttled, t.reason
+	}
+	t.lastCheck = time.Now()
+
+	goroutines, memoryBytes := t.metrics.SystemUsage()
+
+	wasThrottled := t.throttled
+	t.throttled = false
+	t.reason = ""
+
+	switch {
+	case t.maxMemoryBytes > 0 && memoryBytes > t.maxMemoryBytes:
+		t.throttled = true
+		t.reason = "memory"
+	case t.maxGoroutines > 0 && goroutines > t.maxGoroutines:
+		t.throttled = true
+		t.reason = "goroutines"
+	}
+
+	if t.throttled {
+		t.metrics.RecordThrottleEvent(t.reason)
+		if !wasThrottled {
+			log.Printf("Inbox worker throttled: %s", t.describe(goroutines, memoryBytes))
+		}
+	} else if wasThrottled {
+		log.Printf("Inbox worker throttling lifted: %s", t.describe(goroutines, memoryBytes))
+	}
+
+	return t.throttled, t.reason
+}
+
+// describe formats current usage against thresholds for logging
+func (t *throttler) describe(goroutines int, memoryBytes uint64) string {
+	return fmt.Sprintf("memory %dMB (limit %dMB), goroutines %d (limit %d)",
+		memoryBytes/1024/1024, t.maxMemoryBytes/1024/1024, goroutines, t.maxGoroutines)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// transformStep is one parsed step of a write transformation pipeline
+type transformStep struct {
+	spec  string
+	apply func(value map[string]interface{}) error
+}
+
+// TransformPipeline rewrites record values on write, before schema
+// validation and before the task is enqueued, so the worker stores exactly
+// what was validated
+type TransformPipeline struct {
+	steps []transformStep
+}
+
+// ParseTransforms parses a ";"-separated list of transformation steps:
+//
+//	lowercase:<field>            lower-case a string field
+//	uppercase:<field>            upper-case a string field
+//	trim:<field>                 trim surrounding whitespace of a string field
+//	set:<field>=<value>          set a field to a string, "$now" is the write time
+//	hash:<field>=<src>[,<src>]   set a field to the SHA-256 of the source fields
+//
+// Fields are dotted paths into the value, e.g. "profile.email"; steps on
+// missing or non-string fields are skipped
+func ParseTransforms(spec string) (*TransformPipeline, error) {
+	pipeline := &TransformPipeline{}
+
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kind, arg, ok := strings.Cut(part, ":")
+		if !ok || arg == "" {
+			return nil, fmt.Errorf("invalid transform %q, expected kind:args", part)
+		}
+
+		var apply func(map[string]interface{}) error
+		switch kind {
+		case "lowercase":
+			apply = mapString(arg, strings.ToLower)
+		case "uppercase":
+			apply = mapString(arg, strings.ToUpper)
+		case "trim":
+			apply = mapString(arg, strings.TrimSpace)
+		case "set":
+			field, literal, ok := strings.Cut(arg, "=")
+			if !ok || field == "" {
+				return nil, fmt.Errorf("invalid transform %q, expected set:field=value", part)
+			}
+			apply = setField(field, literal)
+		case "hash":
+			field, sources, ok := strings.Cut(arg, "=")
+			if !ok || field == "" || sources == "" {
+				return nil, fmt.Errorf("invalid transform %q, expected hash:field=source[,source]", part)
+			}
+			apply = hashFields(field, strings.Split(sources, ","))
+		default:
+			return nil, fmt.Errorf("unknown transform %q", kind)
+		}
+
+		pipeline.steps = append(pipeline.steps, transformStep{spec: part, apply: apply})
+	}
+
+	return pipeline, nil
+}
+
+// Len returns the number of steps
+func (p *TransformPipeline) Len() int {
+	return len(p.steps)
+}
+
+// Apply runs every step on value in order
+func (p *TransformPipeline) Apply(value map[string]interface{}) error {
+	for _, step := range p.steps {
+		if err := step.apply(value); err != nil {
+			return fmt.Errorf("transform %q failed: %w", step.spec, err)
+		}
+	}
+	return nil
+}
+
+// mapString replaces a string field with fn applied to it
+func mapString(field string, fn func(string) string) func(map[string]interface{}) error {
+	path := strings.Split(field, ".")
+	return func(value map[string]interface{}) error {
+		if str, ok := lookupField(value, path).(string); ok {
+			setPath(value, path, fn(str))
+		}
+		return nil
+	}
+}
+
+// setField sets a field to a literal string or the write time
+func setField(field, literal string) func(map[string]interface{}) error {
+	path := strings.Split(field, ".")
+	return func(value map[string]interface{}) error {
+		if literal == "$now" {
+			setPath(value, path, time.Now().UTC().Format(time.RFC3339))
+		} else {
+			setPath(value, path, literal)
+		}
+		return nil
+	}
+}
+
+// hashFields sets a field to the hex SHA-256 of the JSON encoding of the
+// source fields, missing sources hash as null
+func hashFields(field string, sources []string) func(map[string]interface{}) error {
+	path := strings.Split(field, ".")
+	sourcePaths := make([][]string, len(sources))
+	for i, source := range sources {
+		sourcePaths[i] = strings.Split(strings.TrimSpace(source), ".")
+	}
+
+	return func(value map[string]interface{}) error {
+		values := make([]interface{}, len(sourcePaths))
+		for i, sourcePath := range sourcePaths {
+			values[i] = lookupField(value, sourcePath)
+		}
+
+		// Map keys are encoded sorted, so equal values hash equally
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(encoded)
+		setPath(value, path, hex.EncodeToString(sum[:]))
+		return nil
+	}
+}
+
+// lookupField returns the value at a dotted path, nil when missing
+func lookupField(value map[string]interface{}, path []string) interface{} {
+	var current interface{} = value
+	for _, key := range path {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = obj[key]
+	}
+	return current
+}
+
+// setPath sets the value at a dotted path, creating intermediate objects
+func setPath(value map[string]interface{}, path []string, v interface{}) {
+	obj := value
+	for _, key := range path[:len(path)-1] {
+		next, ok := obj[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			obj[key] = next
+		}
+		obj = next
+	}
+	obj[path[len(path)-1]] = v
+}
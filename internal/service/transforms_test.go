@@ -0,0 +1,39 @@
+package service
+
+import "testing"
+
+func TestTransformPipeline(t *testing.T) {
+	pipeline, err := ParseTransforms("trim:email; lowercase:email; set:meta.updated_by=api; hash:email_hash=email")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	value := map[string]interface{}{"email": "  John@Example.COM "}
+	if err := pipeline.Apply(value); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if value["email"] != "john@example.com" {
+		t.Errorf("Expected normalized email, got %v", value["email"])
+	}
+
+	meta, _ := value["meta"].(map[string]interface{})
+	if meta["updated_by"] != "api" {
+		t.Errorf("Expected meta.updated_by=api, got %v", value["meta"])
+	}
+
+	// The hash only depends on the (normalized) source fields
+	other := map[string]interface{}{"email": "JOHN@example.com", "name": "ignored"}
+	if err := pipeline.Apply(other); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value["email_hash"] != other["email_hash"] {
+		t.Errorf("Expected equal hashes, got %v and %v", value["email_hash"], other["email_hash"])
+	}
+
+	for _, spec := range []string{"lowercase", "reverse:name", "set:=x", "hash:h="} {
+		if _, err := ParseTransforms(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
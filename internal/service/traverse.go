@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mit-service/internal/models"
+	"mit-service/internal/reqtrace"
+)
+
+// MaxTraversalDepth is the deepest a traversal may follow references
+const MaxTraversalDepth = 10
+
+// maxTraversalRecords bounds the records a traversal returns
+const maxTraversalRecords = 1000
+
+// Traverse returns the records reachable from the record start by following
+// up to depth references, breadth first, with the references followed.
+// Each record is returned once, so cycles end the walk. References to
+// records that do not exist, or are out of reach, are listed as missing. It
+// fails with models.ErrRecordNotFound when start does not exist
+func (s *Service) Traverse(ctx context.Context, start string, depth int) (*models.Traversal, error) {
+	defer reqtrace.FromContext(ctx).Span("service", "Traverse")()
+
+	if depth < 0 || depth > MaxTraversalDepth {
+		return nil, fmt.Errorf("%w: depth must be between 0 and %d", models.ErrInvalidTraversal, MaxTraversalDepth)
+	}
+
+	record, err := s.Get(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.Traversal{
+		Start:   start,
+		Depth:   depth,
+		Records: []*models.Record{record},
+		Edges:   []models.ReferenceEdge{},
+	}
+	seen := map[string]bool{start: true}
+	frontier := []*models.Record{record}
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		var next []*models.Record
+		for _, record := range frontier {
+			refs, err := s.outgoingReferences(ctx, record)
+			if err != nil {
+				return nil, err
+			}
+			for _, ref := range refs {
+				result.Edges = append(result.Edges, models.ReferenceEdge{From: record.ID, To: ref.ID, Field: ref.Field})
+				if seen[ref.ID] {
+					continue
+				}
+				seen[ref.ID] = true
+
+				if len(result.Records) == maxTraversalRecords {
+					result.Truncated = true
+					return result, nil
+				}
+				target, err := s.Get(ctx, ref.ID)
+				if errors.Is(err, models.ErrRecordNotFound) || errors.Is(err, models.ErrSystemRecord) {
+					result.Missing = append(result.Missing, ref.ID)
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				result.Records = append(result.Records, target)
+				next = append(next, target)
+			}
+		}
+		frontier = next
+	}
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"mit-service/internal/models"
+)
+
+func TestService_Traverse(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	ref := map[string]interface{}{"type": "string", "x-reference": map[string]interface{}{}}
+	err := svc.PutRecordType(ctx, &models.RecordType{Name: "node", Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"next": ref, "other": ref},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// a -> b -> c -> a, and b -> gone
+	for id, value := range map[string]string{
+		"a": `{"next": "b"}`,
+		"b": `{"next": "c", "other": "gone"}`,
+		"c": `{"next": "a"}`,
+	} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Type: "node", Value: json.RawMessage(value)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	ids := func(records []*models.Record) []string {
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+		return ids
+	}
+
+	result, err := svc.Traverse(ctx, "a", 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := ids(result.Records); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected a and b at depth 1, got %v", got)
+	}
+
+	result, err = svc.Traverse(ctx, "a", 5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := ids(result.Records); len(got) != 3 || got[2] != "c" {
+		t.Errorf("Expected a, b and c once each, got %v", got)
+	}
+	if len(result.Edges) != 4 || len(result.Missing) != 1 || result.Missing[0] != "gone" {
+		t.Errorf("Expected 4 edges and gone missing, got %+v and %v", result.Edges, result.Missing)
+	}
+
+	if _, err := svc.Traverse(ctx, "nope", 1); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound, got %v", err)
+	}
+	if _, err := svc.Traverse(ctx, "a", MaxTraversalDepth+1); !errors.Is(err, models.ErrInvalidTraversal) {
+		t.Errorf("Expected ErrInvalidTraversal, got %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// maxVerifyDivergences bounds the divergences listed in a verify report
+const maxVerifyDivergences = 100
+
+// Shadow names shown in verify reports
+const (
+	shadowMemory     = "memory"
+	shadowRepository = "repository"
+)
+
+// verifyState is what a verify run knows about a record of the shadow
+type verifyState int
+
+const (
+	// verifyUntracked records were not in the shadow when a task changed
+	// them, their state depends on writes before the replay
+	verifyUntracked verifyState = iota
+	verifyTracked
+	verifyFailed
+)
+
+// StartVerify starts replaying the completed tasks selected by req against
+// the shadow repository in the background, then compares every record the
+// replay built with the primary. The primary is only read. Tasks are
+// applied as the worker applies them, without enrichment, in the order they
+// finished, through the middleware added with WithTaskMiddleware but not
+// the middleware acting on persisted writes
+func (s *Service) StartVerify(req *models.VerifyRequest) (*models.VerifyReport, error) {
+	if req.From.IsZero() {
+		return nil, fmt.Errorf("%w: from is required", models.ErrInvalidVerify)
+	}
+	if req.FromID != "" && req.ToID != "" && req.FromID > req.ToID {
+		return nil, fmt.Errorf("%w: from_id must not be after to_id", models.ErrInvalidVerify)
+	}
+	if req.Limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative", models.ErrInvalidVerify)
+	}
+
+	shadow, name := s.shadow, shadowRepository
+	if shadow == nil {
+		shadow, name = repository.NewMockRepository(), shadowMemory
+	}
+
+	report := &models.VerifyReport{
+		Status:      models.ScanRunning,
+		Request:     req,
+		Shadow:      name,
+		StartedAt:   time.Now(),
+		Divergences: []*models.Divergence{},
+	}
+
+	err := s.verify.start(report, func(ctx context.Context) *models.VerifyReport {
+		result := *report
+		defer func() {
+			now := time.Now()
+			result.FinishedAt = &now
+		}()
+
+		if err := s.verifyShadow(ctx, req, shadow, &result); err != nil {
+			result.Status = models.ScanFailed
+			result.Error = err.Error()
+			log.Printf("Verify failed after %d tasks: %v", result.Scanned, err)
+		} else {
+			result.Status = models.ScanCompleted
+			log.Printf("Verify completed: %d tasks replayed, %d records compared, %d divergent",
+				result.Replayed, result.Compared, result.Divergent)
+		}
+		return &result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *report
+	return &copied, nil
+}
+
+// VerifyReport returns the running or last finished verify run, nil when
+// none was started
+func (s *Service) VerifyReport() *models.VerifyReport {
+	return s.verify.last()
+}
+
+// verifyShadow replays the tasks into shadow and compares the records
+func (s *Service) verifyShadow(ctx context.Context, req *models.VerifyRequest, shadow repository.RecordRepository, report *models.VerifyReport) error {
+	apply := chainMiddleware(s.taskMiddleware(), func(ctx context.Context, task *models.InboxTask) error {
+		return applyTask(ctx, s.operations, shadow, task)
+	})
+	states := make(map[string]verifyState)
+	until := time.Now()
+
+	cursor, afterID := req.From, ""
+replay:
+	for {
+		tasks, err := s.repo.Inbox.GetCompletedTasksAfter(ctx, cursor, afterID, scanPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			if task.UpdatedAt.After(until) || (req.Limit > 0 && report.Replayed >= req.Limit) {
+				break replay
+			}
+			cursor, afterID = task.UpdatedAt, task.ID
+			report.Scanned++
+
+			id := payloadRecordID(task.Payload)
+			if len(req.Operations) > 0 && !slices.Contains(req.Operations, task.Operation) {
+				continue
+			}
+			if (req.FromID != "" || req.ToID != "") && !idInRange(id, req.FromID, req.ToID) {
+				continue
+			}
+
+			if err := s.replayShadowTask(ctx, req, apply, shadow, task, id, states, report); err != nil {
+				return err
+			}
+		}
+
+		if len(tasks) < scanPageSize {
+			break
+		}
+	}
+
+	return s.compareShadow(ctx, shadow, states, report)
+}
+
+// replayShadowTask applies one task through apply, tracking the record it
+// changes. Only errors reading the shadow are returned, failures to apply
+// are divergences
+func (s *Service) replayShadowTask(ctx context.Context, req *models.VerifyRequest, apply TaskStep,
+	shadow repository.RecordRepository, task *models.InboxTask, id string, states map[string]verifyState,
+	report *models.VerifyReport) error {
+	state := states[id]
+	if state == verifyFailed {
+		return nil
+	}
+	if state == verifyUntracked && id != "" && task.Operation != models.TaskOperationInsert {
+		if _, err := shadow.Get(ctx, id); err != nil {
+			if !errors.Is(err, models.ErrRecordNotFound) {
+				return fmt.Errorf("failed to read shadow record %s: %w", id, err)
+			}
+			if task.Operation == models.TaskOperationUpdate || task.Operation == models.TaskOperationDelete {
+				report.Skipped++
+				return nil
+			}
+		}
+	}
+
+	replayed := task
+	if req.ApplyTransforms {
+		var err error
+		if replayed, err = s.transformTask(task); err != nil {
+			s.addDivergence(report, states, &models.Divergence{
+				Kind: models.DivergenceApplyFailed, RecordID: id, TaskID: task.ID, Error: err.Error(),
+			})
+			return nil
+		}
+	}
+
+	report.Replayed++
+	if err := apply(ctx, replayed); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.addDivergence(report, states, &models.Divergence{
+			Kind: models.DivergenceApplyFailed, RecordID: id, TaskID: task.ID, Error: err.Error(),
+		})
+		return nil
+	}
+	if id != "" {
+		states[id] = verifyTracked
+	}
+	return nil
+}
+
+// transformTask returns a copy of an insert or update task with the current
+// write transformations applied to its value
+func (s *Service) transformTask(task *models.InboxTask) (*models.InboxTask, error) {
+	if task.Operation != models.TaskOperationInsert && task.Operation != models.TaskOperationUpdate {
+		return task, nil
+	}
+
+	var payload map[string]interface{}
+	if err := models.UnmarshalValue(task.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s payload: %w", task.Operation, err)
+	}
+	if value, ok := payload["value"].(map[string]interface{}); ok {
+		if err := s.transform(value); err != nil {
+			return nil, err
+		}
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", task.Operation, err)
+	}
+	transformed := *task
+	transformed.Payload = encoded
+	return &transformed, nil
+}
+
+// compareShadow compares every tracked record of the shadow with the primary
+func (s *Service) compareShadow(ctx context.Context, shadow repository.RecordRepository, states map[string]verifyState, report *models.VerifyReport) error {
+	ids := make([]string, 0, len(states))
+	for id, state := range states {
+		if state == verifyTracked {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		primary, err := s.repo.Record.Get(ctx, id)
+		if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+			return fmt.Errorf("failed to read record %s: %w", id, err)
+		}
+		copied, err := shadow.Get(ctx, id)
+		if err != nil && !errors.Is(err, models.ErrRecordNotFound) {
+			return fmt.Errorf("failed to read shadow record %s: %w", id, err)
+		}
+		report.Compared++
+
+		switch {
+		case primary == nil && copied == nil:
+		case copied == nil:
+			s.addDivergence(report, states, &models.Divergence{Kind: models.DivergenceMissingInShadow, RecordID: id})
+		case primary == nil:
+			s.addDivergence(report, states, &models.Divergence{Kind: models.DivergenceMissingInPrimary, RecordID: id})
+		case primary.Type != copied.Type:
+			s.addDivergence(report, states, &models.Divergence{
+				Kind: models.DivergenceTypeMismatch, RecordID: id,
+				Error: fmt.Sprintf("type %q in primary, %q in shadow", primary.Type, copied.Type),
+			})
+		default:
+			if changes := diffRecordValues(primary, copied); len(changes) > 0 {
+				s.addDivergence(report, states, &models.Divergence{
+					Kind: models.DivergenceValueMismatch, RecordID: id, Changes: changes,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// addDivergence counts a divergent record and lists the divergence while
+// the report has room
+func (s *Service) addDivergence(report *models.VerifyReport, states map[string]verifyState, divergence *models.Divergence) {
+	if divergence.RecordID == "" || states[divergence.RecordID] != verifyFailed {
+		report.Divergent++
+	}
+	if divergence.RecordID != "" {
+		states[divergence.RecordID] = verifyFailed
+	}
+	if len(report.Divergences) < maxVerifyDivergences {
+		report.Divergences = append(report.Divergences, divergence)
+	}
+}
+
+// idInRange reports whether id lies between from and to, both inclusive
+// and optional. Tasks without a record ID are never in a range
+func idInRange(id, from, to string) bool {
+	return id != "" && (from == "" || id >= from) && (to == "" || id <= to)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// waitForVerify waits for the running verify run to finish
+func waitForVerify(t *testing.T, svc *Service) *models.VerifyReport {
+	t.Helper()
+	var report *models.VerifyReport
+	waitFor(t, "the verify run", func() bool {
+		report = svc.VerifyReport()
+		return report != nil && report.Status != models.ScanRunning
+	})
+	return report
+}
+
+func TestService_Verify(t *testing.T) {
+	ctx := context.Background()
+	mock := repository.NewMockRepository()
+	pipeline, err := ParseTransforms("lowercase:email")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svc := NewService(&repository.RepositoryManager{Record: mock, Inbox: mock}, metrics.NewMetrics(), WithTransforms(pipeline))
+	defer svc.Close()
+
+	// The primary holds the result of the tasks, except b which was changed
+	// outside the inbox and c which is missing
+	for id, email := range map[string]string{"a": "A@EXAMPLE.COM", "b": "edited@example.com"} {
+		if err := mock.Insert(ctx, &models.Record{ID: id, Value: models.MustEncodeValue(map[string]interface{}{"email": email})}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	from := time.Now()
+	time.Sleep(time.Millisecond)
+	finishTask(t, mock, "task_1", models.TaskOperationInsert, `{"id":"a","value":{"email":"A@EXAMPLE.COM"}}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_2", models.TaskOperationInsert, `{"id":"b","value":{"email":"b@example.com"}}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_3", models.TaskOperationInsert, `{"id":"c","value":{"email":"c@example.com"}}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_4", models.TaskOperationUpdate, `{"id":"z","value":{"email":"z@example.com"}}`, models.TaskStatusCompleted)
+	finishTask(t, mock, "task_5", models.TaskOperationInsert, `{"id":"d","value":{}}`, models.TaskStatusFailed)
+
+	if _, err := svc.StartVerify(&models.VerifyRequest{From: from}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report := waitForVerify(t, svc)
+	if report.Status != models.ScanCompleted || report.Shadow != shadowMemory || report.Scanned != 4 ||
+		report.Replayed != 3 || report.Skipped != 1 || report.Compared != 3 || report.Divergent != 2 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if len(report.Divergences) != 2 {
+		t.Fatalf("Expected 2 divergences, got %d", len(report.Divergences))
+	}
+	mismatch, missing := report.Divergences[0], report.Divergences[1]
+	if mismatch.Kind != models.DivergenceValueMismatch || mismatch.RecordID != "b" ||
+		len(mismatch.Changes) != 1 || mismatch.Changes[0].Path != "/email" || mismatch.Changes[0].New != "b@example.com" {
+		t.Errorf("Unexpected divergence %+v", mismatch)
+	}
+	if missing.Kind != models.DivergenceMissingInPrimary || missing.RecordID != "c" {
+		t.Errorf("Unexpected divergence %+v", missing)
+	}
+	if _, err := mock.Get(ctx, "c"); !errors.Is(err, models.ErrRecordNotFound) {
+		t.Errorf("Expected the primary left alone, got %v", err)
+	}
+
+	// Previewing the transformations on a configured shadow flags a, whose
+	// stored value was not lower-cased
+	shadow := repository.NewMockRepository()
+	svc.shadow = shadow
+	if _, err := svc.StartVerify(&models.VerifyRequest{From: from, ToID: "a", ApplyTransforms: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report = waitForVerify(t, svc)
+	if report.Shadow != shadowRepository || report.Replayed != 1 || report.Divergent != 1 ||
+		report.Divergences[0].Changes[0].New != "a@example.com" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if record, err := shadow.Get(ctx, "a"); err != nil || valueField(record, "email") != "a@example.com" {
+		t.Errorf("Expected the transformed value in the shadow, got %v, %v", record, err)
+	}
+}
+
+func TestService_VerifyInvalid(t *testing.T) {
+	svc, _ := newMockService()
+	defer svc.Close()
+
+	from := time.Now()
+	for name, req := range map[string]*models.VerifyRequest{
+		"missing from":   {},
+		"inverted ids":   {From: from, FromID: "b", ToID: "a"},
+		"negative limit": {From: from, Limit: -1},
+	} {
+		if _, err := svc.StartVerify(req); !errors.Is(err, models.ErrInvalidVerify) {
+			t.Errorf("%s: expected ErrInvalidVerify, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mit-service/internal/models"
+)
+
+func TestService_ExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	svc, mock := newMockService()
+	defer svc.Close()
+
+	if err := mock.Insert(ctx, &models.Record{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Ada"})}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record, _ := svc.Get(ctx, "user_1"); record.Version != 1 {
+		t.Fatalf("Expected version 1 after insert, got %d", record.Version)
+	}
+
+	// Writes expecting a version the record does not have are rejected
+	// before they are queued
+	_, err := svc.Update(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Bob"}), ExpectedVersion: 2})
+	if !errors.Is(err, models.ErrVersionConflict) {
+		t.Fatalf("Expected a version conflict, got %v", err)
+	}
+	if _, err := svc.Delete(ctx, &models.DeleteRequest{ID: "user_1", ExpectedVersion: 2}); !errors.Is(err, models.ErrVersionConflict) {
+		t.Fatalf("Expected a version conflict, got %v", err)
+	}
+
+	// Of two writers reading version 1, the first applied wins and the
+	// second fails without retries
+	first, err := svc.Update(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Bob"}), ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := svc.Update(ctx, &models.UpdateRequest{ID: "user_1", Value: models.MustEncodeValue(map[string]interface{}{"name": "Eve"}), ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	svc.StartInboxWorker(1, 10, 10*time.Millisecond, 5, time.Millisecond, WithCoalescing([]string{"user_"}))
+	waitFor(t, "the updates", func() bool {
+		stored, _ := mock.GetTask(ctx, second.ID)
+		return stored != nil && stored.Status == models.TaskStatusFailed
+	})
+
+	if stored, _ := mock.GetTask(ctx, first.ID); stored.Status != models.TaskStatusCompleted {
+		t.Errorf("Expected the first update completed, got %s", stored.Status)
+	}
+	if stored, _ := mock.GetTask(ctx, second.ID); stored.Retries != 1 {
+		t.Errorf("Expected the conflicting update failed on its first attempt, got %d retries", stored.Retries)
+	}
+	record, err := svc.Get(ctx, "user_1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if record.Version != 2 || valueField(record, "name") != "Bob" {
+		t.Errorf("Expected version 2 holding Bob, got version %d holding %v", record.Version, valueField(record, "name"))
+	}
+
+	// Deletes are checked the same way
+	if _, err := svc.Delete(ctx, &models.DeleteRequest{ID: "user_1", ExpectedVersion: 1}); !errors.Is(err, models.ErrVersionConflict) {
+		t.Fatalf("Expected a version conflict, got %v", err)
+	}
+	if _, err := svc.Delete(ctx, &models.DeleteRequest{ID: "user_1", ExpectedVersion: 2}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitFor(t, "the delete", func() bool {
+		_, err := mock.Get(ctx, "user_1")
+		return errors.Is(err, models.ErrRecordNotFound)
+	})
+}
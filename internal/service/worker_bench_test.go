@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"mit-service/internal/metrics"
+	"mit-service/internal/models"
+	"mit-service/internal/repository"
+)
+
+// BenchmarkInboxWorker measures worker throughput in tasks/s on the mock
+// repository for combinations of worker count and batch size
+func BenchmarkInboxWorker(b *testing.B) {
+	// The worker logs every task, which would dominate the measurement
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, workers := range []int{1, 4, 8} {
+		for _, batchSize := range []int{1, 10, 50} {
+			b.Run(fmt.Sprintf("workers=%d/batch=%d", workers, batchSize), func(b *testing.B) {
+				benchmarkInboxWorker(b, workers, batchSize)
+			})
+		}
+	}
+}
+
+func benchmarkInboxWorker(b *testing.B, workers, batchSize int) {
+	mock := repository.NewMockRepository()
+	repo := &repository.RepositoryManager{Record: mock, Inbox: mock, Tx: mock}
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		payload, _ := json.Marshal(&models.InsertTaskPayload{
+			ID:    fmt.Sprintf("record_%d", i),
+			Value: models.MustEncodeValue(map[string]interface{}{"n": i}),
+		})
+		err := mock.CreateTask(ctx, &models.InboxTask{
+			ID:        fmt.Sprintf("task_%d", i),
+			Operation: models.TaskOperationInsert,
+			Payload:   payload,
+			Status:    models.TaskStatusPending,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		})
+		if err != nil {
+			b.Fatalf("Failed to create task: %v", err)
+		}
+	}
+
+	w := NewInboxWorker(repo, metrics.NewMetrics(), workers, batchSize, time.Millisecond, 3, time.Second)
+
+	b.ResetTimer()
+	start := time.Now()
+	w.Start()
+	for {
+		stats, err := mock.GetTaskStats(ctx)
+		if err != nil {
+			b.Fatalf("Failed to get task stats: %v", err)
+		}
+		if stats.CompletedTasks+stats.FailedTasks >= b.N {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+	w.Stop()
+
+	b.ReportMetric(float64(b.N)/elapsed.Seconds(), "tasks/s")
+}
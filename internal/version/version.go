@@ -0,0 +1,33 @@
+// Package version holds the build information, injected at build time with
+//
+//	go build -ldflags "-X mit-service/internal/version.Version=1.2.3 \
+//	  -X mit-service/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X mit-service/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import "runtime"
+
+// Set via -ldflags -X, the defaults identify local builds
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
@@ -0,0 +1,113 @@
+// Package warehouse loads exported rows into an analytics warehouse
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// identifierPattern matches the table names accepted in INSERT statements
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ClickHouseConfig configures the connection to a ClickHouse server
+type ClickHouseConfig struct {
+	// URL is the HTTP interface address, e.g. http://localhost:8123
+	URL      string
+	Database string
+	Username string
+	Password string
+
+	// Timeout bounds every insert
+	Timeout time.Duration
+}
+
+// ClickHouse inserts rows over the HTTP interface in the JSONEachRow format,
+// which matches the keys of a row to the columns of the table
+type ClickHouse struct {
+	cfg  ClickHouseConfig
+	base string
+	http *http.Client
+}
+
+// NewClickHouse creates a ClickHouse client
+func NewClickHouse(cfg ClickHouseConfig) (*ClickHouse, error) {
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid ClickHouse URL %q", cfg.URL)
+	}
+	if !identifierPattern.MatchString(cfg.Database) {
+		return nil, fmt.Errorf("invalid ClickHouse database %q", cfg.Database)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("ClickHouse timeout must be positive, got %v", cfg.Timeout)
+	}
+
+	return &ClickHouse{
+		cfg:  cfg,
+		base: strings.TrimRight(cfg.URL, "/") + "/",
+		http: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Name returns the warehouse name shown in the export status
+func (c *ClickHouse) Name() string {
+	return "clickhouse:" + c.cfg.Database
+}
+
+// ValidTable reports whether table can be inserted into
+func ValidTable(table string) bool {
+	return identifierPattern.MatchString(table)
+}
+
+// Insert appends rows to table in one request. Keys without a column are
+// ignored so the table can omit columns it does not need
+func (c *ClickHouse) Insert(ctx context.Context, table string, rows []map[string]interface{}) error {
+	if !ValidTable(table) {
+		return fmt.Errorf("invalid table name %q", table)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("failed to encode row: %w", err)
+		}
+	}
+
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("INSERT INTO %s.%s FORMAT JSONEachRow", c.cfg.Database, table))
+	query.Set("input_format_skip_unknown_fields", "1")
+	query.Set("date_time_input_format", "best_effort")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+"?"+query.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	if c.cfg.Username != "" {
+		req.Header.Set("X-ClickHouse-User", c.cfg.Username)
+		req.Header.Set("X-ClickHouse-Key", c.cfg.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to insert into %s: %w", table, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("insert into %s returned %d: %s", table, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package warehouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClickHouse_Insert(t *testing.T) {
+	var query, user, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		query, user, body = r.URL.Query().Get("query"), r.Header.Get("X-ClickHouse-User"), string(data)
+		if strings.Contains(body, "fail") {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Code: 27. DB::Exception: Cannot parse input")
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClickHouse(ClickHouseConfig{URL: server.URL, Database: "analytics", Username: "exporter", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rows := []map[string]interface{}{{"task_id": "t1", "retries": 0}, {"task_id": "t2", "retries": 1}}
+	if err := client.Insert(context.Background(), "task_events", rows); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if query != "INSERT INTO analytics.task_events FORMAT JSONEachRow" || user != "exporter" {
+		t.Errorf("Unexpected query %q by %q", query, user)
+	}
+	expected := "{\"retries\":0,\"task_id\":\"t1\"}\n{\"retries\":1,\"task_id\":\"t2\"}\n"
+	if body != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+
+	err = client.Insert(context.Background(), "task_events", []map[string]interface{}{{"task_id": "fail"}})
+	if err == nil || !strings.Contains(err.Error(), "Cannot parse input") {
+		t.Errorf("Expected the server error, got %v", err)
+	}
+	if err := client.Insert(context.Background(), "events; DROP TABLE x", rows); err == nil {
+		t.Error("Expected an invalid table name rejected")
+	}
+}
+
+func TestNewClickHouse_Invalid(t *testing.T) {
+	for _, cfg := range []ClickHouseConfig{
+		{URL: "localhost:8123", Database: "analytics", Timeout: time.Second},
+		{URL: "http://localhost:8123", Database: "analytics.x", Timeout: time.Second},
+		{URL: "http://localhost:8123", Database: "analytics"},
+	} {
+		if _, err := NewClickHouse(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}